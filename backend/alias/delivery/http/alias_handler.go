@@ -0,0 +1,158 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// AliasHandler represent the http handler for aliases of renamed URLs
+type AliasHandler struct {
+	aliasUsecase  domain.AliasUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+}
+
+// NewAliasHandler will initialize the url/:id/aliases resources endpoint
+func NewAliasHandler(au domain.AliasUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) *AliasHandler {
+	return &AliasHandler{
+		aliasUsecase:  au,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+	}
+}
+
+// RegisterRoutes registers routes of API version 1
+func (ah *AliasHandler) RegisterRoutes(e *echo.Echo) {
+	ah.RegisterAPIRoutes(e.Group("/v1"))
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2
+func (ah *AliasHandler) RegisterAPIRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(ah.logger)
+	authenticated := []echo.MiddlewareFunc{echojwt.WithConfig(ah.authenticator.JWTConfig), myMiddl.SpanIdentity("urlid")}
+	g.GET("/url/:id/aliases", ah.Fetch, authenticated...)
+	g.DELETE("/url/:id/aliases/:alias", ah.Delete, authenticated...)
+}
+
+type aliasesResponse struct {
+	Aliases []*domain.Alias `json:"aliases"`
+}
+
+// Fetch will list aliases of URL with their redirect counts, aliases without
+// recent redirects are flagged as cleanup candidates
+func (ah *AliasHandler) Fetch(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := ah.tracer.Start(
+		ctx,
+		"http Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := ah.validator.V.Var(id, "required,max=20,linkid"); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(ah.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	aliases, err := ah.aliasUsecase.Fetch(ctx, id, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, ah.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(attribute.String("urlid", id))
+	span.SetStatus(codes.Ok, "success")
+
+	// all aliases of URL are listed at once, so total is known without
+	// counting
+	total := int64(len(aliases))
+	web.SetPageHeaders(c, &total, nil, nil)
+
+	return web.RespondList(c, http.StatusOK, aliasesResponse{Aliases: aliases}, aliases, web.Pagination{Count: len(aliases), Total: &total})
+}
+
+// Delete will retire alias of URL, it doesn't redirect anymore
+func (ah *AliasHandler) Delete(c echo.Context) error {
+	id := c.Param("id")
+	alias := c.Param("alias")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := ah.tracer.Start(
+		ctx,
+		"http Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	for _, v := range []string{id, alias} {
+		if err := ah.validator.V.Var(v, "required,max=20,linkid"); err != nil {
+			span.RecordError(err)
+			fields := err.(validator.ValidationErrors).Translate(ah.validator.Translator)
+			return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		}
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	if err := ah.aliasUsecase.Delete(ctx, id, alias, user); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, ah.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", id),
+		attribute.String("alias", alias),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+package http_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	aliasHttp "github.com/semka95/shortener/backend/alias/delivery/http"
+	"github.com/semka95/shortener/backend/alias/mock"
+	"github.com/semka95/shortener/backend/domain"
+	myMiddl "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tests"
+	urlHttp "github.com/semka95/shortener/backend/url/delivery/http"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type aliasStack struct {
+	e      *echo.Echo
+	uc     *mock.MockAliasUsecase
+	claims *auth.Claims
+	token  string
+}
+
+func newAliasStack(t *testing.T) *aliasStack {
+	t.Helper()
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+	uc := mock.NewMockAliasUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	// url handler registers linkid validation
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	h := aliasHttp.NewAliasHandler(uc, authenticator, v, zap.NewNop(), tracer)
+	h.RegisterAPIRoutes(e.Group("/v1"))
+	h.RegisterAPIRoutes(e.Group("/v2"))
+
+	return &aliasStack{e: e, uc: uc, claims: claims, token: token}
+}
+
+func (s *aliasStack) serve(method, path string, authorized bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if authorized {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+s.token)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAliasHTTPFetch(t *testing.T) {
+	s := newAliasStack(t)
+	tURL := tests.NewURL()
+	createdAt := time.Now().Truncate(time.Second).UTC()
+	aliases := []*domain.Alias{
+		{ID: "oldcode", URLID: tURL.ID, CreatedAt: createdAt, Redirects: 5},
+		{ID: "older", URLID: tURL.ID, CreatedAt: createdAt, Stale: true},
+	}
+
+	t.Run("v1", func(t *testing.T) {
+		s.uc.EXPECT().Fetch(gomock.Any(), tURL.ID, s.claims).Return(aliases, nil)
+
+		rec := s.serve(echo.GET, "/v1/url/"+tURL.ID+"/aliases", true)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get(web.HeaderXTotalCount))
+		body := struct {
+			Aliases []struct {
+				Alias            string    `json:"alias"`
+				CreatedAt        time.Time `json:"created_at"`
+				Redirects        int64     `json:"redirects"`
+				CleanupCandidate bool      `json:"cleanup_candidate"`
+			} `json:"aliases"`
+		}{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		require.Len(t, body.Aliases, 2)
+		assert.Equal(t, "oldcode", body.Aliases[0].Alias)
+		assert.Equal(t, createdAt, body.Aliases[0].CreatedAt)
+		assert.Equal(t, int64(5), body.Aliases[0].Redirects)
+		assert.False(t, body.Aliases[0].CleanupCandidate)
+		assert.True(t, body.Aliases[1].CleanupCandidate)
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		s.uc.EXPECT().Fetch(gomock.Any(), tURL.ID, s.claims).Return(aliases, nil)
+
+		rec := s.serve(echo.GET, "/v2/url/"+tURL.ID+"/aliases", true)
+		require.Equal(t, http.StatusOK, rec.Code)
+		body := web.Envelope{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		require.NotNil(t, body.Meta)
+		assert.Equal(t, 2, body.Meta.Pagination.Count)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		s.uc.EXPECT().Fetch(gomock.Any(), tURL.ID, s.claims).Return(nil, domain.ErrForbidden)
+
+		rec := s.serve(echo.GET, "/v1/url/"+tURL.ID+"/aliases", true)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := s.serve(echo.GET, "/v1/url/"+tURL.ID+"/aliases", false)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestAliasHTTPDelete(t *testing.T) {
+	s := newAliasStack(t)
+	tURL := tests.NewURL()
+
+	t.Run("success", func(t *testing.T) {
+		s.uc.EXPECT().Delete(gomock.Any(), tURL.ID, "oldcode", s.claims).Return(nil)
+
+		rec := s.serve(echo.DELETE, "/v1/url/"+tURL.ID+"/aliases/oldcode", true)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("not alias of url", func(t *testing.T) {
+		s.uc.EXPECT().Delete(gomock.Any(), tURL.ID, "oldcode", s.claims).Return(domain.ErrNoAffected)
+
+		rec := s.serve(echo.DELETE, "/v1/url/"+tURL.ID+"/aliases/oldcode", true)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid alias", func(t *testing.T) {
+		rec := s.serve(echo.DELETE, "/v1/url/"+tURL.ID+"/aliases/bad.alias", true)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
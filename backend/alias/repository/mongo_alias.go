@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoAliasRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoAliasRepository will create an object that represent the alias.Repository interface
+func NewMongoAliasRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.AliasRepository {
+	return &mongoAliasRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoAliasRepository) Store(ctx context.Context, alias *domain.Alias) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("alias", alias.ID),
+			attribute.String("urlid", alias.URLID)),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.AliasCollection)).InsertOne(ctx, alias)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return fmt.Errorf("alias %s already exists: %w", alias.ID, domain.ErrConflict)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("alias store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoAliasRepository) GetByID(ctx context.Context, id string) (*domain.Alias, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository GetByID",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("alias", id)),
+	)
+	defer span.End()
+
+	alias := new(domain.Alias)
+	err := m.Conn.Collection(m.cols.Name(store.AliasCollection)).FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(alias)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, fmt.Errorf("alias was not found: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("alias get error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return alias, nil
+}
+
+func (m *mongoAliasRepository) FetchByURL(ctx context.Context, urlID string) ([]*domain.Alias, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository FetchByURL",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "created_at", Value: 1}})
+	cur, err := m.Conn.Collection(m.cols.Name(store.AliasCollection)).Find(ctx, bson.D{primitive.E{Key: "url_id", Value: urlID}}, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("alias fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]*domain.Alias, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("alias cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+func (m *mongoAliasRepository) Delete(ctx context.Context, id, urlID string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("alias", id),
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "url_id", Value: urlID},
+	}
+	delRes, err := m.Conn.Collection(m.cols.Name(store.AliasCollection)).DeleteOne(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("alias delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	if delRes.DeletedCount == 0 {
+		err = fmt.Errorf("alias was not deleted: %w", domain.ErrNoAffected)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoAliasRepository) Redirect(ctx context.Context, id string, at time.Time) (*domain.Alias, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Redirect",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("alias", id)),
+	)
+	defer span.End()
+
+	update := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{primitive.E{Key: "redirects", Value: 1}}},
+		primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "last_redirect_at", Value: at.Truncate(time.Millisecond).UTC()}}},
+		primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: "stale", Value: ""}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	alias := new(domain.Alias)
+	err := m.Conn.Collection(m.cols.Name(store.AliasCollection)).FindOneAndUpdate(ctx, bson.D{primitive.E{Key: "_id", Value: id}}, update, opts).Decode(alias)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, fmt.Errorf("alias was not found: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("alias redirect error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return alias, nil
+}
+
+func (m *mongoAliasRepository) FlagStale(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository FlagStale",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("before", before.Format(time.RFC3339))),
+	)
+	defer span.End()
+
+	before = before.Truncate(time.Millisecond).UTC()
+	filter := bson.D{
+		primitive.E{Key: "stale", Value: bson.D{primitive.E{Key: "$ne", Value: true}}},
+		primitive.E{Key: "created_at", Value: bson.D{primitive.E{Key: "$lt", Value: before}}},
+		primitive.E{Key: "$or", Value: bson.A{
+			bson.D{primitive.E{Key: "last_redirect_at", Value: bson.D{primitive.E{Key: "$exists", Value: false}}}},
+			bson.D{primitive.E{Key: "last_redirect_at", Value: bson.D{primitive.E{Key: "$lt", Value: before}}}},
+		}},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "stale", Value: true}}}}
+
+	res, err := m.Conn.Collection(m.cols.Name(store.AliasCollection)).UpdateMany(ctx, filter, update)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("alias flag error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return res.ModifiedCount, nil
+}
@@ -0,0 +1,219 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/alias/repository"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func newAlias() *domain.Alias {
+	return &domain.Alias{
+		ID:        "oldcode",
+		URLID:     "test123",
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+}
+
+func aliasDoc(a *domain.Alias) bson.D {
+	return bson.D{
+		{Key: "_id", Value: a.ID},
+		{Key: "url_id", Value: a.URLID},
+		{Key: "created_at", Value: a.CreatedAt},
+		{Key: "redirects", Value: a.Redirects},
+	}
+}
+
+func newRepository(mt *mtest.T) domain.AliasRepository {
+	return repository.NewMongoAliasRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+}
+
+func TestMongoAliasRepository_Store(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tAlias := newAlias()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		require.NoError(mt, newRepository(mt).Store(noopCtx, tAlias))
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, tAlias.ID, doc.Lookup("_id").StringValue())
+		assert.Equal(mt, tAlias.URLID, doc.Lookup("url_id").StringValue())
+	})
+
+	mt.Run("exists", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+
+		assert.ErrorIs(mt, newRepository(mt).Store(noopCtx, tAlias), domain.ErrConflict)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+
+		assert.ErrorIs(mt, newRepository(mt).Store(noopCtx, tAlias), domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoAliasRepository_GetByID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tAlias := newAlias()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.alias", mtest.FirstBatch, aliasDoc(tAlias)),
+			mtest.CreateCursorResponse(0, "test.alias", mtest.NextBatch),
+		)
+
+		alias, err := newRepository(mt).GetByID(noopCtx, tAlias.ID)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, tAlias, alias)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.alias", mtest.FirstBatch))
+
+		alias, err := newRepository(mt).GetByID(noopCtx, tAlias.ID)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+		assert.Nil(mt, alias)
+	})
+}
+
+func TestMongoAliasRepository_FetchByURL(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tAlias := newAlias()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.alias", mtest.FirstBatch, aliasDoc(tAlias)),
+			mtest.CreateCursorResponse(0, "test.alias", mtest.NextBatch),
+		)
+
+		aliases, err := newRepository(mt).FetchByURL(noopCtx, tAlias.URLID)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.Alias{tAlias}, aliases)
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(mt, tAlias.URLID, cmd.Lookup("filter", "url_id").StringValue())
+		assert.Equal(mt, int32(1), cmd.Lookup("sort", "created_at").Int32())
+	})
+
+	mt.Run("none", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.alias", mtest.FirstBatch))
+
+		aliases, err := newRepository(mt).FetchByURL(noopCtx, tAlias.URLID)
+
+		require.NoError(mt, err)
+		assert.Empty(mt, aliases)
+		assert.NotNil(mt, aliases)
+	})
+}
+
+func TestMongoAliasRepository_Delete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tAlias := newAlias()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 1}})
+
+		require.NoError(mt, newRepository(mt).Delete(noopCtx, tAlias.ID, tAlias.URLID))
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, tAlias.URLID, filter.Lookup("url_id").StringValue())
+	})
+
+	mt.Run("no document deleted", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 0}})
+
+		assert.ErrorIs(mt, newRepository(mt).Delete(noopCtx, tAlias.ID, tAlias.URLID), domain.ErrNoAffected)
+	})
+}
+
+func TestMongoAliasRepository_Redirect(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tAlias := newAlias()
+	now := time.Now()
+
+	mt.Run("success", func(mt *mtest.T) {
+		redirected := *tAlias
+		redirected.Redirects = 1
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "value", Value: aliasDoc(&redirected)},
+		})
+
+		alias, err := newRepository(mt).Redirect(noopCtx, tAlias.ID, now)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, tAlias.URLID, alias.URLID)
+		assert.Equal(mt, int64(1), alias.Redirects)
+		update := mt.GetStartedEvent().Command.Lookup("update").Document()
+		assert.Equal(mt, int32(1), update.Lookup("$inc", "redirects").Int32())
+		assert.Equal(mt, now.UnixMilli(), int64(update.Lookup("$set", "last_redirect_at").DateTime()))
+		_, err = update.LookupErr("$unset", "stale")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}})
+
+		alias, err := newRepository(mt).Redirect(noopCtx, tAlias.ID, now)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+		assert.Nil(mt, alias)
+	})
+}
+
+func TestMongoAliasRepository_FlagStale(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	before := time.Now().Truncate(time.Millisecond).UTC()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}, {Key: "nModified", Value: 2}})
+
+		n, err := newRepository(mt).FlagStale(noopCtx, before)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(2), n)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("multi").Boolean())
+		assert.Equal(mt, before.UnixMilli(), int64(update.Lookup("q", "created_at", "$lt").DateTime()))
+		assert.True(mt, update.Lookup("u", "$set", "stale").Boolean())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+
+		_, err := newRepository(mt).FlagStale(noopCtx, before)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
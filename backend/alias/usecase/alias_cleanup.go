@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// Defaults of CleanupConfig fields that are not set
+const (
+	DefaultCleanupDays     = 90
+	DefaultCleanupInterval = 3600
+)
+
+// cleanupLock is the name of the lock held while aliases are flagged
+const cleanupLock = "alias_cleanup"
+
+// CleanupConfig stores configuration of alias cleanup
+type CleanupConfig struct {
+	// Days is the number of days without redirects alias is flagged as
+	// cleanup candidate after
+	Days int `yaml:"stale_days"`
+	// Interval is the interval between runs in seconds
+	Interval int `yaml:"interval_seconds"`
+}
+
+// AliasCleanup flags aliases that had no redirects for configured days, so
+// owners see them as cleanup candidates. Aliases are never retired by it.
+type AliasCleanup struct {
+	aliasRepo      domain.AliasRepository
+	locker         domain.Locker
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            CleanupConfig
+	now            func() time.Time
+}
+
+// NewAliasCleanup creates AliasCleanup, call Run to flag aliases
+// periodically
+func NewAliasCleanup(a domain.AliasRepository, l domain.Locker, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg CleanupConfig) *AliasCleanup {
+	if cfg.Days <= 0 {
+		cfg.Days = DefaultCleanupDays
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultCleanupInterval
+	}
+
+	return &AliasCleanup{
+		aliasRepo:      a,
+		locker:         l,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces clock days without redirects are counted by
+func (ac *AliasCleanup) SetClock(now func() time.Time) {
+	ac.now = now
+}
+
+// Run flags aliases right away and then every interval until context is
+// canceled, it waits while service is read-only
+func (ac *AliasCleanup) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(ac.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		if err := ac.Flag(ctx); err != nil && ctx.Err() == nil {
+			ac.logger.Error("can't flag stale aliases", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flag flags aliases without redirects for configured days. Only one instance
+// flags at a time, others skip while lock is held.
+func (ac *AliasCleanup) Flag(c context.Context) error {
+	ctx, cancel := context.WithTimeout(c, ac.contextTimeout)
+	defer cancel()
+
+	lock, err := ac.locker.AcquireLock(ctx, cleanupLock, time.Duration(ac.cfg.Interval)*time.Second)
+	if errors.Is(err, domain.ErrConflict) {
+		ac.logger.Debug("aliases are flagged by another instance")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), ac.contextTimeout)
+		defer cancel()
+		if err := lock.Release(releaseCtx); err != nil {
+			ac.logger.Warn("can't release alias cleanup lock", zap.Error(err))
+		}
+	}()
+
+	before := ac.now().UTC().AddDate(0, 0, -ac.cfg.Days)
+	ctx, span := ac.tracer.Start(
+		ctx,
+		"usecase FlagStaleAliases",
+		trace.WithAttributes(
+			attribute.String("before", before.Format(time.RFC3339))),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	n, err := ac.aliasRepo.FlagStale(ctx, before)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if n > 0 {
+		ac.logger.Info("flagged stale aliases", zap.Time("before", before), zap.Int64("aliases", n))
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/alias/mock"
+	"github.com/semka95/shortener/backend/alias/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+)
+
+func TestAliasCleanup_Flag(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockAliasRepository(controller)
+	locker := lockmock.NewMockLocker(controller)
+	lock := lockmock.NewMockLock(controller)
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	newCleanup := func(cfg usecase.CleanupConfig) *usecase.AliasCleanup {
+		ac := usecase.NewAliasCleanup(repository, locker, 10*time.Second, tracer, zap.NewNop(), cfg)
+		ac.SetClock(func() time.Time { return now })
+		return ac
+	}
+
+	t.Run("configured days", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "alias_cleanup", 10*time.Minute).Return(lock, nil)
+		repository.EXPECT().FlagStale(gomock.Any(), now.AddDate(0, 0, -30)).Return(int64(2), nil)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newCleanup(usecase.CleanupConfig{Days: 30, Interval: 600}).Flag(context.Background()))
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "alias_cleanup", time.Hour).Return(lock, nil)
+		repository.EXPECT().FlagStale(gomock.Any(), now.AddDate(0, 0, -usecase.DefaultCleanupDays)).Return(int64(0), nil)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newCleanup(usecase.CleanupConfig{}).Flag(context.Background()))
+	})
+
+	t.Run("flagged by another instance", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "alias_cleanup", gomock.Any()).Return(nil, domain.ErrConflict)
+
+		require.NoError(t, newCleanup(usecase.CleanupConfig{}).Flag(context.Background()))
+	})
+
+	t.Run("flag error", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "alias_cleanup", gomock.Any()).Return(lock, nil)
+		repository.EXPECT().FlagStale(gomock.Any(), gomock.Any()).Return(int64(0), domain.ErrInternalServerError)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		err := newCleanup(usecase.CleanupConfig{}).Flag(context.Background())
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+}
@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type aliasUsecase struct {
+	aliasRepo      domain.AliasRepository
+	urlRepo        domain.URLRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+}
+
+// NewAliasUsecase will create new an aliasUsecase object representation of domain.AliasUsecase interface
+func NewAliasUsecase(a domain.AliasRepository, u domain.URLRepository, timeout time.Duration, tracer trace.Tracer) domain.AliasUsecase {
+	return &aliasUsecase{
+		aliasRepo:      a,
+		urlRepo:        u,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+	}
+}
+
+func (uc *aliasUsecase) Fetch(c context.Context, urlID string, user *auth.Claims) ([]*domain.Alias, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	aliases, err := uc.aliasRepo.FetchByURL(ctx, urlID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+func (uc *aliasUsecase) Delete(c context.Context, urlID, id string, user *auth.Claims) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Delete",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID),
+			attribute.String("alias", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if err := uc.aliasRepo.Delete(ctx, id, urlID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// Resolve is called for ids which are not URLs, so redirect misses cost one
+// more lookup
+func (uc *aliasUsecase) Resolve(c context.Context, id string) (string, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Resolve",
+		trace.WithAttributes(
+			attribute.String("alias", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	alias, err := uc.aliasRepo.Redirect(ctx, id, time.Now())
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	span.SetAttributes(attribute.String("urlid", alias.URLID))
+
+	return alias.URLID, nil
+}
+
+// checkAccess allows managing aliases of URL to its owner and admins
+func (uc *aliasUsecase) checkAccess(ctx context.Context, urlID string, user *auth.Claims) error {
+	u, err := uc.urlRepo.GetByID(ctx, urlID, "id", "user_id")
+	if err != nil {
+		return fmt.Errorf("can't get %s url: %w", urlID, err)
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && (u.UserID == "" || u.UserID != user.Subject) {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
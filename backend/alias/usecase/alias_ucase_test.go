@@ -0,0 +1,123 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/alias/mock"
+	"github.com/semka95/shortener/backend/alias/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	urlmock "github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+func TestAliasUsecase_Fetch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockAliasRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := usecase.NewAliasUsecase(repository, urlRepository, 10*time.Second, tracer)
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+	admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+	aliases := []*domain.Alias{{ID: "oldcode", URLID: tURL.ID, Redirects: 3}}
+
+	t.Run("owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().FetchByURL(gomock.Any(), tURL.ID).Return(aliases, nil)
+
+		result, err := uc.Fetch(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		assert.Equal(t, aliases, result)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().FetchByURL(gomock.Any(), tURL.ID).Return(aliases, nil)
+
+		_, err := uc.Fetch(context.Background(), tURL.ID, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		_, err := uc.Fetch(context.Background(), tURL.ID, other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+	})
+
+	t.Run("url not found", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(nil, domain.ErrNotFound)
+
+		_, err := uc.Fetch(context.Background(), tURL.ID, owner)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+}
+
+func TestAliasUsecase_Delete(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockAliasRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := usecase.NewAliasUsecase(repository, urlRepository, 10*time.Second, tracer)
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	t.Run("success", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().Delete(gomock.Any(), "oldcode", tURL.ID).Return(nil)
+
+		require.NoError(t, uc.Delete(context.Background(), tURL.ID, "oldcode", owner))
+	})
+
+	t.Run("alias of another url", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().Delete(gomock.Any(), "oldcode", tURL.ID).Return(domain.ErrNoAffected)
+
+		err := uc.Delete(context.Background(), tURL.ID, "oldcode", owner)
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		err := uc.Delete(context.Background(), tURL.ID, "oldcode", other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+	})
+}
+
+func TestAliasUsecase_Resolve(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockAliasRepository(controller)
+	uc := usecase.NewAliasUsecase(repository, urlmock.NewMockURLRepository(controller), 10*time.Second, tracer)
+
+	t.Run("alias", func(t *testing.T) {
+		repository.EXPECT().Redirect(gomock.Any(), "oldcode", gomock.Any()).Return(&domain.Alias{ID: "oldcode", URLID: "test123", Redirects: 1}, nil)
+
+		urlID, err := uc.Resolve(context.Background(), "oldcode")
+		require.NoError(t, err)
+		assert.Equal(t, "test123", urlID)
+	})
+
+	t.Run("not alias", func(t *testing.T) {
+		repository.EXPECT().Redirect(gomock.Any(), "missing", gomock.Any()).Return(nil, domain.ErrNotFound)
+
+		_, err := uc.Resolve(context.Background(), "missing")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+}
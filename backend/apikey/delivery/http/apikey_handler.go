@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// APIKeyHandler represent the http handler for API keys
+type APIKeyHandler struct {
+	apiKeyUsecase domain.APIKeyUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+}
+
+// NewAPIKeyHandler will initialize the user/apikeys resources endpoint
+func NewAPIKeyHandler(ku domain.APIKeyUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyUsecase: ku,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+	}
+}
+
+// RegisterRoutes registers routes for a path with matching handler
+func (kh *APIKeyHandler) RegisterRoutes(e *echo.Echo) {
+	kh.RegisterAPIRoutes(e.Group("/v1"))
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2.
+// Keys are managed with password login tokens only.
+func (kh *APIKeyHandler) RegisterAPIRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(kh.logger)
+	authenticated := []echo.MiddlewareFunc{echojwt.WithConfig(kh.authenticator.JWTConfig), myMiddl.SpanIdentity("keyid"), myMiddl.DenyService}
+	g.GET("/user/apikeys", kh.Fetch, authenticated...)
+	g.POST("/user/apikeys", kh.Store, authenticated...)
+	g.DELETE("/user/apikeys/:id", kh.Delete, authenticated...)
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (kh *APIKeyHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(kh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(kh.authenticator.JWTConfig), myMiddl.SpanIdentity("userid"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.POST("/service-accounts/:id/apikeys", kh.StoreServiceKey, admin...)
+}
+
+// Fetch will list API keys of the user
+func (kh *APIKeyHandler) Fetch(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := kh.tracer.Start(
+		ctx,
+		"http Fetch",
+	)
+	defer span.End()
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	keys, err := kh.apiKeyUsecase.Fetch(ctx, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, kh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return web.RespondList(c, http.StatusOK, keys, keys, web.Pagination{Count: len(keys)})
+}
+
+// Store will create API key by given request body, the key is returned only
+// in this response
+func (kh *APIKeyHandler) Store(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := kh.tracer.Start(
+		ctx,
+		"http Store",
+	)
+	defer span.End()
+
+	createKey := new(domain.CreateAPIKey)
+	if err := c.Bind(createKey); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(createKey); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(kh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	key, err := kh.apiKeyUsecase.Store(ctx, *createKey, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, kh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	span.SetAttributes(
+		attribute.String("keyid", key.ID.Hex()),
+	)
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return web.Respond(c, http.StatusCreated, key)
+}
+
+// Delete will revoke API key by given id
+func (kh *APIKeyHandler) Delete(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := kh.tracer.Start(
+		ctx,
+		"http Delete",
+	)
+	defer span.End()
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	if err := kh.apiKeyUsecase.Delete(ctx, id, user); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, kh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// StoreServiceKey will create API key of service account by given id, the
+// key is returned only in this response
+func (kh *APIKeyHandler) StoreServiceKey(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := kh.tracer.Start(
+		ctx,
+		"http StoreServiceKey",
+	)
+	defer span.End()
+
+	createKey := new(domain.CreateServiceAPIKey)
+	if err := c.Bind(createKey); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(createKey); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(kh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	key, err := kh.apiKeyUsecase.StoreServiceKey(ctx, id, *createKey)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, kh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	span.SetAttributes(
+		attribute.String("keyid", key.ID.Hex()),
+	)
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return web.Respond(c, http.StatusCreated, key)
+}
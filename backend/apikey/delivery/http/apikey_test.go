@@ -0,0 +1,213 @@
+package http_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	apiKeyHttp "github.com/semka95/shortener/backend/apikey/delivery/http"
+	"github.com/semka95/shortener/backend/apikey/mock"
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type apiKeyStack struct {
+	e             *echo.Echo
+	uc            *mock.MockAPIKeyUsecase
+	authenticator *auth.Authenticator
+	claims        *auth.Claims
+	token         string
+}
+
+func newAPIKeyStack(t *testing.T) *apiKeyStack {
+	t.Helper()
+	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+	uc := mock.NewMockAPIKeyUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler := apiKeyHttp.NewAPIKeyHandler(uc, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	handler.RegisterRoutes(e)
+	handler.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	return &apiKeyStack{e: e, uc: uc, authenticator: authenticator, claims: claims, token: token}
+}
+
+func (s *apiKeyStack) serve(method, path, body string, authorized bool) *httptest.ResponseRecorder {
+	token := ""
+	if authorized {
+		token = s.token
+	}
+	return s.serveToken(method, path, body, token)
+}
+
+func (s *apiKeyStack) serveToken(method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *apiKeyStack) tokenOf(t *testing.T, claims *auth.Claims) string {
+	t.Helper()
+	token, err := s.authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+	return token
+}
+
+func TestAPIKeyHTTPFetch(t *testing.T) {
+	s := newAPIKeyStack(t)
+
+	t.Run("success", func(t *testing.T) {
+		keys := []*domain.APIKey{{ID: primitive.NewObjectID(), UserID: s.claims.Subject, Name: "bookmarklet", Hash: "hash", Hint: "shk_abcd"}}
+		s.uc.EXPECT().Fetch(gomock.Any(), s.claims).Return(keys, nil)
+
+		rec := s.serve(echo.GET, "/v1/user/apikeys", "", true)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "hash")
+		assert.NotContains(t, rec.Body.String(), "user_id")
+		assert.Contains(t, rec.Body.String(), `"hint":"shk_abcd"`)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := s.serve(echo.GET, "/v1/user/apikeys", "", false)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestAPIKeyHTTPStore(t *testing.T) {
+	s := newAPIKeyStack(t)
+
+	t.Run("success", func(t *testing.T) {
+		key := &domain.NewAPIKey{
+			APIKey: &domain.APIKey{ID: primitive.NewObjectID(), Name: "bookmarklet", Hint: "shk_abcd"},
+			Key:    "shk_abcdefgh",
+		}
+		s.uc.EXPECT().Store(gomock.Any(), domain.CreateAPIKey{Name: "bookmarklet"}, s.claims).Return(key, nil)
+
+		rec := s.serve(echo.POST, "/v1/user/apikeys", `{"name":"bookmarklet"}`, true)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+		body := struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		}{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, key.ID.Hex(), body.ID)
+		assert.Equal(t, key.Key, body.Key)
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/user/apikeys", `{"name":""}`, true)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "CreateAPIKey.name")
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/user/apikeys", `{"name":"bookmarklet"}`, false)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestAPIKeyHTTPDelete(t *testing.T) {
+	s := newAPIKeyStack(t)
+	id := primitive.NewObjectID().Hex()
+
+	t.Run("success", func(t *testing.T) {
+		s.uc.EXPECT().Delete(gomock.Any(), id, s.claims).Return(nil)
+
+		rec := s.serve(echo.DELETE, "/v1/user/apikeys/"+id, "", true)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s.uc.EXPECT().Delete(gomock.Any(), id, s.claims).Return(domain.ErrNoAffected)
+
+		rec := s.serve(echo.DELETE, "/v1/user/apikeys/"+id, "", true)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestAPIKeyHTTPStoreServiceKey(t *testing.T) {
+	s := newAPIKeyStack(t)
+	id := primitive.NewObjectID().Hex()
+	admin := s.tokenOf(t, auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Hour))
+	path := "/v1/admin/service-accounts/" + id + "/apikeys"
+
+	t.Run("success", func(t *testing.T) {
+		key := &domain.NewAPIKey{
+			APIKey: &domain.APIKey{ID: primitive.NewObjectID(), Name: "crm", Hint: "shk_abcd", Scopes: []string{auth.ScopeURLRead}},
+			Key:    "shk_abcdefgh",
+		}
+		s.uc.EXPECT().StoreServiceKey(gomock.Any(), id, domain.CreateServiceAPIKey{Name: "crm", Scopes: []string{auth.ScopeURLRead}}).Return(key, nil)
+
+		rec := s.serveToken(echo.POST, path, `{"name":"crm","scopes":["url:read"]}`, admin)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+		assert.Contains(t, rec.Body.String(), `"scopes":["url:read"]`)
+		assert.Contains(t, rec.Body.String(), `"key":"shk_abcdefgh"`)
+	})
+
+	t.Run("scopes required", func(t *testing.T) {
+		rec := s.serveToken(echo.POST, path, `{"name":"crm"}`, admin)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "CreateServiceAPIKey.scopes")
+	})
+
+	t.Run("unknown scope", func(t *testing.T) {
+		rec := s.serveToken(echo.POST, path, `{"name":"crm","scopes":["user:write"]}`, admin)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "CreateServiceAPIKey.scopes[0]")
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := s.serve(echo.POST, path, `{"name":"crm","scopes":["url:read"]}`, true)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestAPIKeyHTTPServiceAccountDenied(t *testing.T) {
+	s := newAPIKeyStack(t)
+	service := auth.NewClaims("507f191e810c19729de860eb", []string{}, time.Now(), time.Hour)
+	service.Type = auth.TypeService
+	service.Scopes = []string{auth.ScopeURLRead, auth.ScopeURLWrite}
+	token := s.tokenOf(t, service)
+
+	assert.Equal(t, http.StatusForbidden, s.serveToken(echo.GET, "/v1/user/apikeys", "", token).Code)
+	assert.Equal(t, http.StatusForbidden, s.serveToken(echo.POST, "/v1/user/apikeys", `{"name":"more"}`, token).Code)
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoAPIKeyRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoAPIKeyRepository will create an object that represent the apikey.Repository interface
+func NewMongoAPIKeyRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.APIKeyRepository {
+	return &mongoAPIKeyRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoAPIKeyRepository) Fetch(ctx context.Context, userID string) ([]*domain.APIKey, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("userid", userID)),
+	)
+	defer span.End()
+
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "_id", Value: 1}})
+	cur, err := m.Conn.Collection(m.cols.Name(store.APIKeyCollection)).Find(ctx, bson.D{primitive.E{Key: "user_id", Value: userID}}, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("api key fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]*domain.APIKey, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("api key cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+func (m *mongoAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository GetByHash",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	key := new(domain.APIKey)
+	err := m.Conn.Collection(m.cols.Name(store.APIKeyCollection)).FindOne(ctx, bson.D{primitive.E{Key: "hash", Value: hash}}).Decode(key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, fmt.Errorf("api key was not found: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("api key get error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return key, nil
+}
+
+func (m *mongoAPIKeyRepository) Store(ctx context.Context, key *domain.APIKey) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("userid", key.UserID)),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.APIKeyCollection)).InsertOne(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("api key store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoAPIKeyRepository) Delete(ctx context.Context, id primitive.ObjectID, userID string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("keyid", id.Hex()),
+			attribute.String("userid", userID)),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "user_id", Value: userID},
+	}
+	delRes, err := m.Conn.Collection(m.cols.Name(store.APIKeyCollection)).DeleteOne(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("api key delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	if delRes.DeletedCount == 0 {
+		err = fmt.Errorf("api key was not deleted: %w", domain.ErrNoAffected)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoAPIKeyRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository DeleteByUser",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("userid", userID)),
+	)
+	defer span.End()
+
+	delRes, err := m.Conn.Collection(m.cols.Name(store.APIKeyCollection)).DeleteMany(ctx, bson.D{primitive.E{Key: "user_id", Value: userID}})
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("api key delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return delRes.DeletedCount, nil
+}
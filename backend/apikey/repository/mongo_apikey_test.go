@@ -0,0 +1,239 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/apikey/repository"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func newAPIKey() *domain.APIKey {
+	return &domain.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    "507f191e810c19729de860ea",
+		Name:      "bookmarklet",
+		Hash:      "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		Hint:      "shk_abcd",
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+}
+
+func apiKeyBsonD(k *domain.APIKey) bson.D {
+	return bson.D{
+		{Key: "_id", Value: k.ID},
+		{Key: "user_id", Value: k.UserID},
+		{Key: "name", Value: k.Name},
+		{Key: "hash", Value: k.Hash},
+		{Key: "hint", Value: k.Hint},
+		{Key: "created_at", Value: k.CreatedAt},
+	}
+}
+
+func TestMongoAPIKeyRepository_Fetch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tKey := newAPIKey()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.apikey", mtest.FirstBatch, apiKeyBsonD(tKey)),
+			mtest.CreateCursorResponse(0, "test.apikey", mtest.NextBatch),
+		)
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		keys, err := r.Fetch(noopCtx, tKey.UserID)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.APIKey{tKey}, keys)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(mt, tKey.UserID, filter.Lookup("user_id").StringValue())
+	})
+
+	mt.Run("no keys", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.apikey", mtest.FirstBatch))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		keys, err := r.Fetch(noopCtx, tKey.UserID)
+
+		require.NoError(mt, err)
+		assert.NotNil(mt, keys)
+		assert.Empty(mt, keys)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		keys, err := r.Fetch(noopCtx, tKey.UserID)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, keys)
+	})
+}
+
+func TestMongoAPIKeyRepository_GetByHash(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tKey := newAPIKey()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.apikey", mtest.FirstBatch, apiKeyBsonD(tKey)),
+			mtest.CreateCursorResponse(0, "test.apikey", mtest.NextBatch),
+		)
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		key, err := r.GetByHash(noopCtx, tKey.Hash)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, tKey, key)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.apikey", mtest.FirstBatch))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		key, err := r.GetByHash(noopCtx, tKey.Hash)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+		assert.Nil(mt, key)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		key, err := r.GetByHash(noopCtx, tKey.Hash)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, key)
+	})
+}
+
+func TestMongoAPIKeyRepository_Store(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tKey := newAPIKey()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tKey)
+
+		require.NoError(mt, err)
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, tKey.Hash, doc.Lookup("hash").StringValue())
+		assert.Equal(mt, tKey.UserID, doc.Lookup("user_id").StringValue())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tKey)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoAPIKeyRepository_Delete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tKey := newAPIKey()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 1}})
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tKey.ID, tKey.UserID)
+
+		require.NoError(mt, err)
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, tKey.UserID, filter.Lookup("user_id").StringValue())
+	})
+
+	mt.Run("no document deleted", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 0}})
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tKey.ID, tKey.UserID)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tKey.ID, tKey.UserID)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoAPIKeyRepository_DeleteByUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	userID := "507f191e810c19729de860ea"
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 2}})
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.DeleteByUser(noopCtx, userID)
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 2, n)
+		del := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document()
+		assert.Equal(mt, userID, del.Lookup("q").Document().Lookup("user_id").StringValue())
+		assert.EqualValues(mt, 0, del.Lookup("limit").AsInt64())
+	})
+
+	mt.Run("no keys", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 0}})
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.DeleteByUser(noopCtx, userID)
+
+		require.NoError(mt, err)
+		assert.Zero(mt, n)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoAPIKeyRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		_, err := r.DeleteByUser(noopCtx, userID)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
@@ -0,0 +1,246 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// keyBytes is the number of random bytes of API key
+const keyBytes = 32
+
+// hintLength is the number of key characters after prefix kept as hint
+const hintLength = 4
+
+type apiKeyUsecase struct {
+	apiKeyRepo     domain.APIKeyRepository
+	userRepo       domain.UserRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	omitProfile    bool
+}
+
+// NewAPIKeyUsecase will create new an apiKeyUsecase object representation of domain.APIKeyUsecase interface,
+// claims of API keys have no email and name when omitProfile is set
+func NewAPIKeyUsecase(k domain.APIKeyRepository, u domain.UserRepository, timeout time.Duration, tracer trace.Tracer, omitProfile bool) domain.APIKeyUsecase {
+	return &apiKeyUsecase{
+		apiKeyRepo:     k,
+		userRepo:       u,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		omitProfile:    omitProfile,
+	}
+}
+
+// hashKey returns hex encoded SHA-256 of the key, keys are random, so they
+// don't need slow hashing like passwords
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (uc *apiKeyUsecase) Authenticate(c context.Context, now time.Time, key string) (*auth.Claims, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Authenticate",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if !strings.HasPrefix(key, domain.APIKeyPrefix) {
+		err := fmt.Errorf("malformed api key: %w", domain.ErrAuthenticationFailure)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	apiKey, err := uc.apiKeyRepo.GetByHash(ctx, hashKey(key))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %s", domain.ErrAuthenticationFailure, err.Error())
+	}
+	span.SetAttributes(attribute.String("userid", apiKey.UserID))
+
+	userID, err := primitive.ObjectIDFromHex(apiKey.UserID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("api key user id is not valid ObjectID: %w: %s", domain.ErrAuthenticationFailure, err.Error())
+	}
+	u, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %s", domain.ErrAuthenticationFailure, err.Error())
+	}
+
+	if u.IsDisabled() {
+		err = fmt.Errorf("user account is disabled: %w", domain.ErrAuthenticationFailure)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	claims := auth.NewClaims(u.ID.Hex(), u.Roles, now, domain.APIKeyTTL)
+	// requests made with the key are told apart by its id in logs
+	claims.ID = apiKey.ID.Hex()
+	if !uc.omitProfile {
+		claims.WithProfile(u.Email, u.FullName)
+	}
+	claims.PasswordChangeRequired = u.MustChangePassword
+	claims.TOSVersion = u.TOSVersion
+	if u.IsService() {
+		claims.Type = auth.TypeService
+		claims.Scopes = apiKey.Scopes
+	}
+	return claims, nil
+}
+
+func (uc *apiKeyUsecase) Fetch(c context.Context, user *auth.Claims) ([]*domain.APIKey, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithAttributes(
+			attribute.String("userid", user.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	keys, err := uc.apiKeyRepo.Fetch(ctx, user.Subject)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (uc *apiKeyUsecase) Store(c context.Context, createKey domain.CreateAPIKey, user *auth.Claims) (*domain.NewAPIKey, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Store",
+		trace.WithAttributes(
+			attribute.String("userid", user.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	key, err := uc.storeKey(ctx, user.Subject, createKey.Name, nil)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (uc *apiKeyUsecase) StoreServiceKey(c context.Context, accountID string, createKey domain.CreateServiceAPIKey) (*domain.NewAPIKey, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase StoreServiceKey",
+		trace.WithAttributes(
+			attribute.String("userid", accountID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	id, err := primitive.ObjectIDFromHex(accountID)
+	if err != nil {
+		err = fmt.Errorf("service account id is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		span.RecordError(err)
+		return nil, err
+	}
+	u, err := uc.userRepo.GetByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("can't get %s service account: %w", accountID, err)
+	}
+	if !u.IsService() {
+		err = fmt.Errorf("user %s is not a service account: %w", accountID, domain.ErrBadParamInput)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	key, err := uc.storeKey(ctx, accountID, createKey.Name, createKey.Scopes)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// storeKey generates and stores API key of the user
+func (uc *apiKeyUsecase) storeKey(ctx context.Context, userID, name string, scopes []string) (*domain.NewAPIKey, error) {
+	random := make([]byte, keyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("can't generate api key: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	key := domain.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	apiKey := &domain.APIKey{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Hash:      hashKey(key),
+		Hint:      key[:len(domain.APIKeyPrefix)+hintLength],
+		Scopes:    scopes,
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+
+	if err := uc.apiKeyRepo.Store(ctx, apiKey); err != nil {
+		return nil, err
+	}
+
+	return &domain.NewAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func (uc *apiKeyUsecase) Delete(c context.Context, id string, user *auth.Claims) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Delete",
+		trace.WithAttributes(
+			attribute.String("keyid", id),
+			attribute.String("userid", user.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	keyID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = fmt.Errorf("api key id is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		span.RecordError(err)
+		return err
+	}
+
+	if err = uc.apiKeyRepo.Delete(ctx, keyID, user.Subject); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
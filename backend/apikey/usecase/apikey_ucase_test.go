@@ -0,0 +1,254 @@
+package usecase_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/apikey/mock"
+	"github.com/semka95/shortener/backend/apikey/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	usermock "github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+func TestAPIKeyUsecase_Store(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockAPIKeyRepository(controller)
+	uc := usecase.NewAPIKeyUsecase(repository, usermock.NewMockUserRepository(controller), 10*time.Second, tracer, false)
+	user := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	t.Run("success", func(t *testing.T) {
+		var stored *domain.APIKey
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, k *domain.APIKey) error {
+			stored = k
+			return nil
+		})
+
+		key, err := uc.Store(context.Background(), domain.CreateAPIKey{Name: "bookmarklet"}, user)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(key.Key, domain.APIKeyPrefix))
+		assert.Equal(t, stored, key.APIKey)
+		assert.Equal(t, user.Subject, stored.UserID)
+		assert.Equal(t, "bookmarklet", stored.Name)
+		sum := sha256.Sum256([]byte(key.Key))
+		assert.Equal(t, hex.EncodeToString(sum[:]), stored.Hash)
+		assert.True(t, strings.HasPrefix(key.Key, stored.Hint))
+		assert.Less(t, len(stored.Hint), len(key.Key))
+	})
+
+	t.Run("keys are unique", func(t *testing.T) {
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+		first, err := uc.Store(context.Background(), domain.CreateAPIKey{Name: "first"}, user)
+		require.NoError(t, err)
+		second, err := uc.Store(context.Background(), domain.CreateAPIKey{Name: "second"}, user)
+		require.NoError(t, err)
+		assert.NotEqual(t, first.Key, second.Key)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+
+		key, err := uc.Store(context.Background(), domain.CreateAPIKey{Name: "bookmarklet"}, user)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, key)
+	})
+}
+
+func TestAPIKeyUsecase_StoreServiceKey(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockAPIKeyRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewAPIKeyUsecase(repository, userRepository, 10*time.Second, tracer, false)
+	service := tests.NewUser()
+	service.Type = domain.UserTypeService
+	createKey := domain.CreateServiceAPIKey{Name: "crm", Scopes: []string{auth.ScopeURLRead, auth.ScopeURLWrite}}
+
+	t.Run("success", func(t *testing.T) {
+		userRepository.EXPECT().GetByID(gomock.Any(), service.ID).Return(service, nil)
+		var stored *domain.APIKey
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, k *domain.APIKey) error {
+			stored = k
+			return nil
+		})
+
+		key, err := uc.StoreServiceKey(context.Background(), service.ID.Hex(), createKey)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(key.Key, domain.APIKeyPrefix))
+		assert.Equal(t, service.ID.Hex(), stored.UserID)
+		assert.Equal(t, "crm", stored.Name)
+		assert.Equal(t, createKey.Scopes, stored.Scopes)
+	})
+
+	t.Run("not a service account", func(t *testing.T) {
+		userRepository.EXPECT().GetByID(gomock.Any(), service.ID).Return(tests.NewUser(), nil)
+
+		key, err := uc.StoreServiceKey(context.Background(), service.ID.Hex(), createKey)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, key)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		userRepository.EXPECT().GetByID(gomock.Any(), service.ID).Return(nil, domain.ErrNotFound)
+
+		key, err := uc.StoreServiceKey(context.Background(), service.ID.Hex(), createKey)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, key)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		key, err := uc.StoreServiceKey(context.Background(), "wrong", createKey)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, key)
+	})
+}
+
+func TestAPIKeyUsecase_Authenticate(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockAPIKeyRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewAPIKeyUsecase(repository, userRepository, 10*time.Second, tracer, false)
+	tUser := tests.NewUser()
+	tUser.Roles = []string{auth.RoleUser, auth.RoleAdmin}
+	key := domain.APIKeyPrefix + "secret"
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	tKey := &domain.APIKey{ID: primitive.NewObjectID(), UserID: tUser.ID.Hex(), Hash: hash}
+	now := time.Now()
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(tKey, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), claims.Subject)
+		assert.Equal(t, tKey.ID.Hex(), claims.ID)
+		assert.Equal(t, tUser.Roles, claims.Roles)
+		assert.Equal(t, now.Add(domain.APIKeyTTL).Unix(), claims.ExpiresAt.Unix())
+		assert.Equal(t, tUser.Email, claims.Email)
+		assert.Equal(t, tUser.FullName, claims.Name)
+	})
+
+	t.Run("profile omitted", func(t *testing.T) {
+		uc := usecase.NewAPIKeyUsecase(repository, userRepository, 10*time.Second, tracer, true)
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(tKey, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), claims.Subject)
+		assert.Empty(t, claims.Email)
+		assert.Empty(t, claims.Name)
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		service := tests.NewUser()
+		service.Type = domain.UserTypeService
+		service.Roles = []string{}
+		serviceKey := *tKey
+		serviceKey.Scopes = []string{auth.ScopeURLRead}
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(&serviceKey, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(service, nil)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		require.NoError(t, err)
+		assert.True(t, claims.IsService())
+		assert.Equal(t, []string{auth.ScopeURLRead}, claims.Scopes)
+		assert.Empty(t, claims.Roles)
+	})
+
+	t.Run("password change required", func(t *testing.T) {
+		forced := *tUser
+		forced.MustChangePassword = true
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(tKey, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(&forced, nil)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		require.NoError(t, err)
+		assert.True(t, claims.PasswordChangeRequired)
+	})
+
+	t.Run("malformed key", func(t *testing.T) {
+		claims, err := uc.Authenticate(context.Background(), now, "secret")
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(nil, domain.ErrNotFound)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("disabled user", func(t *testing.T) {
+		disabled := *tUser
+		disabledAt := now
+		disabled.DisabledAt = &disabledAt
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(tKey, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(&disabled, nil)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, claims)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		repository.EXPECT().GetByHash(gomock.Any(), hash).Return(tKey, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+
+		claims, err := uc.Authenticate(context.Background(), now, key)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, claims)
+	})
+}
+
+func TestAPIKeyUsecase_Delete(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockAPIKeyRepository(controller)
+	uc := usecase.NewAPIKeyUsecase(repository, usermock.NewMockUserRepository(controller), 10*time.Second, tracer, false)
+	user := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
+	id := primitive.NewObjectID()
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().Delete(gomock.Any(), id, user.Subject).Return(nil)
+
+		err := uc.Delete(context.Background(), id.Hex(), user)
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		err := uc.Delete(context.Background(), "invalid", user)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		repository.EXPECT().Delete(gomock.Any(), id, user.Subject).Return(domain.ErrNoAffected)
+
+		err := uc.Delete(context.Background(), id.Hex(), user)
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+	})
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoAuditRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoAuditRepository will create an object that represent the audit.Repository interface
+func NewMongoAuditRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.AuditRepository {
+	return &mongoAuditRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoAuditRepository) Store(ctx context.Context, entry *domain.AuditEntry) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("action", entry.Action)),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.AuditCollection)).InsertOne(ctx, entry)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("audit entry store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// BackupHandler represent the http handler for account backups
+type BackupHandler struct {
+	backupUsecase domain.BackupUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+}
+
+// NewBackupHandler will initialize the admin users/:id/backup and
+// users/:id/restore resources
+func NewBackupHandler(bu domain.BackupUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) *BackupHandler {
+	return &BackupHandler{
+		backupUsecase: bu,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+	}
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (bh *BackupHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(bh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(bh.authenticator.JWTConfig), myMiddl.SpanIdentity("userid"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.GET("/users/:id/backup", bh.Backup, admin...)
+	g.POST("/users/:id/restore", bh.Restore, admin...)
+}
+
+// Backup will stream JSON lines archive of account of user with given id
+func (bh *BackupHandler) Backup(c echo.Context) error {
+	id := c.Param("id")
+	ctx, span := tracing.StartHandler(c, bh.tracer, "http Backup")
+	defer span.End()
+	span.SetAttributes(attribute.String("userid", id))
+
+	// backup holds account data, so reading it is audited
+	c.Set(_MyMiddleware.AuditKey, true)
+
+	backup := new(domain.Backup)
+	if err := c.Bind(backup); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	// headers are sent with the first batch, so error reading it is still
+	// responded with error status
+	c.Response().Header().Set(echo.HeaderContentType, web.MIMEApplicationNDJSON)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "backup-"+id+".ndjson"))
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	err := bh.backupUsecase.Backup(ctx, id, *backup, c.Response())
+	if err != nil && !c.Response().Committed {
+		c.Response().Header().Del(echo.HeaderContentDisposition)
+		return web.RespondDomainError(c, tracing.Fail(span, err), bh.logger)
+	}
+	if err != nil {
+		// client sees truncated backup
+		span.RecordError(err)
+		bh.logger.Error("account backup failed", zap.Error(err), zap.String("userid", id))
+		return nil
+	}
+	tracing.Success(span)
+
+	return nil
+}
+
+// Restore will replay archive of request body into account of user with
+// given id, restore aborted at conflict is responded with 409 and summary of
+// records restored before it
+func (bh *BackupHandler) Restore(c echo.Context) error {
+	id := c.Param("id")
+	ctx, span := tracing.StartHandler(c, bh.tracer, "http Restore")
+	defer span.End()
+	span.SetAttributes(attribute.String("userid", id))
+
+	// body is the archive, parameters are given in query
+	restore := new(domain.Restore)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, restore); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(restore); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(bh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	summary, err := bh.backupUsecase.Restore(ctx, id, *restore, c.Request().Body)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), bh.logger)
+	}
+	if summary.Aborted {
+		return web.Respond(c, http.StatusConflict, summary)
+	}
+	tracing.Success(span)
+
+	return web.Respond(c, http.StatusOK, summary)
+}
@@ -0,0 +1,171 @@
+package http_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	backupHttp "github.com/semka95/shortener/backend/backup/delivery/http"
+	"github.com/semka95/shortener/backend/backup/mock"
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+const userID = "507f191e810c19729de860ea"
+
+type backupStack struct {
+	e          *echo.Echo
+	uc         *mock.MockBackupUsecase
+	adminToken string
+	userToken  string
+}
+
+func newBackupStack(t *testing.T) *backupStack {
+	t.Helper()
+	admin := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e7f", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	user := auth.NewClaims(userID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	adminToken, err := authenticator.GenerateToken(admin)
+	require.NoError(t, err)
+	userToken, err := authenticator.GenerateToken(user)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+	uc := mock.NewMockBackupUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	backupHttp.NewBackupHandler(uc, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer("")).RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	return &backupStack{e: e, uc: uc, adminToken: adminToken, userToken: userToken}
+}
+
+func (s *backupStack) serve(method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, "application/x-ndjson")
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBackupHTTPBackup(t *testing.T) {
+	s := newBackupStack(t)
+
+	t.Run("success", func(t *testing.T) {
+		s.uc.EXPECT().Backup(gomock.Any(), userID, domain.Backup{Clicks: true}, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ domain.Backup, w io.Writer) error {
+			_, err := w.Write([]byte(`{"collection":"backup","document":{"version":1}}` + "\n"))
+			return err
+		})
+
+		rec := s.serve(echo.GET, "/v1/admin/users/"+userID+"/backup?clicks=true", "", s.adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename="backup-`+userID+`.ndjson"`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, `{"collection":"backup","document":{"version":1}}`+"\n", rec.Body.String())
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		s.uc.EXPECT().Backup(gomock.Any(), userID, domain.Backup{}, gomock.Any()).Return(domain.ErrNotFound)
+
+		rec := s.serve(echo.GET, "/v1/admin/users/"+userID+"/backup", "", s.adminToken)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentDisposition))
+	})
+
+	t.Run("error after first batch", func(t *testing.T) {
+		s.uc.EXPECT().Backup(gomock.Any(), userID, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ domain.Backup, w io.Writer) error {
+			_, _ = w.Write([]byte(`{"collection":"backup","document":{"version":1}}` + "\n"))
+			return domain.ErrInternalServerError
+		})
+
+		rec := s.serve(echo.GET, "/v1/admin/users/"+userID+"/backup", "", s.adminToken)
+		assert.Equal(t, http.StatusOK, rec.Code, "status is sent with the first batch")
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := s.serve(echo.GET, "/v1/admin/users/"+userID+"/backup", "", s.userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestBackupHTTPRestore(t *testing.T) {
+	s := newBackupStack(t)
+	archive := `{"collection":"backup","document":{"version":1}}` + "\n"
+
+	t.Run("success", func(t *testing.T) {
+		summary := &domain.RestoreSummary{
+			Policy:      domain.RestorePolicyOverwrite,
+			Collections: map[string]*domain.RestoreCounts{domain.BackupCollectionURLs: {Created: 2, Overwritten: 1}},
+		}
+		s.uc.EXPECT().Restore(gomock.Any(), userID, domain.Restore{Policy: domain.RestorePolicyOverwrite, Clicks: true}, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, _ domain.Restore, r io.Reader) (*domain.RestoreSummary, error) {
+			body, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, archive, string(body))
+			return summary, nil
+		})
+
+		rec := s.serve(echo.POST, "/v1/admin/users/"+userID+"/restore?policy=overwrite&clicks=true", archive, s.adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		body := new(domain.RestoreSummary)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, summary, body)
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		s.uc.EXPECT().Restore(gomock.Any(), userID, domain.Restore{Policy: domain.RestorePolicyFail}, gomock.Any()).Return(&domain.RestoreSummary{
+			Policy:    domain.RestorePolicyFail,
+			Conflicts: []domain.RestoreConflict{{Collection: domain.BackupCollectionURLs, ID: "test123", Reason: "record exists in account"}},
+			Aborted:   true,
+		}, nil)
+
+		rec := s.serve(echo.POST, "/v1/admin/users/"+userID+"/restore?policy=fail", archive, s.adminToken)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "test123")
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/admin/users/"+userID+"/restore?policy=merge", archive, s.adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("invalid archive", func(t *testing.T) {
+		s.uc.EXPECT().Restore(gomock.Any(), userID, domain.Restore{}, gomock.Any()).Return(nil, domain.NewError(domain.ErrBadParamInput, "backup doesn't start with header"))
+
+		rec := s.serve(echo.POST, "/v1/admin/users/"+userID+"/restore", "{}", s.adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/admin/users/"+userID+"/restore", archive, s.userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
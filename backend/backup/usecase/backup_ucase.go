@@ -0,0 +1,633 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// backupBatch is the number of URLs and clicks read from repository at once
+const backupBatch = 500
+
+// restoreBatch is the number of records restored in one transaction
+const restoreBatch = 100
+
+// maxRecordSize is the length of the longest archive line restore accepts
+const maxRecordSize = 1 << 20
+
+// errRestoreAborted aborts transaction of batch with conflict when restore
+// policy is fail
+var errRestoreAborted = errors.New("restore is aborted at conflict")
+
+type backupUsecase struct {
+	userRepo       domain.UserRepository
+	urlRepo        domain.URLRepository
+	clickRepo      domain.ClickRepository
+	transactor     domain.Transactor
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+}
+
+// NewBackupUsecase will create new an backupUsecase object representation of domain.BackupUsecase interface.
+// Records are restored through repositories, so URLs restored are encrypted
+// and cached the same way as created ones.
+func NewBackupUsecase(u domain.UserRepository, urls domain.URLRepository, c domain.ClickRepository, tx domain.Transactor, timeout time.Duration, tracer trace.Tracer) domain.BackupUsecase {
+	return &backupUsecase{
+		userRepo:       u,
+		urlRepo:        urls,
+		clickRepo:      c,
+		transactor:     tx,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+	}
+}
+
+// Backup runs longer than other usecases, so timeout is applied to every
+// batch of records instead of the whole backup
+func (uc *backupUsecase) Backup(c context.Context, userID string, backup domain.Backup, w io.Writer) error {
+	ctx, span := uc.tracer.Start(
+		c,
+		"usecase Backup",
+		trace.WithAttributes(
+			attribute.String("userid", userID),
+			attribute.Bool("clicks", backup.Clicks)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	user, err := uc.getUser(ctx, userID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	header, err := json.Marshal(domain.BackupHeader{
+		Version:   domain.BackupVersion,
+		UserID:    userID,
+		Clicks:    backup.Clicks,
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("can't write backup header: %w", err)
+	}
+	if err = writeRecord(bw, domain.BackupRecord{Collection: domain.BackupCollectionHeader, Document: header}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	// credentials are never written to backups
+	user.HashedPassword = ""
+	user.PasswordHistory = nil
+	if err = encodeRecord(bw, domain.BackupCollectionUser, user); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if err = encodeRecord(bw, domain.BackupCollectionSettings, user.Settings); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	filter := domain.URLFilter{OwnerID: userID, Limit: backupBatch}
+	for {
+		urls, err := uc.fetchURLs(ctx, filter)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		ids := make([]string, 0, len(urls))
+		for _, u := range urls {
+			if err = encodeRecord(bw, domain.BackupCollectionURLs, &u.URL); err != nil {
+				span.RecordError(err)
+				return err
+			}
+			ids = append(ids, u.ID)
+		}
+		if backup.Clicks && len(ids) > 0 {
+			if err = uc.backupClicks(ctx, bw, ids); err != nil {
+				span.RecordError(err)
+				return err
+			}
+		}
+		// written batch is sent to client while the next one is read
+		if err = bw.Flush(); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("can't write backup: %w", err)
+		}
+
+		if len(urls) < backupBatch {
+			return nil
+		}
+		filter.Cursor = urls[len(urls)-1].ID
+	}
+}
+
+// backupClicks writes clicks on URLs with ids
+func (uc *backupUsecase) backupClicks(c context.Context, w io.Writer, ids []string) error {
+	filter := domain.ClickFilter{URLIDs: ids, Limit: backupBatch}
+	for {
+		ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+		clicks, err := uc.clickRepo.FetchClicks(ctx, filter)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, click := range clicks {
+			if err = encodeRecord(w, domain.BackupCollectionClicks, click); err != nil {
+				return err
+			}
+		}
+
+		if len(clicks) < backupBatch {
+			return nil
+		}
+		filter.Cursor = clicks[len(clicks)-1].ID
+	}
+}
+
+func (uc *backupUsecase) getUser(c context.Context, userID string) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, domain.NewError(domain.ErrBadParamInput, "user ID is not valid ObjectID").WithEntity(domain.EntityUser, userID).Wrap(err)
+	}
+	return uc.userRepo.GetByID(ctx, id)
+}
+
+func (uc *backupUsecase) fetchURLs(c context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	return uc.urlRepo.Fetch(ctx, filter)
+}
+
+// encodeRecord writes document of collection as archive line
+func encodeRecord(w io.Writer, collection string, document interface{}) error {
+	doc, err := bson.MarshalExtJSON(document, false, false)
+	if err != nil {
+		return fmt.Errorf("can't encode %s backup record: %w", collection, err)
+	}
+	return writeRecord(w, domain.BackupRecord{Collection: collection, Document: doc})
+}
+
+func writeRecord(w io.Writer, record domain.BackupRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("can't encode %s backup record: %w", record.Collection, err)
+	}
+	if _, err = w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("can't write backup: %w", err)
+	}
+	return nil
+}
+
+// Restore reads archive line by line, records of one collection are
+// restored in batches, each in its own transaction
+func (uc *backupUsecase) Restore(c context.Context, userID string, restore domain.Restore, r io.Reader) (*domain.RestoreSummary, error) {
+	ctx, span := uc.tracer.Start(
+		c,
+		"usecase Restore",
+		trace.WithAttributes(
+			attribute.String("userid", userID),
+			attribute.String("policy", restore.Policy)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if restore.Policy == "" {
+		restore.Policy = domain.RestorePolicySkip
+	}
+	// records are restored into existing account only
+	if _, err := uc.getUser(ctx, userID); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	rs := &restorer{
+		uc:      uc,
+		userID:  userID,
+		restore: restore,
+		owned:   make(map[string]bool),
+		summary: &domain.RestoreSummary{
+			Policy:      restore.Policy,
+			Collections: make(map[string]*domain.RestoreCounts),
+		},
+	}
+	if err := rs.run(ctx, r); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Bool("aborted", rs.summary.Aborted))
+
+	return rs.summary, nil
+}
+
+// restorer restores one archive
+type restorer struct {
+	uc      *backupUsecase
+	userID  string
+	restore domain.Restore
+	// owned holds ids of URLs of the account restored so far, clicks on
+	// other URLs are not restored
+	owned   map[string]bool
+	summary *domain.RestoreSummary
+}
+
+// record is archive record read from line
+type record struct {
+	domain.BackupRecord
+	line int
+}
+
+func (rs *restorer) run(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	var header bool
+	batch := make([]record, 0, restoreBatch)
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		rec := record{line: line}
+		if err := json.Unmarshal(b, &rec.BackupRecord); err != nil {
+			return domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("line %d is not valid backup record", line)).Wrap(err)
+		}
+
+		if !header {
+			if err := checkHeader(rec); err != nil {
+				return err
+			}
+			header = true
+			continue
+		}
+
+		switch rec.Collection {
+		case domain.BackupCollectionUser, domain.BackupCollectionSettings, domain.BackupCollectionURLs:
+		case domain.BackupCollectionClicks:
+			if !rs.restore.Clicks {
+				rs.counts(rec.Collection).Skipped++
+				continue
+			}
+		default:
+			return domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("line %d has unknown collection %q", line, rec.Collection))
+		}
+
+		if len(batch) > 0 && (batch[0].Collection != rec.Collection || len(batch) == restoreBatch) {
+			if err := rs.flush(ctx, batch); err != nil || rs.summary.Aborted {
+				return err
+			}
+			batch = batch[:0]
+		}
+		batch = append(batch, rec)
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("backup record is longer than %d bytes", maxRecordSize))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("can't read backup: %w", err)
+	}
+	if !header {
+		return domain.NewError(domain.ErrBadParamInput, "backup is empty")
+	}
+
+	if len(batch) > 0 {
+		return rs.flush(ctx, batch)
+	}
+	return nil
+}
+
+func checkHeader(rec record) error {
+	if rec.Collection != domain.BackupCollectionHeader {
+		return domain.NewError(domain.ErrBadParamInput, "backup doesn't start with header")
+	}
+	header := new(domain.BackupHeader)
+	if err := json.Unmarshal(rec.Document, header); err != nil {
+		return domain.NewError(domain.ErrBadParamInput, "backup header is not valid").Wrap(err)
+	}
+	if header.Version != domain.BackupVersion {
+		return domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("backup version %d is not supported", header.Version))
+	}
+	return nil
+}
+
+// batchResult is outcome of batch, it is added to summary once batch is
+// committed
+type batchResult struct {
+	counts    domain.RestoreCounts
+	conflicts []domain.RestoreConflict
+	owned     []string
+}
+
+// flush restores batch of records of one collection in transaction
+func (rs *restorer) flush(c context.Context, batch []record) error {
+	collection := batch[0].Collection
+	docs, err := decodeBatch(batch)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c, rs.uc.contextTimeout)
+	defer cancel()
+
+	var result *batchResult
+	err = rs.uc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		// transaction may be retried, so result is made anew
+		result = new(batchResult)
+		switch collection {
+		case domain.BackupCollectionUser:
+			return rs.restoreUser(ctx, result, docs.users)
+		case domain.BackupCollectionSettings:
+			return rs.restoreSettings(ctx, result, docs.settings)
+		case domain.BackupCollectionURLs:
+			return rs.restoreURLs(ctx, result, docs.urls)
+		default:
+			return rs.restoreClicks(ctx, result, docs.clicks)
+		}
+	})
+	if errors.Is(err, errRestoreAborted) {
+		// nothing of the batch is restored
+		rs.counts(collection).Conflicted += int64(len(result.conflicts))
+		rs.addConflicts(result.conflicts)
+		rs.summary.Aborted = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	counts := rs.counts(collection)
+	counts.Created += result.counts.Created
+	counts.Overwritten += result.counts.Overwritten
+	counts.Skipped += result.counts.Skipped
+	counts.Conflicted += result.counts.Conflicted
+	rs.addConflicts(result.conflicts)
+	for _, id := range result.owned {
+		rs.owned[id] = true
+	}
+
+	return nil
+}
+
+func (rs *restorer) counts(collection string) *domain.RestoreCounts {
+	counts, ok := rs.summary.Collections[collection]
+	if !ok {
+		counts = new(domain.RestoreCounts)
+		rs.summary.Collections[collection] = counts
+	}
+	return counts
+}
+
+func (rs *restorer) addConflicts(conflicts []domain.RestoreConflict) {
+	for _, conflict := range conflicts {
+		if len(rs.summary.Conflicts) == domain.RestoreConflictsLimit {
+			return
+		}
+		rs.summary.Conflicts = append(rs.summary.Conflicts, conflict)
+	}
+}
+
+// conflict records record that can't be restored, restore with fail policy
+// is aborted at it
+func (rs *restorer) conflict(result *batchResult, collection, id, reason string) error {
+	result.counts.Conflicted++
+	result.conflicts = append(result.conflicts, domain.RestoreConflict{Collection: collection, ID: id, Reason: reason})
+	if rs.restore.Policy == domain.RestorePolicyFail {
+		return errRestoreAborted
+	}
+	return nil
+}
+
+// exists records record that differs from the one in the account by
+// policy, it reports whether record is to be overwritten
+func (rs *restorer) exists(result *batchResult, collection, id string) (bool, error) {
+	switch rs.restore.Policy {
+	case domain.RestorePolicyOverwrite:
+		result.counts.Overwritten++
+		return true, nil
+	case domain.RestorePolicyFail:
+		return false, rs.conflict(result, collection, id, "record exists in account")
+	default:
+		result.counts.Skipped++
+		return false, nil
+	}
+}
+
+// documents are decoded records of batch
+type documents struct {
+	users    []*domain.User
+	settings []*domain.UserSettings
+	urls     []*domain.URL
+	clicks   []*domain.Click
+}
+
+func decodeBatch(batch []record) (*documents, error) {
+	docs := new(documents)
+	for _, rec := range batch {
+		var v interface{}
+		switch rec.Collection {
+		case domain.BackupCollectionUser:
+			u := new(domain.User)
+			docs.users, v = append(docs.users, u), u
+		case domain.BackupCollectionSettings:
+			s := new(domain.UserSettings)
+			docs.settings, v = append(docs.settings, s), s
+		case domain.BackupCollectionURLs:
+			u := new(domain.URL)
+			docs.urls, v = append(docs.urls, u), u
+		default:
+			click := new(domain.Click)
+			docs.clicks, v = append(docs.clicks, click), click
+		}
+		if err := bson.UnmarshalExtJSON(rec.Document, false, v); err != nil {
+			return nil, domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("line %d has invalid %s document", rec.line, rec.Collection)).Wrap(err)
+		}
+	}
+
+	for i, u := range docs.urls {
+		if u.ID == "" || u.Link == "" {
+			return nil, domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("line %d has URL without id or link", batch[i].line))
+		}
+	}
+	for i, click := range docs.clicks {
+		if click.ID.IsZero() || click.URLID == "" {
+			return nil, domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("line %d has click without id or URL", batch[i].line))
+		}
+	}
+
+	return docs, nil
+}
+
+// restoreUser restores name of the account
+func (rs *restorer) restoreUser(ctx context.Context, result *batchResult, users []*domain.User) error {
+	for _, u := range users {
+		target, err := rs.uc.getUser(ctx, rs.userID)
+		if err != nil {
+			return err
+		}
+		if target.FullName == u.FullName {
+			result.counts.Skipped++
+			continue
+		}
+		overwrite, err := rs.exists(result, domain.BackupCollectionUser, rs.userID)
+		if err != nil || !overwrite {
+			return err
+		}
+
+		target.FullName = u.FullName
+		target.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+		if err = rs.uc.userRepo.Update(ctx, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSettings restores settings of the account
+func (rs *restorer) restoreSettings(ctx context.Context, result *batchResult, settings []*domain.UserSettings) error {
+	for _, s := range settings {
+		target, err := rs.uc.getUser(ctx, rs.userID)
+		if err != nil {
+			return err
+		}
+		if target.Settings == *s {
+			result.counts.Skipped++
+			continue
+		}
+		overwrite, err := rs.exists(result, domain.BackupCollectionSettings, rs.userID)
+		if err != nil || !overwrite {
+			return err
+		}
+
+		target.Settings = *s
+		target.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+		if err = rs.uc.userRepo.Update(ctx, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreURLs restores URLs into the account, URLs of other accounts are
+// conflicts with every policy
+func (rs *restorer) restoreURLs(ctx context.Context, result *batchResult, urls []*domain.URL) error {
+	ids := make([]string, len(urls))
+	for i, u := range urls {
+		ids[i] = u.ID
+	}
+	found, err := rs.uc.urlRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*domain.URL, len(found))
+	for _, u := range found {
+		existing[u.ID] = u
+	}
+
+	for _, u := range urls {
+		u.UserID = rs.userID
+		stored, ok := existing[u.ID]
+		if !ok {
+			if err = rs.uc.urlRepo.Store(ctx, u); err != nil {
+				return err
+			}
+			result.counts.Created++
+			result.owned = append(result.owned, u.ID)
+			continue
+		}
+		if stored.UserID != rs.userID {
+			if err = rs.conflict(result, domain.BackupCollectionURLs, u.ID, "URL belongs to another account"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		result.owned = append(result.owned, u.ID)
+		overwrite, err := rs.exists(result, domain.BackupCollectionURLs, u.ID)
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			continue
+		}
+		// URL equal to the stored one is not modified
+		if err = rs.uc.urlRepo.Update(ctx, u, domain.AnyOwner); err != nil && !errors.Is(err, domain.ErrNoAffected) {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreClicks restores clicks on URLs of the account restored so far.
+// Clicks never change once made, so existing clicks are skipped unless
+// policy is fail.
+func (rs *restorer) restoreClicks(ctx context.Context, result *batchResult, clicks []*domain.Click) error {
+	ids := make([]primitive.ObjectID, 0, len(clicks))
+	owned := make([]*domain.Click, 0, len(clicks))
+	for _, click := range clicks {
+		if !rs.owned[click.URLID] {
+			if err := rs.conflict(result, domain.BackupCollectionClicks, click.ID.Hex(), "URL of click isn't restored"); err != nil {
+				return err
+			}
+			continue
+		}
+		ids = append(ids, click.ID)
+		owned = append(owned, click)
+	}
+	if len(owned) == 0 {
+		return nil
+	}
+
+	found, err := rs.uc.clickRepo.FetchClicks(ctx, domain.ClickFilter{IDs: ids})
+	if err != nil {
+		return err
+	}
+	existing := make(map[primitive.ObjectID]bool, len(found))
+	for _, click := range found {
+		existing[click.ID] = true
+	}
+
+	created := make([]*domain.Click, 0, len(owned))
+	for _, click := range owned {
+		if !existing[click.ID] {
+			created = append(created, click)
+			continue
+		}
+		if rs.restore.Policy == domain.RestorePolicyFail {
+			return rs.conflict(result, domain.BackupCollectionClicks, click.ID.Hex(), "record exists in account")
+		}
+		result.counts.Skipped++
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	if err = rs.uc.clickRepo.StoreMany(ctx, created); err != nil {
+		return err
+	}
+	if err = rs.uc.clickRepo.AddToRollup(ctx, created); err != nil {
+		return err
+	}
+	result.counts.Created += int64(len(created))
+
+	return nil
+}
@@ -0,0 +1,320 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/backup/usecase"
+	_ClickMock "github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+	"github.com/semka95/shortener/backend/tests"
+	_URLMock "github.com/semka95/shortener/backend/url/mock"
+	usermock "github.com/semka95/shortener/backend/user/mock"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+type backupStack struct {
+	uc     domain.BackupUsecase
+	users  *usermock.MockUserRepository
+	urls   *_URLMock.MockURLRepository
+	clicks *_ClickMock.MockClickRepository
+	tx     *lockmock.MockTransactor
+}
+
+func newBackupStack(t *testing.T) *backupStack {
+	t.Helper()
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+
+	s := &backupStack{
+		users:  usermock.NewMockUserRepository(controller),
+		urls:   _URLMock.NewMockURLRepository(controller),
+		clicks: _ClickMock.NewMockClickRepository(controller),
+		tx:     lockmock.NewMockTransactor(controller),
+	}
+	s.uc = usecase.NewBackupUsecase(s.users, s.urls, s.clicks, s.tx, 10*time.Second, tracer)
+	return s
+}
+
+// transactions runs n transactions with functions called once
+func (s *backupStack) transactions(n int) {
+	s.tx.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+		return fn(ctx)
+	}).Times(n)
+}
+
+func records(t *testing.T, archive string) []domain.BackupRecord {
+	t.Helper()
+	var list []domain.BackupRecord
+	for _, line := range strings.Split(strings.TrimSpace(archive), "\n") {
+		var rec domain.BackupRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		list = append(list, rec)
+	}
+	return list
+}
+
+func TestBackupUsecase_Backup(t *testing.T) {
+	t.Run("account with clicks", func(t *testing.T) {
+		s := newBackupStack(t)
+		user := tests.NewUser()
+		user.Settings = domain.UserSettings{DefaultExpirationDays: 30}
+		tURL := tests.NewURL()
+		tURL.UserID = user.ID.Hex()
+		click := &domain.Click{ID: primitive.NewObjectID(), URLID: tURL.ID, CreatedAt: time.Now().Truncate(time.Millisecond).UTC()}
+		s.users.EXPECT().GetByID(gomock.Any(), user.ID).Return(user, nil)
+		s.urls.EXPECT().Fetch(gomock.Any(), domain.URLFilter{OwnerID: user.ID.Hex(), Limit: 500}).Return([]*domain.AdminURL{{URL: *tURL}}, nil)
+		s.clicks.EXPECT().FetchClicks(gomock.Any(), domain.ClickFilter{URLIDs: []string{tURL.ID}, Limit: 500}).Return([]*domain.Click{click}, nil)
+
+		buf := new(bytes.Buffer)
+		err := s.uc.Backup(context.Background(), user.ID.Hex(), domain.Backup{Clicks: true}, buf)
+
+		require.NoError(t, err)
+		list := records(t, buf.String())
+		require.Len(t, list, 5)
+		assert.Equal(t, []string{"backup", "user", "settings", "urls", "clicks"}, []string{list[0].Collection, list[1].Collection, list[2].Collection, list[3].Collection, list[4].Collection})
+		header := new(domain.BackupHeader)
+		require.NoError(t, json.Unmarshal(list[0].Document, header))
+		assert.Equal(t, domain.BackupVersion, header.Version)
+		assert.Equal(t, user.ID.Hex(), header.UserID)
+		assert.True(t, header.Clicks)
+		assert.Contains(t, string(list[1].Document), `"hashed_password":""`)
+		assert.NotContains(t, string(list[1].Document), tests.NewUser().HashedPassword)
+		assert.JSONEq(t, `{"default_expiration_days":30}`, string(list[2].Document))
+		assert.Contains(t, string(list[3].Document), tURL.Link)
+		assert.Contains(t, string(list[4].Document), click.ID.Hex())
+	})
+
+	t.Run("urls in batches without clicks", func(t *testing.T) {
+		s := newBackupStack(t)
+		user := tests.NewUser()
+		first := make([]*domain.AdminURL, 500)
+		for i := range first {
+			first[i] = &domain.AdminURL{URL: *tests.NewURL()}
+			first[i].ID = primitive.NewObjectID().Hex()
+		}
+		s.users.EXPECT().GetByID(gomock.Any(), user.ID).Return(user, nil)
+		gomock.InOrder(
+			s.urls.EXPECT().Fetch(gomock.Any(), domain.URLFilter{OwnerID: user.ID.Hex(), Limit: 500}).Return(first, nil),
+			s.urls.EXPECT().Fetch(gomock.Any(), domain.URLFilter{OwnerID: user.ID.Hex(), Limit: 500, Cursor: first[499].ID}).Return(nil, nil),
+		)
+
+		buf := new(bytes.Buffer)
+		err := s.uc.Backup(context.Background(), user.ID.Hex(), domain.Backup{}, buf)
+
+		require.NoError(t, err)
+		assert.Len(t, records(t, buf.String()), 503)
+	})
+
+	t.Run("invalid user id", func(t *testing.T) {
+		s := newBackupStack(t)
+
+		err := s.uc.Backup(context.Background(), "test", domain.Backup{}, new(bytes.Buffer))
+
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+
+	t.Run("fetch error", func(t *testing.T) {
+		s := newBackupStack(t)
+		user := tests.NewUser()
+		s.users.EXPECT().GetByID(gomock.Any(), user.ID).Return(user, nil)
+		s.urls.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, domain.ErrInternalServerError)
+
+		buf := new(bytes.Buffer)
+		err := s.uc.Backup(context.Background(), user.ID.Hex(), domain.Backup{}, buf)
+
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Empty(t, buf.String(), "nothing is written before the first batch")
+	})
+}
+
+func TestBackupUsecase_Restore(t *testing.T) {
+	source := tests.NewUser()
+	source.FullName = "Source Name"
+	source.Settings = domain.UserSettings{ClickRetentionDays: 7}
+	ownURL := tests.NewURL()
+	ownURL.ID = "own"
+	ownURL.UserID = source.ID.Hex()
+	newURL := tests.NewURL()
+	newURL.ID = "new"
+	newURL.UserID = source.ID.Hex()
+	click := &domain.Click{ID: primitive.NewObjectID(), URLID: newURL.ID, CreatedAt: time.Now().Truncate(time.Millisecond).UTC()}
+	strayClick := &domain.Click{ID: primitive.NewObjectID(), URLID: "stray", CreatedAt: click.CreatedAt}
+
+	// archive is made by Backup, so restore reads what backup writes
+	archive := func(t *testing.T, urls ...*domain.URL) string {
+		t.Helper()
+		s := newBackupStack(t)
+		list := make([]*domain.AdminURL, len(urls))
+		ids := make([]string, len(urls))
+		for i, u := range urls {
+			list[i] = &domain.AdminURL{URL: *u}
+			ids[i] = u.ID
+		}
+		s.users.EXPECT().GetByID(gomock.Any(), source.ID).Return(source, nil)
+		s.urls.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(list, nil)
+		if len(urls) > 0 {
+			s.clicks.EXPECT().FetchClicks(gomock.Any(), domain.ClickFilter{URLIDs: ids, Limit: 500}).Return([]*domain.Click{click, strayClick}, nil)
+		}
+		buf := new(bytes.Buffer)
+		require.NoError(t, s.uc.Backup(context.Background(), source.ID.Hex(), domain.Backup{Clicks: true}, buf))
+		return buf.String()
+	}
+
+	t.Run("overwrite", func(t *testing.T) {
+		s := newBackupStack(t)
+		target := tests.NewUser()
+		owned := tests.NewURL()
+		owned.ID = ownURL.ID
+		owned.UserID = target.ID.Hex()
+		s.users.EXPECT().GetByID(gomock.Any(), target.ID).DoAndReturn(func(context.Context, primitive.ObjectID) (*domain.User, error) {
+			u := *target
+			return &u, nil
+		}).Times(3)
+		s.transactions(4)
+		s.users.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u *domain.User) error {
+			assert.Equal(t, "Source Name", u.FullName)
+			assert.Equal(t, target.Email, u.Email)
+			assert.Equal(t, target.HashedPassword, u.HashedPassword)
+			return nil
+		})
+		s.users.EXPECT().Update(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u *domain.User) error {
+			assert.Equal(t, source.Settings, u.Settings)
+			return nil
+		})
+		s.urls.EXPECT().GetByIDs(gomock.Any(), []string{"own", "new"}).Return([]*domain.URL{owned}, nil)
+		s.urls.EXPECT().Update(gomock.Any(), gomock.Any(), domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ string) error {
+			assert.Equal(t, "own", u.ID)
+			assert.Equal(t, target.ID.Hex(), u.UserID)
+			return domain.ErrNoAffected
+		})
+		s.urls.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u *domain.URL) error {
+			assert.Equal(t, "new", u.ID)
+			assert.Equal(t, target.ID.Hex(), u.UserID)
+			return nil
+		})
+		s.clicks.EXPECT().FetchClicks(gomock.Any(), domain.ClickFilter{IDs: []primitive.ObjectID{click.ID}}).Return(nil, nil)
+		s.clicks.EXPECT().StoreMany(gomock.Any(), []*domain.Click{click}).Return(nil)
+		s.clicks.EXPECT().AddToRollup(gomock.Any(), []*domain.Click{click}).Return(nil)
+
+		summary, err := s.uc.Restore(context.Background(), target.ID.Hex(), domain.Restore{Policy: domain.RestorePolicyOverwrite, Clicks: true}, strings.NewReader(archive(t, ownURL, newURL)))
+
+		require.NoError(t, err)
+		assert.Equal(t, &domain.RestoreSummary{
+			Policy: domain.RestorePolicyOverwrite,
+			Collections: map[string]*domain.RestoreCounts{
+				domain.BackupCollectionUser:     {Overwritten: 1},
+				domain.BackupCollectionSettings: {Overwritten: 1},
+				domain.BackupCollectionURLs:     {Created: 1, Overwritten: 1},
+				domain.BackupCollectionClicks:   {Created: 1, Conflicted: 1},
+			},
+			Conflicts: []domain.RestoreConflict{{Collection: domain.BackupCollectionClicks, ID: strayClick.ID.Hex(), Reason: "URL of click isn't restored"}},
+		}, summary)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		s := newBackupStack(t)
+		target := tests.NewUser()
+		target.FullName = source.FullName
+		other := tests.NewURL()
+		other.ID = ownURL.ID
+		other.UserID = primitive.NewObjectID().Hex()
+		s.users.EXPECT().GetByID(gomock.Any(), target.ID).Return(target, nil).Times(3)
+		s.transactions(3)
+		s.urls.EXPECT().GetByIDs(gomock.Any(), []string{"own"}).Return([]*domain.URL{other}, nil)
+
+		summary, err := s.uc.Restore(context.Background(), target.ID.Hex(), domain.Restore{}, strings.NewReader(archive(t, ownURL)))
+
+		require.NoError(t, err)
+		assert.Equal(t, &domain.RestoreSummary{
+			Policy: domain.RestorePolicySkip,
+			Collections: map[string]*domain.RestoreCounts{
+				domain.BackupCollectionUser:     {Skipped: 1},
+				domain.BackupCollectionSettings: {Skipped: 1},
+				domain.BackupCollectionURLs:     {Conflicted: 1},
+				domain.BackupCollectionClicks:   {Skipped: 2},
+			},
+			Conflicts: []domain.RestoreConflict{{Collection: domain.BackupCollectionURLs, ID: "own", Reason: "URL belongs to another account"}},
+		}, summary)
+	})
+
+	t.Run("fail aborts at conflict", func(t *testing.T) {
+		s := newBackupStack(t)
+		target := tests.NewUser()
+		target.FullName = source.FullName
+		target.Settings = source.Settings
+		owned := tests.NewURL()
+		owned.ID = ownURL.ID
+		owned.UserID = target.ID.Hex()
+		s.users.EXPECT().GetByID(gomock.Any(), target.ID).Return(target, nil).Times(3)
+		s.transactions(2)
+		// batch with conflict is rolled back
+		s.tx.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		})
+		s.urls.EXPECT().GetByIDs(gomock.Any(), []string{"new", "own"}).Return([]*domain.URL{owned}, nil)
+		s.urls.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		summary, err := s.uc.Restore(context.Background(), target.ID.Hex(), domain.Restore{Policy: domain.RestorePolicyFail, Clicks: true}, strings.NewReader(archive(t, newURL, ownURL)))
+
+		require.NoError(t, err)
+		assert.True(t, summary.Aborted)
+		assert.Equal(t, &domain.RestoreCounts{Conflicted: 1}, summary.Collections[domain.BackupCollectionURLs], "created URL is rolled back")
+		assert.Equal(t, []domain.RestoreConflict{{Collection: domain.BackupCollectionURLs, ID: "own", Reason: "record exists in account"}}, summary.Conflicts)
+		assert.NotContains(t, summary.Collections, domain.BackupCollectionClicks)
+	})
+
+	t.Run("invalid archive", func(t *testing.T) {
+		target := tests.NewUser()
+		for name, body := range map[string]string{
+			"empty":              "",
+			"no header":          `{"collection":"user","document":{}}`,
+			"unsupported header": `{"collection":"backup","document":{"version":2}}`,
+			"unknown collection": `{"collection":"backup","document":{"version":1}}` + "\n" + `{"collection":"webhooks","document":{}}`,
+			"invalid record":     `{"collection":"backup","document":{"version":1}}` + "\n" + `not json`,
+			"url without link":   `{"collection":"backup","document":{"version":1}}` + "\n" + `{"collection":"urls","document":{"_id":"test"}}`,
+		} {
+			t.Run(name, func(t *testing.T) {
+				s := newBackupStack(t)
+				s.users.EXPECT().GetByID(gomock.Any(), target.ID).Return(target, nil)
+
+				_, err := s.uc.Restore(context.Background(), target.ID.Hex(), domain.Restore{}, strings.NewReader(body))
+
+				assert.ErrorIs(t, err, domain.ErrBadParamInput)
+			})
+		}
+	})
+
+	t.Run("target not found", func(t *testing.T) {
+		s := newBackupStack(t)
+		target := tests.NewUser()
+		s.users.EXPECT().GetByID(gomock.Any(), target.ID).Return(nil, domain.ErrNotFound)
+
+		_, err := s.uc.Restore(context.Background(), target.ID.Hex(), domain.Restore{}, strings.NewReader(""))
+
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("transaction error", func(t *testing.T) {
+		s := newBackupStack(t)
+		target := tests.NewUser()
+		s.users.EXPECT().GetByID(gomock.Any(), target.ID).Return(target, nil)
+		s.tx.EXPECT().WithTransaction(gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+
+		_, err := s.uc.Restore(context.Background(), target.ID.Hex(), domain.Restore{}, strings.NewReader(archive(t)))
+
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+}
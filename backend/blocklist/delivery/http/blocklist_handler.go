@@ -0,0 +1,183 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// BlocklistHandler represent the http handler for blocklist
+type BlocklistHandler struct {
+	blocklistUsecase domain.BlocklistUsecase
+	authenticator    *auth.Authenticator
+	validator        *web.AppValidator
+	logger           *zap.Logger
+	tracer           trace.Tracer
+}
+
+// NewBlocklistHandler will initialize the blocklist resources endpoint
+func NewBlocklistHandler(bu domain.BlocklistUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) (*BlocklistHandler, error) {
+	handler := &BlocklistHandler{
+		blocklistUsecase: bu,
+		authenticator:    authenticator,
+		validator:        v,
+		logger:           logger,
+		tracer:           tracing.Tracer(tracer),
+	}
+
+	err := handler.RegisterValidation()
+	if err != nil {
+		return nil, err
+	}
+
+	return handler, nil
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (bh *BlocklistHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(bh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(bh.authenticator.JWTConfig), myMiddl.SpanIdentity("ruleid"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.GET("/blocklist", bh.Fetch, admin...)
+	g.POST("/blocklist", bh.Store, admin...)
+	g.DELETE("/blocklist/:id", bh.Delete, admin...)
+}
+
+// RegisterValidation will initialize validation for blocklist handler
+func (bh *BlocklistHandler) RegisterValidation() error {
+	err := bh.validator.V.RegisterValidation("blockrule", checkRule)
+	if err != nil {
+		return err
+	}
+
+	err = bh.validator.V.RegisterTranslation("blockrule", bh.validator.Translator, func(ut ut.Translator) error {
+		return ut.Add("blockrule", "{0} must be a domain name, optionally prefixed with *.", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("blockrule", fe.Field())
+		return t
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ruleValidator validates domain part of the rule with builtin fqdn validation
+var ruleValidator = validator.New()
+
+// checkRule accepts domain names and wildcard rules like *.example.com
+func checkRule(fl validator.FieldLevel) bool {
+	rule := strings.TrimPrefix(strings.TrimSpace(fl.Field().String()), "*.")
+	return ruleValidator.Var(rule, "fqdn") == nil
+}
+
+// Fetch will list blocklist rules
+func (bh *BlocklistHandler) Fetch(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := bh.tracer.Start(
+		ctx,
+		"http Fetch",
+	)
+	defer span.End()
+
+	rules, err := bh.blocklistUsecase.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, bh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	// all rules are listed at once, so total is known without counting
+	total := int64(len(rules))
+	web.SetPageHeaders(c, &total, nil, nil)
+
+	return web.RespondList(c, http.StatusOK, rules, rules, web.Pagination{Count: len(rules), Total: &total})
+}
+
+// Store will add blocklist rule by given request body
+func (bh *BlocklistHandler) Store(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := bh.tracer.Start(
+		ctx,
+		"http Store",
+	)
+	defer span.End()
+
+	rule := new(domain.CreateBlockedDomain)
+	if err := c.Bind(rule); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(rule); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(bh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	admin, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	b, err := bh.blocklistUsecase.Store(ctx, *rule, admin)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, bh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	span.SetAttributes(
+		attribute.String("ruleid", b.ID.Hex()),
+	)
+
+	return web.Respond(c, http.StatusCreated, b)
+}
+
+// Delete will delete blocklist rule by given id
+func (bh *BlocklistHandler) Delete(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := bh.tracer.Start(
+		ctx,
+		"http Delete",
+	)
+	defer span.End()
+
+	if err := bh.blocklistUsecase.Delete(ctx, id); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, bh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
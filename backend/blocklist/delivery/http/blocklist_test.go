@@ -0,0 +1,169 @@
+package http_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	blocklistHttp "github.com/semka95/shortener/backend/blocklist/delivery/http"
+	"github.com/semka95/shortener/backend/blocklist/mock"
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestBlocklistHTTP(t *testing.T) {
+	tRule := tests.NewBlockedDomain()
+	adminClaims := auth.NewClaims(tRule.CreatedBy, []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	adminToken := jwt.NewWithClaims(jwt.SigningMethodHS256, adminClaims)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	kf := auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey))
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", kf)
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockBlocklistUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+
+	handler, err := blocklistHttp.NewBlocklistHandler(uc, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	req := new(http.Request)
+	c := e.NewContext(req, nil)
+
+	// Test BlocklistHandler.Store
+	casesStore := []struct {
+		description   string
+		mockCalls     func(muc *mock.MockBlocklistUsecase)
+		reqBody       string
+		checkResponse func(rec *httptest.ResponseRecorder)
+	}{
+		{
+			description: "Store wildcard rule",
+			mockCalls: func(muc *mock.MockBlocklistUsecase) {
+				muc.EXPECT().Store(gomock.Any(), domain.CreateBlockedDomain{Domain: "*.example.org", Reason: "phishing"}, adminClaims).Return(tRule, nil)
+			},
+			reqBody: `{"domain":"*.example.org","reason":"phishing"}`,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.BlockedDomain)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, tRule.ID, body.ID)
+				assert.Equal(t, http.StatusCreated, rec.Code)
+			},
+		},
+		{
+			description: "Store rule already exists",
+			mockCalls: func(muc *mock.MockBlocklistUsecase) {
+				muc.EXPECT().Store(gomock.Any(), domain.CreateBlockedDomain{Domain: "example.com"}, adminClaims).Return(nil, domain.ErrConflict)
+			},
+			reqBody: `{"domain":"example.com"}`,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			},
+		},
+		{
+			description: "Store not valid rule",
+			mockCalls:   func(muc *mock.MockBlocklistUsecase) {},
+			reqBody:     `{"domain":"https://example.com/path"}`,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, "domain must be a domain name, optionally prefixed with *.", body.Fields["CreateBlockedDomain.domain"])
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
+	}
+
+	for _, tc := range casesStore {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls(uc)
+			req = httptest.NewRequest(echo.POST, "/v1/admin/blocklist", bytes.NewBufferString(tc.reqBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c.Reset(req, rec)
+			c.SetPath("/v1/admin/blocklist")
+			c.Set("user", adminToken)
+
+			err = handler.Store(c)
+			require.NoError(t, err)
+
+			tc.checkResponse(rec)
+		})
+	}
+
+	// Test BlocklistHandler.Fetch
+	t.Run("Fetch success", func(t *testing.T) {
+		uc.EXPECT().Fetch(gomock.Any()).Return([]*domain.BlockedDomain{tRule}, nil)
+		req = httptest.NewRequest(echo.GET, "/v1/admin/blocklist", nil)
+		rec := httptest.NewRecorder()
+		c.Reset(req, rec)
+		c.SetPath("/v1/admin/blocklist")
+
+		err = handler.Fetch(c)
+		require.NoError(t, err)
+
+		var body []*domain.BlockedDomain
+		err = json.NewDecoder(rec.Body).Decode(&body)
+		require.NoError(t, err)
+		require.Len(t, body, 1)
+		assert.Equal(t, tRule.Domain, body[0].Domain)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get(web.HeaderXTotalCount))
+		assert.Empty(t, rec.Header().Get("Link"))
+	})
+
+	// Test BlocklistHandler.Delete
+	casesDelete := []struct {
+		description string
+		err         error
+		code        int
+	}{
+		{"Delete success", nil, http.StatusNoContent},
+		{"Delete not found", domain.ErrNoAffected, http.StatusNotFound},
+	}
+
+	for _, tc := range casesDelete {
+		t.Run(tc.description, func(t *testing.T) {
+			uc.EXPECT().Delete(gomock.Any(), tRule.ID.Hex()).Return(tc.err)
+			req = httptest.NewRequest(echo.DELETE, "/v1/admin/blocklist/"+tRule.ID.Hex(), nil)
+			rec := httptest.NewRecorder()
+			c.Reset(req, rec)
+			c.SetPath("/v1/admin/blocklist/:id")
+			c.SetParamNames("id")
+			c.SetParamValues(tRule.ID.Hex())
+
+			err = handler.Delete(c)
+			require.NoError(t, err)
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
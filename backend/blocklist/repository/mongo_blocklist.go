@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoBlocklistRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoBlocklistRepository will create an object that represent the blocklist.Repository interface
+func NewMongoBlocklistRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.BlocklistRepository {
+	return &mongoBlocklistRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoBlocklistRepository) Fetch(ctx context.Context) ([]*domain.BlockedDomain, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.BlocklistCollection)).Find(ctx, bson.D{})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("blocklist fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]*domain.BlockedDomain, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("blocklist cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+func (m *mongoBlocklistRepository) Store(ctx context.Context, rule *domain.BlockedDomain) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rule", rule.Domain)),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.BlocklistCollection)).InsertOne(ctx, rule)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return fmt.Errorf("blocklist rule %s already exists: %w", rule.Domain, domain.ErrConflict)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("blocklist rule store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoBlocklistRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("ruleid", id.Hex())),
+	)
+	defer span.End()
+
+	delRes, err := m.Conn.Collection(m.cols.Name(store.BlocklistCollection)).DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("blocklist rule delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	if delRes.DeletedCount == 0 {
+		err = fmt.Errorf("blocklist rule was not deleted: %w", domain.ErrNoAffected)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoBlocklistRepository) MarkApplied(ctx context.Context, id primitive.ObjectID, appliedAt time.Time) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository MarkApplied",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("ruleid", id.Hex())),
+	)
+	defer span.End()
+
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "applied_at", Value: appliedAt}}}}
+	updRes, err := m.Conn.Collection(m.cols.Name(store.BlocklistCollection)).UpdateOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}, update)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("blocklist rule update error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	if updRes.MatchedCount == 0 {
+		err = fmt.Errorf("blocklist rule was not updated: %w", domain.ErrNoAffected)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
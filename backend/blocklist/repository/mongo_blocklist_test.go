@@ -0,0 +1,153 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/blocklist/repository"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func TestMongoBlocklistRepository_Fetch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tRule := tests.NewBlockedDomain()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.blocklist", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: tRule.ID},
+				{Key: "domain", Value: tRule.Domain},
+				{Key: "reason", Value: tRule.Reason},
+				{Key: "created_by", Value: tRule.CreatedBy},
+				{Key: "applied_at", Value: nil},
+				{Key: "created_at", Value: tRule.CreatedAt},
+			}),
+			mtest.CreateCursorResponse(0, "test.blocklist", mtest.NextBatch),
+		)
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		rules, err := r.Fetch(noopCtx)
+
+		require.NoError(mt, err)
+		require.Len(mt, rules, 1)
+		assert.EqualValues(mt, tRule, rules[0])
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		rules, err := r.Fetch(noopCtx)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, rules)
+	})
+}
+
+func TestMongoBlocklistRepository_Store(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tRule := tests.NewBlockedDomain()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tRule)
+
+		require.NoError(mt, err)
+	})
+
+	mt.Run("duplicate domain", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tRule)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+	})
+}
+
+func TestMongoBlocklistRepository_Delete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tRule := tests.NewBlockedDomain()
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "acknowledged", Value: true},
+			{Key: "n", Value: 0},
+		})
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tRule.ID)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "acknowledged", Value: true},
+			{Key: "n", Value: 1},
+		})
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tRule.ID)
+
+		require.NoError(mt, err)
+	})
+}
+
+func TestMongoBlocklistRepository_MarkApplied(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tRule := tests.NewBlockedDomain()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.MarkApplied(noopCtx, tRule.ID, time.Now())
+
+		require.NoError(mt, err)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+			{Key: "nModified", Value: 0},
+		})
+		r := repository.NewMongoBlocklistRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.MarkApplied(noopCtx, tRule.ID, time.Now())
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+}
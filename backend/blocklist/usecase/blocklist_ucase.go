@@ -0,0 +1,243 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// blockAction is the audit action of URL blocked by blocklist rule
+const blockAction = "BLOCK url"
+
+type blocklistUsecase struct {
+	blocklistRepo  domain.BlocklistRepository
+	urlRepo        domain.URLRepository
+	auditRepo      domain.AuditRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+
+	mu    sync.RWMutex
+	rules []*domain.BlockedDomain
+}
+
+// NewBlocklistUsecase will create new an blocklistUsecase object representation of domain.BlocklistUsecase interface.
+// Rules are cached in memory, call Refresh to load them.
+func NewBlocklistUsecase(b domain.BlocklistRepository, u domain.URLRepository, a domain.AuditRepository, timeout time.Duration, tracer trace.Tracer) domain.BlocklistUsecase {
+	return &blocklistUsecase{
+		blocklistRepo:  b,
+		urlRepo:        u,
+		auditRepo:      a,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+	}
+}
+
+func (uc *blocklistUsecase) Fetch(c context.Context) ([]*domain.BlockedDomain, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	rules, err := uc.blocklistRepo.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (uc *blocklistUsecase) Store(c context.Context, createRule domain.CreateBlockedDomain, admin *auth.Claims) (*domain.BlockedDomain, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	rule := &domain.BlockedDomain{
+		ID:        primitive.NewObjectID(),
+		Domain:    strings.TrimSuffix(strings.ToLower(strings.TrimSpace(createRule.Domain)), "."),
+		Reason:    createRule.Reason,
+		CreatedBy: admin.Subject,
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	span.SetAttributes(attribute.String("rule", rule.Domain))
+
+	if err := uc.blocklistRepo.Store(ctx, rule); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	uc.mu.Lock()
+	uc.rules = append(uc.rules, rule)
+	uc.mu.Unlock()
+
+	return rule, nil
+}
+
+func (uc *blocklistUsecase) Delete(c context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("ruleid", id)),
+	)
+	defer span.End()
+
+	ruleID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = fmt.Errorf("rule id is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		span.RecordError(err)
+		return err
+	}
+
+	if err = uc.blocklistRepo.Delete(ctx, ruleID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	rules := make([]*domain.BlockedDomain, 0, len(uc.rules))
+	for _, r := range uc.rules {
+		if r.ID != ruleID {
+			rules = append(rules, r)
+		}
+	}
+	uc.rules = rules
+
+	return nil
+}
+
+func (uc *blocklistUsecase) Match(link string) *domain.BlockedDomain {
+	u, err := url.Parse(link)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+
+	for _, r := range uc.rules {
+		if r.Matches(u.Hostname()) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// Refresh reloads cached rules and blocks existing URLs matching rules that
+// were not applied yet, every blocked URL gets audit entry
+func (uc *blocklistUsecase) Refresh(ctx context.Context) error {
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Refresh",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	rules, err := uc.blocklistRepo.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	uc.mu.Lock()
+	uc.rules = rules
+	uc.mu.Unlock()
+
+	var errs []error
+	for _, r := range rules {
+		if r.AppliedAt != nil {
+			continue
+		}
+		if err = uc.apply(ctx, r); err != nil {
+			span.RecordError(err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// apply blocks existing URLs that match the rule
+func (uc *blocklistUsecase) apply(ctx context.Context, rule *domain.BlockedDomain) error {
+	ids, err := uc.urlRepo.BlockByPattern(ctx, rule.LinkPattern(), rule.Domain)
+	if err != nil {
+		return fmt.Errorf("can't block URLs by %s rule: %w", rule.Domain, err)
+	}
+
+	for _, id := range ids {
+		entry := &domain.AuditEntry{
+			ID:        primitive.NewObjectID(),
+			Action:    blockAction,
+			ActorID:   rule.CreatedBy,
+			EntityID:  id,
+			CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+		}
+		if err = uc.auditRepo.Store(ctx, entry); err != nil {
+			return fmt.Errorf("can't audit URL %s blocked by %s rule: %w", id, rule.Domain, err)
+		}
+	}
+
+	appliedAt := time.Now().Truncate(time.Millisecond).UTC()
+	if err = uc.blocklistRepo.MarkApplied(ctx, rule.ID, appliedAt); err != nil {
+		return fmt.Errorf("can't mark %s rule applied: %w", rule.Domain, err)
+	}
+	rule.AppliedAt = &appliedAt
+
+	return nil
+}
+
+// RunRefresh refreshes blocklist every interval until context is canceled,
+// non-positive interval disables refresh. Refresh applies new rules to URLs,
+// so it waits while service is read-only.
+func RunRefresh(ctx context.Context, uc domain.BlocklistUsecase, interval time.Duration, logger *zap.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := domain.WaitWritable(ctx); err != nil {
+				return
+			}
+			if err := uc.Refresh(ctx); err != nil {
+				logger.Error("can't refresh blocklist", zap.Error(err))
+			}
+		}
+	}
+}
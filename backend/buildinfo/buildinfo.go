@@ -0,0 +1,95 @@
+// Package buildinfo provides version of running build. Values are injected at
+// build time, e.g.
+//
+//	go build -ldflags "-X github.com/semka95/shortener/backend/buildinfo.Version=v1.2.0"
+package buildinfo
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.uber.org/zap"
+)
+
+// Default is the value of build information that was not injected
+const Default = "dev"
+
+// Values injected with -ldflags -X, empty values are replaced by Default or
+// by version control information embedded by go build
+var (
+	Version   string
+	GitSHA    string
+	BuildDate string
+)
+
+// Info represents build of running binary
+type Info struct {
+	Version   string `json:"version"`
+	GitSHA    string `json:"git_sha"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns build information of running binary
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.GitSHA == "":
+				info.GitSHA = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+
+	for _, v := range []*string{&info.Version, &info.GitSHA, &info.BuildDate} {
+		if *v == "" {
+			*v = Default
+		}
+	}
+
+	return info
+}
+
+// Fields returns build information as log fields
+func (i Info) Fields() []zap.Field {
+	return []zap.Field{
+		zap.String("version", i.Version),
+		zap.String("git_sha", i.GitSHA),
+		zap.String("build_date", i.BuildDate),
+		zap.String("go_version", i.GoVersion),
+	}
+}
+
+// Attributes returns build information as resource attributes, so traces
+// are attributable to builds
+func (i Info) Attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.ServiceVersionKey.String(i.Version),
+		attribute.String("build.git_sha", i.GitSHA),
+		attribute.String("build.date", i.BuildDate),
+		attribute.String("build.go_version", i.GoVersion),
+	}
+}
+
+// NewVersionHandler will initialize the /version endpoint
+func NewVersionHandler(e *echo.Echo) {
+	e.GET("/version", VersionHandler)
+}
+
+// VersionHandler responds with build information of running binary
+func VersionHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, Get())
+}
@@ -0,0 +1,60 @@
+package buildinfo_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/buildinfo"
+)
+
+func TestGet(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		info := buildinfo.Get()
+		assert.Equal(t, buildinfo.Default, info.Version)
+		assert.NotEmpty(t, info.GitSHA)
+		assert.NotEmpty(t, info.BuildDate)
+		assert.Equal(t, runtime.Version(), info.GoVersion)
+	})
+
+	t.Run("injected", func(t *testing.T) {
+		defer func(v, sha, date string) {
+			buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildDate = v, sha, date
+		}(buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildDate)
+		buildinfo.Version = "v1.2.0"
+		buildinfo.GitSHA = "1c9c769"
+		buildinfo.BuildDate = "2026-10-15T10:00:00Z"
+
+		info := buildinfo.Get()
+		assert.Equal(t, buildinfo.Info{
+			Version:   "v1.2.0",
+			GitSHA:    "1c9c769",
+			BuildDate: "2026-10-15T10:00:00Z",
+			GoVersion: runtime.Version(),
+		}, info)
+	})
+}
+
+func TestVersionHandler(t *testing.T) {
+	e := echo.New()
+	buildinfo.NewVersionHandler(e)
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := make(map[string]string)
+	err := json.NewDecoder(rec.Body).Decode(&body)
+	require.NoError(t, err)
+	assert.Equal(t, buildinfo.Default, body["version"])
+	assert.Equal(t, runtime.Version(), body["go_version"])
+	assert.Contains(t, body, "git_sha")
+	assert.Contains(t, body, "build_date")
+}
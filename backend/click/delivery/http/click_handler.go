@@ -0,0 +1,398 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// ClickHandler represent the http handler for URL click statistics
+type ClickHandler struct {
+	clickUsecase  domain.ClickUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+	// shutdown is closed when server shuts down to end click streams
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// StreamHeartbeat is the interval of comments sent to idle click streams, so
+// proxies don't close the connection
+const StreamHeartbeat = 15 * time.Second
+
+// NewClickHandler will initialize the url/:id/stats resources endpoint, url
+// handler must be created first as it registers linkid validation
+func NewClickHandler(cu domain.ClickUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) (*ClickHandler, error) {
+	handler := &ClickHandler{
+		clickUsecase:  cu,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+		shutdown:      make(chan struct{}),
+	}
+
+	err := handler.RegisterValidation()
+	if err != nil {
+		return nil, err
+	}
+
+	return handler, nil
+}
+
+// RegisterRoutes registers routes for a path with matching handler
+func (ch *ClickHandler) RegisterRoutes(e *echo.Echo) {
+	ch.RegisterAPIRoutes(e.Group("/v1"))
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2
+func (ch *ClickHandler) RegisterAPIRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(ch.logger)
+	authenticated := []echo.MiddlewareFunc{echojwt.WithConfig(ch.authenticator.JWTConfig), myMiddl.SpanIdentity("urlid")}
+	g.GET("/url/:id/stats/campaigns", ch.CampaignStats, authenticated...)
+	g.GET("/url/:id/stats/patterns", ch.ClickPatterns, authenticated...)
+	g.GET("/url/:id/clicks/stream", ch.Stream, authenticated...)
+	g.GET("/url/stats/compare", ch.Compare, echojwt.WithConfig(ch.authenticator.JWTConfig))
+}
+
+// RegisterValidation will initialize validation for click handler
+func (ch *ClickHandler) RegisterValidation() error {
+	// builtin timezone validation has no default translation
+	err := ch.validator.V.RegisterTranslation("timezone", ch.validator.Translator, func(ut ut.Translator) error {
+		return ut.Add("timezone", "{0} must be an IANA time zone name, e.g. Europe/Berlin", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("timezone", fe.Field())
+		return t
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CampaignStats will get clicks on URL grouped by campaign
+func (ch *ClickHandler) CampaignStats(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := ch.tracer.Start(
+		ctx,
+		"http CampaignStats",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	err := ch.validator.V.Var(id, "required,max=20,linkid")
+	if err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(ch.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	stats, coverage, err := ch.clickUsecase.CampaignStats(ctx, id, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, ch.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", id),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	web.SetCoverageHeader(c, coverage)
+	return web.RespondList(c, http.StatusOK, stats, stats, web.Pagination{Count: len(stats)})
+}
+
+// ClickPatterns will get clicks on URL by hour of day and day of week, ?tz=
+// query parameter sets time zone
+func (ch *ClickHandler) ClickPatterns(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := ch.tracer.Start(
+		ctx,
+		"http ClickPatterns",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	err := ch.validator.V.Var(id, "required,max=20,linkid")
+	if err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(ch.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	filter := new(domain.PatternsFilter)
+	if err = c.Bind(filter); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err = c.Validate(filter); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(ch.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	patterns, err := ch.clickUsecase.ClickPatterns(ctx, id, *filter, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, ch.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", id),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	web.SetCoverageHeader(c, patterns.Coverage)
+	return web.Respond(c, http.StatusOK, patterns)
+}
+
+// Compare will get statistics of up to domain.MaxCompareIDs URLs side by
+// side, ?ids= query parameter lists comma separated URL ids and ?window= sets
+// number of days, e.g. 30d
+func (ch *ClickHandler) Compare(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := ch.tracer.Start(
+		ctx,
+		"http Compare",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	ids, err := ch.parseIDs(c.QueryParam("ids"))
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: map[string]string{"ids": err.Error()}})
+	}
+
+	window := c.QueryParam("window")
+	if window == "" {
+		window = domain.DefaultStatsWindow
+	}
+	if _, err = domain.ParseStatsWindow(window); err != nil {
+		span.RecordError(err)
+		msg := fmt.Sprintf("window must be a number of days from 1d to %dd", domain.MaxStatsWindowDays)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: map[string]string{"window": msg}})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	comparison, err := ch.clickUsecase.Compare(ctx, ids, window, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, ch.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(
+		attribute.StringSlice("urlids", ids),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	web.SetCoverageHeader(c, comparison.Coverage)
+	return web.Respond(c, http.StatusOK, comparison)
+}
+
+// Shutdown ends click streams, it is meant to be registered with
+// http.Server.RegisterOnShutdown as server doesn't wait for streams to end
+func (ch *ClickHandler) Shutdown() {
+	ch.shutdownOnce.Do(func() { close(ch.shutdown) })
+}
+
+// Stream will push clicks on URL as server-sent events until client
+// disconnects or server shuts down. Every click is "click" event with JSON
+// click as data, "dropped" event reports total number of clicks dropped
+// because client was reading too slowly.
+func (ch *ClickHandler) Stream(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := ch.tracer.Start(
+		ctx,
+		"http Stream",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	err := ch.validator.V.Var(id, "required,max=20,linkid")
+	if err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(ch.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	sub, err := ch.clickUsecase.Subscribe(ctx, id, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, ch.logger), domain.ResponseError{Error: err.Error()})
+	}
+	defer sub.Close()
+
+	span.SetAttributes(
+		attribute.String("urlid", id),
+	)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// nginx buffers responses by default
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(StreamHeartbeat)
+	defer heartbeat.Stop()
+
+	var dropped int64
+	for {
+		select {
+		case <-ctx.Done():
+			span.SetStatus(codes.Ok, "client disconnected")
+			return nil
+		case <-ch.shutdown:
+			span.SetStatus(codes.Ok, "server shutdown")
+			return nil
+		case <-heartbeat.C:
+			if _, err = res.Write([]byte(": ping\n\n")); err != nil {
+				return nil
+			}
+		case click, ok := <-sub.Clicks():
+			if !ok {
+				span.SetStatus(codes.Ok, "clicks are no longer recorded")
+				return nil
+			}
+			if n := sub.Dropped(); n != dropped {
+				dropped = n
+				if err = writeEvent(res, "dropped", "", map[string]int64{"dropped": dropped}); err != nil {
+					return nil
+				}
+			}
+			if err = writeEvent(res, "click", click.ID.Hex(), click); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+// writeEvent writes server-sent event with data encoded as JSON
+func writeEvent(w http.ResponseWriter, event, id string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err = fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// parseIDs splits comma separated URL ids dropping duplicates
+func (ch *ClickHandler) parseIDs(param string) ([]string, error) {
+	ids := make([]string, 0, domain.MaxCompareIDs)
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(param, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if err := ch.validator.V.Var(id, "max=20,linkid"); err != nil {
+			return nil, fmt.Errorf("ids has invalid id %q", id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("ids is a required field")
+	}
+	if len(ids) > domain.MaxCompareIDs {
+		return nil, fmt.Errorf("ids must contain at most %d items", domain.MaxCompareIDs)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,470 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	clickHttp "github.com/semka95/shortener/backend/click/delivery/http"
+	"github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tests"
+	urlHttp "github.com/semka95/shortener/backend/url/delivery/http"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestClickHTTPCampaignStats(t *testing.T) {
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockClickUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	// url handler registers linkid validation
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	handler, err := clickHttp.NewClickHandler(uc, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+	handler.RegisterRoutes(e)
+	handler.RegisterAPIRoutes(e.Group("/v2"))
+
+	stats := []*domain.CampaignStats{
+		{Source: "newsletter", Medium: "email", Campaign: "spring", Clicks: 3},
+		{Source: domain.CampaignNone, Medium: domain.CampaignNone, Campaign: domain.CampaignNone, Clicks: 1},
+	}
+
+	cases := []struct {
+		description string
+		mockCalls   func()
+		target      string
+		token       string
+		code        int
+		body        string
+	}{
+		{
+			description: "success",
+			mockCalls: func() {
+				uc.EXPECT().CampaignStats(gomock.Any(), tURL.ID, claims).Return(stats, domain.NewStatsCoverage(domain.AnalyticsStandard, 0), nil)
+			},
+			target: "/v1/url/" + tURL.ID + "/stats/campaigns",
+			token:  token,
+			code:   http.StatusOK,
+			body: `[{"source":"newsletter","medium":"email","campaign":"spring","clicks":3},` +
+				`{"source":"(none)","medium":"(none)","campaign":"(none)","clicks":1}]`,
+		},
+		{
+			description: "v2 success",
+			mockCalls: func() {
+				uc.EXPECT().CampaignStats(gomock.Any(), tURL.ID, claims).Return(stats[:1], domain.NewStatsCoverage(domain.AnalyticsStandard, 0), nil)
+			},
+			target: "/v2/url/" + tURL.ID + "/stats/campaigns",
+			token:  token,
+			code:   http.StatusOK,
+			body:   `{"data":[{"source":"newsletter","medium":"email","campaign":"spring","clicks":3}],"meta":{"pagination":{"count":1}}}`,
+		},
+		{
+			description: "forbidden",
+			mockCalls: func() {
+				uc.EXPECT().CampaignStats(gomock.Any(), tURL.ID, claims).Return(nil, nil, domain.ErrForbidden)
+			},
+			target: "/v1/url/" + tURL.ID + "/stats/campaigns",
+			token:  token,
+			code:   http.StatusForbidden,
+			body:   `{"error":"attempted action is not allowed"}`,
+		},
+		{
+			description: "validation error",
+			mockCalls:   func() {},
+			target:      "/v1/url/te!t/stats/campaigns",
+			token:       token,
+			code:        http.StatusBadRequest,
+		},
+		{
+			description: "unauthenticated",
+			mockCalls:   func() {},
+			target:      "/v1/url/" + tURL.ID + "/stats/campaigns",
+			code:        http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls()
+			req := httptest.NewRequest(echo.GET, tc.target, nil)
+			if tc.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.code, rec.Code)
+			if tc.body != "" {
+				assert.JSONEq(t, tc.body, rec.Body.String())
+			} else if tc.code == http.StatusBadRequest {
+				re := new(domain.ResponseError)
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+				assert.Equal(t, "validation error", re.Error)
+			}
+		})
+	}
+}
+
+func TestClickHTTPClickPatterns(t *testing.T) {
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockClickUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler, err := clickHttp.NewClickHandler(uc, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+	handler.RegisterRoutes(e)
+
+	patterns := &domain.ClickPatterns{Timezone: "Europe/Berlin"}
+	patterns.Hours[9] = 4
+	patterns.Weekdays[time.Monday] = 4
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID+"/stats/patterns"+query, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("time zone", func(t *testing.T) {
+		uc.EXPECT().ClickPatterns(gomock.Any(), tURL.ID, domain.PatternsFilter{TZ: "Europe/Berlin"}, claims).Return(patterns, nil)
+
+		rec := get("?tz=Europe/Berlin")
+		require.Equal(t, http.StatusOK, rec.Code)
+		body := new(domain.ClickPatterns)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, patterns, body)
+	})
+
+	t.Run("default time zone", func(t *testing.T) {
+		uc.EXPECT().ClickPatterns(gomock.Any(), tURL.ID, domain.PatternsFilter{}, claims).Return(&domain.ClickPatterns{Timezone: domain.DefaultTimezone}, nil)
+
+		rec := get("")
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("invalid time zone", func(t *testing.T) {
+		for _, tz := range []string{"Mars/Olympus", "Local"} {
+			rec := get("?tz=" + tz)
+			require.Equal(t, http.StatusBadRequest, rec.Code, tz)
+			re := new(domain.ResponseError)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+			assert.Equal(t, "validation error", re.Error)
+			assert.Equal(t, "tz must be an IANA time zone name, e.g. Europe/Berlin", re.Fields["PatternsFilter.tz"])
+		}
+	})
+}
+
+func TestClickHTTPCompare(t *testing.T) {
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockClickUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	handler, err := clickHttp.NewClickHandler(uc, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+	handler.RegisterRoutes(e)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/v1/url/stats/compare"+query, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("success", func(t *testing.T) {
+		clicks := int64(4)
+		comparison := &domain.StatsComparison{
+			Window: "2d",
+			Days:   []string{"2023-03-01", "2023-03-02"},
+			URLs: []*domain.URLStats{
+				{ID: tURL.ID, Clicks: &clicks, Uniques: &clicks, Daily: []*int64{nil, &clicks}},
+				{ID: "missing"},
+			},
+			Coverage: domain.NewStatsCoverage(domain.AnalyticsMinimal, 2),
+		}
+		uc.EXPECT().Compare(gomock.Any(), []string{tURL.ID, "missing"}, "2d", claims).Return(comparison, nil)
+
+		rec := get("?ids=" + tURL.ID + ",missing," + tURL.ID + "&window=2d")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "analytics=minimal; untracked_clicks=2", rec.Header().Get(web.HeaderXStatsPartial))
+		assert.JSONEq(t, `{"window":"2d","days":["2023-03-01","2023-03-02"],"urls":[`+
+			`{"id":"`+tURL.ID+`","clicks":4,"uniques":4,"daily":[null,4]},`+
+			`{"id":"missing","clicks":null,"uniques":null,"daily":null}],`+
+			`"coverage":{"analytics":"minimal","untracked_clicks":2,"partial":true}}`, rec.Body.String())
+	})
+
+	t.Run("default window", func(t *testing.T) {
+		uc.EXPECT().Compare(gomock.Any(), []string{tURL.ID}, domain.DefaultStatsWindow, claims).Return(&domain.StatsComparison{}, nil)
+
+		rec := get("?ids=" + tURL.ID)
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		uc.EXPECT().Compare(gomock.Any(), []string{tURL.ID}, domain.DefaultStatsWindow, claims).Return(nil, domain.ErrForbidden)
+
+		rec := get("?ids=" + tURL.ID)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		cases := []struct {
+			query string
+			field string
+		}{
+			{query: "", field: "ids"},
+			{query: "?ids=a,b,c,d,e,f", field: "ids"},
+			{query: "?ids=a!b", field: "ids"},
+			{query: "?ids=" + tURL.ID + "&window=0d", field: "window"},
+			{query: "?ids=" + tURL.ID + "&window=1y", field: "window"},
+		}
+		for _, tc := range cases {
+			rec := get(tc.query)
+			require.Equal(t, http.StatusBadRequest, rec.Code, tc.query)
+			re := new(domain.ResponseError)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+			assert.Equal(t, "validation error", re.Error)
+			assert.NotEmpty(t, re.Fields[tc.field], tc.query)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/v1/url/stats/compare?ids="+tURL.ID, nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+// testSubscription is domain.ClickSubscription fed by test
+type testSubscription struct {
+	clicks  chan *domain.Click
+	dropped atomic.Int64
+	closed  atomic.Bool
+}
+
+func (s *testSubscription) Clicks() <-chan *domain.Click { return s.clicks }
+
+func (s *testSubscription) Dropped() int64 { return s.dropped.Load() }
+
+func (s *testSubscription) Close() { s.closed.Store(true) }
+
+func TestClickHTTPStream(t *testing.T) {
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockClickUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	handler, err := clickHttp.NewClickHandler(uc, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+	handler.RegisterRoutes(e)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	// open starts stream, it is closed when ctx is canceled
+	open := func(t *testing.T, ctx context.Context) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/v1/url/"+tURL.ID+"/clicks/stream", nil)
+		require.NoError(t, err)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { res.Body.Close() })
+		return res, bufio.NewReader(res.Body)
+	}
+
+	// readEvent reads lines of the next event
+	readEvent := func(t *testing.T, r *bufio.Reader) []string {
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return lines
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	click := &domain.Click{
+		ID:        primitive.NewObjectID(),
+		URLID:     tURL.ID,
+		Campaign:  domain.Campaign{Source: "newsletter"},
+		Visitor:   "secret",
+		CreatedAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("clicks", func(t *testing.T) {
+		sub := &testSubscription{clicks: make(chan *domain.Click, 1)}
+		uc.EXPECT().Subscribe(gomock.Any(), tURL.ID, claims).Return(sub, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		res, r := open(t, ctx)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get(echo.HeaderContentType))
+		assert.Equal(t, "no-cache", res.Header.Get(echo.HeaderCacheControl))
+
+		sub.clicks <- click
+		assert.Equal(t, []string{
+			"id: " + click.ID.Hex(),
+			"event: click",
+			`data: {"id":"` + click.ID.Hex() + `","url_id":"` + tURL.ID + `","campaign":{"source":"newsletter"},"created_at":"2023-05-01T12:00:00Z"}`,
+		}, readEvent(t, r))
+
+		// slow client is told how many clicks it has missed
+		sub.dropped.Store(3)
+		sub.clicks <- click
+		assert.Equal(t, []string{"event: dropped", `data: {"dropped":3}`}, readEvent(t, r))
+		assert.Equal(t, "event: click", readEvent(t, r)[1])
+
+		// client disconnects
+		cancel()
+		require.Eventually(t, sub.closed.Load, time.Second, time.Millisecond)
+	})
+
+	t.Run("clicks are no longer recorded", func(t *testing.T) {
+		sub := &testSubscription{clicks: make(chan *domain.Click)}
+		uc.EXPECT().Subscribe(gomock.Any(), tURL.ID, claims).Return(sub, nil)
+
+		res, r := open(t, context.Background())
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		close(sub.clicks)
+		_, err := r.ReadString('\n')
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		uc.EXPECT().Subscribe(gomock.Any(), tURL.ID, claims).Return(nil, domain.ErrForbidden)
+
+		req := httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID+"/clicks/stream", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"error":"attempted action is not allowed"}`, rec.Body.String())
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		req := httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID+"/clicks/stream", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	// shutdown ends streams of the handler for good, so it goes last
+	t.Run("server shutdown", func(t *testing.T) {
+		sub := &testSubscription{clicks: make(chan *domain.Click)}
+		uc.EXPECT().Subscribe(gomock.Any(), tURL.ID, claims).Return(sub, nil)
+
+		res, r := open(t, context.Background())
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		handler.Shutdown()
+		_, err := r.ReadString('\n')
+		assert.ErrorIs(t, err, io.EOF)
+		assert.True(t, sub.closed.Load())
+	})
+}
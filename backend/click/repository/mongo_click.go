@@ -0,0 +1,782 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+)
+
+type mongoClickRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoClickRepository will create an object that represent the click.Repository interface
+func NewMongoClickRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.ClickRepository {
+	return &mongoClickRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoClickRepository) StoreMany(ctx context.Context, clicks []*domain.Click) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository StoreMany",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("clicks", len(clicks))),
+	)
+	defer span.End()
+
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(clicks))
+	for i, click := range clicks {
+		docs[i] = click
+	}
+	// unordered insert stores the rest of clicks when one of them fails
+	_, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("click store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoClickRepository) CampaignStats(ctx context.Context, urlID string) ([]*domain.CampaignStats, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository CampaignStats",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "url_id", Value: urlID}}}},
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{
+				primitive.E{Key: "source", Value: campaignField("source")},
+				primitive.E{Key: "medium", Value: campaignField("medium")},
+				primitive.E{Key: "campaign", Value: campaignField("name")},
+			}},
+			primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{primitive.E{Key: "$sort", Value: bson.D{
+			primitive.E{Key: "clicks", Value: -1},
+			primitive.E{Key: "_id.source", Value: 1},
+			primitive.E{Key: "_id.medium", Value: 1},
+			primitive.E{Key: "_id.campaign", Value: 1},
+		}}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{
+			primitive.E{Key: "_id", Value: 0},
+			primitive.E{Key: "source", Value: "$_id.source"},
+			primitive.E{Key: "medium", Value: "$_id.medium"},
+			primitive.E{Key: "campaign", Value: "$_id.campaign"},
+			primitive.E{Key: "clicks", Value: 1},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click stats error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]*domain.CampaignStats, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click stats cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+func (m *mongoClickRepository) ClickPatterns(ctx context.Context, urlID string, timezone string) (*domain.ClickPatterns, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository ClickPatterns",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID),
+			attribute.String("timezone", timezone)),
+	)
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "url_id", Value: urlID}}}},
+		bson.D{primitive.E{Key: "$facet", Value: bson.D{
+			primitive.E{Key: "hours", Value: bson.A{clicksBy("$hour", timezone)}},
+			primitive.E{Key: "weekdays", Value: bson.A{clicksBy("$dayOfWeek", timezone)}},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click patterns error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	type bucket struct {
+		Key    int   `bson:"_id"`
+		Clicks int64 `bson:"clicks"`
+	}
+	facets := make([]struct {
+		Hours    []bucket `bson:"hours"`
+		Weekdays []bucket `bson:"weekdays"`
+	}, 0, 1)
+	if err = cur.All(ctx, &facets); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click patterns cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	patterns := &domain.ClickPatterns{Timezone: timezone}
+	if len(facets) == 0 {
+		return patterns, nil
+	}
+	for _, b := range facets[0].Hours {
+		if b.Key >= 0 && b.Key < len(patterns.Hours) {
+			patterns.Hours[b.Key] = b.Clicks
+		}
+	}
+	// $dayOfWeek numbers days from 1 (Sunday) to 7 (Saturday)
+	for _, b := range facets[0].Weekdays {
+		if b.Key >= 1 && b.Key <= len(patterns.Weekdays) {
+			patterns.Weekdays[b.Key-1] = b.Clicks
+		}
+	}
+
+	return patterns, nil
+}
+
+// ClickStats reads rollups of hours completely within the range that have
+// passed, clicks of the current hour and of partially covered hours are read
+// from click collection
+func (m *mongoClickRepository) ClickStats(ctx context.Context, urlID string, from, to time.Time) (*domain.ClickStats, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository ClickStats",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	// rollups cover hours from first until last
+	first := from.Truncate(time.Hour)
+	if first.Before(from) {
+		first = first.Add(time.Hour)
+	}
+	last := to.Truncate(time.Hour)
+	if current := time.Now().UTC().Truncate(time.Hour); current.Before(last) {
+		last = current
+	}
+	if !first.Before(last) {
+		first, last = from, from
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "url_id", Value: urlID},
+			primitive.E{Key: "hour", Value: bson.D{
+				primitive.E{Key: "$gte", Value: first},
+				primitive.E{Key: "$lt", Value: last},
+			}},
+		}}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{
+			primitive.E{Key: "_id", Value: 0},
+			primitive.E{Key: "at", Value: "$hour"},
+			primitive.E{Key: "clicks", Value: 1},
+			primitive.E{Key: "untracked", Value: 1},
+			primitive.E{Key: "visitors", Value: 1},
+		}}},
+		bson.D{primitive.E{Key: "$unionWith", Value: bson.D{
+			primitive.E{Key: "coll", Value: m.cols.Name(store.ClickCollection)},
+			primitive.E{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{primitive.E{Key: "$match", Value: bson.D{
+					primitive.E{Key: "url_id", Value: urlID},
+					primitive.E{Key: "$or", Value: bson.A{
+						bson.D{primitive.E{Key: "created_at", Value: bson.D{
+							primitive.E{Key: "$gte", Value: from},
+							primitive.E{Key: "$lt", Value: first},
+						}}},
+						bson.D{primitive.E{Key: "created_at", Value: bson.D{
+							primitive.E{Key: "$gte", Value: last},
+							primitive.E{Key: "$lte", Value: to},
+						}}},
+					}},
+				}}},
+				bson.D{primitive.E{Key: "$project", Value: bson.D{
+					primitive.E{Key: "_id", Value: 0},
+					primitive.E{Key: "at", Value: "$created_at"},
+					primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$literal", Value: 1}}},
+					primitive.E{Key: "visitors", Value: bson.D{primitive.E{Key: "$cond", Value: bson.A{
+						bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$visitor", false}}},
+						bson.A{"$visitor"},
+						bson.A{},
+					}}}},
+				}}},
+			}},
+		}}},
+		// untracked clicks of partial hours are not in clicks
+		bson.D{primitive.E{Key: "$unionWith", Value: bson.D{
+			primitive.E{Key: "coll", Value: m.cols.Name(store.ClickRollupCollection)},
+			primitive.E{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{primitive.E{Key: "$match", Value: bson.D{
+					primitive.E{Key: "url_id", Value: urlID},
+					primitive.E{Key: "untracked", Value: bson.D{primitive.E{Key: "$gt", Value: 0}}},
+					primitive.E{Key: "$or", Value: bson.A{
+						bson.D{primitive.E{Key: "hour", Value: bson.D{
+							primitive.E{Key: "$gte", Value: from.Truncate(time.Hour)},
+							primitive.E{Key: "$lt", Value: first},
+						}}},
+						bson.D{primitive.E{Key: "hour", Value: bson.D{
+							primitive.E{Key: "$gte", Value: last},
+							primitive.E{Key: "$lte", Value: to},
+						}}},
+					}},
+				}}},
+				bson.D{primitive.E{Key: "$project", Value: bson.D{
+					primitive.E{Key: "_id", Value: 0},
+					primitive.E{Key: "at", Value: "$hour"},
+					primitive.E{Key: "clicks", Value: "$untracked"},
+					primitive.E{Key: "untracked", Value: 1},
+					primitive.E{Key: "visitors", Value: bson.A{}},
+				}}},
+			}},
+		}}},
+		bson.D{primitive.E{Key: "$facet", Value: bson.D{
+			primitive.E{Key: "totals", Value: bson.A{
+				bson.D{primitive.E{Key: "$group", Value: bson.D{
+					primitive.E{Key: "_id", Value: nil},
+					primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: "$clicks"}}},
+					primitive.E{Key: "untracked", Value: bson.D{primitive.E{Key: "$sum", Value: "$untracked"}}},
+				}}},
+			}},
+			primitive.E{Key: "uniques", Value: bson.A{
+				bson.D{primitive.E{Key: "$unwind", Value: "$visitors"}},
+				bson.D{primitive.E{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "$visitors"}}}},
+				bson.D{primitive.E{Key: "$count", Value: "uniques"}},
+			}},
+			primitive.E{Key: "daily", Value: bson.A{
+				bson.D{primitive.E{Key: "$group", Value: bson.D{
+					primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$dateToString", Value: bson.D{
+						primitive.E{Key: "format", Value: "%Y-%m-%d"},
+						primitive.E{Key: "date", Value: "$at"},
+					}}}},
+					primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: "$clicks"}}},
+				}}},
+			}},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickRollupCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click stats error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	facets := make([]struct {
+		Totals []struct {
+			Clicks    int64 `bson:"clicks"`
+			Untracked int64 `bson:"untracked"`
+		} `bson:"totals"`
+		Uniques []struct {
+			Uniques int64 `bson:"uniques"`
+		} `bson:"uniques"`
+		Daily []struct {
+			Day    string `bson:"_id"`
+			Clicks int64  `bson:"clicks"`
+		} `bson:"daily"`
+	}, 0, 1)
+	if err = cur.All(ctx, &facets); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click stats cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	stats := &domain.ClickStats{Daily: make(map[string]int64)}
+	if len(facets) == 0 {
+		return stats, nil
+	}
+	if len(facets[0].Totals) > 0 {
+		stats.Clicks = facets[0].Totals[0].Clicks
+		stats.Untracked = facets[0].Totals[0].Untracked
+	}
+	if len(facets[0].Uniques) > 0 {
+		stats.Uniques = facets[0].Uniques[0].Uniques
+	}
+	for _, d := range facets[0].Daily {
+		stats.Daily[d.Day] = d.Clicks
+	}
+
+	return stats, nil
+}
+
+func (m *mongoClickRepository) AddToRollup(ctx context.Context, clicks []*domain.Click) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository AddToRollup",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("clicks", len(clicks))),
+	)
+	defer span.End()
+
+	// clicks are counted in memory, so every rollup is updated once
+	return m.AddRollupDeltas(ctx, domain.RollupDeltas(clicks))
+}
+
+func (m *mongoClickRepository) AddRollupDeltas(ctx context.Context, deltas []*domain.RollupDelta) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository AddRollupDeltas",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("rollups", len(deltas))),
+	)
+	defer span.End()
+
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(deltas))
+	for _, d := range deltas {
+		filter := bson.D{
+			primitive.E{Key: "url_id", Value: d.URLID},
+			primitive.E{Key: "hour", Value: d.Hour.UTC()},
+		}
+		update := bson.D{primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "clicks", Value: d.Clicks},
+			primitive.E{Key: "bots", Value: d.Bots},
+			primitive.E{Key: "untracked", Value: d.Untracked},
+		}}}
+		if len(d.Visitors) > 0 {
+			update = append(update, primitive.E{Key: "$addToSet", Value: bson.D{primitive.E{Key: "visitors", Value: bson.D{
+				primitive.E{Key: "$each", Value: d.Visitors},
+			}}}})
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+
+	collection := m.Conn.Collection(m.cols.Name(store.ClickRollupCollection))
+	opts := options.BulkWrite().SetOrdered(false)
+	_, err := collection.BulkWrite(ctx, models, opts)
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		// another instance inserted rollups of the hour first, they are
+		// updated without upsert
+		retry := make([]mongo.WriteModel, 0, len(bulkErr.WriteErrors))
+		for _, we := range bulkErr.WriteErrors {
+			model, ok := we.Request.(*mongo.UpdateOneModel)
+			if !ok || !mongo.IsDuplicateKeyError(we.WriteError) {
+				retry = nil
+				break
+			}
+			retry = append(retry, mongo.NewUpdateOneModel().SetFilter(model.Filter).SetUpdate(model.Update))
+		}
+		if len(retry) > 0 {
+			_, err = collection.BulkWrite(ctx, retry, opts)
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("click rollup error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+// RebuildRollups merges rollups computed from click collection into rollup
+// collection, so running it again or on several instances at once gives the
+// same result
+func (m *mongoClickRepository) RebuildRollups(ctx context.Context, from, to time.Time) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository RebuildRollups",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "created_at", Value: bson.D{
+				primitive.E{Key: "$gte", Value: from.UTC().Truncate(time.Hour)},
+				primitive.E{Key: "$lt", Value: to.UTC().Truncate(time.Hour)},
+			}},
+		}}},
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{
+				primitive.E{Key: "url_id", Value: "$url_id"},
+				primitive.E{Key: "hour", Value: bson.D{primitive.E{Key: "$dateTrunc", Value: bson.D{
+					primitive.E{Key: "date", Value: "$created_at"},
+					primitive.E{Key: "unit", Value: "hour"},
+				}}}},
+			}},
+			primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+			primitive.E{Key: "bots", Value: bson.D{primitive.E{Key: "$sum", Value: bson.D{primitive.E{Key: "$cond", Value: bson.A{"$bot", 1, 0}}}}}},
+			primitive.E{Key: "visitors", Value: bson.D{primitive.E{Key: "$addToSet", Value: "$visitor"}}},
+		}}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{
+			primitive.E{Key: "_id", Value: 0},
+			primitive.E{Key: "url_id", Value: "$_id.url_id"},
+			primitive.E{Key: "hour", Value: "$_id.hour"},
+			primitive.E{Key: "clicks", Value: 1},
+			primitive.E{Key: "bots", Value: 1},
+			primitive.E{Key: "visitors", Value: 1},
+		}}},
+		bson.D{primitive.E{Key: "$merge", Value: bson.D{
+			primitive.E{Key: "into", Value: m.cols.Name(store.ClickRollupCollection)},
+			primitive.E{Key: "on", Value: bson.A{"url_id", "hour"}},
+			// untracked clicks are counted in rollups only
+			primitive.E{Key: "whenMatched", Value: mongo.Pipeline{
+				bson.D{primitive.E{Key: "$set", Value: bson.D{
+					primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$add", Value: bson.A{
+						"$$new.clicks",
+						bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$untracked", 0}}},
+					}}}},
+					primitive.E{Key: "bots", Value: "$$new.bots"},
+					primitive.E{Key: "visitors", Value: "$$new.visitors"},
+				}}},
+			}},
+			primitive.E{Key: "whenNotMatched", Value: "insert"},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("click rollup rebuild error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	if err = cur.Close(ctx); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("click rollup rebuild cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoClickRepository) TopReferrers(ctx context.Context, urlID string, from, to time.Time, limit int) ([]*domain.ReferrerStats, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository TopReferrers",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "url_id", Value: urlID},
+			primitive.E{Key: "created_at", Value: bson.D{
+				primitive.E{Key: "$gte", Value: from},
+				primitive.E{Key: "$lte", Value: to},
+			}},
+		}}},
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$referrer", domain.ReferrerDirect}}}},
+			primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{primitive.E{Key: "$sort", Value: bson.D{
+			primitive.E{Key: "clicks", Value: -1},
+			primitive.E{Key: "_id", Value: 1},
+		}}},
+		bson.D{primitive.E{Key: "$limit", Value: limit}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{
+			primitive.E{Key: "_id", Value: 0},
+			primitive.E{Key: "referrer", Value: "$_id"},
+			primitive.E{Key: "clicks", Value: 1},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click referrers error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]*domain.ReferrerStats, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click referrers cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+// TopURLs sums hourly rollups by URL, URLs are joined after sorting, so
+// deleted ones are skipped too
+func (m *mongoClickRepository) TopURLs(ctx context.Context, from, now time.Time, limit int) ([]string, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository TopURLs",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "hour", Value: bson.D{primitive.E{Key: "$gte", Value: from.UTC().Truncate(time.Hour)}}},
+		}}},
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: "$url_id"},
+			primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: "$clicks"}}},
+		}}},
+		bson.D{primitive.E{Key: "$sort", Value: bson.D{
+			primitive.E{Key: "clicks", Value: -1},
+			primitive.E{Key: "_id", Value: 1},
+		}}},
+		bson.D{primitive.E{Key: "$lookup", Value: bson.D{
+			primitive.E{Key: "from", Value: m.cols.Name(store.URLCollection)},
+			primitive.E{Key: "localField", Value: "_id"},
+			primitive.E{Key: "foreignField", Value: "_id"},
+			primitive.E{Key: "as", Value: "url"},
+		}}},
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "url", Value: bson.D{primitive.E{Key: "$elemMatch", Value: bson.D{
+				primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$gt", Value: now}}},
+				primitive.E{Key: "blocked_by", Value: bson.D{primitive.E{Key: "$exists", Value: false}}},
+			}}}},
+		}}},
+		bson.D{primitive.E{Key: "$limit", Value: limit}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{primitive.E{Key: "_id", Value: 1}}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickRollupCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click top urls error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	found := make([]struct {
+		ID string `bson:"_id"`
+	}, 0)
+	if err = cur.All(ctx, &found); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click top urls cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]string, 0, len(found))
+	for _, f := range found {
+		result = append(result, f.ID)
+	}
+
+	return result, nil
+}
+
+// clicksBy returns stage grouping clicks by date operator value of click time
+// in time zone
+func clicksBy(operator, timezone string) bson.D {
+	return bson.D{primitive.E{Key: "$group", Value: bson.D{
+		primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: operator, Value: bson.D{
+			primitive.E{Key: "date", Value: "$created_at"},
+			primitive.E{Key: "timezone", Value: timezone},
+		}}}},
+		primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+	}}}
+}
+
+// campaignField returns expression of campaign field value, absent values are
+// domain.CampaignNone
+func campaignField(name string) bson.D {
+	return bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$campaign." + name, domain.CampaignNone}}}
+}
+
+func (m *mongoClickRepository) UntrackedClicks(ctx context.Context, urlID string, from, to time.Time) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository UntrackedClicks",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "url_id", Value: urlID},
+			primitive.E{Key: "hour", Value: bson.D{
+				primitive.E{Key: "$gte", Value: from.UTC().Truncate(time.Hour)},
+				primitive.E{Key: "$lte", Value: to},
+			}},
+			primitive.E{Key: "untracked", Value: bson.D{primitive.E{Key: "$gt", Value: 0}}},
+		}}},
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: nil},
+			primitive.E{Key: "untracked", Value: bson.D{primitive.E{Key: "$sum", Value: "$untracked"}}},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickRollupCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("untracked clicks error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	totals := make([]struct {
+		Untracked int64 `bson:"untracked"`
+	}, 0, 1)
+	if err = cur.All(ctx, &totals); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("untracked clicks cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+
+	return totals[0].Untracked, nil
+}
+
+// purgeURLBatch is the number of URLs whose clicks are deleted at once
+const purgeURLBatch = 1000
+
+func (m *mongoClickRepository) Purge(ctx context.Context, filter domain.ClickPurgeFilter) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Purge",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("userid", filter.UserID),
+			attribute.String("before", filter.Before.Format(time.RFC3339))),
+	)
+	defer span.End()
+
+	if filter.UserID == "" {
+		n, err := m.deleteBefore(ctx, nil, filter.Before)
+		if err != nil {
+			span.RecordError(err)
+			return 0, err
+		}
+		return n, nil
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).Find(ctx,
+		bson.D{primitive.E{Key: "user_id", Value: filter.UserID}},
+		options.Find().SetProjection(bson.D{primitive.E{Key: "_id", Value: 1}}))
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("click purge error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	defer func(ctx context.Context) {
+		if err := cur.Close(ctx); err != nil {
+			web.LoggerFromContext(ctx).Error("can't close cursor: ", zap.Error(err))
+		}
+	}(ctx)
+
+	var deleted int64
+	ids := make([]string, 0, purgeURLBatch)
+	for cur.Next(ctx) {
+		if id, ok := cur.Current.Lookup("_id").StringValueOK(); ok {
+			ids = append(ids, id)
+		}
+		if len(ids) < purgeURLBatch {
+			continue
+		}
+		n, err := m.deleteBefore(ctx, ids, filter.Before)
+		deleted += n
+		if err != nil {
+			span.RecordError(err)
+			return deleted, err
+		}
+		ids = ids[:0]
+	}
+	if err = cur.Err(); err != nil {
+		span.RecordError(err)
+		return deleted, fmt.Errorf("click purge cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	if len(ids) > 0 {
+		n, err := m.deleteBefore(ctx, ids, filter.Before)
+		deleted += n
+		if err != nil {
+			span.RecordError(err)
+			return deleted, err
+		}
+	}
+	span.SetAttributes(attribute.Int64("deleted", deleted))
+
+	return deleted, nil
+}
+
+func (m *mongoClickRepository) FetchClicks(ctx context.Context, filter domain.ClickFilter) ([]*domain.Click, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository FetchClicks",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("urls", len(filter.URLIDs)),
+			attribute.Int("ids", len(filter.IDs))),
+	)
+	defer span.End()
+
+	query := bson.D{}
+	if filter.URLIDs != nil {
+		query = append(query, primitive.E{Key: "url_id", Value: bson.D{primitive.E{Key: "$in", Value: filter.URLIDs}}})
+	}
+	id := bson.D{}
+	if filter.IDs != nil {
+		id = append(id, primitive.E{Key: "$in", Value: filter.IDs})
+	}
+	if !filter.Cursor.IsZero() {
+		id = append(id, primitive.E{Key: "$gt", Value: filter.Cursor})
+	}
+	if len(id) > 0 {
+		query = append(query, primitive.E{Key: "_id", Value: id})
+	}
+
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "_id", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(filter.Limit)
+	}
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).Find(ctx, query, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	clicks := make([]*domain.Click, 0)
+	if err = cur.All(ctx, &clicks); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("click fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return clicks, nil
+}
+
+// deleteBefore deletes clicks made before given time on URLs with ids, or on
+// all URLs when ids are nil
+func (m *mongoClickRepository) deleteBefore(ctx context.Context, ids []string, before time.Time) (int64, error) {
+	query := bson.D{primitive.E{Key: "created_at", Value: bson.D{primitive.E{Key: "$lt", Value: before}}}}
+	if ids != nil {
+		query = append(query, primitive.E{Key: "url_id", Value: bson.D{primitive.E{Key: "$in", Value: ids}}})
+	}
+
+	res, err := m.Conn.Collection(m.cols.Name(store.ClickCollection)).DeleteMany(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("click purge error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,775 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/click/repository"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func TestMongoClickRepository_StoreMany(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tClick := &domain.Click{
+		ID:        primitive.NewObjectID(),
+		URLID:     "test123",
+		Campaign:  domain.Campaign{Source: "newsletter"},
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.StoreMany(noopCtx, []*domain.Click{tClick, {ID: primitive.NewObjectID(), URLID: "test456"}})
+
+		require.NoError(mt, err)
+		command := mt.GetStartedEvent().Command
+		assert.False(mt, command.Lookup("ordered").Boolean())
+		docs, err := command.Lookup("documents").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, docs, 2)
+		doc := docs[0].Document()
+		assert.Equal(mt, "newsletter", doc.Lookup("campaign", "source").StringValue())
+		_, err = doc.LookupErr("campaign", "medium")
+		assert.Error(mt, err, "absent campaign values are not stored")
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.StoreMany(noopCtx, []*domain.Click{tClick})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+
+	mt.Run("no clicks", func(mt *mtest.T) {
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.StoreMany(noopCtx, nil)
+
+		require.NoError(mt, err)
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
+
+func TestMongoClickRepository_CampaignStats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click", mtest.FirstBatch,
+				bson.D{
+					{Key: "clicks", Value: int32(3)},
+					{Key: "source", Value: "newsletter"},
+					{Key: "medium", Value: "email"},
+					{Key: "campaign", Value: "spring"},
+				},
+				bson.D{
+					{Key: "clicks", Value: int32(1)},
+					{Key: "source", Value: domain.CampaignNone},
+					{Key: "medium", Value: domain.CampaignNone},
+					{Key: "campaign", Value: domain.CampaignNone},
+				},
+			),
+			mtest.CreateCursorResponse(0, "test.click", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.CampaignStats(noopCtx, "test123")
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.CampaignStats{
+			{Source: "newsletter", Medium: "email", Campaign: "spring", Clicks: 3},
+			{Source: domain.CampaignNone, Medium: domain.CampaignNone, Campaign: domain.CampaignNone, Clicks: 1},
+		}, stats)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		match := pipeline.Index(0).Value().Document().Lookup("$match", "url_id")
+		assert.Equal(mt, "test123", match.StringValue())
+		group := pipeline.Index(1).Value().Document().Lookup("$group", "_id", "source", "$ifNull").Array()
+		assert.Equal(mt, "$campaign.source", group.Index(0).Value().StringValue())
+		assert.Equal(mt, domain.CampaignNone, group.Index(1).Value().StringValue())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.CampaignStats(noopCtx, "test123")
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, stats)
+	})
+}
+
+func TestMongoClickRepository_ClickPatterns(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click", mtest.FirstBatch, bson.D{
+				{Key: "hours", Value: bson.A{
+					bson.D{{Key: "_id", Value: int32(0)}, {Key: "clicks", Value: int32(2)}},
+					bson.D{{Key: "_id", Value: int32(23)}, {Key: "clicks", Value: int32(5)}},
+				}},
+				{Key: "weekdays", Value: bson.A{
+					bson.D{{Key: "_id", Value: int32(1)}, {Key: "clicks", Value: int32(4)}},
+					bson.D{{Key: "_id", Value: int32(7)}, {Key: "clicks", Value: int32(3)}},
+				}},
+			}),
+			mtest.CreateCursorResponse(0, "test.click", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		patterns, err := r.ClickPatterns(noopCtx, "test123", "Europe/Berlin")
+
+		require.NoError(mt, err)
+		expected := &domain.ClickPatterns{Timezone: "Europe/Berlin"}
+		expected.Hours[0] = 2
+		expected.Hours[23] = 5
+		expected.Weekdays[time.Sunday] = 4
+		expected.Weekdays[time.Saturday] = 3
+		assert.Equal(mt, expected, patterns)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		facet := pipeline.Index(1).Value().Document().Lookup("$facet").Document()
+		hour := facet.Lookup("hours").Array().Index(0).Value().Document().Lookup("$group", "_id", "$hour").Document()
+		assert.Equal(mt, "$created_at", hour.Lookup("date").StringValue())
+		assert.Equal(mt, "Europe/Berlin", hour.Lookup("timezone").StringValue())
+		weekday := facet.Lookup("weekdays").Array().Index(0).Value().Document().Lookup("$group", "_id", "$dayOfWeek").Document()
+		assert.Equal(mt, "Europe/Berlin", weekday.Lookup("timezone").StringValue())
+	})
+
+	mt.Run("no clicks", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click", mtest.FirstBatch, bson.D{
+				{Key: "hours", Value: bson.A{}},
+				{Key: "weekdays", Value: bson.A{}},
+			}),
+			mtest.CreateCursorResponse(0, "test.click", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		patterns, err := r.ClickPatterns(noopCtx, "test123", "UTC")
+
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.ClickPatterns{Timezone: "UTC"}, patterns)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		patterns, err := r.ClickPatterns(noopCtx, "test123", "UTC")
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, patterns)
+	})
+}
+
+func TestMongoClickRepository_ClickStats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	to := time.Now().Truncate(time.Millisecond).UTC()
+	from := to.Truncate(24*time.Hour).AddDate(0, 0, -29)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click_rollup", mtest.FirstBatch, bson.D{
+				{Key: "totals", Value: bson.A{
+					bson.D{{Key: "clicks", Value: int32(5)}, {Key: "untracked", Value: int32(1)}},
+				}},
+				{Key: "uniques", Value: bson.A{
+					bson.D{{Key: "uniques", Value: int32(3)}},
+				}},
+				{Key: "daily", Value: bson.A{
+					bson.D{{Key: "_id", Value: "2023-03-01"}, {Key: "clicks", Value: int32(2)}},
+					bson.D{{Key: "_id", Value: "2023-03-03"}, {Key: "clicks", Value: int32(3)}},
+				}},
+			}),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.ClickStats(noopCtx, "test123", from, to)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.ClickStats{
+			Clicks:    5,
+			Uniques:   3,
+			Untracked: 1,
+			Daily:     map[string]int64{"2023-03-01": 2, "2023-03-03": 3},
+		}, stats)
+
+		// completed hours are read from rollups, the current hour from clicks
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, "click_rollup", command.Lookup("aggregate").StringValue())
+		rollups, clicks := statsRanges(mt, command)
+		assert.Equal(mt, [2]int64{from.UnixMilli(), to.Truncate(time.Hour).UnixMilli()}, rollups)
+		assert.Equal(mt, [][2]int64{
+			{from.UnixMilli(), from.UnixMilli()},
+			{to.Truncate(time.Hour).UnixMilli(), to.UnixMilli()},
+		}, clicks)
+	})
+
+	mt.Run("partial hours", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click_rollup", mtest.FirstBatch, bson.D{}),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		from := to.Truncate(time.Hour).Add(-150 * time.Minute)
+		to := to.Truncate(time.Hour).Add(-30 * time.Minute)
+
+		_, err := r.ClickStats(noopCtx, "test123", from, to)
+
+		require.NoError(mt, err)
+		rollups, clicks := statsRanges(mt, mt.GetStartedEvent().Command)
+		assert.Equal(mt, [2]int64{from.Add(30 * time.Minute).UnixMilli(), to.Add(-30 * time.Minute).UnixMilli()}, rollups)
+		assert.Equal(mt, [][2]int64{
+			{from.UnixMilli(), from.Add(30 * time.Minute).UnixMilli()},
+			{to.Add(-30 * time.Minute).UnixMilli(), to.UnixMilli()},
+		}, clicks)
+	})
+
+	mt.Run("no completed hours", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click_rollup", mtest.FirstBatch, bson.D{}),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		from := to.Truncate(time.Hour)
+
+		_, err := r.ClickStats(noopCtx, "test123", from, to)
+
+		require.NoError(mt, err)
+		rollups, clicks := statsRanges(mt, mt.GetStartedEvent().Command)
+		assert.Equal(mt, [2]int64{from.UnixMilli(), from.UnixMilli()}, rollups)
+		assert.Equal(mt, [][2]int64{
+			{from.UnixMilli(), from.UnixMilli()},
+			{from.UnixMilli(), to.UnixMilli()},
+		}, clicks)
+	})
+
+	mt.Run("no clicks", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click_rollup", mtest.FirstBatch, bson.D{
+				{Key: "totals", Value: bson.A{}},
+				{Key: "uniques", Value: bson.A{}},
+				{Key: "daily", Value: bson.A{}},
+			}),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.ClickStats(noopCtx, "test123", from, to)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.ClickStats{Daily: map[string]int64{}}, stats)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.ClickStats(noopCtx, "test123", from, to)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, stats)
+	})
+}
+
+// statsRanges returns range of rollup hours and ranges of click times read
+// by click stats aggregation as unix milliseconds
+func statsRanges(mt *mtest.T, command bson.Raw) ([2]int64, [][2]int64) {
+	pipeline := command.Lookup("pipeline").Array()
+	match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+	assert.Equal(mt, "test123", match.Lookup("url_id").StringValue())
+	rollups := [2]int64{int64(match.Lookup("hour", "$gte").DateTime()), int64(match.Lookup("hour", "$lt").DateTime())}
+
+	union := pipeline.Index(2).Value().Document().Lookup("$unionWith").Document()
+	assert.Equal(mt, "click", union.Lookup("coll").StringValue())
+	match = union.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+	assert.Equal(mt, "test123", match.Lookup("url_id").StringValue())
+	or := match.Lookup("$or").Array()
+	before := or.Index(0).Value().Document().Lookup("created_at").Document()
+	after := or.Index(1).Value().Document().Lookup("created_at").Document()
+	clicks := [][2]int64{
+		{int64(before.Lookup("$gte").DateTime()), int64(before.Lookup("$lt").DateTime())},
+		{int64(after.Lookup("$gte").DateTime()), int64(after.Lookup("$lte").DateTime())},
+	}
+
+	// untracked clicks of partial hours are read from rollups
+	union = pipeline.Index(3).Value().Document().Lookup("$unionWith").Document()
+	assert.Equal(mt, "click_rollup", union.Lookup("coll").StringValue())
+	or = union.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match", "$or").Array()
+	assert.Equal(mt, clicks[0][1], int64(or.Index(0).Value().Document().Lookup("hour", "$lt").DateTime()))
+	assert.Equal(mt, clicks[1], [2]int64{
+		int64(or.Index(1).Value().Document().Lookup("hour", "$gte").DateTime()),
+		int64(or.Index(1).Value().Document().Lookup("hour", "$lte").DateTime()),
+	})
+
+	return rollups, clicks
+}
+
+func TestMongoClickRepository_TopReferrers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	to := time.Now().Truncate(time.Millisecond).UTC()
+	from := to.AddDate(0, 0, -30)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click", mtest.FirstBatch,
+				bson.D{{Key: "referrer", Value: "news.example.com"}, {Key: "clicks", Value: int32(3)}},
+				bson.D{{Key: "referrer", Value: domain.ReferrerDirect}, {Key: "clicks", Value: int32(1)}},
+			),
+			mtest.CreateCursorResponse(0, "test.click", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		referrers, err := r.TopReferrers(noopCtx, "test123", from, to, 10)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.ReferrerStats{
+			{Referrer: "news.example.com", Clicks: 3},
+			{Referrer: domain.ReferrerDirect, Clicks: 1},
+		}, referrers)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		group := pipeline.Index(1).Value().Document().Lookup("$group", "_id", "$ifNull").Array()
+		assert.Equal(mt, "$referrer", group.Index(0).Value().StringValue())
+		assert.Equal(mt, domain.ReferrerDirect, group.Index(1).Value().StringValue())
+		assert.Equal(mt, int32(10), pipeline.Index(3).Value().Document().Lookup("$limit").Int32())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		referrers, err := r.TopReferrers(noopCtx, "test123", from, to, 10)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, referrers)
+	})
+}
+
+func TestMongoClickRepository_TopURLs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	from := now.AddDate(0, 0, -7)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click_rollup", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "popular"}},
+				bson.D{{Key: "_id", Value: "other"}},
+			),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		ids, err := r.TopURLs(noopCtx, from, now, 100)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"popular", "other"}, ids)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		assert.Equal(mt, from.Truncate(time.Hour), pipeline.Index(0).Value().Document().Lookup("$match", "hour", "$gte").Time().UTC())
+		url := pipeline.Index(4).Value().Document().Lookup("$match", "url", "$elemMatch").Document()
+		assert.Equal(mt, now, url.Lookup("expiration_date", "$gt").Time().UTC())
+		assert.False(mt, url.Lookup("blocked_by", "$exists").Boolean())
+		assert.Equal(mt, int32(100), pipeline.Index(5).Value().Document().Lookup("$limit").Int32())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		ids, err := r.TopURLs(noopCtx, from, now, 100)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, ids)
+	})
+}
+
+func TestMongoClickRepository_AddToRollup(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tClick := &domain.Click{
+		ID:        primitive.NewObjectID(),
+		URLID:     "test123",
+		Visitor:   "visitor",
+		Bot:       true,
+		CreatedAt: time.Date(2023, 3, 1, 12, 34, 56, 0, time.UTC),
+	}
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.AddToRollup(noopCtx, []*domain.Click{tClick})
+
+		require.NoError(mt, err)
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, "click_rollup", command.Lookup("update").StringValue())
+		update := command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("upsert").Boolean())
+		assert.Equal(mt, "test123", update.Lookup("q", "url_id").StringValue())
+		assert.Equal(mt, time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC).UnixMilli(), int64(update.Lookup("q", "hour").DateTime()))
+		assert.EqualValues(mt, 1, update.Lookup("u", "$inc", "clicks").AsInt64())
+		assert.EqualValues(mt, 1, update.Lookup("u", "$inc", "bots").AsInt64())
+		assert.Equal(mt, "visitor", update.Lookup("u", "$addToSet", "visitors", "$each").Array().Index(0).Value().StringValue())
+	})
+
+	mt.Run("clicks counted by rollup", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}})
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		nextHour := *tClick
+		nextHour.CreatedAt = tClick.CreatedAt.Add(time.Hour)
+
+		err := r.AddToRollup(noopCtx, []*domain.Click{tClick, {URLID: "test123", Visitor: "other", CreatedAt: tClick.CreatedAt}, &nextHour})
+
+		require.NoError(mt, err)
+		updates, err := mt.GetStartedEvent().Command.Lookup("updates").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, updates, 2)
+		update := updates[0].Document()
+		assert.EqualValues(mt, 2, update.Lookup("u", "$inc", "clicks").AsInt64())
+		assert.EqualValues(mt, 1, update.Lookup("u", "$inc", "bots").AsInt64())
+		visitors, err := update.Lookup("u", "$addToSet", "visitors", "$each").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, visitors, 2)
+		assert.Equal(mt, time.Date(2023, 3, 1, 13, 0, 0, 0, time.UTC).UnixMilli(), int64(updates[1].Document().Lookup("q", "hour").DateTime()))
+	})
+
+	mt.Run("without visitor", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		click := *tClick
+		click.Visitor = ""
+		click.Bot = false
+
+		err := r.AddToRollup(noopCtx, []*domain.Click{&click})
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.EqualValues(mt, 0, update.Lookup("u", "$inc", "bots").AsInt64())
+		_, err = update.LookupErr("u", "$addToSet")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("untracked", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.AddToRollup(noopCtx, []*domain.Click{{URLID: "test123", Untracked: true, CreatedAt: tClick.CreatedAt}})
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.EqualValues(mt, 1, update.Lookup("u", "$inc", "clicks").AsInt64())
+		assert.EqualValues(mt, 1, update.Lookup("u", "$inc", "untracked").AsInt64())
+	})
+
+	mt.Run("concurrent insert", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.AddToRollup(noopCtx, []*domain.Click{tClick})
+
+		require.NoError(mt, err)
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, err = update.LookupErr("upsert")
+		assert.Error(mt, err, "update is retried without upsert")
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.AddToRollup(noopCtx, []*domain.Click{tClick})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoClickRepository_AddRollupDeltas(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	hour := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}})
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.AddRollupDeltas(noopCtx, []*domain.RollupDelta{
+			{URLID: "test123", Hour: hour, Clicks: 1000, Bots: 10, Untracked: 5, Visitors: []string{"visitor", "other"}},
+			{URLID: "test456", Hour: hour, Clicks: 1},
+		})
+
+		require.NoError(mt, err)
+		events := 0
+		for e := mt.GetStartedEvent(); e != nil; e = mt.GetStartedEvent() {
+			events++
+			updates, err := e.Command.Lookup("updates").Array().Values()
+			require.NoError(mt, err)
+			require.Len(mt, updates, 2)
+			update := updates[0].Document()
+			assert.Equal(mt, "test123", update.Lookup("q", "url_id").StringValue())
+			assert.EqualValues(mt, 1000, update.Lookup("u", "$inc", "clicks").AsInt64())
+			assert.EqualValues(mt, 10, update.Lookup("u", "$inc", "bots").AsInt64())
+			assert.EqualValues(mt, 5, update.Lookup("u", "$inc", "untracked").AsInt64())
+			visitors, err := update.Lookup("u", "$addToSet", "visitors", "$each").Array().Values()
+			require.NoError(mt, err)
+			assert.Len(mt, visitors, 2)
+		}
+		assert.Equal(mt, 1, events, "deltas are added with a single write")
+	})
+
+	mt.Run("no deltas", func(mt *mtest.T) {
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.AddRollupDeltas(noopCtx, nil)
+
+		require.NoError(mt, err)
+		assert.Nil(mt, mt.GetStartedEvent())
+	})
+}
+
+func TestMongoClickRepository_RebuildRollups(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	to := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	from := to.Add(-6 * time.Hour)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.click", mtest.FirstBatch))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.RebuildRollups(noopCtx, from, to.Add(30*time.Minute))
+
+		require.NoError(mt, err)
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, "click", command.Lookup("aggregate").StringValue())
+		pipeline := command.Lookup("pipeline").Array()
+		match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+		assert.Equal(mt, from.UnixMilli(), int64(match.Lookup("created_at", "$gte").DateTime()))
+		assert.Equal(mt, to.UnixMilli(), int64(match.Lookup("created_at", "$lt").DateTime()), "partial hour is not rebuilt")
+		merge := pipeline.Index(3).Value().Document().Lookup("$merge").Document()
+		assert.Equal(mt, "click_rollup", merge.Lookup("into").StringValue())
+		set := merge.Lookup("whenMatched").Array().Index(0).Value().Document().Lookup("$set").Document()
+		assert.Equal(mt, "$$new.clicks", set.Lookup("clicks", "$add").Array().Index(0).Value().StringValue())
+		assert.Equal(mt, "$untracked", set.Lookup("clicks", "$add").Array().Index(1).Value().Document().Lookup("$ifNull").Array().Index(0).Value().StringValue(), "untracked clicks are kept")
+		assert.Equal(mt, "$$new.visitors", set.Lookup("visitors").StringValue())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.RebuildRollups(noopCtx, from, to)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoClickRepository_UntrackedClicks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	to := time.Date(2023, 3, 1, 12, 30, 0, 0, time.UTC)
+	from := to.Add(-6 * time.Hour)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.click_rollup", mtest.FirstBatch, bson.D{{Key: "untracked", Value: int32(7)}}),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.NextBatch),
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.UntrackedClicks(noopCtx, "test123", from, to)
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 7, n)
+		match := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+		assert.Equal(mt, "test123", match.Lookup("url_id").StringValue())
+		assert.Equal(mt, from.Truncate(time.Hour).UnixMilli(), int64(match.Lookup("hour", "$gte").DateTime()))
+	})
+
+	mt.Run("no untracked clicks", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.click_rollup", mtest.FirstBatch))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.UntrackedClicks(noopCtx, "test123", from, to)
+
+		require.NoError(mt, err)
+		assert.Zero(mt, n)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		_, err := r.UntrackedClicks(noopCtx, "test123", from, to)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoClickRepository_Purge(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	before := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("all urls", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 5}})
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.Purge(noopCtx, domain.ClickPurgeFilter{Before: before})
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 5, n)
+		query := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, before.UnixMilli(), int64(query.Lookup("created_at", "$lt").DateTime()))
+		_, err = query.LookupErr("url_id")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("urls of user", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.url", mtest.FirstBatch, bson.D{{Key: "_id", Value: "test123"}}, bson.D{{Key: "_id", Value: "test456"}}),
+			mtest.CreateCursorResponse(0, "test.url", mtest.NextBatch),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 3}},
+		)
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.Purge(noopCtx, domain.ClickPurgeFilter{UserID: "507f191e810c19729de860ea", Before: before})
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 3, n)
+		find := mt.GetStartedEvent().Command
+		assert.Equal(mt, "507f191e810c19729de860ea", find.Lookup("filter", "user_id").StringValue())
+		mt.GetStartedEvent() // getMore
+		query := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		ids := query.Lookup("url_id", "$in").Array()
+		assert.Equal(mt, "test123", ids.Index(0).Value().StringValue())
+		assert.Equal(mt, "test456", ids.Index(1).Value().StringValue())
+	})
+
+	mt.Run("user without urls", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.url", mtest.FirstBatch))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.Purge(noopCtx, domain.ClickPurgeFilter{UserID: "507f191e810c19729de860ea", Before: before})
+
+		require.NoError(mt, err)
+		assert.Zero(mt, n)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		_, err := r.Purge(noopCtx, domain.ClickPurgeFilter{Before: before})
+
+		require.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoClickRepository_FetchClicks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	id := primitive.NewObjectID()
+	createdAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("clicks on urls", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.click", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: id}, {Key: "url_id", Value: "test123"}, {Key: "ip", Value: "192.0.2.1"}, {Key: "created_at", Value: createdAt}}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		cursor := primitive.NewObjectIDFromTimestamp(createdAt.Add(-time.Hour))
+
+		clicks, err := r.FetchClicks(noopCtx, domain.ClickFilter{URLIDs: []string{"test123"}, Cursor: cursor, Limit: 10})
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.Click{{ID: id, URLID: "test123", IP: "192.0.2.1", CreatedAt: createdAt}}, clicks)
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(mt, "test123", cmd.Lookup("filter", "url_id", "$in").Array().Index(0).Value().StringValue())
+		assert.Equal(mt, cursor, cmd.Lookup("filter", "_id", "$gt").ObjectID())
+		assert.EqualValues(mt, 10, cmd.Lookup("limit").AsInt64())
+	})
+
+	mt.Run("clicks with ids", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.click", mtest.FirstBatch))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		clicks, err := r.FetchClicks(noopCtx, domain.ClickFilter{IDs: []primitive.ObjectID{id}})
+
+		require.NoError(mt, err)
+		assert.Empty(mt, clicks)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(mt, id, filter.Lookup("_id", "$in").Array().Index(0).Value().ObjectID())
+		_, err = filter.LookupErr("url_id")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 123, Message: "server error"}))
+		r := repository.NewMongoClickRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		clicks, err := r.FetchClicks(noopCtx, domain.ClickFilter{URLIDs: []string{"test123"}})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, clicks)
+	})
+}
@@ -0,0 +1,256 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Default values of rollup coalescing used when Config fields are not set
+const (
+	DefaultRollupInterval   = 5000
+	DefaultRollupMaxDelta   = 1000
+	DefaultRollupMaxBuckets = 10000
+)
+
+// RollupCoalescer counts stored clicks by URL and hour in memory and adds the
+// counts to rollups with a single bulk write, so rollup of popular URL is
+// updated once an interval instead of once a batch. Counts still in memory
+// when process crashes are lost, reconciliation corrects rollups then.
+type RollupCoalescer struct {
+	clickRepo      domain.ClickRepository
+	contextTimeout time.Duration
+	logger         *zap.Logger
+	cfg            Config
+
+	mu      sync.Mutex
+	buckets map[rollupKey]*rollupBucket
+	pending int64
+	// due is signaled when some bucket reached RollupMaxDelta or there are
+	// more than RollupMaxBuckets of them
+	due     chan struct{}
+	flushed atomic.Int64
+	dropped atomic.Int64
+}
+
+type rollupKey struct {
+	urlID string
+	hour  time.Time
+}
+
+// rollupBucket is the count of clicks on URL within hour, visitors are kept
+// in set, so each of them is added to rollup once
+type rollupBucket struct {
+	delta    *domain.RollupDelta
+	visitors map[string]bool
+}
+
+func (b *rollupBucket) add(d *domain.RollupDelta) {
+	b.delta.Clicks += d.Clicks
+	b.delta.Bots += d.Bots
+	b.delta.Untracked += d.Untracked
+	for _, visitor := range d.Visitors {
+		if !b.visitors[visitor] {
+			b.visitors[visitor] = true
+			b.delta.Visitors = append(b.delta.Visitors, visitor)
+		}
+	}
+}
+
+// size approximates memory taken by bucket
+func (b *rollupBucket) size() int64 {
+	return b.delta.Clicks + int64(len(b.delta.Visitors))
+}
+
+// NewRollupCoalescer creates RollupCoalescer, call Run to add counted clicks
+// to rollups and Shutdown to add the rest once it returns
+func NewRollupCoalescer(c domain.ClickRepository, timeout time.Duration, logger *zap.Logger, cfg Config) *RollupCoalescer {
+	if cfg.RollupInterval <= 0 {
+		cfg.RollupInterval = DefaultRollupInterval
+	}
+	if cfg.RollupMaxDelta <= 0 {
+		cfg.RollupMaxDelta = DefaultRollupMaxDelta
+	}
+	if cfg.RollupMaxBuckets <= 0 {
+		cfg.RollupMaxBuckets = DefaultRollupMaxBuckets
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	return &RollupCoalescer{
+		clickRepo:      c,
+		contextTimeout: timeout,
+		logger:         logger,
+		cfg:            cfg,
+		buckets:        make(map[rollupKey]*rollupBucket),
+		due:            make(chan struct{}, 1),
+	}
+}
+
+// Add counts clicks, they are added to rollups by Run
+func (c *RollupCoalescer) Add(clicks []*domain.Click) {
+	due := false
+	c.mu.Lock()
+	for _, d := range domain.RollupDeltas(clicks) {
+		key := rollupKey{urlID: d.URLID, hour: d.Hour}
+		b, ok := c.buckets[key]
+		if !ok {
+			b = &rollupBucket{delta: &domain.RollupDelta{URLID: d.URLID, Hour: d.Hour}, visitors: make(map[string]bool)}
+			c.buckets[key] = b
+		}
+		b.add(d)
+		c.pending += d.Clicks
+		due = due || b.delta.Clicks >= int64(c.cfg.RollupMaxDelta)
+	}
+	due = due || len(c.buckets) > c.cfg.RollupMaxBuckets
+	c.mu.Unlock()
+
+	if due {
+		select {
+		case c.due <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stats returns number of clicks waiting to be added to rollups, added to
+// them and dropped
+func (c *RollupCoalescer) Stats() (pending, flushed, dropped int64) {
+	c.mu.Lock()
+	pending = c.pending
+	c.mu.Unlock()
+	return pending, c.flushed.Load(), c.dropped.Load()
+}
+
+// Run adds counted clicks to rollups every RollupInterval until context is
+// canceled, buckets over limits are added right away. Adding waits while
+// service is read-only.
+func (c *RollupCoalescer) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.cfg.RollupInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		all := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.due:
+		case <-ticker.C:
+			all = true
+		}
+
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		// counts being added are not interrupted by shutdown
+		if all {
+			c.flush(context.Background(), c.takeAll())
+		} else {
+			c.flush(context.Background(), c.takeDue())
+		}
+	}
+}
+
+// Shutdown adds all counted clicks to rollups within ShutdownTimeout, call it
+// once Run returns. Counts are dropped while service is read-only.
+func (c *RollupCoalescer) Shutdown(ctx context.Context) {
+	deltas := c.takeAll()
+	if !domain.Writable(ctx) {
+		c.drop(deltas, "service is read-only")
+		return
+	}
+
+	deadline, cancel := context.WithTimeout(context.Background(), time.Duration(c.cfg.ShutdownTimeout)*time.Millisecond)
+	defer cancel()
+	c.flush(deadline, deltas)
+}
+
+func (c *RollupCoalescer) takeAll() []*domain.RollupDelta {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deltas := make([]*domain.RollupDelta, 0, len(c.buckets))
+	for key, b := range c.buckets {
+		deltas = append(deltas, b.delta)
+		delete(c.buckets, key)
+	}
+	c.pending = 0
+	return deltas
+}
+
+// takeDue takes buckets that reached RollupMaxDelta. When there are still more
+// than RollupMaxBuckets buckets, the largest are taken until half of the limit
+// is left, they free the most memory.
+func (c *RollupCoalescer) takeDue() []*domain.RollupDelta {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deltas := make([]*domain.RollupDelta, 0)
+	take := func(key rollupKey) {
+		b := c.buckets[key]
+		deltas = append(deltas, b.delta)
+		c.pending -= b.delta.Clicks
+		delete(c.buckets, key)
+	}
+	for key, b := range c.buckets {
+		if b.delta.Clicks >= int64(c.cfg.RollupMaxDelta) {
+			take(key)
+		}
+	}
+	if len(c.buckets) <= c.cfg.RollupMaxBuckets {
+		return deltas
+	}
+
+	keys := make([]rollupKey, 0, len(c.buckets))
+	for key := range c.buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.buckets[keys[i]].size() > c.buckets[keys[j]].size()
+	})
+	for _, key := range keys[:len(keys)-c.cfg.RollupMaxBuckets/2] {
+		take(key)
+	}
+	return deltas
+}
+
+func (c *RollupCoalescer) drop(deltas []*domain.RollupDelta, reason string) {
+	clicks := countDeltas(deltas)
+	if clicks == 0 {
+		return
+	}
+	c.dropped.Add(clicks)
+	c.logger.Warn("clicks are not added to rollups on shutdown", zap.String("reason", reason), zap.Int64("dropped", clicks))
+}
+
+func (c *RollupCoalescer) flush(ctx context.Context, deltas []*domain.RollupDelta) {
+	if len(deltas) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.contextTimeout)
+	defer cancel()
+
+	clicks := countDeltas(deltas)
+	// rollups missing the clicks are corrected by the next reconciliation
+	if err := c.clickRepo.AddRollupDeltas(ctx, deltas); err != nil {
+		c.dropped.Add(clicks)
+		c.logger.Warn("can't add clicks to rollups", zap.Int("rollups", len(deltas)), zap.Int64("clicks", clicks), zap.Error(err))
+		return
+	}
+	c.flushed.Add(clicks)
+}
+
+func countDeltas(deltas []*domain.RollupDelta) int64 {
+	var clicks int64
+	for _, d := range deltas {
+		clicks += d.Clicks
+	}
+	return clicks
+}
@@ -0,0 +1,213 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/click/usecase"
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// rollupRecorder sums deltas added to rollups by URL
+type rollupRecorder struct {
+	mu     sync.Mutex
+	writes [][]*domain.RollupDelta
+	clicks map[string]int64
+}
+
+func newRollupRecorder() *rollupRecorder {
+	return &rollupRecorder{clicks: make(map[string]int64)}
+}
+
+func (r *rollupRecorder) add(_ context.Context, deltas []*domain.RollupDelta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, deltas)
+	for _, d := range deltas {
+		r.clicks[d.URLID] += d.Clicks
+	}
+	return nil
+}
+
+func (r *rollupRecorder) added() (writes [][]*domain.RollupDelta, clicks map[string]int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clicks = make(map[string]int64, len(r.clicks))
+	for id, n := range r.clicks {
+		clicks[id] = n
+	}
+	return append([][]*domain.RollupDelta(nil), r.writes...), clicks
+}
+
+func TestRollupCoalescer(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	hour := int(time.Hour / time.Millisecond)
+	now := time.Date(2023, 3, 1, 12, 34, 56, 0, time.UTC)
+	newCoalescer := func(cfg usecase.Config) (*usecase.RollupCoalescer, *rollupRecorder) {
+		repository := mock.NewMockClickRepository(controller)
+		recorder := newRollupRecorder()
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).DoAndReturn(recorder.add).AnyTimes()
+		return usecase.NewRollupCoalescer(repository, time.Second, zap.NewNop(), cfg), recorder
+	}
+	run := func(c *usecase.RollupCoalescer) (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c.Run(ctx)
+			close(done)
+		}()
+		return func() {
+			cancel()
+			<-done
+			c.Shutdown(ctx)
+		}
+	}
+	clicks := func(urlID string, n int) []*domain.Click {
+		result := make([]*domain.Click, n)
+		for i := range result {
+			result[i] = &domain.Click{URLID: urlID, CreatedAt: now}
+		}
+		return result
+	}
+
+	t.Run("concurrent clicks are not lost", func(t *testing.T) {
+		c, recorder := newCoalescer(usecase.Config{RollupInterval: 1, RollupMaxDelta: 50, RollupMaxBuckets: 4})
+		stop := run(c)
+
+		var wg sync.WaitGroup
+		for g := 0; g < 100; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					click := &domain.Click{URLID: fmt.Sprintf("test%d", (g+i)%10), CreatedAt: now.Add(time.Duration(i%3) * time.Hour)}
+					c.Add([]*domain.Click{click})
+				}
+			}(g)
+		}
+		wg.Wait()
+		stop()
+
+		_, added := recorder.added()
+		var total int64
+		for i := 0; i < 10; i++ {
+			assert.EqualValues(t, 1000, added[fmt.Sprintf("test%d", i)])
+			total += added[fmt.Sprintf("test%d", i)]
+		}
+		assert.EqualValues(t, 10000, total)
+		pending, flushed, dropped := c.Stats()
+		assert.Zero(t, pending)
+		assert.EqualValues(t, 10000, flushed)
+		assert.Zero(t, dropped)
+	})
+
+	t.Run("clicks on url are added at once", func(t *testing.T) {
+		c, recorder := newCoalescer(usecase.Config{RollupInterval: hour})
+		stop := run(c)
+
+		bot := &domain.Click{URLID: "test123", Visitor: "visitor", Bot: true, CreatedAt: now}
+		c.Add(clicks("test123", 3))
+		c.Add([]*domain.Click{bot, bot, {URLID: "test123", Untracked: true, CreatedAt: now}})
+		pending, _, _ := c.Stats()
+		assert.EqualValues(t, 6, pending)
+		stop()
+
+		writes, _ := recorder.added()
+		require.Len(t, writes, 1)
+		assert.Equal(t, []*domain.RollupDelta{{
+			URLID:     "test123",
+			Hour:      now.Truncate(time.Hour),
+			Clicks:    6,
+			Bots:      2,
+			Untracked: 1,
+			Visitors:  []string{"visitor"},
+		}}, writes[0])
+	})
+
+	t.Run("delta cap", func(t *testing.T) {
+		c, recorder := newCoalescer(usecase.Config{RollupInterval: hour, RollupMaxDelta: 5})
+		stop := run(c)
+		defer stop()
+
+		c.Add(clicks("small", 1))
+		c.Add(clicks("popular", 5))
+
+		require.Eventually(t, func() bool {
+			_, added := recorder.added()
+			return added["popular"] == 5
+		}, time.Second, time.Millisecond)
+		_, added := recorder.added()
+		assert.Zero(t, added["small"])
+		pending, _, _ := c.Stats()
+		assert.EqualValues(t, 1, pending)
+	})
+
+	t.Run("the largest buckets are added once there are too many", func(t *testing.T) {
+		c, recorder := newCoalescer(usecase.Config{RollupInterval: hour, RollupMaxBuckets: 4})
+		stop := run(c)
+		defer stop()
+
+		for i := 1; i <= 5; i++ {
+			c.Add(clicks(fmt.Sprintf("test%d", i), i))
+		}
+
+		require.Eventually(t, func() bool {
+			writes, _ := recorder.added()
+			return len(writes) == 1
+		}, time.Second, time.Millisecond)
+		_, added := recorder.added()
+		assert.Equal(t, map[string]int64{"test3": 3, "test4": 4, "test5": 5}, added)
+		pending, _, _ := c.Stats()
+		assert.EqualValues(t, 3, pending)
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		c, recorder := newCoalescer(usecase.Config{RollupInterval: 10})
+		stop := run(c)
+		defer stop()
+
+		c.Add(clicks("test123", 2))
+
+		require.Eventually(t, func() bool {
+			_, added := recorder.added()
+			return added["test123"] == 2
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("add error", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+		c := usecase.NewRollupCoalescer(repository, time.Second, zap.NewNop(), usecase.Config{RollupInterval: hour})
+
+		c.Add(clicks("test123", 3))
+		c.Shutdown(context.Background())
+
+		pending, flushed, dropped := c.Stats()
+		assert.Zero(t, pending)
+		assert.Zero(t, flushed)
+		assert.EqualValues(t, 3, dropped)
+	})
+
+	t.Run("read-only on shutdown", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		c := usecase.NewRollupCoalescer(repository, time.Second, zap.NewNop(), usecase.Config{})
+
+		c.Add(clicks("test123", 2))
+		c.Shutdown(domain.WithReadOnlyMode(context.Background(), domain.NewReadOnlyMode(true)))
+
+		_, flushed, dropped := c.Stats()
+		assert.Zero(t, flushed)
+		assert.EqualValues(t, 2, dropped)
+	})
+}
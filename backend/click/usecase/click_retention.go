@@ -0,0 +1,213 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// Defaults of RetentionConfig fields that are not set
+const (
+	DefaultRetentionMinDays  = 1
+	DefaultRetentionInterval = 3600
+)
+
+// retentionLock is the name of the lock held while clicks are purged
+const retentionLock = "click_retention"
+
+// retentionUserBatch is the number of users with click retention fetched at
+// once
+const retentionUserBatch = 100
+
+// RetentionConfig stores click retention configuration. Only clicks are
+// purged, hourly rollups are kept, so click counts don't change.
+type RetentionConfig struct {
+	// Days is the number of days clicks are kept for, zero keeps them
+	// forever
+	Days int `yaml:"days"`
+	// MinDays and MaxDays bound click retention users may set, MaxDays can't
+	// exceed Days, so users may only shorten retention
+	MinDays int `yaml:"min_days"`
+	MaxDays int `yaml:"max_days"`
+	// PurgeInterval is the interval between purges in seconds
+	PurgeInterval int `yaml:"purge_seconds"`
+}
+
+// ClickRetention is domain.ClickRetentionUsecase, it purges clicks older than
+// service retention and clicks on URLs of users with shorter retention
+type ClickRetention struct {
+	clickRepo      domain.ClickRepository
+	userRepo       domain.UserRepository
+	locker         domain.Locker
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            RetentionConfig
+	now            func() time.Time
+}
+
+var _ domain.ClickRetentionUsecase = (*ClickRetention)(nil)
+
+// NewClickRetention creates ClickRetention, call Run to purge clicks
+// periodically
+func NewClickRetention(c domain.ClickRepository, u domain.UserRepository, l domain.Locker, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg RetentionConfig) *ClickRetention {
+	if cfg.MinDays <= 0 {
+		cfg.MinDays = DefaultRetentionMinDays
+	}
+	if cfg.Days > 0 && (cfg.MaxDays <= 0 || cfg.MaxDays > cfg.Days) {
+		cfg.MaxDays = cfg.Days
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = DefaultRetentionInterval
+	}
+
+	return &ClickRetention{
+		clickRepo:      c,
+		userRepo:       u,
+		locker:         l,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces clock retention is measured by
+func (r *ClickRetention) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+func (r *ClickRetention) CheckRetention(days int) error {
+	if r.cfg.MaxDays > 0 && (days < r.cfg.MinDays || days > r.cfg.MaxDays) {
+		return fmt.Errorf("click retention must be between %d and %d days: %w", r.cfg.MinDays, r.cfg.MaxDays, domain.ErrBadParamInput)
+	}
+	if days < r.cfg.MinDays {
+		return fmt.Errorf("click retention must be at least %d days: %w", r.cfg.MinDays, domain.ErrBadParamInput)
+	}
+	return nil
+}
+
+// Run purges clicks right away and then every interval until context is
+// canceled, purge waits while service is read-only
+func (r *ClickRetention) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.cfg.PurgeInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		if err := r.Purge(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Error("can't purge clicks", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes clicks older than service retention and then clicks on URLs
+// of every user with shorter retention. Only one instance purges at a time,
+// others skip purge while lock is held.
+func (r *ClickRetention) Purge(ctx context.Context) error {
+	lockCtx, cancel := context.WithTimeout(ctx, r.contextTimeout)
+	// purge may take longer than timeout, lock is held for purge interval
+	lock, err := r.locker.AcquireLock(lockCtx, retentionLock, time.Duration(r.cfg.PurgeInterval)*time.Second)
+	cancel()
+	if errors.Is(err, domain.ErrConflict) {
+		r.logger.Debug("clicks are purged by another instance")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), r.contextTimeout)
+		defer cancel()
+		if err := lock.Release(releaseCtx); err != nil {
+			r.logger.Warn("can't release click retention lock", zap.Error(err))
+		}
+	}()
+
+	if r.cfg.Days > 0 {
+		if err = r.purge(ctx, domain.ClickPurgeFilter{Before: r.cutoff(r.cfg.Days)}); err != nil {
+			return err
+		}
+	}
+
+	filter := domain.UserFilter{ClickRetention: true, Limit: retentionUserBatch}
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, r.contextTimeout)
+		users, err := r.userRepo.Fetch(fetchCtx, filter)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			days := u.Settings.ClickRetentionDays
+			if r.cfg.Days > 0 && days >= r.cfg.Days {
+				continue
+			}
+			if err = r.PurgeUser(ctx, u.ID.Hex(), days); err != nil {
+				return fmt.Errorf("can't purge clicks of %s user: %w", u.ID.Hex(), err)
+			}
+		}
+
+		if len(users) < retentionUserBatch {
+			return nil
+		}
+		filter.Cursor = users[len(users)-1].ID.Hex()
+	}
+}
+
+// PurgeUser deletes clicks on URLs of user made more than days ago, days
+// below minimum retention are raised to it
+func (r *ClickRetention) PurgeUser(ctx context.Context, userID string, days int) error {
+	if days < r.cfg.MinDays {
+		days = r.cfg.MinDays
+	}
+	return r.purge(ctx, domain.ClickPurgeFilter{UserID: userID, Before: r.cutoff(days)})
+}
+
+func (r *ClickRetention) purge(c context.Context, filter domain.ClickPurgeFilter) error {
+	ctx, cancel := context.WithTimeout(c, r.contextTimeout)
+	defer cancel()
+
+	ctx, span := r.tracer.Start(
+		ctx,
+		"usecase PurgeClicks",
+		trace.WithAttributes(
+			attribute.String("userid", filter.UserID),
+			attribute.String("before", filter.Before.Format(time.RFC3339))),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	n, err := r.clickRepo.Purge(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if n > 0 {
+		r.logger.Info("purged clicks", zap.String("userid", filter.UserID), zap.Time("before", filter.Before), zap.Int64("clicks", n))
+	}
+	return nil
+}
+
+// cutoff returns time clicks kept for days are made after
+func (r *ClickRetention) cutoff(days int) time.Time {
+	return r.now().UTC().AddDate(0, 0, -days)
+}
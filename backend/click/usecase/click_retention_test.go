@@ -0,0 +1,100 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/click/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+	usermock "github.com/semka95/shortener/backend/user/mock"
+)
+
+func TestClickRetention_Purge(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	locker := lockmock.NewMockLocker(controller)
+	lock := lockmock.NewMockLock(controller)
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	newRetention := func(cfg usecase.RetentionConfig) *usecase.ClickRetention {
+		r := usecase.NewClickRetention(repository, userRepository, locker, 10*time.Second, tracer, zap.NewNop(), cfg)
+		r.SetClock(func() time.Time { return now })
+		return r
+	}
+	user := func(days int) *domain.User {
+		return &domain.User{ID: primitive.NewObjectID(), Settings: domain.UserSettings{ClickRetentionDays: days}}
+	}
+
+	t.Run("service and user retention", func(t *testing.T) {
+		short, long := user(30), user(90)
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_retention", time.Hour).Return(lock, nil)
+		gomock.InOrder(
+			repository.EXPECT().Purge(gomock.Any(), domain.ClickPurgeFilter{Before: now.AddDate(0, 0, -90)}).Return(int64(10), nil),
+			userRepository.EXPECT().Fetch(gomock.Any(), domain.UserFilter{ClickRetention: true, Limit: 100}).Return([]*domain.User{short, long}, nil),
+			repository.EXPECT().Purge(gomock.Any(), domain.ClickPurgeFilter{UserID: short.ID.Hex(), Before: now.AddDate(0, 0, -30)}).Return(int64(2), nil),
+		)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newRetention(usecase.RetentionConfig{Days: 90}).Purge(context.Background()))
+	})
+
+	t.Run("clicks kept forever", func(t *testing.T) {
+		users := make([]*domain.User, 100)
+		for i := range users {
+			users[i] = user(365)
+		}
+		last := user(7)
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_retention", gomock.Any()).Return(lock, nil)
+		userRepository.EXPECT().Fetch(gomock.Any(), domain.UserFilter{ClickRetention: true, Limit: 100}).Return(users, nil)
+		userRepository.EXPECT().Fetch(gomock.Any(), domain.UserFilter{ClickRetention: true, Limit: 100, Cursor: users[99].ID.Hex()}).Return([]*domain.User{last}, nil)
+		repository.EXPECT().Purge(gomock.Any(), gomock.Any()).Return(int64(0), nil).Times(100)
+		repository.EXPECT().Purge(gomock.Any(), domain.ClickPurgeFilter{UserID: last.ID.Hex(), Before: now.AddDate(0, 0, -7)}).Return(int64(0), nil)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newRetention(usecase.RetentionConfig{}).Purge(context.Background()))
+	})
+
+	t.Run("purged by another instance", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_retention", gomock.Any()).Return(nil, domain.ErrConflict)
+
+		require.NoError(t, newRetention(usecase.RetentionConfig{Days: 90}).Purge(context.Background()))
+	})
+
+	t.Run("purge error", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_retention", gomock.Any()).Return(lock, nil)
+		repository.EXPECT().Purge(gomock.Any(), gomock.Any()).Return(int64(0), domain.ErrInternalServerError)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		err := newRetention(usecase.RetentionConfig{Days: 90}).Purge(context.Background())
+		require.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+
+	t.Run("purge user below minimum", func(t *testing.T) {
+		repository.EXPECT().Purge(gomock.Any(), domain.ClickPurgeFilter{UserID: "507f191e810c19729de860ea", Before: now.AddDate(0, 0, -7)}).Return(int64(1), nil)
+
+		require.NoError(t, newRetention(usecase.RetentionConfig{MinDays: 7}).PurgeUser(context.Background(), "507f191e810c19729de860ea", 1))
+	})
+}
+
+func TestClickRetention_CheckRetention(t *testing.T) {
+	r := usecase.NewClickRetention(nil, nil, nil, 10*time.Second, tracer, zap.NewNop(), usecase.RetentionConfig{Days: 90, MinDays: 7, MaxDays: 365})
+	assert.NoError(t, r.CheckRetention(7))
+	assert.NoError(t, r.CheckRetention(90))
+	assert.ErrorIs(t, r.CheckRetention(6), domain.ErrBadParamInput)
+	assert.ErrorIs(t, r.CheckRetention(91), domain.ErrBadParamInput, "maximum is capped by service retention")
+
+	r = usecase.NewClickRetention(nil, nil, nil, 10*time.Second, tracer, zap.NewNop(), usecase.RetentionConfig{})
+	assert.NoError(t, r.CheckRetention(36500))
+	assert.ErrorIs(t, r.CheckRetention(0), domain.ErrBadParamInput)
+}
@@ -0,0 +1,127 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// Defaults of RollupConfig fields that are not set
+const (
+	DefaultReconcileInterval = 300
+	DefaultReconcileHours    = 6
+)
+
+// rollupLock is the name of the lock held while rollups are reconciled
+const rollupLock = "click_rollup"
+
+// RollupConfig stores hourly rollup reconciliation configuration
+type RollupConfig struct {
+	// ReconcileInterval is the interval between reconciliations in seconds
+	ReconcileInterval int `yaml:"reconcile_seconds"`
+	// ReconcileHours is the number of completed hours recomputed from clicks
+	ReconcileHours int `yaml:"reconcile_hours"`
+}
+
+// RollupReconciler recomputes hourly rollups of recent hours from stored
+// clicks. Rollups are updated as clicks are stored, reconciliation corrects
+// clicks missed by those updates, e.g. when database was unavailable.
+type RollupReconciler struct {
+	clickRepo      domain.ClickRepository
+	locker         domain.Locker
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            RollupConfig
+}
+
+// NewRollupReconciler creates RollupReconciler, call Run to reconcile
+// rollups periodically
+func NewRollupReconciler(c domain.ClickRepository, l domain.Locker, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg RollupConfig) *RollupReconciler {
+	if cfg.ReconcileInterval <= 0 {
+		cfg.ReconcileInterval = DefaultReconcileInterval
+	}
+	if cfg.ReconcileHours <= 0 {
+		cfg.ReconcileHours = DefaultReconcileHours
+	}
+
+	return &RollupReconciler{
+		clickRepo:      c,
+		locker:         l,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+	}
+}
+
+// Run reconciles rollups right away and then every interval until context is
+// canceled, reconciliation waits while service is read-only
+func (r *RollupReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.cfg.ReconcileInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		if err := r.Reconcile(ctx); err != nil {
+			r.logger.Error("can't reconcile click rollups", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile recomputes rollups of the last completed hours. Only one instance
+// reconciles at a time, others skip reconciliation while lock is held, but
+// running it several times gives the same rollups anyway.
+func (r *RollupReconciler) Reconcile(c context.Context) error {
+	ctx, cancel := context.WithTimeout(c, r.contextTimeout)
+	defer cancel()
+
+	to := time.Now().UTC().Truncate(time.Hour)
+	from := to.Add(-time.Duration(r.cfg.ReconcileHours) * time.Hour)
+	ctx, span := r.tracer.Start(
+		ctx,
+		"usecase Reconcile",
+		trace.WithAttributes(
+			attribute.String("from", from.Format(time.RFC3339)),
+			attribute.String("to", to.Format(time.RFC3339))),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	lock, err := r.locker.AcquireLock(ctx, rollupLock, r.contextTimeout)
+	if errors.Is(err, domain.ErrConflict) {
+		r.logger.Debug("click rollups are reconciled by another instance")
+		return nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			r.logger.Warn("can't release click rollup lock", zap.Error(err))
+		}
+	}()
+
+	if err = r.clickRepo.RebuildRollups(ctx, from, to); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package usecase_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/click/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+	urlmock "github.com/semka95/shortener/backend/url/mock"
+)
+
+func TestClickUsecase_StoreRollup(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	run := func(t *testing.T, uc domain.ClickUsecase) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			uc.Run(ctx)
+			close(done)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+
+	t.Run("stored click is added to rollup", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		var mu sync.Mutex
+		rolled := &domain.RollupDelta{}
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, deltas []*domain.RollupDelta) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, d := range deltas {
+				assert.Equal(t, "test123", d.URLID)
+				rolled.Clicks += d.Clicks
+				rolled.Bots += d.Bots
+			}
+			return nil
+		}).MinTimes(1).MaxTimes(2)
+		uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.NewNop(), usecase.Config{})
+		run(t, uc)
+
+		uc.Record(domain.ClickRequest{URLID: "test123", UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/112.0"})
+		uc.Record(domain.ClickRequest{URLID: "test123", UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"})
+
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return rolled.Clicks == 2
+		}, time.Second, time.Millisecond, "clicks were not added to rollup")
+		mu.Lock()
+		defer mu.Unlock()
+		assert.EqualValues(t, 1, rolled.Bots)
+	})
+
+	t.Run("click that is not stored is not added", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+		core, logs := observer.New(zapcore.ErrorLevel)
+		uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.New(core), usecase.Config{})
+		run(t, uc)
+
+		uc.Record(domain.ClickRequest{URLID: "test123"})
+
+		require.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("rollup error", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).Return(nil)
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+		core, logs := observer.New(zapcore.WarnLevel)
+		uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.New(core), usecase.Config{})
+		run(t, uc)
+
+		uc.Record(domain.ClickRequest{URLID: "test123"})
+
+		require.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, "can't add clicks to rollups", logs.All()[0].Message)
+	})
+}
+
+func TestRollupReconciler_Reconcile(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	locker := lockmock.NewMockLocker(controller)
+	lock := lockmock.NewMockLock(controller)
+	r := usecase.NewRollupReconciler(repository, locker, 10*time.Second, tracer, zap.NewNop(), usecase.RollupConfig{ReconcileHours: 3})
+
+	t.Run("success", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_rollup", 10*time.Second).Return(lock, nil)
+		repository.EXPECT().RebuildRollups(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, from, to time.Time) error {
+			assert.Equal(t, time.Now().UTC().Truncate(time.Hour), to, "current hour is not rebuilt")
+			assert.Equal(t, 3*time.Hour, to.Sub(from))
+			return nil
+		})
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		err := r.Reconcile(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("reconciled by another instance", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_rollup", gomock.Any()).Return(nil, domain.ErrConflict)
+
+		err := r.Reconcile(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("rebuild error", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_rollup", gomock.Any()).Return(lock, nil)
+		repository.EXPECT().RebuildRollups(gomock.Any(), gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		err := r.Reconcile(context.Background())
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+
+	t.Run("lock error", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "click_rollup", gomock.Any()).Return(nil, domain.ErrInternalServerError)
+
+		err := r.Reconcile(context.Background())
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+}
@@ -0,0 +1,155 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// DefaultStreamBuffer is the number of clicks waiting to be delivered to
+// subscriber used when Config.StreamBuffer is not set
+const DefaultStreamBuffer = 64
+
+// broker delivers clicks to subscriptions of their URL
+type broker struct {
+	mu     sync.Mutex
+	subs   map[string]map[*subscription]struct{}
+	closed bool
+	buffer int
+}
+
+func newBroker(buffer int) *broker {
+	return &broker{subs: make(map[string]map[*subscription]struct{}), buffer: buffer}
+}
+
+func (b *broker) subscribe(urlID string) *subscription {
+	s := &subscription{broker: b, urlID: urlID, ch: make(chan *domain.Click, b.buffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		s.close()
+		return s
+	}
+	if b.subs[urlID] == nil {
+		b.subs[urlID] = make(map[*subscription]struct{})
+	}
+	b.subs[urlID][s] = struct{}{}
+
+	return s
+}
+
+func (b *broker) unsubscribe(s *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs[s.urlID], s)
+	if len(b.subs[s.urlID]) == 0 {
+		delete(b.subs, s.urlID)
+	}
+}
+
+// publish delivers click to subscriptions of its URL without blocking
+func (b *broker) publish(click *domain.Click) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[click.URLID] {
+		s.send(click)
+	}
+}
+
+// close closes all subscriptions, later subscriptions are closed right away
+func (b *broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subs := range b.subs {
+		for s := range subs {
+			s.close()
+		}
+	}
+	b.subs = make(map[string]map[*subscription]struct{})
+}
+
+// subscription is domain.ClickSubscription with bounded buffer, the oldest
+// click is dropped when buffer is full
+type subscription struct {
+	broker  *broker
+	urlID   string
+	dropped atomic.Int64
+
+	mu     sync.Mutex
+	ch     chan *domain.Click
+	closed bool
+}
+
+func (s *subscription) Clicks() <-chan *domain.Click {
+	return s.ch
+}
+
+func (s *subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *subscription) Close() {
+	s.broker.unsubscribe(s)
+	s.close()
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+func (s *subscription) send(click *domain.Click) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.ch <- click:
+		return
+	default:
+	}
+
+	// buffer is full, the oldest click makes room unless subscriber has just
+	// taken it, send can't block as nothing else sends to the channel
+	select {
+	case <-s.ch:
+		s.dropped.Add(1)
+	default:
+	}
+	s.ch <- click
+}
+
+func (uc *clickUsecase) Subscribe(c context.Context, urlID string, user *auth.Claims) (domain.ClickSubscription, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Subscribe",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return uc.broker.subscribe(urlID), nil
+}
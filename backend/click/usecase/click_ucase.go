@@ -0,0 +1,380 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// DefaultQueueSize is the number of clicks waiting to be stored used when
+// Config.QueueSize is not set
+const DefaultQueueSize = 1024
+
+// Config stores click recording configuration
+type Config struct {
+	// QueueSize is the number of clicks waiting to be stored, clicks are
+	// dropped when the queue is full unless Blocking is set
+	QueueSize int `yaml:"queue_size"`
+	// BatchSize is the number of clicks stored at once
+	BatchSize int `yaml:"batch_size"`
+	// FlushInterval is the longest time in milliseconds clicks wait for
+	// batch to fill up
+	FlushInterval int `yaml:"flush_interval_ms"`
+	// ShutdownTimeout is the time in milliseconds queued clicks are stored
+	// within on shutdown, clicks left are dropped
+	ShutdownTimeout int `yaml:"shutdown_timeout_ms"`
+	// Blocking makes redirects wait for room in the full queue, so clicks
+	// are delayed instead of dropped
+	Blocking bool `yaml:"blocking"`
+	// RollupInterval is the longest time in milliseconds stored clicks wait
+	// to be added to rollups, clicks on the same URL are added with a single
+	// update, see RollupCoalescer
+	RollupInterval int `yaml:"rollup_interval_ms"`
+	// RollupMaxDelta is the number of waiting clicks on the same URL and hour
+	// added to rollup without waiting for interval
+	RollupMaxDelta int `yaml:"rollup_max_delta"`
+	// RollupMaxBuckets is the number of URL hours waiting clicks are counted
+	// for, the most clicked are added to rollups early once there are more
+	RollupMaxBuckets int `yaml:"rollup_max_buckets"`
+	// SourceParam is query parameter used as campaign source when utm_source
+	// is absent, e.g. src
+	SourceParam string `yaml:"source_param"`
+	// StreamBuffer is the number of clicks waiting to be delivered to
+	// subscriber, the oldest clicks are dropped when subscriber is slow
+	StreamBuffer int `yaml:"stream_buffer"`
+	// Analytics is the analytics mode, see domain.AnalyticsStandard. Unknown
+	// mode records clicks as domain.AnalyticsOff does.
+	Analytics string `yaml:"analytics"`
+	// IPPolicy sets how client address is stored in standard analytics
+	// mode, see domain.IPPolicyFull. Unknown policy discards addresses.
+	IPPolicy string `yaml:"ip_policy"`
+}
+
+type clickUsecase struct {
+	clickRepo      domain.ClickRepository
+	urlRepo        domain.URLRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            Config
+	writer         *ClickWriter
+	broker         *broker
+	// visitorSecret keys visitor hashes, it is not stored, so visitors can't
+	// be linked to clients after restart
+	visitorSecret []byte
+}
+
+// NewClickUsecase will create new an clickUsecase object representation of domain.ClickUsecase interface.
+// Recorded clicks are written to w, call Run to store them.
+func NewClickUsecase(c domain.ClickRepository, u domain.URLRepository, w *ClickWriter, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg Config) domain.ClickUsecase {
+	if cfg.StreamBuffer <= 0 {
+		cfg.StreamBuffer = DefaultStreamBuffer
+	}
+	analytics, err := domain.ParseAnalytics(cfg.Analytics)
+	if err != nil {
+		logger.Error("clicks are not tracked", zap.Error(err))
+		analytics = domain.AnalyticsOff
+	}
+	cfg.Analytics = analytics
+	ipPolicy, err := domain.ParseIPPolicy(cfg.IPPolicy)
+	if err != nil {
+		logger.Error("client addresses are discarded", zap.Error(err))
+		ipPolicy = domain.IPPolicyDiscard
+	}
+	cfg.IPPolicy = ipPolicy
+
+	return &clickUsecase{
+		clickRepo:      c,
+		urlRepo:        u,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+		writer:         w,
+		broker:         newBroker(cfg.StreamBuffer),
+		visitorSecret:  newVisitorSecret(),
+	}
+}
+
+// newVisitorSecret returns random key of visitor hashes
+func newVisitorSecret() []byte {
+	secret := make([]byte, sha256.Size)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("can't generate visitor secret: %v", err))
+	}
+	return secret
+}
+
+// Record records click with details allowed by analytics mode, clicks of
+// clients that asked not to be tracked are only counted
+func (uc *clickUsecase) Record(req domain.ClickRequest) {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	click := &domain.Click{
+		ID:        primitive.NewObjectID(),
+		URLID:     req.URLID,
+		CreatedAt: now,
+	}
+	switch {
+	case req.DoNotTrack || uc.cfg.Analytics == domain.AnalyticsOff:
+		click.Untracked = true
+	case uc.cfg.Analytics == domain.AnalyticsMinimal:
+		click.Campaign = domain.ParseCampaign(req.Query, uc.cfg.SourceParam)
+	default:
+		click.Campaign = domain.ParseCampaign(req.Query, uc.cfg.SourceParam)
+		click.Visitor = uc.visitor(req, now)
+		click.Referrer = domain.ReferrerHost(req.Referrer)
+		click.Bot = domain.IsBot(req.UserAgent)
+		// address is anonymized last, after everything derived from it
+		click.IP = uc.clientIP(req.IP, now)
+	}
+
+	// subscribers see click without waiting for it to be stored
+	if !click.Untracked {
+		uc.broker.publish(click)
+	}
+	uc.writer.Write(click)
+}
+
+// visitor returns hash of client IP and user agent keyed by the day of click,
+// so clients can't be tracked across days
+func (uc *clickUsecase) visitor(req domain.ClickRequest, now time.Time) string {
+	if req.IP == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, uc.dayKey(now))
+	mac.Write([]byte(req.IP))
+	mac.Write([]byte{0})
+	mac.Write([]byte(req.UserAgent))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// clientIP returns client address as IP policy allows to store it
+func (uc *clickUsecase) clientIP(ip string, now time.Time) string {
+	if ip == "" {
+		return ""
+	}
+
+	switch uc.cfg.IPPolicy {
+	case domain.IPPolicyFull:
+		return ip
+	case domain.IPPolicyTruncate:
+		return domain.TruncateIP(ip)
+	case domain.IPPolicyHash:
+		mac := hmac.New(sha256.New, uc.dayKey(now))
+		mac.Write([]byte(ip))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return ""
+	}
+}
+
+// dayKey returns key of hashes made on the day of now, it rotates daily
+func (uc *clickUsecase) dayKey(now time.Time) []byte {
+	day := hmac.New(sha256.New, uc.visitorSecret)
+	day.Write([]byte(now.Format("2006-01-02")))
+	return day.Sum(nil)
+}
+
+// Run stores recorded clicks until context is canceled, subscriptions are
+// closed once it returns
+func (uc *clickUsecase) Run(ctx context.Context) {
+	defer uc.broker.close()
+	uc.writer.Run(ctx)
+}
+
+func (uc *clickUsecase) CampaignStats(c context.Context, urlID string, user *auth.Claims) ([]*domain.CampaignStats, *domain.StatsCoverage, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase CampaignStats",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return nil, nil, err
+	}
+
+	stats, err := uc.clickRepo.CampaignStats(ctx, urlID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, nil, err
+	}
+
+	coverage, err := uc.coverage(ctx, urlID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, nil, err
+	}
+
+	return stats, coverage, nil
+}
+
+func (uc *clickUsecase) ClickPatterns(c context.Context, urlID string, filter domain.PatternsFilter, user *auth.Claims) (*domain.ClickPatterns, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase ClickPatterns",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	timezone := filter.TZ
+	if timezone == "" {
+		timezone = domain.DefaultTimezone
+	}
+
+	patterns, err := uc.clickRepo.ClickPatterns(ctx, urlID, timezone)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	patterns.Coverage, err = uc.coverage(ctx, urlID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+func (uc *clickUsecase) Compare(c context.Context, ids []string, window string, user *auth.Claims) (*domain.StatsComparison, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Compare",
+		trace.WithAttributes(
+			attribute.StringSlice("urlids", ids),
+			attribute.String("window", window)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if len(ids) == 0 || len(ids) > domain.MaxCompareIDs {
+		err := fmt.Errorf("from 1 to %d urls can be compared: %w", domain.MaxCompareIDs, domain.ErrBadParamInput)
+		span.RecordError(err)
+		return nil, err
+	}
+	days, err := domain.ParseStatsWindow(window)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	to := time.Now().UTC()
+	from := to.Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	result := &domain.StatsComparison{
+		Window: window,
+		Days:   make([]string, days),
+		URLs:   make([]*domain.URLStats, 0, len(ids)),
+	}
+	for i := range result.Days {
+		result.Days[i] = from.AddDate(0, 0, i).Format("2006-01-02")
+	}
+
+	// ownership of all URLs is checked before any statistics are read
+	urls := make([]*domain.URL, len(ids))
+	for i, id := range ids {
+		u, err := uc.urlRepo.GetByID(ctx, id, "id", "user_id", "created_at")
+		if errors.Is(err, domain.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("can't get %s url: %w", id, err)
+		}
+		if !user.HasRole(auth.RoleAdmin) && (u.UserID == "" || u.UserID != user.Subject) {
+			span.RecordError(domain.ErrForbidden)
+			return nil, domain.ErrForbidden
+		}
+		urls[i] = u
+	}
+
+	var untracked int64
+	for i, id := range ids {
+		urlStats := &domain.URLStats{ID: id}
+		result.URLs = append(result.URLs, urlStats)
+		if urls[i] == nil {
+			continue
+		}
+
+		stats, err := uc.clickRepo.ClickStats(ctx, id, from, to)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		untracked += stats.Untracked
+		urlStats.Clicks = &stats.Clicks
+		urlStats.Uniques = &stats.Uniques
+		// days before URL was created are null, so series of URLs of
+		// different age are not mistaken for days without clicks
+		created := urls[i].CreatedAt.UTC().Format("2006-01-02")
+		urlStats.Daily = make([]*int64, len(result.Days))
+		for d, day := range result.Days {
+			if day < created {
+				continue
+			}
+			clicks := stats.Daily[day]
+			urlStats.Daily[d] = &clicks
+		}
+	}
+	result.Coverage = domain.NewStatsCoverage(uc.cfg.Analytics, untracked)
+
+	return result, nil
+}
+
+// coverage returns coverage of all time statistics of URL
+func (uc *clickUsecase) coverage(ctx context.Context, urlID string) (*domain.StatsCoverage, error) {
+	untracked, err := uc.clickRepo.UntrackedClicks(ctx, urlID, time.Time{}, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewStatsCoverage(uc.cfg.Analytics, untracked), nil
+}
+
+// checkAccess allows statistics of URL to its owner and admins
+func (uc *clickUsecase) checkAccess(ctx context.Context, urlID string, user *auth.Claims) error {
+	u, err := uc.urlRepo.GetByID(ctx, urlID, "id", "user_id")
+	if err != nil {
+		return fmt.Errorf("can't get %s url: %w", urlID, err)
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && (u.UserID == "" || u.UserID != user.Subject) {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,732 @@
+package usecase_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/click/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	urlmock "github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+// newClickUsecase returns usecase storing every click as soon as it is
+// recorded
+func newClickUsecase(c domain.ClickRepository, u domain.URLRepository, logger *zap.Logger, cfg usecase.Config) domain.ClickUsecase {
+	cfg.BatchSize = 1
+	cfg.RollupMaxDelta = 1
+	return usecase.NewClickUsecase(c, u, usecase.NewClickWriter(c, 10*time.Second, logger, cfg), 10*time.Second, tracer, logger, cfg)
+}
+
+func TestClickUsecase_Record(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	stored := make(chan *domain.Click, 1)
+	repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+		for _, click := range clicks {
+			stored <- click
+		}
+		return nil
+	}).AnyTimes()
+	repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.NewNop(), usecase.Config{SourceParam: "src"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go uc.Run(ctx)
+
+	long := strings.Repeat("a", domain.MaxCampaignValueLength-1) + "é"
+	cases := []struct {
+		description string
+		query       url.Values
+		campaign    domain.Campaign
+	}{
+		{
+			description: "utm parameters",
+			query:       url.Values{"utm_source": {" newsletter "}, "utm_medium": {"email"}, "utm_campaign": {"spring"}, "src": {"ignored"}},
+			campaign:    domain.Campaign{Source: "newsletter", Medium: "email", Name: "spring"},
+		},
+		{
+			description: "source parameter",
+			query:       url.Values{"src": {"twitter"}},
+			campaign:    domain.Campaign{Source: "twitter"},
+		},
+		{
+			description: "no parameters",
+			campaign:    domain.Campaign{},
+		},
+		{
+			description: "long value is truncated at character boundary",
+			query:       url.Values{"utm_campaign": {long}},
+			campaign:    domain.Campaign{Name: long[:domain.MaxCampaignValueLength-1]},
+		},
+		{
+			description: "invalid UTF-8 is ignored",
+			query:       url.Values{"utm_source": {"news\xffletter"}, "utm_medium": {"email"}},
+			campaign:    domain.Campaign{Medium: "email"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			uc.Record(domain.ClickRequest{URLID: "test123", Query: tc.query})
+
+			select {
+			case click := <-stored:
+				assert.Equal(t, "test123", click.URLID)
+				assert.Equal(t, tc.campaign, click.Campaign)
+				assert.Empty(t, click.Visitor)
+				assert.False(t, click.ID.IsZero())
+				assert.WithinDuration(t, time.Now(), click.CreatedAt, time.Second)
+			case <-time.After(time.Second):
+				t.Fatal("click was not stored")
+			}
+		})
+	}
+}
+
+func TestClickUsecase_RecordVisitor(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	stored := make(chan *domain.Click, 3)
+	repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+		for _, click := range clicks {
+			stored <- click
+		}
+		return nil
+	}).Times(3)
+	repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.NewNop(), usecase.Config{})
+	uc.Record(domain.ClickRequest{URLID: "test123", IP: "192.0.2.1", UserAgent: "agent", Referrer: "https://News.example.com/post?id=1"})
+	uc.Record(domain.ClickRequest{URLID: "test123", IP: "192.0.2.1", UserAgent: "agent", Referrer: "android-app://com.example"})
+	uc.Record(domain.ClickRequest{URLID: "test123", IP: "192.0.2.1", UserAgent: "other agent"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go uc.Run(ctx)
+
+	visitors := make([]string, 0, 3)
+	referrers := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		select {
+		case click := <-stored:
+			visitors = append(visitors, click.Visitor)
+			referrers = append(referrers, click.Referrer)
+		case <-time.After(time.Second):
+			t.Fatal("click was not stored")
+		}
+	}
+
+	assert.Len(t, visitors[0], 64)
+	assert.NotContains(t, visitors[0], "192.0.2.1")
+	assert.Equal(t, visitors[0], visitors[1])
+	assert.NotEqual(t, visitors[0], visitors[2])
+	assert.Equal(t, []string{"news.example.com", "", ""}, referrers)
+}
+
+func TestClickUsecase_RecordAnalytics(t *testing.T) {
+	admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+	req := domain.ClickRequest{
+		URLID:     "test123",
+		Query:     url.Values{"utm_source": {"newsletter"}},
+		IP:        "192.0.2.1",
+		UserAgent: "Googlebot/2.1",
+		Referrer:  "https://news.example.com/post",
+	}
+	cases := []struct {
+		description string
+		analytics   string
+		doNotTrack  bool
+		click       *domain.Click
+	}{
+		{
+			description: "standard",
+			analytics:   domain.AnalyticsStandard,
+			click:       &domain.Click{URLID: "test123", Campaign: domain.Campaign{Source: "newsletter"}, Referrer: "news.example.com", Bot: true},
+		},
+		{
+			description: "minimal",
+			analytics:   domain.AnalyticsMinimal,
+			click:       &domain.Click{URLID: "test123", Campaign: domain.Campaign{Source: "newsletter"}},
+		},
+		{
+			description: "off",
+			analytics:   domain.AnalyticsOff,
+		},
+		{
+			description: "do not track",
+			analytics:   domain.AnalyticsStandard,
+			doNotTrack:  true,
+		},
+		{
+			description: "unknown mode",
+			analytics:   "full",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			controller := gomock.NewController(t)
+			defer controller.Finish()
+
+			repository := mock.NewMockClickRepository(controller)
+			stored := make(chan *domain.Click, 1)
+			rolled := make(chan *domain.RollupDelta, 1)
+			if tc.click != nil {
+				repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+					for _, click := range clicks {
+						stored <- click
+					}
+					return nil
+				})
+			}
+			repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, deltas []*domain.RollupDelta) error {
+				for _, d := range deltas {
+					rolled <- d
+				}
+				return nil
+			})
+
+			urlRepository := urlmock.NewMockURLRepository(controller)
+			urlRepository.EXPECT().GetByID(gomock.Any(), "test123", "id", "user_id").Return(&domain.URL{ID: "test123"}, nil)
+			uc := newClickUsecase(repository, urlRepository, zap.NewNop(), usecase.Config{Analytics: tc.analytics})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sub, err := uc.Subscribe(ctx, "test123", admin)
+			require.NoError(t, err)
+			defer sub.Close()
+			go uc.Run(ctx)
+
+			r := req
+			r.DoNotTrack = tc.doNotTrack
+			uc.Record(r)
+
+			var delta *domain.RollupDelta
+			select {
+			case delta = <-rolled:
+			case <-time.After(time.Second):
+				t.Fatal("click was not counted")
+			}
+			assert.EqualValues(t, 1, delta.Clicks)
+			if tc.click == nil {
+				assert.EqualValues(t, 1, delta.Untracked)
+				assert.Empty(t, delta.Visitors)
+				assert.Zero(t, delta.Bots)
+				select {
+				case <-sub.Clicks():
+					t.Fatal("untracked click is delivered to subscriber")
+				case <-time.After(20 * time.Millisecond):
+				}
+				return
+			}
+
+			assert.Zero(t, delta.Untracked)
+			assert.Equal(t, tc.analytics == domain.AnalyticsStandard, len(delta.Visitors) == 1)
+			click := <-stored
+			assert.False(t, click.Untracked)
+			assert.Equal(t, tc.click.Campaign, click.Campaign)
+			assert.Equal(t, tc.click.Referrer, click.Referrer)
+			assert.Equal(t, tc.click.Bot, click.Bot)
+			assert.Equal(t, tc.analytics == domain.AnalyticsStandard, click.Visitor != "")
+		})
+	}
+}
+
+func TestClickUsecase_RecordIPPolicy(t *testing.T) {
+	cases := []struct {
+		policy string
+		ip     string
+		stored string
+	}{
+		{policy: domain.IPPolicyFull, ip: "192.0.2.123", stored: "192.0.2.123"},
+		{policy: domain.IPPolicyFull, ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", stored: "2001:db8:85a3:8d3:1319:8a2e:370:7348"},
+		{policy: domain.IPPolicyTruncate, ip: "192.0.2.123", stored: "192.0.2.0"},
+		{policy: domain.IPPolicyTruncate, ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", stored: "2001:db8:85a3::"},
+		{policy: domain.IPPolicyTruncate, ip: "not an ip", stored: ""},
+		{policy: domain.IPPolicyDiscard, ip: "192.0.2.123", stored: ""},
+		{policy: domain.IPPolicyDiscard, ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", stored: ""},
+		{policy: "", ip: "192.0.2.123", stored: ""},
+		{policy: "unknown", ip: "192.0.2.123", stored: ""},
+	}
+
+	record := func(t *testing.T, cfg usecase.Config, reqs ...domain.ClickRequest) []*domain.Click {
+		controller := gomock.NewController(t)
+		defer controller.Finish()
+
+		repository := mock.NewMockClickRepository(controller)
+		stored := make(chan *domain.Click, len(reqs))
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+			for _, click := range clicks {
+				stored <- click
+			}
+			return nil
+		}).Times(len(reqs))
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+		uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.NewNop(), cfg)
+		for _, req := range reqs {
+			uc.Record(req)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go uc.Run(ctx)
+
+		clicks := make([]*domain.Click, 0, len(reqs))
+		for range reqs {
+			select {
+			case click := <-stored:
+				clicks = append(clicks, click)
+			case <-time.After(time.Second):
+				t.Fatal("click was not stored")
+			}
+		}
+		return clicks
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy+" "+tc.ip, func(t *testing.T) {
+			clicks := record(t, usecase.Config{IPPolicy: tc.policy}, domain.ClickRequest{URLID: "test123", IP: tc.ip, UserAgent: "agent"})
+			assert.Equal(t, tc.stored, clicks[0].IP)
+			assert.NotEmpty(t, clicks[0].Visitor, "visitor is hashed before address is anonymized")
+		})
+	}
+
+	t.Run("hash", func(t *testing.T) {
+		ipv4, ipv6 := "192.0.2.123", "2001:db8:85a3:8d3:1319:8a2e:370:7348"
+		clicks := record(t, usecase.Config{IPPolicy: domain.IPPolicyHash},
+			domain.ClickRequest{URLID: "test123", IP: ipv4},
+			domain.ClickRequest{URLID: "test123", IP: ipv4, UserAgent: "other agent"},
+			domain.ClickRequest{URLID: "test123", IP: ipv6},
+		)
+		for _, click := range clicks {
+			assert.Len(t, click.IP, 64)
+			assert.NotEqual(t, click.Visitor, click.IP)
+		}
+		assert.Equal(t, clicks[0].IP, clicks[1].IP, "hash doesn't depend on user agent")
+		assert.NotEqual(t, clicks[0].IP, clicks[2].IP)
+	})
+
+	t.Run("minimal analytics", func(t *testing.T) {
+		clicks := record(t, usecase.Config{Analytics: domain.AnalyticsMinimal, IPPolicy: domain.IPPolicyFull}, domain.ClickRequest{URLID: "test123", IP: "192.0.2.123"})
+		assert.Empty(t, clicks[0].IP)
+	})
+}
+
+func TestClickUsecase_RecordQueueFull(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	stored := make(chan *domain.Click, 2)
+	repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+		for _, click := range clicks {
+			stored <- click
+		}
+		return nil
+	}).Times(1)
+	repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.NewNop(), usecase.Config{QueueSize: 1})
+	uc.Record(domain.ClickRequest{URLID: "first01"})
+	uc.Record(domain.ClickRequest{URLID: "second1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go uc.Run(ctx)
+
+	select {
+	case click := <-stored:
+		assert.Equal(t, "first01", click.URLID)
+	case <-time.After(time.Second):
+		t.Fatal("click was not stored")
+	}
+}
+
+func TestClickUsecase_RunReadOnly(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	stored := make(chan *domain.Click, 2)
+	repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+		for _, click := range clicks {
+			stored <- click
+		}
+		return nil
+	}).Times(2)
+	repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	uc := newClickUsecase(repository, urlmock.NewMockURLRepository(controller), zap.NewNop(), usecase.Config{QueueSize: 1})
+	mode := domain.NewReadOnlyMode(true)
+	ctx, cancel := context.WithCancel(domain.WithReadOnlyMode(context.Background(), mode))
+	defer cancel()
+	go uc.Run(ctx)
+
+	// first click waits to be stored, second one waits in the queue and the
+	// third one is dropped
+	uc.Record(domain.ClickRequest{URLID: "first01"})
+	time.Sleep(10 * time.Millisecond)
+	uc.Record(domain.ClickRequest{URLID: "second1"})
+	uc.Record(domain.ClickRequest{URLID: "third01"})
+	select {
+	case <-stored:
+		t.Fatal("click is stored in read-only mode")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	mode.Set(false)
+	for _, id := range []string{"first01", "second1"} {
+		select {
+		case click := <-stored:
+			assert.Equal(t, id, click.URLID)
+		case <-time.After(time.Second):
+			t.Fatal("click was not stored")
+		}
+	}
+}
+
+func TestClickUsecase_CampaignStats(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	stats := []*domain.CampaignStats{{Source: "newsletter", Medium: domain.CampaignNone, Campaign: domain.CampaignNone, Clicks: 2}}
+
+	repository := mock.NewMockClickRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := newClickUsecase(repository, urlRepository, zap.NewNop(), usecase.Config{})
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+	admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+
+	t.Run("owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().CampaignStats(gomock.Any(), tURL.ID).Return(stats, nil)
+		repository.EXPECT().UntrackedClicks(gomock.Any(), tURL.ID, time.Time{}, gomock.Any()).Return(int64(0), nil)
+
+		result, coverage, err := uc.CampaignStats(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		assert.Equal(t, stats, result)
+		assert.Equal(t, domain.NewStatsCoverage(domain.AnalyticsStandard, 0), coverage)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().CampaignStats(gomock.Any(), tURL.ID).Return(stats, nil)
+		repository.EXPECT().UntrackedClicks(gomock.Any(), tURL.ID, time.Time{}, gomock.Any()).Return(int64(0), nil)
+
+		result, coverage, err := uc.CampaignStats(context.Background(), tURL.ID, admin)
+		require.NoError(t, err)
+		assert.Equal(t, stats, result)
+		assert.Equal(t, domain.NewStatsCoverage(domain.AnalyticsStandard, 0), coverage)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		result, _, err := uc.CampaignStats(context.Background(), tURL.ID, other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("anonymous url", func(t *testing.T) {
+		anonURL := tests.NewURL()
+		anonURL.UserID = ""
+		urlRepository.EXPECT().GetByID(gomock.Any(), anonURL.ID, "id", "user_id").Return(anonURL, nil)
+
+		result, _, err := uc.CampaignStats(context.Background(), anonURL.ID, &auth.Claims{})
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("url not found", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(nil, domain.ErrNotFound)
+
+		result, _, err := uc.CampaignStats(context.Background(), tURL.ID, owner)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, result)
+	})
+}
+
+func TestClickUsecase_ClickPatterns(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockClickRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := newClickUsecase(repository, urlRepository, zap.NewNop(), usecase.Config{})
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	t.Run("default time zone", func(t *testing.T) {
+		patterns := &domain.ClickPatterns{Timezone: domain.DefaultTimezone}
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().ClickPatterns(gomock.Any(), tURL.ID, domain.DefaultTimezone).Return(patterns, nil)
+		repository.EXPECT().UntrackedClicks(gomock.Any(), tURL.ID, time.Time{}, gomock.Any()).Return(int64(2), nil)
+
+		result, err := uc.ClickPatterns(context.Background(), tURL.ID, domain.PatternsFilter{}, owner)
+		require.NoError(t, err)
+		assert.Equal(t, patterns, result)
+		assert.Equal(t, &domain.StatsCoverage{Analytics: domain.AnalyticsStandard, Untracked: 2, Partial: true}, result.Coverage)
+	})
+
+	t.Run("time zone", func(t *testing.T) {
+		patterns := &domain.ClickPatterns{Timezone: "Europe/Berlin"}
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().ClickPatterns(gomock.Any(), tURL.ID, "Europe/Berlin").Return(patterns, nil)
+		repository.EXPECT().UntrackedClicks(gomock.Any(), tURL.ID, time.Time{}, gomock.Any()).Return(int64(0), nil)
+
+		result, err := uc.ClickPatterns(context.Background(), tURL.ID, domain.PatternsFilter{TZ: "Europe/Berlin"}, owner)
+		require.NoError(t, err)
+		assert.Equal(t, patterns, result)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		result, err := uc.ClickPatterns(context.Background(), tURL.ID, domain.PatternsFilter{}, other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+}
+
+func TestClickUsecase_Compare(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockClickRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := newClickUsecase(repository, urlRepository, zap.NewNop(), usecase.Config{})
+
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	oldURL := tests.NewURL()
+	oldURL.CreatedAt = now.AddDate(0, 0, -10)
+	newURL := tests.NewURL()
+	newURL.ID = "newurl1"
+	newURL.CreatedAt = now
+	owner := auth.NewClaims(oldURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+	admin := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+	int64p := func(v int64) *int64 { return &v }
+
+	t.Run("success", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), oldURL.ID, "id", "user_id", "created_at").Return(oldURL, nil)
+		urlRepository.EXPECT().GetByID(gomock.Any(), newURL.ID, "id", "user_id", "created_at").Return(newURL, nil)
+		urlRepository.EXPECT().GetByID(gomock.Any(), "missing", "id", "user_id", "created_at").Return(nil, domain.ErrNotFound)
+		repository.EXPECT().ClickStats(gomock.Any(), oldURL.ID, gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, urlID string, from, to time.Time) (*domain.ClickStats, error) {
+			assert.Equal(t, now.AddDate(0, 0, -2).Format("2006-01-02"), from.Format("2006-01-02"))
+			assert.True(t, from.Equal(from.Truncate(24*time.Hour)))
+			return &domain.ClickStats{Clicks: 5, Uniques: 3, Untracked: 1, Daily: map[string]int64{yesterday: 2, today: 3}}, nil
+		})
+		repository.EXPECT().ClickStats(gomock.Any(), newURL.ID, gomock.Any(), gomock.Any()).Return(&domain.ClickStats{Clicks: 1, Uniques: 1, Daily: map[string]int64{today: 1}}, nil)
+
+		result, err := uc.Compare(context.Background(), []string{oldURL.ID, newURL.ID, "missing"}, "3d", owner)
+		require.NoError(t, err)
+		assert.Equal(t, "3d", result.Window)
+		require.Len(t, result.Days, 3)
+		assert.Equal(t, today, result.Days[2])
+		assert.Equal(t, []*domain.URLStats{
+			{ID: oldURL.ID, Clicks: int64p(5), Uniques: int64p(3), Daily: []*int64{int64p(0), int64p(2), int64p(3)}},
+			{ID: newURL.ID, Clicks: int64p(1), Uniques: int64p(1), Daily: []*int64{nil, nil, int64p(1)}},
+			{ID: "missing"},
+		}, result.URLs)
+		assert.Equal(t, &domain.StatsCoverage{Analytics: domain.AnalyticsStandard, Untracked: 1, Partial: true}, result.Coverage)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), oldURL.ID, "id", "user_id", "created_at").Return(oldURL, nil)
+		repository.EXPECT().ClickStats(gomock.Any(), oldURL.ID, gomock.Any(), gomock.Any()).Return(&domain.ClickStats{Daily: map[string]int64{}}, nil)
+
+		result, err := uc.Compare(context.Background(), []string{oldURL.ID}, "30d", admin)
+		require.NoError(t, err)
+		assert.Len(t, result.Days, 30)
+		assert.Equal(t, int64p(0), result.URLs[0].Clicks)
+	})
+
+	t.Run("not owner of one url", func(t *testing.T) {
+		otherURL := tests.NewURL()
+		otherURL.ID = "other01"
+		otherURL.UserID = other.Subject
+		urlRepository.EXPECT().GetByID(gomock.Any(), otherURL.ID, "id", "user_id", "created_at").Return(otherURL, nil)
+		urlRepository.EXPECT().GetByID(gomock.Any(), oldURL.ID, "id", "user_id", "created_at").Return(oldURL, nil)
+
+		result, err := uc.Compare(context.Background(), []string{otherURL.ID, oldURL.ID}, "30d", other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("too many ids", func(t *testing.T) {
+		result, err := uc.Compare(context.Background(), []string{"a", "b", "c", "d", "e", "f"}, "30d", owner)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, result)
+	})
+
+	t.Run("invalid window", func(t *testing.T) {
+		result, err := uc.Compare(context.Background(), []string{oldURL.ID}, "1y", owner)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, result)
+	})
+}
+
+func TestClickUsecase_Subscribe(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	// newUsecase returns usecase whose stored clicks are sent to channel
+	newUsecase := func(cfg usecase.Config) (domain.ClickUsecase, *urlmock.MockURLRepository, chan *domain.Click) {
+		repository := mock.NewMockClickRepository(controller)
+		stored := make(chan *domain.Click, 10)
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+			for _, click := range clicks {
+				stored <- click
+			}
+			return nil
+		}).AnyTimes()
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		urlRepository := urlmock.NewMockURLRepository(controller)
+		return newClickUsecase(repository, urlRepository, zap.NewNop(), cfg), urlRepository, stored
+	}
+
+	waitStored := func(t *testing.T, stored chan *domain.Click, n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case <-stored:
+			case <-time.After(time.Second):
+				t.Fatal("click was not stored")
+			}
+		}
+	}
+
+	t.Run("clicks on url", func(t *testing.T) {
+		uc, urlRepository, stored := newUsecase(usecase.Config{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go uc.Run(ctx)
+
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		sub, err := uc.Subscribe(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		defer sub.Close()
+
+		uc.Record(domain.ClickRequest{URLID: "other01"})
+		uc.Record(domain.ClickRequest{URLID: tURL.ID, Query: url.Values{"utm_source": {"newsletter"}}})
+		waitStored(t, stored, 2)
+
+		select {
+		case click := <-sub.Clicks():
+			assert.Equal(t, tURL.ID, click.URLID)
+			assert.Equal(t, "newsletter", click.Campaign.Source)
+		case <-time.After(time.Second):
+			t.Fatal("click was not delivered")
+		}
+		assert.Empty(t, sub.Clicks())
+		assert.Zero(t, sub.Dropped())
+	})
+
+	t.Run("slow subscriber", func(t *testing.T) {
+		uc, urlRepository, stored := newUsecase(usecase.Config{StreamBuffer: 2})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go uc.Run(ctx)
+
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil).Times(2)
+		slow, err := uc.Subscribe(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		defer slow.Close()
+		fast, err := uc.Subscribe(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		defer fast.Close()
+
+		// fast subscriber keeps up while slow one doesn't read at all
+		sources := []string{"a", "b", "c", "d", "e"}
+		for _, source := range sources {
+			uc.Record(domain.ClickRequest{URLID: tURL.ID, Query: url.Values{"utm_source": {source}}})
+			waitStored(t, stored, 1)
+			click := <-fast.Clicks()
+			assert.Equal(t, source, click.Campaign.Source)
+		}
+
+		// the oldest clicks are dropped, recording is not held up
+		assert.EqualValues(t, 3, slow.Dropped())
+		assert.Equal(t, "d", (<-slow.Clicks()).Campaign.Source)
+		assert.Equal(t, "e", (<-slow.Clicks()).Campaign.Source)
+		assert.Zero(t, fast.Dropped())
+	})
+
+	t.Run("closed when run stops", func(t *testing.T) {
+		uc, urlRepository, _ := newUsecase(usecase.Config{})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			uc.Run(ctx)
+			close(done)
+		}()
+
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil).Times(2)
+		sub, err := uc.Subscribe(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		cancel()
+		<-done
+
+		_, ok := <-sub.Clicks()
+		assert.False(t, ok)
+		sub.Close()
+
+		late, err := uc.Subscribe(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		_, ok = <-late.Clicks()
+		assert.False(t, ok)
+	})
+
+	t.Run("closed subscription", func(t *testing.T) {
+		uc, urlRepository, stored := newUsecase(usecase.Config{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go uc.Run(ctx)
+
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		sub, err := uc.Subscribe(context.Background(), tURL.ID, owner)
+		require.NoError(t, err)
+		sub.Close()
+		sub.Close()
+
+		uc.Record(domain.ClickRequest{URLID: tURL.ID})
+		waitStored(t, stored, 1)
+		_, ok := <-sub.Clicks()
+		assert.False(t, ok)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		uc, urlRepository, _ := newUsecase(usecase.Config{})
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		sub, err := uc.Subscribe(context.Background(), tURL.ID, other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, sub)
+	})
+}
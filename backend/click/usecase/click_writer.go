@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Default values of click writing used when Config fields are not set
+const (
+	DefaultBatchSize       = 100
+	DefaultFlushInterval   = 1000
+	DefaultShutdownTimeout = 5000
+)
+
+// ClickWriter queues recorded clicks and stores them in batches. Batch is
+// stored once it is full or FlushInterval after the previous one. Stored
+// clicks are counted in rollups by RollupCoalescer.
+type ClickWriter struct {
+	clickRepo      domain.ClickRepository
+	contextTimeout time.Duration
+	logger         *zap.Logger
+	cfg            Config
+	queue          chan *domain.Click
+	rollups        *RollupCoalescer
+	// stopped is closed once Run stops reading queue, blocked writes give up
+	stopped chan struct{}
+	flushed atomic.Int64
+	dropped atomic.Int64
+}
+
+// NewClickWriter creates ClickWriter, call Run to store written clicks
+func NewClickWriter(c domain.ClickRepository, timeout time.Duration, logger *zap.Logger, cfg Config) *ClickWriter {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	return &ClickWriter{
+		clickRepo:      c,
+		contextTimeout: timeout,
+		logger:         logger,
+		cfg:            cfg,
+		queue:          make(chan *domain.Click, cfg.QueueSize),
+		rollups:        NewRollupCoalescer(c, timeout, logger, cfg),
+		stopped:        make(chan struct{}),
+	}
+}
+
+// Write queues click. Click is dropped when the queue is full, in blocking
+// mode Write waits for room instead until writer is stopped. Clicks written
+// after writer is stopped are dropped.
+func (w *ClickWriter) Write(click *domain.Click) {
+	if w.enqueue(click) {
+		return
+	}
+
+	w.dropped.Add(1)
+	w.logger.Debug("click can't be queued, click is dropped", zap.String("urlid", click.URLID))
+}
+
+// enqueue tells whether click is queued
+func (w *ClickWriter) enqueue(click *domain.Click) bool {
+	select {
+	case <-w.stopped:
+		return false
+	default:
+	}
+
+	if !w.cfg.Blocking {
+		select {
+		case w.queue <- click:
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case w.queue <- click:
+		return true
+	case <-w.stopped:
+		return false
+	}
+}
+
+// Stats returns number of stored and dropped clicks
+func (w *ClickWriter) Stats() (flushed, dropped int64) {
+	return w.flushed.Load(), w.dropped.Load()
+}
+
+// RollupStats returns number of stored clicks waiting to be added to
+// rollups, added to them and dropped
+func (w *ClickWriter) RollupStats() (pending, flushed, dropped int64) {
+	return w.rollups.Stats()
+}
+
+// Run stores queued clicks until context is canceled, then clicks still
+// queued are stored within ShutdownTimeout. Storing waits while service is
+// read-only, clicks recorded meanwhile are queued. Stored clicks are added to
+// rollups before it returns.
+func (w *ClickWriter) Run(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.rollups.Run(ctx)
+	}()
+
+	w.run(ctx)
+	// clicks stored on shutdown are counted once periodic adding stops
+	<-done
+	w.rollups.Shutdown(ctx)
+}
+
+func (w *ClickWriter) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(w.cfg.FlushInterval) * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]*domain.Click, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			w.shutdown(ctx, batch)
+			return
+		case click := <-w.queue:
+			batch = append(batch, click)
+			if len(batch) < w.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := domain.WaitWritable(ctx); err != nil {
+			w.shutdown(ctx, batch)
+			return
+		}
+		// batch being stored is not interrupted by shutdown
+		w.flush(context.Background(), batch)
+		batch = batch[:0]
+		ticker.Reset(time.Duration(w.cfg.FlushInterval) * time.Millisecond)
+	}
+}
+
+// shutdown stores batch and queued clicks synchronously, clicks not stored
+// before deadline or while service is read-only are dropped
+func (w *ClickWriter) shutdown(ctx context.Context, batch []*domain.Click) {
+	close(w.stopped)
+
+	if !domain.Writable(ctx) {
+		w.drop(append(batch, w.drain(nil, len(w.queue))...), "service is read-only")
+		return
+	}
+
+	deadline, cancel := context.WithTimeout(context.Background(), time.Duration(w.cfg.ShutdownTimeout)*time.Millisecond)
+	defer cancel()
+	for batch = w.drain(batch, w.cfg.BatchSize); len(batch) > 0; batch = w.drain(batch[:0], w.cfg.BatchSize) {
+		if deadline.Err() != nil {
+			w.drop(append(batch, w.drain(nil, len(w.queue))...), "shutdown deadline is exceeded")
+			return
+		}
+		w.flush(deadline, batch)
+	}
+}
+
+// drain appends queued clicks to batch until it has size clicks or queue is
+// empty
+func (w *ClickWriter) drain(batch []*domain.Click, size int) []*domain.Click {
+	for len(batch) < size {
+		select {
+		case click := <-w.queue:
+			batch = append(batch, click)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (w *ClickWriter) drop(clicks []*domain.Click, reason string) {
+	if len(clicks) == 0 {
+		return
+	}
+	w.dropped.Add(int64(len(clicks)))
+	w.logger.Warn("clicks are dropped on shutdown", zap.String("reason", reason), zap.Int("dropped", len(clicks)))
+}
+
+func (w *ClickWriter) flush(c context.Context, batch []*domain.Click) {
+	ctx, cancel := context.WithTimeout(c, w.contextTimeout)
+	defer cancel()
+
+	// untracked clicks are only counted in rollups
+	tracked := make([]*domain.Click, 0, len(batch))
+	for _, click := range batch {
+		if !click.Untracked {
+			tracked = append(tracked, click)
+		}
+	}
+	if len(tracked) > 0 {
+		if err := w.clickRepo.StoreMany(ctx, tracked); err != nil {
+			w.dropped.Add(int64(len(batch)))
+			w.logger.Error("can't store clicks", zap.Int("clicks", len(batch)), zap.Error(err))
+			return
+		}
+	}
+	w.flushed.Add(int64(len(batch)))
+	w.rollups.Add(batch)
+}
@@ -0,0 +1,280 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/click/usecase"
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// batchRecorder records sizes of stored batches
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *batchRecorder) store(_ context.Context, clicks []*domain.Click) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, len(clicks))
+	return nil
+}
+
+func (r *batchRecorder) stored() (batches []int, clicks int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.batches {
+		clicks += n
+	}
+	return append([]int(nil), r.batches...), clicks
+}
+
+func TestClickWriter(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	newRepository := func() (*mock.MockClickRepository, *batchRecorder) {
+		repository := mock.NewMockClickRepository(controller)
+		recorder := &batchRecorder{}
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(recorder.store).AnyTimes()
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		return repository, recorder
+	}
+	run := func(w *usecase.ClickWriter) (stop func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+		return func() {
+			cancel()
+			<-done
+		}
+	}
+	click := func(i int) *domain.Click {
+		return &domain.Click{URLID: fmt.Sprintf("test%03d", i)}
+	}
+
+	t.Run("full batches", func(t *testing.T) {
+		repository, recorder := newRepository()
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{QueueSize: 1000, BatchSize: 10, FlushInterval: int(time.Hour / time.Millisecond)})
+		stop := run(w)
+		defer stop()
+
+		var wg sync.WaitGroup
+		for g := 0; g < 10; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					w.Write(click(g*100 + i))
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		require.Eventually(t, func() bool {
+			_, clicks := recorder.stored()
+			return clicks == 1000
+		}, time.Second, time.Millisecond)
+		batches, _ := recorder.stored()
+		assert.Len(t, batches, 100)
+		for _, n := range batches {
+			assert.Equal(t, 10, n)
+		}
+		flushed, dropped := w.Stats()
+		assert.EqualValues(t, 1000, flushed)
+		assert.Zero(t, dropped)
+	})
+
+	t.Run("partial batch flushed after interval", func(t *testing.T) {
+		repository, recorder := newRepository()
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{BatchSize: 100, FlushInterval: 10})
+		stop := run(w)
+		defer stop()
+
+		for i := 0; i < 3; i++ {
+			w.Write(click(i))
+		}
+
+		require.Eventually(t, func() bool {
+			_, clicks := recorder.stored()
+			return clicks == 3
+		}, time.Second, time.Millisecond)
+		batches, _ := recorder.stored()
+		assert.Equal(t, []int{3}, batches)
+	})
+
+	t.Run("untracked clicks are only added to rollup", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		rolled := make(chan []*domain.RollupDelta, 1)
+		repository.EXPECT().StoreMany(gomock.Any(), []*domain.Click{{URLID: "tracked"}}).Return(nil)
+		repository.EXPECT().AddRollupDeltas(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, deltas []*domain.RollupDelta) error {
+			rolled <- deltas
+			return nil
+		})
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{BatchSize: 2, RollupInterval: 10})
+		stop := run(w)
+		defer stop()
+
+		w.Write(&domain.Click{URLID: "tracked"})
+		w.Write(&domain.Click{URLID: "untracked", Untracked: true})
+
+		select {
+		case deltas := <-rolled:
+			assert.ElementsMatch(t, []*domain.RollupDelta{
+				{URLID: "tracked", Clicks: 1},
+				{URLID: "untracked", Clicks: 1, Untracked: 1},
+			}, deltas)
+		case <-time.After(time.Second):
+			t.Fatal("clicks were not added to rollup")
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		repository, recorder := newRepository()
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{QueueSize: 5, BatchSize: 100})
+
+		for i := 0; i < 8; i++ {
+			w.Write(click(i))
+		}
+		stop := run(w)
+		stop()
+
+		_, clicks := recorder.stored()
+		assert.Equal(t, 5, clicks)
+		flushed, dropped := w.Stats()
+		assert.EqualValues(t, 5, flushed)
+		assert.EqualValues(t, 3, dropped)
+	})
+
+	t.Run("blocking", func(t *testing.T) {
+		repository, recorder := newRepository()
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{QueueSize: 1, BatchSize: 1, Blocking: true})
+
+		w.Write(click(0))
+		written := make(chan struct{})
+		go func() {
+			w.Write(click(1))
+			close(written)
+		}()
+		select {
+		case <-written:
+			t.Fatal("click is written to full queue")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		stop := run(w)
+		defer stop()
+		select {
+		case <-written:
+		case <-time.After(time.Second):
+			t.Fatal("click is not written")
+		}
+		require.Eventually(t, func() bool {
+			_, clicks := recorder.stored()
+			return clicks == 2
+		}, time.Second, time.Millisecond)
+		_, dropped := w.Stats()
+		assert.Zero(t, dropped)
+	})
+
+	t.Run("blocked write gives up once stopped", func(t *testing.T) {
+		repository, _ := newRepository()
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{QueueSize: 1, Blocking: true})
+		stop := run(w)
+
+		w.Write(click(0))
+		blocked := make(chan struct{})
+		go func() {
+			w.Write(click(1))
+			close(blocked)
+		}()
+		stop()
+
+		select {
+		case <-blocked:
+		case <-time.After(time.Second):
+			t.Fatal("write is blocked after writer is stopped")
+		}
+		w.Write(click(2))
+		_, dropped := w.Stats()
+		assert.GreaterOrEqual(t, dropped, int64(1))
+	})
+
+	t.Run("shutdown flushes queued clicks", func(t *testing.T) {
+		repository, recorder := newRepository()
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{QueueSize: 1000, BatchSize: 10, FlushInterval: int(time.Hour / time.Millisecond)})
+		stop := run(w)
+
+		for i := 0; i < 995; i++ {
+			w.Write(click(i))
+		}
+		stop()
+
+		batches, clicks := recorder.stored()
+		assert.Equal(t, 995, clicks)
+		for _, n := range batches {
+			assert.LessOrEqual(t, n, 10)
+		}
+		flushed, dropped := w.Stats()
+		assert.EqualValues(t, 995, flushed)
+		assert.Zero(t, dropped)
+		pending, flushed, dropped := w.RollupStats()
+		assert.Zero(t, pending)
+		assert.EqualValues(t, 995, flushed)
+		assert.Zero(t, dropped)
+	})
+
+	t.Run("shutdown deadline", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		repository.EXPECT().StoreMany(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, clicks []*domain.Click) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{BatchSize: 100, FlushInterval: int(time.Hour / time.Millisecond), ShutdownTimeout: 20})
+		stop := run(w)
+
+		for i := 0; i < 25; i++ {
+			w.Write(click(i))
+		}
+		start := time.Now()
+		stop()
+
+		assert.Less(t, time.Since(start), time.Second)
+		flushed, dropped := w.Stats()
+		assert.Zero(t, flushed)
+		assert.EqualValues(t, 25, dropped)
+	})
+
+	t.Run("read-only on shutdown", func(t *testing.T) {
+		repository := mock.NewMockClickRepository(controller)
+		w := usecase.NewClickWriter(repository, time.Second, zap.NewNop(), usecase.Config{BatchSize: 1})
+		ctx, cancel := context.WithCancel(domain.WithReadOnlyMode(context.Background(), domain.NewReadOnlyMode(true)))
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+
+		w.Write(click(0))
+		w.Write(click(1))
+		cancel()
+		<-done
+
+		flushed, dropped := w.Stats()
+		assert.Zero(t, flushed)
+		assert.EqualValues(t, 2, dropped)
+	})
+}
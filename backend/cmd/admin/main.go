@@ -5,21 +5,30 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	dStub "github.com/golang-migrate/migrate/v4/database/mongodb"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 
 	"github.com/semka95/shortener/backend/cmd"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/pow"
 	"github.com/semka95/shortener/backend/store"
+	_URLRepo "github.com/semka95/shortener/backend/url/repository"
+	_UserRepo "github.com/semka95/shortener/backend/user/repository"
+	_UserUcase "github.com/semka95/shortener/backend/user/usecase"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
 )
 
 func main() {
@@ -33,10 +42,17 @@ func main() {
 
 	if err := run(logger); err != nil {
 		logger.Error("shutting down, error: ", zap.Error(err))
+		_ = logger.Sync()
+		os.Exit(1)
 	}
 }
 
 func run(logger *zap.Logger) error {
+	// scripts solve challenges without config and database
+	if len(os.Args) > 1 && os.Args[1] == "solve_challenge" {
+		return solveChallenge(os.Stdin, os.Stdout)
+	}
+
 	// Configuration
 	configPath, ok := os.LookupEnv("CONFIG")
 
@@ -72,9 +88,13 @@ func run(logger *zap.Logger) error {
 
 	switch os.Args[1] {
 	case "migrate_mongo":
-		err = migrateMongo(client, cfg.MongoConfig.Name)
+		err = store.Migrate(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger)
 	case "seed":
-		err = store.Seed(ctx, client.Database(cfg.MongoConfig.Name))
+		err = store.Seed(ctx, client.Database(cfg.MongoConfig.Name), cfg.MongoConfig.Collections)
+	case "seed_admin":
+		err = seedAdmin(ctx, client, cfg, os.Args[2:], logger)
+	case "reencrypt_links":
+		err = reencryptLinks(client, cfg, os.Args[2:], logger)
 	case "keygen":
 		err = keygen(os.Args[2], logger)
 	default:
@@ -89,25 +109,135 @@ func run(logger *zap.Logger) error {
 	return nil
 }
 
-func migrateMongo(db *mongo.Client, dbName string) error {
-	instance, err := dStub.WithInstance(db, &dStub.Config{DatabaseName: dbName})
+// seedAdmin creates admin user with email and password taken from flags or
+// ADMIN_EMAIL and ADMIN_PASSWORD environment variables. Password is generated
+// and printed when not specified. Existing user is left untouched unless
+// -promote flag is set, then admin role is granted to it.
+func seedAdmin(ctx context.Context, client *mongo.Client, cfg *cmd.Config, args []string, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("seed_admin", flag.ContinueOnError)
+	email := fs.String("email", os.Getenv("ADMIN_EMAIL"), "admin email")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "admin password, generated when empty")
+	fullName := fs.String("name", "", "admin full name")
+	promote := fs.Bool("promote", false, "grant admin role to existing user with the same email")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		pwd, err := generatePassword()
+		if err != nil {
+			return err
+		}
+		*password = pwd
+	}
+
+	cu := domain.CreateUser{
+		FullName: *fullName,
+		Email:    *email,
+		Password: *password,
+	}
+	v, err := web.NewAppValidator()
+	if err != nil {
+		return err
+	}
+	if err = v.Validate(cu); err != nil {
+		return fmt.Errorf("invalid admin user: %w", err)
+	}
+
+	tracer := otel.Tracer("")
+	repo := _UserRepo.NewMongoUserRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer)
+	hasher, err := cfg.PasswordHasher()
 	if err != nil {
 		return err
 	}
+	uu := _UserUcase.NewUserUsecase(repo, cfg.Timeouts(), tracer, hasher)
 
-	// change this to something else
-	m, err := migrate.NewWithDatabaseInstance("file://./store/migrations", dbName, instance)
+	_, err = repo.GetByEmail(ctx, cu.Email)
+	switch {
+	case err == nil && !*promote:
+		logger.Info("user already exists, skipping", zap.String("email", cu.Email))
+		return nil
+	case err == nil:
+		if _, err = uu.GrantRole(ctx, cu.Email, auth.RoleAdmin); err != nil {
+			return err
+		}
+		logger.Info("admin role granted", zap.String("email", cu.Email))
+		return nil
+	case !errors.Is(err, domain.ErrNotFound):
+		return err
+	}
+
+	u, err := uu.Create(ctx, cu)
 	if err != nil {
 		return err
 	}
+	if _, err = uu.GrantRole(ctx, cu.Email, auth.RoleAdmin); err != nil {
+		return err
+	}
+	logger.Info("admin user created", zap.String("email", u.Email), zap.String("id", u.ID.Hex()))
+
+	if generated {
+		fmt.Printf("generated password for %s: %s\n", u.Email, *password)
+	}
+
+	return nil
+}
+
+// reencryptLinks encrypts URL links with current encryption key in batches,
+// links encrypted with old keys are rotated and plain links are encrypted.
+// It runs without timeout as it rewrites every URL.
+func reencryptLinks(client *mongo.Client, cfg *cmd.Config, args []string, logger *zap.Logger) error {
+	fs := flag.NewFlagSet("reencrypt_links", flag.ContinueOnError)
+	batch := fs.Int("batch", 500, "number of URLs read at once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return errors.New("batch must be positive")
+	}
+	if !cfg.MongoConfig.Encryption.Enabled() {
+		return errors.New("encryption is not configured")
+	}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+	keys, err := store.NewStaticKeyProvider(cfg.MongoConfig.Encryption)
+	if err != nil {
+		return err
+	}
+	repo := _URLRepo.NewMongoURLRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, otel.Tracer(""))
+	n, err := _URLRepo.ReencryptLinks(context.Background(), repo, store.NewCipher(keys), *batch, logger)
+	if err != nil {
 		return err
 	}
+	logger.Info("links re-encrypted", zap.Int64("rotated", n))
 
 	return nil
 }
 
+// generatePassword creates random password which fits CreateUser validation
+func generatePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can't generate password: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// solveChallenge reads proof-of-work challenge from r and writes nonce solving it to w.
+func solveChallenge(r io.Reader, w io.Writer) error {
+	ch := pow.Challenge{}
+	if err := json.NewDecoder(r).Decode(&ch); err != nil {
+		return fmt.Errorf("can't decode challenge: %w", err)
+	}
+	if ch.ID == "" || ch.Difficulty <= 0 || ch.Difficulty > pow.MaxDifficulty {
+		return fmt.Errorf("challenge must have id and difficulty between 1 and %d", pow.MaxDifficulty)
+	}
+
+	_, err := fmt.Fprintln(w, pow.Solve(ch))
+	return err
+}
+
 // keygen creates an x509 private key for signing auth tokens.
 func keygen(path string, logger *zap.Logger) error {
 	if path == "" {
@@ -3,16 +3,22 @@ package main
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 	"go.opentelemetry.io/otel"
 
@@ -24,11 +30,49 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc"
 
+	_AliasHttpDelivery "github.com/semka95/shortener/backend/alias/delivery/http"
+	_AliasRepo "github.com/semka95/shortener/backend/alias/repository"
+	_AliasUcase "github.com/semka95/shortener/backend/alias/usecase"
+	_APIKeyHttpDelivery "github.com/semka95/shortener/backend/apikey/delivery/http"
+	_APIKeyRepo "github.com/semka95/shortener/backend/apikey/repository"
+	_APIKeyUcase "github.com/semka95/shortener/backend/apikey/usecase"
+	_AuditRepo "github.com/semka95/shortener/backend/audit/repository"
+	_BackupHttpDelivery "github.com/semka95/shortener/backend/backup/delivery/http"
+	_BackupUcase "github.com/semka95/shortener/backend/backup/usecase"
+	_BlocklistHttpDelivery "github.com/semka95/shortener/backend/blocklist/delivery/http"
+	_BlocklistRepo "github.com/semka95/shortener/backend/blocklist/repository"
+	_BlocklistUcase "github.com/semka95/shortener/backend/blocklist/usecase"
+	"github.com/semka95/shortener/backend/buildinfo"
+	_ClickHttpDelivery "github.com/semka95/shortener/backend/click/delivery/http"
+	_ClickRepo "github.com/semka95/shortener/backend/click/repository"
+	_ClickUcase "github.com/semka95/shortener/backend/click/usecase"
 	"github.com/semka95/shortener/backend/cmd"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/event"
+	_ExportHttpDelivery "github.com/semka95/shortener/backend/export/delivery/http"
+	_ExportUcase "github.com/semka95/shortener/backend/export/usecase"
+	"github.com/semka95/shortener/backend/featureflag"
+	"github.com/semka95/shortener/backend/httpclient"
+	"github.com/semka95/shortener/backend/limit"
+	"github.com/semka95/shortener/backend/lock"
+	_MaintenanceHttpDelivery "github.com/semka95/shortener/backend/maintenance/delivery/http"
+	_MaintenanceUcase "github.com/semka95/shortener/backend/maintenance/usecase"
 	"github.com/semka95/shortener/backend/metrics"
 	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/notifier"
+	"github.com/semka95/shortener/backend/pow"
+	_ReportHttpDelivery "github.com/semka95/shortener/backend/report/delivery/http"
+	_ReportRepo "github.com/semka95/shortener/backend/report/repository"
+	_ReportUcase "github.com/semka95/shortener/backend/report/usecase"
+	_ShareHttpDelivery "github.com/semka95/shortener/backend/share/delivery/http"
+	_ShareRepo "github.com/semka95/shortener/backend/share/repository"
+	_ShareUcase "github.com/semka95/shortener/backend/share/usecase"
+	_ShortDomainHttpDelivery "github.com/semka95/shortener/backend/shortdomain/delivery/http"
+	_ShortDomainRepo "github.com/semka95/shortener/backend/shortdomain/repository"
+	_ShortDomainUcase "github.com/semka95/shortener/backend/shortdomain/usecase"
 	"github.com/semka95/shortener/backend/store"
 	_URLHttpDelivery "github.com/semka95/shortener/backend/url/delivery/http"
 	_URLRepo "github.com/semka95/shortener/backend/url/repository"
@@ -38,8 +82,11 @@ import (
 	_UserUcase "github.com/semka95/shortener/backend/user/usecase"
 	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/certs"
 )
 
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
 func main() {
 	// Logging
 	logger, err := zap.NewDevelopment(zap.AddCaller())
@@ -51,6 +98,7 @@ func main() {
 		// do not need to check for errors
 		_ = logger.Sync()
 	}()
+	zap.ReplaceGlobals(logger)
 
 	if err := run(logger); err != nil {
 		logger.Error("shutting down, error: ", zap.Error(err))
@@ -63,17 +111,27 @@ func run(logger *zap.Logger) error {
 	if !ok {
 		return fmt.Errorf("SHORTENER_CONFIG environment variable is not specified")
 	}
+	logger.Info("starting shortener", buildinfo.Get().Fields()...)
 	logger.Info("Config path", zap.String(configPath, configPath))
 	cfg, err := cmd.AppConfig(configPath, logger)
 	if err != nil {
 		return err
 	}
 
+	migrateOnly := flag.Bool("migrate-only", false, "apply database migrations and exit")
+	flag.Parse()
+	if *migrateOnly {
+		return migrateDB(cfg, logger)
+	}
+
 	// Initialize authentication support
 	authenticator, err := createAuth(cfg.Auth.PrivateKeyFile, cfg.Auth.KeyID, cfg.Auth.Algorithm)
 	if err != nil {
 		return err
 	}
+	authenticator.SetTOSVersion(cfg.Server.TOSVersion)
+	// handlers and middlewares read claims from request context
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
 
 	// Initialize context
 	timeoutContext := time.Duration(cfg.Server.Timeout) * time.Second
@@ -95,6 +153,7 @@ func run(logger *zap.Logger) error {
 			// the service name used to display traces in backends
 			semconv.ServiceNameKey.String("shortener-management-api"),
 		),
+		resource.WithAttributes(buildinfo.Get().Attributes()...),
 	)
 	if err != nil {
 		return err
@@ -107,6 +166,7 @@ func run(logger *zap.Logger) error {
 		sdktrace.WithSpanProcessor(bsp),
 	)
 	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(web.Propagator())
 	tracer := otel.Tracer("shortener-tracer")
 	defer func() {
 		if err = tp.Shutdown(ctx); err != nil {
@@ -144,18 +204,54 @@ func run(logger *zap.Logger) error {
 
 	// Echo configure
 	e := echo.New()
+	e.JSONSerializer = web.JSONSerializer{}
+	e.Binder = &web.Binder{}
+	e.HTTPErrorHandler = web.HTTPErrorHandler(e.DefaultHTTPErrorHandler)
+	// client address is read from forwarded headers of trusted proxies only,
+	// rate limits and logs use it
+	trustedProxies, err := _MyMiddleware.ParseCIDRs(cfg.Server.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("can't parse trusted proxies: %w", err)
+	}
+	e.IPExtractor = _MyMiddleware.IPExtractor(trustedProxies)
 	middL := _MyMiddleware.InitMiddleware(logger)
+	// stray slashes of short URLs are dropped, API clients are redirected
+	// to canonical path
+	e.Pre(middL.CanonicalPath("/v1", "/v2", "/api"))
 	e.Pre(middleware.Rewrite(map[string]string{
 		"/api/*": "/$1",
 	}))
-	e.Use(middL.CORS)
+	e.Use(middL.CORS(cfg.Server.CORS))
+	e.Use(middleware.RequestID())
+	e.Use(middL.RequestContext)
 	e.Use(middL.Logger)
 	e.Use(middleware.RecoverWithConfig(middleware.DefaultRecoverConfig))
-	e.Use(otelecho.Middleware("shortener", otelecho.WithTracerProvider(tp)))
+	e.Use(otelecho.Middleware("shortener", otelecho.WithTracerProvider(tp), otelecho.WithPropagators(web.Propagator())))
+	e.Use(middL.TraceID)
+	e.Use(middL.Locale)
+	e.Use(middL.RequestLogger)
 	e.Use(metrics.Middleware(metrics.WithMeterProvider(meterProvider)))
 
+	shedder := _MyMiddleware.NewLoadShedder(cfg.Server.LoadShed)
+	if err = metrics.RegisterInFlight(shedder.InFlight, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register in-flight metrics: %w", err)
+	}
+	e.Use(middL.LoadShed(shedder))
+	// Writes are refused in read-only mode, background workers started with
+	// ctx wait until it is switched off
+	readOnly := domain.NewReadOnlyMode(cfg.Server.ReadOnly.Enabled)
+	ctx = domain.WithReadOnlyMode(ctx, readOnly)
+	e.Use(middL.ReadOnly(readOnly, cfg.Server.ReadOnly))
+	e.Use(middL.Timeout(cfg.Server.RequestTimeout))
+	// requests with bodies routes don't accept are rejected before binding
+	e.Use(middL.ContentType(cmd.ContentTypes()))
+
 	// Create database connection
-	client, err := store.Open(ctx, cfg.MongoConfig, logger)
+	poolStats := store.NewPoolStats()
+	if err = metrics.RegisterPoolStats(poolStats, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register connection pool metrics: %w", err)
+	}
+	client, err := store.Open(ctx, cfg.MongoConfig, logger, options.Client().SetPoolMonitor(poolStats.Monitor()))
 	if err != nil {
 		return err
 	}
@@ -165,6 +261,14 @@ func run(logger *zap.Logger) error {
 		}
 	}()
 
+	if err = store.Migrate(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger); err != nil {
+		return err
+	}
+
+	// Audit mutating requests
+	ar := _AuditRepo.NewMongoAuditRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer)
+	e.Use(middL.Audit(ar))
+
 	// Initialize validator
 	v, err := web.NewAppValidator()
 	if err != nil {
@@ -173,28 +277,331 @@ func run(logger *zap.Logger) error {
 	e.Validator = v
 
 	// Create URL API
-	ur := _URLRepo.NewMongoURLRepository(client, cfg.MongoConfig.Name, logger, tracer)
-	uu := _URLUcase.NewURLUsecase(ur, timeoutContext, tracer, cfg.Server.URLExpiration)
-	uh, err := _URLHttpDelivery.NewURLHandler(uu, authenticator, v, logger, tracer)
+	slow := store.NewSlowOpLogger(time.Duration(cfg.MongoConfig.SlowOpThreshold)*time.Millisecond, logger)
+	breakerTimeout := time.Duration(cfg.MongoConfig.BreakerOpenTimeout) * time.Millisecond
+	userBreaker := store.NewCircuitBreaker("user", cfg.MongoConfig.BreakerThreshold, breakerTimeout, logger)
+	urlBreaker := store.NewCircuitBreaker("url", cfg.MongoConfig.BreakerThreshold, breakerTimeout, logger)
+	if err = metrics.RegisterCircuitBreakers([]*store.CircuitBreaker{userBreaker, urlBreaker}, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register circuit breaker metrics: %w", err)
+	}
+	// writes fail at once while database is unreachable, redirects are
+	// served from cache
+	e.Use(middL.Degraded(urlBreaker, userBreaker))
+	urlCache := store.NewCache("url", time.Duration(cfg.MongoConfig.CacheTTL)*time.Millisecond, time.Duration(cfg.MongoConfig.CacheNegativeTTL)*time.Millisecond, cfg.MongoConfig.CacheSize)
+	urlCache.SetStaleTTL(time.Duration(cfg.MongoConfig.CacheStaleTTL) * time.Millisecond)
+	ownerTTL := time.Duration(cfg.MongoConfig.OwnerCacheTTL) * time.Millisecond
+	ownerCache := store.NewCache("user", ownerTTL, ownerTTL, cfg.MongoConfig.OwnerCacheSize)
+	if err = metrics.RegisterCaches([]*store.Cache{urlCache, ownerCache}, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register cache metrics: %w", err)
+	}
+	redirectReadPref, err := cfg.MongoConfig.RedirectReadPref()
+	if err != nil {
+		return err
+	}
+	var cipher *store.Cipher
+	if cfg.MongoConfig.Encryption.Enabled() {
+		keys, err := store.NewStaticKeyProvider(cfg.MongoConfig.Encryption)
+		if err != nil {
+			return err
+		}
+		cipher = store.NewCipher(keys)
+	}
+	repoMetrics, err := metrics.NewRepositoryMetrics(metrics.WithMeterProvider(meterProvider))
+	if err != nil {
+		return fmt.Errorf("can't create repository metrics: %w", err)
+	}
+	newURLRepo := func(db string) domain.URLRepository {
+		r := _URLRepo.NewMeteredURLRepository(_URLRepo.NewMongoURLRepository(client, db, cfg.MongoConfig.Collections, logger, tracer, _URLRepo.WithReadPreference(domain.ReadRedirect, redirectReadPref)), repoMetrics)
+		if cipher != nil {
+			r = _URLRepo.NewEncryptedURLRepository(r, cipher)
+		}
+		return r
+	}
+
+	// Shadowed collections are verified against the database they are being
+	// migrated to
+	mongoUserRepo := _UserRepo.NewMeteredUserRepository(_UserRepo.NewMongoUserRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer), repoMetrics)
+	mongoURLRepo := newURLRepo(cfg.MongoConfig.Name)
+	var shadows []*store.Shadow
+	newShadow := func(name string) *store.Shadow {
+		sc := cfg.MongoConfig.Shadow[name]
+		if sc.Database == "" {
+			return nil
+		}
+		s := store.NewShadow(name, time.Duration(sc.TimestampTolerance)*time.Millisecond, timeoutContext, sc.QueueSize, logger)
+		go s.Run(ctx)
+		shadows = append(shadows, s)
+		return s
+	}
+	if s := newShadow("user"); s != nil {
+		mongoUserRepo = _UserRepo.NewShadowUserRepository(mongoUserRepo, _UserRepo.NewMeteredUserRepository(_UserRepo.NewMongoUserRepository(client, cfg.MongoConfig.Shadow["user"].Database, cfg.MongoConfig.Collections, logger, tracer), repoMetrics), s)
+	}
+	if s := newShadow("url"); s != nil {
+		mongoURLRepo = _URLRepo.NewShadowURLRepository(mongoURLRepo, newURLRepo(cfg.MongoConfig.Shadow["url"].Database), s)
+	}
+	if err = metrics.RegisterShadows(shadows, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register shadow metrics: %w", err)
+	}
+
+	usr := _UserRepo.NewCachedUserRepository(_UserRepo.NewBreakerUserRepository(_UserRepo.NewSlowUserRepository(mongoUserRepo, slow), userBreaker), ownerCache)
+	ur := _URLRepo.NewCachedURLRepository(_URLRepo.NewBreakerURLRepository(_URLRepo.NewSlowURLRepository(mongoURLRepo, slow), urlBreaker), urlCache)
+	if cfg.MongoConfig.BloomCapacity > 0 {
+		urlFilter := store.NewExistenceFilter("url", cfg.MongoConfig.BloomCapacity, cfg.MongoConfig.BloomFalsePositiveRate)
+		if err = metrics.RegisterExistenceFilters([]*store.ExistenceFilter{urlFilter}, metrics.WithMeterProvider(meterProvider)); err != nil {
+			return fmt.Errorf("can't register existence filter metrics: %w", err)
+		}
+		// every id may exist until ids are loaded
+		go store.RunRebuild(ctx, urlFilter, ur.ScanIDs, time.Duration(cfg.MongoConfig.BloomRebuild)*time.Second, logger)
+		ur = _URLRepo.NewBloomURLRepository(ur, urlFilter)
+	}
+
+	// Blocked domains are loaded before serving, new rules are picked up and
+	// applied to existing URLs in background
+	bu := _BlocklistUcase.NewBlocklistUsecase(_BlocklistRepo.NewMongoBlocklistRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer), ur, ar, timeoutContext, tracer)
+	if err = bu.Refresh(ctx); err != nil {
+		return fmt.Errorf("can't load blocklist: %w", err)
+	}
+	go _BlocklistUcase.RunRefresh(ctx, bu, time.Duration(cfg.Server.BlocklistRefresh)*time.Second, logger)
+
+	// Clicks are recorded on redirects and stored in background
+	cfg.Server.Clicks.Analytics, err = domain.ParseAnalytics(cfg.Server.Clicks.Analytics)
+	if err != nil {
+		return fmt.Errorf("invalid server clicks: %w", err)
+	}
+	if _, err = domain.ParseIPPolicy(cfg.Server.Clicks.IPPolicy); err != nil {
+		return fmt.Errorf("invalid server clicks: %w", err)
+	}
+	// Background jobs running on one instance at a time hold shared locks
+	locker := lock.NewMongoLocker(client.Database(cfg.MongoConfig.Name), cfg.MongoConfig.Collections)
+	// Rate limits and used challenges are shared by all instances
+	limits := limit.NewMongoLimitStore(client.Database(cfg.MongoConfig.Name), cfg.MongoConfig.Collections)
+	clickRepo := _ClickRepo.NewMongoClickRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer)
+	clickWriter := _ClickUcase.NewClickWriter(clickRepo, timeoutContext, logger, cfg.Server.Clicks)
+	if err = metrics.RegisterClickWriter(clickWriter.Stats, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register click writer metrics: %w", err)
+	}
+	if err = metrics.RegisterClickRollups(clickWriter.RollupStats, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register click rollup metrics: %w", err)
+	}
+	cu := _ClickUcase.NewClickUsecase(clickRepo, ur, clickWriter, timeoutContext, tracer, logger, cfg.Server.Clicks)
+	// clicks are stored until server is shut down, queued clicks are stored
+	// before exit
+	clicksCtx, stopClicks := context.WithCancel(ctx)
+	defer stopClicks()
+	clicksDone := make(chan struct{})
+	go func() {
+		defer close(clicksDone)
+		cu.Run(clicksCtx)
+	}()
+	rollups := _ClickUcase.NewRollupReconciler(clickRepo, locker, timeoutContext, tracer, logger, cfg.Server.ClickRollup)
+	go rollups.Run(ctx)
+	retention := _ClickUcase.NewClickRetention(clickRepo, usr, locker, timeoutContext, tracer, logger, cfg.Server.ClickRetention)
+	go retention.Run(ctx)
+
+	// Popular URLs are cached before serving, so redirects after deploy
+	// don't all reach the database
+	warmed := _URLUcase.WarmCache(ctx, ur, clickRepo, cfg.MongoConfig.CacheWarmupSize, time.Duration(cfg.MongoConfig.CacheWarmupBudget)*time.Millisecond, logger)
+	if err = metrics.RegisterCacheWarmup(urlCache.Name(), int64(warmed), metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register cache warmup metrics: %w", err)
+	}
+
+	// Generated ids are checked in background when pool is enabled
+	var idPool *_URLUcase.IDPool
+	if cfg.Server.IDPoolSize > 0 {
+		idPool = _URLUcase.NewIDPool(ur, cfg.Server.IDPoolSize, timeoutContext, logger)
+		go idPool.Run(ctx)
+	}
+
+	// Flags file is watched, so features are rolled out without restart
+	var flags featureflag.Flags = featureflag.NewStatic(cfg.Server.FeatureFlags.Flags)
+	if cfg.Server.FeatureFlags.File != "" {
+		f, err := featureflag.NewFile(cfg.Server.FeatureFlags.File, logger)
+		if err != nil {
+			return err
+		}
+		interval := cfg.Server.FeatureFlags.WatchInterval
+		if interval <= 0 {
+			interval = featureflag.DefaultWatchInterval
+		}
+		go f.Watch(ctx, time.Duration(interval)*time.Second)
+		flags = f
+	}
+
+	reportRepo := _ReportRepo.NewMongoReportRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer)
+	// former short codes of renamed URLs keep redirecting and can't be taken
+	aliasRepo := _AliasRepo.NewMongoAliasRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer)
+	uu := _URLUcase.NewURLUsecase(ur, usr, cfg.Timeouts(), tracer, cfg.Server.URLExpiration, cfg.Server.Links, bu, idPool, flags, aliasRepo)
+	// links that look like spam are flagged for admin review or rejected
+	spamFilter, err := _URLUcase.NewSpamFilter(uu, reportRepo, cfg.Server.Spam)
+	if err != nil {
+		return fmt.Errorf("invalid server spam: %w", err)
+	}
+	// URLs may be created on short domains admins allowed at runtime
+	du := _ShortDomainUcase.NewShortDomainUsecase(_ShortDomainRepo.NewMongoShortDomainRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer), timeoutContext, tracer)
+	uh, err := _URLHttpDelivery.NewURLHandler(_URLUcase.NewShortDomains(spamFilter, du), cu, authenticator, v, logger, tracer)
 	if err != nil {
 		return fmt.Errorf("url handler creation failed: %w", err)
 	}
+	if cfg.Server.BaseURL != "" {
+		links, err := domain.NewShortLinks(cfg.Server.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid server base_url: %w", err)
+		}
+		uh.SetShortLinks(links)
+	}
+	uh.SetAnonymousCreation(!cfg.Server.DisableAnonymousCreate)
+	uh.SetCreateRateLimit(cfg.Server.CreateRateLimit, limits)
+	if cfg.Server.ProofOfWork.Difficulty > 0 {
+		challenges, err := pow.New(cfg.Server.ProofOfWork, limits)
+		if err != nil {
+			return fmt.Errorf("invalid server proof_of_work: %w", err)
+		}
+		uh.SetProofOfWork(challenges)
+	}
+	uh.SetCreatorIPAnonymization(cfg.Server.AnonymizeCreatorIP)
+	uh.SetFeatureFlags(flags)
+	redirectMetrics, err := metrics.NewRedirectMetrics(metrics.WithMeterProvider(meterProvider))
+	if err != nil {
+		return fmt.Errorf("can't create redirect metrics: %w", err)
+	}
+	uh.SetRedirectMetrics(redirectMetrics)
+	au := _AliasUcase.NewAliasUsecase(aliasRepo, ur, timeoutContext, tracer)
+	uh.SetAliases(au)
+
+	// Outbound requests share connections
+	clients := httpclient.NewFactory(cfg.Server.HTTPClient, tracer)
+
+	// Expired URLs are announced once, through webhook when it is configured
+	publisher := event.NewLogPublisher(logger)
+	if cfg.Server.Webhook.URL != "" {
+		publisher = event.NewWebhookDispatcher(cfg.Server.Webhook, clients)
+	}
+	expirations := _URLUcase.NewExpirationNotifier(ur, clickRepo, publisher, timeoutContext, logger, cfg.Server.Expiration)
+	go expirations.Run(ctx)
+	uh.SetExpirationNotifier(expirations)
+
+	// Counts of URLs alerting is based on are exported as gauges
+	snapshots := _URLUcase.NewLinkSnapshots(_URLRepo.NewMongoLinkSnapshotRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, tracer), locker, timeoutContext, logger, cfg.Server.LinkSnapshot)
+	if err = metrics.RegisterLinkSnapshot(snapshots.Last, metrics.WithMeterProvider(meterProvider)); err != nil {
+		return fmt.Errorf("can't register link snapshot metrics: %w", err)
+	}
+	go snapshots.Run(ctx)
+
+	apiKeyRepo := _APIKeyRepo.NewMongoAPIKeyRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer)
+	ku := _APIKeyUcase.NewAPIKeyUsecase(apiKeyRepo, usr, timeoutContext, tracer, cfg.Auth.OmitAPIKeyProfile)
+	uh.SetAPIKeyAuthenticator(ku)
 	uh.RegisterRoutes(e)
+	v2 := e.Group("/v2")
+	uh.RegisterAPIRoutes(v2)
+	ch, err := _ClickHttpDelivery.NewClickHandler(cu, authenticator, v, logger, tracer)
+	if err != nil {
+		return fmt.Errorf("click handler creation failed: %w", err)
+	}
+	ch.RegisterRoutes(e)
+	ch.RegisterAPIRoutes(v2)
+	// server doesn't wait for click streams to end, they are ended when it
+	// starts shutting down
+	e.Server.RegisterOnShutdown(ch.Shutdown)
+	e.TLSServer.RegisterOnShutdown(ch.Shutdown)
+	su := _ShareUcase.NewShareUsecase(_ShareRepo.NewMongoShareRepository(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger, tracer), ur, clickRepo, timeoutContext, tracer, cfg.Server.Clicks.Analytics)
+	sh := _ShareHttpDelivery.NewShareHandler(su, authenticator, v, logger, tracer, cfg.Server.Share)
+	sh.RegisterRoutes(e)
+	sh.RegisterAPIRoutes(v2)
+	ah := _AliasHttpDelivery.NewAliasHandler(au, authenticator, v, logger, tracer)
+	ah.RegisterRoutes(e)
+	ah.RegisterAPIRoutes(v2)
+	// aliases without redirects are shown to owners as cleanup candidates
+	go _AliasUcase.NewAliasCleanup(aliasRepo, locker, timeoutContext, tracer, logger, cfg.Server.AliasCleanup).Run(ctx)
+	eh := _ExportHttpDelivery.NewExportHandler(_ExportUcase.NewExportUsecase(ur, timeoutContext, tracer), authenticator, v, logger, tracer)
+	eh.RegisterRoutes(e)
+	eh.RegisterAPIRoutes(v2)
 
 	// Create User API
-	usr := _UserRepo.NewMongoUserRepository(client, cfg.MongoConfig.Name, logger, tracer)
-	usu := _UserUcase.NewUserUsecase(usr, timeoutContext, tracer)
+	hasher, err := cfg.PasswordHasher()
+	if err != nil {
+		return err
+	}
+	var usu domain.UserUsecase = _UserUcase.NewClickRetentionSettings(_UserUcase.NewLoginThrottle(_UserUcase.NewUserUsecase(usr, cfg.Timeouts(), tracer, hasher), cfg.Auth.LoginThrottle, limits), retention)
+	if cfg.Server.TOSVersion != "" {
+		usu = _UserUcase.NewTermsOfService(usu, cfg.Server.TOSVersion)
+	}
 	ush := _UserHttpDelivery.NewUserHandler(usu, authenticator, v, logger, tracer)
+
+	// Accounts deleted by their users are restorable during grace period,
+	// they are deleted in background when it is over
+	emails, err := notifier.New(cfg.Server.Email, logger)
+	if err != nil {
+		return fmt.Errorf("email notifier creation failed: %w", err)
+	}
+	go emails.Run(ctx)
+	deletionCfg := cfg.Server.AccountDeletion
+	if deletionCfg.CancelURL == "" {
+		deletionCfg.CancelURL = strings.TrimSuffix(cfg.Server.BaseURL, "/") + "/account/restore"
+	}
+	deletion := _UserUcase.NewAccountDeletion(usr, apiKeyRepo, ur, emails, authenticator, timeoutContext, tracer, logger, deletionCfg)
+	go deletion.Run(ctx)
+	ush.SetAccountDeletion(deletion)
 	ush.RegisterRoutes(e)
+	ush.RegisterAPIRoutes(v2)
+	kh := _APIKeyHttpDelivery.NewAPIKeyHandler(ku, authenticator, v, logger, tracer)
+	kh.RegisterRoutes(e)
+	kh.RegisterAPIRoutes(v2)
 
-	// Status check
-	store.NewStatusHandler(e, client.Database(cfg.MongoConfig.Name))
+	// Admin API
+	bh, err := _BlocklistHttpDelivery.NewBlocklistHandler(bu, authenticator, v, logger, tracer)
+	if err != nil {
+		return fmt.Errorf("blocklist handler creation failed: %w", err)
+	}
+	dh := _ShortDomainHttpDelivery.NewShortDomainHandler(du, authenticator, v, logger, tracer)
+	mu := _MaintenanceUcase.NewMaintenanceUsecase(ur, locker, readOnly, timeoutContext, tracer, logger, cfg.Server.Purge)
+	mh := _MaintenanceHttpDelivery.NewMaintenanceHandler(mu, authenticator, logger, tracer)
+	// Abuse reports are made by anyone and resolved by admins with blocklist
+	// and account actions
+	ru := _ReportUcase.NewReportUsecase(reportRepo, ur, bu, usu, ar, timeoutContext, tracer)
+	// Reported URLs admins don't review in time are disabled until the
+	// report is resolved
+	escalation := _ReportUcase.NewReportEscalation(reportRepo, ur, usr, ar, emails, locker, timeoutContext, tracer, logger, cfg.Server.ReportEscalation)
+	go escalation.Run(ctx)
+	rh := _ReportHttpDelivery.NewReportHandler(ru, authenticator, v, logger, tracer, cfg.Server.Reports)
+	rh.RegisterRoutes(e)
+	rh.RegisterAPIRoutes(v2)
+	// Account backups are restored in transactions, so restore requires
+	// replica set
+	backupH := _BackupHttpDelivery.NewBackupHandler(_BackupUcase.NewBackupUsecase(usr, ur, clickRepo, store.NewTransactor(client), timeoutContext, tracer), authenticator, v, logger, tracer)
+	for _, prefix := range []string{"/v1/admin", "/v2/admin"} {
+		admin, err := adminGroup(e, middL, cfg, prefix)
+		if err != nil {
+			return err
+		}
+		ush.RegisterAdminRoutes(admin)
+		kh.RegisterAdminRoutes(admin)
+		uh.RegisterAdminRoutes(admin)
+		bh.RegisterAdminRoutes(admin)
+		dh.RegisterAdminRoutes(admin)
+		mh.RegisterAdminRoutes(admin)
+		rh.RegisterAdminRoutes(admin)
+		backupH.RegisterAdminRoutes(admin)
+	}
 
-	go func() {
-		if err := e.Start(cfg.Server.Address); err != nil {
-			logger.Error("can't start server: ", zap.Error(err))
+	// Token introspection for internal services
+	if len(cfg.Server.IntrospectAllowlist) > 0 {
+		introspect, err := allowlistGroup(e, middL, cfg, "/v1/auth", "introspect", cfg.Server.IntrospectAllowlist)
+		if err != nil {
+			return err
 		}
-	}()
+		ush.RegisterIntrospectRoutes(introspect)
+	}
+
+	// Status check
+	store.NewStatusHandler(e, map[string]domain.HealthChecker{
+		"url":  ur,
+		"user": usr,
+	})
+	buildinfo.NewVersionHandler(e)
+
+	if err = startServer(ctx, e, cfg, logger); err != nil {
+		return err
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -205,10 +612,115 @@ func run(logger *zap.Logger) error {
 	if err := e.Shutdown(shutdownCtx); err != nil {
 		return fmt.Errorf("can't shutdownn server: %w", err)
 	}
+	stopClicks()
+	<-clicksDone
+
+	return nil
+}
+
+// migrateDB applies database migrations without starting the server
+func migrateDB(cfg *cmd.Config, logger *zap.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.Timeout)*time.Second)
+	defer cancel()
+
+	client, err := store.Open(ctx, cfg.MongoConfig, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err = client.Disconnect(ctx); err != nil {
+			logger.Error("mongodb client disconnect error: ", zap.Error(err))
+		}
+	}()
+
+	return store.Migrate(client, cfg.MongoConfig.Name, cfg.MongoConfig.Collections, logger)
+}
+
+// startServer starts plain HTTP server or, when configured, HTTPS server with
+// certificate files or certificates obtained via ACME
+func startServer(ctx context.Context, e *echo.Echo, cfg *cmd.Config, logger *zap.Logger) error {
+	serve := func(start func() error) {
+		go func() {
+			if err := start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("can't start server: ", zap.Error(err))
+			}
+		}()
+	}
+
+	if !cfg.TLSEnabled() {
+		serve(func() error { return e.Start(cfg.Server.Address) })
+		return nil
+	}
+
+	tlsCfg := cfg.Server.TLS
+	if tlsCfg.RedirectHTTPS {
+		e.Pre(middleware.HTTPSRedirectWithConfig(middleware.RedirectConfig{
+			Skipper: func(c echo.Context) bool {
+				return strings.HasPrefix(c.Request().URL.Path, acmeChallengePath)
+			},
+		}))
+	}
+
+	if tlsCfg.Autocert {
+		if len(tlsCfg.Domains) == 0 {
+			return errors.New("autocert requires at least one domain")
+		}
+		e.AutoTLSManager.Prompt = autocert.AcceptTOS
+		e.AutoTLSManager.HostPolicy = autocert.HostWhitelist(tlsCfg.Domains...)
+		e.AutoTLSManager.Cache = autocert.DirCache(tlsCfg.CacheDir)
+		e.GET(acmeChallengePath+"*", echo.WrapHandler(e.AutoTLSManager.HTTPHandler(nil)))
+	}
+
+	if tlsCfg.HTTPAddress != "" {
+		serve(func() error { return e.Start(tlsCfg.HTTPAddress) })
+	}
+
+	if tlsCfg.Autocert {
+		serve(func() error { return e.StartAutoTLS(cfg.Server.Address) })
+		return nil
+	}
+
+	reloader, err := certs.NewReloader(tlsCfg.CertFile, tlsCfg.KeyFile, logger)
+	if err != nil {
+		return err
+	}
+	go reloader.Watch(ctx, time.Minute)
+
+	e.TLSServer.Addr = cfg.Server.Address
+	e.TLSServer.TLSConfig = &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	serve(func() error { return e.StartServer(e.TLSServer) })
 
 	return nil
 }
 
+// adminGroup creates group for admin routes, restricted to configured networks
+// when admin allowlist is set
+func adminGroup(e *echo.Echo, middL *_MyMiddleware.GoMiddleware, cfg *cmd.Config, prefix string) (*echo.Group, error) {
+	if len(cfg.Server.AdminAllowlist) == 0 {
+		return e.Group(prefix), nil
+	}
+
+	return allowlistGroup(e, middL, cfg, prefix, "admin", cfg.Server.AdminAllowlist)
+}
+
+// allowlistGroup creates group of routes reachable only from allowlist
+// networks
+func allowlistGroup(e *echo.Echo, middL *_MyMiddleware.GoMiddleware, cfg *cmd.Config, prefix, name string, allowlist []string) (*echo.Group, error) {
+	allowed, err := _MyMiddleware.ParseCIDRs(allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %s allowlist: %w", name, err)
+	}
+	trusted, err := _MyMiddleware.ParseCIDRs(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse trusted proxies: %w", err)
+	}
+
+	return e.Group(prefix, middL.IPAllowlist(allowed, trusted)), nil
+}
+
 func createAuth(privateKeyFile, keyID, algorithm string) (*auth.Authenticator, error) {
 	keyContents, err := os.ReadFile(privateKeyFile)
 	if err != nil {
@@ -3,25 +3,99 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
+	_AliasUcase "github.com/semka95/shortener/backend/alias/usecase"
+	_ClickUcase "github.com/semka95/shortener/backend/click/usecase"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/event"
+	"github.com/semka95/shortener/backend/featureflag"
+	"github.com/semka95/shortener/backend/httpclient"
+	_MaintenanceUcase "github.com/semka95/shortener/backend/maintenance/usecase"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/notifier"
+	"github.com/semka95/shortener/backend/pow"
+	"github.com/semka95/shortener/backend/pwhash"
+	_ReportHttpDelivery "github.com/semka95/shortener/backend/report/delivery/http"
+	_ReportUcase "github.com/semka95/shortener/backend/report/usecase"
+	_ShareHttpDelivery "github.com/semka95/shortener/backend/share/delivery/http"
 	"github.com/semka95/shortener/backend/store"
+	_URLHttpDelivery "github.com/semka95/shortener/backend/url/delivery/http"
+	_URLUcase "github.com/semka95/shortener/backend/url/usecase"
+	_UserUcase "github.com/semka95/shortener/backend/user/usecase"
 )
 
 // Config stores app configuration
 type Config struct {
 	Server struct {
-		Address       string `yaml:"address"`
-		Timeout       int    `yaml:"timeout"`
-		OtlpAddress   string `yaml:"otlp_address"`
-		URLExpiration int    `yaml:"url_expiration_years"`
+		Address string `yaml:"address"`
+		Timeout int    `yaml:"timeout"`
+		// OperationTimeouts overrides Timeout for classes of URL and user
+		// operations
+		OperationTimeouts struct {
+			Read  int `yaml:"read_ms"`
+			Write int `yaml:"write_ms"`
+			Scan  int `yaml:"scan_ms"`
+		} `yaml:"operation_timeouts"`
+		OtlpAddress            string               `yaml:"otlp_address"`
+		BaseURL                string               `yaml:"base_url"`
+		URLExpiration          int                  `yaml:"url_expiration_years"`
+		DisableAnonymousCreate bool                 `yaml:"disable_anonymous_create"`
+		IDPoolSize             int                  `yaml:"id_pool_size"`
+		AnonymizeCreatorIP     bool                 `yaml:"anonymize_creator_ip"`
+		Links                  _URLUcase.LinkConfig `yaml:",inline"`
+		TLS                    struct {
+			CertFile      string   `yaml:"cert_file"`
+			KeyFile       string   `yaml:"key_file"`
+			Autocert      bool     `yaml:"autocert"`
+			Domains       []string `yaml:"domains"`
+			CacheDir      string   `yaml:"cache_dir"`
+			HTTPAddress   string   `yaml:"http_address"`
+			RedirectHTTPS bool     `yaml:"redirect_https"`
+		} `yaml:"tls"`
+		AdminAllowlist []string `yaml:"admin_allowlist"`
+		// IntrospectAllowlist lists networks of internal services allowed to
+		// introspect tokens, introspection is disabled when it is empty
+		IntrospectAllowlist []string                     `yaml:"introspect_allowlist"`
+		TrustedProxies      []string                     `yaml:"trusted_proxies"`
+		CORS                _MyMiddleware.CORSConfig     `yaml:"cors"`
+		LoadShed            _MyMiddleware.LoadShedConfig `yaml:"load_shed"`
+		RequestTimeout      _MyMiddleware.TimeoutConfig  `yaml:"request_timeout"`
+		ReadOnly            _MyMiddleware.ReadOnlyConfig `yaml:"read_only"`
+		// BlocklistRefresh is the interval of blocklist reload in seconds
+		BlocklistRefresh int                                    `yaml:"blocklist_refresh_seconds"`
+		Clicks           _ClickUcase.Config                     `yaml:"clicks"`
+		ClickRollup      _ClickUcase.RollupConfig               `yaml:"click_rollup"`
+		ClickRetention   _ClickUcase.RetentionConfig            `yaml:"click_retention"`
+		CreateRateLimit  _URLHttpDelivery.CreateRateLimitConfig `yaml:"create_rate_limit"`
+		Share            _ShareHttpDelivery.Config              `yaml:"share"`
+		Reports          _ReportHttpDelivery.Config             `yaml:"reports"`
+		ReportEscalation _ReportUcase.EscalationConfig          `yaml:"report_escalation"`
+		Spam             _URLUcase.SpamConfig                   `yaml:"spam"`
+		ProofOfWork      pow.Config                             `yaml:"proof_of_work"`
+		Purge            _MaintenanceUcase.Config               `yaml:"purge"`
+		Expiration       _URLUcase.ExpirationConfig             `yaml:"expiration"`
+		LinkSnapshot     _URLUcase.SnapshotConfig               `yaml:"link_snapshot"`
+		HTTPClient       httpclient.Config                      `yaml:"http_client"`
+		Webhook          event.WebhookConfig                    `yaml:"webhook"`
+		Email            notifier.Config                        `yaml:"email"`
+		AccountDeletion  _UserUcase.DeletionConfig              `yaml:"account_deletion"`
+		AliasCleanup     _AliasUcase.CleanupConfig              `yaml:"alias_cleanup"`
+		// TOSVersion is the version of terms of service users must accept,
+		// empty disables terms of service
+		TOSVersion   string               `yaml:"tos_version"`
+		FeatureFlags featureflag.Settings `yaml:"feature_flags"`
 	} `yaml:"server"`
 	Auth struct {
-		KeyID          string `yaml:"key_id"`
-		PrivateKeyFile string `yaml:"private_key_file"`
-		Algorithm      string `yaml:"algorithm"`
+		KeyID             string                    `yaml:"key_id"`
+		PrivateKeyFile    string                    `yaml:"private_key_file"`
+		Algorithm         string                    `yaml:"algorithm"`
+		OmitAPIKeyProfile bool                      `yaml:"omit_api_key_profile"`
+		PasswordHashing   pwhash.Config             `yaml:"password_hashing"`
+		LoginThrottle     _UserUcase.ThrottleConfig `yaml:"login_throttle"`
 	} `yaml:"auth"`
 	store.MongoConfig `yaml:"mongo"`
 }
@@ -47,3 +121,34 @@ func AppConfig(cfgPath string, logger *zap.Logger) (*Config, error) {
 	}
 	return cfg, nil
 }
+
+// TLSEnabled reports whether server should listen with TLS
+func (c *Config) TLSEnabled() bool {
+	return c.Server.TLS.Autocert || c.Server.TLS.CertFile != ""
+}
+
+// PasswordHasher returns hasher of configured password hashing scheme
+func (c *Config) PasswordHasher() (*pwhash.Hasher, error) {
+	h, err := pwhash.New(c.Auth.PasswordHashing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth password_hashing: %w", err)
+	}
+	return h, nil
+}
+
+// Timeouts returns time budgets of URL and user operations, classes without
+// budget get the server timeout
+func (c *Config) Timeouts() domain.Timeouts {
+	budget := func(ms int) time.Duration {
+		if ms <= 0 {
+			return time.Duration(c.Server.Timeout) * time.Second
+		}
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	return domain.Timeouts{
+		Read:  budget(c.Server.OperationTimeouts.Read),
+		Write: budget(c.Server.OperationTimeouts.Write),
+		Scan:  budget(c.Server.OperationTimeouts.Scan),
+	}
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/labstack/echo/v4"
+
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/web"
+)
+
+// ContentTypes returns media types accepted in request bodies of API routes.
+// API bodies are JSON, except for archives of account restore and forms of
+// token introspection.
+func ContentTypes() _MyMiddleware.ContentTypeConfig {
+	return _MyMiddleware.ContentTypeConfig{
+		Groups: map[string][]string{
+			"/v1": {echo.MIMEApplicationJSON},
+			"/v2": {echo.MIMEApplicationJSON},
+			// archives are made by GET /admin/users/:id/backup
+			"/v1/admin/users/:id/restore": {web.MIMEApplicationNDJSON},
+			"/v2/admin/users/:id/restore": {web.MIMEApplicationNDJSON},
+			// RFC 7662 clients send form
+			"/v1/auth/introspect": {echo.MIMEApplicationForm, echo.MIMEApplicationJSON},
+		},
+	}
+}
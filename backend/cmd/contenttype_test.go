@@ -0,0 +1,78 @@
+package cmd_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	backupHttp "github.com/semka95/shortener/backend/backup/delivery/http"
+	"github.com/semka95/shortener/backend/backup/mock"
+	"github.com/semka95/shortener/backend/cmd"
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestContentTypes(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e7f", []string{auth.RoleAdmin}, time.Now(), time.Hour))
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockBackupUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	e.Use(_MyMiddleware.InitMiddleware(zap.NewNop()).ContentType(cmd.ContentTypes()))
+	h := backupHttp.NewBackupHandler(uc, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	h.RegisterAdminRoutes(e.Group("/v1/admin"))
+	h.RegisterAdminRoutes(e.Group("/v2/admin"))
+	e.PUT("/v1/admin/users/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(method, target, contentType string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"collection":"backup","document":{"version":1}}`+"\n"))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	const userID = "507f191e810c19729de860ea"
+	for _, version := range []string{"v1", "v2"} {
+		t.Run("restore archive "+version, func(t *testing.T) {
+			uc.EXPECT().Restore(gomock.Any(), userID, domain.Restore{}, gomock.Any()).Return(&domain.RestoreSummary{}, nil)
+
+			assert.Equal(t, http.StatusOK, serve(echo.POST, "/"+version+"/admin/users/"+userID+"/restore", web.MIMEApplicationNDJSON))
+			assert.Equal(t, http.StatusUnsupportedMediaType, serve(echo.POST, "/"+version+"/admin/users/"+userID+"/restore", echo.MIMEApplicationJSON))
+		})
+	}
+
+	t.Run("other admin routes are json", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(echo.PUT, "/v1/admin/users/"+userID, echo.MIMEApplicationJSON))
+		assert.Equal(t, http.StatusUnsupportedMediaType, serve(echo.PUT, "/v1/admin/users/"+userID, web.MIMEApplicationNDJSON))
+	})
+}
@@ -0,0 +1,57 @@
+// Command smoketest verifies deployed service end to end, it exits with non
+// zero status when any step fails:
+//
+//	smoketest -url https://sho.rt -email admin@example.com -password secret -json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/semka95/shortener/backend/smoketest"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	cfg := smoketest.Config{}
+	flag.StringVar(&cfg.BaseURL, "url", os.Getenv("BASE_URL"), "base URL of the service")
+	flag.StringVar(&cfg.Email, "email", os.Getenv("ADMIN_EMAIL"), "admin email")
+	flag.StringVar(&cfg.Password, "password", os.Getenv("ADMIN_PASSWORD"), "admin password")
+	flag.StringVar(&cfg.Token, "token", os.Getenv("ADMIN_TOKEN"), "admin token, used instead of email and password")
+	flag.StringVar(&cfg.Link, "link", smoketest.DefaultLink, "link of created URL")
+	flag.DurationVar(&cfg.Timeout, "timeout", smoketest.DefaultTimeout, "timeout of every request")
+	asJSON := flag.Bool("json", false, "write report as JSON")
+	flag.Parse()
+
+	if cfg.BaseURL == "" {
+		fmt.Fprintln(os.Stderr, "base URL must be set with -url flag or BASE_URL environment variable")
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	report := smoketest.Run(ctx, cfg)
+
+	var err error
+	if *asJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "can't write report:", err)
+		return 1
+	}
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
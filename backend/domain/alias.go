@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Alias represents former short code of renamed URL, it keeps redirecting to
+// the URL until owner retires it
+type Alias struct {
+	ID        string    `json:"alias" bson:"_id"`
+	URLID     string    `json:"url_id" bson:"url_id"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// Redirects is the number of redirects made through the alias
+	Redirects      int64      `json:"redirects" bson:"redirects"`
+	LastRedirectAt *time.Time `json:"last_redirect_at,omitempty" bson:"last_redirect_at,omitempty"`
+	// Stale is set by alias cleanup when alias had no redirects for
+	// configured days, owner is offered to retire it. Next redirect clears
+	// it.
+	Stale bool `json:"cleanup_candidate" bson:"stale,omitempty"`
+}
+
+// AliasUsecase represents the alias's usecases
+type AliasUsecase interface {
+	// Fetch lists aliases of URL, user must own the URL or be admin
+	Fetch(ctx context.Context, urlID string, user *auth.Claims) ([]*Alias, error)
+	// Delete retires alias of URL, so it doesn't redirect anymore, user must
+	// own the URL or be admin
+	Delete(ctx context.Context, urlID, id string, user *auth.Claims) error
+	// Resolve returns id of URL alias redirects to and counts the redirect,
+	// ErrNotFound is returned when id is not an alias
+	Resolve(ctx context.Context, id string) (string, error)
+}
+
+// AliasRepository represents the alias's repository contract
+type AliasRepository interface {
+	// Store stores alias, ErrConflict is returned when alias exists
+	Store(ctx context.Context, alias *Alias) error
+	GetByID(ctx context.Context, id string) (*Alias, error)
+	// FetchByURL lists aliases of URL in creation order
+	FetchByURL(ctx context.Context, urlID string) ([]*Alias, error)
+	// Delete deletes alias of URL
+	Delete(ctx context.Context, id, urlID string) error
+	// Redirect counts redirect made at through alias, clears its Stale flag
+	// and returns it
+	Redirect(ctx context.Context, id string, at time.Time) (*Alias, error)
+	// FlagStale flags aliases without redirects since before and created
+	// before it as Stale, number of newly flagged aliases is returned
+	FlagStale(ctx context.Context, before time.Time) (int64, error)
+}
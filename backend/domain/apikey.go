@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to find
+const APIKeyPrefix = "shk_"
+
+// APIKeyTTL is the lifetime of claims made from API key, key is checked on
+// every request
+const APIKeyTTL = time.Minute
+
+// APIKey represents key user authenticates with instead of password, key
+// itself is shown only once when it is created
+type APIKey struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	UserID string             `json:"-" bson:"user_id"`
+	Name   string             `json:"name" bson:"name"`
+	// Hash is hex encoded SHA-256 of the key
+	Hash string `json:"-" bson:"hash"`
+	// Hint is the beginning of the key that tells keys apart
+	Hint string `json:"hint" bson:"hint"`
+	// Scopes limit keys of service accounts, keys of users have none
+	Scopes    []string  `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// CreateAPIKey represents data to create new API key
+type CreateAPIKey struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// CreateServiceAPIKey represents data to create new API key of service
+// account, key must be limited to at least one scope
+type CreateServiceAPIKey struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=url:read url:write"`
+}
+
+// NewAPIKey represents created API key along with the key
+type NewAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyAuthenticator authenticates requests made with API keys
+type APIKeyAuthenticator interface {
+	// Authenticate returns claims of the user who owns the key
+	Authenticate(ctx context.Context, now time.Time, key string) (*auth.Claims, error)
+}
+
+// APIKeyUsecase represents the API key's usecases
+type APIKeyUsecase interface {
+	APIKeyAuthenticator
+	Fetch(ctx context.Context, user *auth.Claims) ([]*APIKey, error)
+	Store(ctx context.Context, createKey CreateAPIKey, user *auth.Claims) (*NewAPIKey, error)
+	Delete(ctx context.Context, id string, user *auth.Claims) error
+	// StoreServiceKey creates API key of service account by given id
+	StoreServiceKey(ctx context.Context, accountID string, createKey CreateServiceAPIKey) (*NewAPIKey, error)
+}
+
+// APIKeyRepository represents the API key's repository contract
+type APIKeyRepository interface {
+	Fetch(ctx context.Context, userID string) ([]*APIKey, error)
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	Store(ctx context.Context, key *APIKey) error
+	// Delete deletes API key of the user
+	Delete(ctx context.Context, id primitive.ObjectID, userID string) error
+	// DeleteByUser deletes all API keys of the user and returns their number
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
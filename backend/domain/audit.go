@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEntry represents a record of a mutating action performed by a user,
+// RequestID and ClientIP identify the request that made it
+type AuditEntry struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	Action       string             `json:"action" bson:"action"`
+	ActorID      string             `json:"actor_id" bson:"actor_id"`
+	Impersonator string             `json:"impersonator,omitempty" bson:"impersonator,omitempty"`
+	EntityID     string             `json:"entity_id,omitempty" bson:"entity_id,omitempty"`
+	Status       int                `json:"status" bson:"status"`
+	RequestID    string             `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	ClientIP     string             `json:"client_ip,omitempty" bson:"client_ip,omitempty"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AuditRepository represents the audit's repository contract
+type AuditRepository interface {
+	Store(ctx context.Context, entry *AuditEntry) error
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// BackupVersion is the version of account backup archive format
+const BackupVersion = 1
+
+// Collections of records in account backup archive. Archive starts with
+// header, followed by user and settings, clicks follow batch of URLs they
+// were made on.
+const (
+	BackupCollectionHeader   = "backup"
+	BackupCollectionUser     = "user"
+	BackupCollectionSettings = "settings"
+	BackupCollectionURLs     = "urls"
+	BackupCollectionClicks   = "clicks"
+)
+
+// Policies restore treats records that exist in target account with. Records
+// owned by another account are never restored.
+const (
+	RestorePolicySkip      = "skip"
+	RestorePolicyOverwrite = "overwrite"
+	RestorePolicyFail      = "fail"
+)
+
+// RestoreConflictsLimit is the number of conflicting records listed by
+// restore summary
+const RestoreConflictsLimit = 100
+
+// Backup represents parameters of account backup
+type Backup struct {
+	// Clicks includes click events in backup
+	Clicks bool `json:"clicks" query:"clicks"`
+}
+
+// Restore represents parameters of account restore, Policy defaults to
+// RestorePolicySkip
+type Restore struct {
+	Policy string `json:"policy" query:"policy" validate:"omitempty,oneof=skip overwrite fail"`
+	// Clicks restores click events of backup, they are skipped by default
+	Clicks bool `json:"clicks" query:"clicks"`
+}
+
+// BackupRecord represents line of backup archive, Document is stored
+// document in MongoDB relaxed extended JSON, document of header record is
+// BackupHeader
+type BackupRecord struct {
+	Collection string          `json:"collection"`
+	Document   json.RawMessage `json:"document"`
+}
+
+// BackupHeader represents the first record of backup archive
+type BackupHeader struct {
+	Version   int       `json:"version"`
+	UserID    string    `json:"user_id"`
+	Clicks    bool      `json:"clicks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RestoreCounts represents numbers of records of collection by restore
+// outcome
+type RestoreCounts struct {
+	Created     int64 `json:"created"`
+	Overwritten int64 `json:"overwritten"`
+	Skipped     int64 `json:"skipped"`
+	Conflicted  int64 `json:"conflicted"`
+}
+
+// RestoreConflict represents record that wasn't restored because of
+// conflict
+type RestoreConflict struct {
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+	Reason     string `json:"reason"`
+}
+
+// RestoreSummary represents outcome of restore. Records are restored in
+// transactional batches, Aborted is set when restore with fail policy
+// stopped at conflict, batch with the conflict isn't restored then.
+type RestoreSummary struct {
+	Policy      string                    `json:"policy"`
+	Collections map[string]*RestoreCounts `json:"collections"`
+	// Conflicts lists first RestoreConflictsLimit conflicts
+	Conflicts []RestoreConflict `json:"conflicts,omitempty"`
+	Aborted   bool              `json:"aborted,omitempty"`
+}
+
+// BackupUsecase represents the account backup's usecases
+type BackupUsecase interface {
+	// Backup writes archive of account of user with userID to w, records
+	// are written as they are read
+	Backup(ctx context.Context, userID string, backup Backup, w io.Writer) error
+	// Restore replays archive read from r into account of user with userID.
+	// Identity, credentials and roles of the account are kept, only its
+	// name, settings, URLs and clicks are restored.
+	Restore(ctx context.Context, userID string, restore Restore, r io.Reader) (*RestoreSummary, error)
+}
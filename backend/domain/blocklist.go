@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// wildcardPrefix marks rules that match all subdomains of the domain
+const wildcardPrefix = "*."
+
+// BlockedDomain represents the blocklist rule. Rule is either exact domain,
+// e.g. example.com, or wildcard, e.g. *.example.com, which matches every
+// subdomain, but not the domain itself.
+type BlockedDomain struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	Domain    string             `json:"domain" bson:"domain"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedBy string             `json:"created_by" bson:"created_by"`
+	// AppliedAt is set once existing URLs that match the rule are blocked
+	AppliedAt *time.Time `json:"applied_at,omitempty" bson:"applied_at"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+}
+
+// IsWildcard returns true if the rule matches subdomains
+func (b *BlockedDomain) IsWildcard() bool {
+	return strings.HasPrefix(b.Domain, wildcardPrefix)
+}
+
+// Matches returns true if the rule matches host
+func (b *BlockedDomain) Matches(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if b.IsWildcard() {
+		return strings.HasSuffix(host, b.Domain[1:])
+	}
+
+	return host == b.Domain
+}
+
+// LinkPattern returns regular expression that matches links to hosts matched
+// by the rule
+func (b *BlockedDomain) LinkPattern() string {
+	host := regexp.QuoteMeta(b.Domain)
+	if b.IsWildcard() {
+		host = `[^/?#@:]+\.` + regexp.QuoteMeta(b.Domain[len(wildcardPrefix):])
+	}
+
+	return `^https?://([^/?#@]*@)?` + host + `\.?(:[0-9]*)?([/?#]|$)`
+}
+
+// CreateBlockedDomain represents data to create new blocklist rule
+type CreateBlockedDomain struct {
+	Domain string `json:"domain" validate:"required,max=253,blockrule"`
+	Reason string `json:"reason" validate:"omitempty,max=200"`
+}
+
+// LinkMatcher finds blocklist rule that blocks the link
+type LinkMatcher interface {
+	// Match returns rule that blocks the link or nil
+	Match(link string) *BlockedDomain
+}
+
+// BlocklistUsecase represents the blocklist's usecases
+type BlocklistUsecase interface {
+	LinkMatcher
+	Fetch(ctx context.Context) ([]*BlockedDomain, error)
+	Store(ctx context.Context, createRule CreateBlockedDomain, admin *auth.Claims) (*BlockedDomain, error)
+	Delete(ctx context.Context, id string) error
+	// Refresh reloads rules and blocks existing URLs that match new rules
+	Refresh(ctx context.Context) error
+}
+
+// BlocklistRepository represents the blocklist's repository contract
+type BlocklistRepository interface {
+	Fetch(ctx context.Context) ([]*BlockedDomain, error)
+	Store(ctx context.Context, rule *BlockedDomain) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	MarkApplied(ctx context.Context, id primitive.ObjectID, appliedAt time.Time) error
+}
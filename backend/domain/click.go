@@ -0,0 +1,458 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Click represents redirect made with short URL
+type Click struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	URLID    string             `json:"url_id" bson:"url_id"`
+	Campaign Campaign           `json:"campaign" bson:"campaign"`
+	// Visitor identifies client for counting unique visitors, it is keyed
+	// hash that changes every day, so the same client is counted once a day
+	Visitor string `json:"-" bson:"visitor,omitempty"`
+	// Referrer is the host of referring page, it is empty for direct visits
+	Referrer string `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	// Bot is set when user agent identifies crawler or link preview
+	Bot bool `json:"bot,omitempty" bson:"bot,omitempty"`
+	// IP is client address kept as IP policy allows, see IPPolicyFull
+	IP        string    `json:"-" bson:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// Untracked is set for clicks that are only counted, they are never
+	// stored nor delivered to subscribers
+	Untracked bool `json:"-" bson:"-"`
+}
+
+// ClickRequest represents redirect request data click is made of
+type ClickRequest struct {
+	URLID     string
+	Query     url.Values
+	IP        string
+	UserAgent string
+	Referrer  string
+	// DoNotTrack is set when client asked not to be tracked, see DoNotTrack
+	DoNotTrack bool
+}
+
+// DoNotTrack reports whether request has DNT or Sec-GPC header set to 1, such
+// clicks are counted without any details
+func DoNotTrack(h http.Header) bool {
+	return h.Get("DNT") == "1" || h.Get("Sec-GPC") == "1"
+}
+
+// Analytics modes set which click details are recorded
+const (
+	// AnalyticsStandard records campaign, referrer, visitor and bot flag
+	AnalyticsStandard = "standard"
+	// AnalyticsMinimal records campaign only, user agent, IP address and
+	// referrer are never looked at
+	AnalyticsMinimal = "minimal"
+	// AnalyticsOff records no details, clicks are only counted
+	AnalyticsOff = "off"
+)
+
+// ParseAnalytics returns analytics mode, empty mode is AnalyticsStandard
+func ParseAnalytics(mode string) (string, error) {
+	switch mode {
+	case "":
+		return AnalyticsStandard, nil
+	case AnalyticsStandard, AnalyticsMinimal, AnalyticsOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown analytics mode %q, it must be standard, minimal or off: %w", mode, ErrBadParamInput)
+	}
+}
+
+// IP policies set how client address of click is stored, address is used for
+// visitor hashes before the policy is applied
+const (
+	// IPPolicyFull stores address as is
+	IPPolicyFull = "full"
+	// IPPolicyTruncate stores address with host portion zeroed, see TruncateIP
+	IPPolicyTruncate = "truncate"
+	// IPPolicyHash stores address hashed with the daily rotating key of
+	// visitor hashes
+	IPPolicyHash = "hash"
+	// IPPolicyDiscard never stores address
+	IPPolicyDiscard = "discard"
+)
+
+// ParseIPPolicy returns IP policy, empty policy is IPPolicyDiscard
+func ParseIPPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return IPPolicyDiscard, nil
+	case IPPolicyFull, IPPolicyTruncate, IPPolicyHash, IPPolicyDiscard:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown ip policy %q, it must be full, truncate, hash or discard: %w", policy, ErrBadParamInput)
+	}
+}
+
+// TruncateIP zeroes last octet of IPv4 address and last 80 bits of IPv6
+// address, invalid address is dropped
+func TruncateIP(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return addr.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// StatsCoverage tells whether statistics are made of all clicks with all
+// details. Analytics is the current analytics mode, Untracked is the number
+// of clicks counted without details, e.g. because of DoNotTrack. Statistics
+// are partial when details are not recorded in current mode or some clicks
+// are untracked.
+type StatsCoverage struct {
+	Analytics string `json:"analytics"`
+	Untracked int64  `json:"untracked_clicks"`
+	Partial   bool   `json:"partial"`
+}
+
+// NewStatsCoverage returns coverage of statistics made in analytics mode with
+// untracked clicks
+func NewStatsCoverage(analytics string, untracked int64) *StatsCoverage {
+	return &StatsCoverage{
+		Analytics: analytics,
+		Untracked: untracked,
+		Partial:   analytics != AnalyticsStandard || untracked > 0,
+	}
+}
+
+// ReferrerHost returns lower case host of referring page, paths and query
+// are dropped as they may contain personal data
+func ReferrerHost(referrer string) string {
+	u, err := url.Parse(strings.TrimSpace(referrer))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// botMarkers are lower case substrings of user agents of crawlers, link
+// previews and HTTP libraries
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "preview", "facebookexternalhit",
+	"whatsapp", "embedly", "curl/", "wget/", "python-requests", "go-http-client",
+}
+
+// IsBot reports whether click with user agent was made by a program rather
+// than a person, empty user agent is counted as bot
+func IsBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReferrerDirect groups clicks without referrer
+const ReferrerDirect = "(direct)"
+
+// ReferrerStats represents number of clicks from referring host
+type ReferrerStats struct {
+	Referrer string `json:"referrer" bson:"referrer"`
+	Clicks   int64  `json:"clicks" bson:"clicks"`
+}
+
+// Campaign represents traffic source of the click taken from UTM parameters of
+// short URL, empty values mean parameter was absent
+type Campaign struct {
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+	Medium string `json:"medium,omitempty" bson:"medium,omitempty"`
+	Name   string `json:"name,omitempty" bson:"name,omitempty"`
+}
+
+// CampaignNone groups clicks without campaign parameter value
+const CampaignNone = "(none)"
+
+// MaxCampaignValueLength is the maximum length in bytes of campaign parameter
+// value, longer values are truncated
+const MaxCampaignValueLength = 100
+
+// ParseCampaign takes campaign from utm_source, utm_medium and utm_campaign
+// query parameters, sourceParam is used as source when utm_source is absent.
+// Values that are not valid UTF-8 are ignored.
+func ParseCampaign(query url.Values, sourceParam string) Campaign {
+	c := Campaign{
+		Source: campaignValue(query.Get("utm_source")),
+		Medium: campaignValue(query.Get("utm_medium")),
+		Name:   campaignValue(query.Get("utm_campaign")),
+	}
+	if c.Source == "" && sourceParam != "" {
+		c.Source = campaignValue(query.Get(sourceParam))
+	}
+
+	return c
+}
+
+// campaignValue trims value and truncates it to MaxCampaignValueLength
+// without splitting characters
+func campaignValue(v string) string {
+	v = strings.TrimSpace(v)
+	if !utf8.ValidString(v) {
+		return ""
+	}
+	if len(v) <= MaxCampaignValueLength {
+		return v
+	}
+
+	v = v[:MaxCampaignValueLength]
+	for !utf8.ValidString(v) {
+		v = v[:len(v)-1]
+	}
+	return v
+}
+
+// CampaignStats represents number of clicks of the campaign, absent values
+// are CampaignNone
+type CampaignStats struct {
+	Source   string `json:"source" bson:"source"`
+	Medium   string `json:"medium" bson:"medium"`
+	Campaign string `json:"campaign" bson:"campaign"`
+	Clicks   int64  `json:"clicks" bson:"clicks"`
+}
+
+// DefaultTimezone is the time zone of click patterns when filter has none
+const DefaultTimezone = "UTC"
+
+// PatternsFilter represents parameters of click patterns, TZ is IANA time
+// zone name
+type PatternsFilter struct {
+	TZ string `json:"tz" query:"tz" validate:"omitempty,timezone"`
+}
+
+// ClickPatterns represents number of clicks by hour of day and by day of week
+// in the time zone
+type ClickPatterns struct {
+	Timezone string `json:"timezone"`
+	// Hours has clicks of every hour of day, Hours[0] is 00:00-00:59
+	Hours [24]int64 `json:"hours"`
+	// Weekdays has clicks of every day of week, Weekdays[0] is Sunday
+	Weekdays [7]int64       `json:"weekdays"`
+	Coverage *StatsCoverage `json:"coverage,omitempty"`
+}
+
+// MaxCompareIDs is the maximum number of URLs compared at once
+const MaxCompareIDs = 5
+
+// DefaultStatsWindow is the window of statistics when request has none
+const DefaultStatsWindow = "30d"
+
+// MaxStatsWindowDays is the longest statistics window
+const MaxStatsWindowDays = 365
+
+// ParseStatsWindow parses window of statistics given in days, e.g. 30d
+func ParseStatsWindow(window string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(window, "d"))
+	if err != nil || !strings.HasSuffix(window, "d") || days < 1 || days > MaxStatsWindowDays {
+		return 0, fmt.Errorf("window must be a number of days from 1d to %dd: %w", MaxStatsWindowDays, ErrBadParamInput)
+	}
+
+	return days, nil
+}
+
+// ClickStats represents clicks on URL in time range
+type ClickStats struct {
+	Clicks  int64 `bson:"clicks"`
+	Uniques int64 `bson:"uniques"`
+	// Untracked is the number of clicks counted without details, they are
+	// included in Clicks and Daily
+	Untracked int64 `bson:"untracked"`
+	// Daily has number of clicks by UTC day formatted as 2006-01-02, days
+	// without clicks are absent
+	Daily map[string]int64 `bson:"-"`
+}
+
+// RollupDelta represents clicks on URL made within the hour that are added
+// to its rollup at once
+type RollupDelta struct {
+	URLID     string
+	Hour      time.Time
+	Clicks    int64
+	Bots      int64
+	Untracked int64
+	// Visitors lists visitors of the clicks, each of them once
+	Visitors []string
+}
+
+// RollupDeltas counts clicks by URL and UTC hour, deltas are in order of the
+// first click of each
+func RollupDeltas(clicks []*Click) []*RollupDelta {
+	type key struct {
+		urlID string
+		hour  time.Time
+	}
+	deltas := make([]*RollupDelta, 0)
+	byKey := make(map[key]*RollupDelta)
+	seen := make(map[key]map[string]bool)
+	for _, click := range clicks {
+		k := key{urlID: click.URLID, hour: click.CreatedAt.UTC().Truncate(time.Hour)}
+		d, ok := byKey[k]
+		if !ok {
+			d = &RollupDelta{URLID: k.urlID, Hour: k.hour}
+			byKey[k] = d
+			seen[k] = make(map[string]bool)
+			deltas = append(deltas, d)
+		}
+		d.Clicks++
+		if click.Bot {
+			d.Bots++
+		}
+		// untracked clicks are not stored, so rebuild keeps their count
+		if click.Untracked {
+			d.Untracked++
+		}
+		if click.Visitor != "" && !seen[k][click.Visitor] {
+			seen[k][click.Visitor] = true
+			d.Visitors = append(d.Visitors, click.Visitor)
+		}
+	}
+	return deltas
+}
+
+// StatsComparison represents statistics of URLs side by side for the same
+// days, URLs are in requested order
+type StatsComparison struct {
+	Window string `json:"window"`
+	// Days lists UTC days of daily series formatted as 2006-01-02
+	Days []string    `json:"days"`
+	URLs []*URLStats `json:"urls"`
+	// Coverage counts untracked clicks of all URLs
+	Coverage *StatsCoverage `json:"coverage,omitempty"`
+}
+
+// URLStats represents statistics of URL in comparison. Values are null when
+// URL is not found, daily values are null for days before URL was created.
+type URLStats struct {
+	ID      string   `json:"id"`
+	Clicks  *int64   `json:"clicks"`
+	Uniques *int64   `json:"uniques"`
+	Daily   []*int64 `json:"daily"`
+}
+
+// ClickRecorder records clicks on short URLs
+type ClickRecorder interface {
+	// Record records click made by request, it doesn't wait for the click
+	// to be stored
+	Record(req ClickRequest)
+}
+
+// ClickSubscription delivers clicks on URL as they are recorded. Slow
+// subscriber doesn't hold up recording, the oldest undelivered clicks are
+// dropped instead.
+type ClickSubscription interface {
+	// Clicks returns channel of recorded clicks, it is closed when
+	// subscription is closed or clicks are no longer recorded
+	Clicks() <-chan *Click
+	// Dropped returns number of clicks dropped since subscription was made
+	Dropped() int64
+	// Close stops delivery of clicks
+	Close()
+}
+
+// ClickUsecase represents the click's usecases
+type ClickUsecase interface {
+	ClickRecorder
+	// Run stores recorded clicks until context is canceled, clicks still
+	// queued are stored before it returns
+	Run(ctx context.Context)
+	// CampaignStats returns clicks on URL grouped by campaign and coverage
+	// of them, user must own the URL or be admin
+	CampaignStats(ctx context.Context, urlID string, user *auth.Claims) ([]*CampaignStats, *StatsCoverage, error)
+	// ClickPatterns returns clicks on URL by hour and weekday, user must own
+	// the URL or be admin
+	ClickPatterns(ctx context.Context, urlID string, filter PatternsFilter, user *auth.Claims) (*ClickPatterns, error)
+	// Compare returns statistics of URLs in window of days, user must own
+	// all found URLs or be admin
+	Compare(ctx context.Context, ids []string, window string, user *auth.Claims) (*StatsComparison, error)
+	// Subscribe returns subscription to clicks on URL recorded by this
+	// instance, user must own the URL or be admin
+	Subscribe(ctx context.Context, urlID string, user *auth.Claims) (ClickSubscription, error)
+}
+
+// ClickRepository represents the click's repository contract
+type ClickRepository interface {
+	// StoreMany stores clicks at once
+	StoreMany(ctx context.Context, clicks []*Click) error
+	// CampaignStats returns clicks on URL grouped by campaign ordered by
+	// number of clicks
+	CampaignStats(ctx context.Context, urlID string) ([]*CampaignStats, error)
+	// ClickPatterns returns clicks on URL by hour and weekday in IANA time
+	// zone
+	ClickPatterns(ctx context.Context, urlID string, timezone string) (*ClickPatterns, error)
+	// ClickStats returns clicks on URL made from from time until to time,
+	// completed hours are read from rollups
+	ClickStats(ctx context.Context, urlID string, from, to time.Time) (*ClickStats, error)
+	// AddToRollup adds clicks to rollups of their hours
+	AddToRollup(ctx context.Context, clicks []*Click) error
+	// AddRollupDeltas adds counted clicks to rollups of their hours with a
+	// single bulk write
+	AddRollupDeltas(ctx context.Context, deltas []*RollupDelta) error
+	// RebuildRollups recomputes rollups of hours from from hour until to hour
+	// from stored clicks, rebuilt rollups replace existing ones
+	RebuildRollups(ctx context.Context, from, to time.Time) error
+	// TopReferrers returns up to limit referring hosts with most clicks on
+	// URL made from from time until to time
+	TopReferrers(ctx context.Context, urlID string, from, to time.Time, limit int) ([]*ReferrerStats, error)
+	// TopURLs returns ids of up to limit URLs with most clicks made since
+	// from hour, URLs expired at now or blocked are skipped
+	TopURLs(ctx context.Context, from, now time.Time, limit int) ([]string, error)
+	// UntrackedClicks returns number of untracked clicks on URL made from
+	// from hour until to time
+	UntrackedClicks(ctx context.Context, urlID string, from, to time.Time) (int64, error)
+	// Purge deletes clicks matching the filter and returns their number,
+	// rollups are kept, so click counts don't change
+	Purge(ctx context.Context, filter ClickPurgeFilter) (int64, error)
+	// FetchClicks lists stored clicks matching the filter in id order
+	FetchClicks(ctx context.Context, filter ClickFilter) ([]*Click, error)
+}
+
+// ClickFilter selects clicks on URLs with URLIDs or clicks with IDs, clicks
+// are listed after Cursor when it is set
+type ClickFilter struct {
+	URLIDs []string
+	IDs    []primitive.ObjectID
+	Cursor primitive.ObjectID
+	Limit  int64
+}
+
+// ClickPurgeFilter selects clicks made before Before, on URLs of user with
+// UserID when it is set or on all URLs otherwise
+type ClickPurgeFilter struct {
+	UserID string
+	Before time.Time
+}
+
+// ClickRetentionUsecase represents the click retention's usecases
+type ClickRetentionUsecase interface {
+	// CheckRetention returns ErrBadParamInput when user may not keep clicks
+	// for days
+	CheckRetention(days int) error
+	// PurgeUser deletes clicks on URLs of user made more than days ago
+	PurgeUser(ctx context.Context, userID string, days int) error
+}
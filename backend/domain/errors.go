@@ -24,16 +24,174 @@ var (
 	// ErrForbidden will throw if user tries to do something that he is not
 	// authorized to do
 	ErrForbidden = errors.New("attempted action is not allowed")
+	// ErrOverloaded will throw if server has no capacity to handle request
+	ErrOverloaded = errors.New("server is overloaded, try again later")
+	// ErrBlocked will throw if destination domain is in the blocklist
+	ErrBlocked = errors.New("destination domain is blocked")
+	// ErrSpam will throw if link of new URL looks like spam
+	ErrSpam = errors.New("link looks like spam")
+	// ErrTOSOutdated will throw if terms of service version user accepts is
+	// not the current one
+	ErrTOSOutdated = errors.New("current terms of service must be accepted")
+	// ErrTimeout will throw if request is not handled in time
+	ErrTimeout = errors.New("request took too long to handle")
+	// ErrReadOnly will throw if data is changed while service is in
+	// read-only maintenance mode
+	ErrReadOnly = errors.New("service is in read-only maintenance mode, try again later")
+	// ErrUnavailable will throw if database can't be reached, calls fail
+	// fast until it recovers
+	ErrUnavailable = errors.New("database is unavailable, try again later")
 )
 
+// Entities errors are about
+const (
+	EntityURL  = "url"
+	EntityUser = "user"
+)
+
+// Error is an error with machine-readable details. Kind is one of Err*
+// sentinels, errors.Is(err, kind) is true for Error of the kind, so it is
+// checked as errors wrapping sentinels with fmt.Errorf are.
+type Error struct {
+	Kind error
+	// Message describes what failed, e.g. "URL get error"
+	Message string
+	// Entity and ID identify the item error is about, e.g. URL which
+	// already exists
+	Entity string
+	ID     string
+	// Field is the request field error is about
+	Field string
+	// Err is the cause of the error
+	Err error
+}
+
+// NewError returns Error of kind with message
+func NewError(kind error, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// NotFoundError returns ErrNotFound Error of entity with id
+func NotFoundError(entity, id, message string) *Error {
+	return &Error{Kind: ErrNotFound, Message: message, Entity: entity, ID: id}
+}
+
+// InternalError returns ErrInternalServerError Error caused by err
+func InternalError(message string, err error) *Error {
+	return &Error{Kind: ErrInternalServerError, Message: message, Err: err}
+}
+
+// WithEntity sets entity and id of the item error is about
+func (e *Error) WithEntity(entity, id string) *Error {
+	e.Entity = entity
+	e.ID = id
+	return e
+}
+
+// WithField sets request field error is about
+func (e *Error) WithField(field string) *Error {
+	e.Field = field
+	return e
+}
+
+// Wrap sets cause of the error
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// Error formats error as "message: kind: cause", the way sentinels were
+// wrapped with fmt.Errorf
+func (e *Error) Error() string {
+	msg := e.Kind.Error()
+	if e.Message != "" {
+		msg = e.Message + ": " + msg
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of the error
+func (e *Error) Is(target error) bool {
+	return errors.Is(e.Kind, target)
+}
+
+// Unwrap returns cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrCodeReadOnly is the code of ErrReadOnly responses
+const ErrCodeReadOnly = "read_only"
+
+// ErrCodeUnavailable is the code of ErrUnavailable responses
+const ErrCodeUnavailable = "unavailable"
+
+// ErrCodeChallengeRequired is the code of responses to anonymous URL creation
+// without solved proof-of-work challenge
+const ErrCodeChallengeRequired = "challenge_required"
+
+// ErrCodeTOSOutdated is the code of ErrTOSOutdated responses
+const ErrCodeTOSOutdated = "tos_outdated"
+
 // ResponseError represent the response error struct
 type ResponseError struct {
-	Error  string                                 `json:"error"`
+	Error string `json:"error"`
+	// Code identifies error clients may handle, e.g. by retrying later
+	Code   string                                 `json:"code,omitempty"`
 	Fields validator.ValidationErrorsTranslations `json:"fields,omitempty"`
+	// Entity and ID identify the item error is about, see Error
+	Entity string `json:"entity,omitempty"`
+	ID     string `json:"id,omitempty"`
+	// Items lists validation errors of items of payloads holding list of
+	// items, e.g. ids of lookup
+	Items []ItemError `json:"items,omitempty"`
+	// TraceID is set for server errors so they can be found in tracing backend
+	TraceID string `json:"trace_id,omitempty"`
 }
 
-// GetStatusCode gets http code from error
+// NewResponseError returns response of err, details of Error are set on the
+// response
+func NewResponseError(err error) ResponseError {
+	re := ResponseError{Error: err.Error()}
+	var de *Error
+	if !errors.As(err, &de) {
+		return re
+	}
+
+	re.Entity = de.Entity
+	re.ID = de.ID
+	if de.Field != "" {
+		msg := de.Message
+		if msg == "" {
+			msg = de.Kind.Error()
+		}
+		re.Fields = validator.ValidationErrorsTranslations{de.Field: msg}
+	}
+
+	return re
+}
+
+// ItemError represents validation error of one item of list payload. Field
+// is path of the invalid field inside the item, it is empty when the item
+// itself is invalid.
+type ItemError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// GetStatusCode gets http code from error, code of Error is the code of its
+// kind even if its cause is of other kind
 func GetStatusCode(err error, logger *zap.Logger) int {
+	cause := err
+	var de *Error
+	if errors.As(err, &de) {
+		err = de.Kind
+	}
+
 	if errors.Is(err, ErrAuthenticationFailure) {
 		return http.StatusUnauthorized
 	}
@@ -52,7 +210,20 @@ func GetStatusCode(err error, logger *zap.Logger) int {
 	if errors.Is(err, ErrForbidden) {
 		return http.StatusForbidden
 	}
+	if errors.Is(err, ErrBlocked) || errors.Is(err, ErrSpam) || errors.Is(err, ErrTOSOutdated) {
+		return http.StatusUnprocessableEntity
+	}
+	if errors.Is(err, ErrOverloaded) || errors.Is(err, ErrReadOnly) || errors.Is(err, ErrUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
 
-	logger.Error("Server error: ", zap.Error(err))
+	fields := []zap.Field{zap.Error(cause)}
+	if de != nil && de.Entity != "" {
+		fields = append(fields, zap.String("entity", de.Entity), zap.String("id", de.ID))
+	}
+	logger.Error("Server error: ", fields...)
 	return http.StatusInternalServerError
 }
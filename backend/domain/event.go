@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// EventURLExpired is the type of event published when URL expires, it may be
+// delivered more than once, so consumers dedupe it by URL id
+const EventURLExpired = "url.expired"
+
+// Event represents something that happened to a resource, Data is marshaled
+// to JSON by publishers
+type Event struct {
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// URLExpired represents data of url.expired event, Clicks is the final
+// number of clicks on URL
+type URLExpired struct {
+	ID             string    `json:"id"`
+	Link           string    `json:"link"`
+	UserID         string    `json:"user_id,omitempty"`
+	ExpirationDate time.Time `json:"expiration_date"`
+	Clicks         int64     `json:"clicks"`
+}
+
+// EventPublisher publishes events to systems interested in them
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// ExpirationNotifier notifies about URLs found expired
+type ExpirationNotifier interface {
+	// NotifyExpired notifies about URL if it is expired and was not notified
+	// yet, it doesn't wait for the notification to be published
+	NotifyExpired(u *URL)
+}
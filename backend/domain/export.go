@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Formats exports are written in
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// ExportURLs is the name of export of user's URLs
+const ExportURLs = "urls"
+
+// DownloadTTL is the lifetime of signed export download links
+const DownloadTTL = 10 * time.Minute
+
+// URLExport represents parameters of export of user's URLs, they are signed
+// into download link as they are
+type URLExport struct {
+	Format        string     `json:"format" query:"format" validate:"required,oneof=csv ndjson"`
+	Domain        string     `json:"domain,omitempty" query:"domain" validate:"omitempty,max=253,hostname_rfc1123"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty" query:"created_after"`
+	CreatedBefore *time.Time `json:"created_before,omitempty" query:"created_before"`
+	Status        string     `json:"status,omitempty" query:"status" validate:"omitempty,oneof=active expired disabled"`
+	Source        string     `json:"source,omitempty" query:"source" validate:"omitempty,oneof=web api cli bookmarklet import unknown"`
+	Q             string     `json:"q,omitempty" query:"q" validate:"omitempty,max=100"`
+}
+
+// Download represents signed link export is downloaded from without
+// authentication, e.g. with wget
+type Download struct {
+	Token string `json:"token"`
+	// Path is the path of download endpoint
+	Path      string    `json:"path"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExportUsecase represents the export's usecases
+type ExportUsecase interface {
+	// ExportURLs writes URLs of user with userID matching export to w in
+	// export format, URLs are written as they are read, so export of many URLs
+	// is not held in memory
+	ExportURLs(ctx context.Context, export URLExport, userID string, w io.Writer) error
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "context"
+
+// RepositoryStats represents statistics of repository storage, Documents is
+// an estimate and may lag behind recent writes
+type RepositoryStats struct {
+	Documents int64 `json:"documents"`
+}
+
+// HealthChecker checks storage of repository, so health of the service is
+// checked without reaching around repositories
+type HealthChecker interface {
+	// Ping returns error when storage is unreachable
+	Ping(ctx context.Context) error
+	// Stats returns statistics of the storage
+	Stats(ctx context.Context) (*RepositoryStats, error)
+}
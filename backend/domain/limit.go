@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// LimitStore keeps state of limits shared by all instances of the service, so
+// limits hold whichever instance serves the request. Entries expire on their
+// own, so the store doesn't grow with keys that are not used anymore.
+type LimitStore interface {
+	// Use records key until expiresAt, it returns false when key is recorded
+	// and not expired already, e.g. one-time token was used
+	Use(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+	// Add records event of key at now and returns number of events of key
+	// within window ending at now, including the new one
+	Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	// Count returns number of events of key within window ending at now
+	Count(ctx context.Context, key string, now time.Time, window time.Duration) (int, error)
+	// Reset removes events of key
+	Reset(ctx context.Context, key string) error
+}
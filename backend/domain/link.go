@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// NormalizeLink trims whitespace, adds https scheme to links that start with
+// host and lowercases scheme and host. Fragment is removed when stripFragment
+// is set. Only http and https links with host are allowed.
+func NormalizeLink(link string, stripFragment bool) (string, error) {
+	link = strings.TrimSpace(link)
+	if !utf8.ValidString(link) {
+		return "", fmt.Errorf("link is not valid utf-8: %w", ErrBadParamInput)
+	}
+
+	schemeAdded := false
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+		schemeAdded = true
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("can't parse link: %w", ErrBadParamInput)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("link scheme %q is not allowed: %w", u.Scheme, ErrBadParamInput)
+	}
+	if u.Host == "" || schemeAdded && !looksLikeHost(u.Hostname()) {
+		return "", fmt.Errorf("link has no host: %w", ErrBadParamInput)
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	// url.Parse keeps spaces in query as is, they would be trimmed on next
+	// normalization
+	u.RawQuery = strings.ReplaceAll(u.RawQuery, " ", "%20")
+	if stripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	return u.String(), nil
+}
+
+// looksLikeHost reports whether string without scheme starts with domain name
+// or IP address rather than being a random word
+func looksLikeHost(host string) bool {
+	return host == "localhost" || strings.Contains(host, ".") || strings.Contains(host, ":")
+}
+
+// ShortLinks builds public short URLs of base URL, short URLs are built
+// nowhere else. Nil ShortLinks builds empty short URLs.
+type ShortLinks struct {
+	base   string
+	scheme string
+}
+
+// NewShortLinks returns ShortLinks of public base URL, e.g. https://sho.rt or
+// https://example.com/s when service is served under path prefix
+func NewShortLinks(base string) (*ShortLinks, error) {
+	u, err := url.Parse(strings.TrimSpace(base))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q must be an http or https URL with host", base)
+	}
+	if u.User != nil || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return nil, fmt.Errorf("base URL %q must not have user info, query or fragment", base)
+	}
+
+	return &ShortLinks{base: strings.TrimSuffix(u.String(), "/"), scheme: u.Scheme}, nil
+}
+
+// URL returns public short URL of u, URL created on short domain gets short
+// URL of that domain with scheme of base URL
+func (s *ShortLinks) URL(u *URL) string {
+	if s == nil {
+		return ""
+	}
+	if u.Domain != "" {
+		return s.scheme + "://" + u.Domain + "/" + url.PathEscape(u.ID)
+	}
+	return s.base + "/" + url.PathEscape(u.ID)
+}
+
+// Set sets ShortURL of urls
+func (s *ShortLinks) Set(urls ...*URL) {
+	for _, u := range urls {
+		u.ShortURL = s.URL(u)
+	}
+}
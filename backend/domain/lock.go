@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Locker acquires named locks shared by all instances of the service, e.g. so
+// only one instance runs background job. Locks are leases expiring after ttl,
+// so lock of crashed holder is taken over once its lease expires.
+type Locker interface {
+	// AcquireLock returns ErrConflict if lock is held by another holder
+	AcquireLock(ctx context.Context, name string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a held lease of named lock
+type Lock interface {
+	// Token is fencing token of the lease, it grows every time lock is
+	// acquired, so writes of holder whose lease was taken over can be told
+	// apart by smaller token
+	Token() int64
+	// Refresh extends lease to ttl from now, it returns ErrConflict if lease
+	// expired and lock was acquired by another holder
+	Refresh(ctx context.Context, ttl time.Duration) error
+	// Release frees lock unless it was acquired by another holder
+	Release(ctx context.Context) error
+}
+
+// Transactor runs functions in transactions, repositories called with
+// context of the transaction take part in it
+type Transactor interface {
+	// WithTransaction commits changes fn makes when it returns nil and
+	// aborts them otherwise. fn is called again when transaction fails with
+	// transient error, so it must not keep state between calls.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
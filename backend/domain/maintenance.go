@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// PurgeFilter selects URLs to purge, set either ExpiredBefore to select URLs
+// expired before given time, Orphaned to select URLs whose owners were
+// deleted or UserID to select URLs of the user
+type PurgeFilter struct {
+	ExpiredBefore time.Time
+	Orphaned      bool
+	UserID        string
+}
+
+// Purge represents purge request, URLs are only counted unless Confirm is set
+type Purge struct {
+	Confirm bool `json:"confirm"`
+}
+
+// PurgeReport represents number of URLs matched and deleted by purge
+type PurgeReport struct {
+	DryRun bool `json:"dry_run"`
+	// ExpiredBefore is the time URLs expired before are purged
+	ExpiredBefore time.Time `json:"expired_before"`
+	Expired       int64     `json:"expired"`
+	Orphaned      int64     `json:"orphaned"`
+	// Deleted is the number of deleted URLs, zero in dry run
+	Deleted int64 `json:"deleted"`
+}
+
+// ReadOnlyStatus represents read-only mode of the instance
+type ReadOnlyStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ReadOnlyMode is switched on while service must not write, e.g. during
+// migrations. Requests changing data are refused and background workers wait
+// until it is switched off. Nil ReadOnlyMode is always off.
+type ReadOnlyMode struct {
+	mu sync.Mutex
+	// off is closed while mode is off, so waiting workers are released once
+	// it is switched off
+	off chan struct{}
+}
+
+// NewReadOnlyMode creates read-only mode switched on or off
+func NewReadOnlyMode(enabled bool) *ReadOnlyMode {
+	m := &ReadOnlyMode{off: make(chan struct{})}
+	if !enabled {
+		close(m.off)
+	}
+	return m
+}
+
+// Enabled tells whether writes are refused
+func (m *ReadOnlyMode) Enabled() bool {
+	if m == nil {
+		return false
+	}
+
+	select {
+	case <-m.released():
+		return false
+	default:
+		return true
+	}
+}
+
+// Set switches mode on or off
+func (m *ReadOnlyMode) Set(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-m.off:
+		if enabled {
+			m.off = make(chan struct{})
+		}
+	default:
+		if !enabled {
+			close(m.off)
+		}
+	}
+}
+
+// Wait blocks while mode is on, it returns ctx error if ctx is done first
+func (m *ReadOnlyMode) Wait(ctx context.Context) error {
+	if m == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case <-m.released():
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *ReadOnlyMode) released() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.off
+}
+
+type readOnlyKey struct{}
+
+// WithReadOnlyMode returns copy of ctx whose background writes wait while
+// read-only mode is on
+func WithReadOnlyMode(ctx context.Context, m *ReadOnlyMode) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, m)
+}
+
+// WaitWritable blocks while read-only mode stored in ctx is on, it returns
+// right away if there is none
+func WaitWritable(ctx context.Context) error {
+	m, _ := ctx.Value(readOnlyKey{}).(*ReadOnlyMode)
+	return m.Wait(ctx)
+}
+
+// Writable tells whether read-only mode stored in ctx is off, it is true if
+// there is none
+func Writable(ctx context.Context) bool {
+	m, _ := ctx.Value(readOnlyKey{}).(*ReadOnlyMode)
+	return !m.Enabled()
+}
+
+// MaintenanceUsecase represents the admin maintenance usecases
+type MaintenanceUsecase interface {
+	// Purge deletes expired and orphaned URLs in batches. Matching URLs are
+	// selected again for every batch, so interrupted purge is resumed by
+	// running it again.
+	Purge(ctx context.Context, purge Purge, admin *auth.Claims) (*PurgeReport, error)
+	// SetReadOnly switches read-only mode of this instance on or off
+	SetReadOnly(ctx context.Context, status ReadOnlyStatus, admin *auth.Claims) (*ReadOnlyStatus, error)
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "context"
+
+// Notification represents email rendered from template in recipient's locale,
+// Data is passed to the template
+type Notification struct {
+	To       string
+	Template string
+	Locale   string
+	Data     interface{}
+}
+
+// NotificationSender sends notifications to users
+type NotificationSender interface {
+	// Send renders notification and queues it for delivery, it doesn't wait
+	// for the notification to be delivered
+	Send(ctx context.Context, n Notification) error
+}
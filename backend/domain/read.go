@@ -0,0 +1,32 @@
+package domain
+
+import "context"
+
+// ReadClass tells repository how fresh data returned by read must be
+type ReadClass int
+
+const (
+	// ReadPrimary reads see every acknowledged write, reads are ReadPrimary
+	// unless context says otherwise
+	ReadPrimary ReadClass = iota
+	// ReadRedirect reads serve redirects, they may return data that is
+	// stale within configured bound
+	ReadRedirect
+	// ReadForUpdate reads are made before document is changed, e.g. to check
+	// its owner, they are served by primary and skip caches
+	ReadForUpdate
+)
+
+type readClassKey struct{}
+
+// WithReadClass returns copy of ctx whose reads are of read class
+func WithReadClass(ctx context.Context, class ReadClass) context.Context {
+	return context.WithValue(ctx, readClassKey{}, class)
+}
+
+// ReadClassFromContext returns read class stored in ctx, ReadPrimary is
+// returned if there is none
+func ReadClassFromContext(ctx context.Context) ReadClass {
+	class, _ := ctx.Value(readClassKey{}).(ReadClass)
+	return class
+}
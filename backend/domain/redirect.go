@@ -0,0 +1,39 @@
+package domain
+
+import "context"
+
+// Outcomes of redirects
+const (
+	RedirectHit      = "hit"
+	RedirectMiss     = "miss"
+	RedirectExpired  = "expired"
+	RedirectDisabled = "disabled"
+	RedirectFlagged  = "flagged"
+	RedirectInvalid  = "invalid"
+	RedirectError    = "error"
+)
+
+// RedirectObservation is filled by layers serving redirect, so its outcome
+// can be told apart where only ErrNotFound is returned. Redirect handler
+// stores it in context, layers find it by RedirectObservationFromContext.
+type RedirectObservation struct {
+	// CacheHit is set when URL or its absence was found in cache
+	CacheHit bool
+	// Disabled is set when URL is hidden as it is blocked or its owner is
+	// disabled
+	Disabled bool
+}
+
+type redirectObservationKey struct{}
+
+// WithRedirectObservation returns copy of ctx which stores o
+func WithRedirectObservation(ctx context.Context, o *RedirectObservation) context.Context {
+	return context.WithValue(ctx, redirectObservationKey{}, o)
+}
+
+// RedirectObservationFromContext returns observation stored in ctx, nil is
+// returned if there is none
+func RedirectObservationFromContext(ctx context.Context) *RedirectObservation {
+	o, _ := ctx.Value(redirectObservationKey{}).(*RedirectObservation)
+	return o
+}
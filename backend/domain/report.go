@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Report reasons
+const (
+	ReportReasonPhishing = "phishing"
+	ReportReasonMalware  = "malware"
+	ReportReasonSpam     = "spam"
+	ReportReasonIllegal  = "illegal"
+	ReportReasonOther    = "other"
+)
+
+// Report statuses, URL has at most one open report
+const (
+	ReportStatusOpen     = "open"
+	ReportStatusResolved = "resolved"
+)
+
+// Actions admins resolve reports with
+const (
+	ReportActionDismiss     = "dismiss"
+	ReportActionDisableURL  = "disable_url"
+	ReportActionBlockDomain = "block_domain"
+	ReportActionBanOwner    = "ban_owner"
+)
+
+// URLSignalReported is the signal of flag open report forces on reported
+// URL, see URLFlag
+const URLSignalReported = "reported"
+
+// ReportCommentsLimit is the number of latest comments kept by report
+const ReportCommentsLimit = 20
+
+// DefaultReportPageLimit is the number of reports listed when filter has no
+// limit
+const DefaultReportPageLimit = 20
+
+// Report represents abuse reports of URL. Reports of URL made before the
+// report is resolved are aggregated into it, Count is the number of them and
+// Reasons counts them by reason.
+type Report struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	URLID  string             `json:"url_id" bson:"url_id"`
+	Status string             `json:"status" bson:"status"`
+	Count  int64              `json:"count" bson:"count"`
+	// Reasons maps reasons to number of reports, reports without reason are
+	// counted as other
+	Reasons map[string]int64 `json:"reasons" bson:"reasons"`
+	// Comments are latest comments reports were made with
+	Comments       []ReportComment   `json:"comments,omitempty" bson:"comments,omitempty"`
+	Resolution     *ReportResolution `json:"resolution,omitempty" bson:"resolution,omitempty"`
+	CreatedAt      time.Time         `json:"created_at" bson:"created_at"`
+	LastReportedAt time.Time         `json:"last_reported_at" bson:"last_reported_at"`
+}
+
+// ReportComment represents free text report was made with
+type ReportComment struct {
+	Reason    string    `json:"reason" bson:"reason"`
+	Text      string    `json:"text" bson:"text"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// ReportResolution represents action admin resolved report with
+type ReportResolution struct {
+	Action string    `json:"action" bson:"action"`
+	Note   string    `json:"note,omitempty" bson:"note,omitempty"`
+	By     string    `json:"by" bson:"by"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// CreateReport represents data to report URL abuse
+type CreateReport struct {
+	Reason  string `json:"reason" validate:"omitempty,oneof=phishing malware spam illegal other"`
+	Comment string `json:"comment" validate:"omitempty,max=500"`
+}
+
+// ResolveReport represents data to resolve report, Note is used as reason of
+// blocklist rule and of disabled account
+type ResolveReport struct {
+	Action string `json:"action" validate:"required,oneof=dismiss disable_url block_domain ban_owner"`
+	Note   string `json:"note" validate:"omitempty,max=200"`
+}
+
+// ReportFilter represents parameters admins list reports with, reports are
+// listed in id order after Cursor
+type ReportFilter struct {
+	Status string `json:"status" query:"status" validate:"omitempty,oneof=open resolved"`
+	Cursor string `json:"cursor" query:"cursor" validate:"omitempty,len=24,hexadecimal"`
+	Limit  int64  `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	// CreatedBefore lists reports created before it, it is set by
+	// escalation and is never taken from request
+	CreatedBefore time.Time `json:"-" query:"-"`
+}
+
+// ReportPage represents a page of reports
+type ReportPage struct {
+	Reports    []*Report `json:"reports"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// NotificationURLDisabled is the template of email sent to owner of URL
+// disabled automatically because its report wasn't reviewed in time
+const NotificationURLDisabled = "url_disabled"
+
+// URLDisabled represents data of email sent when reported URL is disabled
+// automatically, URL is restored if admin dismisses the report
+type URLDisabled struct {
+	Name       string
+	ID         string
+	Link       string
+	ReportedAt time.Time
+}
+
+// ReportEscalationUsecase disables reported URLs admins haven't reviewed in
+// time, they are restored when report is dismissed
+type ReportEscalationUsecase interface {
+	// Escalate disables URLs of open reports older than configured period
+	Escalate(ctx context.Context) error
+}
+
+// ReportUsecase represents the report's usecases
+type ReportUsecase interface {
+	// Store reports abuse of URL, it is added to open report of the URL.
+	// Reported URL redirects through interstitial page until report is
+	// resolved.
+	Store(ctx context.Context, urlID string, createReport CreateReport) error
+	Fetch(ctx context.Context, filter ReportFilter) (*ReportPage, error)
+	// Resolve resolves open report with action, every action but dismiss is
+	// audited. Dismiss clears flag the report forced and restores URL
+	// disabled by escalation.
+	Resolve(ctx context.Context, id string, resolve ResolveReport, admin *auth.Claims) (*Report, error)
+}
+
+// ReportRepository represents the report's repository contract
+type ReportRepository interface {
+	// Store adds report to open report of URL, it is created when URL has
+	// none
+	Store(ctx context.Context, urlID string, comment ReportComment) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Report, error)
+	Fetch(ctx context.Context, filter ReportFilter) ([]*Report, error)
+	// Resolve resolves open report, ErrConflict is returned when report is
+	// already resolved
+	Resolve(ctx context.Context, id primitive.ObjectID, resolution ReportResolution) error
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Panels of shared statistics
+const (
+	SharePanelClicks    = "clicks"
+	SharePanelDaily     = "daily"
+	SharePanelReferrers = "referrers"
+)
+
+// SharePanels lists panels shared when request has none
+var SharePanels = []string{SharePanelClicks, SharePanelDaily, SharePanelReferrers}
+
+// DefaultShareDays is the lifetime of share in days when request has none
+const DefaultShareDays = 30
+
+// ShareStatsDays is the number of days shown on shared statistics page
+const ShareStatsDays = 30
+
+// ShareReferrersLimit is the number of top referrers shown on shared
+// statistics page
+const ShareReferrersLimit = 10
+
+// Share represents read-only access to URL statistics given to anyone who has
+// share token
+type Share struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	URLID     string             `json:"url_id" bson:"url_id"`
+	UserID    string             `json:"-" bson:"user_id"`
+	Panels    []string           `json:"panels" bson:"panels"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// HasPanel returns true if panel is shared
+func (s *Share) HasPanel(panel string) bool {
+	for _, p := range s.Panels {
+		if p == panel {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateShare represents data to share URL statistics
+type CreateShare struct {
+	Panels        []string `json:"panels" validate:"omitempty,max=3,unique,dive,oneof=clicks daily referrers"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+// SharedStats represents URL statistics shown by share, only shared panels
+// are set. Destination link is never shown.
+type SharedStats struct {
+	URLID  string   `json:"url_id"`
+	Panels []string `json:"panels"`
+	Clicks *int64   `json:"clicks,omitempty"`
+	// Days lists UTC days of daily series formatted as 2006-01-02
+	Days      []string         `json:"days,omitempty"`
+	Daily     []int64          `json:"daily,omitempty"`
+	Referrers []*ReferrerStats `json:"referrers,omitempty"`
+	Coverage  *StatsCoverage   `json:"coverage,omitempty"`
+	ExpiresAt time.Time        `json:"expires_at"`
+}
+
+// ShareUsecase represents the share's usecases
+type ShareUsecase interface {
+	// Store shares statistics of URL, user must own the URL or be admin
+	Store(ctx context.Context, urlID string, createShare CreateShare, user *auth.Claims) (*Share, error)
+	// Delete revokes share of URL statistics, user must own the URL or be
+	// admin
+	Delete(ctx context.Context, urlID string, id string, user *auth.Claims) error
+	// Stats returns statistics shown by share of URL
+	Stats(ctx context.Context, urlID string, id string) (*SharedStats, error)
+}
+
+// ShareRepository represents the share's repository contract
+type ShareRepository interface {
+	Store(ctx context.Context, share *Share) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*Share, error)
+	// Delete deletes share of URL
+	Delete(ctx context.Context, id primitive.ObjectID, urlID string) error
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// ShortDomain represents domain URLs may be created on besides the default
+// one, name is lowercase without trailing dot
+type ShortDomain struct {
+	Name      string    `json:"name" bson:"_id"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// CreateShortDomain represents data to allow new domain
+type CreateShortDomain struct {
+	Name string `json:"name" validate:"required,max=253,fqdn"`
+}
+
+// NormalizeDomain lowercases domain name and removes trailing dot
+func NormalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// UnknownDomainError is returned when URL is created on domain which is not
+// allowed, it is ErrBadParamInput
+type UnknownDomainError struct {
+	Domain  string
+	Allowed []string
+}
+
+func (e *UnknownDomainError) Error() string {
+	return fmt.Sprintf("domain %s is not allowed", e.Domain)
+}
+
+func (e *UnknownDomainError) Unwrap() error {
+	return ErrBadParamInput
+}
+
+// Field returns validation message of domain field naming allowed domains
+func (e *UnknownDomainError) Field() string {
+	if len(e.Allowed) == 0 {
+		return "domain must not be set, no domains are allowed"
+	}
+	return "domain must be one of " + strings.Join(e.Allowed, ", ")
+}
+
+// DefaultDomainStatsDays is the number of days clicks are counted for when
+// filter has no days
+const DefaultDomainStatsDays = 30
+
+// DomainStatsFilter represents parameters domain statistics are read with
+type DomainStatsFilter struct {
+	Days int `json:"days" query:"days" validate:"omitempty,min=1,max=90"`
+}
+
+// DomainStats represents totals of URLs created on domain, Domain is empty for
+// URLs created on the default domain
+type DomainStats struct {
+	Domain string `json:"domain"`
+	Links  int64  `json:"links"`
+	// LinksBySource has number of links by source they were created
+	// through, see URLSources
+	LinksBySource map[string]int64 `json:"links_by_source"`
+	// ClicksPerDay has number of clicks by UTC day formatted as 2006-01-02,
+	// days without clicks are omitted
+	ClicksPerDay map[string]int64 `json:"clicks_per_day"`
+	// TopLinks lists URLs clicked the most during the counted days
+	TopLinks []*LinkClicks `json:"top_links"`
+}
+
+// LinkClicks represents number of clicks on URL
+type LinkClicks struct {
+	URLID  string `json:"url_id" bson:"url_id"`
+	Clicks int64  `json:"clicks" bson:"clicks"`
+}
+
+// DomainChecker checks domain URL is created on
+type DomainChecker interface {
+	// CheckDomain returns UnknownDomainError when name is not allowed, empty
+	// name is the default domain which is always allowed
+	CheckDomain(ctx context.Context, name string) error
+}
+
+// ShortDomainUsecase represents the short domain's usecases
+type ShortDomainUsecase interface {
+	DomainChecker
+	Fetch(ctx context.Context) ([]*ShortDomain, error)
+	Store(ctx context.Context, createDomain CreateShortDomain, admin *auth.Claims) (*ShortDomain, error)
+	Delete(ctx context.Context, name string) error
+	// Stats returns statistics of the default domain and every domain URLs
+	// were created on or which is allowed
+	Stats(ctx context.Context, filter DomainStatsFilter) ([]*DomainStats, error)
+}
+
+// ShortDomainRepository represents the short domain's repository contract
+type ShortDomainRepository interface {
+	Fetch(ctx context.Context) ([]*ShortDomain, error)
+	Store(ctx context.Context, d *ShortDomain) error
+	Delete(ctx context.Context, name string) error
+	// Stats counts URLs by domain and their clicks made since from, top is
+	// the number of top links of every domain
+	Stats(ctx context.Context, from time.Time, top int) ([]*DomainStats, error)
+}
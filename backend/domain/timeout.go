@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OperationClass classifies usecase operations by their cost, every class has
+// its own time budget
+type OperationClass int
+
+const (
+	// OperationRead reads few documents, e.g. by id
+	OperationRead OperationClass = iota
+	// OperationWrite changes documents, usually after reading them
+	OperationWrite
+	// OperationScan lists or counts documents matching a filter
+	OperationScan
+)
+
+// Timeouts stores time budgets of usecase operations by class, zero budget
+// disables deadline of the class
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Scan  time.Duration
+}
+
+// NewTimeouts returns Timeouts with the same budget of every class
+func NewTimeouts(d time.Duration) Timeouts {
+	return Timeouts{Read: d, Write: d, Scan: d}
+}
+
+func (t Timeouts) budget(class OperationClass) time.Duration {
+	switch class {
+	case OperationWrite:
+		return t.Write
+	case OperationScan:
+		return t.Scan
+	default:
+		return t.Read
+	}
+}
+
+// WithTimeout returns copy of ctx which is done once budget of class is over,
+// shorter deadline of ctx is kept
+func (t Timeouts) WithTimeout(ctx context.Context, class OperationClass) (context.Context, context.CancelFunc) {
+	d := t.budget(class)
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// WrapTimeout makes *err ErrTimeout when deadline of ctx is exceeded, so
+// errors of operations interrupted by deadline are not reported as server
+// errors. Usecases defer it right after applying their budget.
+func WrapTimeout(ctx context.Context, err *error) {
+	if *err == nil || errors.Is(*err, ErrTimeout) || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return
+	}
+	*err = fmt.Errorf("%w: %s", ErrTimeout, (*err).Error())
+}
@@ -2,47 +2,364 @@ package domain
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/semka95/shortener/backend/web/auth"
 )
 
-// URL represents the URL model
+// URL represents the URL model, BlockedBy is set to the blocklist rule that
+// disabled the URL
 type URL struct {
 	ID             string    `json:"id" bson:"_id"`
 	Link           string    `json:"link" bson:"link"`
 	ExpirationDate time.Time `json:"expiration_date" bson:"expiration_date"`
 	UserID         string    `json:"user_id" bson:"user_id"`
-	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
+	// Domain is the domain URL was created on, it is empty for the default
+	// domain, see ShortDomain
+	Domain    string `json:"domain,omitempty" bson:"domain,omitempty"`
+	BlockedBy string `json:"blocked_by,omitempty" bson:"blocked_by,omitempty"`
+	// Flag is set for URLs that look like spam, they redirect through
+	// interstitial page until flag is cleared
+	Flag      *URLFlag  `json:"flag,omitempty" bson:"flag"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// Creation is never part of public responses, see CreationInfo
+	Creation CreationInfo `json:"-" bson:",inline"`
+	// ExpiredNotified is set when url.expired event was published
+	ExpiredNotified bool `json:"-" bson:"expired_notified,omitempty"`
+	// NotifyingAt is the time url.expired event was claimed to be published
+	// at, claim is taken over once it is older than claim timeout
+	NotifyingAt *time.Time `json:"-" bson:"notifying_at,omitempty"`
+	// ShortURL is public short URL set for responses, see ShortLinks
+	ShortURL string `json:"short_url,omitempty" bson:"-"`
+}
+
+// URLFlag represents spam score URL was flagged with
+type URLFlag struct {
+	Score   int       `json:"score" bson:"score"`
+	Signals []string  `json:"signals" bson:"signals"`
+	At      time.Time `json:"at" bson:"at"`
+}
+
+// CreationInfo represents request URL was created with, it is kept for abuse
+// investigations and shown only to admins and URL owner
+type CreationInfo struct {
+	IP        string `json:"created_ip,omitempty" bson:"created_ip,omitempty"`
+	UserAgent string `json:"created_user_agent,omitempty" bson:"created_user_agent,omitempty"`
+	// Source is the channel URL was created through, it is set by the create
+	// path and is never taken from request, see URLSources
+	Source string `json:"source" bson:"source,omitempty"`
+}
+
+// Channels URLs are created through. URLs created before sources were stored
+// have URLSourceUnknown.
+const (
+	URLSourceWeb         = "web"
+	URLSourceAPI         = "api"
+	URLSourceCLI         = "cli"
+	URLSourceBookmarklet = "bookmarklet"
+	URLSourceImport      = "import"
+	URLSourceUnknown     = "unknown"
+)
+
+// URLSources lists sources URLs can be filtered by
+var URLSources = []string{URLSourceWeb, URLSourceAPI, URLSourceCLI, URLSourceBookmarklet, URLSourceImport, URLSourceUnknown}
+
+// AnonymizeIP zeroes last octet of IPv4 address and last 64 bits of IPv6
+// address, invalid address is dropped
+func AnonymizeIP(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return addr.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// OwnedBy reports whether user owns the URL or is admin, user is nil for
+// anonymous caller
+func (u *URL) OwnedBy(user *auth.Claims) bool {
+	return user != nil && (user.HasRole(auth.RoleAdmin) || u.UserID != "" && u.UserID == user.Subject)
+}
+
+// URLFields lists URL fields that can be selected with sparse fieldsets,
+// fields not listed here can never be selected
+var URLFields = []string{"id", "link", "expiration_date", "user_id", "created_at", "updated_at"}
+
+// ParseURLFields parses comma separated list of URL fields, empty list selects
+// all fields
+func ParseURLFields(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	fields := make([]string, 0, len(URLFields))
+	seen := make(map[string]bool, len(URLFields))
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		if !isURLField(f) {
+			return nil, fmt.Errorf("unknown field %q, allowed fields are %s: %w", f, strings.Join(URLFields, ", "), ErrBadParamInput)
+		}
+		if !seen[f] {
+			seen[f] = true
+			fields = append(fields, f)
+		}
+	}
+
+	return fields, nil
+}
+
+func isURLField(f string) bool {
+	for _, allowed := range URLFields {
+		if f == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicURLFields lists URL fields returned by lookup for URLs caller doesn't
+// own, they are enough to follow the short link
+var PublicURLFields = []string{"id", "link", "short_url"}
+
+// MaxLookupIDs is the maximum number of ids in one lookup request
+const MaxLookupIDs = 100
+
+// LookupURLs represents ids of URLs to look up
+type LookupURLs struct {
+	IDs []string `json:"ids" validate:"required,min=1,max=100,dive,required,max=20,linkid"`
+}
+
+// URLLookup represents result of URLs lookup. URLs are in requested order,
+// Owned reports for each of them whether caller owns it or is admin, URLs
+// which are not owned must be shown with PublicURLFields only.
+type URLLookup struct {
+	URLs    []*URL
+	Owned   []bool
+	Missing []string
+}
+
+// URL statuses used for filtering, URLs blocked by blocklist are disabled
+const (
+	URLStatusActive   = "active"
+	URLStatusExpired  = "expired"
+	URLStatusDisabled = "disabled"
+)
+
+// Status returns status of the URL at given time
+func (u *URL) Status(now time.Time) string {
+	if u.BlockedBy != "" {
+		return URLStatusDisabled
+	}
+	if !now.Before(u.ExpirationDate) {
+		return URLStatusExpired
+	}
+	return URLStatusActive
+}
+
+// DefaultURLPageLimit is the number of URLs listed when filter has no limit
+const DefaultURLPageLimit = 20
+
+// URLFilter represents parameters admins list URLs with. Owner is email of
+// URL owner, Domain matches destination host and its subdomains, Q matches
+// part of id or link. URLs are listed in id order after Cursor.
+type URLFilter struct {
+	Owner         string     `json:"owner" query:"owner" validate:"omitempty,email"`
+	Domain        string     `json:"domain" query:"domain" validate:"omitempty,max=253,hostname_rfc1123"`
+	CreatedAfter  *time.Time `json:"created_after" query:"created_after"`
+	CreatedBefore *time.Time `json:"created_before" query:"created_before"`
+	Status        string     `json:"status" query:"status" validate:"omitempty,oneof=active expired disabled"`
+	Source        string     `json:"source" query:"source" validate:"omitempty,oneof=web api cli bookmarklet import unknown"`
+	Q             string     `json:"q" query:"q" validate:"omitempty,max=100"`
+	Cursor        string     `json:"cursor" query:"cursor" validate:"omitempty,max=20,linkid"`
+	Limit         int64      `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	// OwnerID is set by usecase to id of the user with Owner email
+	OwnerID string `json:"-"`
+}
+
+// DomainPattern returns regular expression that matches links to Domain and
+// its subdomains
+func (f *URLFilter) DomainPattern() string {
+	return `^https?://([^/?#@]*@)?([^/?#@:]+\.)?` + regexp.QuoteMeta(strings.ToLower(f.Domain)) + `\.?(:[0-9]*)?([/?#]|$)`
+}
+
+// AdminURL represents URL listed to admins along with its owner email and
+// number of clicks
+type AdminURL struct {
+	URL          `bson:",inline"`
+	CreationInfo `bson:"-"`
+	Status       string `json:"status" bson:"-"`
+	OwnerEmail   string `json:"owner_email,omitempty" bson:"owner_email,omitempty"`
+	Clicks       int64  `json:"clicks" bson:"clicks"`
+}
+
+// URLPage represents a page of URLs
+type URLPage struct {
+	URLs       []*AdminURL `json:"urls"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 // CreateURL represents data to create new URL
 type CreateURL struct {
-	ID             *string    `json:"id" validate:"omitempty,linkid,min=7,max=20"`
-	Link           string     `json:"link" validate:"required,url"`
-	ExpirationDate *time.Time `json:"expiration_date" validate:"omitempty,gt"`
-	UserID         string     `json:"-"`
+	// ID is custom alias, its length and form are checked by usecase
+	ID             *string    `json:"id" validate:"omitempty,max=20,linkid"`
+	Link           string     `json:"link" validate:"required,max=8192,link"`
+	ExpirationDate *time.Time `json:"expiration_date" validate:"omitempty,future"`
+	// Domain is one of allowed short domains, URL is created on the default
+	// domain when it is not set
+	Domain string `json:"domain" validate:"omitempty,max=253,fqdn"`
+	UserID string `json:"-"`
+	// Creation is set by handler from request, handler sets Source of the
+	// create path it serves
+	Creation CreationInfo `json:"-"`
+	// Flag is set by spam filter
+	Flag *URLFlag `json:"-"`
 }
 
-// UpdateURL represents data to update URL
+// UpdateURL represents data to update URL, fields which are not set are left
+// as is, at least one of them must be set
 type UpdateURL struct {
-	ID             string    `json:"id" validate:"required,linkid,max=20"`
-	ExpirationDate time.Time `json:"expiration_date" validate:"required,gt"`
+	ID             string     `json:"id" validate:"required,max=20,linkid"`
+	Link           *string    `json:"link" validate:"omitempty,max=8192,link"`
+	ExpirationDate *time.Time `json:"expiration_date" validate:"required_without=Link,omitempty,future"`
+}
+
+// Optional represents JSON field of partial update, it tells absent field
+// from explicit null
+type Optional[T any] struct {
+	// Set is true when field is present, Null is true when it is null
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is called only for present fields, including null ones
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(b, &o.Value)
+}
+
+// ValidationValue returns value to validate, it is nil for absent and null
+// fields
+func (o Optional[T]) ValidationValue() interface{} {
+	if !o.Set || o.Null {
+		return nil
+	}
+	return o.Value
+}
+
+// PatchURL represents partial update of URL, absent fields are left as is.
+// Null link is not allowed, null expiration date resets it to default one.
+type PatchURL struct {
+	ID             string              `json:"-" validate:"required,max=20,linkid"`
+	Link           Optional[string]    `json:"link" validate:"omitempty,max=8192,link"`
+	ExpirationDate Optional[time.Time] `json:"expiration_date" validate:"omitempty,future"`
+	// Version is the version of URL client has seen, see URL.Version, empty
+	// version is not checked
+	Version string `json:"-"`
+}
+
+// Version returns version of URL which changes on every update, it is used
+// for optimistic concurrency
+func (u *URL) Version() string {
+	return strconv.FormatInt(u.UpdatedAt.UnixMilli(), 10)
 }
 
 // URLUsecase represents the URL's usecases
 type URLUsecase interface {
-	GetByID(ctx context.Context, id string) (*URL, error)
+	// GetByID returns URL, when fields are set only they are guaranteed to be
+	// filled
+	GetByID(ctx context.Context, id string, fields ...string) (*URL, error)
 	Update(ctx context.Context, updateURL UpdateURL, user *auth.Claims) error
+	// Patch changes fields of URL present in patch, user must own the URL or
+	// be admin. ErrConflict is returned when URL version is not the patched
+	// one.
+	Patch(ctx context.Context, patch PatchURL, user *auth.Claims) (*URL, error)
 	Store(ctx context.Context, createURL CreateURL) (*URL, error)
 	Delete(ctx context.Context, id string, user *auth.Claims) error
+	// Lookup returns URLs by ids, user is nil for anonymous caller
+	Lookup(ctx context.Context, ids []string, user *auth.Claims) (*URLLookup, error)
+	// Fetch lists URLs of all users by given filter
+	Fetch(ctx context.Context, filter URLFilter) (*URLPage, error)
 }
 
-// URLRepository represents the URL's repository contract
+// AnyOwner is the owner constraint of URL writes made by admins and
+// background jobs, they are not restricted to URLs of some user
+const AnyOwner = ""
+
+// URLRepository represents the URL's repository contract. Writes restricted
+// to URLs of owner with ownerID are enforced by database atomically, they
+// return ErrNoAffected when URL belongs to another user, AnyOwner doesn't
+// restrict them.
 type URLRepository interface {
-	GetByID(ctx context.Context, id string) (*URL, error)
-	Update(ctx context.Context, url *URL) error
+	HealthChecker
+	// GetByID returns URL, when fields are set only they and fields needed
+	// by usecase are fetched
+	GetByID(ctx context.Context, id string, fields ...string) (*URL, error)
+	// GetByIDs returns found URLs with given ids in no particular order
+	GetByIDs(ctx context.Context, ids []string) ([]*URL, error)
+	Update(ctx context.Context, url *URL, ownerID string) error
+	// UpdateIfUnchanged updates URL unless it was updated after updatedAt,
+	// ErrConflict is returned then. URL with cleared BlockedBy is unblocked.
+	UpdateIfUnchanged(ctx context.Context, url *URL, updatedAt time.Time, ownerID string) error
 	Store(ctx context.Context, u *URL) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id, ownerID string) error
+	// BlockByPattern marks not blocked URLs whose links match the pattern as
+	// blocked by rule and returns their ids
+	BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error)
+	// Fetch lists URLs by given filter, Owner is ignored in favour of OwnerID
+	Fetch(ctx context.Context, filter URLFilter) ([]*AdminURL, error)
+	// CountPurgeable returns number of URLs matching purge filter
+	CountPurgeable(ctx context.Context, filter PurgeFilter) (int64, error)
+	// PurgeBatch deletes up to limit URLs matching purge filter and returns
+	// number of deleted URLs
+	PurgeBatch(ctx context.Context, filter PurgeFilter, limit int64) (int64, error)
+	// ScanIDs calls fn with id of every URL, scan stops at first error
+	ScanIDs(ctx context.Context, fn func(id string) error) error
+	// FetchExpired returns up to limit not blocked URLs expired by now
+	// which are not notified and not claimed after claimedBefore
+	FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*URL, error)
+	// ClaimExpired claims notification of URL expired by now, claims made
+	// before claimedBefore are taken over. It reports false when URL is not
+	// expired, is notified or is claimed by another caller
+	ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error)
+	// MarkExpiredNotified marks URL as notified and removes its claim
+	MarkExpiredNotified(ctx context.Context, id string) error
+	// ReleaseExpired removes claim of URL, so it is notified again
+	ReleaseExpired(ctx context.Context, id string) error
+}
+
+// LinkSnapshot represents counts of URLs alerting is based on, they can't be
+// derived from request counters, so they are counted periodically
+type LinkSnapshot struct {
+	// Active is the number of URLs that are neither expired nor blocked
+	Active int64 `bson:"active"`
+	// CreatedLastHour is the number of URLs created during the hour before
+	// TakenAt
+	CreatedLastHour int64     `bson:"created_last_hour"`
+	TakenAt         time.Time `bson:"taken_at"`
+}
+
+// LinkSnapshotRepository counts URLs and stores the last snapshot, so
+// instances that didn't count export the same numbers
+type LinkSnapshotRepository interface {
+	// Count counts URLs active at now and created during the hour before
+	Count(ctx context.Context, now time.Time) (*LinkSnapshot, error)
+	// Save replaces the last snapshot
+	Save(ctx context.Context, snapshot *LinkSnapshot) error
+	// Last returns the last saved snapshot, ErrNotFound is returned when
+	// none was saved
+	Last(ctx context.Context) (*LinkSnapshot, error)
 }
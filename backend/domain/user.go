@@ -2,6 +2,8 @@ package domain
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,8 +18,118 @@ type User struct {
 	Email          string             `json:"email" bson:"email"`
 	HashedPassword string             `json:"-" bson:"hashed_password"`
 	Roles          []string           `json:"roles" bson:"roles"`
-	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+	Type           string             `json:"type,omitempty" bson:"type,omitempty"`
+	DisabledAt     *time.Time         `json:"disabled_at,omitempty" bson:"disabled_at"`
+	DisabledBy     string             `json:"disabled_by,omitempty" bson:"disabled_by"`
+	DisabledReason string             `json:"disabled_reason,omitempty" bson:"disabled_reason"`
+	// DeleteAfter is set when user requested deletion of the account, it is
+	// disabled until then and deleted afterwards
+	DeleteAfter *time.Time `json:"delete_after,omitempty" bson:"delete_after"`
+	// DeletingAt is set when sweeper started deleting the account, it can't
+	// be restored afterwards
+	DeletingAt *time.Time `json:"-" bson:"deleting_at,omitempty"`
+	// MustChangePassword is set by admin, tokens of the user are accepted only
+	// for password change until the user changes it
+	MustChangePassword bool         `json:"must_change_password,omitempty" bson:"must_change_password"`
+	Settings           UserSettings `json:"settings" bson:"settings"`
+	CreatedAt          time.Time    `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at" bson:"updated_at"`
+	// PasswordHistory holds hashes of previous passwords, newest first, it is
+	// never serialized
+	PasswordHistory []string `json:"-" bson:"password_history,omitempty"`
+	// TOSVersion is the terms of service version the user accepted last,
+	// at TOSAcceptedAt
+	TOSVersion    string     `json:"tos_version,omitempty" bson:"tos_version,omitempty"`
+	TOSAcceptedAt *time.Time `json:"tos_accepted_at,omitempty" bson:"tos_accepted_at,omitempty"`
+}
+
+// PasswordHistorySize is the number of last passwords, including the current
+// one, new password must differ from
+const PasswordHistorySize = 5
+
+// ErrPasswordReused will throw if new password is one of the last
+// PasswordHistorySize passwords
+var ErrPasswordReused = fmt.Errorf("new password must differ from the last %d passwords: %w", PasswordHistorySize, ErrBadParamInput)
+
+// ErrNewPasswordRequired will throw if user who must change password updates
+// account without setting new password
+var ErrNewPasswordRequired = fmt.Errorf("new password is required: %w", ErrBadParamInput)
+
+// ErrEmailTaken will throw if email is used by another user, emails that
+// differ only in case are the same email
+var ErrEmailTaken = fmt.Errorf("email is already taken: %w", ErrConflict)
+
+// NormalizeEmail returns email as users are stored and looked up by, so
+// emails that differ only in case or surrounding spaces are the same
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UserSettings represents defaults of URLs user creates, they are applied when
+// request omits corresponding fields
+type UserSettings struct {
+	// DefaultExpirationDays is the lifetime of new URLs in days
+	DefaultExpirationDays int `json:"default_expiration_days,omitempty" bson:"default_expiration_days,omitempty" validate:"omitempty,min=1,max=36500"`
+	// ClickRetentionDays is the number of days clicks on URLs of user are
+	// kept for, it is bounded by service click retention
+	ClickRetentionDays int `json:"click_retention_days,omitempty" bson:"click_retention_days,omitempty" validate:"omitempty,min=1,max=36500"`
+}
+
+// DefaultExpiration returns expiration date of URL created at given time, it
+// returns nil when user has no default
+func (s *UserSettings) DefaultExpiration(now time.Time) *time.Time {
+	if s.DefaultExpirationDays <= 0 {
+		return nil
+	}
+	expDate := now.AddDate(0, 0, s.DefaultExpirationDays)
+	return &expDate
+}
+
+// User statuses used for filtering
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+)
+
+// IsDisabled returns true if the user account is disabled
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// DeletionReason is the disabled reason of accounts whose users requested
+// their deletion
+const DeletionReason = "account deletion requested"
+
+// IsDeletionScheduled returns true if the user requested deletion of the
+// account and it was not deleted yet
+func (u *User) IsDeletionScheduled() bool {
+	return u.DeleteAfter != nil
+}
+
+// IsBeingDeleted returns true if sweeper started deleting the account
+func (u *User) IsBeingDeleted() bool {
+	return u.DeletingAt != nil
+}
+
+// User types, users have no type stored. Service accounts can't log in with
+// password, they authenticate with API keys only.
+const (
+	UserTypeUser    = "user"
+	UserTypeService = "service"
+)
+
+// IsService returns true if the user is a service account
+func (u *User) IsService() bool {
+	return u.Type == UserTypeService
+}
+
+// ServiceAccountEmailDomain is the domain of emails generated for service
+// accounts, they are unique and can't receive mail
+const ServiceAccountEmailDomain = "service.invalid"
+
+// CreateServiceAccount represents data to create new service account
+type CreateServiceAccount struct {
+	Name string `json:"name" validate:"required,max=30"`
 }
 
 // CreateUser represents data to create new User
@@ -25,6 +137,14 @@ type CreateUser struct {
 	FullName string `json:"full_name" validate:"omitempty,max=30"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=8,max=30"`
+	// TOSVersion is the terms of service version the user accepts, it must
+	// be the current one when terms of service are configured
+	TOSVersion string `json:"tos_version" validate:"max=64"`
+}
+
+// AcceptTOS represents request to accept terms of service of given version
+type AcceptTOS struct {
+	Version string `json:"tos_version" validate:"required,max=64"`
 }
 
 // UpdateUser represents data to update User
@@ -36,6 +156,58 @@ type UpdateUser struct {
 	NewPassword     *string            `json:"new_password" validate:"omitempty,min=8,max=30"`
 }
 
+// DisableUser represents data to disable User
+type DisableUser struct {
+	Reason string `json:"reason" validate:"required,max=200"`
+}
+
+// DefaultUserPageLimit is the number of users listed when filter has no limit
+const DefaultUserPageLimit = 20
+
+// UserFilter represents parameters to list users. Cursor lists users after
+// given id, Before lists users before given id, they can't be used together.
+type UserFilter struct {
+	Status string `json:"status" query:"status" validate:"omitempty,oneof=active disabled"`
+	Type   string `json:"type" query:"type" validate:"omitempty,oneof=user service"`
+	Cursor string `json:"cursor" query:"cursor" validate:"omitempty,len=24,hexadecimal"`
+	Before string `json:"before" query:"before" validate:"omitempty,len=24,hexadecimal,excluded_with=Cursor"`
+	Limit  int64  `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	// WithCount requests total number of users matching the filter
+	WithCount bool `json:"with_count" query:"with_count"`
+	// ClickRetention is set by usecase to fetch only users with click
+	// retention set
+	ClickRetention bool `json:"-" query:"-"`
+}
+
+// IntrospectToken represents token introspection request (RFC 7662),
+// TokenTypeHint is accepted but ignored as only access tokens are issued
+type IntrospectToken struct {
+	Token         string `json:"token" form:"token" validate:"required"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+}
+
+// TokenIntrospection represents token introspection response (RFC 7662),
+// only Active is set for inactive tokens
+type TokenIntrospection struct {
+	Active       bool     `json:"active"`
+	Subject      string   `json:"sub,omitempty"`
+	Scope        string   `json:"scope,omitempty"`
+	Roles        []string `json:"roles,omitempty"`
+	TokenType    string   `json:"token_type,omitempty"`
+	ExpiresAt    int64    `json:"exp,omitempty"`
+	IssuedAt     int64    `json:"iat,omitempty"`
+	Impersonator string   `json:"impersonator,omitempty"`
+}
+
+// UserPage represents a page of users
+type UserPage struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	PrevCursor string  `json:"prev_cursor,omitempty"`
+	// Total is set when filter requests count
+	Total *int64 `json:"total,omitempty"`
+}
+
 // UserUsecase represents the User's usecases
 type UserUsecase interface {
 	GetByID(ctx context.Context, id string) (*User, error)
@@ -43,13 +215,99 @@ type UserUsecase interface {
 	Create(ctx context.Context, user CreateUser) (*User, error)
 	Delete(ctx context.Context, id string) error
 	Authenticate(ctx context.Context, now time.Time, email, password string) (*auth.Claims, error)
+	Impersonate(ctx context.Context, now time.Time, id string, admin *auth.Claims) (*auth.Claims, error)
+	Disable(ctx context.Context, id string, disableUser DisableUser, admin *auth.Claims) error
+	Enable(ctx context.Context, id string) error
+	Fetch(ctx context.Context, filter UserFilter) (*UserPage, error)
+	GrantRole(ctx context.Context, email string, role string) (*User, error)
+	// UpdateSettings replaces settings of the user and returns them
+	UpdateSettings(ctx context.Context, settings UserSettings, claims *auth.Claims) (*UserSettings, error)
+	// CreateServiceAccount creates service account, it has no password and
+	// no roles
+	CreateServiceAccount(ctx context.Context, account CreateServiceAccount) (*User, error)
+	// Introspect reports whether claims of valid token are still active,
+	// tokens of deleted or disabled users are not
+	Introspect(ctx context.Context, claims *auth.Claims) (*TokenIntrospection, error)
+	// ForcePasswordReset requires the user to change password, tokens issued
+	// until then are accepted only for password change
+	ForcePasswordReset(ctx context.Context, id string) error
+	// VerifyPassword returns user with given credentials, unlike
+	// Authenticate it doesn't reject disabled users
+	VerifyPassword(ctx context.Context, email, password string) (*User, error)
+	// AcceptTOS records that the user accepted terms of service of given
+	// version
+	AcceptTOS(ctx context.Context, version string, claims *auth.Claims) (*User, error)
+}
+
+// NotificationAccountDeletion is the template of email sent when user
+// requests deletion of the account
+const NotificationAccountDeletion = "account_deletion"
+
+// AccountDeletion represents data of email sent when user requests deletion
+// of the account, account is restored by opening CancelLink before
+// DeleteAfter
+type AccountDeletion struct {
+	Name        string
+	DeleteAfter time.Time
+	CancelLink  string
+}
+
+// CancelDeletion represents request to cancel deletion of account, Token is
+// cancellation token from deletion email, requests without it authenticate
+// with password
+type CancelDeletion struct {
+	Token string `json:"token"`
+}
+
+// AccountDeletionUsecase deletes accounts on request of their users after
+// grace period, accounts are disabled during it and can be restored
+type AccountDeletionUsecase interface {
+	// Schedule disables account of the user, schedules its deletion and
+	// emails cancellation link to the user
+	Schedule(ctx context.Context, claims *auth.Claims) (*User, error)
+	// Cancel restores account of the user with given id
+	Cancel(ctx context.Context, id string) error
+	// CancelWithToken restores account with cancellation token from deletion
+	// email
+	CancelWithToken(ctx context.Context, token string) error
+}
+
+// PasswordHasher hashes passwords with configured scheme and verifies hashes
+// of all supported schemes
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns nil when password matches the hash
+	Verify(hash, password string) error
+	// NeedsRehash reports whether hash was made with other scheme or
+	// parameters than configured ones
+	NeedsRehash(hash string) bool
 }
 
 // UserRepository represents the User's repository contract
 type UserRepository interface {
+	HealthChecker
 	GetByID(ctx context.Context, id primitive.ObjectID) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
+	// Restore replaces user unless sweeper started deleting it,
+	// ErrNoAffected is returned then
+	Restore(ctx context.Context, user *User) error
+	// UpdatePasswordHash replaces password hash of the user unless password
+	// was changed since oldHash was read, ErrNoAffected is returned then
+	UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error
 	Create(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id primitive.ObjectID) error
+	// ClaimDeletion marks user whose deletion was scheduled before now as
+	// being deleted, so it can't be restored. ErrNoAffected is returned when
+	// deletion is not scheduled before now, e.g. it was canceled
+	ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	// DeleteScheduled deletes user unless deletion is not scheduled before
+	// now, e.g. it was canceled, ErrNoAffected is returned then
+	DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error
+	Fetch(ctx context.Context, filter UserFilter) ([]*User, error)
+	// Count returns number of users matching the filter, cursors are ignored
+	Count(ctx context.Context, filter UserFilter) (int64, error)
+	// FetchDeletable returns up to limit users whose deletion was scheduled
+	// before now, earliest first
+	FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*User, error)
 }
@@ -0,0 +1,24 @@
+package event
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+type logPublisher struct {
+	logger *zap.Logger
+}
+
+// NewLogPublisher creates publisher that only logs events, it is used when no
+// webhook is configured
+func NewLogPublisher(logger *zap.Logger) domain.EventPublisher {
+	return &logPublisher{logger: logger}
+}
+
+func (p *logPublisher) Publish(ctx context.Context, event domain.Event) error {
+	p.logger.Info("event published", zap.String("type", event.Type), zap.Time("occurred_at", event.OccurredAt), zap.Any("data", event.Data))
+	return nil
+}
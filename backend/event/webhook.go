@@ -0,0 +1,95 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/httpclient"
+)
+
+// DefaultWebhookTimeout is the webhook request timeout in milliseconds used
+// when WebhookConfig.Timeout is not set
+const DefaultWebhookTimeout = 5000
+
+// SignatureHeader carries hex encoded HMAC-SHA256 of request body keyed with
+// webhook secret
+const SignatureHeader = "X-Shortener-Signature"
+
+// EventHeader carries type of the event
+const EventHeader = "X-Shortener-Event"
+
+// WebhookConfig stores webhook configuration, webhook is disabled when URL is
+// empty
+type WebhookConfig struct {
+	// URL receives events as JSON in POST requests
+	URL string `yaml:"url"`
+	// Secret signs request bodies, requests are not signed when it is empty
+	Secret string `yaml:"secret"`
+	// Timeout is the request timeout in milliseconds
+	Timeout int `yaml:"timeout_ms"`
+}
+
+type webhookDispatcher struct {
+	client *http.Client
+	cfg    WebhookConfig
+}
+
+// NewWebhookDispatcher creates publisher that posts events to webhook,
+// event is published when webhook responds with 2xx status. Requests are made
+// by client created by clients.
+func NewWebhookDispatcher(cfg WebhookConfig, clients *httpclient.Factory) domain.EventPublisher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultWebhookTimeout
+	}
+
+	return &webhookDispatcher{
+		client: clients.Client(time.Duration(cfg.Timeout) * time.Millisecond),
+		cfg:    cfg,
+	}
+}
+
+func (d *webhookDispatcher) Publish(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("can't marshal %s event: %w", event.Type, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("can't create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Type)
+	if d.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(body, d.cfg.Secret))
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request error: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %d status", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body keyed with secret
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,86 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/event"
+	"github.com/semka95/shortener/backend/httpclient"
+)
+
+var clients = httpclient.NewFactory(httpclient.Config{}, sdktrace.NewTracerProvider().Tracer(""))
+
+func TestWebhookDispatcher(t *testing.T) {
+	expired := domain.Event{
+		Type:       domain.EventURLExpired,
+		OccurredAt: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+		Data:       domain.URLExpired{ID: "test123", Link: "https://www.example.org", Clicks: 42},
+	}
+
+	t.Run("signed event", func(t *testing.T) {
+		var body []byte
+		var header http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			header = r.Header
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer srv.Close()
+		d := event.NewWebhookDispatcher(event.WebhookConfig{URL: srv.URL, Secret: "secret"}, clients)
+
+		err := d.Publish(context.Background(), expired)
+		require.NoError(t, err)
+
+		assert.Equal(t, domain.EventURLExpired, header.Get(event.EventHeader))
+		assert.Equal(t, event.Sign(body, "secret"), header.Get(event.SignatureHeader))
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &got))
+		assert.Equal(t, "url.expired", got["type"])
+		assert.Equal(t, "2023-05-01T12:00:00Z", got["occurred_at"])
+		assert.Equal(t, map[string]interface{}{
+			"id":              "test123",
+			"link":            "https://www.example.org",
+			"expiration_date": "0001-01-01T00:00:00Z",
+			"clicks":          float64(42),
+		}, got["data"])
+	})
+
+	t.Run("unsigned event", func(t *testing.T) {
+		var header http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+		}))
+		defer srv.Close()
+		d := event.NewWebhookDispatcher(event.WebhookConfig{URL: srv.URL}, clients)
+
+		err := d.Publish(context.Background(), expired)
+		require.NoError(t, err)
+		assert.Empty(t, header.Get(event.SignatureHeader))
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+		d := event.NewWebhookDispatcher(event.WebhookConfig{URL: srv.URL}, clients)
+
+		err := d.Publish(context.Background(), expired)
+		assert.ErrorContains(t, err, "503")
+	})
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"type":"url.expired"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "153d9b50b3cc2a83a5e6c808bdff45c7c80c35ccf18aa6b5b84aeffba9bcb96e", event.Sign([]byte(`{"type":"url.expired"}`), "secret"))
+}
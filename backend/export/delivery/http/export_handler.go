@@ -0,0 +1,187 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// downloadPath is the path of download endpoint, its links are given away, so
+// it doesn't change with API version
+const downloadPath = "/v1/download/"
+
+// contentTypes maps export formats to content types of downloads
+var contentTypes = map[string]string{
+	domain.ExportFormatCSV:    "text/csv; charset=utf-8",
+	domain.ExportFormatNDJSON: web.MIMEApplicationNDJSON,
+}
+
+// ExportHandler represent the http handler for exports
+type ExportHandler struct {
+	exportUsecase domain.ExportUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+}
+
+// NewExportHandler will initialize the export resources and download endpoint
+func NewExportHandler(eu domain.ExportUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) *ExportHandler {
+	return &ExportHandler{
+		exportUsecase: eu,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+	}
+}
+
+// RegisterRoutes registers routes for a path with matching handler, download
+// endpoint is authenticated by its token only, so it can be handed to wget
+func (eh *ExportHandler) RegisterRoutes(e *echo.Echo) {
+	eh.RegisterAPIRoutes(e.Group("/v1"))
+	e.GET(downloadPath+":token", eh.Download)
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2
+func (eh *ExportHandler) RegisterAPIRoutes(g *echo.Group) {
+	g.GET("/export/urls", eh.ExportURLs, echojwt.WithConfig(eh.authenticator.JWTConfig))
+}
+
+// ExportURLs will return signed download link of export of user's URLs
+// matching query parameters, the link is valid for domain.DownloadTTL
+func (eh *ExportHandler) ExportURLs(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := eh.tracer.Start(
+		ctx,
+		"http ExportURLs",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	export := new(domain.URLExport)
+	if err := c.Bind(export); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(export); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(eh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	params, err := json.Marshal(export)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("%w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	now := time.Now()
+	// token expiry has seconds precision
+	expiresAt := now.Add(domain.DownloadTTL).Truncate(time.Second).UTC()
+	downloadToken, err := eh.authenticator.GenerateDownloadToken(auth.NewDownloadClaims(domain.ExportURLs, user.Subject, params, now, expiresAt))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("%w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	span.SetAttributes(attribute.String("format", export.Format))
+	span.SetStatus(codes.Ok, "success")
+
+	return web.Respond(c, http.StatusOK, domain.Download{Token: downloadToken, Path: downloadPath + downloadToken, ExpiresAt: expiresAt})
+}
+
+// Download will stream export signed into token without authentication,
+// expired token gets 410
+func (eh *ExportHandler) Download(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := eh.tracer.Start(
+		ctx,
+		"http Download",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// token is the only credential, so it must not leak to other sites or
+	// caches
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set(echo.HeaderReferrerPolicy, "no-referrer")
+	c.Response().Header().Set("X-Robots-Tag", "noindex")
+
+	claims, err := eh.authenticator.ParseDownloadClaims(c.Param("token"))
+	if errors.Is(err, auth.ErrDownloadExpired) {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusGone, domain.ResponseError{Error: err.Error()})
+	}
+	if err != nil || claims.Export != domain.ExportURLs {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusNotFound, domain.ResponseError{Error: "download was not found"})
+	}
+
+	export := new(domain.URLExport)
+	if err = json.Unmarshal(claims.Params, export); err == nil {
+		err = c.Validate(export)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusNotFound, domain.ResponseError{Error: "download was not found"})
+	}
+	span.SetAttributes(
+		attribute.String("format", export.Format),
+		attribute.String("userid", claims.Subject),
+	)
+
+	// headers are sent with the first batch, so error reading it is still
+	// responded with error status
+	c.Response().Header().Set(echo.HeaderContentType, contentTypes[export.Format])
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", domain.ExportURLs+"."+export.Format))
+	err = eh.exportUsecase.ExportURLs(ctx, *export, claims.Subject, c.Response())
+	if err != nil && !c.Response().Committed {
+		span.RecordError(err)
+		c.Response().Header().Del(echo.HeaderContentDisposition)
+		return web.RespondError(c, domain.GetStatusCode(err, eh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	if err != nil {
+		// client sees truncated download
+		span.RecordError(err)
+		eh.logger.Error("export download failed", zap.Error(err), zap.String("userid", claims.Subject))
+		return nil
+	}
+	span.SetStatus(codes.Ok, "success")
+
+	return nil
+}
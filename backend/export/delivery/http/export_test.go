@@ -0,0 +1,190 @@
+package http_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	exportHttp "github.com/semka95/shortener/backend/export/delivery/http"
+	"github.com/semka95/shortener/backend/export/mock"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type exportStack struct {
+	e             *echo.Echo
+	uc            *mock.MockExportUsecase
+	authenticator *auth.Authenticator
+	claims        *auth.Claims
+	token         string
+}
+
+func newExportStack(t *testing.T) *exportStack {
+	t.Helper()
+	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+	uc := mock.NewMockExportUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	exportHttp.NewExportHandler(uc, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer("")).RegisterRoutes(e)
+
+	return &exportStack{e: e, uc: uc, authenticator: authenticator, claims: claims, token: token}
+}
+
+func (s *exportStack) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// downloadToken signs download of export with params
+func (s *exportStack) downloadToken(t *testing.T, export, params string, expiresAt time.Time) string {
+	t.Helper()
+	tkn, err := s.authenticator.GenerateDownloadToken(auth.NewDownloadClaims(export, s.claims.Subject, json.RawMessage(params), expiresAt.Add(-domain.DownloadTTL), expiresAt))
+	require.NoError(t, err)
+	return tkn
+}
+
+func TestExportHTTPExportURLs(t *testing.T) {
+	s := newExportStack(t)
+
+	get := func(query string, authorized bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/v1/export/urls?"+query, nil)
+		if authorized {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+s.token)
+		}
+		return s.serve(req)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		rec := get("format=csv&status=active&q=example", true)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		body := new(domain.Download)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, "/v1/download/"+body.Token, body.Path)
+		assert.WithinDuration(t, time.Now().Add(domain.DownloadTTL), body.ExpiresAt, 2*time.Second)
+
+		claims, err := s.authenticator.ParseDownloadClaims(body.Token)
+		require.NoError(t, err)
+		assert.Equal(t, domain.ExportURLs, claims.Export)
+		assert.Equal(t, s.claims.Subject, claims.Subject)
+		assert.JSONEq(t, `{"format":"csv","status":"active","q":"example"}`, string(claims.Params))
+		assert.Equal(t, body.ExpiresAt, claims.ExpiresAt.Time.UTC())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		rec := get("format=xml", true)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := get("format=csv", false)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestExportHTTPDownload(t *testing.T) {
+	s := newExportStack(t)
+	expiresAt := time.Now().Add(domain.DownloadTTL)
+
+	get := func(token string) *httptest.ResponseRecorder {
+		return s.serve(httptest.NewRequest(echo.GET, "/v1/download/"+token, nil))
+	}
+
+	t.Run("success", func(t *testing.T) {
+		tkn := s.downloadToken(t, domain.ExportURLs, `{"format":"csv","status":"active"}`, expiresAt)
+		s.uc.EXPECT().ExportURLs(gomock.Any(), domain.URLExport{Format: domain.ExportFormatCSV, Status: "active"}, s.claims.Subject, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ domain.URLExport, _ string, w io.Writer) error {
+				_, err := io.WriteString(w, "id,link\n")
+				return err
+			})
+
+		rec := get(tkn)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "id,link\n", rec.Body.String())
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename="urls.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		tkn := s.downloadToken(t, domain.ExportURLs, `{"format":"csv"}`, time.Now().Add(-time.Minute))
+
+		rec := get(tkn)
+		assert.Equal(t, http.StatusGone, rec.Code)
+	})
+
+	t.Run("user token", func(t *testing.T) {
+		rec := get(s.token)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("unknown export", func(t *testing.T) {
+		tkn := s.downloadToken(t, "clicks", `{"format":"csv"}`, expiresAt)
+
+		rec := get(tkn)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		tkn := s.downloadToken(t, domain.ExportURLs, `{"format":"xml"}`, expiresAt)
+
+		rec := get(tkn)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("error before first batch", func(t *testing.T) {
+		tkn := s.downloadToken(t, domain.ExportURLs, `{"format":"ndjson"}`, expiresAt)
+		s.uc.EXPECT().ExportURLs(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+
+		rec := get(tkn)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentDisposition))
+	})
+
+	t.Run("error after first batch", func(t *testing.T) {
+		tkn := s.downloadToken(t, domain.ExportURLs, `{"format":"ndjson"}`, expiresAt)
+		s.uc.EXPECT().ExportURLs(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ domain.URLExport, _ string, w io.Writer) error {
+				_, err := io.WriteString(w, "{}\n")
+				require.NoError(t, err)
+				return domain.ErrInternalServerError
+			})
+
+		rec := get(tkn)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "{}\n", rec.Body.String())
+	})
+}
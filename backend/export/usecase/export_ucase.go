@@ -0,0 +1,192 @@
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// exportBatch is the number of URLs read from repository at once
+const exportBatch = 500
+
+// csvHeader lists columns of CSV export, fields of NDJSON export have the
+// same names
+var csvHeader = []string{"id", "link", "domain", "status", "clicks", "expiration_date", "created_at", "source"}
+
+type exportUsecase struct {
+	urlRepo        domain.URLRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+}
+
+// NewExportUsecase will create new an exportUsecase object representation of domain.ExportUsecase interface
+func NewExportUsecase(u domain.URLRepository, timeout time.Duration, tracer trace.Tracer) domain.ExportUsecase {
+	return &exportUsecase{
+		urlRepo:        u,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+	}
+}
+
+// ExportURLs runs longer than other usecases, so timeout is applied to every
+// batch of URLs instead of the whole export
+func (uc *exportUsecase) ExportURLs(c context.Context, export domain.URLExport, userID string, w io.Writer) error {
+	ctx, span := uc.tracer.Start(
+		c,
+		"usecase ExportURLs",
+		trace.WithAttributes(
+			attribute.String("format", export.Format)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// repository lists URLs of all users when owner is not set
+	if userID == "" {
+		err := fmt.Errorf("export of URLs without owner: %w", domain.ErrBadParamInput)
+		span.RecordError(err)
+		return err
+	}
+
+	enc, err := newURLEncoder(export.Format, w)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	filter := domain.URLFilter{
+		Domain:        export.Domain,
+		CreatedAfter:  export.CreatedAfter,
+		CreatedBefore: export.CreatedBefore,
+		Status:        export.Status,
+		Source:        export.Source,
+		Q:             export.Q,
+		Limit:         exportBatch,
+		OwnerID:       userID,
+	}
+	exported := 0
+	for {
+		urls, err := uc.fetch(ctx, filter)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		now := time.Now()
+		for _, u := range urls {
+			if err = enc.Encode(newExportedURL(u, now)); err != nil {
+				span.RecordError(err)
+				return fmt.Errorf("can't write URL export: %w", err)
+			}
+		}
+		// written batch is sent to client while the next one is read
+		if err = enc.Flush(); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("can't write URL export: %w", err)
+		}
+		exported += len(urls)
+
+		if len(urls) < exportBatch {
+			span.SetAttributes(attribute.Int("exported", exported))
+			return nil
+		}
+		filter.Cursor = urls[len(urls)-1].ID
+	}
+}
+
+func (uc *exportUsecase) fetch(c context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	return uc.urlRepo.Fetch(ctx, filter)
+}
+
+// exportedURL represents URL written to export
+type exportedURL struct {
+	ID             string    `json:"id"`
+	Link           string    `json:"link"`
+	Domain         string    `json:"domain"`
+	Status         string    `json:"status"`
+	Clicks         int64     `json:"clicks"`
+	ExpirationDate time.Time `json:"expiration_date"`
+	CreatedAt      time.Time `json:"created_at"`
+	Source         string    `json:"source"`
+}
+
+func newExportedURL(u *domain.AdminURL, now time.Time) *exportedURL {
+	return &exportedURL{
+		ID:             u.ID,
+		Link:           u.Link,
+		Domain:         u.Domain,
+		Status:         u.URL.Status(now),
+		Clicks:         u.Clicks,
+		ExpirationDate: u.ExpirationDate.UTC(),
+		CreatedAt:      u.CreatedAt.UTC(),
+		Source:         u.Creation.Source,
+	}
+}
+
+// urlEncoder writes URLs in export format
+type urlEncoder interface {
+	Encode(u *exportedURL) error
+	Flush() error
+}
+
+func newURLEncoder(format string, w io.Writer) (urlEncoder, error) {
+	switch format {
+	case domain.ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, fmt.Errorf("can't write URL export: %w", err)
+		}
+		return &csvEncoder{w: cw}, nil
+	case domain.ExportFormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %s: %w", format, domain.ErrBadParamInput)
+	}
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Encode(u *exportedURL) error {
+	return e.w.Write([]string{
+		u.ID,
+		u.Link,
+		u.Domain,
+		u.Status,
+		strconv.FormatInt(u.Clicks, 10),
+		u.ExpirationDate.Format(time.RFC3339),
+		u.CreatedAt.Format(time.RFC3339),
+		u.Source,
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes every URL as JSON object on its own line
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(u *exportedURL) error {
+	return e.enc.Encode(u)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
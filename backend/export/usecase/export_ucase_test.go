@@ -0,0 +1,94 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/export/usecase"
+	"github.com/semka95/shortener/backend/url/mock"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+func TestExportUsecase_ExportURLs(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockURLRepository(controller)
+	uc := usecase.NewExportUsecase(repository, 10*time.Second, tracer)
+	userID := "507f191e810c19729de860ea"
+	created := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	newURL := func(id string) *domain.AdminURL {
+		return &domain.AdminURL{
+			URL: domain.URL{
+				ID:             id,
+				Link:           "https://example.com/" + id,
+				ExpirationDate: time.Now().AddDate(1, 0, 0).Truncate(time.Second),
+				UserID:         userID,
+				CreatedAt:      created,
+				Creation:       domain.CreationInfo{Source: domain.URLSourceAPI},
+			},
+			Clicks: 3,
+		}
+	}
+
+	t.Run("csv in batches", func(t *testing.T) {
+		first := make([]*domain.AdminURL, 500)
+		for i := range first {
+			first[i] = newURL(fmt.Sprintf("url%03d", i))
+		}
+		last := newURL("url500")
+		last.Domain = "go.example.com"
+		filter := domain.URLFilter{Status: "active", Source: domain.URLSourceAPI, Limit: 500, OwnerID: userID}
+		gomock.InOrder(
+			repository.EXPECT().Fetch(gomock.Any(), filter).Return(first, nil),
+			repository.EXPECT().Fetch(gomock.Any(), domain.URLFilter{Status: "active", Source: domain.URLSourceAPI, Limit: 500, OwnerID: userID, Cursor: "url499"}).Return([]*domain.AdminURL{last}, nil),
+		)
+
+		buf := new(bytes.Buffer)
+		err := uc.ExportURLs(context.Background(), domain.URLExport{Format: domain.ExportFormatCSV, Status: "active", Source: domain.URLSourceAPI}, userID, buf)
+
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 502)
+		assert.Equal(t, "id,link,domain,status,clicks,expiration_date,created_at,source", lines[0])
+		assert.Equal(t, fmt.Sprintf("url500,https://example.com/url500,go.example.com,active,3,%s,2023-03-01T12:00:00Z,api", last.ExpirationDate.UTC().Format(time.RFC3339)), lines[501])
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		u := newURL("test123")
+		repository.EXPECT().Fetch(gomock.Any(), domain.URLFilter{Limit: 500, OwnerID: userID}).Return([]*domain.AdminURL{u}, nil)
+
+		buf := new(bytes.Buffer)
+		err := uc.ExportURLs(context.Background(), domain.URLExport{Format: domain.ExportFormatNDJSON}, userID, buf)
+
+		require.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`{"id":"test123","link":"https://example.com/test123","domain":"","status":"active","clicks":3,"expiration_date":%q,"created_at":"2023-03-01T12:00:00Z","source":"api"}`, u.ExpirationDate.UTC().Format(time.RFC3339)), buf.String())
+	})
+
+	t.Run("fetch error", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, domain.ErrInternalServerError)
+
+		buf := new(bytes.Buffer)
+		err := uc.ExportURLs(context.Background(), domain.URLExport{Format: domain.ExportFormatCSV}, userID, buf)
+
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Empty(t, buf.String(), "nothing is written before the first batch is read")
+	})
+
+	t.Run("no owner", func(t *testing.T) {
+		err := uc.ExportURLs(context.Background(), domain.URLExport{Format: domain.ExportFormatCSV}, "", new(bytes.Buffer))
+
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+}
@@ -0,0 +1,110 @@
+// Package featureflag tells whether features being rolled out are enabled.
+// Flags are either on for everyone or for percentage of users, users are
+// bucketed by hash of their id, so user keeps seeing feature as long as
+// percentage is not lowered.
+package featureflag
+
+import (
+	"context"
+	"hash/fnv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Flags of features
+const (
+	// IDPool takes ids of created URLs from pool of checked ids
+	IDPool = "url.id_pool"
+	// TemporaryRedirect redirects to URLs with 302, so browsers don't cache
+	// redirects and every click is counted, it is rolled out by URL owner
+	TemporaryRedirect = "url.temporary_redirect"
+)
+
+// Defaults are flags of features missing from configuration, e.g. features
+// that are already rolled out but may still be switched off
+var Defaults = Config{
+	IDPool: {Enabled: true},
+}
+
+// Flags tells whether feature is enabled. Evaluations are recorded as events
+// of span of ctx.
+type Flags interface {
+	// Enabled tells whether flag is on for everyone
+	Enabled(ctx context.Context, flag string) bool
+	// EnabledFor tells whether flag is on for user, anonymous users only see
+	// flags on for everyone
+	EnabledFor(ctx context.Context, flag, userID string) bool
+}
+
+// Flag is configuration of feature flag
+type Flag struct {
+	// Enabled switches flag on for everyone
+	Enabled bool `yaml:"enabled"`
+	// Percentage is the percentage of users flag is on for, 0 to 100
+	Percentage int `yaml:"percentage"`
+}
+
+// Config stores flags by their name, missing flags have their default or are
+// off
+type Config map[string]Flag
+
+// Settings stores configuration of feature flags, flags are read from File
+// when it is set and Flags are ignored then
+type Settings struct {
+	Flags Config `yaml:"flags"`
+	File  string `yaml:"file"`
+	// WatchInterval is the interval of File modification checks in seconds
+	WatchInterval int `yaml:"watch_interval_seconds"`
+}
+
+// DefaultWatchInterval is the interval of flags file modification checks in
+// seconds used when Settings.WatchInterval is not set
+const DefaultWatchInterval = 30
+
+// Static serves flags of fixed configuration
+type Static struct {
+	cfg Config
+}
+
+// NewStatic creates Static, flags missing from cfg have their default
+func NewStatic(cfg Config) *Static {
+	flags := make(Config, len(Defaults)+len(cfg))
+	for name, f := range Defaults {
+		flags[name] = f
+	}
+	for name, f := range cfg {
+		flags[name] = f
+	}
+
+	return &Static{cfg: flags}
+}
+
+// Enabled implements Flags
+func (s *Static) Enabled(ctx context.Context, flag string) bool {
+	return s.EnabledFor(ctx, flag, "")
+}
+
+// EnabledFor implements Flags
+func (s *Static) EnabledFor(ctx context.Context, flag, userID string) bool {
+	f := s.cfg[flag]
+	on := f.Enabled || userID != "" && Bucket(flag, userID) < f.Percentage
+
+	trace.SpanFromContext(ctx).AddEvent("feature_flag", trace.WithAttributes(
+		attribute.String("feature_flag.key", flag),
+		attribute.Bool("feature_flag.enabled", on),
+	))
+
+	return on
+}
+
+// Bucket returns bucket of user from 0 to 99, flags rolled out to percentage
+// of users are on for buckets below percentage. Buckets of user differ by
+// flag, so the same users don't get every new feature first.
+func Bucket(flag, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	return int(h.Sum32() % 100)
+}
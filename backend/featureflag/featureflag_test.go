@@ -0,0 +1,91 @@
+package featureflag_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/semka95/shortener/backend/featureflag"
+)
+
+const flag = "test.flag"
+
+func TestStatic_Defaults(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, featureflag.NewStatic(nil).Enabled(ctx, featureflag.IDPool))
+	assert.False(t, featureflag.NewStatic(nil).Enabled(ctx, featureflag.TemporaryRedirect))
+	assert.False(t, featureflag.NewStatic(nil).Enabled(ctx, flag))
+
+	flags := featureflag.NewStatic(featureflag.Config{featureflag.IDPool: {}})
+	assert.False(t, flags.Enabled(ctx, featureflag.IDPool))
+	assert.True(t, featureflag.Defaults[featureflag.IDPool].Enabled, "defaults are not changed")
+}
+
+func TestStatic_Percentage(t *testing.T) {
+	ctx := context.Background()
+	users := make([]string, 1000)
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+	}
+
+	enabled := func(percentage int) map[string]bool {
+		flags := featureflag.NewStatic(featureflag.Config{flag: {Percentage: percentage}})
+		on := make(map[string]bool)
+		for _, user := range users {
+			if flags.EnabledFor(ctx, flag, user) {
+				on[user] = true
+			}
+		}
+		return on
+	}
+
+	assert.Empty(t, enabled(0))
+	assert.Len(t, enabled(100), len(users))
+
+	// users keep feature while it is rolled out to more of them
+	ten, fifty := enabled(10), enabled(50)
+	assert.InDelta(t, 100, len(ten), 40)
+	assert.InDelta(t, 500, len(fifty), 80)
+	for user := range ten {
+		assert.True(t, fifty[user], "user %s lost feature", user)
+	}
+
+	assert.False(t, featureflag.NewStatic(featureflag.Config{flag: {Percentage: 100}}).EnabledFor(ctx, flag, ""), "anonymous user")
+	assert.True(t, featureflag.NewStatic(featureflag.Config{flag: {Enabled: true}}).EnabledFor(ctx, flag, ""))
+}
+
+func TestBucket(t *testing.T) {
+	assert.Equal(t, featureflag.Bucket(flag, "user"), featureflag.Bucket(flag, "user"))
+
+	differ := false
+	for i := 0; i < 100 && !differ; i++ {
+		user := fmt.Sprintf("user%d", i)
+		b := featureflag.Bucket(flag, user)
+		require.True(t, b >= 0 && b < 100)
+		differ = b != featureflag.Bucket("other.flag", user)
+	}
+	assert.True(t, differ, "buckets of users are the same for every flag")
+}
+
+func TestStatic_SpanEvent(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("")
+
+	ctx, span := tracer.Start(context.Background(), "test")
+	featureflag.NewStatic(featureflag.Config{flag: {Enabled: true}}).Enabled(ctx, flag)
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Len(t, spans[0].Events, 1)
+	event := spans[0].Events[0]
+	assert.Equal(t, "feature_flag", event.Name)
+	assert.Contains(t, event.Attributes, attribute.String("feature_flag.key", flag))
+	assert.Contains(t, event.Attributes, attribute.Bool("feature_flag.enabled", true))
+}
@@ -0,0 +1,101 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// File serves flags read from YAML file of Config and reloads them when file
+// is modified, so flags are changed without restart
+type File struct {
+	path   string
+	logger *zap.Logger
+	flags  atomic.Pointer[Static]
+	// modTime is modification time of loaded file, it is only used by Watch
+	modTime time.Time
+}
+
+// NewFile reads flags from file and creates File
+func NewFile(path string, logger *zap.Logger) (*File, error) {
+	f := &File{
+		path:   path,
+		logger: logger,
+	}
+
+	modTime, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	f.modTime = modTime
+
+	return f, nil
+}
+
+// load reads flags from file and returns its modification time
+func (f *File) load() (time.Time, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't stat feature flags file: %w", err)
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't read feature flags file: %w", err)
+	}
+
+	cfg := make(Config)
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return time.Time{}, fmt.Errorf("can't parse feature flags file: %w", err)
+	}
+	f.flags.Store(NewStatic(cfg))
+
+	return info.ModTime(), nil
+}
+
+// Enabled implements Flags
+func (f *File) Enabled(ctx context.Context, flag string) bool {
+	return f.flags.Load().Enabled(ctx, flag)
+}
+
+// EnabledFor implements Flags
+func (f *File) EnabledFor(ctx context.Context, flag, userID string) bool {
+	return f.flags.Load().EnabledFor(ctx, flag, userID)
+}
+
+// Watch polls file for changes every interval until context is canceled,
+// flags are kept when modified file can't be read
+func (f *File) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(f.path)
+			if err != nil {
+				f.logger.Error("can't check feature flags file", zap.Error(err))
+				continue
+			}
+			if !info.ModTime().After(f.modTime) {
+				continue
+			}
+
+			modTime, err := f.load()
+			if err != nil {
+				f.logger.Error("can't reload feature flags, keeping previous ones", zap.Error(err))
+				// file is not read again until it is modified
+				f.modTime = info.ModTime()
+				continue
+			}
+			f.modTime = modTime
+			f.logger.Info("feature flags reloaded")
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package featureflag_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/featureflag"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	write := func(data string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	_, err := featureflag.NewFile(path, zap.NewNop())
+	assert.Error(t, err)
+
+	now := time.Now()
+	write("test.flag:\n  enabled: true\n", now)
+	f, err := featureflag.NewFile(path, zap.NewNop())
+	require.NoError(t, err)
+	assert.True(t, f.Enabled(ctx, flag))
+	assert.True(t, f.Enabled(ctx, featureflag.IDPool), "missing flags have their default")
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		f.Watch(watchCtx, time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	write("test.flag:\n  enabled: false\n", now.Add(time.Second))
+	require.Eventually(t, func() bool { return !f.Enabled(ctx, flag) }, time.Second, time.Millisecond)
+
+	// flags are kept when file is broken
+	write("test.flag: [", now.Add(2*time.Second))
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, f.Enabled(ctx, flag))
+	assert.True(t, f.Enabled(ctx, featureflag.IDPool))
+
+	write("test.flag:\n  enabled: true\n", now.Add(3*time.Second))
+	require.Eventually(t, func() bool { return f.Enabled(ctx, flag) }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,163 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/web"
+)
+
+// Default values used when Config fields are not set
+const (
+	DefaultTimeout             = 10000
+	DefaultDialTimeout         = 5000
+	DefaultTLSHandshakeTimeout = 5000
+	DefaultIdleConnTimeout     = 90000
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 10
+)
+
+// MaxRedirects is the number of redirects clients follow
+const MaxRedirects = 5
+
+// ErrPrivateAddress is returned when redirect leads to loopback, private or
+// link-local address
+var ErrPrivateAddress = errors.New("redirect to private address")
+
+// ErrTooManyRedirects is returned when request is redirected more than
+// MaxRedirects times
+var ErrTooManyRedirects = fmt.Errorf("stopped after %d redirects", MaxRedirects)
+
+// Config stores outbound HTTP client configuration, all timeouts are in
+// milliseconds. Proxy is taken from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables.
+type Config struct {
+	// Timeout limits the whole request including redirects and reading body,
+	// callers may set their own
+	Timeout             int `yaml:"timeout_ms"`
+	DialTimeout         int `yaml:"dial_timeout_ms"`
+	TLSHandshakeTimeout int `yaml:"tls_handshake_timeout_ms"`
+	IdleConnTimeout     int `yaml:"idle_conn_timeout_ms"`
+	MaxIdleConns        int `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+}
+
+// Factory creates clients sharing one transport, so connections are reused
+// by all outbound callers
+type Factory struct {
+	transport http.RoundTripper
+	timeout   time.Duration
+	guard     *redirectGuard
+}
+
+// NewFactory creates transport by cfg, requests are traced with tracer
+func NewFactory(cfg Config, tracer trace.Tracer) *Factory {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(cfg.DialTimeout) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   time.Duration(cfg.TLSHandshakeTimeout) * time.Millisecond,
+		IdleConnTimeout:       time.Duration(cfg.IdleConnTimeout) * time.Millisecond,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &Factory{
+		transport: web.NewTracingTransport(transport, tracer),
+		timeout:   time.Duration(cfg.Timeout) * time.Millisecond,
+		guard:     &redirectGuard{lookup: net.DefaultResolver.LookupIPAddr},
+	}
+}
+
+// Client returns client limited by timeout, zero timeout uses
+// Config.Timeout. Client follows up to MaxRedirects redirects and refuses
+// redirects to private addresses, so user supplied URLs can't reach internal
+// services through redirects.
+func (f *Factory) Client(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = f.timeout
+	}
+
+	return &http.Client{
+		Transport:     f.transport,
+		Timeout:       timeout,
+		CheckRedirect: f.guard.checkRedirect,
+	}
+}
+
+type redirectGuard struct {
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// checkRedirect is called before every redirect is followed, via holds
+// requests made so far
+func (g *redirectGuard) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > MaxRedirects {
+		return ErrTooManyRedirects
+	}
+
+	host := req.URL.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivate(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+		return nil
+	}
+
+	addrs, err := g.lookup(req.Context(), host)
+	if err != nil {
+		return fmt.Errorf("can't resolve redirect host %s: %w", host, err)
+	}
+	// host is refused if any of its addresses is private, as any of them may
+	// be dialed
+	for _, addr := range addrs {
+		if isPrivate(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, addr.IP)
+		}
+	}
+
+	return nil
+}
+
+// sharedAddressSpace is carrier-grade NAT range, RFC 6598
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip)
+}
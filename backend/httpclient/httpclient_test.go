@@ -0,0 +1,115 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFactory_Client(t *testing.T) {
+	t.Run("redirect to private address refused", func(t *testing.T) {
+		internal := false
+		private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			internal = true
+		}))
+		defer private.Close()
+		public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, private.URL, http.StatusFound)
+		}))
+		defer public.Close()
+
+		client := NewFactory(Config{}, sdktrace.NewTracerProvider().Tracer("")).Client(time.Second)
+		res, err := client.Get(public.URL)
+		if res != nil {
+			require.NoError(t, res.Body.Close())
+		}
+
+		assert.ErrorIs(t, err, ErrPrivateAddress)
+		assert.False(t, internal)
+	})
+
+	t.Run("requests traced", func(t *testing.T) {
+		var got string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("traceparent")
+		}))
+		defer srv.Close()
+
+		sr := tracetest.NewSpanRecorder()
+		client := NewFactory(Config{}, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("")).Client(0)
+		res, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+
+		require.Len(t, sr.Ended(), 1)
+		assert.NotEmpty(t, got)
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		f := NewFactory(Config{}, sdktrace.NewTracerProvider().Tracer(""))
+		assert.Equal(t, DefaultTimeout*time.Millisecond, f.Client(0).Timeout)
+		assert.Equal(t, time.Second, f.Client(time.Second).Timeout)
+		assert.Same(t, f.Client(0).Transport, f.Client(time.Second).Transport)
+	})
+}
+
+func TestRedirectGuard(t *testing.T) {
+	hosts := map[string][]net.IPAddr{
+		"example.org":  {{IP: net.ParseIP("93.184.216.34")}},
+		"internal.org": {{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.1")}},
+	}
+	g := &redirectGuard{lookup: func(_ context.Context, host string) ([]net.IPAddr, error) {
+		addrs, ok := hosts[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return addrs, nil
+	}}
+	redirect := func(target string, redirects int) error {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		return g.checkRedirect(req, make([]*http.Request, redirects))
+	}
+
+	tests := []struct {
+		name      string
+		target    string
+		redirects int
+		err       error
+	}{
+		{name: "public host", target: "https://example.org/a", redirects: 1},
+		{name: "public address", target: "http://93.184.216.34/a", redirects: 1},
+		{name: "redirect limit reached", target: "https://example.org/a", redirects: MaxRedirects},
+		{name: "too many redirects", target: "https://example.org/a", redirects: MaxRedirects + 1, err: ErrTooManyRedirects},
+		{name: "loopback", target: "http://127.0.0.1:8080/a", redirects: 1, err: ErrPrivateAddress},
+		{name: "loopback IPv6", target: "http://[::1]/a", redirects: 1, err: ErrPrivateAddress},
+		{name: "private network", target: "http://192.168.1.1/a", redirects: 1, err: ErrPrivateAddress},
+		{name: "cloud metadata", target: "http://169.254.169.254/latest/meta-data", redirects: 1, err: ErrPrivateAddress},
+		{name: "shared address space", target: "http://100.64.0.1/a", redirects: 1, err: ErrPrivateAddress},
+		{name: "unspecified", target: "http://0.0.0.0/a", redirects: 1, err: ErrPrivateAddress},
+		{name: "host resolving to private address", target: "https://internal.org/a", redirects: 1, err: ErrPrivateAddress},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := redirect(test.target, test.redirects)
+			if test.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+
+	t.Run("unknown host", func(t *testing.T) {
+		assert.Error(t, redirect("https://unknown.org/a", 1))
+	})
+}
@@ -0,0 +1,204 @@
+// Package i18n translates user-facing strings. Messages are kept in catalogs
+// embedded per locale, messages missing from catalog of locale are taken from
+// DefaultLocale catalog, so translations may lag behind.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLocale is the locale of messages missing from catalog of requested
+// locale
+const DefaultLocale = "en"
+
+// catalogs are named <locale>.yaml and map message keys to fmt formats
+//
+//go:embed catalogs
+var catalogs embed.FS
+
+// Catalog maps message keys to fmt formats
+type Catalog map[string]string
+
+// Bundle holds catalogs of supported locales
+type Bundle struct {
+	catalogs map[string]Catalog
+	locales  []string
+	matcher  language.Matcher
+}
+
+var bundle = mustLoad(catalogs)
+
+// Load reads catalogs named <locale>.yaml from catalogs directory of fsys,
+// catalog of DefaultLocale is required
+func Load(fsys fs.FS) (*Bundle, error) {
+	b := &Bundle{catalogs: make(map[string]Catalog)}
+	tags := []language.Tag{language.Make(DefaultLocale)}
+
+	entries, err := fs.ReadDir(fsys, "catalogs")
+	if err != nil {
+		return nil, fmt.Errorf("can't read message catalogs: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".yaml" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join("catalogs", name))
+		if err != nil {
+			return nil, fmt.Errorf("can't read %s catalog: %w", name, err)
+		}
+		c := make(Catalog)
+		if err = yaml.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("can't parse %s catalog: %w", name, err)
+		}
+
+		locale := strings.ToLower(strings.TrimSuffix(name, ".yaml"))
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locale of %s catalog: %w", name, err)
+		}
+		b.catalogs[locale] = c
+		if locale != DefaultLocale {
+			tags = append(tags, tag)
+		}
+	}
+	if _, ok := b.catalogs[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("%s catalog is missing", DefaultLocale)
+	}
+
+	for _, tag := range tags {
+		b.locales = append(b.locales, strings.ToLower(tag.String()))
+	}
+	// default locale goes first, so it is chosen when nothing matches
+	b.matcher = language.NewMatcher(tags)
+
+	return b, nil
+}
+
+func mustLoad(fsys fs.FS) *Bundle {
+	b, err := Load(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Locales returns locales catalogs are embedded for, DefaultLocale goes first
+func Locales() []string {
+	return bundle.Locales()
+}
+
+// Match returns locale that suits Accept-Language header best, it is
+// DefaultLocale when header is empty, malformed or nothing matches
+func Match(acceptLanguage string) string {
+	return bundle.Match(acceptLanguage)
+}
+
+// Translate returns message of key in locale formatted with args
+func Translate(locale, key string, args ...interface{}) string {
+	return bundle.Translate(locale, key, args...)
+}
+
+// T returns message of key in locale of ctx formatted with args
+func T(ctx context.Context, key string, args ...interface{}) string {
+	return bundle.Translate(LocaleFromContext(ctx), key, args...)
+}
+
+// Locales returns locales of the bundle, DefaultLocale goes first
+func (b *Bundle) Locales() []string {
+	return append([]string(nil), b.locales...)
+}
+
+// Match returns locale of the bundle that suits Accept-Language header best
+func (b *Bundle) Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+	_, i, confidence := b.matcher.Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return b.locales[i]
+}
+
+// Translate returns message of key in locale formatted with args. Locale
+// falls back to its language and then to DefaultLocale, e.g. ru-RU message is
+// taken from ru-ru, ru or en catalog. Key is returned as is when no catalog
+// has it.
+func (b *Bundle) Translate(locale, key string, args ...interface{}) string {
+	format, ok := b.lookup(locale, key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// lookup returns format of key in catalog of locale or its fallbacks
+func (b *Bundle) lookup(locale, key string) (string, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, lang)
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, l := range candidates {
+		if format, ok := b.catalogs[l][key]; ok {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+type localeKey struct{}
+
+// WithLocale returns copy of ctx carrying locale of user-facing strings
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns locale of ctx, it is DefaultLocale when ctx has
+// none
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// Funcs returns template functions translating to locale: t returns message
+// of key formatted with args and locale returns the locale itself. Pointer
+// args are dereferenced like values printed by templates. Templates are
+// parsed with funcs of any locale and cloned with funcs of request locale.
+func Funcs(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"t": func(key string, args ...interface{}) string {
+			for i, arg := range args {
+				v := reflect.ValueOf(arg)
+				for v.Kind() == reflect.Pointer && !v.IsNil() {
+					v = v.Elem()
+				}
+				if v.IsValid() {
+					args[i] = v.Interface()
+				}
+			}
+			return bundle.Translate(locale, key, args...)
+		},
+		"locale": func() string {
+			return locale
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package i18n_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/semka95/shortener/backend/i18n"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		header string
+		locale string
+	}{
+		{header: "", locale: "en"},
+		{header: "ru", locale: "ru"},
+		{header: "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7", locale: "ru"},
+		{header: "en-US,en;q=0.9,ru;q=0.8", locale: "en"},
+		{header: "de-DE, ru;q=0.5", locale: "ru"},
+		{header: "de-DE,de;q=0.9", locale: "en"},
+		{header: "ru;q=malformed", locale: "en"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.header, func(t *testing.T) {
+			assert.Equal(t, tc.locale, i18n.Match(tc.header))
+		})
+	}
+	assert.Equal(t, []string{"en", "ru"}, i18n.Locales())
+}
+
+func TestTranslate(t *testing.T) {
+	b, err := i18n.Load(fstest.MapFS{
+		"catalogs/en.yaml": {Data: []byte("greeting: \"Hello, %s\"\nfarewell: \"Bye\"\n")},
+		"catalogs/ru.yaml": {Data: []byte("greeting: \"Привет, %s\"\n")},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Привет, Ann", b.Translate("ru", "greeting", "Ann"))
+	assert.Equal(t, "Привет, Ann", b.Translate("ru_RU", "greeting", "Ann"), "region falls back to language")
+	assert.Equal(t, "Bye", b.Translate("ru", "farewell"), "missing translation falls back to default locale")
+	assert.Equal(t, "Hello, Ann", b.Translate("de", "greeting", "Ann"))
+	assert.Equal(t, "unknown", b.Translate("ru", "unknown"))
+}
+
+func TestLoad_DefaultLocaleRequired(t *testing.T) {
+	_, err := i18n.Load(fstest.MapFS{"catalogs/ru.yaml": {Data: []byte("greeting: Привет\n")}})
+	assert.EqualError(t, err, "en catalog is missing")
+}
+
+func TestT(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "en", i18n.LocaleFromContext(ctx))
+	assert.Equal(t, "Short URL", i18n.T(ctx, "shorten.title"))
+	assert.Equal(t, "Короткая ссылка", i18n.T(i18n.WithLocale(ctx, "ru"), "shorten.title"))
+}
+
+func TestFuncs(t *testing.T) {
+	clicks := int64(3)
+	tr := i18n.Funcs("ru")["t"].(func(string, ...interface{}) string)
+	assert.Equal(t, "Переходов за последние дни (30): 3", tr("stats.clicks", 30, &clicks), "pointers are dereferenced")
+	assert.Equal(t, "ru", i18n.Funcs("ru")["locale"].(func() string)())
+}
+
+// TestCatalogs checks translations have keys and format verbs of default
+// locale messages
+func TestCatalogs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[-+# 0]*[0-9]*[a-zA-Z%]`)
+	load := func(locale string) map[string]string {
+		data, err := os.ReadFile(filepath.Join("catalogs", locale+".yaml"))
+		require.NoError(t, err)
+		c := make(map[string]string)
+		require.NoError(t, yaml.Unmarshal(data, &c))
+		return c
+	}
+
+	en := load(i18n.DefaultLocale)
+	for _, locale := range i18n.Locales()[1:] {
+		for key, msg := range load(locale) {
+			def, ok := en[key]
+			if assert.True(t, ok, "%s message %s is missing from default catalog", locale, key) {
+				assert.Equal(t, verbs.FindAllString(def, -1), verbs.FindAllString(msg, -1), "%s message %s", locale, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package limit provides state of limits shared by all instances of the
+// service
+package limit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+// MongoLimitStore keeps limits as documents of limit collection, they are
+// removed by TTL index once expires_at passes. Used key is document id, so
+// only one document per key can exist, events are documents of their own.
+type MongoLimitStore struct {
+	db   *mongo.Database
+	cols store.Collections
+}
+
+var _ domain.LimitStore = (*MongoLimitStore)(nil)
+
+// NewMongoLimitStore creates MongoLimitStore, it is representation of
+// domain.LimitStore
+func NewMongoLimitStore(db *mongo.Database, cols store.Collections) *MongoLimitStore {
+	return &MongoLimitStore{db: db, cols: cols}
+}
+
+// Use records key when it is not recorded or expired, TTL index removes
+// expired documents with a delay. Otherwise upsert tries to insert second
+// document with the same id and fails.
+func (s *MongoLimitStore) Use(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: key},
+		primitive.E{Key: "expires_at", Value: bson.D{primitive.E{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "expires_at", Value: expiresAt.UTC()},
+	}}}
+
+	_, err := s.db.Collection(s.cols.Name(store.LimitCollection)).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("limit use error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return true, nil
+}
+
+// Add inserts event expiring after the window and counts events of the key
+// within the window
+func (s *MongoLimitStore) Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	now = now.Truncate(time.Millisecond).UTC()
+	col := s.db.Collection(s.cols.Name(store.LimitCollection))
+
+	event := bson.D{
+		primitive.E{Key: "_id", Value: primitive.NewObjectID()},
+		primitive.E{Key: "key", Value: key},
+		primitive.E{Key: "at", Value: now},
+		primitive.E{Key: "expires_at", Value: now.Add(window)},
+	}
+	if _, err := col.InsertOne(ctx, event); err != nil {
+		return 0, fmt.Errorf("limit add error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return s.Count(ctx, key, now, window)
+}
+
+// Count counts events of the key within the window, expired events TTL index
+// didn't remove yet are not counted
+func (s *MongoLimitStore) Count(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	now = now.Truncate(time.Millisecond).UTC()
+	n, err := s.db.Collection(s.cols.Name(store.LimitCollection)).CountDocuments(ctx, bson.D{
+		primitive.E{Key: "key", Value: key},
+		primitive.E{Key: "at", Value: bson.D{primitive.E{Key: "$gt", Value: now.Add(-window)}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("limit count error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return int(n), nil
+}
+
+// Reset deletes events of the key
+func (s *MongoLimitStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.Collection(s.cols.Name(store.LimitCollection)).DeleteMany(ctx, bson.D{primitive.E{Key: "key", Value: key}})
+	if err != nil {
+		return fmt.Errorf("limit reset error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
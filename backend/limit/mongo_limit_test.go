@@ -0,0 +1,145 @@
+package limit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/limit"
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestMongoLimitStore_Use(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Millisecond).UTC()
+
+	mt.Run("use", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: "pow:abc"}}}}})
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		used, err := s.Use(context.Background(), "pow:abc", expiresAt)
+
+		require.NoError(mt, err)
+		assert.True(mt, used)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("upsert").Boolean())
+		assert.Equal(mt, "pow:abc", update.Lookup("q", "_id").StringValue())
+		assert.WithinDuration(mt, time.Now(), update.Lookup("q", "expires_at", "$lte").Time(), 5*time.Second)
+		assert.Equal(mt, expiresAt, update.Lookup("u", "$set", "expires_at").Time().UTC())
+	})
+
+	mt.Run("used already", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		used, err := s.Use(context.Background(), "pow:abc", expiresAt)
+
+		require.NoError(mt, err)
+		assert.False(mt, used)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		used, err := s.Use(context.Background(), "pow:abc", expiresAt)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.False(mt, used)
+	})
+}
+
+func TestMongoLimitStore_Add(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+
+	mt.Run("add", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "limit.limit", mtest.FirstBatch, bson.D{{Key: "n", Value: int32(3)}}),
+		)
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		n, err := s.Add(context.Background(), "create:192.0.2.1", now, time.Minute)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, 3, n)
+		event := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, "create:192.0.2.1", event.Lookup("key").StringValue())
+		assert.Equal(mt, now, event.Lookup("at").Time().UTC())
+		assert.Equal(mt, now.Add(time.Minute), event.Lookup("expires_at").Time().UTC())
+		match := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		assert.Equal(mt, now.Add(-time.Minute), match.Lookup("$match", "at", "$gt").Time().UTC())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		_, err := s.Add(context.Background(), "create:192.0.2.1", now, time.Minute)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoLimitStore_Count(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+
+	mt.Run("count", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "limit.limit", mtest.FirstBatch, bson.D{{Key: "n", Value: int32(2)}}))
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		n, err := s.Count(context.Background(), "login:user@example.com", now, time.Minute)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, 2, n)
+		match := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document()
+		assert.Equal(mt, "login:user@example.com", match.Lookup("$match", "key").StringValue())
+		assert.Equal(mt, now.Add(-time.Minute), match.Lookup("$match", "at", "$gt").Time().UTC())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		_, err := s.Count(context.Background(), "login:user@example.com", now, time.Minute)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoLimitStore_Reset(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("reset", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 3}})
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		require.NoError(mt, s.Reset(context.Background(), "login:user@example.com"))
+		del := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document()
+		assert.Equal(mt, "login:user@example.com", del.Lookup("q", "key").StringValue())
+		assert.Equal(mt, int32(0), del.Lookup("limit").Int32())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		s := limit.NewMongoLimitStore(mt.DB, store.Collections{})
+
+		assert.ErrorIs(mt, s.Reset(context.Background(), "login:user@example.com"), domain.ErrInternalServerError)
+	})
+}
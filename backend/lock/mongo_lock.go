@@ -0,0 +1,118 @@
+// Package lock provides named locks shared by all instances of the service
+package lock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+// MongoLocker holds locks as documents of lock collection, lock name is
+// document id, so only one document per lock can exist. Documents are kept
+// after release, so fencing token keeps growing.
+type MongoLocker struct {
+	db   *mongo.Database
+	cols store.Collections
+}
+
+// NewMongoLocker creates MongoLocker, it is representation of domain.Locker
+func NewMongoLocker(db *mongo.Database, cols store.Collections) *MongoLocker {
+	return &MongoLocker{db: db, cols: cols}
+}
+
+// AcquireLock takes lock when it is free or expired. Otherwise upsert tries to
+// insert second document with the same id and fails.
+func (l *MongoLocker) AcquireLock(ctx context.Context, name string, ttl time.Duration) (domain.Lock, error) {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	owner := primitive.NewObjectID().Hex()
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: name},
+		primitive.E{Key: "expires_at", Value: bson.D{primitive.E{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "owner", Value: owner},
+			primitive.E{Key: "expires_at", Value: now.Add(ttl)},
+		}},
+		primitive.E{Key: "$inc", Value: bson.D{primitive.E{Key: "token", Value: int64(1)}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After).
+		SetProjection(bson.D{primitive.E{Key: "token", Value: 1}})
+
+	var acquired struct {
+		Token int64 `bson:"token"`
+	}
+	err := l.db.Collection(l.cols.Name(store.LockCollection)).FindOneAndUpdate(ctx, filter, update, opts).Decode(&acquired)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%s is locked: %w", name, domain.ErrConflict)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock acquire error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return &mongoLock{locker: l, name: name, owner: owner, token: acquired.Token}, nil
+}
+
+// mongoLock is lease of lock document, document still held by the lease has
+// its owner and token
+type mongoLock struct {
+	locker *MongoLocker
+	name   string
+	owner  string
+	token  int64
+}
+
+func (m *mongoLock) Token() int64 {
+	return m.token
+}
+
+// Refresh extends lease even if it expired, as long as lock wasn't acquired by
+// another holder meanwhile
+func (m *mongoLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "expires_at", Value: now.Add(ttl)},
+	}}}
+
+	res, err := m.locker.db.Collection(m.locker.cols.Name(store.LockCollection)).UpdateOne(ctx, m.filter(), update)
+	if err != nil {
+		return fmt.Errorf("lock refresh error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%s was acquired by another holder: %w", m.name, domain.ErrConflict)
+	}
+
+	return nil
+}
+
+// Release expires the lease, lock taken over by another holder is left
+// untouched
+func (m *mongoLock) Release(ctx context.Context) error {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "expires_at", Value: now},
+	}}}
+
+	_, err := m.locker.db.Collection(m.locker.cols.Name(store.LockCollection)).UpdateOne(ctx, m.filter(), update)
+	if err != nil {
+		return fmt.Errorf("lock release error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoLock) filter() bson.D {
+	return bson.D{
+		primitive.E{Key: "_id", Value: m.name},
+		primitive.E{Key: "owner", Value: m.owner},
+		primitive.E{Key: "token", Value: m.token},
+	}
+}
@@ -0,0 +1,122 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/lock"
+	"github.com/semka95/shortener/backend/store"
+)
+
+// acquired is response of findAndModify which acquired lock with token
+func acquired(token int64) bson.D {
+	return bson.D{
+		{Key: "ok", Value: 1},
+		{Key: "value", Value: bson.D{{Key: "_id", Value: "purge"}, {Key: "token", Value: token}}},
+	}
+}
+
+func TestMongoLocker(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("acquire", func(mt *mtest.T) {
+		mt.AddMockResponses(acquired(3))
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(3), held.Token())
+		cmd := mt.GetStartedEvent().Command
+		assert.True(mt, cmd.Lookup("upsert").Boolean())
+		assert.Equal(mt, "purge", cmd.Lookup("query", "_id").StringValue())
+		assert.WithinDuration(mt, time.Now(), cmd.Lookup("query", "expires_at", "$lte").Time(), 5*time.Second)
+		assert.NotEmpty(mt, cmd.Lookup("update", "$set", "owner").StringValue())
+		assert.WithinDuration(mt, time.Now().Add(time.Minute), cmd.Lookup("update", "$set", "expires_at").Time(), 5*time.Second)
+		assert.Equal(mt, int64(1), cmd.Lookup("update", "$inc", "token").Int64())
+	})
+
+	mt.Run("held by another holder", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+		assert.Nil(mt, held)
+	})
+
+	mt.Run("acquire error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, held)
+	})
+
+	mt.Run("refresh", func(mt *mtest.T) {
+		mt.AddMockResponses(acquired(3), bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+		require.NoError(mt, err)
+		owner := mt.GetStartedEvent().Command.Lookup("update", "$set", "owner").StringValue()
+
+		err = held.Refresh(context.Background(), time.Hour)
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, owner, update.Lookup("q", "owner").StringValue())
+		assert.Equal(mt, int64(3), update.Lookup("q", "token").Int64())
+		assert.WithinDuration(mt, time.Now().Add(time.Hour), update.Lookup("u", "$set", "expires_at").Time(), 5*time.Second)
+	})
+
+	mt.Run("refresh of taken over lock", func(mt *mtest.T) {
+		mt.AddMockResponses(acquired(3), bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}})
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+		require.NoError(mt, err)
+
+		err = held.Refresh(context.Background(), time.Hour)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+	})
+
+	mt.Run("release", func(mt *mtest.T) {
+		mt.AddMockResponses(acquired(3), bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+		require.NoError(mt, err)
+		mt.ClearEvents()
+
+		err = held.Release(context.Background())
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, int64(3), update.Lookup("q", "token").Int64())
+		assert.WithinDuration(mt, time.Now(), update.Lookup("u", "$set", "expires_at").Time(), 5*time.Second)
+	})
+
+	mt.Run("release error", func(mt *mtest.T) {
+		mt.AddMockResponses(acquired(3), bson.D{{Key: "ok", Value: 0}})
+		l := lock.NewMongoLocker(mt.DB, store.Collections{})
+		held, err := l.AcquireLock(context.Background(), "purge", time.Minute)
+		require.NoError(mt, err)
+
+		err = held.Release(context.Background())
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// MaintenanceHandler represent the http handler for admin maintenance
+type MaintenanceHandler struct {
+	maintenanceUsecase domain.MaintenanceUsecase
+	authenticator      *auth.Authenticator
+	logger             *zap.Logger
+	tracer             trace.Tracer
+}
+
+// NewMaintenanceHandler will initialize the maintenance resources endpoint
+func NewMaintenanceHandler(mu domain.MaintenanceUsecase, authenticator *auth.Authenticator, logger *zap.Logger, tracer trace.Tracer) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		maintenanceUsecase: mu,
+		authenticator:      authenticator,
+		logger:             logger,
+		tracer:             tracing.Tracer(tracer),
+	}
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (mh *MaintenanceHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(mh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(mh.authenticator.JWTConfig), myMiddl.SpanIdentity("id"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.POST("/maintenance/purge", mh.Purge, admin...)
+	g.POST("/maintenance/readonly", mh.SetReadOnly, admin...)
+}
+
+// Purge will count expired and orphaned URLs, and delete them when request
+// confirms it
+func (mh *MaintenanceHandler) Purge(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := mh.tracer.Start(
+		ctx,
+		"http Purge",
+	)
+	defer span.End()
+
+	purge := new(domain.Purge)
+	if err := c.Bind(purge); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	admin, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	report, err := mh.maintenanceUsecase.Purge(ctx, *purge, admin)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, mh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	span.SetAttributes(
+		attribute.Int64("deleted", report.Deleted),
+	)
+
+	return web.Respond(c, http.StatusOK, report)
+}
+
+// SetReadOnly will switch read-only mode of the instance handling request on
+// or off
+func (mh *MaintenanceHandler) SetReadOnly(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := mh.tracer.Start(
+		ctx,
+		"http SetReadOnly",
+	)
+	defer span.End()
+
+	status := new(domain.ReadOnlyStatus)
+	if err := c.Bind(status); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	admin, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	status, err := mh.maintenanceUsecase.SetReadOnly(ctx, *status, admin)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, mh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return web.Respond(c, http.StatusOK, status)
+}
@@ -0,0 +1,146 @@
+package http_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	maintenanceHttp "github.com/semka95/shortener/backend/maintenance/delivery/http"
+	"github.com/semka95/shortener/backend/maintenance/mock"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestMaintenanceHTTPPurge(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockMaintenanceUsecase(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	adminClaims := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleUser, auth.RoleAdmin}, time.Now(), time.Hour)
+	adminToken, err := authenticator.GenerateToken(adminClaims)
+	require.NoError(t, err)
+	userToken, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Binder = &web.Binder{}
+	maintenanceHttp.NewMaintenanceHandler(uc, authenticator, zap.NewNop(), sdktrace.NewTracerProvider().Tracer("")).RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	purge := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/admin/maintenance/purge", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("dry run by default", func(t *testing.T) {
+		uc.EXPECT().Purge(gomock.Any(), domain.Purge{}, adminClaims).Return(&domain.PurgeReport{DryRun: true, Expired: 3, Orphaned: 2}, nil)
+
+		rec := purge("", adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		report := new(domain.PurgeReport)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(report))
+		assert.True(t, report.DryRun)
+		assert.EqualValues(t, 3, report.Expired)
+		assert.EqualValues(t, 2, report.Orphaned)
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		uc.EXPECT().Purge(gomock.Any(), domain.Purge{Confirm: true}, adminClaims).Return(&domain.PurgeReport{Expired: 3, Deleted: 3}, nil)
+
+		rec := purge(`{"confirm":true}`, adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"deleted":3`)
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		uc.EXPECT().Purge(gomock.Any(), domain.Purge{Confirm: true}, adminClaims).Return(nil, domain.ErrConflict)
+
+		rec := purge(`{"confirm":true}`, adminToken)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		rec := purge(`{"confirmed":true}`, adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := purge(`{"confirm":true}`, userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestMaintenanceHTTPSetReadOnly(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockMaintenanceUsecase(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	adminClaims := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleUser, auth.RoleAdmin}, time.Now(), time.Hour)
+	adminToken, err := authenticator.GenerateToken(adminClaims)
+	require.NoError(t, err)
+	userToken, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Binder = &web.Binder{}
+	maintenanceHttp.NewMaintenanceHandler(uc, authenticator, zap.NewNop(), sdktrace.NewTracerProvider().Tracer("")).RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	readOnly := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/admin/maintenance/readonly", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("enable", func(t *testing.T) {
+		uc.EXPECT().SetReadOnly(gomock.Any(), domain.ReadOnlyStatus{Enabled: true}, adminClaims).Return(&domain.ReadOnlyStatus{Enabled: true}, nil)
+
+		rec := readOnly(`{"enabled":true}`, adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"enabled":true}`, rec.Body.String())
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		uc.EXPECT().SetReadOnly(gomock.Any(), domain.ReadOnlyStatus{}, adminClaims).Return(&domain.ReadOnlyStatus{}, nil)
+
+		rec := readOnly(`{"enabled":false}`, adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"enabled":false}`, rec.Body.String())
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := readOnly(`{"enabled":true}`, userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,189 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// DefaultRetentionDays is the number of days expired URLs are kept for used
+// when Config.RetentionDays is not set
+const DefaultRetentionDays = 90
+
+// DefaultBatchSize is the number of URLs deleted at once used when
+// Config.BatchSize is not set
+const DefaultBatchSize = 500
+
+// purgeLock is the name of the lock held while purge runs
+const purgeLock = "purge"
+
+// purgeLockTTL is the lifetime of purge lock, it is extended after every
+// batch, so only purge of crashed instance lets the lock expire
+const purgeLockTTL = 5 * time.Minute
+
+// Config stores maintenance configuration
+type Config struct {
+	// RetentionDays is the number of days expired URLs are kept for
+	RetentionDays int `yaml:"retention_days"`
+	// BatchSize is the number of URLs deleted at once
+	BatchSize int64 `yaml:"batch_size"`
+}
+
+type maintenanceUsecase struct {
+	urlRepo        domain.URLRepository
+	locker         domain.Locker
+	readOnly       *domain.ReadOnlyMode
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            Config
+}
+
+// NewMaintenanceUsecase will create new an maintenanceUsecase object representation of domain.MaintenanceUsecase interface
+func NewMaintenanceUsecase(u domain.URLRepository, l domain.Locker, ro *domain.ReadOnlyMode, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg Config) domain.MaintenanceUsecase {
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = DefaultRetentionDays
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+
+	return &maintenanceUsecase{
+		urlRepo:        u,
+		locker:         l,
+		readOnly:       ro,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+	}
+}
+
+// Purge runs longer than other usecases, so timeout is applied to every
+// repository call instead of the whole purge
+func (uc *maintenanceUsecase) Purge(c context.Context, purge domain.Purge, admin *auth.Claims) (*domain.PurgeReport, error) {
+	ctx, span := uc.tracer.Start(
+		c,
+		"usecase Purge",
+		trace.WithAttributes(
+			attribute.Bool("confirm", purge.Confirm)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	report := &domain.PurgeReport{
+		DryRun:        !purge.Confirm,
+		ExpiredBefore: time.Now().Truncate(time.Millisecond).UTC().AddDate(0, 0, -uc.cfg.RetentionDays),
+	}
+	expired := domain.PurgeFilter{ExpiredBefore: report.ExpiredBefore}
+	orphaned := domain.PurgeFilter{Orphaned: true}
+
+	lock, err := uc.lock(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	defer func() {
+		// request context may be already canceled
+		ctx, cancel := context.WithTimeout(context.Background(), uc.contextTimeout)
+		defer cancel()
+		if err := lock.Release(ctx); err != nil {
+			uc.logger.Error("can't release purge lock", zap.Error(err))
+		}
+	}()
+
+	if report.Expired, err = uc.count(ctx, expired); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if report.Orphaned, err = uc.count(ctx, orphaned); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if report.DryRun {
+		return report, nil
+	}
+
+	for _, filter := range []domain.PurgeFilter{expired, orphaned} {
+		for {
+			n, err := uc.purgeBatch(ctx, filter)
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+			report.Deleted += n
+			uc.logger.Info("purged batch of URLs",
+				zap.Bool("orphaned", filter.Orphaned),
+				zap.Int64("deleted", n),
+				zap.Int64("total_deleted", report.Deleted),
+				zap.String("admin", admin.Subject),
+			)
+			if n == 0 {
+				break
+			}
+
+			if err = uc.refresh(ctx, lock); err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int64("deleted", report.Deleted))
+
+	return report, nil
+}
+
+// SetReadOnly switches mode of this instance only, every instance has to be
+// switched
+func (uc *maintenanceUsecase) SetReadOnly(c context.Context, status domain.ReadOnlyStatus, admin *auth.Claims) (*domain.ReadOnlyStatus, error) {
+	_, span := uc.tracer.Start(
+		c,
+		"usecase SetReadOnly",
+		trace.WithAttributes(
+			attribute.Bool("enabled", status.Enabled)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if uc.readOnly.Enabled() != status.Enabled {
+		uc.readOnly.Set(status.Enabled)
+		uc.logger.Warn("read-only mode switched", zap.Bool("enabled", status.Enabled), zap.String("admin", admin.Subject))
+	}
+
+	return &domain.ReadOnlyStatus{Enabled: uc.readOnly.Enabled()}, nil
+}
+
+func (uc *maintenanceUsecase) lock(c context.Context) (domain.Lock, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	return uc.locker.AcquireLock(ctx, purgeLock, purgeLockTTL)
+}
+
+func (uc *maintenanceUsecase) refresh(c context.Context, lock domain.Lock) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	return lock.Refresh(ctx, purgeLockTTL)
+}
+
+func (uc *maintenanceUsecase) count(c context.Context, filter domain.PurgeFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	return uc.urlRepo.CountPurgeable(ctx, filter)
+}
+
+func (uc *maintenanceUsecase) purgeBatch(c context.Context, filter domain.PurgeFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	return uc.urlRepo.PurgeBatch(ctx, filter, uc.cfg.BatchSize)
+}
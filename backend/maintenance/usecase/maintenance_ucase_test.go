@@ -0,0 +1,162 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+	"github.com/semka95/shortener/backend/maintenance/usecase"
+	urlmock "github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+// expiredFilter matches purge filter of expired URLs
+type expiredFilter struct{}
+
+func (expiredFilter) Matches(x interface{}) bool {
+	f, ok := x.(domain.PurgeFilter)
+	return ok && !f.ExpiredBefore.IsZero() && !f.Orphaned
+}
+
+func (expiredFilter) String() string {
+	return "is filter of expired URLs"
+}
+
+func TestMaintenanceUsecase_Purge(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := urlmock.NewMockURLRepository(controller)
+	locker := lockmock.NewMockLocker(controller)
+	lock := lockmock.NewMockLock(controller)
+	admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+	isExpired := expiredFilter{}
+	orphaned := domain.PurgeFilter{Orphaned: true}
+
+	t.Run("dry run", func(t *testing.T) {
+		uc := usecase.NewMaintenanceUsecase(repository, locker, domain.NewReadOnlyMode(false), 10*time.Second, tracer, zap.NewNop(), usecase.Config{RetentionDays: 30})
+		gomock.InOrder(
+			locker.EXPECT().AcquireLock(gomock.Any(), "purge", gomock.Any()).Return(lock, nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), isExpired).Return(int64(3), nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), orphaned).Return(int64(2), nil),
+			lock.EXPECT().Release(gomock.Any()).Return(nil),
+		)
+
+		report, err := uc.Purge(context.Background(), domain.Purge{}, admin)
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.EqualValues(t, 3, report.Expired)
+		assert.EqualValues(t, 2, report.Orphaned)
+		assert.Zero(t, report.Deleted)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, -30), report.ExpiredBefore, time.Minute)
+	})
+
+	t.Run("confirm deletes in batches", func(t *testing.T) {
+		core, logs := observer.New(zapcore.InfoLevel)
+		uc := usecase.NewMaintenanceUsecase(repository, locker, domain.NewReadOnlyMode(false), 10*time.Second, tracer, zap.New(core), usecase.Config{BatchSize: 2})
+		gomock.InOrder(
+			locker.EXPECT().AcquireLock(gomock.Any(), "purge", gomock.Any()).Return(lock, nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), isExpired).Return(int64(3), nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), orphaned).Return(int64(1), nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), isExpired, int64(2)).Return(int64(2), nil),
+			lock.EXPECT().Refresh(gomock.Any(), 5*time.Minute).Return(nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), isExpired, int64(2)).Return(int64(1), nil),
+			lock.EXPECT().Refresh(gomock.Any(), 5*time.Minute).Return(nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), isExpired, int64(2)).Return(int64(0), nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), orphaned, int64(2)).Return(int64(1), nil),
+			lock.EXPECT().Refresh(gomock.Any(), 5*time.Minute).Return(nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), orphaned, int64(2)).Return(int64(0), nil),
+			lock.EXPECT().Release(gomock.Any()).Return(nil),
+		)
+
+		report, err := uc.Purge(context.Background(), domain.Purge{Confirm: true}, admin)
+		require.NoError(t, err)
+		assert.False(t, report.DryRun)
+		assert.EqualValues(t, 4, report.Deleted)
+		assert.Equal(t, 5, logs.FilterMessage("purged batch of URLs").Len())
+	})
+
+	t.Run("already running", func(t *testing.T) {
+		uc := usecase.NewMaintenanceUsecase(repository, locker, domain.NewReadOnlyMode(false), 10*time.Second, tracer, zap.NewNop(), usecase.Config{})
+		locker.EXPECT().AcquireLock(gomock.Any(), "purge", gomock.Any()).Return(nil, domain.ErrConflict)
+
+		report, err := uc.Purge(context.Background(), domain.Purge{Confirm: true}, admin)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, report)
+	})
+
+	t.Run("lock taken over", func(t *testing.T) {
+		uc := usecase.NewMaintenanceUsecase(repository, locker, domain.NewReadOnlyMode(false), 10*time.Second, tracer, zap.NewNop(), usecase.Config{})
+		gomock.InOrder(
+			locker.EXPECT().AcquireLock(gomock.Any(), "purge", gomock.Any()).Return(lock, nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), isExpired).Return(int64(1), nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), orphaned).Return(int64(0), nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), isExpired, int64(usecase.DefaultBatchSize)).Return(int64(1), nil),
+			lock.EXPECT().Refresh(gomock.Any(), gomock.Any()).Return(domain.ErrConflict),
+			lock.EXPECT().Release(gomock.Any()).Return(nil),
+		)
+
+		report, err := uc.Purge(context.Background(), domain.Purge{Confirm: true}, admin)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, report)
+	})
+
+	t.Run("lock is released on error", func(t *testing.T) {
+		uc := usecase.NewMaintenanceUsecase(repository, locker, domain.NewReadOnlyMode(false), 10*time.Second, tracer, zap.NewNop(), usecase.Config{})
+		gomock.InOrder(
+			locker.EXPECT().AcquireLock(gomock.Any(), "purge", gomock.Any()).Return(lock, nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), isExpired).Return(int64(0), nil),
+			repository.EXPECT().CountPurgeable(gomock.Any(), orphaned).Return(int64(0), nil),
+			repository.EXPECT().PurgeBatch(gomock.Any(), isExpired, int64(usecase.DefaultBatchSize)).Return(int64(0), domain.ErrInternalServerError),
+			lock.EXPECT().Release(gomock.Any()).Return(nil),
+		)
+
+		report, err := uc.Purge(context.Background(), domain.Purge{Confirm: true}, admin)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, report)
+	})
+}
+
+func TestMaintenanceUsecase_SetReadOnly(t *testing.T) {
+	mode := domain.NewReadOnlyMode(false)
+	core, logs := observer.New(zapcore.InfoLevel)
+	uc := usecase.NewMaintenanceUsecase(nil, nil, mode, 10*time.Second, tracer, zap.New(core), usecase.Config{})
+	admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+
+	status, err := uc.SetReadOnly(context.Background(), domain.ReadOnlyStatus{Enabled: true}, admin)
+	require.NoError(t, err)
+	assert.True(t, status.Enabled)
+	assert.True(t, mode.Enabled())
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "507f191e810c19729de860ec", logs.All()[0].ContextMap()["admin"])
+
+	// switching to the same mode is not logged
+	_, err = uc.SetReadOnly(context.Background(), domain.ReadOnlyStatus{Enabled: true}, admin)
+	require.NoError(t, err)
+	assert.Equal(t, 1, logs.Len())
+
+	// workers waiting for mode are released once it is switched off
+	released := make(chan error)
+	go func() { released <- mode.Wait(context.Background()) }()
+	status, err = uc.SetReadOnly(context.Background(), domain.ReadOnlyStatus{Enabled: false}, admin)
+	require.NoError(t, err)
+	assert.False(t, status.Enabled)
+	select {
+	case err = <-released:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("worker is not released")
+	}
+}
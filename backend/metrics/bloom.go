@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+var filterLabel = attribute.Key("filter")
+
+// RegisterExistenceFilters exposes number of keys checked by existence
+// filters as existence_filter_checks_total counter and number of keys found
+// missing, so backend was skipped, as existence_filter_skips_total counter
+func RegisterExistenceFilters(filters []*store.ExistenceFilter, opts ...Option) error {
+	meter := newMeter(opts)
+
+	_, err := meter.Int64ObservableCounter("existence_filter_checks_total",
+		instrument.WithDescription("How many keys were checked by existence filter."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, f := range filters {
+				o.Observe(f.Checks(), filterLabel.String(f.Name()))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("existence_filter_skips_total",
+		instrument.WithDescription("How many backend lookups were skipped as existence filter found key missing."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, f := range filters {
+				o.Observe(f.Skips(), filterLabel.String(f.Name()))
+			}
+			return nil
+		}),
+	)
+
+	return err
+}
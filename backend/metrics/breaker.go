@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+var breakerLabel = attribute.Key("breaker")
+
+// RegisterCircuitBreakers exposes state of circuit breakers as
+// circuit_breaker_state gauge (0 closed, 1 open, 2 half-open) and number of
+// their state changes as circuit_breaker_transitions_total counter
+func RegisterCircuitBreakers(breakers []*store.CircuitBreaker, opts ...Option) error {
+	meter := newMeter(opts)
+
+	_, err := meter.Int64ObservableGauge("circuit_breaker_state",
+		instrument.WithDescription("Current state of circuit breaker: 0 closed, 1 open, 2 half-open."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, cb := range breakers {
+				o.Observe(int64(cb.State()), breakerLabel.String(cb.Name()))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("circuit_breaker_transitions_total",
+		instrument.WithDescription("How many times circuit breaker changed its state."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, cb := range breakers {
+				o.Observe(cb.Transitions(), breakerLabel.String(cb.Name()))
+			}
+			return nil
+		}),
+	)
+
+	return err
+}
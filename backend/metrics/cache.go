@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+var (
+	cacheLabel  = attribute.Key("cache")
+	resultLabel = attribute.Key("result")
+)
+
+// RegisterCaches exposes number of cache lookups as cache_lookups_total
+// counter partitioned by result: hit, negative_hit, miss or stale_hit, stale
+// hits are values served past their TTL while backend is unavailable
+func RegisterCaches(caches []*store.Cache, opts ...Option) error {
+	results := []store.CacheResult{store.CacheHit, store.CacheNegativeHit, store.CacheMiss, store.CacheStaleHit}
+
+	_, err := newMeter(opts).Int64ObservableCounter("cache_lookups_total",
+		instrument.WithDescription("How many lookups were made in cache, partitioned by result."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, c := range caches {
+				for _, r := range results {
+					o.Observe(c.Lookups(r), cacheLabel.String(c.Name()), resultLabel.String(r.String()))
+				}
+			}
+			return nil
+		}),
+	)
+
+	return err
+}
+
+// RegisterCacheWarmup exposes number of entries loaded into cache on startup
+// as cache_warmed_entries gauge
+func RegisterCacheWarmup(name string, warmed int64, opts ...Option) error {
+	_, err := newMeter(opts).Int64ObservableGauge("cache_warmed_entries",
+		instrument.WithDescription("How many entries were loaded into cache on startup."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			o.Observe(warmed, cacheLabel.String(name))
+			return nil
+		}),
+	)
+
+	return err
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// RegisterClickWriter exposes number of stored clicks as
+// clicks_flushed_total counter and number of clicks dropped because the
+// queue was full, storing failed or shutdown deadline was exceeded as
+// clicks_dropped_total counter
+func RegisterClickWriter(stats func() (flushed, dropped int64), opts ...Option) error {
+	meter := newMeter(opts)
+
+	_, err := meter.Int64ObservableCounter("clicks_flushed_total",
+		instrument.WithDescription("How many recorded clicks were stored."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			flushed, _ := stats()
+			o.Observe(flushed)
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("clicks_dropped_total",
+		instrument.WithDescription("How many recorded clicks were dropped without being stored."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			_, dropped := stats()
+			o.Observe(dropped)
+			return nil
+		}),
+	)
+
+	return err
+}
+
+// RegisterClickRollups exposes number of stored clicks waiting to be added to
+// rollups as click_rollup_pending gauge, number of clicks added to rollups as
+// click_rollup_flushed_total counter and number of clicks not added because
+// the update failed or service was read-only on shutdown as
+// click_rollup_dropped_total counter
+func RegisterClickRollups(stats func() (pending, flushed, dropped int64), opts ...Option) error {
+	meter := newMeter(opts)
+
+	_, err := meter.Int64ObservableGauge("click_rollup_pending",
+		instrument.WithDescription("How many stored clicks wait to be added to rollups."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			pending, _, _ := stats()
+			o.Observe(pending)
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("click_rollup_flushed_total",
+		instrument.WithDescription("How many stored clicks were added to rollups."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			_, flushed, _ := stats()
+			o.Observe(flushed)
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("click_rollup_dropped_total",
+		instrument.WithDescription("How many stored clicks were not added to rollups."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			_, _, dropped := stats()
+			o.Observe(dropped)
+			return nil
+		}),
+	)
+
+	return err
+}
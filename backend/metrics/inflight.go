@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/contrib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+var budgetLabel = attribute.Key("budget")
+
+// RegisterInFlight exposes number of in-flight requests of redirect and api
+// budgets as in_flight_requests gauge
+func RegisterInFlight(inFlight func() (redirect, api int64), opts ...Option) error {
+	_, err := newMeter(opts).Int64ObservableGauge("in_flight_requests",
+		instrument.WithDescription("How many HTTP requests are being handled, partitioned by load shedding budget."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			redirect, api := inFlight()
+			o.Observe(redirect, budgetLabel.String("redirect"))
+			o.Observe(api, budgetLabel.String("api"))
+			return nil
+		}),
+	)
+
+	return err
+}
+
+// newMeter creates meter from configured or global provider
+func newMeter(opts []Option) metric.Meter {
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = global.MeterProvider()
+	}
+
+	return cfg.MeterProvider.Meter(
+		meterName,
+		metric.WithInstrumentationVersion(contrib.SemVersion()),
+	)
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+var stateLabel = attribute.Key("state")
+
+// RegisterPoolStats exposes MongoDB connection pool stats as
+// mongo_pool_connections gauge partitioned by state: open or in_use, and
+// number of failed connection checkouts as
+// mongo_pool_checkout_failures_total counter
+func RegisterPoolStats(stats *store.PoolStats, opts ...Option) error {
+	meter := newMeter(opts)
+
+	_, err := meter.Int64ObservableGauge("mongo_pool_connections",
+		instrument.WithDescription("Number of MongoDB connections, partitioned by state: open or in_use."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			o.Observe(stats.Open(), stateLabel.String("open"))
+			o.Observe(stats.InUse(), stateLabel.String("in_use"))
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("mongo_pool_checkout_failures_total",
+		instrument.WithDescription("How many MongoDB connection checkouts failed."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			o.Observe(stats.CheckoutFailures())
+			return nil
+		}),
+	)
+
+	return err
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+var cacheHitLabel = attribute.Key("cache_hit")
+
+// RedirectMetrics records duration of redirects as
+// redirect_duration_milliseconds histogram partitioned by outcome, e.g.
+// domain.RedirectHit, and whether URL was served by cache. Ids of URLs are
+// not recorded to keep the number of series bounded.
+type RedirectMetrics struct {
+	duration instrument.Float64Histogram
+}
+
+// NewRedirectMetrics creates RedirectMetrics instruments
+func NewRedirectMetrics(opts ...Option) (*RedirectMetrics, error) {
+	meter := newMeter(opts)
+
+	duration, err := meter.Float64Histogram("redirect_duration_milliseconds",
+		instrument.WithDescription("The redirect latencies in milliseconds from request start to response write, partitioned by outcome and cache hit."),
+		instrument.WithUnit(unit.Milliseconds),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedirectMetrics{duration: duration}, nil
+}
+
+// Record records redirect started at start, nothing is recorded by nil
+// RedirectMetrics
+func (m *RedirectMetrics) Record(ctx context.Context, start time.Time, outcome string, cacheHit bool) {
+	if m == nil {
+		return
+	}
+	m.duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond),
+		outcomeLabel.String(outcome), cacheHitLabel.Bool(cacheHit))
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+var (
+	operationLabel = attribute.Key("operation")
+	outcomeLabel   = attribute.Key("outcome")
+)
+
+// Outcomes of repository operations
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeConflict = "conflict"
+	OutcomeTimeout  = "timeout"
+	OutcomeError    = "error"
+)
+
+// Outcome classifies error returned by repository operation
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, domain.ErrNotFound), errors.Is(err, domain.ErrNoAffected):
+		return OutcomeNotFound
+	case errors.Is(err, domain.ErrConflict):
+		return OutcomeConflict
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, domain.ErrTimeout):
+		return OutcomeTimeout
+	default:
+		return OutcomeError
+	}
+}
+
+// RepositoryMetrics records duration of repository operations as
+// repository_operation_duration_milliseconds histogram and number of failed
+// operations as repository_operation_errors_total counter, both partitioned
+// by operation, e.g. url.GetByID, and outcome
+type RepositoryMetrics struct {
+	duration instrument.Float64Histogram
+	errors   instrument.Int64Counter
+}
+
+// NewRepositoryMetrics creates RepositoryMetrics instruments
+func NewRepositoryMetrics(opts ...Option) (*RepositoryMetrics, error) {
+	meter := newMeter(opts)
+
+	duration, err := meter.Float64Histogram("repository_operation_duration_milliseconds",
+		instrument.WithDescription("The repository operation latencies in milliseconds, partitioned by operation and outcome."),
+		instrument.WithUnit(unit.Milliseconds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := meter.Int64Counter("repository_operation_errors_total",
+		instrument.WithDescription("How many repository operations failed, partitioned by operation and outcome."),
+		instrument.WithUnit(unit.Dimensionless),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RepositoryMetrics{
+		duration: duration,
+		errors:   errs,
+	}, nil
+}
+
+// Record records operation op started at start which returned err
+func (m *RepositoryMetrics) Record(ctx context.Context, op string, start time.Time, err error) {
+	lbl := []attribute.KeyValue{operationLabel.String(op), outcomeLabel.String(Outcome(err))}
+
+	m.duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), lbl...)
+	if err != nil {
+		m.errors.Add(ctx, 1, lbl...)
+	}
+}
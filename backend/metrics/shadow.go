@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+var collectionLabel = attribute.Key("collection")
+
+// RegisterShadows exposes number of reads repeated against secondary
+// repositories as shadow_reads_total counter partitioned by result: match,
+// mismatch, failed or dropped, and number of writes secondary failed as
+// shadow_write_errors_total counter
+func RegisterShadows(shadows []*store.Shadow, opts ...Option) error {
+	meter := newMeter(opts)
+	results := []store.ShadowResult{store.ShadowMatch, store.ShadowMismatch, store.ShadowFailed, store.ShadowDropped}
+
+	_, err := meter.Int64ObservableCounter("shadow_reads_total",
+		instrument.WithDescription("How many reads were repeated against secondary repository, partitioned by result."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, s := range shadows {
+				for _, r := range results {
+					o.Observe(s.Reads(r), collectionLabel.String(s.Name()), resultLabel.String(r.String()))
+				}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableCounter("shadow_write_errors_total",
+		instrument.WithDescription("How many writes copied to secondary repository failed."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			for _, s := range shadows {
+				o.Observe(s.WriteErrors(), collectionLabel.String(s.Name()))
+			}
+			return nil
+		}),
+	)
+
+	return err
+}
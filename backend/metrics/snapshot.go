@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// RegisterLinkSnapshot exposes counts of the last snapshot as links_active
+// and links_created_last_hour gauges, nothing is observed until the first
+// snapshot
+func RegisterLinkSnapshot(last func() *domain.LinkSnapshot, opts ...Option) error {
+	meter := newMeter(opts)
+
+	_, err := meter.Int64ObservableGauge("links_active",
+		instrument.WithDescription("Number of links that are neither expired nor blocked."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			if s := last(); s != nil {
+				o.Observe(s.Active)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableGauge("links_created_last_hour",
+		instrument.WithDescription("Number of links created during the last hour."),
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithInt64Callback(func(_ context.Context, o instrument.Int64Observer) error {
+			if s := last(); s != nil {
+				o.Observe(s.CreatedLastHour)
+			}
+			return nil
+		}),
+	)
+
+	return err
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CanonicalPath must be used with echo.Pre, before routes are matched. Paths
+// of API routes, those under one of apiPrefixes, with duplicate or trailing
+// slashes are redirected with 308 to canonical path, so clients learn the
+// right URL. Other paths are served without redirect: leading duplicate
+// slashes are dropped and single trailing slash of one segment path, e.g.
+// /abc/, is stripped so short URL is found. The rest of other paths is left as
+// is, it may be forwarded to destination.
+func (m *GoMiddleware) CanonicalPath(apiPrefixes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			path := req.URL.Path
+			if req.URL.RawPath != "" {
+				path = req.URL.RawPath
+			}
+
+			if isAPIPath(squashSlashes(path), apiPrefixes) {
+				canonical := strings.TrimSuffix(squashSlashes(path), "/")
+				if canonical == "" || canonical == path {
+					return next(c)
+				}
+				if req.URL.RawQuery != "" {
+					canonical += "?" + req.URL.RawQuery
+				}
+				return c.Redirect(http.StatusPermanentRedirect, canonical)
+			}
+
+			if req.URL.RawPath == "" {
+				req.URL.Path = shortPath(path)
+				return next(c)
+			}
+			// escaped path decides, so escaped slash is not taken for segment
+			// separator
+			raw := shortPath(path)
+			if unescaped, err := url.PathUnescape(raw); err == nil {
+				req.URL.RawPath, req.URL.Path = raw, unescaped
+			}
+			return next(c)
+		}
+	}
+}
+
+// squashSlashes replaces every run of slashes in path with a single slash
+func squashSlashes(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	return path
+}
+
+// shortPath drops leading duplicate slashes of path and strips trailing slash
+// of one segment path
+func shortPath(path string) string {
+	if strings.HasPrefix(path, "//") {
+		path = "/" + strings.TrimLeft(path, "/")
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(path, "/"), "/")
+	if ok && id != "" && !strings.Contains(id, "/") {
+		return "/" + id
+	}
+	return path
+}
+
+func isAPIPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+// ContentTypeConfig stores media types accepted in request bodies of route
+// groups
+type ContentTypeConfig struct {
+	// Groups maps route prefix, e.g. /v1, to media types accepted by its
+	// routes, the longest matching prefix is used. Routes outside of groups
+	// are not checked.
+	Groups map[string][]string
+	// Skip lists routes which check their bodies themselves, e.g. multipart
+	// uploads
+	Skip []string
+}
+
+// accepted returns media types accepted by route, nil means that route is not
+// checked
+func (cfg ContentTypeConfig) accepted(route string) []string {
+	for _, skip := range cfg.Skip {
+		if route == skip {
+			return nil
+		}
+	}
+
+	var group string
+	var types []string
+	for prefix, t := range cfg.Groups {
+		if (route == prefix || strings.HasPrefix(route, prefix+"/")) && len(prefix) > len(group) {
+			group, types = prefix, t
+		}
+	}
+
+	return types
+}
+
+// ContentType rejects requests with body of media type that route doesn't
+// accept with 415 before they reach handler. Parameters of media type, e.g.
+// charset, are ignored. GET, HEAD, DELETE and OPTIONS requests and requests
+// without body are not checked.
+func (m *GoMiddleware) ContentType(cfg ContentTypeConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+				return next(c)
+			}
+			if req.ContentLength == 0 {
+				return next(c)
+			}
+
+			types := cfg.accepted(c.Path())
+			if len(types) == 0 {
+				return next(c)
+			}
+
+			header := req.Header.Get(echo.HeaderContentType)
+			mediaType, _, err := mime.ParseMediaType(header)
+			if err == nil {
+				for _, t := range types {
+					if strings.EqualFold(mediaType, t) {
+						return next(c)
+					}
+				}
+			}
+
+			msg := fmt.Sprintf("Content-Type %q is not supported, use %s", header, strings.Join(types, " or "))
+			if header == "" {
+				msg = fmt.Sprintf("Content-Type header is missing, use %s", strings.Join(types, " or "))
+			}
+			return web.RespondError(c, http.StatusUnsupportedMediaType, domain.ResponseError{Error: msg})
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/semka95/shortener/backend/pow"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// CORSConfig stores configuration of cross-origin requests
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to make cross-origin requests,
+	// e.g. "https://dashboard.example.com". Any origin is allowed when it is
+	// empty or has "*", credentials are never allowed then.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowCredentials lets browsers send Authorization header and cookies
+	// with requests of allowed origins
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge is the number of seconds browsers cache preflight responses
+	MaxAge int `yaml:"max_age_seconds"`
+}
+
+// DefaultCORSMaxAge is the number of seconds browsers cache preflight
+// responses used when CORSConfig.MaxAge is not set
+const DefaultCORSMaxAge = 600
+
+var (
+	corsAllowMethods = strings.Join([]string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}, ",")
+	corsAllowHeaders = strings.Join([]string{
+		echo.HeaderAuthorization, echo.HeaderContentType, echo.HeaderXRequestID, HeaderAPIKey,
+		"If-Match", echo.HeaderIfModifiedSince, "If-None-Match", "traceparent",
+		pow.HeaderChallenge, pow.HeaderNonce,
+	}, ",")
+	// corsExposeHeaders are response headers scripts of other origins may
+	// read besides safelisted ones
+	corsExposeHeaders = strings.Join([]string{
+		web.HeaderXTraceID, echo.HeaderXRequestID, web.HeaderXTotalCount, web.HeaderXStatsPartial, "Link",
+		"ETag", echo.HeaderLastModified, echo.HeaderLocation, echo.HeaderRetryAfter,
+		auth.HeaderTOSOutdated,
+	}, ",")
+)
+
+// CORS will handle the CORS middleware. Allowed origin is echoed back when
+// origins are listed, so credentialed requests are accepted by browsers.
+// Preflight requests are answered right away, requests of other origins are
+// served without CORS headers, so browsers don't expose responses to them.
+func (m *GoMiddleware) CORS(cfg CORSConfig) echo.MiddlewareFunc {
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultCORSMaxAge
+	}
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	anyOrigin := len(cfg.AllowedOrigins) == 0
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		origins[strings.TrimSuffix(o, "/")] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req, h := c.Request(), c.Response().Header()
+			origin := req.Header.Get(echo.HeaderOrigin)
+			preflight := req.Method == http.MethodOptions && origin != "" && req.Header.Get(echo.HeaderAccessControlRequestMethod) != ""
+
+			switch {
+			case anyOrigin:
+				h.Set(echo.HeaderAccessControlAllowOrigin, "*")
+			case origins[origin]:
+				h.Add(echo.HeaderVary, echo.HeaderOrigin)
+				h.Set(echo.HeaderAccessControlAllowOrigin, origin)
+				if cfg.AllowCredentials {
+					h.Set(echo.HeaderAccessControlAllowCredentials, "true")
+				}
+			default:
+				h.Add(echo.HeaderVary, echo.HeaderOrigin)
+				if preflight {
+					return c.NoContent(http.StatusNoContent)
+				}
+				return next(c)
+			}
+
+			if !preflight {
+				h.Set(echo.HeaderAccessControlExposeHeaders, corsExposeHeaders)
+				return next(c)
+			}
+
+			h.Add(echo.HeaderVary, echo.HeaderAccessControlRequestMethod)
+			h.Add(echo.HeaderVary, echo.HeaderAccessControlRequestHeaders)
+			h.Set(echo.HeaderAccessControlAllowMethods, corsAllowMethods)
+			h.Set(echo.HeaderAccessControlAllowHeaders, corsAllowHeaders)
+			h.Set(echo.HeaderAccessControlMaxAge, maxAge)
+			return c.NoContent(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+// Breaker is circuit breaker of database calls, e.g. store.CircuitBreaker
+type Breaker interface {
+	// RejectingFor returns how long calls are going to be rejected, it is
+	// zero when calls are let through
+	RejectingFor() time.Duration
+}
+
+// Degraded refuses requests changing data with 503 while any of breakers
+// rejects database calls, so writes fail at once during database outage.
+// Redirects and other reads are served as usual, recently resolved URLs are
+// served from cache. Writes are let through as soon as breakers probe
+// database again, so service leaves degraded mode on its own.
+func (m *GoMiddleware) Degraded(breakers ...Breaker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if safeRoute(c.Request().Method, c.Path()) {
+				return next(c)
+			}
+
+			var rejecting time.Duration
+			for _, b := range breakers {
+				if d := b.RejectingFor(); d > rejecting {
+					rejecting = d
+				}
+			}
+			if rejecting <= 0 {
+				return next(c)
+			}
+
+			m.logger.Debug("write rejected in degraded mode", zap.String("route", c.Path()), zap.Duration("rejecting", rejecting))
+			retryAfter := (rejecting + time.Second - 1) / time.Second
+			c.Response().Header().Set(echo.HeaderRetryAfter, strconv.FormatInt(int64(retryAfter), 10))
+			return web.RespondError(c, http.StatusServiceUnavailable, domain.ResponseError{Error: domain.ErrUnavailable.Error(), Code: domain.ErrCodeUnavailable})
+		}
+	}
+}
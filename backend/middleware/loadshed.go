@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+const (
+	redirectRoute    = "/:id"
+	statusCheckRoute = "/v1/status"
+)
+
+// LoadShedConfig stores in-flight request budgets, zero disables the budget
+type LoadShedConfig struct {
+	// RedirectLimit is the number of redirect requests handled concurrently
+	RedirectLimit int64 `yaml:"redirect_limit"`
+	// APILimit is the number of other requests handled concurrently
+	APILimit int64 `yaml:"api_limit"`
+	// RetryAfter is the value of Retry-After header of rejected requests in seconds
+	RetryAfter int `yaml:"retry_after_seconds"`
+}
+
+// LoadShedder counts in-flight requests of redirect and API budgets
+type LoadShedder struct {
+	cfg      LoadShedConfig
+	redirect atomic.Int64
+	api      atomic.Int64
+}
+
+// NewLoadShedder creates load shedder with given budgets
+func NewLoadShedder(cfg LoadShedConfig) *LoadShedder {
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = 1
+	}
+
+	return &LoadShedder{cfg: cfg}
+}
+
+// InFlight returns number of requests being handled by each budget
+func (ls *LoadShedder) InFlight() (redirect, api int64) {
+	return ls.redirect.Load(), ls.api.Load()
+}
+
+// budget returns in-flight counter and limit for the route, nil counter means
+// that route is not limited
+func (ls *LoadShedder) budget(route string) (*atomic.Int64, int64) {
+	switch route {
+	case statusCheckRoute:
+		return nil, 0
+	case redirectRoute:
+		return &ls.redirect, ls.cfg.RedirectLimit
+	default:
+		return &ls.api, ls.cfg.APILimit
+	}
+}
+
+// LoadShed rejects requests with 503 once in-flight budget of the route is
+// exhausted, health checks are never rejected
+func (m *GoMiddleware) LoadShed(ls *LoadShedder) echo.MiddlewareFunc {
+	retryAfter := strconv.Itoa(ls.cfg.RetryAfter)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			inFlight, limit := ls.budget(c.Path())
+			if inFlight == nil || limit <= 0 {
+				return next(c)
+			}
+
+			if n := inFlight.Add(1); n > limit {
+				inFlight.Add(-1)
+				m.logger.Debug("request rejected by load shedder", zap.String("route", c.Path()), zap.Int64("limit", limit))
+				c.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+				return web.RespondError(c, http.StatusServiceUnavailable, domain.ResponseError{Error: domain.ErrOverloaded.Error()})
+			}
+			defer inFlight.Add(-1)
+
+			return next(c)
+		}
+	}
+}
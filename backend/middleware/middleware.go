@@ -1,17 +1,47 @@
 package middleware
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/i18n"
+	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
 )
 
+// ShortIDKey is the context key handlers use to pass short url id to the
+// Logger middleware
+const ShortIDKey = "short_id"
+
+// APIKeyIDKey is the context key APIKey middleware uses to pass id of the API
+// key request is authenticated with to the Logger middleware
+const APIKeyIDKey = "api_key_id"
+
+// AuditKey is the context key handlers set to true to make Audit middleware
+// record safe method requests that change data
+const AuditKey = "audit"
+
+// HeaderAPIKey is the header API key is taken from
+const HeaderAPIKey = "X-API-Key"
+
+// APIKeyParam is the query parameter API key is taken from when HeaderAPIKey
+// is absent
+const APIKeyParam = "api_key"
+
 // GoMiddleware represent the data-struct for middleware
 type GoMiddleware struct {
 	logger *zap.Logger
@@ -24,14 +54,6 @@ func InitMiddleware(logger *zap.Logger) *GoMiddleware {
 	}
 }
 
-// CORS will handle the CORS middleware
-func (m *GoMiddleware) CORS(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		c.Response().Header().Set("Access-Control-Allow-Origin", "*")
-		return next(c)
-	}
-}
-
 // Logger is a middleware that logs requests
 func (m *GoMiddleware) Logger(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -45,19 +67,36 @@ func (m *GoMiddleware) Logger(next echo.HandlerFunc) echo.HandlerFunc {
 		req := c.Request()
 		res := c.Response()
 
-		id := req.Header.Get(echo.HeaderXRequestID)
-		if id == "" {
-			id = res.Header().Get(echo.HeaderXRequestID)
+		// route template is used instead of raw uri to keep cardinality low,
+		// it is empty when no route matched the request
+		route := c.Path()
+		if route == "" {
+			route = req.URL.Path
 		}
 
 		fields := []zapcore.Field{
 			zap.Int("status", res.Status),
 			zap.String("latency", time.Since(start).String()),
-			zap.String("id", id),
+			zap.String("id", requestID(c)),
 			zap.String("method", req.Method),
-			zap.String("uri", req.RequestURI),
+			zap.String("route", route),
 			zap.String("host", req.Host),
-			zap.String("remote_ip", c.RealIP()),
+			zap.String("remote_ip", web.ClientIP(c)),
+		}
+
+		// values below are set by inner middlewares and handlers, so they are
+		// only available once the request is processed
+		if claims, ok := requestctx.ClaimsFrom(req.Context()); ok {
+			fields = append(fields, zap.String("user_id", claims.Subject))
+			if claims.IsImpersonated() {
+				fields = append(fields, zap.String("impersonator", claims.Impersonator))
+			}
+		}
+		if keyID, ok := c.Get(APIKeyIDKey).(string); ok && keyID != "" {
+			fields = append(fields, zap.String("api_key_id", keyID))
+		}
+		if shortID, ok := c.Get(ShortIDKey).(string); ok && shortID != "" {
+			fields = append(fields, zap.String("short_id", shortID))
 		}
 
 		n := res.Status
@@ -76,25 +115,383 @@ func (m *GoMiddleware) Logger(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// Locale resolves locale of user-facing strings from Accept-Language header,
+// see i18n.LocaleFromContext
+func (m *GoMiddleware) Locale(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		locale := i18n.Match(req.Header.Get("Accept-Language"))
+		c.SetRequest(req.WithContext(i18n.WithLocale(req.Context(), locale)))
+		return next(c)
+	}
+}
+
+// TraceID sets X-Trace-ID response header to the trace id of the current span.
+// The header is set before calling next handler, so it is present even when
+// request is rejected by inner middleware. It must be registered after tracing
+// middleware.
+func (m *GoMiddleware) TraceID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if sc := trace.SpanContextFromContext(c.Request().Context()); sc.HasTraceID() {
+			c.Response().Header().Set(web.HeaderXTraceID, sc.TraceID().String())
+		}
+
+		return next(c)
+	}
+}
+
+// RequestLogger stores in request context a child logger annotated with trace,
+// span and request ids, so log lines of a single request can be correlated.
+// It must be registered after tracing and request id middlewares.
+func (m *GoMiddleware) RequestLogger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+
+		fields := []zapcore.Field{zap.String("request_id", requestID(c))}
+		if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+			fields = append(fields,
+				zap.String("trace_id", sc.TraceID().String()),
+				zap.String("span_id", sc.SpanID().String()),
+			)
+		}
+
+		ctx := web.WithLogger(req.Context(), m.logger.With(fields...))
+		c.SetRequest(req.WithContext(ctx))
+
+		return next(c)
+	}
+}
+
+// RequestContext stores request id and client address in request context,
+// see requestctx.RequestIDFrom and requestctx.ClientIPFrom. Client address is
+// resolved by web.ClientIP. It must be registered after request id
+// middleware.
+func (m *GoMiddleware) RequestContext(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := requestctx.WithClientIP(requestctx.WithRequestID(req.Context(), requestID(c)), web.ClientIP(c))
+		c.SetRequest(req.WithContext(ctx))
+
+		return next(c)
+	}
+}
+
+// requestID returns id of the request given by client or generated by
+// request id middleware
+func requestID(c echo.Context) string {
+	if id := c.Request().Header.Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Response().Header().Get(echo.HeaderXRequestID)
+}
+
+// StoreClaims is JWT middleware success handler, it stores claims of the
+// verified token in request context, see requestctx.ClaimsFrom. It must be
+// set as SuccessHandler of auth.Authenticator JWTConfig before routes are
+// registered.
+func StoreClaims(c echo.Context) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		return
+	}
+	if claims, ok := token.Claims.(*auth.Claims); ok {
+		c.SetRequest(c.Request().WithContext(requestctx.WithClaims(c.Request().Context(), claims)))
+	}
+}
+
 // HasRole validates that an authenticated user has at least one role from a
-// specified list. This method constructs the actual function that is used.
+// specified list, unauthenticated requests get 401 and users lacking the role
+// get 403, see requestctx.RequireRole. This method constructs the actual
+// function that is used.
 func (m *GoMiddleware) HasRole(roles ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			token, ok := c.Get("user").(*jwt.Token)
+			if _, err := requestctx.RequireRole(c.Request().Context(), roles...); err != nil {
+				return web.RespondDomainError(c, err, m.logger)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// DenyService rejects requests of service accounts, it guards routes that
+// manage users and their credentials. It must be placed after authentication
+// middleware, unauthenticated requests are passed through.
+func (m *GoMiddleware) DenyService(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if claims, ok := requestctx.ClaimsFrom(c.Request().Context()); ok && claims.IsService() {
+			return echo.NewHTTPError(http.StatusForbidden, "service accounts are not allowed to do that action")
+		}
+		return next(c)
+	}
+}
+
+// RequireScope rejects requests of service accounts whose API key doesn't
+// have the scope, users have every scope. It must be placed after
+// authentication middleware, unauthenticated requests are passed through.
+func (m *GoMiddleware) RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if claims, ok := requestctx.ClaimsFrom(c.Request().Context()); ok && !claims.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("api key doesn't have %s scope", scope))
+			}
+			return next(c)
+		}
+	}
+}
+
+// APIKey authenticates request with API key taken from HeaderAPIKey header or
+// APIKeyParam query parameter, cookies are never used. Claims of the key owner
+// are stored as JWT middleware stores them, so handlers and other middlewares
+// treat both the same way.
+func (m *GoMiddleware) APIKey(a domain.APIKeyAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderAPIKey)
+			if key == "" {
+				key = c.QueryParam(APIKeyParam)
+			}
+			if key == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing api key")
+			}
+
+			claims, err := a.Authenticate(c.Request().Context(), time.Now(), key)
+			if err != nil {
+				m.logger.Debug("api key authentication failed", zap.Error(err))
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+			}
+			if claims.PasswordChangeRequired {
+				return echo.NewHTTPError(http.StatusForbidden, auth.ErrPasswordChangeRequired.Error())
+			}
+
+			c.Set("user", &jwt.Token{Claims: claims, Valid: true})
+			c.Set(APIKeyIDKey, claims.ID)
+			StoreClaims(c)
+			return next(c)
+		}
+	}
+}
+
+// APIKeyOr authenticates request with API key when HeaderAPIKey header is set
+// and with fallback otherwise, e.g. JWT middleware. Query parameter is not
+// checked, routes that accept it use APIKey.
+func (m *GoMiddleware) APIKeyOr(a domain.APIKeyAuthenticator, fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	apiKey := m.APIKey(a)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withKey, withFallback := apiKey(next), fallback(next)
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(HeaderAPIKey) != "" {
+				return withKey(c)
+			}
+			return withFallback(c)
+		}
+	}
+}
+
+// NoStore forbids caching of responses, including error responses of inner
+// middlewares
+func (m *GoMiddleware) NoStore(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		c.Response().Header().Set("Pragma", "no-cache")
+		return next(c)
+	}
+}
+
+// SpanIdentity adds authenticated user id and roles, route template and :id
+// path parameter, stored under idAttr key, to the active span. It must be
+// placed after JWT middleware, spans of unauthenticated requests are left
+// untouched.
+func (m *GoMiddleware) SpanIdentity(idAttr string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := requestctx.ClaimsFrom(c.Request().Context())
 			if !ok {
-				return echo.NewHTTPError(http.StatusBadRequest, "JWT token missing or invalid")
+				return next(c)
 			}
-			claims, ok := token.Claims.(*auth.Claims)
+
+			span := trace.SpanFromContext(c.Request().Context())
+			span.SetAttributes(
+				semconv.EnduserIDKey.String(claims.Subject),
+				semconv.EnduserRoleKey.String(strings.Join(claims.Roles, ",")),
+				semconv.HTTPRouteKey.String(c.Path()),
+			)
+			if claims.IsImpersonated() {
+				span.SetAttributes(attribute.String("impersonator", claims.Impersonator))
+			}
+			if id := c.Param("id"); id != "" {
+				span.SetAttributes(attribute.String(idAttr, id))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Audit records every successful mutating request made by an authenticated user.
+// When the request is made with an impersonation token, the real admin is stored
+// in the entry and added to the active span.
+func (m *GoMiddleware) Audit(repo domain.AuditRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			req := c.Request()
+			switch req.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				if audit, _ := c.Get(AuditKey).(bool); !audit {
+					return nil
+				}
+			}
+
+			claims, ok := requestctx.ClaimsFrom(req.Context())
 			if !ok {
-				return echo.NewHTTPError(http.StatusInternalServerError, "can't convert jwt.Claims to auth.Claims")
+				return nil
+			}
+
+			span := trace.SpanFromContext(req.Context())
+			span.SetAttributes(attribute.String("userid", claims.Subject))
+			if claims.IsImpersonated() {
+				span.SetAttributes(attribute.String("impersonator", claims.Impersonator))
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusBadRequest {
+				return nil
+			}
+
+			entry := &domain.AuditEntry{
+				ID:           primitive.NewObjectID(),
+				Action:       fmt.Sprintf("%s %s", req.Method, c.Path()),
+				ActorID:      claims.Subject,
+				Impersonator: claims.Impersonator,
+				EntityID:     c.Param("id"),
+				Status:       status,
+				CreatedAt:    time.Now().Truncate(time.Millisecond).UTC(),
+			}
+			entry.RequestID, _ = requestctx.RequestIDFrom(req.Context())
+			entry.ClientIP, _ = requestctx.ClientIPFrom(req.Context())
+			if err := repo.Store(req.Context(), entry); err != nil {
+				m.logger.Error("can't store audit entry: ", zap.Error(err), zap.String("action", entry.Action))
 			}
 
-			if !claims.HasRole(roles...) {
-				return echo.NewHTTPError(http.StatusForbidden, "you are not authorized for that action")
+			return nil
+		}
+	}
+}
+
+// IPAllowlist restricts access to clients whose address belongs to one of the
+// allowed networks. Forwarded headers are honored only when the direct peer is
+// one of the trusted proxies, otherwise they can be spoofed by anyone. Requests
+// from other addresses get 404 so the protected routes are not advertised.
+func (m *GoMiddleware) IPAllowlist(allowed, trustedProxies []*net.IPNet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := clientIP(c.Request(), trustedProxies)
+			if ip == nil || !containsIP(allowed, ip) {
+				return echo.ErrNotFound
 			}
 
 			return next(c)
 		}
 	}
 }
+
+// ParseCIDRs parses list of networks in CIDR notation, single addresses are
+// treated as networks containing only that address
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address: %s", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %w", err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// IPExtractor returns extractor of client address honoring forwarded headers
+// only when the direct peer is one of the trusted proxies, set it as
+// echo.Echo.IPExtractor so c.RealIP() can't be spoofed. Empty string is
+// returned when forwarded address is invalid.
+func IPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	return func(req *http.Request) string {
+		ip := clientIP(req, trustedProxies)
+		if ip == nil {
+			return ""
+		}
+		return ip.String()
+	}
+}
+
+// clientIP returns address of the client that made the request. X-Forwarded-For
+// is walked from right to left skipping trusted proxies, X-Real-IP is used when
+// X-Forwarded-For is absent.
+func clientIP(req *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !containsIP(trustedProxies, peer) {
+		return peer
+	}
+
+	if xff := req.Header.Values(echo.HeaderXForwardedFor); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := parseHeaderIP(hops[i])
+			if ip == nil {
+				return nil
+			}
+			if !containsIP(trustedProxies, ip) {
+				return ip
+			}
+		}
+		return parseHeaderIP(hops[0])
+	}
+
+	if xri := req.Header.Get(echo.HeaderXRealIP); xri != "" {
+		return parseHeaderIP(xri)
+	}
+
+	return peer
+}
+
+func parseHeaderIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+	return net.ParseIP(s)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
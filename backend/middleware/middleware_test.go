@@ -2,6 +2,7 @@ package middleware_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
@@ -12,39 +13,126 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/golang/mock/gomock"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
+	"github.com/semka95/shortener/backend/audit/mock"
+	"github.com/semka95/shortener/backend/domain"
 	mdlwr "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
 )
 
 func TestCORS(t *testing.T) {
-	e := echo.New()
-	req := httptest.NewRequest(echo.GET, "/", nil)
-	res := httptest.NewRecorder()
-	c := e.NewContext(req, res)
 	m := mdlwr.InitMiddleware(nil)
+	newServer := func(cfg mdlwr.CORSConfig) *echo.Echo {
+		e := echo.New()
+		e.Use(m.CORS(cfg))
+		e.POST("/v1/url/create", func(c echo.Context) error {
+			c.Response().Header().Set(web.HeaderXTraceID, "trace")
+			return c.NoContent(http.StatusCreated)
+		})
+		return e
+	}
+	serve := func(e *echo.Echo, method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v1/url/create", nil)
+		if origin != "" {
+			req.Header.Set(echo.HeaderOrigin, origin)
+		}
+		if method == http.MethodOptions {
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+			req.Header.Set(echo.HeaderAccessControlRequestHeaders, "authorization,content-type")
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
 
-	h := m.CORS(func(c echo.Context) error {
-		return c.NoContent(http.StatusOK)
+	t.Run("any origin", func(t *testing.T) {
+		e := newServer(mdlwr.CORSConfig{AllowCredentials: true})
+
+		rec := serve(e, http.MethodPost, "")
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "*", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+
+		rec = serve(e, http.MethodPost, "https://evil.example.com")
+		assert.Equal(t, "*", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowCredentials), "credentials are never allowed for any origin")
 	})
 
-	err := h(c)
-	require.NoError(t, err)
-	assert.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"))
+	cfg := mdlwr.CORSConfig{AllowedOrigins: []string{"https://dashboard.example.com/"}, AllowCredentials: true, MaxAge: 3600}
+	e := newServer(cfg)
+
+	t.Run("credentialed preflight", func(t *testing.T) {
+		rec := serve(e, http.MethodOptions, "https://dashboard.example.com")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "https://dashboard.example.com", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		assert.Equal(t, "true", rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+		assert.Equal(t, "3600", rec.Header().Get(echo.HeaderAccessControlMaxAge))
+		assert.Contains(t, rec.Header().Get(echo.HeaderAccessControlAllowMethods), http.MethodPost)
+		assert.Contains(t, rec.Header().Get(echo.HeaderAccessControlAllowHeaders), echo.HeaderAuthorization)
+		assert.Contains(t, rec.Header().Values(echo.HeaderVary), echo.HeaderOrigin)
+	})
+
+	t.Run("credentialed request", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "https://dashboard.example.com")
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "https://dashboard.example.com", rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		assert.Equal(t, "true", rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+		expose := rec.Header().Get(echo.HeaderAccessControlExposeHeaders)
+		for _, h := range []string{web.HeaderXTraceID, web.HeaderXTotalCount, "Link"} {
+			assert.Contains(t, expose, h)
+		}
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlMaxAge))
+	})
+
+	t.Run("disallowed origin preflight", func(t *testing.T) {
+		rec := serve(e, http.MethodOptions, "https://evil.example.com")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowMethods))
+	})
+
+	t.Run("disallowed origin request", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "https://evil.example.com")
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowCredentials))
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlExposeHeaders))
+	})
+
+	t.Run("same origin request", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, "")
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	})
 }
 
 type loggerJSON struct {
-	Level   string `json:"L"`
-	Message string `json:"M"`
-	Status  int    `json:"status"`
-	Method  string `json:"method"`
-	URI     string `json:"uri"`
+	Level    string `json:"L"`
+	Message  string `json:"M"`
+	Status   int    `json:"status"`
+	Method   string `json:"method"`
+	Route    string `json:"route"`
+	UserID   string `json:"user_id"`
+	APIKeyID string `json:"api_key_id"`
+	ShortID  string `json:"short_id"`
+	RemoteIP string `json:"remote_ip"`
 }
 
 func TestLogger(t *testing.T) {
@@ -73,35 +161,65 @@ func TestLogger(t *testing.T) {
 			echo.HandlerFunc(func(c echo.Context) error {
 				return c.NoContent(http.StatusOK)
 			}),
-			loggerJSON{Level: "INFO", Message: "Success", Status: 200, Method: "GET", URI: "/"},
+			loggerJSON{Level: "INFO", Message: "Success", Status: 200, Method: "GET", Route: "/"},
 		},
 		{
 			"test server error",
 			echo.HandlerFunc(func(c echo.Context) error {
 				return errors.New("test error")
 			}),
-			loggerJSON{Level: "ERROR", Message: "Server error", Status: 500, Method: "GET", URI: "/"},
+			loggerJSON{Level: "ERROR", Message: "Server error", Status: 500, Method: "GET", Route: "/"},
 		},
 		{
 			"test client error",
 			echo.HandlerFunc(func(c echo.Context) error {
 				return c.NoContent(http.StatusBadRequest)
 			}),
-			loggerJSON{Level: "WARN", Message: "Client error", Status: 400, Method: "GET", URI: "/"},
+			loggerJSON{Level: "WARN", Message: "Client error", Status: 400, Method: "GET", Route: "/"},
 		},
 		{
 			"test redirection",
 			echo.HandlerFunc(func(c echo.Context) error {
 				return c.NoContent(http.StatusMovedPermanently)
 			}),
-			loggerJSON{Level: "INFO", Message: "Redirection", Status: 301, Method: "GET", URI: "/"},
+			loggerJSON{Level: "INFO", Message: "Redirection", Status: 301, Method: "GET", Route: "/"},
+		},
+		{
+			"test authenticated user",
+			echo.HandlerFunc(func(c echo.Context) error {
+				claims := auth.NewClaims("test user", []string{auth.RoleUser}, time.Now(), time.Minute)
+				c.SetRequest(c.Request().WithContext(requestctx.WithClaims(c.Request().Context(), claims)))
+				return c.NoContent(http.StatusOK)
+			}),
+			loggerJSON{Level: "INFO", Message: "Success", Status: 200, Method: "GET", Route: "/", UserID: "test user"},
+		},
+		{
+			"test route template and short id",
+			echo.HandlerFunc(func(c echo.Context) error {
+				c.SetPath("/:id")
+				c.Set(mdlwr.ShortIDKey, "abcdefg")
+				return c.NoContent(http.StatusMovedPermanently)
+			}),
+			loggerJSON{Level: "INFO", Message: "Redirection", Status: 301, Method: "GET", Route: "/:id", ShortID: "abcdefg"},
+		},
+		{
+			"test api key",
+			m.APIKey(apiKeyAuthenticator(func(key string) (*auth.Claims, error) {
+				claims := auth.NewClaims("test user", []string{auth.RoleUser}, time.Now(), time.Minute)
+				claims.ID = "test key"
+				return claims, nil
+			}))(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			}),
+			loggerJSON{Level: "INFO", Message: "Success", Status: 200, Method: "GET", Route: "/", UserID: "test user", APIKeyID: "test key"},
 		},
 	}
 
 	for _, test := range cases {
 		t.Run(test.Description, func(t *testing.T) {
 			e := echo.New()
-			req := httptest.NewRequest(echo.GET, "/", nil)
+			req := httptest.NewRequest(echo.GET, "/?api_key=shk_test", nil)
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
 			res := httptest.NewRecorder()
 			c := e.NewContext(req, res)
 
@@ -113,7 +231,8 @@ func TestLogger(t *testing.T) {
 			err = json.Unmarshal(l.Bytes(), answer)
 			require.NoError(t, err)
 
-			assert.EqualValues(t, test.Want, *answer)
+			test.Want.RemoteIP = "192.0.2.1"
+			assert.EqualValues(t, test.Want, *answer, "forwarded headers of untrusted peer are ignored")
 
 			l.Reset()
 		})
@@ -197,42 +316,1090 @@ func TestJWT(t *testing.T) {
 }
 
 func TestHasRole(t *testing.T) {
+	user := auth.NewClaims("test user", []string{auth.RoleUser}, time.Now(), time.Minute)
+	service := auth.NewClaims("service", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+	service.Type = auth.TypeService
+
+	cases := []struct {
+		description string
+		role        string
+		claims      *auth.Claims
+		code        int
+	}{
+		{"role check success", auth.RoleUser, user, http.StatusOK},
+		{"role check fail", auth.RoleAdmin, user, http.StatusForbidden},
+		// service accounts have no roles
+		{"service account", auth.RoleAdmin, service, http.StatusForbidden},
+		{"unauthenticated", auth.RoleUser, nil, http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			if tc.claims != nil {
+				req = req.WithContext(requestctx.WithClaims(req.Context(), tc.claims))
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := mdlwr.InitMiddleware(zap.NewNop()).HasRole(tc.role)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			require.NoError(t, h(c))
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
+
+func TestStoreClaims(t *testing.T) {
 	claims := auth.NewClaims("test user", []string{auth.RoleUser}, time.Now(), time.Minute)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	t.Run("role check success", func(t *testing.T) {
-		e := echo.New()
+	t.Run("token", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(echo.GET, "/", nil), httptest.NewRecorder())
+		c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, claims))
+
+		mdlwr.StoreClaims(c)
+		stored, ok := requestctx.ClaimsFrom(c.Request().Context())
+		require.True(t, ok)
+		assert.Same(t, claims, stored)
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(echo.GET, "/", nil), httptest.NewRecorder())
+
+		mdlwr.StoreClaims(c)
+		_, ok := requestctx.ClaimsFrom(c.Request().Context())
+		assert.False(t, ok)
+	})
+
+	t.Run("foreign claims", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(echo.GET, "/", nil), httptest.NewRecorder())
+		c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "test user"}))
+
+		mdlwr.StoreClaims(c)
+		_, ok := requestctx.ClaimsFrom(c.Request().Context())
+		assert.False(t, ok)
+	})
+}
+
+func TestRequestContext(t *testing.T) {
+	m := mdlwr.InitMiddleware(zap.NewNop())
+
+	t.Run("request id and client ip", func(t *testing.T) {
 		req := httptest.NewRequest(echo.GET, "/", nil)
-		res := httptest.NewRecorder()
-		c := e.NewContext(req, res)
-		c.Set("user", token)
+		req.Header.Set(echo.HeaderXRequestID, "request-1")
+		req.RemoteAddr = "203.0.113.7:4321"
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+
+		err := m.RequestContext(func(c echo.Context) error {
+			id, ok := requestctx.RequestIDFrom(c.Request().Context())
+			assert.True(t, ok)
+			assert.Equal(t, "request-1", id)
+			ip, ok := requestctx.ClientIPFrom(c.Request().Context())
+			assert.True(t, ok)
+			assert.Equal(t, "203.0.113.7", ip)
+			return nil
+		})(c)
+		require.NoError(t, err)
+	})
+
+	t.Run("spoofed forwarded headers", func(t *testing.T) {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		req.RemoteAddr = "203.0.113.7:4321"
+		req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+		req.Header.Set(echo.HeaderXRealIP, "198.51.100.7")
+		e := echo.New()
+		e.IPExtractor = mdlwr.IPExtractor(nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		err := m.RequestContext(func(c echo.Context) error {
+			ip, _ := requestctx.ClientIPFrom(c.Request().Context())
+			assert.Equal(t, "203.0.113.7", ip)
+			return nil
+		})(c)
+		require.NoError(t, err)
+	})
 
-		m := mdlwr.InitMiddleware(nil).HasRole(auth.RoleUser)
-		h := m(func(c echo.Context) error {
+	t.Run("generated request id", func(t *testing.T) {
+		e := echo.New()
+		e.Use(middleware.RequestID(), m.RequestContext)
+		var id string
+		e.GET("/", func(c echo.Context) error {
+			id, _ = requestctx.RequestIDFrom(c.Request().Context())
 			return c.NoContent(http.StatusOK)
 		})
 
-		err := h(c)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/", nil))
+		assert.NotEmpty(t, id)
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), id)
+	})
+}
+
+func TestServiceAccountScopes(t *testing.T) {
+	user := auth.NewClaims("user", []string{auth.RoleUser}, time.Now(), time.Minute)
+	service := auth.NewClaims("service", []string{}, time.Now(), time.Minute)
+	service.Type = auth.TypeService
+	service.Scopes = []string{auth.ScopeURLRead}
+
+	m := mdlwr.InitMiddleware(nil)
+	cases := []struct {
+		description string
+		middleware  echo.MiddlewareFunc
+		claims      *auth.Claims
+		code        int
+	}{
+		{"deny service, user", m.DenyService, user, http.StatusOK},
+		{"deny service, service", m.DenyService, service, http.StatusForbidden},
+		{"deny service, unauthenticated", m.DenyService, nil, http.StatusOK},
+		{"scope, user", m.RequireScope(auth.ScopeURLWrite), user, http.StatusOK},
+		{"scope, service with scope", m.RequireScope(auth.ScopeURLRead), service, http.StatusOK},
+		{"scope, service without scope", m.RequireScope(auth.ScopeURLWrite), service, http.StatusForbidden},
+		{"scope, unauthenticated", m.RequireScope(auth.ScopeURLWrite), nil, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			if tc.claims != nil {
+				req = req.WithContext(requestctx.WithClaims(req.Context(), tc.claims))
+			}
+			c := e.NewContext(req, rec)
+
+			err := tc.middleware(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			var herr *echo.HTTPError
+			require.ErrorAs(t, err, &herr)
+			assert.Equal(t, tc.code, herr.Code)
+		})
+	}
+}
+
+type apiKeyAuthenticator func(key string) (*auth.Claims, error)
+
+func (f apiKeyAuthenticator) Authenticate(_ context.Context, _ time.Time, key string) (*auth.Claims, error) {
+	return f(key)
+}
+
+func TestAPIKey(t *testing.T) {
+	claims := auth.NewClaims("test user", []string{auth.RoleUser}, time.Now(), time.Minute)
+	a := apiKeyAuthenticator(func(key string) (*auth.Claims, error) {
+		switch key {
+		case "shk_valid":
+			return claims, nil
+		case "shk_forced":
+			forced := *claims
+			forced.PasswordChangeRequired = true
+			return &forced, nil
+		}
+		return nil, domain.ErrAuthenticationFailure
+	})
+
+	cases := []struct {
+		description string
+		header      string
+		query       string
+		cookie      string
+		message     string
+		status      int
+	}{
+		{description: "key in header", header: "shk_valid"},
+		{description: "key in query", query: "shk_valid"},
+		{description: "header takes precedence", header: "shk_valid", query: "shk_invalid"},
+		{description: "missing key", message: "missing api key"},
+		{description: "cookie is ignored", cookie: "shk_valid", message: "missing api key"},
+		{description: "invalid key", query: "shk_invalid", message: "invalid api key"},
+		{description: "password change required", header: "shk_forced", message: "password change required", status: http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/?api_key="+tc.query, nil)
+			if tc.header != "" {
+				req.Header.Set(mdlwr.HeaderAPIKey, tc.header)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: mdlwr.APIKeyParam, Value: tc.cookie})
+			}
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+
+			h := mdlwr.InitMiddleware(zap.NewNop()).APIKey(a)(func(c echo.Context) error {
+				token, ok := c.Get("user").(*jwt.Token)
+				require.True(t, ok)
+				assert.Equal(t, claims, token.Claims)
+				return c.NoContent(http.StatusOK)
+			})
+
+			err := h(c)
+			if tc.message == "" {
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, res.Code)
+				return
+			}
+			var herr *echo.HTTPError
+			require.ErrorAs(t, err, &herr)
+			status := http.StatusUnauthorized
+			if tc.status != 0 {
+				status = tc.status
+			}
+			assert.Equal(t, status, herr.Code)
+			assert.EqualValues(t, tc.message, herr.Message)
+		})
+	}
+}
+
+func TestAPIKeyOr(t *testing.T) {
+	claims := auth.NewClaims("test user", []string{auth.RoleUser}, time.Now(), time.Minute)
+	a := apiKeyAuthenticator(func(key string) (*auth.Claims, error) {
+		if key != "shk_valid" {
+			return nil, domain.ErrAuthenticationFailure
+		}
+		return claims, nil
+	})
+	fallback := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusTeapot)
+		}
+	}
+
+	cases := []struct {
+		description string
+		header      string
+		query       string
+		code        int
+	}{
+		{description: "key in header", header: "shk_valid", code: http.StatusOK},
+		{description: "invalid key in header", header: "shk_invalid", code: http.StatusUnauthorized},
+		{description: "no key uses fallback", code: http.StatusTeapot},
+		{description: "key in query uses fallback", query: "shk_valid", code: http.StatusTeapot},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/?api_key="+tc.query, nil)
+			if tc.header != "" {
+				req.Header.Set(mdlwr.HeaderAPIKey, tc.header)
+			}
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+
+			h := mdlwr.InitMiddleware(zap.NewNop()).APIKeyOr(a, fallback)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			err := h(c)
+			if tc.code == http.StatusOK {
+				require.NoError(t, err)
+				return
+			}
+			var herr *echo.HTTPError
+			require.ErrorAs(t, err, &herr)
+			assert.Equal(t, tc.code, herr.Code)
+		})
+	}
+}
+
+func TestNoStore(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(echo.GET, "/", nil)
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+
+	h := mdlwr.InitMiddleware(nil).NoStore(func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusUnauthorized)
+	})
+	_ = h(c)
+
+	assert.Equal(t, "no-store", res.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, "no-cache", res.Header().Get("Pragma"))
+}
+
+func TestAudit(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	repo := mock.NewMockAuditRepository(controller)
+
+	adminID := "507f191e810c19729de860ec"
+	userID := "507f191e810c19729de860ea"
+	impClaims := auth.NewImpersonationClaims(userID, []string{auth.RoleUser}, adminID, time.Now())
+	userClaims := auth.NewClaims(userID, []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	cases := []struct {
+		description string
+		method      string
+		claims      *auth.Claims
+		requestID   string
+		audit       bool
+		status      int
+		mockCalls   func(repo *mock.MockAuditRepository, entry **domain.AuditEntry)
+		check       func(entry *domain.AuditEntry, attrs []attribute.KeyValue)
+	}{
+		{
+			description: "impersonated action attributed to admin",
+			method:      echo.DELETE,
+			claims:      impClaims,
+			requestID:   "request-1",
+			status:      http.StatusNoContent,
+			mockCalls: func(repo *mock.MockAuditRepository, entry **domain.AuditEntry) {
+				repo.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *domain.AuditEntry) error {
+					*entry = e
+					return nil
+				})
+			},
+			check: func(entry *domain.AuditEntry, attrs []attribute.KeyValue) {
+				require.NotNil(t, entry)
+				assert.Equal(t, userID, entry.ActorID)
+				assert.Equal(t, adminID, entry.Impersonator)
+				assert.Equal(t, "DELETE /v1/url/:id", entry.Action)
+				assert.Equal(t, "test123", entry.EntityID)
+				assert.Equal(t, "request-1", entry.RequestID)
+				assert.Equal(t, "203.0.113.7", entry.ClientIP)
+				assert.Contains(t, attrs, attribute.String("impersonator", adminID))
+			},
+		},
+		{
+			description: "regular user action",
+			method:      echo.PUT,
+			claims:      userClaims,
+			status:      http.StatusNoContent,
+			mockCalls: func(repo *mock.MockAuditRepository, entry **domain.AuditEntry) {
+				repo.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *domain.AuditEntry) error {
+					*entry = e
+					return nil
+				})
+			},
+			check: func(entry *domain.AuditEntry, attrs []attribute.KeyValue) {
+				require.NotNil(t, entry)
+				assert.Equal(t, userID, entry.ActorID)
+				assert.Empty(t, entry.Impersonator)
+				// request metadata is not stored in context
+				assert.Empty(t, entry.RequestID)
+				assert.Empty(t, entry.ClientIP)
+				assert.NotContains(t, attrs, attribute.String("impersonator", adminID))
+			},
+		},
+		{
+			description: "read request is not audited",
+			method:      echo.GET,
+			claims:      impClaims,
+			status:      http.StatusOK,
+			mockCalls:   func(repo *mock.MockAuditRepository, entry **domain.AuditEntry) {},
+			check: func(entry *domain.AuditEntry, attrs []attribute.KeyValue) {
+				assert.Nil(t, entry)
+			},
+		},
+		{
+			description: "read request marked by handler is audited",
+			method:      echo.GET,
+			claims:      userClaims,
+			audit:       true,
+			status:      http.StatusCreated,
+			mockCalls: func(repo *mock.MockAuditRepository, entry **domain.AuditEntry) {
+				repo.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, e *domain.AuditEntry) error {
+					*entry = e
+					return nil
+				})
+			},
+			check: func(entry *domain.AuditEntry, attrs []attribute.KeyValue) {
+				require.NotNil(t, entry)
+				assert.Equal(t, "GET /v1/url/:id", entry.Action)
+			},
+		},
+		{
+			description: "failed request is not audited",
+			method:      echo.DELETE,
+			claims:      impClaims,
+			status:      http.StatusForbidden,
+			mockCalls:   func(repo *mock.MockAuditRepository, entry **domain.AuditEntry) {},
+			check: func(entry *domain.AuditEntry, attrs []attribute.KeyValue) {
+				assert.Nil(t, entry)
+			},
+		},
+		{
+			description: "anonymous request is not audited",
+			method:      echo.DELETE,
+			claims:      nil,
+			status:      http.StatusNoContent,
+			mockCalls:   func(repo *mock.MockAuditRepository, entry **domain.AuditEntry) {},
+			check: func(entry *domain.AuditEntry, attrs []attribute.KeyValue) {
+				assert.Nil(t, entry)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			var entry *domain.AuditEntry
+			tc.mockCalls(repo, &entry)
+
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			ctx, span := tp.Tracer("").Start(context.Background(), "request")
+			if tc.requestID != "" {
+				ctx = requestctx.WithClientIP(requestctx.WithRequestID(ctx, tc.requestID), "203.0.113.7")
+			}
+
+			e := echo.New()
+			req := httptest.NewRequest(tc.method, "/v1/url/test123", nil).WithContext(ctx)
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+			c.SetPath("/v1/url/:id")
+			c.SetParamNames("id")
+			c.SetParamValues("test123")
+
+			h := mdlwr.InitMiddleware(zap.NewNop()).Audit(repo)(func(c echo.Context) error {
+				// authentication middleware of the route runs after audit one
+				if tc.claims != nil {
+					c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, tc.claims))
+					mdlwr.StoreClaims(c)
+				}
+				if tc.audit {
+					c.Set(mdlwr.AuditKey, true)
+				}
+				return c.NoContent(tc.status)
+			})
+
+			err := h(c)
+			require.NoError(t, err)
+			span.End()
+
+			tc.check(entry, sr.Ended()[0].Attributes())
+		})
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	trusted, err := mdlwr.ParseCIDRs([]string{"192.168.1.1"})
+	require.NoError(t, err)
+	extract := mdlwr.IPExtractor(trusted)
+
+	cases := []struct {
+		Description string
+		RemoteAddr  string
+		Headers     map[string]string
+		IP          string
+	}{
+		{"direct peer", "8.8.8.8:1234", nil, "8.8.8.8"},
+		{"spoofed forwarded for from untrusted peer", "8.8.8.8:1234", map[string]string{echo.HeaderXForwardedFor: "10.1.2.3"}, "8.8.8.8"},
+		{"spoofed real ip from untrusted peer", "8.8.8.8:1234", map[string]string{echo.HeaderXRealIP: "10.1.2.3"}, "8.8.8.8"},
+		{"forwarded for from trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "10.1.2.3"}, "10.1.2.3"},
+		{"invalid forwarded for from trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "garbage"}, ""},
+	}
+
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			req := httptest.NewRequest(echo.GET, "/", nil)
+			req.RemoteAddr = test.RemoteAddr
+			for k, v := range test.Headers {
+				req.Header.Set(k, v)
+			}
+
+			assert.Equal(t, test.IP, extract(req))
+		})
+	}
+}
+
+func TestIPAllowlist(t *testing.T) {
+	allowed, err := mdlwr.ParseCIDRs([]string{"10.0.0.0/8", "2001:db8::/32"})
+	require.NoError(t, err)
+	trusted, err := mdlwr.ParseCIDRs([]string{"192.168.1.1", "172.16.0.0/12"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		Description string
+		RemoteAddr  string
+		Headers     map[string]string
+		Code        int
+	}{
+		{"direct allowed peer", "10.1.2.3:1234", nil, http.StatusOK},
+		{"direct allowed ipv6 peer", "[2001:db8::1]:1234", nil, http.StatusOK},
+		{"direct denied peer", "8.8.8.8:1234", nil, http.StatusNotFound},
+		{"spoofed forwarded for from untrusted peer", "8.8.8.8:1234", map[string]string{echo.HeaderXForwardedFor: "10.1.2.3"}, http.StatusNotFound},
+		{"spoofed real ip from untrusted peer", "8.8.8.8:1234", map[string]string{echo.HeaderXRealIP: "10.1.2.3"}, http.StatusNotFound},
+		{"allowed peer forwarding denied client is not trusted", "10.1.2.3:1234", map[string]string{echo.HeaderXForwardedFor: "8.8.8.8"}, http.StatusOK},
+		{"forwarded for from trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "10.1.2.3"}, http.StatusOK},
+		{"forwarded for denied client from trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "8.8.8.8"}, http.StatusNotFound},
+		{"spoofed leftmost hop behind trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "10.1.2.3, 8.8.8.8"}, http.StatusNotFound},
+		{"chain of trusted proxies", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "10.1.2.3, 172.16.0.5"}, http.StatusOK},
+		{"real ip from trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXRealIP: "10.1.2.3"}, http.StatusOK},
+		{"trusted proxy without headers", "192.168.1.1:1234", nil, http.StatusNotFound},
+		{"invalid forwarded for from trusted proxy", "192.168.1.1:1234", map[string]string{echo.HeaderXForwardedFor: "garbage"}, http.StatusNotFound},
+	}
+
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(echo.GET, "/v1/admin/users", nil)
+			req.RemoteAddr = test.RemoteAddr
+			for k, v := range test.Headers {
+				req.Header.Set(k, v)
+			}
+			res := httptest.NewRecorder()
+			c := e.NewContext(req, res)
+
+			h := mdlwr.InitMiddleware(nil).IPAllowlist(allowed, trusted)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			err := h(c)
+			if test.Code == http.StatusOK {
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, res.Code)
+				return
+			}
+			var herr *echo.HTTPError
+			require.ErrorAs(t, err, &herr)
+			assert.Equal(t, test.Code, herr.Code)
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := mdlwr.ParseCIDRs([]string{"127.0.0.1", "::1", "10.0.0.0/8"})
+	require.NoError(t, err)
+	require.Len(t, nets, 3)
+	assert.Equal(t, "127.0.0.1/32", nets[0].String())
+	assert.Equal(t, "::1/128", nets[1].String())
+	assert.Equal(t, "10.0.0.0/8", nets[2].String())
+
+	_, err = mdlwr.ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = mdlwr.ParseCIDRs([]string{"not an ip"})
+	assert.Error(t, err)
+}
+
+func TestRequestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	m := mdlwr.InitMiddleware(zap.New(core))
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+
+	e := echo.New()
+	ctx, span := tracer.Start(context.Background(), "http request")
+	defer span.End()
+	req := httptest.NewRequest(echo.GET, "/", nil).WithContext(ctx)
+	req.Header.Set(echo.HeaderXRequestID, "test-request")
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+
+	h := m.RequestLogger(func(c echo.Context) error {
+		web.LoggerFromContext(c.Request().Context()).Info("handler")
+		return c.NoContent(http.StatusOK)
+	})
+
+	err := h(c)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "test-request", fields["request_id"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), fields["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), fields["span_id"])
+}
+
+func TestLoggerFromContextFallback(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	restore := zap.ReplaceGlobals(zap.New(core))
+	defer restore()
+
+	web.LoggerFromContext(context.Background()).Info("fallback")
+
+	assert.Equal(t, 1, logs.Len())
+}
+
+func TestTraceID(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	m := mdlwr.InitMiddleware(zap.NewNop())
+
+	e := echo.New()
+	e.JSONSerializer = web.JSONSerializer{}
+	e.Use(otelecho.Middleware("test", otelecho.WithTracerProvider(tp)))
+	e.Use(m.TraceID)
+	e.GET("/server-error", func(c echo.Context) error {
+		return c.JSON(http.StatusInternalServerError, domain.ResponseError{Error: "server error"})
+	})
+	e.GET("/client-error", func(c echo.Context) error {
+		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "client error"})
+	})
+	e.POST("/limited", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, middleware.BodyLimit("1B"))
+
+	cases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Body        string
+		Code        int
+		BodyTraceID bool
+	}{
+		{"server error has trace id in body", echo.GET, "/server-error", "", http.StatusInternalServerError, true},
+		{"client error has no trace id in body", echo.GET, "/client-error", "", http.StatusBadRequest, false},
+		{"rejected before handler", echo.POST, "/limited", "too large body", http.StatusRequestEntityTooLarge, false},
+		{"route not found", echo.GET, "/not-found", "", http.StatusNotFound, false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.Description, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp.RegisterSpanProcessor(sr)
+			defer tp.UnregisterSpanProcessor(sr)
+
+			req := httptest.NewRequest(test.Method, test.Path, bytes.NewBufferString(test.Body))
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+
+			assert.Equal(t, test.Code, res.Code)
+			spans := sr.Ended()
+			require.Len(t, spans, 1)
+			traceID := spans[0].SpanContext().TraceID().String()
+			assert.Equal(t, traceID, res.Header().Get(web.HeaderXTraceID))
+
+			body := new(domain.ResponseError)
+			if test.BodyTraceID {
+				require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+				assert.Equal(t, traceID, body.TraceID)
+			}
+			if test.Code == http.StatusBadRequest {
+				require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+				assert.Empty(t, body.TraceID)
+			}
+		})
+	}
+}
+
+func TestLoadShed(t *testing.T) {
+	const redirectLimit, apiLimit = 4, 2
+	shedder := mdlwr.NewLoadShedder(mdlwr.LoadShedConfig{RedirectLimit: redirectLimit, APILimit: apiLimit, RetryAfter: 5})
+
+	release := make(chan struct{})
+	slow := func(c echo.Context) error {
+		<-release
+		return c.NoContent(http.StatusOK)
+	}
+
+	e := echo.New()
+	e.Use(mdlwr.InitMiddleware(zap.NewNop()).LoadShed(shedder))
+	e.GET("/:id", slow)
+	e.GET("/v1/url/:id", slow)
+	e.GET("/v1/status", slow)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(echo.GET, path, nil))
+		return res
+	}
+
+	// saturate both budgets with slow requests
+	codes := make(chan int, redirectLimit+apiLimit+1)
+	for i := 0; i < redirectLimit; i++ {
+		go func() { codes <- serve("/test123").Code }()
+	}
+	for i := 0; i < apiLimit; i++ {
+		go func() { codes <- serve("/v1/url/test123").Code }()
+	}
+	require.Eventually(t, func() bool {
+		redirect, api := shedder.InFlight()
+		return redirect == redirectLimit && api == apiLimit
+	}, time.Second, time.Millisecond)
+
+	for _, path := range []string{"/test123", "/v1/url/test123"} {
+		start := time.Now()
+		res := serve(path)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+		assert.Equal(t, "5", res.Header().Get(echo.HeaderRetryAfter))
+
+		body := new(domain.ResponseError)
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+		assert.Equal(t, domain.ErrOverloaded.Error(), body.Error)
+	}
+
+	// health check is not counted and not rejected
+	go func() { codes <- serve("/v1/status").Code }()
+	time.Sleep(10 * time.Millisecond)
+	redirect, api := shedder.InFlight()
+	assert.Equal(t, int64(redirectLimit), redirect)
+	assert.Equal(t, int64(apiLimit), api)
+
+	close(release)
+	for i := 0; i < redirectLimit+apiLimit+1; i++ {
+		assert.Equal(t, http.StatusOK, <-codes)
+	}
+
+	redirect, api = shedder.InFlight()
+	assert.Zero(t, redirect)
+	assert.Zero(t, api)
+	assert.Equal(t, http.StatusOK, serve("/test123").Code)
+}
+
+func TestLoadShedDisabled(t *testing.T) {
+	shedder := mdlwr.NewLoadShedder(mdlwr.LoadShedConfig{})
+	e := echo.New()
+	e.Use(mdlwr.InitMiddleware(zap.NewNop()).LoadShed(shedder))
+	e.GET("/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, httptest.NewRequest(echo.GET, "/test123", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestRateLimiterStore(t *testing.T) {
+	limits := tests.NewMemoryLimitStore()
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	newStore := func(name string) *mdlwr.RateLimiterStore {
+		s := mdlwr.NewRateLimiterStore(limits, name, 1, 2)
+		s.SetClock(func() time.Time { return now })
+		return s
+	}
+	// stores of the same name share clients like instances of the service
+	first, second, other := newStore("create"), newStore("create"), newStore("challenge")
+
+	allow := func(s *mdlwr.RateLimiterStore, identifier string) bool {
+		ok, err := s.Allow(identifier)
 		require.NoError(t, err)
+		return ok
+	}
+	assert.True(t, allow(first, "client"))
+	assert.True(t, allow(second, "client"))
+	assert.False(t, allow(first, "client"), "burst is used up by both instances")
+	assert.True(t, allow(first, "another"), "other client")
+	assert.True(t, allow(other, "client"), "other limiter")
+
+	now = now.Add(3 * time.Second)
+	assert.True(t, allow(second, "client"), "window passed")
+}
+
+func TestReadOnly(t *testing.T) {
+	mode := domain.NewReadOnlyMode(true)
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	e := echo.New()
+	e.Use(mdlwr.InitMiddleware(zap.NewNop()).ReadOnly(mode, mdlwr.ReadOnlyConfig{RetryAfter: 30}))
+	e.GET("/:id", ok)
+	e.POST("/v1/url/create", ok)
+	e.DELETE("/v1/url/:id", ok)
+	e.GET("/v1/url/shorten", ok)
+	e.POST("/v1/url/lookup", ok)
+	e.POST("/v1/admin/maintenance/readonly", ok)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+		return res
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{method: echo.GET, path: "/test123", code: http.StatusOK},
+		{method: echo.POST, path: "/v1/url/create", code: http.StatusServiceUnavailable},
+		{method: echo.DELETE, path: "/v1/url/test123", code: http.StatusServiceUnavailable},
+		{method: echo.GET, path: "/v1/url/shorten", code: http.StatusServiceUnavailable},
+		{method: echo.POST, path: "/v1/url/lookup", code: http.StatusOK},
+		{method: echo.POST, path: "/v1/admin/maintenance/readonly", code: http.StatusOK},
+	}
+	for _, tc := range cases {
+		res := serve(tc.method, tc.path)
+		assert.Equal(t, tc.code, res.Code, "%s %s", tc.method, tc.path)
+		if tc.code != http.StatusServiceUnavailable {
+			continue
+		}
+		assert.Equal(t, "30", res.Header().Get(echo.HeaderRetryAfter))
+		body := new(domain.ResponseError)
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+		assert.Equal(t, domain.ErrReadOnly.Error(), body.Error)
+		assert.Equal(t, domain.ErrCodeReadOnly, body.Code)
+	}
+
+	// mode is switched off live
+	mode.Set(false)
+	assert.Equal(t, http.StatusOK, serve(echo.POST, "/v1/url/create").Code)
+	assert.Equal(t, http.StatusOK, serve(echo.GET, "/v1/url/shorten").Code)
+}
+
+func TestDegraded(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	urlBreaker := store.NewCircuitBreaker("url", 1, 5*time.Second, zap.NewNop())
+	urlBreaker.SetClock(func() time.Time { return now })
+	userBreaker := store.NewCircuitBreaker("user", 1, 5*time.Second, zap.NewNop())
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	e := echo.New()
+	e.Use(mdlwr.InitMiddleware(zap.NewNop()).Degraded(urlBreaker, userBreaker))
+	e.GET("/:id", ok)
+	e.POST("/v1/url/create", ok)
+	e.POST("/v1/url/lookup", ok)
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+		return res
+	}
+
+	assert.Equal(t, http.StatusOK, serve(echo.POST, "/v1/url/create").Code)
+
+	_ = urlBreaker.Do(func() error { return errors.New("server selection timeout") })
+	now = now.Add(1500 * time.Millisecond)
+
+	res := serve(echo.POST, "/v1/url/create")
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "4", res.Header().Get(echo.HeaderRetryAfter))
+	body := new(domain.ResponseError)
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+	assert.Equal(t, domain.ErrUnavailable.Error(), body.Error)
+	assert.Equal(t, domain.ErrCodeUnavailable, body.Code)
+
+	// reads are served
+	assert.Equal(t, http.StatusOK, serve(echo.GET, "/test123").Code)
+	assert.Equal(t, http.StatusOK, serve(echo.POST, "/v1/url/lookup").Code)
+
+	// write after open timeout probes database
+	now = now.Add(4 * time.Second)
+	assert.Equal(t, http.StatusOK, serve(echo.POST, "/v1/url/create").Code)
+}
+
+func TestTimeout(t *testing.T) {
+	cfg := mdlwr.TimeoutConfig{
+		Redirect: 20,
+		API:      50,
+		Routes:   map[string]int{"/v1/export": 0},
+	}
+
+	newEcho := func(handler echo.HandlerFunc) *echo.Echo {
+		e := echo.New()
+		e.Use(mdlwr.InitMiddleware(zap.NewNop()).Timeout(cfg))
+		e.GET("/:id", handler)
+		e.GET("/v1/url/:id", handler)
+		e.GET("/v1/export", handler)
+		return e
+	}
+
+	t.Run("slow handler gets 504 and canceled context", func(t *testing.T) {
+		canceled := make(chan error, 1)
+		e := newEcho(func(c echo.Context) error {
+			<-c.Request().Context().Done()
+			canceled <- c.Request().Context().Err()
+			return c.JSON(http.StatusOK, "late")
+		})
+
+		for path, budget := range map[string]time.Duration{"/test123": 20 * time.Millisecond, "/v1/url/test123": 50 * time.Millisecond} {
+			res := httptest.NewRecorder()
+			start := time.Now()
+			e.ServeHTTP(res, httptest.NewRequest(echo.GET, path, nil))
+			elapsed := time.Since(start)
+
+			assert.GreaterOrEqual(t, elapsed, budget)
+			assert.Less(t, elapsed, budget+200*time.Millisecond)
+			assert.Equal(t, http.StatusGatewayTimeout, res.Code)
+			assert.ErrorIs(t, <-canceled, context.DeadlineExceeded)
+
+			body := new(domain.ResponseError)
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+			assert.Equal(t, domain.ErrTimeout.Error(), body.Error)
+		}
 	})
 
-	t.Run("role check fail", func(t *testing.T) {
+	t.Run("handler ignoring context does not hold response", func(t *testing.T) {
+		release := make(chan struct{})
+		e := newEcho(func(c echo.Context) error {
+			<-release
+			c.Response().Header().Set("X-Late", "1")
+			return c.String(http.StatusOK, "late")
+		})
+
+		codes := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, httptest.NewRequest(echo.GET, "/test123", nil))
+			codes <- res
+		}()
+
+		// 504 is written while handler is still running
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		res := <-codes
+		assert.Equal(t, http.StatusGatewayTimeout, res.Code)
+		assert.Empty(t, res.Header().Get("X-Late"))
+		assert.NotContains(t, res.Body.String(), "late")
+	})
+
+	t.Run("fast handler is not affected", func(t *testing.T) {
+		e := newEcho(func(c echo.Context) error {
+			_, ok := c.Request().Context().Deadline()
+			assert.True(t, ok)
+			c.Response().Header().Set("X-Custom", "1")
+			return c.String(http.StatusOK, "ok")
+		})
+
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(echo.GET, "/test123", nil))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "1", res.Header().Get("X-Custom"))
+		assert.Equal(t, "ok", res.Body.String())
+	})
+
+	t.Run("exempt route has no deadline", func(t *testing.T) {
+		e := newEcho(func(c echo.Context) error {
+			_, ok := c.Request().Context().Deadline()
+			assert.False(t, ok)
+			time.Sleep(80 * time.Millisecond)
+			return c.String(http.StatusOK, "exported")
+		})
+
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(echo.GET, "/v1/export", nil))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "exported", res.Body.String())
+	})
+
+	t.Run("started response is not replaced", func(t *testing.T) {
+		e := newEcho(func(c echo.Context) error {
+			c.Response().WriteHeader(http.StatusOK)
+			<-c.Request().Context().Done()
+			_, err := c.Response().Write([]byte("partial"))
+			return err
+		})
+
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(echo.GET, "/test123", nil))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "partial", res.Body.String())
+	})
+
+	t.Run("panic is passed to recover middleware", func(t *testing.T) {
 		e := echo.New()
-		req := httptest.NewRequest(echo.GET, "/", nil)
+		e.Use(middleware.Recover())
+		e.Use(mdlwr.InitMiddleware(zap.NewNop()).Timeout(cfg))
+		e.GET("/:id", func(c echo.Context) error {
+			panic("boom")
+		})
+
 		res := httptest.NewRecorder()
-		c := e.NewContext(req, res)
-		c.Set("user", token)
+		e.ServeHTTP(res, httptest.NewRequest(echo.GET, "/test123", nil))
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+	})
+}
 
-		m := mdlwr.InitMiddleware(nil).HasRole(auth.RoleAdmin)
-		h := m(func(c echo.Context) error {
-			return c.NoContent(http.StatusOK)
+func TestContentType(t *testing.T) {
+	cfg := mdlwr.ContentTypeConfig{
+		Groups: map[string][]string{
+			"/v1":       {echo.MIMEApplicationJSON},
+			"/v1/forms": {echo.MIMEApplicationJSON, echo.MIMEApplicationForm},
+		},
+		Skip: []string{"/v1/upload"},
+	}
+	e := echo.New()
+	e.Use(mdlwr.InitMiddleware(zap.NewNop()).ContentType(cfg))
+	ok := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	for _, path := range []string{"/v1/url", "/v1/forms/url", "/v1/upload", "/other"} {
+		e.Any(path, ok)
+	}
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+		message     string
+	}{
+		{description: "json", method: echo.POST, path: "/v1/url", contentType: "application/json", body: "{}", code: http.StatusOK},
+		{description: "json with charset", method: echo.PUT, path: "/v1/url", contentType: "application/json; charset=utf-8", body: "{}", code: http.StatusOK},
+		{description: "media type is case insensitive", method: echo.POST, path: "/v1/url", contentType: "Application/JSON", body: "{}", code: http.StatusOK},
+		{description: "plain text", method: echo.POST, path: "/v1/url", contentType: "text/plain", body: "{}", code: http.StatusUnsupportedMediaType, message: `Content-Type "text/plain" is not supported, use application/json`},
+		{description: "missing content type", method: echo.PATCH, path: "/v1/url", body: "{}", code: http.StatusUnsupportedMediaType, message: "Content-Type header is missing, use application/json"},
+		{description: "malformed content type", method: echo.POST, path: "/v1/url", contentType: "/json", body: "{}", code: http.StatusUnsupportedMediaType, message: `Content-Type "/json" is not supported, use application/json`},
+		{description: "form on json group", method: echo.POST, path: "/v1/url", contentType: "application/x-www-form-urlencoded", body: "a=1", code: http.StatusUnsupportedMediaType, message: `Content-Type "application/x-www-form-urlencoded" is not supported, use application/json`},
+		{description: "form on form group", method: echo.POST, path: "/v1/forms/url", contentType: "application/x-www-form-urlencoded", body: "a=1", code: http.StatusOK},
+		{description: "plain text on form group", method: echo.POST, path: "/v1/forms/url", contentType: "text/plain", body: "a", code: http.StatusUnsupportedMediaType, message: `Content-Type "text/plain" is not supported, use application/json or application/x-www-form-urlencoded`},
+		{description: "get", method: echo.GET, path: "/v1/url", contentType: "text/plain", body: "a", code: http.StatusOK},
+		{description: "delete", method: echo.DELETE, path: "/v1/url", contentType: "text/plain", body: "a", code: http.StatusOK},
+		{description: "empty body", method: echo.POST, path: "/v1/url", code: http.StatusOK},
+		{description: "multipart upload", method: echo.POST, path: "/v1/upload", contentType: "multipart/form-data; boundary=x", body: "--x--", code: http.StatusOK},
+		{description: "route outside of groups", method: echo.POST, path: "/other", contentType: "text/plain", body: "a", code: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tc.contentType)
+			}
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+
+			assert.Equal(t, tc.code, res.Code)
+			if tc.message != "" {
+				body := new(domain.ResponseError)
+				require.NoError(t, json.Unmarshal(res.Body.Bytes(), body))
+				assert.Equal(t, tc.message, body.Error)
+			}
 		})
+	}
+}
 
-		err := h(c)
-		var herr *echo.HTTPError
-		if !errors.As(err, &herr) {
-			t.Error("error is not type of echo.HTTPError")
-		}
-		assert.EqualValues(t, herr.Message, "you are not authorized for that action")
+func TestCanonicalPath(t *testing.T) {
+	e := echo.New()
+	e.Pre(mdlwr.InitMiddleware(zap.NewNop()).CanonicalPath("/v1"))
+	e.Any("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().URL.EscapedPath())
 	})
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+		served   string
+	}{
+		{path: "/", code: http.StatusOK, served: "/"},
+		{path: "/abc", code: http.StatusOK, served: "/abc"},
+		{path: "/abc/", code: http.StatusOK, served: "/abc"},
+		{path: "///abc", code: http.StatusOK, served: "/abc"},
+		{path: "//abc/", code: http.StatusOK, served: "/abc"},
+		{path: "/abc//", code: http.StatusOK, served: "/abc//"},
+		{path: "/abc/docs//page/", code: http.StatusOK, served: "/abc/docs//page/"},
+		{path: "/a%2Fb/", code: http.StatusOK, served: "/a%2Fb"},
+		{path: "/v1/url", code: http.StatusOK, served: "/v1/url"},
+		{path: "/v1/", code: http.StatusPermanentRedirect, location: "/v1"},
+		{path: "/v1/url/abc/", code: http.StatusPermanentRedirect, location: "/v1/url/abc"},
+		{path: "//v1//url/abc?a=1", code: http.StatusPermanentRedirect, location: "/v1/url/abc?a=1"},
+		{path: "/v1/url/a%2Fb/", code: http.StatusPermanentRedirect, location: "/v1/url/a%2Fb"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, httptest.NewRequest(echo.POST, tc.path, nil))
+
+			assert.Equal(t, tc.code, res.Code)
+			assert.Equal(t, tc.location, res.Header().Get(echo.HeaderLocation))
+			if tc.served != "" {
+				assert.Equal(t, tc.served, res.Body.String())
+			}
+		})
+	}
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// rateLimitTimeout bounds request to limit store made by rate limiter, echo
+// store interface doesn't pass request context
+const rateLimitTimeout = time.Second
+
+// RateLimiterStore is echo rate limiter store backed by domain.LimitStore, so
+// client is limited whichever instance serves it. Client makes burst requests
+// within burst/rate seconds, denied requests are counted too, so client
+// exceeding the rate is served once it slows down.
+type RateLimiterStore struct {
+	limits domain.LimitStore
+	name   string
+	burst  int
+	window time.Duration
+	now    func() time.Time
+}
+
+var _ middleware.RateLimiterStore = (*RateLimiterStore)(nil)
+
+// NewRateLimiterStore creates RateLimiterStore, name separates clients of
+// different limiters sharing limits
+func NewRateLimiterStore(limits domain.LimitStore, name string, rate float64, burst int) *RateLimiterStore {
+	return &RateLimiterStore{
+		limits: limits,
+		name:   name,
+		burst:  burst,
+		window: time.Duration(float64(burst) / rate * float64(time.Second)),
+		now:    time.Now,
+	}
+}
+
+// SetClock replaces clock requests are recorded by
+func (s *RateLimiterStore) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Allow records request of identifier and reports whether it is within the
+// limit, store errors deny the request
+func (s *RateLimiterStore) Allow(identifier string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rateLimitTimeout)
+	defer cancel()
+
+	n, err := s.limits.Add(ctx, "rate:"+s.name+":"+identifier, s.now(), s.window)
+	if err != nil {
+		return false, err
+	}
+	return n <= s.burst, nil
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+// ReadOnlyConfig stores read-only mode configuration
+type ReadOnlyConfig struct {
+	// Enabled switches read-only mode on at startup
+	Enabled bool `yaml:"enabled"`
+	// RetryAfter is the value of Retry-After header of refused requests in seconds
+	RetryAfter int `yaml:"retry_after_seconds"`
+}
+
+// DefaultReadOnlyRetryAfter is the value of Retry-After header of requests
+// refused in read-only mode used when ReadOnlyConfig.RetryAfter is not set
+const DefaultReadOnlyRetryAfter = 60
+
+// writeRoutes tells whether route changes data when its method says
+// otherwise. Read-only mode must be possible to switch off, so its route is
+// never refused.
+var writeRoutes = map[string]bool{
+	"/v1/url/shorten":                false,
+	"/v2/url/shorten":                false,
+	"/v1/url/lookup":                 true,
+	"/v2/url/lookup":                 true,
+	"/v1/auth/introspect":            true,
+	"/v1/admin/maintenance/readonly": true,
+	"/v2/admin/maintenance/readonly": true,
+}
+
+// safeRoute tells whether request of route may be handled in read-only mode
+func safeRoute(method, route string) bool {
+	if safe, ok := writeRoutes[route]; ok {
+		return safe
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadOnly refuses requests changing data with 503 while read-only mode is
+// on, redirects and other reads are served as usual
+func (m *GoMiddleware) ReadOnly(mode *domain.ReadOnlyMode, cfg ReadOnlyConfig) echo.MiddlewareFunc {
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = DefaultReadOnlyRetryAfter
+	}
+	retryAfter := strconv.Itoa(cfg.RetryAfter)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !mode.Enabled() || safeRoute(c.Request().Method, c.Path()) {
+				return next(c)
+			}
+
+			c.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+			return web.RespondError(c, http.StatusServiceUnavailable, domain.ResponseError{Error: domain.ErrReadOnly.Error(), Code: domain.ErrCodeReadOnly})
+		}
+	}
+}
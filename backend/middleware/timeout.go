@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+// TimeoutConfig stores per-route request time budgets in milliseconds, zero
+// budget disables timeout
+type TimeoutConfig struct {
+	// Redirect is the budget of redirect route
+	Redirect int `yaml:"redirect_ms"`
+	// API is the budget of other routes
+	API int `yaml:"api_ms"`
+	// Routes overrides budget of specific routes, e.g. long exports, streaming
+	// routes should be set to zero to exempt them
+	Routes map[string]int `yaml:"routes"`
+}
+
+func (cfg TimeoutConfig) budget(route string) time.Duration {
+	ms, ok := cfg.Routes[route]
+	if !ok {
+		ms = cfg.API
+		if route == redirectRoute {
+			ms = cfg.Redirect
+		}
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Timeout cancels request context once time budget of the route is exceeded
+// and responds with 504, unless handler has already started writing response.
+// Handler keeps running in background until it returns, its writes after
+// timeout are discarded.
+func (m *GoMiddleware) Timeout(cfg TimeoutConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			d := cfg.budget(c.Path())
+			if d <= 0 {
+				return next(c)
+			}
+
+			parent := c.Request().Context()
+			ctx, cancel := context.WithTimeout(parent, d)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			res := c.Response()
+			contentType, body := web.ErrorBody(c, http.StatusGatewayTimeout, domain.ResponseError{Error: domain.ErrTimeout.Error()})
+			tw := &timeoutWriter{w: res.Writer, h: res.Header().Clone(), ctx: ctx, parent: parent, contentType: contentType}
+			tw.body, _ = json.Marshal(body)
+			res.Writer = tw
+			defer func() { res.Writer = tw.w }()
+
+			done := make(chan error, 1)
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				done <- next(c)
+			}()
+
+			var err error
+			select {
+			case err = <-done:
+			case p := <-panicked:
+				panic(p)
+			case <-ctx.Done():
+				tw.timeout()
+
+				// echo context must not be reused while handler is still running
+				select {
+				case err = <-done:
+				case p := <-panicked:
+					if _, timedOut := tw.result(); !timedOut {
+						panic(p)
+					}
+					m.logger.Error("handler panicked after timeout", zap.Any("panic", p))
+				}
+			}
+
+			size, timedOut := tw.result()
+			if !timedOut {
+				return err
+			}
+
+			m.logger.Warn("request timed out", zap.String("route", c.Path()), zap.Duration("budget", d), zap.Error(err))
+			res.Status = http.StatusGatewayTimeout
+			res.Size = int64(size)
+			res.Committed = true
+
+			return nil
+		}
+	}
+}
+
+// timeoutWriter passes writes to underlying writer until deadline, it keeps
+// own header map so handler can't modify headers of timeout response
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	h      http.Header
+	ctx    context.Context
+	parent context.Context
+	// contentType and body of timeout response
+	contentType string
+	body        []byte
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	size        int
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	if tw.expired() {
+		tw.writeTimeout()
+		return
+	}
+	tw.wroteHeader = true
+
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.writeHeader(http.StatusOK)
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if f, ok := tw.w.(http.Flusher); ok && !tw.timedOut {
+		f.Flush()
+	}
+}
+
+// timeout writes timeout response unless handler has already started writing
+// or client has gone away
+func (tw *timeoutWriter) timeout() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.wroteHeader && tw.expired() {
+		tw.writeTimeout()
+	}
+}
+
+// result returns size of timeout response and whether it was written
+func (tw *timeoutWriter) result() (int, bool) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.size, tw.timedOut
+}
+
+// expired reports whether budget is exceeded while client still waits for
+// response
+func (tw *timeoutWriter) expired() bool {
+	return errors.Is(tw.ctx.Err(), context.DeadlineExceeded) && tw.parent.Err() == nil
+}
+
+func (tw *timeoutWriter) writeTimeout() {
+	tw.wroteHeader = true
+	tw.timedOut = true
+
+	h := tw.w.Header()
+	h.Set(echo.HeaderContentType, tw.contentType)
+	h.Set(echo.HeaderContentLength, strconv.Itoa(len(tw.body)))
+	tw.w.WriteHeader(http.StatusGatewayTimeout)
+	_, _ = tw.w.Write(tw.body)
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	tw.size = len(tw.body)
+}
@@ -0,0 +1,27 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type consoleNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConsoleNotifier creates Notifier that prints text of emails to w, it is
+// meant for development
+func NewConsoleNotifier(w io.Writer) Notifier {
+	return &consoleNotifier{w: w}
+}
+
+func (c *consoleNotifier) Notify(ctx context.Context, email Email) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := fmt.Fprintf(c.w, "To: %s\nSubject: %s\n\n%s\n", email.To, email.Subject, email.Text)
+	return err
+}
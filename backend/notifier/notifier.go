@@ -0,0 +1,63 @@
+// Package notifier delivers emails rendered from embedded templates. Emails
+// are queued and sent by workers, failed deliveries are retried and logged to
+// dead-letter log when attempts are exhausted.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// Email represents rendered email, HTML may be empty
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Notifier delivers emails
+type Notifier interface {
+	Notify(ctx context.Context, email Email) error
+}
+
+// Drivers of Config.Driver
+const (
+	DriverSMTP    = "smtp"
+	DriverConsole = "console"
+)
+
+// Config stores email delivery configuration
+type Config struct {
+	// Driver is smtp or console, console prints emails to stdout
+	Driver string      `yaml:"driver"`
+	SMTP   SMTPConfig  `yaml:"smtp"`
+	Queue  QueueConfig `yaml:",inline"`
+}
+
+// New creates Queue that delivers emails with configured driver, call Run to
+// start delivery
+func New(cfg Config, logger *zap.Logger) (*Queue, error) {
+	renderer, err := NewRenderer()
+	if err != nil {
+		return nil, err
+	}
+
+	var n Notifier
+	switch cfg.Driver {
+	case DriverSMTP:
+		n, err = NewSMTPNotifier(cfg.SMTP, nil)
+		if err != nil {
+			return nil, err
+		}
+	case DriverConsole, "":
+		n = NewConsoleNotifier(os.Stdout)
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", cfg.Driver)
+	}
+
+	return NewQueue(renderer, n, logger, cfg.Queue), nil
+}
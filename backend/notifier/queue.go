@@ -0,0 +1,166 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Defaults of QueueConfig fields that are not set
+const (
+	DefaultQueueSize   = 256
+	DefaultWorkers     = 2
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = 1000
+)
+
+// QueueConfig stores email queue configuration
+type QueueConfig struct {
+	// QueueSize is the number of emails waiting to be sent, Send fails when
+	// the queue is full
+	QueueSize int `yaml:"queue_size"`
+	// Workers is the number of emails sent at once
+	Workers int `yaml:"workers"`
+	// MaxAttempts is the number of delivery attempts before email is
+	// written to dead-letter log
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryDelay is the delay before the second attempt in milliseconds, it
+	// doubles with every next attempt
+	RetryDelay int `yaml:"retry_delay_ms"`
+}
+
+// permanentError is delivery error that is not retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// isPermanent reports whether delivery fails the same way when retried, e.g.
+// SMTP server rejected recipient with 5xx reply
+func isPermanent(err error) bool {
+	var pe *permanentError
+	var te *textproto.Error
+	return errors.As(err, &pe) || errors.As(err, &te) && te.Code >= 500
+}
+
+// Queue is domain.NotificationSender that renders notifications and delivers
+// them in background
+type Queue struct {
+	renderer    *Renderer
+	notifier    Notifier
+	logger      *zap.Logger
+	deadLetters *zap.Logger
+	cfg         QueueConfig
+	queue       chan Email
+}
+
+// NewQueue creates Queue that delivers emails with notifier, call Run to
+// start delivery
+func NewQueue(r *Renderer, n Notifier, logger *zap.Logger, cfg QueueConfig) *Queue {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+
+	return &Queue{
+		renderer:    r,
+		notifier:    n,
+		logger:      logger,
+		deadLetters: logger.Named("dead_letter"),
+		cfg:         cfg,
+		queue:       make(chan Email, cfg.QueueSize),
+	}
+}
+
+// Send renders notification and queues it, rendering errors are returned
+// right away
+func (q *Queue) Send(ctx context.Context, n domain.Notification) error {
+	email, err := q.renderer.Render(n.Template, n.Locale, n.Data)
+	if err != nil {
+		return err
+	}
+	email.To = n.To
+
+	select {
+	case q.queue <- *email:
+		return nil
+	default:
+		return fmt.Errorf("email queue is full: %w", domain.ErrOverloaded)
+	}
+}
+
+// Run delivers queued emails until context is canceled, emails left in the
+// queue are not delivered
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case email := <-q.queue:
+					q.deliver(ctx, email)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver sends email retrying with exponential backoff, email is written to
+// dead-letter log when it can't be delivered
+func (q *Queue) deliver(ctx context.Context, email Email) {
+	delay := time.Duration(q.cfg.RetryDelay) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := q.notifier.Notify(ctx, email)
+		if err == nil {
+			return
+		}
+		if attempt >= q.cfg.MaxAttempts || isPermanent(err) {
+			q.deadLetter(email, attempt, err)
+			return
+		}
+		q.logger.Warn("can't send email, retrying", zap.String("subject", email.Subject), zap.Int("attempt", attempt), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			q.deadLetter(email, attempt, ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// deadLetter logs undelivered email with everything needed to resend it
+func (q *Queue) deadLetter(email Email, attempts int, err error) {
+	q.deadLetters.Error("email was not delivered",
+		zap.String("to", email.To),
+		zap.String("subject", email.Subject),
+		zap.String("text", email.Text),
+		zap.String("html", email.HTML),
+		zap.Int("attempts", attempts),
+		zap.Error(err),
+	)
+}
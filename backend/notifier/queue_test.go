@@ -0,0 +1,146 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// flakyNotifier fails with errs in order and then delivers emails
+type flakyNotifier struct {
+	mu        sync.Mutex
+	errs      []error
+	attempts  int
+	delivered []Email
+}
+
+func (n *flakyNotifier) Notify(ctx context.Context, email Email) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.attempts++
+	if len(n.errs) > 0 {
+		err := n.errs[0]
+		n.errs = n.errs[1:]
+		return err
+	}
+	n.delivered = append(n.delivered, email)
+	return nil
+}
+
+func (n *flakyNotifier) Attempts() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.attempts
+}
+
+func (n *flakyNotifier) Delivered() []Email {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Email(nil), n.delivered...)
+}
+
+func testNotification() domain.Notification {
+	return domain.Notification{
+		To:       "user@example.com",
+		Template: "url_expired",
+		Locale:   "en",
+		Data:     domain.URLExpired{ID: "test123", Link: "https://www.example.org"},
+	}
+}
+
+// runQueue runs queue until test ends
+func runQueue(t *testing.T, q *Queue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestQueue(t *testing.T) {
+	r, err := NewRenderer()
+	require.NoError(t, err)
+	cfg := QueueConfig{MaxAttempts: 3, RetryDelay: 1}
+
+	t.Run("retried until delivered", func(t *testing.T) {
+		n := &flakyNotifier{errs: []error{errors.New("connection refused"), &textproto.Error{Code: 421, Msg: "try later"}}}
+		core, logs := observer.New(zapcore.ErrorLevel)
+		q := NewQueue(r, n, zap.New(core), cfg)
+		runQueue(t, q)
+
+		require.NoError(t, q.Send(context.Background(), testNotification()))
+
+		require.Eventually(t, func() bool { return len(n.Delivered()) == 1 }, time.Second, time.Millisecond)
+		email := n.Delivered()[0]
+		assert.Equal(t, "user@example.com", email.To)
+		assert.Equal(t, "Your short link test123 has expired", email.Subject)
+		assert.NotEmpty(t, email.HTML)
+		assert.Equal(t, 3, n.Attempts())
+		assert.Zero(t, logs.Len())
+	})
+
+	t.Run("dead letter after max attempts", func(t *testing.T) {
+		errDown := errors.New("connection refused")
+		n := &flakyNotifier{errs: []error{errDown, errDown, errDown, errDown}}
+		core, logs := observer.New(zapcore.ErrorLevel)
+		q := NewQueue(r, n, zap.New(core), cfg)
+		runQueue(t, q)
+
+		require.NoError(t, q.Send(context.Background(), testNotification()))
+
+		require.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, time.Millisecond)
+		entry := logs.All()[0]
+		assert.Equal(t, "dead_letter", entry.LoggerName)
+		fields := entry.ContextMap()
+		assert.Equal(t, "user@example.com", fields["to"])
+		assert.Equal(t, "Your short link test123 has expired", fields["subject"])
+		assert.EqualValues(t, 3, fields["attempts"])
+		assert.Equal(t, 3, n.Attempts())
+		assert.Empty(t, n.Delivered())
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		n := &flakyNotifier{errs: []error{&textproto.Error{Code: 550, Msg: "no such user"}}}
+		core, logs := observer.New(zapcore.ErrorLevel)
+		q := NewQueue(r, n, zap.New(core), cfg)
+		runQueue(t, q)
+
+		require.NoError(t, q.Send(context.Background(), testNotification()))
+
+		require.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, 1, n.Attempts())
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		q := NewQueue(r, &flakyNotifier{}, zap.NewNop(), cfg)
+		notification := testNotification()
+		notification.Template = "unknown"
+
+		err := q.Send(context.Background(), notification)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+
+	t.Run("queue is full", func(t *testing.T) {
+		q := NewQueue(r, &flakyNotifier{}, zap.NewNop(), QueueConfig{QueueSize: 1})
+
+		require.NoError(t, q.Send(context.Background(), testNotification()))
+		err := q.Send(context.Background(), testNotification())
+		assert.ErrorIs(t, err, domain.ErrOverloaded)
+	})
+}
@@ -0,0 +1,210 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLS modes of SMTPConfig.TLS
+const (
+	// TLSStartTLS upgrades plain connection, server must support STARTTLS
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects with TLS, usually to port 465
+	TLSImplicit = "tls"
+	// TLSNone sends emails in plain text, it suits local relays only
+	TLSNone = "none"
+)
+
+// DefaultSMTPTimeout is the SMTP session timeout in milliseconds used when
+// SMTPConfig.Timeout is not set
+const DefaultSMTPTimeout = 10000
+
+// SMTPConfig stores SMTP server configuration
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Username and Password are used for PLAIN authentication, emails are
+	// sent without authentication when Username is empty
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// From is the sender address, e.g. Shortener <no-reply@example.com>
+	From string `yaml:"from"`
+	// TLS is starttls, tls or none, starttls is used when it is empty
+	TLS string `yaml:"tls"`
+	// Timeout is the SMTP session timeout in milliseconds
+	Timeout int `yaml:"timeout_ms"`
+}
+
+type smtpNotifier struct {
+	cfg       SMTPConfig
+	from      *mail.Address
+	tlsConfig *tls.Config
+}
+
+// NewSMTPNotifier creates Notifier that sends emails through SMTP server,
+// tlsConfig may be nil to verify server certificate with system roots
+func NewSMTPNotifier(cfg SMTPConfig, tlsConfig *tls.Config) (Notifier, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", cfg.From, err)
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = TLSStartTLS
+	}
+	if cfg.TLS != TLSStartTLS && cfg.TLS != TLSImplicit && cfg.TLS != TLSNone {
+		return nil, fmt.Errorf("unknown smtp tls mode %q", cfg.TLS)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultSMTPTimeout
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = cfg.Host
+	}
+
+	return &smtpNotifier{
+		cfg:       cfg,
+		from:      from,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+func (s *smtpNotifier) Notify(ctx context.Context, email Email) error {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return &permanentError{fmt.Errorf("invalid recipient address %q: %w", email.To, err)}
+	}
+	msg, err := s.message(to, email)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(s.cfg.Timeout) * time.Millisecond)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	dialer := &net.Dialer{Deadline: deadline}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+
+	var conn net.Conn
+	if s.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("can't connect to smtp server: %w", err)
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("can't set smtp deadline: %w", err)
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting error: %w", err)
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return &permanentError{fmt.Errorf("smtp server doesn't support STARTTLS")}
+		}
+		if err = c.StartTLS(s.tlsConfig); err != nil {
+			return fmt.Errorf("smtp STARTTLS error: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth error: %w", err)
+		}
+	}
+	if err = c.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("smtp MAIL error: %w", err)
+	}
+	if err = c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("smtp RCPT error: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA error: %w", err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		return fmt.Errorf("can't write email: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA error: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// message returns MIME message with text and html alternatives
+func (s *smtpNotifier) message(to *mail.Address, email Email) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	header := func(k, v string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	header("From", s.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", s.messageID())
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{{"text/plain", email.Text}}
+	if email.HTML != "" {
+		parts = append(parts, struct{ contentType, body string }{"text/html", email.HTML})
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't create email part: %w", err)
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write([]byte(p.body)); err != nil {
+			return nil, fmt.Errorf("can't write email part: %w", err)
+		}
+		if err = qw.Close(); err != nil {
+			return nil, fmt.Errorf("can't write email part: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("can't write email: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// messageID returns unique Message-ID in domain of sender
+func (s *smtpNotifier) messageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	domain := s.from.Address[strings.LastIndex(s.from.Address, "@")+1:]
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
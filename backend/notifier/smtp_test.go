@@ -0,0 +1,316 @@
+package notifier
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpServer is local SMTP server that accepts emails and records them
+type smtpServer struct {
+	ln       net.Listener
+	tls      *tls.Config
+	startTLS bool
+	reject   string
+
+	mu    sync.Mutex
+	auth  string
+	from  string
+	rcpt  []string
+	data  string
+	tlsOn bool
+}
+
+// newSMTPServer starts server, tlsConfig enables STARTTLS or implicit TLS
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config, implicit bool) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if implicit {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	s := &smtpServer{ln: ln, tls: tlsConfig, startTLS: tlsConfig != nil && !implicit, tlsOn: implicit}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) Port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			ext := []string{"250-localhost", "250-AUTH PLAIN"}
+			if s.startTLS {
+				ext = append(ext, "250-STARTTLS")
+			}
+			for _, l := range append(ext, "250 8BITMIME") {
+				_ = tp.PrintfLine("%s", l)
+			}
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tls)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			s.mu.Lock()
+			s.tlsOn = true
+			s.mu.Unlock()
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = arg
+			s.mu.Unlock()
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = arg
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			if s.reject != "" && strings.Contains(arg, s.reject) {
+				_ = tp.PrintfLine("550 no such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, arg)
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			b, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(b)
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// testTLS returns server config with certificate for 127.0.0.1 and client
+// config trusting it
+func testTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	return &tls.Config{Certificates: srv.TLS.Certificates}, &tls.Config{RootCAs: roots}
+}
+
+func testEmail() Email {
+	return Email{
+		To:      "Test User <user@example.com>",
+		Subject: "Срок действия ссылки истёк",
+		Text:    "Hello,\nyour link expired.\n",
+		HTML:    "<p>Hello,</p><p>your link expired.</p>",
+	}
+}
+
+// parseEmail returns headers and bodies of text and html parts of message
+func parseEmail(t *testing.T, data string) (mail.Header, map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	bodies := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		contentType, _, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		// multipart reader decodes quoted-printable parts
+		b, err := io.ReadAll(p)
+		require.NoError(t, err)
+		bodies[contentType] = string(b)
+	}
+	return msg.Header, bodies
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	cfg := SMTPConfig{
+		Host:     "127.0.0.1",
+		Username: "user",
+		Password: "secret",
+		From:     "Shortener <no-reply@example.com>",
+	}
+
+	t.Run("starttls", func(t *testing.T) {
+		srv := newSMTPServer(t, serverTLS, false)
+		cfg := cfg
+		cfg.Port = srv.Port()
+		n, err := NewSMTPNotifier(cfg, clientTLS)
+		require.NoError(t, err)
+
+		err = n.Notify(context.Background(), testEmail())
+		require.NoError(t, err)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.True(t, srv.tlsOn)
+		assert.Equal(t, "PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00user\x00secret")), srv.auth)
+		assert.Equal(t, "FROM:<no-reply@example.com>", strings.Fields(srv.from)[0])
+		assert.Equal(t, []string{"TO:<user@example.com>"}, srv.rcpt)
+
+		header, bodies := parseEmail(t, srv.data)
+		assert.Equal(t, `"Shortener" <no-reply@example.com>`, header.Get("From"))
+		assert.Equal(t, `"Test User" <user@example.com>`, header.Get("To"))
+		subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, "Срок действия ссылки истёк", subject)
+		assert.True(t, strings.HasSuffix(header.Get("Message-ID"), "@example.com>"))
+		_, err = header.Date()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"text/plain": "Hello,\nyour link expired.\n",
+			"text/html":  "<p>Hello,</p><p>your link expired.</p>",
+		}, bodies)
+	})
+
+	t.Run("implicit tls", func(t *testing.T) {
+		srv := newSMTPServer(t, serverTLS, true)
+		cfg := cfg
+		cfg.Port = srv.Port()
+		cfg.TLS = TLSImplicit
+		n, err := NewSMTPNotifier(cfg, clientTLS)
+		require.NoError(t, err)
+
+		err = n.Notify(context.Background(), testEmail())
+		require.NoError(t, err)
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.NotEmpty(t, srv.data)
+	})
+
+	t.Run("plain without auth", func(t *testing.T) {
+		srv := newSMTPServer(t, nil, false)
+		cfg := cfg
+		cfg.Port = srv.Port()
+		cfg.TLS = TLSNone
+		cfg.Username = ""
+		n, err := NewSMTPNotifier(cfg, nil)
+		require.NoError(t, err)
+
+		email := testEmail()
+		email.HTML = ""
+		err = n.Notify(context.Background(), email)
+		require.NoError(t, err)
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Empty(t, srv.auth)
+		_, bodies := parseEmail(t, srv.data)
+		assert.Equal(t, map[string]string{"text/plain": "Hello,\nyour link expired.\n"}, bodies)
+	})
+
+	t.Run("starttls not supported", func(t *testing.T) {
+		srv := newSMTPServer(t, nil, false)
+		cfg := cfg
+		cfg.Port = srv.Port()
+		n, err := NewSMTPNotifier(cfg, clientTLS)
+		require.NoError(t, err)
+
+		err = n.Notify(context.Background(), testEmail())
+		assert.ErrorContains(t, err, "STARTTLS")
+		assert.True(t, isPermanent(err))
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		assert.Empty(t, srv.auth)
+	})
+
+	t.Run("recipient rejected", func(t *testing.T) {
+		srv := newSMTPServer(t, serverTLS, false)
+		srv.reject = "user@example.com"
+		cfg := cfg
+		cfg.Port = srv.Port()
+		n, err := NewSMTPNotifier(cfg, clientTLS)
+		require.NoError(t, err)
+
+		err = n.Notify(context.Background(), testEmail())
+		assert.Error(t, err)
+		assert.True(t, isPermanent(err))
+	})
+
+	t.Run("server unavailable", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		cfg := cfg
+		cfg.Port = port
+		n, err := NewSMTPNotifier(cfg, clientTLS)
+		require.NoError(t, err)
+
+		err = n.Notify(context.Background(), testEmail())
+		assert.Error(t, err)
+		assert.False(t, isPermanent(err))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := NewSMTPNotifier(SMTPConfig{From: "not an address"}, nil)
+		assert.Error(t, err)
+		_, err = NewSMTPNotifier(SMTPConfig{From: "no-reply@example.com", TLS: "ssl"}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestConsoleNotifier(t *testing.T) {
+	var b strings.Builder
+	n := NewConsoleNotifier(&b)
+
+	err := n.Notify(context.Background(), Email{To: "user@example.com", Subject: "Hi", Text: "Hello\n", HTML: "<p>Hello</p>"})
+	require.NoError(t, err)
+	assert.Equal(t, "To: user@example.com\nSubject: Hi\n\nHello\n\n", b.String())
+}
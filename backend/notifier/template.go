@@ -0,0 +1,135 @@
+package notifier
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// DefaultLocale is the locale of emails whose template has no variant in
+// recipient's locale
+const DefaultLocale = "en"
+
+// templates are named <name>.<locale>.txt and <name>.<locale>.html, text
+// template defines subject and text body, html template is optional
+//
+//go:embed templates
+var templates embed.FS
+
+// Renderer renders emails from embedded templates
+type Renderer struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// NewRenderer parses embedded templates
+func NewRenderer() (*Renderer, error) {
+	return newRenderer(templates)
+}
+
+func newRenderer(fsys fs.FS) (*Renderer, error) {
+	r := &Renderer{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	err := fs.WalkDir(fsys, "templates", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		name := path.Base(p)
+		switch ext := path.Ext(name); ext {
+		case ".txt":
+			t, err := texttemplate.New(name).Option("missingkey=error").Parse(string(b))
+			if err != nil {
+				return fmt.Errorf("can't parse %s template: %w", name, err)
+			}
+			if t.Lookup("subject") == nil || t.Lookup("text") == nil {
+				return fmt.Errorf("%s template must define subject and text", name)
+			}
+			r.text[strings.TrimSuffix(name, ext)] = t
+		case ".html":
+			t, err := htmltemplate.New(name).Option("missingkey=error").Parse(string(b))
+			if err != nil {
+				return fmt.Errorf("can't parse %s template: %w", name, err)
+			}
+			r.html[strings.TrimSuffix(name, ext)] = t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't load email templates: %w", err)
+	}
+
+	for key := range r.html {
+		if _, ok := r.text[key]; !ok {
+			return nil, fmt.Errorf("%s.html template has no text variant", key)
+		}
+	}
+
+	return r, nil
+}
+
+// Render renders template in locale, locale falls back to its language and
+// then to DefaultLocale, e.g. pt-BR is rendered with pt-br, pt or en variant
+func (r *Renderer) Render(name, locale string, data interface{}) (*Email, error) {
+	key, ok := r.resolve(name, locale)
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %s: %w", name, domain.ErrBadParamInput)
+	}
+
+	email := new(Email)
+	var buf bytes.Buffer
+	t := r.text[key]
+	if err := t.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return nil, fmt.Errorf("can't render %s subject: %w", key, err)
+	}
+	// subject must be a single header line
+	email.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := t.ExecuteTemplate(&buf, "text", data); err != nil {
+		return nil, fmt.Errorf("can't render %s text: %w", key, err)
+	}
+	email.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	if h, ok := r.html[key]; ok {
+		buf.Reset()
+		if err := h.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("can't render %s html: %w", key, err)
+		}
+		email.HTML = buf.String()
+	}
+
+	return email, nil
+}
+
+// resolve returns key of template variant used for locale
+func (r *Renderer) resolve(name, locale string) (string, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, lang)
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, l := range candidates {
+		key := name + "." + l
+		if _, ok := r.text[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,178 @@
+package notifier
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden compares rendered email with testdata/<name>.golden
+func assertGolden(t *testing.T, name string, email *Email) {
+	t.Helper()
+	got := "Subject: " + email.Subject + "\n\n-- text --\n" + email.Text + "\n-- html --\n" + email.HTML
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), got)
+}
+
+func TestRenderer_Render(t *testing.T) {
+	r, err := NewRenderer()
+	require.NoError(t, err)
+
+	data := domain.URLExpired{
+		ID:             "test123",
+		Link:           "https://www.example.org/?a=1&b=<2>",
+		ExpirationDate: time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC),
+		Clicks:         1,
+	}
+
+	cases := []struct {
+		description string
+		locale      string
+		golden      string
+	}{
+		{description: "english", locale: "en", golden: "url_expired.en"},
+		{description: "russian", locale: "ru", golden: "url_expired.ru"},
+		{description: "region falls back to language", locale: "ru-RU", golden: "url_expired.ru"},
+		{description: "underscore region", locale: "ru_RU", golden: "url_expired.ru"},
+		{description: "unknown locale falls back to default", locale: "pt-BR", golden: "url_expired.en"},
+		{description: "empty locale", locale: "", golden: "url_expired.en"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			email, err := r.Render("url_expired", tc.locale, data)
+			require.NoError(t, err)
+			assertGolden(t, tc.golden, email)
+		})
+	}
+
+	t.Run("plural", func(t *testing.T) {
+		data := data
+		data.Clicks = 5
+		email, err := r.Render("url_expired", "en", data)
+		require.NoError(t, err)
+		assert.Contains(t, email.Text, "It was clicked 5 times.")
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		email, err := r.Render("unknown", "en", data)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, email)
+	})
+
+	t.Run("missing data", func(t *testing.T) {
+		email, err := r.Render("url_expired", "en", map[string]interface{}{"ID": "test123"})
+		assert.Error(t, err)
+		assert.Nil(t, email)
+	})
+}
+
+func TestRenderer_RenderAccountDeletion(t *testing.T) {
+	r, err := NewRenderer()
+	require.NoError(t, err)
+
+	data := domain.AccountDeletion{
+		Name:        "Jane <Doe>",
+		DeleteAfter: time.Date(2023, 5, 15, 12, 30, 0, 0, time.UTC),
+		CancelLink:  "https://sho.rt/account/restore?token=a.b-c&x=<1>",
+	}
+
+	for _, locale := range []string{"en", "ru"} {
+		t.Run(locale, func(t *testing.T) {
+			email, err := r.Render(domain.NotificationAccountDeletion, locale, data)
+			require.NoError(t, err)
+			assertGolden(t, "account_deletion."+locale, email)
+		})
+	}
+
+	t.Run("no name", func(t *testing.T) {
+		data := data
+		data.Name = ""
+		email, err := r.Render(domain.NotificationAccountDeletion, "en", data)
+		require.NoError(t, err)
+		assert.Contains(t, email.Text, "Hello,\n")
+	})
+}
+
+func TestRenderer_RenderURLDisabled(t *testing.T) {
+	r, err := NewRenderer()
+	require.NoError(t, err)
+
+	data := domain.URLDisabled{
+		Name:       "Jane <Doe>",
+		ID:         "test123",
+		Link:       "https://www.example.org/?a=1&b=<2>",
+		ReportedAt: time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC),
+	}
+
+	for _, locale := range []string{"en", "ru"} {
+		t.Run(locale, func(t *testing.T) {
+			email, err := r.Render(domain.NotificationURLDisabled, locale, data)
+			require.NoError(t, err)
+			assertGolden(t, "url_disabled."+locale, email)
+		})
+	}
+}
+
+func TestNewRenderer(t *testing.T) {
+	cases := []struct {
+		description string
+		fsys        fstest.MapFS
+		wantErr     string
+	}{
+		{
+			description: "text only",
+			fsys: fstest.MapFS{
+				"templates/hello.en.txt": {Data: []byte(`{{define "subject"}}Hi{{end}}{{define "text"}}Hello{{end}}`)},
+			},
+		},
+		{
+			description: "no subject",
+			fsys: fstest.MapFS{
+				"templates/hello.en.txt": {Data: []byte(`{{define "text"}}Hello{{end}}`)},
+			},
+			wantErr: "must define subject and text",
+		},
+		{
+			description: "html without text",
+			fsys: fstest.MapFS{
+				"templates/hello.en.html": {Data: []byte(`<p>Hello</p>`)},
+			},
+			wantErr: "has no text variant",
+		},
+		{
+			description: "syntax error",
+			fsys: fstest.MapFS{
+				"templates/hello.en.txt": {Data: []byte(`{{define "subject"}}Hi{{end}`)},
+			},
+			wantErr: "can't parse hello.en.txt template",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := newRenderer(tc.fsys)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
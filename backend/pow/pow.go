@@ -0,0 +1,201 @@
+// Package pow implements proof-of-work challenges anonymous clients solve
+// before creating URLs. Challenge is solved by nonce whose SHA-256 hash along
+// with challenge id has at least Difficulty leading zero bits, so solving
+// takes about 2^Difficulty hashes and verifying takes one.
+package pow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Headers clients send solved challenge in
+const (
+	HeaderChallenge = "X-PoW-Challenge"
+	HeaderNonce     = "X-PoW-Nonce"
+)
+
+// TTL is the time challenge may be solved in
+const TTL = 2 * time.Minute
+
+// MaxDifficulty caps difficulty, higher ones can't be solved in TTL
+const MaxDifficulty = 32
+
+// maxNonceLength is the length of the longest uint64 nonce
+const maxNonceLength = 20
+
+// Config stores proof-of-work configuration
+type Config struct {
+	// Difficulty is the number of leading zero bits of solution hash, zero
+	// disables challenges
+	Difficulty int `yaml:"difficulty"`
+	// Secret signs challenges, instances sharing it verify challenges issued
+	// by each other. Random secret is generated when it is empty.
+	Secret string `yaml:"secret"`
+}
+
+// Challenge represents challenge issued to client
+type Challenge struct {
+	ID         string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Challenges issues challenges and verifies their solutions. Challenge id is
+// signed along with its expiration and difficulty, so issued challenges are
+// not kept and any instance sharing the secret verifies them. Used challenges
+// are kept in the shared limit store until they expire, so every challenge is
+// verified once whichever instance serves it.
+type Challenges struct {
+	difficulty int
+	secret     []byte
+	used       domain.LimitStore
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// New creates Challenges of configured difficulty, used challenges are
+// recorded in used store
+func New(cfg Config, used domain.LimitStore) (*Challenges, error) {
+	if cfg.Difficulty <= 0 || cfg.Difficulty > MaxDifficulty {
+		return nil, fmt.Errorf("difficulty must be between 1 and %d", MaxDifficulty)
+	}
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("can't generate secret: %w", err)
+		}
+	}
+
+	return &Challenges{
+		difficulty: cfg.Difficulty,
+		secret:     secret,
+		used:       used,
+		now:        time.Now,
+	}, nil
+}
+
+// SetClock replaces clock challenges are expired by
+func (c *Challenges) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Issue issues new challenge, its id is random value, expiration and their
+// signature joined by dots
+func (c *Challenges) Issue() (Challenge, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Challenge{}, fmt.Errorf("can't generate challenge: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	c.mu.Lock()
+	expiresAt := c.now().Add(TTL).Truncate(time.Second)
+	c.mu.Unlock()
+	payload := hex.EncodeToString(b) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	id := payload + "." + hex.EncodeToString(c.sign(payload))
+
+	return Challenge{ID: id, Difficulty: c.difficulty, ExpiresAt: expiresAt}, nil
+}
+
+// Verify checks that nonce solves signed not expired challenge, the challenge
+// is used up whether the nonce solves it or not. ErrForbidden is returned for
+// unknown, used, expired and not solved challenges, store errors are returned
+// as is.
+func (c *Challenges) Verify(ctx context.Context, id, nonce string) error {
+	expiresAt, ok := c.parse(id)
+	if !ok {
+		return fmt.Errorf("unknown challenge: %w", domain.ErrForbidden)
+	}
+
+	c.mu.Lock()
+	now := c.now()
+	c.mu.Unlock()
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("challenge expired: %w", domain.ErrForbidden)
+	}
+	unused, err := c.used.Use(ctx, "pow:"+id, expiresAt)
+	if err != nil {
+		return err
+	}
+	if !unused {
+		return fmt.Errorf("challenge is used: %w", domain.ErrForbidden)
+	}
+
+	if !Solves(id, nonce, c.difficulty) {
+		return fmt.Errorf("challenge is not solved: %w", domain.ErrForbidden)
+	}
+	return nil
+}
+
+// parse returns expiration of challenge issued by Issue, false is returned
+// when signature doesn't match
+func (c *Challenges) parse(id string) (time.Time, bool) {
+	i := strings.LastIndexByte(id, '.')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	payload := id[:i]
+	signature, err := hex.DecodeString(id[i+1:])
+	if err != nil || !hmac.Equal(signature, c.sign(payload)) {
+		return time.Time{}, false
+	}
+	j := strings.LastIndexByte(payload, '.')
+	if j < 0 {
+		return time.Time{}, false
+	}
+	expiresAt, err := strconv.ParseInt(payload[j+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(expiresAt, 0), true
+}
+
+// sign returns signature of challenge payload, difficulty is signed too, so
+// challenges issued before difficulty changed are not accepted
+func (c *Challenges) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload + "." + strconv.Itoa(c.difficulty)))
+	return mac.Sum(nil)
+}
+
+// Solves reports whether nonce solves challenge of given difficulty
+func Solves(id, nonce string, difficulty int) bool {
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return false
+	}
+	sum := sha256.Sum256([]byte(id + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 || zeros >= difficulty {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// Solve finds nonce that solves the challenge, it is the reference solver for
+// clients
+func Solve(ch Challenge) string {
+	for n := uint64(0); ; n++ {
+		nonce := strconv.FormatUint(n, 10)
+		if Solves(ch.ID, nonce, ch.Difficulty) {
+			return nonce
+		}
+	}
+}
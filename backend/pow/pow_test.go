@@ -0,0 +1,135 @@
+package pow_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/pow"
+	"github.com/semka95/shortener/backend/tests"
+)
+
+func newTestChallenges(t *testing.T, cfg pow.Config) (*pow.Challenges, *time.Time) {
+	t.Helper()
+	return newSharedChallenges(t, cfg, tests.NewMemoryLimitStore())
+}
+
+func newSharedChallenges(t *testing.T, cfg pow.Config, used *tests.MemoryLimitStore) (*pow.Challenges, *time.Time) {
+	t.Helper()
+	c, err := pow.New(cfg, used)
+	require.NoError(t, err)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.SetClock(func() time.Time { return now })
+	used.SetClock(func() time.Time { return now })
+	return c, &now
+}
+
+func TestChallenges(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("solved", func(t *testing.T) {
+		c, now := newTestChallenges(t, pow.Config{Difficulty: 8})
+		ch, err := c.Issue()
+		require.NoError(t, err)
+		assert.Equal(t, 8, ch.Difficulty)
+		assert.Equal(t, now.Add(pow.TTL), ch.ExpiresAt)
+
+		require.NoError(t, c.Verify(ctx, ch.ID, pow.Solve(ch)))
+	})
+
+	t.Run("single use", func(t *testing.T) {
+		c, _ := newTestChallenges(t, pow.Config{Difficulty: 8})
+		ch, err := c.Issue()
+		require.NoError(t, err)
+		nonce := pow.Solve(ch)
+
+		require.NoError(t, c.Verify(ctx, ch.ID, nonce))
+		require.ErrorIs(t, c.Verify(ctx, ch.ID, nonce), domain.ErrForbidden)
+	})
+
+	t.Run("wrong nonce uses challenge up", func(t *testing.T) {
+		c, _ := newTestChallenges(t, pow.Config{Difficulty: 8})
+		ch, err := c.Issue()
+		require.NoError(t, err)
+		nonce := pow.Solve(ch)
+		wrong := 0
+		for pow.Solves(ch.ID, strconv.Itoa(wrong), ch.Difficulty) {
+			wrong++
+		}
+
+		require.ErrorIs(t, c.Verify(ctx, ch.ID, strconv.Itoa(wrong)), domain.ErrForbidden)
+		require.ErrorIs(t, c.Verify(ctx, ch.ID, nonce), domain.ErrForbidden)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		c, now := newTestChallenges(t, pow.Config{Difficulty: 8})
+		ch, err := c.Issue()
+		require.NoError(t, err)
+		c.SetClock(func() time.Time { return now.Add(pow.TTL) })
+
+		require.ErrorIs(t, c.Verify(ctx, ch.ID, pow.Solve(ch)), domain.ErrForbidden)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		c, _ := newTestChallenges(t, pow.Config{Difficulty: 1})
+		require.ErrorIs(t, c.Verify(ctx, "unknown", "0"), domain.ErrForbidden)
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		c, _ := newTestChallenges(t, pow.Config{Difficulty: 8})
+		ch, err := c.Issue()
+		require.NoError(t, err)
+		forged := ch
+		forged.ID = strings.Replace(ch.ID, ".", "0.", 1)
+
+		require.ErrorIs(t, c.Verify(ctx, forged.ID, pow.Solve(forged)), domain.ErrForbidden)
+	})
+
+	t.Run("issued by another instance", func(t *testing.T) {
+		issuer, _ := newTestChallenges(t, pow.Config{Difficulty: 8, Secret: "secret"})
+		ch, err := issuer.Issue()
+		require.NoError(t, err)
+		nonce := pow.Solve(ch)
+
+		other, _ := newTestChallenges(t, pow.Config{Difficulty: 8, Secret: "other"})
+		require.ErrorIs(t, other.Verify(ctx, ch.ID, nonce), domain.ErrForbidden, "other secret")
+		easier, _ := newTestChallenges(t, pow.Config{Difficulty: 4, Secret: "secret"})
+		require.ErrorIs(t, easier.Verify(ctx, ch.ID, nonce), domain.ErrForbidden, "other difficulty")
+		verifier, _ := newTestChallenges(t, pow.Config{Difficulty: 8, Secret: "secret"})
+		require.NoError(t, verifier.Verify(ctx, ch.ID, nonce))
+	})
+
+	t.Run("used on another instance", func(t *testing.T) {
+		used := tests.NewMemoryLimitStore()
+		first, _ := newSharedChallenges(t, pow.Config{Difficulty: 8, Secret: "secret"}, used)
+		second, _ := newSharedChallenges(t, pow.Config{Difficulty: 8, Secret: "secret"}, used)
+		ch, err := first.Issue()
+		require.NoError(t, err)
+		nonce := pow.Solve(ch)
+
+		require.NoError(t, first.Verify(ctx, ch.ID, nonce))
+		require.ErrorIs(t, second.Verify(ctx, ch.ID, nonce), domain.ErrForbidden)
+	})
+}
+
+func TestNew_Difficulty(t *testing.T) {
+	for _, d := range []int{0, -1, pow.MaxDifficulty + 1} {
+		_, err := pow.New(pow.Config{Difficulty: d}, tests.NewMemoryLimitStore())
+		assert.Error(t, err, "difficulty %d", d)
+	}
+}
+
+func TestSolves(t *testing.T) {
+	ch := pow.Challenge{ID: "0123456789abcdef0123456789abcdef", Difficulty: 12}
+	nonce := pow.Solve(ch)
+	assert.True(t, pow.Solves(ch.ID, nonce, ch.Difficulty))
+	assert.True(t, pow.Solves(ch.ID, nonce, ch.Difficulty-4), "easier difficulty")
+	assert.False(t, pow.Solves(ch.ID, "", 0), "empty nonce")
+	assert.False(t, pow.Solves(ch.ID, "123456789012345678901", 0), "too long nonce")
+}
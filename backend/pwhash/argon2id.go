@@ -0,0 +1,135 @@
+package pwhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix starts hashes in PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=2$salt$key with unpadded base64 salt and key
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idParams represents argon2id parameters, Memory is in KiB
+type Argon2idParams struct {
+	Memory      uint32 `yaml:"memory_kib"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length"`
+	KeyLength   uint32 `yaml:"key_length"`
+}
+
+// DefaultArgon2idParams follow OWASP recommendation of 64 MiB memory and 3
+// iterations
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type argon2idScheme struct {
+	params Argon2idParams
+}
+
+// newArgon2idScheme creates argon2id scheme, zero parameters are replaced by
+// DefaultArgon2idParams
+func newArgon2idScheme(p Argon2idParams) (*argon2idScheme, error) {
+	if p.Memory == 0 {
+		p.Memory = DefaultArgon2idParams.Memory
+	}
+	if p.Iterations == 0 {
+		p.Iterations = DefaultArgon2idParams.Iterations
+	}
+	if p.Parallelism == 0 {
+		p.Parallelism = DefaultArgon2idParams.Parallelism
+	}
+	if p.SaltLength == 0 {
+		p.SaltLength = DefaultArgon2idParams.SaltLength
+	}
+	if p.KeyLength == 0 {
+		p.KeyLength = DefaultArgon2idParams.KeyLength
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return nil, fmt.Errorf("argon2id memory must be at least %d KiB for parallelism %d", 8*uint32(p.Parallelism), p.Parallelism)
+	}
+	if p.SaltLength < 8 || p.KeyLength < 16 {
+		return nil, errors.New("argon2id salt must be at least 8 bytes and key at least 16 bytes long")
+	}
+	return &argon2idScheme{params: p}, nil
+}
+
+func (s *argon2idScheme) hash(password string) (string, error) {
+	salt := make([]byte, s.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("can't generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, s.params.Iterations, s.params.Memory, s.params.Parallelism, s.params.KeyLength)
+	return encodeArgon2id(s.params, salt, key), nil
+}
+
+func (s *argon2idScheme) verify(hash, password string) error {
+	p, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// current reports whether hash was made with configured parameters
+func (s *argon2idScheme) current(hash string) bool {
+	p, _, _, err := decodeArgon2id(hash)
+	return err == nil && p == s.params
+}
+
+func encodeArgon2id(p Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// decodeArgon2id parses hash made by encodeArgon2id, salt and key lengths are
+// taken from the hash
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var p Argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("malformed argon2id hash version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("malformed argon2id hash parameters: %w", err)
+	}
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, errors.New("malformed argon2id hash parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.Strict().DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("malformed argon2id hash salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.Strict().DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errors.New("malformed argon2id hash key")
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
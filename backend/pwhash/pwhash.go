@@ -0,0 +1,111 @@
+// Package pwhash hashes passwords with bcrypt or argon2id. Hash format tells
+// its scheme, so hashes of both schemes can be verified while passwords are
+// migrated to the configured one.
+package pwhash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Password hashing schemes
+const (
+	SchemeBcrypt   = "bcrypt"
+	SchemeArgon2id = "argon2id"
+)
+
+// ErrMismatch is returned when password doesn't match the hash
+var ErrMismatch = errors.New("password doesn't match hash")
+
+// Config represents password hashing parameters, new hashes are made with
+// Scheme, empty Scheme means bcrypt
+type Config struct {
+	Scheme     string         `yaml:"scheme"`
+	BcryptCost int            `yaml:"bcrypt_cost"`
+	Argon2id   Argon2idParams `yaml:"argon2id"`
+}
+
+// scheme hashes and verifies passwords of one scheme
+type scheme interface {
+	hash(password string) (string, error)
+	verify(hash, password string) error
+	// current reports whether hash was made with parameters of the scheme
+	current(hash string) bool
+}
+
+// Hasher hashes passwords with configured scheme and verifies hashes of all
+// schemes
+type Hasher struct {
+	name     string
+	bcrypt   *bcryptScheme
+	argon2id *argon2idScheme
+}
+
+var _ domain.PasswordHasher = (*Hasher)(nil)
+
+// New creates Hasher, zero parameters are replaced by defaults
+func New(cfg Config) (*Hasher, error) {
+	b, err := newBcryptScheme(cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newArgon2idScheme(cfg.Argon2id)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hasher{name: cfg.Scheme, bcrypt: b, argon2id: a}
+	switch h.name {
+	case "":
+		h.name = SchemeBcrypt
+	case SchemeBcrypt, SchemeArgon2id:
+	default:
+		return nil, fmt.Errorf("unknown password hashing scheme %q, use %s or %s", cfg.Scheme, SchemeBcrypt, SchemeArgon2id)
+	}
+
+	return h, nil
+}
+
+// Hash returns hash of password made with configured scheme
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.configured().hash(password)
+}
+
+// Verify returns nil when password matches hash of any scheme, ErrMismatch is
+// returned when it doesn't
+func (h *Hasher) Verify(hash, password string) error {
+	s, err := h.schemeOf(hash)
+	if err != nil {
+		return err
+	}
+	return s.verify(hash, password)
+}
+
+// NeedsRehash reports whether hash was made with other scheme or parameters
+// than configured ones
+func (h *Hasher) NeedsRehash(hash string) bool {
+	s, err := h.schemeOf(hash)
+	return err != nil || s != h.configured() || !s.current(hash)
+}
+
+func (h *Hasher) configured() scheme {
+	if h.name == SchemeArgon2id {
+		return h.argon2id
+	}
+	return h.bcrypt
+}
+
+// schemeOf returns scheme by hash prefix, bcrypt hashes start with $2a$, $2b$
+// or $2y$
+func (h *Hasher) schemeOf(hash string) (scheme, error) {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return h.argon2id, nil
+	case strings.HasPrefix(hash, "$2"):
+		return h.bcrypt, nil
+	}
+	return nil, errors.New("unknown password hash format")
+}
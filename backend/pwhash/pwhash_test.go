@@ -0,0 +1,174 @@
+package pwhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/semka95/shortener/backend/pwhash"
+)
+
+// lightArgon2id keeps tests fast, real parameters come from config
+var lightArgon2id = pwhash.Argon2idParams{Memory: 256, Iterations: 1, Parallelism: 1}
+
+// bcryptHash is bcrypt hash of "password" with cost 10
+const bcryptHash = "$2a$10$2iPnt444yuUBu8tSCm0iXOaGO2YYyTLVzGKr9LudAj7s.9m9iv7PS"
+
+// argon2idVectors are test vectors of argon2 reference implementation for
+// password "password" and salt "somesalt"
+var argon2idVectors = []string{
+	"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+	"$argon2id$v=19$m=65536,t=1,p=1$c29tZXNhbHQ$9qWtwbpyPd3vm1rB1GThgPzZ3/ydHL92zKL+15XZypg",
+	"$argon2id$v=19$m=256,t=2,p=1$c29tZXNhbHQ$nf65EOgLrQMR/uIPnA4rEsF5h7TKyQwu9U1bMCHGi/4",
+	"$argon2id$v=19$m=256,t=2,p=2$c29tZXNhbHQ$bQk8UB/VmZZF4Oo79iDXuL5/0ttZwg2f/5U52iv1cDc",
+}
+
+func newHasher(t *testing.T, cfg pwhash.Config) *pwhash.Hasher {
+	t.Helper()
+	h, err := pwhash.New(cfg)
+	require.NoError(t, err)
+	return h
+}
+
+func TestHasher_Argon2idVectors(t *testing.T) {
+	h := newHasher(t, pwhash.Config{Scheme: pwhash.SchemeArgon2id})
+
+	for _, vector := range argon2idVectors {
+		t.Run(vector, func(t *testing.T) {
+			assert.NoError(t, h.Verify(vector, "password"))
+			assert.ErrorIs(t, h.Verify(vector, "differentpassword"), pwhash.ErrMismatch)
+		})
+	}
+}
+
+func TestHasher_Argon2idEncoding(t *testing.T) {
+	h := newHasher(t, pwhash.Config{Scheme: pwhash.SchemeArgon2id, Argon2id: lightArgon2id})
+
+	hash, err := h.Hash("password")
+	require.NoError(t, err)
+
+	parts := strings.Split(hash, "$")
+	require.Len(t, parts, 6)
+	assert.Equal(t, []string{"", "argon2id", "v=19", "m=256,t=1,p=1"}, parts[:4])
+	// 16 bytes salt and 32 bytes key in unpadded base64
+	assert.Len(t, parts[4], 22)
+	assert.Len(t, parts[5], 43)
+
+	assert.NoError(t, h.Verify(hash, "password"))
+	assert.ErrorIs(t, h.Verify(hash, "Password"), pwhash.ErrMismatch)
+
+	other, err := h.Hash("password")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt must be random")
+}
+
+func TestHasher_VerifyMalformed(t *testing.T) {
+	h := newHasher(t, pwhash.Config{})
+
+	for _, hash := range []string{
+		"",
+		"password",
+		"$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=0,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ=$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$",
+		"$2a$10$short",
+	} {
+		err := h.Verify(hash, "password")
+		assert.Error(t, err, hash)
+		assert.NotErrorIs(t, err, pwhash.ErrMismatch, hash)
+	}
+}
+
+func TestHasher_CrossScheme(t *testing.T) {
+	b := newHasher(t, pwhash.Config{Scheme: pwhash.SchemeBcrypt, BcryptCost: bcrypt.MinCost, Argon2id: lightArgon2id})
+	a := newHasher(t, pwhash.Config{Scheme: pwhash.SchemeArgon2id, BcryptCost: bcrypt.MinCost, Argon2id: lightArgon2id})
+
+	bHash, err := b.Hash("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(bHash, "$2a$04$"))
+	aHash, err := a.Hash("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(aHash, "$argon2id$"))
+
+	for _, h := range []*pwhash.Hasher{a, b} {
+		assert.NoError(t, h.Verify(bHash, "password"))
+		assert.NoError(t, h.Verify(aHash, "password"))
+		assert.NoError(t, h.Verify(bcryptHash, "password"))
+		assert.NoError(t, h.Verify(argon2idVectors[0], "password"))
+		assert.ErrorIs(t, h.Verify(bHash, "wrong"), pwhash.ErrMismatch)
+		assert.ErrorIs(t, h.Verify(aHash, "wrong"), pwhash.ErrMismatch)
+	}
+
+	assert.False(t, b.NeedsRehash(bHash))
+	assert.True(t, b.NeedsRehash(aHash))
+	assert.False(t, a.NeedsRehash(aHash))
+	assert.True(t, a.NeedsRehash(bHash))
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	cases := []struct {
+		description string
+		cfg         pwhash.Config
+		hash        string
+		want        bool
+	}{
+		{
+			description: "bcrypt of default cost",
+			cfg:         pwhash.Config{},
+			hash:        bcryptHash,
+		},
+		{
+			description: "bcrypt of lower cost",
+			cfg:         pwhash.Config{BcryptCost: 11},
+			hash:        bcryptHash,
+			want:        true,
+		},
+		{
+			description: "bcrypt of higher cost is kept",
+			cfg:         pwhash.Config{BcryptCost: bcrypt.MinCost},
+			hash:        bcryptHash,
+		},
+		{
+			description: "argon2id of configured parameters",
+			cfg:         pwhash.Config{Scheme: pwhash.SchemeArgon2id, Argon2id: pwhash.Argon2idParams{Memory: 256, Iterations: 2, Parallelism: 2, SaltLength: 8}},
+			hash:        argon2idVectors[3],
+		},
+		{
+			description: "argon2id of other parameters",
+			cfg:         pwhash.Config{Scheme: pwhash.SchemeArgon2id},
+			hash:        argon2idVectors[3],
+			want:        true,
+		},
+		{
+			description: "unknown format",
+			cfg:         pwhash.Config{},
+			hash:        "password",
+			want:        true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.want, newHasher(t, tc.cfg).NeedsRehash(tc.hash))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, cfg := range []pwhash.Config{
+		{Scheme: "md5"},
+		{BcryptCost: bcrypt.MaxCost + 1},
+		{BcryptCost: 1},
+		{Argon2id: pwhash.Argon2idParams{Memory: 8, Parallelism: 2}},
+		{Argon2id: pwhash.Argon2idParams{SaltLength: 4}},
+	} {
+		_, err := pwhash.New(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
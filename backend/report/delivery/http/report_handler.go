@@ -0,0 +1,239 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// DefaultRateLimit is the number of abuse reports per second a client can
+// make used when Config.RateLimit is not set, it is one report a minute
+const DefaultRateLimit = 1.0 / 60
+
+// DefaultBurst is the number of abuse reports a client can make at once used
+// when Config.Burst is not set
+const DefaultBurst = 3
+
+// Config stores abuse reports configuration
+type Config struct {
+	// RateLimit is the number of reports per second a client can make
+	RateLimit float64 `yaml:"rate_limit"`
+	// Burst is the number of reports a client can make at once
+	Burst int `yaml:"burst"`
+}
+
+// ReportHandler represent the http handler for abuse reports
+type ReportHandler struct {
+	reportUsecase domain.ReportUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+	// limiter is shared by routes of all API versions
+	limiter echo.MiddlewareFunc
+}
+
+// NewReportHandler will initialize the url/:id/report resource and admin
+// reports queue
+func NewReportHandler(ru domain.ReportUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer, cfg Config) *ReportHandler {
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = DefaultRateLimit
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultBurst
+	}
+
+	return &ReportHandler{
+		reportUsecase: ru,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+		limiter: middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+			IdentifierExtractor: web.ClientIdentifier,
+			Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+				Rate:      rate.Limit(cfg.RateLimit),
+				Burst:     cfg.Burst,
+				ExpiresIn: time.Duration(float64(cfg.Burst)/cfg.RateLimit) * time.Second,
+			}),
+		}),
+	}
+}
+
+// RegisterRoutes registers routes for a path with matching handler
+func (rh *ReportHandler) RegisterRoutes(e *echo.Echo) {
+	rh.RegisterAPIRoutes(e.Group("/v1"))
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2,
+// reports are made without authentication
+func (rh *ReportHandler) RegisterAPIRoutes(g *echo.Group) {
+	g.POST("/url/:id/report", rh.Store, rh.limiter)
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (rh *ReportHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(rh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(rh.authenticator.JWTConfig), myMiddl.SpanIdentity("reportid"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.GET("/reports", rh.Fetch, admin...)
+	g.POST("/reports/:id/resolve", rh.Resolve, admin...)
+}
+
+// Store will report abuse of URL, reports are reviewed by admins later
+func (rh *ReportHandler) Store(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := rh.tracer.Start(
+		ctx,
+		"http Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", id)),
+	)
+	defer span.End()
+
+	err := rh.validator.V.Var(id, "required,max=20,linkid")
+	if err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(rh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	createReport := new(domain.CreateReport)
+	if err = c.Bind(createReport); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err = c.Validate(createReport); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(rh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	if err = rh.reportUsecase.Store(ctx, id, *createReport); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, rh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// Fetch will list reports by given filter
+func (rh *ReportHandler) Fetch(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := rh.tracer.Start(
+		ctx,
+		"http Fetch",
+	)
+	defer span.End()
+
+	filter := new(domain.ReportFilter)
+	if err := c.Bind(filter); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(filter); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(rh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	page, err := rh.reportUsecase.Fetch(ctx, *filter)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, rh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	var next url.Values
+	if page.NextCursor != "" {
+		next = url.Values{"cursor": {page.NextCursor}}
+	}
+	web.SetPageHeaders(c, nil, next, nil, "cursor")
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = domain.DefaultReportPageLimit
+	}
+	return web.RespondList(c, http.StatusOK, page, page.Reports, web.Pagination{
+		Count:      len(page.Reports),
+		Limit:      limit,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// Resolve will resolve report by given id with action of request body
+func (rh *ReportHandler) Resolve(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := rh.tracer.Start(
+		ctx,
+		"http Resolve",
+	)
+	defer span.End()
+
+	resolve := new(domain.ResolveReport)
+	if err := c.Bind(resolve); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(resolve); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(rh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	admin, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	report, err := rh.reportUsecase.Resolve(ctx, id, *resolve, admin)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, rh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	span.SetAttributes(
+		attribute.String("action", resolve.Action),
+	)
+
+	return web.Respond(c, http.StatusOK, report)
+}
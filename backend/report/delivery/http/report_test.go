@@ -0,0 +1,224 @@
+package http_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	reportHttp "github.com/semka95/shortener/backend/report/delivery/http"
+	"github.com/semka95/shortener/backend/report/mock"
+	urlHttp "github.com/semka95/shortener/backend/url/delivery/http"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type reportStack struct {
+	e          *echo.Echo
+	uc         *mock.MockReportUsecase
+	adminToken string
+	userToken  string
+	admin      *auth.Claims
+}
+
+func newReportStack(t *testing.T, cfg reportHttp.Config) *reportStack {
+	t.Helper()
+	admin := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e7f", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	user := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	adminToken, err := authenticator.GenerateToken(admin)
+	require.NoError(t, err)
+	userToken, err := authenticator.GenerateToken(user)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+	uc := mock.NewMockReportUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	// url handler registers linkid validation
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	e.IPExtractor = _MyMiddleware.IPExtractor(nil)
+	rh := reportHttp.NewReportHandler(uc, authenticator, v, zap.NewNop(), tracer, cfg)
+	rh.RegisterRoutes(e)
+	rh.RegisterAPIRoutes(e.Group("/v2"))
+	rh.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	return &reportStack{e: e, uc: uc, adminToken: adminToken, userToken: userToken, admin: admin}
+}
+
+func (s *reportStack) serve(method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestReportHTTPStore(t *testing.T) {
+	s := newReportStack(t, reportHttp.Config{RateLimit: 1000, Burst: 1000})
+
+	t.Run("success", func(t *testing.T) {
+		s.uc.EXPECT().Store(gomock.Any(), "test123", domain.CreateReport{Reason: domain.ReportReasonPhishing, Comment: "fake bank"}).Return(nil)
+
+		rec := s.serve(echo.POST, "/v1/url/test123/report", `{"reason":"phishing","comment":"fake bank"}`, "")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+	})
+
+	t.Run("without body fields", func(t *testing.T) {
+		s.uc.EXPECT().Store(gomock.Any(), "test123", domain.CreateReport{}).Return(nil)
+
+		rec := s.serve(echo.POST, "/v2/url/test123/report", `{}`, "")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+	})
+
+	t.Run("unknown reason", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/url/test123/report", `{"reason":"boring"}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "CreateReport.reason")
+	})
+
+	t.Run("comment too long", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/url/test123/report", `{"comment":"`+strings.Repeat("a", 501)+`"}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "CreateReport.comment")
+	})
+
+	t.Run("url not found", func(t *testing.T) {
+		s.uc.EXPECT().Store(gomock.Any(), "missing1", gomock.Any()).Return(domain.ErrNotFound)
+
+		rec := s.serve(echo.POST, "/v1/url/missing1/report", `{}`, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestReportHTTPStoreRateLimit(t *testing.T) {
+	s := newReportStack(t, reportHttp.Config{})
+	s.uc.EXPECT().Store(gomock.Any(), "test123", gomock.Any()).Return(nil).Times(reportHttp.DefaultBurst)
+
+	for i := 0; i < reportHttp.DefaultBurst; i++ {
+		rec := s.serve(echo.POST, "/v1/url/test123/report", `{}`, "")
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+	}
+
+	rec := s.serve(echo.POST, "/v2/url/test123/report", `{}`, "")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "limit is shared by API versions")
+}
+
+func TestReportHTTPStoreRateLimitSpoofedForwardedFor(t *testing.T) {
+	s := newReportStack(t, reportHttp.Config{})
+	s.uc.EXPECT().Store(gomock.Any(), "test123", gomock.Any()).Return(nil).Times(reportHttp.DefaultBurst)
+
+	serve := func(i int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/url/test123/report", strings.NewReader(`{}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", i))
+		req.Header.Set(echo.HeaderXRealIP, fmt.Sprintf("198.51.100.%d", i))
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < reportHttp.DefaultBurst; i++ {
+		assert.Equal(t, http.StatusAccepted, serve(i).Code)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(reportHttp.DefaultBurst).Code, "forwarded headers of untrusted peer are ignored")
+}
+
+func TestReportHTTPFetch(t *testing.T) {
+	s := newReportStack(t, reportHttp.Config{})
+	report := &domain.Report{ID: primitive.NewObjectID(), URLID: "test123", Status: domain.ReportStatusOpen, Count: 3}
+
+	t.Run("success", func(t *testing.T) {
+		s.uc.EXPECT().Fetch(gomock.Any(), domain.ReportFilter{Status: domain.ReportStatusOpen, Limit: 1}).
+			Return(&domain.ReportPage{Reports: []*domain.Report{report}, NextCursor: report.ID.Hex()}, nil)
+
+		rec := s.serve(echo.GET, "/v1/admin/reports?status=open&limit=1", "", s.adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		page := new(domain.ReportPage)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(page))
+		require.Len(t, page.Reports, 1)
+		assert.Equal(t, int64(3), page.Reports[0].Count)
+		assert.Contains(t, rec.Header().Get("Link"), "cursor="+report.ID.Hex())
+	})
+
+	t.Run("invalid status", func(t *testing.T) {
+		rec := s.serve(echo.GET, "/v1/admin/reports?status=closed", "", s.adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := s.serve(echo.GET, "/v1/admin/reports", "", s.userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := s.serve(echo.GET, "/v1/admin/reports", "", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestReportHTTPResolve(t *testing.T) {
+	s := newReportStack(t, reportHttp.Config{})
+	id := primitive.NewObjectID()
+
+	t.Run("success", func(t *testing.T) {
+		resolved := &domain.Report{ID: id, Status: domain.ReportStatusResolved, Resolution: &domain.ReportResolution{Action: domain.ReportActionBanOwner, By: s.admin.Subject}}
+		s.uc.EXPECT().Resolve(gomock.Any(), id.Hex(), domain.ResolveReport{Action: domain.ReportActionBanOwner, Note: "repeat offender"}, gomock.Any()).Return(resolved, nil)
+
+		rec := s.serve(echo.POST, "/v1/admin/reports/"+id.Hex()+"/resolve", `{"action":"ban_owner","note":"repeat offender"}`, s.adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		body := new(domain.Report)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, domain.ReportStatusResolved, body.Status)
+		assert.Equal(t, domain.ReportActionBanOwner, body.Resolution.Action)
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/admin/reports/"+id.Hex()+"/resolve", `{"action":"ignore"}`, s.adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("already resolved", func(t *testing.T) {
+		s.uc.EXPECT().Resolve(gomock.Any(), id.Hex(), gomock.Any(), gomock.Any()).Return(nil, domain.ErrConflict)
+
+		rec := s.serve(echo.POST, "/v1/admin/reports/"+id.Hex()+"/resolve", `{"action":"dismiss"}`, s.adminToken)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := s.serve(echo.POST, "/v1/admin/reports/"+id.Hex()+"/resolve", `{"action":"dismiss"}`, s.userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoReportRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoReportRepository will create an object that represent the report.Repository interface
+func NewMongoReportRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.ReportRepository {
+	return &mongoReportRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoReportRepository) fetch(ctx context.Context, command interface{}) ([]*domain.Report, error) {
+	ctx, span := m.tracer.Start(ctx, "repository fetch")
+	defer span.End()
+
+	cur, err := m.Conn.RunCommandCursor(ctx, command)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("can't execute command: %w", err)
+	}
+
+	defer func(ctx context.Context) {
+		err = cur.Close(ctx)
+		if err != nil {
+			m.logger.Error("Can't close cursor: ", zap.Error(err))
+		}
+	}(ctx)
+
+	result := make([]*domain.Report, 0)
+
+	for cur.Next(ctx) {
+		elem := new(domain.Report)
+		if err = cur.Decode(elem); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("can't unmarshal document into Report: %w", err)
+		}
+
+		result = append(result, elem)
+	}
+
+	if err = cur.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return result, nil
+}
+
+// Store upserts open report of URL. Unique index of open reports makes one of
+// concurrent upserts fail, it is retried then and updates the report created
+// by the other one.
+func (m *mongoReportRepository) Store(ctx context.Context, urlID string, comment domain.ReportComment) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", urlID),
+			attribute.String("reason", comment.Reason)),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "url_id", Value: urlID},
+		primitive.E{Key: "status", Value: domain.ReportStatusOpen},
+	}
+	update := bson.D{
+		primitive.E{Key: "$inc", Value: bson.D{
+			primitive.E{Key: "count", Value: 1},
+			primitive.E{Key: "reasons." + comment.Reason, Value: 1},
+		}},
+		primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "last_reported_at", Value: comment.CreatedAt},
+		}},
+		primitive.E{Key: "$setOnInsert", Value: bson.D{
+			primitive.E{Key: "_id", Value: primitive.NewObjectID()},
+			primitive.E{Key: "created_at", Value: comment.CreatedAt},
+		}},
+	}
+	if comment.Text != "" {
+		// only latest comments are kept
+		update = append(update, primitive.E{Key: "$push", Value: bson.D{
+			primitive.E{Key: "comments", Value: bson.D{
+				primitive.E{Key: "$each", Value: bson.A{comment}},
+				primitive.E{Key: "$slice", Value: -domain.ReportCommentsLimit},
+			}},
+		}})
+	}
+
+	col := m.Conn.Collection(m.cols.Name(store.ReportCollection))
+	opts := options.Update().SetUpsert(true)
+	_, err := col.UpdateOne(ctx, filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = col.UpdateOne(ctx, filter, update, opts)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("report store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoReportRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Report, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository GetByID",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("reportid", id.Hex())),
+	)
+	defer span.End()
+
+	report := new(domain.Report)
+	err := m.Conn.Collection(m.cols.Name(store.ReportCollection)).FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(report)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, fmt.Errorf("report was not found: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("report get error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return report, nil
+}
+
+func (m *mongoReportRepository) Fetch(ctx context.Context, filter domain.ReportFilter) ([]*domain.Report, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Fetch",
+		trace.WithAttributes(
+			attribute.String("status", filter.Status)),
+	)
+	defer span.End()
+
+	query := bson.D{}
+	if filter.Status != "" {
+		query = append(query, primitive.E{Key: "status", Value: filter.Status})
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query = append(query, primitive.E{Key: "created_at", Value: bson.D{primitive.E{Key: "$lt", Value: filter.CreatedBefore}}})
+	}
+	if filter.Cursor != "" {
+		cursor, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("cursor is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		}
+		query = append(query, primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$gt", Value: cursor}}})
+	}
+
+	command := bson.D{
+		primitive.E{Key: "find", Value: m.cols.Name(store.ReportCollection)},
+		primitive.E{Key: "filter", Value: query},
+		primitive.E{Key: "sort", Value: bson.D{primitive.E{Key: "_id", Value: 1}}},
+		primitive.E{Key: "limit", Value: filter.Limit},
+	}
+
+	list, err := m.fetch(ctx, command)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("report fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return list, nil
+}
+
+func (m *mongoReportRepository) Resolve(ctx context.Context, id primitive.ObjectID, resolution domain.ReportResolution) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Resolve",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("reportid", id.Hex()),
+			attribute.String("action", resolution.Action)),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "status", Value: domain.ReportStatusOpen},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: domain.ReportStatusResolved},
+		primitive.E{Key: "resolution", Value: resolution},
+	}}}
+
+	col := m.Conn.Collection(m.cols.Name(store.ReportCollection))
+	updRes, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("report resolve error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	if updRes.MatchedCount > 0 {
+		return nil
+	}
+
+	// report is either resolved or missing
+	n, err := col.CountDocuments(ctx, bson.D{primitive.E{Key: "_id", Value: id}}, options.Count().SetLimit(1))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("report count error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+	if n == 0 {
+		err = fmt.Errorf("report was not found: %w", domain.ErrNotFound)
+	} else {
+		err = fmt.Errorf("report is already resolved: %w", domain.ErrConflict)
+	}
+	span.RecordError(err)
+	return err
+}
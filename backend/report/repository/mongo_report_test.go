@@ -0,0 +1,250 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/report/repository"
+	"github.com/semka95/shortener/backend/store"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func newReport() *domain.Report {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	return &domain.Report{
+		ID:             primitive.NewObjectID(),
+		URLID:          "test123",
+		Status:         domain.ReportStatusOpen,
+		Count:          2,
+		Reasons:        map[string]int64{domain.ReportReasonPhishing: 1, domain.ReportReasonOther: 1},
+		Comments:       []domain.ReportComment{{Reason: domain.ReportReasonPhishing, Text: "fake bank login", CreatedAt: now}},
+		CreatedAt:      now.Add(-time.Hour),
+		LastReportedAt: now,
+	}
+}
+
+func newReportBsonD(r *domain.Report) bson.D {
+	return bson.D{
+		{Key: "_id", Value: r.ID},
+		{Key: "url_id", Value: r.URLID},
+		{Key: "status", Value: r.Status},
+		{Key: "count", Value: r.Count},
+		{Key: "reasons", Value: bson.D{
+			{Key: domain.ReportReasonPhishing, Value: int64(1)},
+			{Key: domain.ReportReasonOther, Value: int64(1)},
+		}},
+		{Key: "comments", Value: bson.A{bson.D{
+			{Key: "reason", Value: r.Comments[0].Reason},
+			{Key: "text", Value: r.Comments[0].Text},
+			{Key: "created_at", Value: r.Comments[0].CreatedAt},
+		}}},
+		{Key: "created_at", Value: r.CreatedAt},
+		{Key: "last_reported_at", Value: r.LastReportedAt},
+	}
+}
+
+func TestMongoReportRepository_Store(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	comment := domain.ReportComment{Reason: domain.ReportReasonSpam, Text: "spam in comments", CreatedAt: time.Now().Truncate(time.Millisecond).UTC()}
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, "test123", comment)
+
+		require.NoError(mt, err)
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, upd.Lookup("upsert").Boolean())
+		q := upd.Lookup("q").Document()
+		assert.Equal(mt, "test123", q.Lookup("url_id").StringValue())
+		assert.Equal(mt, domain.ReportStatusOpen, q.Lookup("status").StringValue())
+		u := upd.Lookup("u").Document()
+		assert.Equal(mt, int32(1), u.Lookup("$inc", "reasons.spam").Int32())
+		assert.Equal(mt, int32(-domain.ReportCommentsLimit), u.Lookup("$push", "comments", "$slice").Int32())
+		assert.Equal(mt, comment.Text, u.Lookup("$push", "comments", "$each").Array().Index(0).Value().Document().Lookup("text").StringValue())
+	})
+
+	mt.Run("without comment", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, "test123", domain.ReportComment{Reason: domain.ReportReasonOther, CreatedAt: comment.CreatedAt})
+
+		require.NoError(mt, err)
+		u := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		_, err = u.LookupErr("$push")
+		assert.Error(mt, err, "empty comment is not kept")
+	})
+
+	mt.Run("concurrent insert", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, "test123", comment)
+
+		require.NoError(mt, err)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, "test123", comment)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoReportRepository_GetByID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tReport := newReport()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.report", mtest.FirstBatch, newReportBsonD(tReport)),
+			mtest.CreateCursorResponse(0, "test.report", mtest.NextBatch),
+		)
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		report, err := r.GetByID(noopCtx, tReport.ID)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, tReport, report)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.report", mtest.FirstBatch))
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		report, err := r.GetByID(noopCtx, tReport.ID)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+		assert.Nil(mt, report)
+	})
+}
+
+func TestMongoReportRepository_Fetch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tReport := newReport()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.report", mtest.FirstBatch, newReportBsonD(tReport)),
+			mtest.CreateCursorResponse(0, "test.report", mtest.NextBatch),
+		)
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, zap.NewNop(), tracer)
+		cursor := primitive.NewObjectIDFromTimestamp(time.Now().Add(-24 * time.Hour))
+
+		list, err := r.Fetch(noopCtx, domain.ReportFilter{Status: domain.ReportStatusOpen, Cursor: cursor.Hex(), Limit: 10})
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.Report{tReport}, list)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(mt, domain.ReportStatusOpen, filter.Lookup("status").StringValue())
+		assert.Equal(mt, cursor, filter.Lookup("_id", "$gt").ObjectID())
+		_, err = filter.LookupErr("created_at")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("created before", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.report", mtest.FirstBatch, newReportBsonD(tReport)))
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, zap.NewNop(), tracer)
+		before := time.Now().Add(-time.Hour).Truncate(time.Millisecond).UTC()
+
+		list, err := r.Fetch(noopCtx, domain.ReportFilter{Status: domain.ReportStatusOpen, CreatedBefore: before, Limit: 10})
+
+		require.NoError(mt, err)
+		assert.Len(mt, list, 1)
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		assert.Equal(mt, before, filter.Lookup("created_at", "$lt").Time().UTC())
+	})
+
+	mt.Run("invalid cursor", func(mt *mtest.T) {
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, zap.NewNop(), tracer)
+
+		list, err := r.Fetch(noopCtx, domain.ReportFilter{Cursor: "zzz", Limit: 10})
+
+		assert.ErrorIs(mt, err, domain.ErrBadParamInput)
+		assert.Nil(mt, list)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, zap.NewNop(), tracer)
+
+		list, err := r.Fetch(noopCtx, domain.ReportFilter{Limit: 10})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, list)
+	})
+}
+
+func TestMongoReportRepository_Resolve(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	id := primitive.NewObjectID()
+	resolution := domain.ReportResolution{Action: domain.ReportActionDismiss, By: "507f191e810c19729de860ea", At: time.Now().Truncate(time.Millisecond).UTC()}
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Resolve(noopCtx, id, resolution)
+
+		require.NoError(mt, err)
+		upd := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, domain.ReportStatusOpen, upd.Lookup("q", "status").StringValue())
+		assert.Equal(mt, domain.ReportStatusResolved, upd.Lookup("u", "$set", "status").StringValue())
+		assert.Equal(mt, resolution.Action, upd.Lookup("u", "$set", "resolution", "action").StringValue())
+	})
+
+	mt.Run("already resolved", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+			mtest.CreateCursorResponse(0, "test.report", mtest.FirstBatch, bson.D{{Key: "n", Value: int64(1)}}),
+		)
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Resolve(noopCtx, id, resolution)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+			mtest.CreateCursorResponse(0, "test.report", mtest.FirstBatch),
+		)
+		r := repository.NewMongoReportRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Resolve(noopCtx, id, resolution)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+	})
+}
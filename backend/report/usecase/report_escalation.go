@@ -0,0 +1,256 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// DefaultEscalationInterval is the interval between escalations in seconds
+// used when EscalationConfig has none
+const DefaultEscalationInterval = 600
+
+// escalationLock is the name of the lock held while reports are escalated
+const escalationLock = "report_escalation"
+
+// escalationBatch is the number of open reports fetched at once
+const escalationBatch = 100
+
+// blockedByEscalation is the rule URLs disabled by escalation are blocked by,
+// they are restored when report is dismissed
+const blockedByEscalation = "report_escalation"
+
+// escalationActor is the actor of audit entries of escalation
+const escalationActor = "system"
+
+// EscalationConfig stores configuration of reported URLs containment.
+// Reported URLs redirect through interstitial page right away, URLs of
+// reports left open for DisableAfter are disabled until admin resolves the
+// report.
+type EscalationConfig struct {
+	// DisableAfter is the number of seconds report may stay open before its
+	// URL is disabled, zero never disables URLs
+	DisableAfter int `yaml:"disable_after_seconds"`
+	// Interval is the interval between escalations in seconds
+	Interval int `yaml:"interval_seconds"`
+}
+
+// ReportEscalation is domain.ReportEscalationUsecase, it disables URLs of
+// reports admins haven't reviewed in time and notifies their owners
+type ReportEscalation struct {
+	reportRepo     domain.ReportRepository
+	urlRepo        domain.URLRepository
+	userRepo       domain.UserRepository
+	auditRepo      domain.AuditRepository
+	sender         domain.NotificationSender
+	locker         domain.Locker
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            EscalationConfig
+	now            func() time.Time
+}
+
+var _ domain.ReportEscalationUsecase = (*ReportEscalation)(nil)
+
+// NewReportEscalation creates ReportEscalation, call Run to escalate reports
+// periodically
+func NewReportEscalation(r domain.ReportRepository, u domain.URLRepository, users domain.UserRepository, a domain.AuditRepository, sender domain.NotificationSender, l domain.Locker, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg EscalationConfig) *ReportEscalation {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultEscalationInterval
+	}
+
+	return &ReportEscalation{
+		reportRepo:     r,
+		urlRepo:        u,
+		userRepo:       users,
+		auditRepo:      a,
+		sender:         sender,
+		locker:         l,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces clock age of reports is measured by
+func (e *ReportEscalation) SetClock(now func() time.Time) {
+	e.now = now
+}
+
+// Run escalates reports right away and then every interval until context is
+// canceled, escalation waits while service is read-only. Run returns at once
+// when URLs are never disabled.
+func (e *ReportEscalation) Run(ctx context.Context) {
+	if e.cfg.DisableAfter <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(e.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		if err := e.Escalate(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Error("can't escalate reports", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Escalate disables URLs of reports open for longer than DisableAfter. Only
+// one instance escalates at a time, others skip escalation while lock is
+// held.
+func (e *ReportEscalation) Escalate(ctx context.Context) error {
+	if e.cfg.DisableAfter <= 0 {
+		return nil
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, e.contextTimeout)
+	lock, err := e.locker.AcquireLock(lockCtx, escalationLock, time.Duration(e.cfg.Interval)*time.Second)
+	cancel()
+	if errors.Is(err, domain.ErrConflict) {
+		e.logger.Debug("reports are escalated by another instance")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), e.contextTimeout)
+		defer cancel()
+		if err := lock.Release(releaseCtx); err != nil {
+			e.logger.Warn("can't release report escalation lock", zap.Error(err))
+		}
+	}()
+
+	filter := domain.ReportFilter{
+		Status:        domain.ReportStatusOpen,
+		CreatedBefore: e.now().UTC().Add(-time.Duration(e.cfg.DisableAfter) * time.Second),
+		Limit:         escalationBatch,
+	}
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, e.contextTimeout)
+		reports, err := e.reportRepo.Fetch(fetchCtx, filter)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, report := range reports {
+			err = e.escalate(ctx, report)
+			// URL changed or deleted since it was read is escalated by the
+			// next run
+			if errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("can't escalate report %s: %w", report.ID.Hex(), err)
+			}
+		}
+
+		if len(reports) < escalationBatch {
+			return nil
+		}
+		filter.Cursor = reports[len(reports)-1].ID.Hex()
+	}
+}
+
+// escalate disables URL of report, audits it and notifies URL owner. URLs
+// already blocked are left as they are.
+func (e *ReportEscalation) escalate(c context.Context, report *domain.Report) error {
+	ctx, cancel := context.WithTimeout(c, e.contextTimeout)
+	defer cancel()
+
+	ctx, span := e.tracer.Start(
+		ctx,
+		"usecase EscalateReport",
+		trace.WithAttributes(
+			attribute.String("reportid", report.ID.Hex()),
+			attribute.String("urlid", report.URLID)),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	u, err := e.urlRepo.GetByID(ctx, report.URLID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if u.BlockedBy != "" {
+		return nil
+	}
+
+	updatedAt := u.UpdatedAt
+	u.BlockedBy = blockedByEscalation
+	u.UpdatedAt = e.now().Truncate(time.Millisecond).UTC()
+	if err = e.urlRepo.UpdateIfUnchanged(ctx, u, updatedAt, domain.AnyOwner); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	entry := &domain.AuditEntry{
+		ID:        primitive.NewObjectID(),
+		Action:    blockURLAction,
+		ActorID:   escalationActor,
+		EntityID:  u.ID,
+		CreatedAt: u.UpdatedAt,
+	}
+	if err = e.auditRepo.Store(ctx, entry); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("can't audit %s of report %s: %w", blockURLAction, report.ID.Hex(), err)
+	}
+	e.logger.Info("URL of unreviewed report is disabled", zap.String("reportid", report.ID.Hex()), zap.String("urlid", u.ID))
+
+	// URL stays disabled when owner can't be notified
+	if err = e.notify(ctx, u, report); err != nil {
+		span.RecordError(err)
+		e.logger.Error("can't send URL disabled email", zap.String("urlid", u.ID), zap.Error(err))
+	}
+
+	return nil
+}
+
+// notify emails owner of disabled URL, anonymous URLs have none
+func (e *ReportEscalation) notify(ctx context.Context, u *domain.URL, report *domain.Report) error {
+	if u.UserID == "" {
+		return nil
+	}
+	userID, err := primitive.ObjectIDFromHex(u.UserID)
+	if err != nil {
+		return fmt.Errorf("owner id is not valid ObjectID: %w", err)
+	}
+	owner, err := e.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return e.sender.Send(ctx, domain.Notification{
+		To:       owner.Email,
+		Template: domain.NotificationURLDisabled,
+		Data: domain.URLDisabled{
+			Name:       owner.FullName,
+			ID:         u.ID,
+			Link:       u.Link,
+			ReportedAt: report.CreatedAt,
+		},
+	})
+}
@@ -0,0 +1,150 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	_AuditMock "github.com/semka95/shortener/backend/audit/mock"
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+	notifiermock "github.com/semka95/shortener/backend/notifier/mock"
+	"github.com/semka95/shortener/backend/report/mock"
+	"github.com/semka95/shortener/backend/report/usecase"
+	"github.com/semka95/shortener/backend/tests"
+	_URLMock "github.com/semka95/shortener/backend/url/mock"
+	usermock "github.com/semka95/shortener/backend/user/mock"
+)
+
+func TestReportEscalation_Escalate(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	reports := mock.NewMockReportRepository(controller)
+	urls := _URLMock.NewMockURLRepository(controller)
+	users := usermock.NewMockUserRepository(controller)
+	audit := _AuditMock.NewMockAuditRepository(controller)
+	sender := notifiermock.NewMockNotificationSender(controller)
+	locker := lockmock.NewMockLocker(controller)
+	lock := lockmock.NewMockLock(controller)
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	newEscalation := func(cfg usecase.EscalationConfig) *usecase.ReportEscalation {
+		e := usecase.NewReportEscalation(reports, urls, users, audit, sender, locker, 10*time.Second, tracer, zap.NewNop(), cfg)
+		e.SetClock(func() time.Time { return now })
+		return e
+	}
+	cfg := usecase.EscalationConfig{DisableAfter: 3600}
+	filter := domain.ReportFilter{Status: domain.ReportStatusOpen, CreatedBefore: now.Add(-time.Hour), Limit: 100}
+
+	t.Run("url disabled and owner notified", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		updatedAt := tURL.UpdatedAt
+		owner := tests.NewUser()
+		tURL.UserID = owner.ID.Hex()
+		locker.EXPECT().AcquireLock(gomock.Any(), "report_escalation", 600*time.Second).Return(lock, nil)
+		reports.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.Report{tReport}, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), updatedAt, domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+			assert.Equal(t, "report_escalation", u.BlockedBy)
+			assert.Equal(t, now, u.UpdatedAt)
+			return nil
+		})
+		audit.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, e *domain.AuditEntry) error {
+			assert.Equal(t, "BLOCK url", e.Action)
+			assert.Equal(t, "system", e.ActorID)
+			assert.Equal(t, tURL.ID, e.EntityID)
+			return nil
+		})
+		users.EXPECT().GetByID(gomock.Any(), owner.ID).Return(owner, nil)
+		sender.EXPECT().Send(gomock.Any(), domain.Notification{
+			To:       owner.Email,
+			Template: domain.NotificationURLDisabled,
+			Data: domain.URLDisabled{
+				Name:       owner.FullName,
+				ID:         tURL.ID,
+				Link:       tURL.Link,
+				ReportedAt: tReport.CreatedAt,
+			},
+		}).Return(nil)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newEscalation(cfg).Escalate(context.Background()))
+	})
+
+	t.Run("blocked and changed urls are skipped", func(t *testing.T) {
+		list := make([]*domain.Report, 100)
+		for i := range list {
+			list[i] = newReport()
+		}
+		last := newReport()
+		blocked := tests.NewURL()
+		blocked.BlockedBy = "report_escalation"
+		next := filter
+		next.Cursor = list[99].ID.Hex()
+		locker.EXPECT().AcquireLock(gomock.Any(), "report_escalation", gomock.Any()).Return(lock, nil)
+		reports.EXPECT().Fetch(gomock.Any(), filter).Return(list, nil)
+		reports.EXPECT().Fetch(gomock.Any(), next).Return([]*domain.Report{last}, nil)
+		urls.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(blocked, nil).Times(100)
+		urls.EXPECT().GetByID(gomock.Any(), last.URLID).Return(tests.NewURL(), nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(domain.ErrConflict)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newEscalation(cfg).Escalate(context.Background()))
+	})
+
+	t.Run("anonymous url", func(t *testing.T) {
+		tURL := tests.NewURL()
+		tURL.UserID = ""
+		locker.EXPECT().AcquireLock(gomock.Any(), "report_escalation", gomock.Any()).Return(lock, nil)
+		reports.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.Report{newReport()}, nil)
+		urls.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(nil)
+		audit.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newEscalation(cfg).Escalate(context.Background()))
+	})
+
+	t.Run("notification error", func(t *testing.T) {
+		tURL := tests.NewURL()
+		tURL.UserID = primitive.NewObjectID().Hex()
+		locker.EXPECT().AcquireLock(gomock.Any(), "report_escalation", gomock.Any()).Return(lock, nil)
+		reports.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.Report{newReport()}, nil)
+		urls.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(nil)
+		audit.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+		users.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		require.NoError(t, newEscalation(cfg).Escalate(context.Background()), "URL stays disabled")
+	})
+
+	t.Run("audit error", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "report_escalation", gomock.Any()).Return(lock, nil)
+		reports.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.Report{newReport()}, nil)
+		urls.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(tests.NewURL(), nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(nil)
+		audit.EXPECT().Store(gomock.Any(), gomock.Any()).Return(domain.ErrInternalServerError)
+		lock.EXPECT().Release(gomock.Any()).Return(nil)
+
+		err := newEscalation(cfg).Escalate(context.Background())
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+
+	t.Run("escalated by another instance", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "report_escalation", gomock.Any()).Return(nil, domain.ErrConflict)
+
+		require.NoError(t, newEscalation(cfg).Escalate(context.Background()))
+	})
+
+	t.Run("urls never disabled", func(t *testing.T) {
+		require.NoError(t, newEscalation(usecase.EscalationConfig{}).Escalate(context.Background()))
+	})
+}
@@ -0,0 +1,329 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Audit actions of report resolutions, URL blocked by report has the same
+// action as URL blocked by blocklist rule
+const (
+	blockURLAction    = "BLOCK url"
+	unblockURLAction  = "UNBLOCK url"
+	blockDomainAction = "BLOCK domain"
+	disableUserAction = "DISABLE user"
+)
+
+// blockedByReport is the rule URLs disabled by report are blocked by
+const blockedByReport = "report"
+
+// defaultResolveNote is the reason of blocklist rules and disabled accounts
+// when admin gives no note
+const defaultResolveNote = "abuse report"
+
+type reportUsecase struct {
+	reportRepo     domain.ReportRepository
+	urlRepo        domain.URLRepository
+	blocklist      domain.BlocklistUsecase
+	users          domain.UserUsecase
+	auditRepo      domain.AuditRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+}
+
+// NewReportUsecase will create new an reportUsecase object representation of domain.ReportUsecase interface.
+// Reports are resolved with blocklist and user usecases admins use directly.
+func NewReportUsecase(r domain.ReportRepository, u domain.URLRepository, b domain.BlocklistUsecase, users domain.UserUsecase, a domain.AuditRepository, timeout time.Duration, tracer trace.Tracer) domain.ReportUsecase {
+	return &reportUsecase{
+		reportRepo:     r,
+		urlRepo:        u,
+		blocklist:      b,
+		users:          users,
+		auditRepo:      a,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+	}
+}
+
+func (uc *reportUsecase) Store(c context.Context, urlID string, createReport domain.CreateReport) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Store",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// blocked URLs are reported as missing, they are not served anyway
+	u, err := uc.urlRepo.GetByID(ctx, urlID, "id", "flag")
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if u.BlockedBy != "" {
+		err = fmt.Errorf("URL is blocked by %s rule: %w", u.BlockedBy, domain.ErrNotFound)
+		span.RecordError(err)
+		return err
+	}
+
+	reason := createReport.Reason
+	if reason == "" {
+		reason = domain.ReportReasonOther
+	}
+	comment := domain.ReportComment{
+		Reason:    reason,
+		Text:      createReport.Comment,
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+
+	if err = uc.reportRepo.Store(ctx, urlID, comment); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if u.Flag != nil {
+		return nil
+	}
+	if err = uc.flag(ctx, urlID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// flag forces interstitial page on reported URL until report is resolved,
+// it is tried once more when URL is changed meanwhile
+func (uc *reportUsecase) flag(ctx context.Context, urlID string) error {
+	for retry := true; ; retry = false {
+		u, err := uc.urlRepo.GetByID(ctx, urlID)
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if u.Flag != nil {
+			return nil
+		}
+
+		updatedAt := u.UpdatedAt
+		u.Flag = &domain.URLFlag{Signals: []string{domain.URLSignalReported}, At: time.Now().Truncate(time.Millisecond).UTC()}
+		u.UpdatedAt = u.Flag.At
+		err = uc.urlRepo.UpdateIfUnchanged(ctx, u, updatedAt, domain.AnyOwner)
+		if !retry || !errors.Is(err, domain.ErrConflict) {
+			return err
+		}
+	}
+}
+
+func (uc *reportUsecase) Fetch(c context.Context, filter domain.ReportFilter) (*domain.ReportPage, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if filter.Limit == 0 {
+		filter.Limit = domain.DefaultReportPageLimit
+	}
+
+	reports, err := uc.reportRepo.Fetch(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	page := &domain.ReportPage{Reports: reports}
+	if int64(len(reports)) == filter.Limit {
+		page.NextCursor = reports[len(reports)-1].ID.Hex()
+	}
+
+	return page, nil
+}
+
+func (uc *reportUsecase) Resolve(c context.Context, id string, resolve domain.ResolveReport, admin *auth.Claims) (*domain.Report, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Resolve",
+		trace.WithAttributes(
+			attribute.String("reportid", id),
+			attribute.String("action", resolve.Action)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	reportID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = fmt.Errorf("report id is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		span.RecordError(err)
+		return nil, err
+	}
+
+	report, err := uc.reportRepo.GetByID(ctx, reportID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if report.Status != domain.ReportStatusOpen {
+		err = fmt.Errorf("report is already resolved: %w", domain.ErrConflict)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if resolve.Action == domain.ReportActionDismiss {
+		err = uc.unflag(ctx, report, admin)
+	} else {
+		err = uc.apply(ctx, report, resolve, admin)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	resolution := domain.ReportResolution{
+		Action: resolve.Action,
+		Note:   resolve.Note,
+		By:     admin.Subject,
+		At:     time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	if err = uc.reportRepo.Resolve(ctx, reportID, resolution); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	report.Status = domain.ReportStatusResolved
+	report.Resolution = &resolution
+
+	return report, nil
+}
+
+// unflag clears flag of the URL once its report is dismissed, so it
+// redirects without interstitial page, URL disabled by escalation is
+// restored and it is audited. URL may be deleted since it was reported.
+func (uc *reportUsecase) unflag(ctx context.Context, report *domain.Report, admin *auth.Claims) error {
+	u, err := uc.urlRepo.GetByID(ctx, report.URLID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	escalated := u.BlockedBy == blockedByEscalation
+	if u.Flag == nil && !escalated {
+		return nil
+	}
+
+	updatedAt := u.UpdatedAt
+	u.Flag = nil
+	if escalated {
+		u.BlockedBy = ""
+	}
+	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+	if err = uc.urlRepo.UpdateIfUnchanged(ctx, u, updatedAt, domain.AnyOwner); err != nil {
+		return err
+	}
+	if !escalated {
+		return nil
+	}
+
+	entry := &domain.AuditEntry{
+		ID:           primitive.NewObjectID(),
+		Action:       unblockURLAction,
+		ActorID:      admin.Subject,
+		Impersonator: admin.Impersonator,
+		EntityID:     u.ID,
+		CreatedAt:    u.UpdatedAt,
+	}
+	if err = uc.auditRepo.Store(ctx, entry); err != nil {
+		return fmt.Errorf("can't audit %s of report %s: %w", unblockURLAction, report.ID.Hex(), err)
+	}
+
+	return nil
+}
+
+// apply takes action on reported URL and audits it
+func (uc *reportUsecase) apply(ctx context.Context, report *domain.Report, resolve domain.ResolveReport, admin *auth.Claims) error {
+	u, err := uc.urlRepo.GetByID(ctx, report.URLID)
+	if err != nil {
+		return err
+	}
+
+	note := resolve.Note
+	if note == "" {
+		note = defaultResolveNote
+	}
+
+	var action, entityID string
+	switch resolve.Action {
+	case domain.ReportActionDisableURL:
+		action, entityID = blockURLAction, u.ID
+		if u.BlockedBy != "" && u.BlockedBy != blockedByEscalation {
+			// URL is already blocked, e.g. by blocklist rule
+			return nil
+		}
+		// URL disabled by escalation is confirmed, it stays blocked by report
+		updatedAt := u.UpdatedAt
+		u.BlockedBy = blockedByReport
+		u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+		if err = uc.urlRepo.UpdateIfUnchanged(ctx, u, updatedAt, domain.AnyOwner); err != nil {
+			return err
+		}
+	case domain.ReportActionBlockDomain:
+		link, err := url.Parse(u.Link)
+		if err != nil || link.Hostname() == "" {
+			return fmt.Errorf("reported link has no domain: %w", domain.ErrBadParamInput)
+		}
+		// existing URLs of the domain are blocked by blocklist refresh
+		rule, err := uc.blocklist.Store(ctx, domain.CreateBlockedDomain{Domain: link.Hostname(), Reason: note}, admin)
+		if err != nil {
+			return err
+		}
+		action, entityID = blockDomainAction, rule.ID.Hex()
+	case domain.ReportActionBanOwner:
+		if u.UserID == "" {
+			return fmt.Errorf("reported URL is anonymous: %w", domain.ErrBadParamInput)
+		}
+		if err = uc.users.Disable(ctx, u.UserID, domain.DisableUser{Reason: note}, admin); err != nil {
+			return err
+		}
+		action, entityID = disableUserAction, u.UserID
+	default:
+		return fmt.Errorf("unknown report action %q: %w", resolve.Action, domain.ErrBadParamInput)
+	}
+
+	entry := &domain.AuditEntry{
+		ID:           primitive.NewObjectID(),
+		Action:       action,
+		ActorID:      admin.Subject,
+		Impersonator: admin.Impersonator,
+		EntityID:     entityID,
+		CreatedAt:    time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	if err = uc.auditRepo.Store(ctx, entry); err != nil {
+		return fmt.Errorf("can't audit %s of report %s: %w", action, report.ID.Hex(), err)
+	}
+
+	return nil
+}
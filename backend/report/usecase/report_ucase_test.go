@@ -0,0 +1,360 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	_AuditMock "github.com/semka95/shortener/backend/audit/mock"
+	_BlocklistMock "github.com/semka95/shortener/backend/blocklist/mock"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/report/mock"
+	"github.com/semka95/shortener/backend/report/usecase"
+	"github.com/semka95/shortener/backend/tests"
+	_URLMock "github.com/semka95/shortener/backend/url/mock"
+	_UserMock "github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+func newReport() *domain.Report {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	return &domain.Report{
+		ID:             primitive.NewObjectID(),
+		URLID:          "test123",
+		Status:         domain.ReportStatusOpen,
+		Count:          1,
+		Reasons:        map[string]int64{domain.ReportReasonPhishing: 1},
+		CreatedAt:      now,
+		LastReportedAt: now,
+	}
+}
+
+func TestReportUsecase_Store(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	reports := mock.NewMockReportRepository(controller)
+	urls := _URLMock.NewMockURLRepository(controller)
+	uc := usecase.NewReportUsecase(reports, urls, nil, nil, nil, 10*time.Second, tracer)
+	tURL := tests.NewURL()
+
+	t.Run("success", func(t *testing.T) {
+		stored := tests.NewURL()
+		updatedAt := stored.UpdatedAt
+		gomock.InOrder(
+			urls.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "flag").Return(tURL, nil),
+			reports.EXPECT().Store(gomock.Any(), tURL.ID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, c domain.ReportComment) error {
+				assert.Equal(t, domain.ReportReasonPhishing, c.Reason)
+				assert.Equal(t, "fake bank login", c.Text)
+				assert.False(t, c.CreatedAt.IsZero())
+				return nil
+			}),
+			urls.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(stored, nil),
+			urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), updatedAt, domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+				require.NotNil(t, u.Flag)
+				assert.Equal(t, []string{domain.URLSignalReported}, u.Flag.Signals)
+				assert.Equal(t, tURL.Link, u.Link, "URL is updated as whole")
+				return nil
+			}),
+		)
+
+		err := uc.Store(context.Background(), tURL.ID, domain.CreateReport{Reason: domain.ReportReasonPhishing, Comment: "fake bank login"})
+		require.NoError(t, err)
+	})
+
+	t.Run("reason defaults to other", func(t *testing.T) {
+		flagged := tests.NewURL()
+		flagged.Flag = &domain.URLFlag{Signals: []string{domain.URLSignalReported}}
+		urls.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "flag").Return(flagged, nil)
+		reports.EXPECT().Store(gomock.Any(), tURL.ID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, c domain.ReportComment) error {
+			assert.Equal(t, domain.ReportReasonOther, c.Reason)
+			return nil
+		})
+
+		err := uc.Store(context.Background(), tURL.ID, domain.CreateReport{})
+		require.NoError(t, err)
+	})
+
+	t.Run("url changed while flagged", func(t *testing.T) {
+		urls.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "flag").Return(tests.NewURL(), nil)
+		reports.EXPECT().Store(gomock.Any(), tURL.ID, gomock.Any()).Return(nil)
+		gomock.InOrder(
+			urls.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tests.NewURL(), nil),
+			urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(domain.ErrConflict),
+			urls.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tests.NewURL(), nil),
+			urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(nil),
+		)
+
+		err := uc.Store(context.Background(), tURL.ID, domain.CreateReport{})
+		require.NoError(t, err)
+	})
+
+	t.Run("flag error", func(t *testing.T) {
+		urls.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "flag").Return(tests.NewURL(), nil)
+		reports.EXPECT().Store(gomock.Any(), tURL.ID, gomock.Any()).Return(nil)
+		urls.EXPECT().GetByID(gomock.Any(), tURL.ID).DoAndReturn(func(context.Context, string, ...string) (*domain.URL, error) {
+			return tests.NewURL(), nil
+		}).Times(2)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(domain.ErrConflict).Times(2)
+
+		err := uc.Store(context.Background(), tURL.ID, domain.CreateReport{})
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("url not found", func(t *testing.T) {
+		urls.EXPECT().GetByID(gomock.Any(), "missing", "id", "flag").Return(nil, domain.ErrNotFound)
+
+		err := uc.Store(context.Background(), "missing", domain.CreateReport{})
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("url blocked", func(t *testing.T) {
+		blocked := tests.NewURL()
+		blocked.BlockedBy = "example.org"
+		urls.EXPECT().GetByID(gomock.Any(), blocked.ID, "id", "flag").Return(blocked, nil)
+
+		err := uc.Store(context.Background(), blocked.ID, domain.CreateReport{})
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+}
+
+func TestReportUsecase_Fetch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	reports := mock.NewMockReportRepository(controller)
+	uc := usecase.NewReportUsecase(reports, nil, nil, nil, nil, 10*time.Second, tracer)
+
+	t.Run("full page has next cursor", func(t *testing.T) {
+		list := []*domain.Report{newReport(), newReport()}
+		reports.EXPECT().Fetch(gomock.Any(), domain.ReportFilter{Status: domain.ReportStatusOpen, Limit: 2}).Return(list, nil)
+
+		page, err := uc.Fetch(context.Background(), domain.ReportFilter{Status: domain.ReportStatusOpen, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, list, page.Reports)
+		assert.Equal(t, list[1].ID.Hex(), page.NextCursor)
+	})
+
+	t.Run("default limit", func(t *testing.T) {
+		reports.EXPECT().Fetch(gomock.Any(), domain.ReportFilter{Limit: domain.DefaultReportPageLimit}).Return([]*domain.Report{newReport()}, nil)
+
+		page, err := uc.Fetch(context.Background(), domain.ReportFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, page.NextCursor)
+	})
+}
+
+func TestReportUsecase_Resolve(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	reports := mock.NewMockReportRepository(controller)
+	urls := _URLMock.NewMockURLRepository(controller)
+	blocklist := _BlocklistMock.NewMockBlocklistUsecase(controller)
+	users := _UserMock.NewMockUserUsecase(controller)
+	audit := _AuditMock.NewMockAuditRepository(controller)
+	uc := usecase.NewReportUsecase(reports, urls, blocklist, users, audit, 10*time.Second, tracer)
+	admin := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e7f", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+
+	expectAudit := func(action, entityID string) {
+		audit.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, e *domain.AuditEntry) error {
+			assert.Equal(t, action, e.Action)
+			assert.Equal(t, admin.Subject, e.ActorID)
+			assert.Equal(t, entityID, e.EntityID)
+			return nil
+		})
+	}
+	expectResolve := func(report *domain.Report, action string) {
+		reports.EXPECT().Resolve(gomock.Any(), report.ID, gomock.Any()).DoAndReturn(func(_ context.Context, _ primitive.ObjectID, r domain.ReportResolution) error {
+			assert.Equal(t, action, r.Action)
+			assert.Equal(t, admin.Subject, r.By)
+			return nil
+		})
+	}
+
+	t.Run("invalid id", func(t *testing.T) {
+		report, err := uc.Resolve(context.Background(), "not valid id", domain.ResolveReport{Action: domain.ReportActionDismiss}, admin)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, report)
+	})
+
+	t.Run("already resolved", func(t *testing.T) {
+		tReport := newReport()
+		tReport.Status = domain.ReportStatusResolved
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+
+		report, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDismiss}, admin)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, report)
+	})
+
+	t.Run("dismiss", func(t *testing.T) {
+		tReport := newReport()
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tests.NewURL(), nil)
+		expectResolve(tReport, domain.ReportActionDismiss)
+
+		report, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDismiss, Note: "not abuse"}, admin)
+		require.NoError(t, err)
+		assert.Equal(t, domain.ReportStatusResolved, report.Status)
+		assert.Equal(t, "not abuse", report.Resolution.Note)
+	})
+
+	t.Run("dismiss clears spam flag", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		tURL.Flag = &domain.URLFlag{Score: 60, Signals: []string{"homograph"}}
+		updatedAt := tURL.UpdatedAt
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), updatedAt, domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+			assert.Nil(t, u.Flag)
+			return nil
+		})
+		expectResolve(tReport, domain.ReportActionDismiss)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDismiss}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("dismiss restores escalated url", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		tURL.BlockedBy = "report_escalation"
+		tURL.Flag = &domain.URLFlag{Signals: []string{domain.URLSignalReported}}
+		updatedAt := tURL.UpdatedAt
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), updatedAt, domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+			assert.Nil(t, u.Flag)
+			assert.Empty(t, u.BlockedBy)
+			return nil
+		})
+		expectAudit("UNBLOCK url", tURL.ID)
+		expectResolve(tReport, domain.ReportActionDismiss)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDismiss}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("dismiss keeps url blocked by rule", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		tURL.BlockedBy = "example.org"
+		tURL.Flag = &domain.URLFlag{Signals: []string{domain.URLSignalReported}}
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+			assert.Nil(t, u.Flag)
+			assert.Equal(t, "example.org", u.BlockedBy)
+			return nil
+		})
+		expectResolve(tReport, domain.ReportActionDismiss)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDismiss}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("dismiss deleted url", func(t *testing.T) {
+		tReport := newReport()
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(nil, domain.ErrNotFound)
+		expectResolve(tReport, domain.ReportActionDismiss)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDismiss}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("disable url", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		updatedAt := tURL.UpdatedAt
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), updatedAt, domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+			assert.Equal(t, "report", u.BlockedBy)
+			return nil
+		})
+		expectAudit("BLOCK url", tURL.ID)
+		expectResolve(tReport, domain.ReportActionDisableURL)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDisableURL}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("disable escalated url", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		tURL.BlockedBy = "report_escalation"
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		urls.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).DoAndReturn(func(_ context.Context, u *domain.URL, _ time.Time, _ string) error {
+			assert.Equal(t, "report", u.BlockedBy)
+			return nil
+		})
+		expectAudit("BLOCK url", tURL.ID)
+		expectResolve(tReport, domain.ReportActionDisableURL)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionDisableURL}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("block domain", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		rule := &domain.BlockedDomain{ID: primitive.NewObjectID(), Domain: "www.example.org"}
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		blocklist.EXPECT().Store(gomock.Any(), domain.CreateBlockedDomain{Domain: "www.example.org", Reason: "phishing kit"}, admin).Return(rule, nil)
+		expectAudit("BLOCK domain", rule.ID.Hex())
+		expectResolve(tReport, domain.ReportActionBlockDomain)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionBlockDomain, Note: "phishing kit"}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("ban owner", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		users.EXPECT().Disable(gomock.Any(), tURL.UserID, domain.DisableUser{Reason: "abuse report"}, admin).Return(nil)
+		expectAudit("DISABLE user", tURL.UserID)
+		expectResolve(tReport, domain.ReportActionBanOwner)
+
+		_, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionBanOwner}, admin)
+		require.NoError(t, err)
+	})
+
+	t.Run("ban owner of anonymous url", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		tURL.UserID = ""
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+
+		report, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionBanOwner}, admin)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, report)
+	})
+
+	t.Run("action failed", func(t *testing.T) {
+		tReport := newReport()
+		tURL := tests.NewURL()
+		reports.EXPECT().GetByID(gomock.Any(), tReport.ID).Return(tReport, nil)
+		urls.EXPECT().GetByID(gomock.Any(), tReport.URLID).Return(tURL, nil)
+		users.EXPECT().Disable(gomock.Any(), tURL.UserID, gomock.Any(), admin).Return(domain.ErrNotFound)
+
+		report, err := uc.Resolve(context.Background(), tReport.ID.Hex(), domain.ResolveReport{Action: domain.ReportActionBanOwner}, admin)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, report, "report stays open")
+	})
+}
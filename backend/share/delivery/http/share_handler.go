@@ -0,0 +1,293 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/i18n"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// DefaultRateLimit is the number of requests per second a client can make to
+// shared statistics pages used when Config.RateLimit is not set
+const DefaultRateLimit = 1
+
+// DefaultBurst is the number of requests a client can make at once to shared
+// statistics pages used when Config.Burst is not set
+const DefaultBurst = 10
+
+// Config stores shared statistics pages configuration
+type Config struct {
+	// RateLimit is the number of requests per second a client can make
+	RateLimit float64 `yaml:"rate_limit"`
+	// Burst is the number of requests a client can make at once
+	Burst int `yaml:"burst"`
+}
+
+// ShareHandler represent the http handler for shared URL statistics
+type ShareHandler struct {
+	shareUsecase  domain.ShareUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+	cfg           Config
+}
+
+// NewShareHandler will initialize the url/:id/stats/share resources and
+// public /s/:token endpoint
+func NewShareHandler(su domain.ShareUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer, cfg Config) *ShareHandler {
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = DefaultRateLimit
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultBurst
+	}
+
+	return &ShareHandler{
+		shareUsecase:  su,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+		cfg:           cfg,
+	}
+}
+
+// RegisterRoutes registers routes for a path with matching handler, public
+// shared statistics page is not versioned as its links are given away
+func (sh *ShareHandler) RegisterRoutes(e *echo.Echo) {
+	sh.RegisterAPIRoutes(e.Group("/v1"))
+
+	limiter := middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		IdentifierExtractor: web.ClientIdentifier,
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(sh.cfg.RateLimit),
+			Burst:     sh.cfg.Burst,
+			ExpiresIn: 3 * time.Minute,
+		}),
+	})
+	e.GET("/s/:token", sh.Public, limiter)
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2
+func (sh *ShareHandler) RegisterAPIRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(sh.logger)
+	authenticated := []echo.MiddlewareFunc{echojwt.WithConfig(sh.authenticator.JWTConfig), myMiddl.SpanIdentity("urlid")}
+	g.POST("/url/:id/stats/share", sh.Store, authenticated...)
+	g.DELETE("/url/:id/stats/share/:share_id", sh.Delete, authenticated...)
+}
+
+type shareResponse struct {
+	*domain.Share
+	Token string `json:"token"`
+	// Path is the path of public statistics page
+	Path string `json:"path"`
+}
+
+// Store will share URL statistics, response has token of public statistics
+// page
+func (sh *ShareHandler) Store(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := sh.tracer.Start(
+		ctx,
+		"http Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	err := sh.validator.V.Var(id, "required,max=20,linkid")
+	if err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(sh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	createShare := new(domain.CreateShare)
+	if err = c.Bind(createShare); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err = c.Validate(createShare); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(sh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	share, err := sh.shareUsecase.Store(ctx, id, *createShare, user)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, sh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	shareToken, err := sh.authenticator.GenerateShareToken(auth.NewShareClaims(share.ID.Hex(), share.URLID, share.Panels, share.CreatedAt, share.ExpiresAt))
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("%w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", id),
+		attribute.String("shareid", share.ID.Hex()),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	return web.Respond(c, http.StatusCreated, shareResponse{Share: share, Token: shareToken, Path: "/s/" + shareToken})
+}
+
+// Delete will revoke share of URL statistics
+func (sh *ShareHandler) Delete(c echo.Context) error {
+	id := c.Param("id")
+	shareID := c.Param("share_id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := sh.tracer.Start(
+		ctx,
+		"http Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	err := sh.validator.V.Var(id, "required,max=20,linkid")
+	if err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(sh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	user, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	if err = sh.shareUsecase.Delete(ctx, id, shareID, user); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, sh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", id),
+		attribute.String("shareid", shareID),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Public will show shared URL statistics without authentication, response is
+// HTML page when client accepts it, JSON otherwise
+func (sh *ShareHandler) Public(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := sh.tracer.Start(
+		ctx,
+		"http Public",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// token is the only credential, so it must not leak to other sites or
+	// caches
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set(echo.HeaderReferrerPolicy, "no-referrer")
+	c.Response().Header().Set("X-Robots-Tag", "noindex")
+
+	shareClaims, err := sh.authenticator.ParseShareClaims(c.Param("token"))
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusNotFound, domain.ResponseError{Error: "share was not found"})
+	}
+
+	stats, err := sh.shareUsecase.Stats(ctx, shareClaims.URLID, shareClaims.ID)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, sh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", stats.URLID),
+		attribute.String("shareid", shareClaims.ID),
+	)
+	span.SetStatus(codes.Ok, "success")
+
+	web.SetCoverageHeader(c, stats.Coverage)
+	if web.AcceptsHTML(c.Request()) {
+		return web.RespondHTML(c, http.StatusOK, statsPage, stats)
+	}
+
+	return web.Respond(c, http.StatusOK, stats)
+}
+
+var statsPage = template.Must(template.New("stats").Funcs(i18n.Funcs(i18n.DefaultLocale)).Funcs(template.FuncMap{
+	"days": func() int { return domain.ShareStatsDays },
+}).Parse(`<!DOCTYPE html>
+<html lang="{{locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{t "stats.title" .URLID}}</title>
+</head>
+<body>
+<h1>{{t "stats.title" .URLID}}</h1>
+{{with .Clicks}}<p>{{t "stats.clicks" days .}}</p>{{end}}
+{{if .Days}}<h2>{{t "stats.daily"}}</h2>
+<table>
+<tr><th>{{t "stats.day"}}</th><th>{{t "stats.clicks_column"}}</th></tr>
+{{range $i, $day := .Days}}<tr><td>{{$day}}</td><td>{{index $.Daily $i}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Referrers}}<h2>{{t "stats.referrers"}}</h2>
+<table>
+<tr><th>{{t "stats.referrer"}}</th><th>{{t "stats.clicks_column"}}</th></tr>
+{{range .Referrers}}<tr><td>{{.Referrer}}</td><td>{{.Clicks}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Coverage}}{{if .Partial}}<p>{{t "stats.partial" .Untracked}}</p>
+{{end}}{{end}}<p>{{t "stats.shared_until" (.ExpiresAt.Format "2006-01-02 15:04 MST")}}</p>
+</body>
+</html>
+`))
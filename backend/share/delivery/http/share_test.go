@@ -0,0 +1,304 @@
+package http_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	myMiddl "github.com/semka95/shortener/backend/middleware"
+	shareHttp "github.com/semka95/shortener/backend/share/delivery/http"
+	"github.com/semka95/shortener/backend/share/mock"
+	"github.com/semka95/shortener/backend/tests"
+	urlHttp "github.com/semka95/shortener/backend/url/delivery/http"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type shareStack struct {
+	e             *echo.Echo
+	uc            *mock.MockShareUsecase
+	authenticator *auth.Authenticator
+	claims        *auth.Claims
+	token         string
+}
+
+func newShareStack(t *testing.T, cfg shareHttp.Config) *shareStack {
+	t.Helper()
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+	token, err := authenticator.GenerateToken(claims)
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+	uc := mock.NewMockShareUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	// url handler registers linkid validation
+	_, err = urlHttp.NewURLHandler(nil, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	e.IPExtractor = myMiddl.IPExtractor(nil)
+	e.Use(myMiddl.InitMiddleware(zap.NewNop()).Locale)
+	shareHttp.NewShareHandler(uc, authenticator, v, zap.NewNop(), tracer, cfg).RegisterRoutes(e)
+
+	return &shareStack{e: e, uc: uc, authenticator: authenticator, claims: claims, token: token}
+}
+
+func (s *shareStack) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestShareHTTPStore(t *testing.T) {
+	s := newShareStack(t, shareHttp.Config{})
+	tURL := tests.NewURL()
+	now := time.Now().Truncate(time.Second).UTC()
+
+	post := func(body string, authorized bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/url/"+tURL.ID+"/stats/share", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if authorized {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+s.token)
+		}
+		return s.serve(req)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		share := &domain.Share{
+			ID:        primitive.NewObjectID(),
+			URLID:     tURL.ID,
+			UserID:    tURL.UserID,
+			Panels:    []string{domain.SharePanelClicks},
+			ExpiresAt: now.AddDate(0, 0, 7),
+			CreatedAt: now,
+		}
+		s.uc.EXPECT().Store(gomock.Any(), tURL.ID, domain.CreateShare{Panels: []string{domain.SharePanelClicks}, ExpiresInDays: 7}, s.claims).Return(share, nil)
+
+		rec := post(`{"panels":["clicks"],"expires_in_days":7}`, true)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		body := struct {
+			ID     string   `json:"id"`
+			Panels []string `json:"panels"`
+			Token  string   `json:"token"`
+			Path   string   `json:"path"`
+			UserID string   `json:"user_id"`
+		}{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, share.ID.Hex(), body.ID)
+		assert.Empty(t, body.UserID)
+		assert.Equal(t, "/s/"+body.Token, body.Path)
+
+		shareClaims, err := s.authenticator.ParseShareClaims(body.Token)
+		require.NoError(t, err)
+		assert.Equal(t, share.ID.Hex(), shareClaims.ID)
+		assert.Equal(t, tURL.ID, shareClaims.URLID)
+		assert.Equal(t, share.Panels, shareClaims.Panels)
+		assert.Equal(t, share.ExpiresAt, shareClaims.ExpiresAt.Time.UTC())
+	})
+
+	t.Run("unknown panel", func(t *testing.T) {
+		rec := post(`{"panels":["link"]}`, true)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		s.uc.EXPECT().Store(gomock.Any(), tURL.ID, domain.CreateShare{}, s.claims).Return(nil, domain.ErrForbidden)
+
+		rec := post(`{}`, true)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := post(`{}`, false)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestShareHTTPDelete(t *testing.T) {
+	s := newShareStack(t, shareHttp.Config{})
+	tURL := tests.NewURL()
+	shareID := primitive.NewObjectID().Hex()
+
+	del := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.DELETE, "/v1/url/"+tURL.ID+"/stats/share/"+shareID, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+s.token)
+		return s.serve(req)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		s.uc.EXPECT().Delete(gomock.Any(), tURL.ID, shareID, s.claims).Return(nil)
+
+		rec := del()
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s.uc.EXPECT().Delete(gomock.Any(), tURL.ID, shareID, s.claims).Return(domain.ErrNoAffected)
+
+		rec := del()
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestShareHTTPPublic(t *testing.T) {
+	s := newShareStack(t, shareHttp.Config{RateLimit: 100, Burst: 100})
+	tURL := tests.NewURL()
+	now := time.Now().Truncate(time.Second).UTC()
+	shareID := primitive.NewObjectID().Hex()
+	shareToken, err := s.authenticator.GenerateShareToken(auth.NewShareClaims(shareID, tURL.ID, domain.SharePanels, now, now.Add(time.Hour)))
+	require.NoError(t, err)
+
+	clicks := int64(3)
+	stats := &domain.SharedStats{
+		URLID:     tURL.ID,
+		Panels:    domain.SharePanels,
+		Clicks:    &clicks,
+		Days:      []string{"2023-03-01"},
+		Daily:     []int64{3},
+		Referrers: []*domain.ReferrerStats{{Referrer: "<news>.example.com", Clicks: 3}},
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	get := func(token, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/s/"+token, nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		return s.serve(req)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		s.uc.EXPECT().Stats(gomock.Any(), tURL.ID, shareID).Return(stats, nil)
+
+		rec := get(shareToken, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+		assert.Equal(t, "no-referrer", rec.Header().Get(echo.HeaderReferrerPolicy))
+		body := new(domain.SharedStats)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, stats, body)
+	})
+
+	t.Run("html", func(t *testing.T) {
+		s.uc.EXPECT().Stats(gomock.Any(), tURL.ID, shareID).Return(stats, nil)
+
+		rec := get(shareToken, "text/html,application/xhtml+xml,*/*;q=0.8")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+		body := rec.Body.String()
+		assert.Contains(t, body, "2023-03-01")
+		assert.Contains(t, body, "&lt;news&gt;.example.com")
+		assert.NotContains(t, body, tURL.Link)
+		assert.Contains(t, body, "<title>Statistics of "+tURL.ID+"</title>")
+		assert.NotContains(t, body, "Statistics are partial")
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		partial := *stats
+		partial.Coverage = domain.NewStatsCoverage(domain.AnalyticsStandard, 2)
+		s.uc.EXPECT().Stats(gomock.Any(), tURL.ID, shareID).Return(&partial, nil).Times(2)
+
+		rec := get(shareToken, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "analytics=standard; untracked_clicks=2", rec.Header().Get(web.HeaderXStatsPartial))
+
+		rec = get(shareToken, "text/html")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "2 clicks are counted without details")
+	})
+
+	t.Run("html in locale", func(t *testing.T) {
+		s.uc.EXPECT().Stats(gomock.Any(), tURL.ID, shareID).Return(stats, nil)
+
+		req := httptest.NewRequest(echo.GET, "/s/"+shareToken, nil)
+		req.Header.Set(echo.HeaderAccept, "text/html")
+		req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9")
+		rec := s.serve(req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "ru", rec.Header().Get("Content-Language"))
+		body := rec.Body.String()
+		assert.Contains(t, body, `<html lang="ru">`)
+		assert.Contains(t, body, "<title>Статистика "+tURL.ID+"</title>")
+		assert.Contains(t, body, "Переходов за последние дни (30): 3")
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		s.uc.EXPECT().Stats(gomock.Any(), tURL.ID, shareID).Return(nil, domain.ErrNotFound)
+
+		rec := get(shareToken, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		rec := get("invalid", "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("user token", func(t *testing.T) {
+		rec := get(s.token, "")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("share token is not accepted by API", func(t *testing.T) {
+		req := httptest.NewRequest(echo.DELETE, "/v1/url/"+tURL.ID+"/stats/share/"+shareID, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+shareToken)
+		rec := s.serve(req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestShareHTTPPublicRateLimit(t *testing.T) {
+	s := newShareStack(t, shareHttp.Config{RateLimit: 0.001, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		rec := s.serve(httptest.NewRequest(echo.GET, "/s/invalid", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+
+	rec := s.serve(httptest.NewRequest(echo.GET, "/s/invalid", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func TestShareHTTPPublicRateLimitSpoofedForwardedFor(t *testing.T) {
+	s := newShareStack(t, shareHttp.Config{RateLimit: 0.001, Burst: 2})
+
+	get := func(i int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/s/invalid", nil)
+		req.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", i))
+		return s.serve(req)
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusNotFound, get(i).Code)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, get(2).Code, "forwarded headers of untrusted peer are ignored")
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoShareRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoShareRepository will create an object that represent the share.Repository interface
+func NewMongoShareRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.ShareRepository {
+	return &mongoShareRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoShareRepository) Store(ctx context.Context, share *domain.Share) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", share.URLID)),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.ShareCollection)).InsertOne(ctx, share)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("share store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoShareRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.Share, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository GetByID",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("shareid", id.Hex())),
+	)
+	defer span.End()
+
+	share := new(domain.Share)
+	err := m.Conn.Collection(m.cols.Name(store.ShareCollection)).FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(share)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, fmt.Errorf("share was not found: %w", domain.ErrNotFound)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("share get error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return share, nil
+}
+
+func (m *mongoShareRepository) Delete(ctx context.Context, id primitive.ObjectID, urlID string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("shareid", id.Hex()),
+			attribute.String("urlid", urlID)),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "url_id", Value: urlID},
+	}
+	delRes, err := m.Conn.Collection(m.cols.Name(store.ShareCollection)).DeleteOne(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("share delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	if delRes.DeletedCount == 0 {
+		err = fmt.Errorf("share was not deleted: %w", domain.ErrNoAffected)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
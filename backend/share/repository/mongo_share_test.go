@@ -0,0 +1,152 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/share/repository"
+	"github.com/semka95/shortener/backend/store"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func newShare() *domain.Share {
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	return &domain.Share{
+		ID:        primitive.NewObjectID(),
+		URLID:     "test123",
+		UserID:    "507f191e810c19729de860ea",
+		Panels:    []string{domain.SharePanelClicks},
+		ExpiresAt: now.AddDate(0, 0, domain.DefaultShareDays),
+		CreatedAt: now,
+	}
+}
+
+func TestMongoShareRepository_Store(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tShare := newShare()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tShare)
+
+		require.NoError(mt, err)
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, tShare.URLID, doc.Lookup("url_id").StringValue())
+		assert.Equal(mt, tShare.ExpiresAt.UnixMilli(), int64(doc.Lookup("expires_at").DateTime()))
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tShare)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoShareRepository_GetByID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tShare := newShare()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.share", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: tShare.ID},
+				{Key: "url_id", Value: tShare.URLID},
+				{Key: "user_id", Value: tShare.UserID},
+				{Key: "panels", Value: bson.A{domain.SharePanelClicks}},
+				{Key: "expires_at", Value: tShare.ExpiresAt},
+				{Key: "created_at", Value: tShare.CreatedAt},
+			}),
+			mtest.CreateCursorResponse(0, "test.share", mtest.NextBatch),
+		)
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		share, err := r.GetByID(noopCtx, tShare.ID)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, tShare, share)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.share", mtest.FirstBatch),
+		)
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		share, err := r.GetByID(noopCtx, tShare.ID)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+		assert.Nil(mt, share)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		share, err := r.GetByID(noopCtx, tShare.ID)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, share)
+	})
+}
+
+func TestMongoShareRepository_Delete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tShare := newShare()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 1}})
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tShare.ID, tShare.URLID)
+
+		require.NoError(mt, err)
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, tShare.URLID, filter.Lookup("url_id").StringValue())
+	})
+
+	mt.Run("no document deleted", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 0}})
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tShare.ID, tShare.URLID)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoShareRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tShare.ID, tShare.URLID)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
@@ -0,0 +1,220 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type shareUsecase struct {
+	shareRepo      domain.ShareRepository
+	urlRepo        domain.URLRepository
+	clickRepo      domain.ClickRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	analytics      string
+}
+
+// NewShareUsecase will create new an shareUsecase object representation of domain.ShareUsecase interface,
+// analytics is the analytics mode clicks are recorded in
+func NewShareUsecase(s domain.ShareRepository, u domain.URLRepository, c domain.ClickRepository, timeout time.Duration, tracer trace.Tracer, analytics string) domain.ShareUsecase {
+	return &shareUsecase{
+		shareRepo:      s,
+		urlRepo:        u,
+		clickRepo:      c,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		analytics:      analytics,
+	}
+}
+
+func (uc *shareUsecase) Store(c context.Context, urlID string, createShare domain.CreateShare, user *auth.Claims) (*domain.Share, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Store",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	panels := createShare.Panels
+	if len(panels) == 0 {
+		panels = domain.SharePanels
+	}
+	days := createShare.ExpiresInDays
+	if days == 0 {
+		days = domain.DefaultShareDays
+	}
+
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	share := &domain.Share{
+		ID:        primitive.NewObjectID(),
+		URLID:     urlID,
+		UserID:    user.Subject,
+		Panels:    panels,
+		ExpiresAt: now.AddDate(0, 0, days),
+		CreatedAt: now,
+	}
+
+	if err := uc.shareRepo.Store(ctx, share); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (uc *shareUsecase) Delete(c context.Context, urlID string, id string, user *auth.Claims) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Delete",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID),
+			attribute.String("shareid", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	shareID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = fmt.Errorf("share id is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		span.RecordError(err)
+		return err
+	}
+
+	if err = uc.checkAccess(ctx, urlID, user); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if err = uc.shareRepo.Delete(ctx, shareID, urlID); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (uc *shareUsecase) Stats(c context.Context, urlID string, id string) (*domain.SharedStats, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Stats",
+		trace.WithAttributes(
+			attribute.String("urlid", urlID),
+			attribute.String("shareid", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	shareID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		err = fmt.Errorf("share id is not valid ObjectID: %w: %s", domain.ErrNotFound, err.Error())
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// revoked shares are deleted, expired ones are removed by TTL index
+	// eventually, so expiration is checked as well
+	share, err := uc.shareRepo.GetByID(ctx, shareID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if share.URLID != urlID || !now.Before(share.ExpiresAt) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, fmt.Errorf("share was not found: %w", domain.ErrNotFound)
+	}
+
+	if _, err = uc.urlRepo.GetByID(ctx, urlID, "id"); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("can't get %s url: %w", urlID, err)
+	}
+
+	stats := &domain.SharedStats{
+		URLID:     urlID,
+		Panels:    share.Panels,
+		ExpiresAt: share.ExpiresAt,
+	}
+	from := now.Truncate(24*time.Hour).AddDate(0, 0, 1-domain.ShareStatsDays)
+
+	var untracked *int64
+	if share.HasPanel(domain.SharePanelClicks) || share.HasPanel(domain.SharePanelDaily) {
+		clicks, err := uc.clickRepo.ClickStats(ctx, urlID, from, now)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		untracked = &clicks.Untracked
+		if share.HasPanel(domain.SharePanelClicks) {
+			stats.Clicks = &clicks.Clicks
+		}
+		if share.HasPanel(domain.SharePanelDaily) {
+			stats.Days = make([]string, domain.ShareStatsDays)
+			stats.Daily = make([]int64, domain.ShareStatsDays)
+			for i := range stats.Days {
+				stats.Days[i] = from.AddDate(0, 0, i).Format("2006-01-02")
+				stats.Daily[i] = clicks.Daily[stats.Days[i]]
+			}
+		}
+	}
+
+	if share.HasPanel(domain.SharePanelReferrers) {
+		stats.Referrers, err = uc.clickRepo.TopReferrers(ctx, urlID, from, now, domain.ShareReferrersLimit)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		// untracked clicks have no referrer
+		if untracked == nil {
+			n, err := uc.clickRepo.UntrackedClicks(ctx, urlID, from, now)
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+			untracked = &n
+		}
+	}
+	if untracked != nil {
+		stats.Coverage = domain.NewStatsCoverage(uc.analytics, *untracked)
+	}
+
+	return stats, nil
+}
+
+// checkAccess allows sharing statistics of URL to its owner and admins
+func (uc *shareUsecase) checkAccess(ctx context.Context, urlID string, user *auth.Claims) error {
+	u, err := uc.urlRepo.GetByID(ctx, urlID, "id", "user_id")
+	if err != nil {
+		return fmt.Errorf("can't get %s url: %w", urlID, err)
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && (u.UserID == "" || u.UserID != user.Subject) {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	clickmock "github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/share/mock"
+	"github.com/semka95/shortener/backend/share/usecase"
+	"github.com/semka95/shortener/backend/tests"
+	urlmock "github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+func TestShareUsecase_Store(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockShareRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := usecase.NewShareUsecase(repository, urlRepository, clickmock.NewMockClickRepository(controller), 10*time.Second, tracer, domain.AnalyticsStandard)
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	t.Run("defaults", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		share, err := uc.Store(context.Background(), tURL.ID, domain.CreateShare{}, owner)
+		require.NoError(t, err)
+		assert.False(t, share.ID.IsZero())
+		assert.Equal(t, tURL.ID, share.URLID)
+		assert.Equal(t, owner.Subject, share.UserID)
+		assert.Equal(t, domain.SharePanels, share.Panels)
+		assert.Equal(t, share.CreatedAt.AddDate(0, 0, domain.DefaultShareDays), share.ExpiresAt)
+	})
+
+	t.Run("panels and expiration", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		share, err := uc.Store(context.Background(), tURL.ID, domain.CreateShare{Panels: []string{domain.SharePanelClicks}, ExpiresInDays: 7}, owner)
+		require.NoError(t, err)
+		assert.Equal(t, []string{domain.SharePanelClicks}, share.Panels)
+		assert.Equal(t, share.CreatedAt.AddDate(0, 0, 7), share.ExpiresAt)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		share, err := uc.Store(context.Background(), tURL.ID, domain.CreateShare{}, other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, share)
+	})
+}
+
+func TestShareUsecase_Delete(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockShareRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	uc := usecase.NewShareUsecase(repository, urlRepository, clickmock.NewMockClickRepository(controller), 10*time.Second, tracer, domain.AnalyticsStandard)
+	owner := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	other := auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Minute)
+	shareID := primitive.NewObjectID()
+
+	t.Run("success", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+		repository.EXPECT().Delete(gomock.Any(), shareID, tURL.ID).Return(nil)
+
+		err := uc.Delete(context.Background(), tURL.ID, shareID.Hex(), owner)
+		require.NoError(t, err)
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id", "user_id").Return(tURL, nil)
+
+		err := uc.Delete(context.Background(), tURL.ID, shareID.Hex(), other)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		err := uc.Delete(context.Background(), tURL.ID, "invalid", owner)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+}
+
+func TestShareUsecase_Stats(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockShareRepository(controller)
+	urlRepository := urlmock.NewMockURLRepository(controller)
+	clickRepository := clickmock.NewMockClickRepository(controller)
+	uc := usecase.NewShareUsecase(repository, urlRepository, clickRepository, 10*time.Second, tracer, domain.AnalyticsStandard)
+
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+	newShare := func(panels ...string) *domain.Share {
+		return &domain.Share{
+			ID:        primitive.NewObjectID(),
+			URLID:     tURL.ID,
+			Panels:    panels,
+			ExpiresAt: now.Add(time.Hour),
+		}
+	}
+
+	t.Run("all panels", func(t *testing.T) {
+		share := newShare(domain.SharePanels...)
+		referrers := []*domain.ReferrerStats{{Referrer: "news.example.com", Clicks: 3}}
+		repository.EXPECT().GetByID(gomock.Any(), share.ID).Return(share, nil)
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id").Return(tURL, nil)
+		clickRepository.EXPECT().ClickStats(gomock.Any(), tURL.ID, gomock.Any(), gomock.Any()).Return(&domain.ClickStats{Clicks: 3, Daily: map[string]int64{today: 3}}, nil)
+		clickRepository.EXPECT().TopReferrers(gomock.Any(), tURL.ID, gomock.Any(), gomock.Any(), domain.ShareReferrersLimit).Return(referrers, nil)
+
+		stats, err := uc.Stats(context.Background(), tURL.ID, share.ID.Hex())
+		require.NoError(t, err)
+		require.NotNil(t, stats.Clicks)
+		assert.Equal(t, int64(3), *stats.Clicks)
+		require.Len(t, stats.Days, domain.ShareStatsDays)
+		assert.Equal(t, today, stats.Days[domain.ShareStatsDays-1])
+		assert.Equal(t, int64(3), stats.Daily[domain.ShareStatsDays-1])
+		assert.Equal(t, int64(0), stats.Daily[0])
+		assert.Equal(t, referrers, stats.Referrers)
+		assert.Equal(t, share.ExpiresAt, stats.ExpiresAt)
+		assert.Equal(t, domain.NewStatsCoverage(domain.AnalyticsStandard, 0), stats.Coverage)
+	})
+
+	t.Run("only referrers", func(t *testing.T) {
+		share := newShare(domain.SharePanelReferrers)
+		repository.EXPECT().GetByID(gomock.Any(), share.ID).Return(share, nil)
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id").Return(tURL, nil)
+		clickRepository.EXPECT().TopReferrers(gomock.Any(), tURL.ID, gomock.Any(), gomock.Any(), domain.ShareReferrersLimit).Return([]*domain.ReferrerStats{}, nil)
+		clickRepository.EXPECT().UntrackedClicks(gomock.Any(), tURL.ID, gomock.Any(), gomock.Any()).Return(int64(2), nil)
+
+		stats, err := uc.Stats(context.Background(), tURL.ID, share.ID.Hex())
+		require.NoError(t, err)
+		assert.Nil(t, stats.Clicks)
+		assert.Nil(t, stats.Days)
+		assert.Nil(t, stats.Daily)
+		assert.Equal(t, domain.NewStatsCoverage(domain.AnalyticsStandard, 2), stats.Coverage)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		shareID := primitive.NewObjectID()
+		repository.EXPECT().GetByID(gomock.Any(), shareID).Return(nil, domain.ErrNotFound)
+
+		stats, err := uc.Stats(context.Background(), tURL.ID, shareID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, stats)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		share := newShare(domain.SharePanels...)
+		share.ExpiresAt = now.Add(-time.Minute)
+		repository.EXPECT().GetByID(gomock.Any(), share.ID).Return(share, nil)
+
+		stats, err := uc.Stats(context.Background(), tURL.ID, share.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, stats)
+	})
+
+	t.Run("other url", func(t *testing.T) {
+		share := newShare(domain.SharePanels...)
+		repository.EXPECT().GetByID(gomock.Any(), share.ID).Return(share, nil)
+
+		stats, err := uc.Stats(context.Background(), "other01", share.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, stats)
+	})
+
+	t.Run("url deleted", func(t *testing.T) {
+		share := newShare(domain.SharePanels...)
+		repository.EXPECT().GetByID(gomock.Any(), share.ID).Return(share, nil)
+		urlRepository.EXPECT().GetByID(gomock.Any(), tURL.ID, "id").Return(nil, domain.ErrNotFound)
+
+		stats, err := uc.Stats(context.Background(), tURL.ID, share.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, stats)
+	})
+}
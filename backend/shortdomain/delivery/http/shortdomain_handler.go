@@ -0,0 +1,180 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// ShortDomainHandler represent the http handler for short domains
+type ShortDomainHandler struct {
+	domainUsecase domain.ShortDomainUsecase
+	authenticator *auth.Authenticator
+	validator     *web.AppValidator
+	logger        *zap.Logger
+	tracer        trace.Tracer
+}
+
+// NewShortDomainHandler will initialize the domains resources endpoint
+func NewShortDomainHandler(du domain.ShortDomainUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) *ShortDomainHandler {
+	return &ShortDomainHandler{
+		domainUsecase: du,
+		authenticator: authenticator,
+		validator:     v,
+		logger:        logger,
+		tracer:        tracing.Tracer(tracer),
+	}
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (dh *ShortDomainHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(dh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(dh.authenticator.JWTConfig), myMiddl.SpanIdentity("domain"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.GET("/domains", dh.Fetch, admin...)
+	g.POST("/domains", dh.Store, admin...)
+	g.GET("/domains/stats", dh.Stats, admin...)
+	g.DELETE("/domains/:id", dh.Delete, admin...)
+}
+
+// Fetch will list allowed domains
+func (dh *ShortDomainHandler) Fetch(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := dh.tracer.Start(
+		ctx,
+		"http Fetch",
+	)
+	defer span.End()
+
+	domains, err := dh.domainUsecase.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, dh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	// all domains are listed at once, so total is known without counting
+	total := int64(len(domains))
+	web.SetPageHeaders(c, &total, nil, nil)
+
+	return web.RespondList(c, http.StatusOK, domains, domains, web.Pagination{Count: len(domains), Total: &total})
+}
+
+// Store will allow domain by given request body
+func (dh *ShortDomainHandler) Store(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := dh.tracer.Start(
+		ctx,
+		"http Store",
+	)
+	defer span.End()
+
+	createDomain := new(domain.CreateShortDomain)
+	if err := c.Bind(createDomain); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(createDomain); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(dh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		span.RecordError(domain.ErrForbidden)
+		return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
+	}
+	admin, ok := token.Claims.(*auth.Claims)
+	if !ok {
+		span.RecordError(domain.ErrInternalServerError)
+		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	}
+
+	d, err := dh.domainUsecase.Store(ctx, *createDomain, admin)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, dh.logger), domain.ResponseError{Error: err.Error()})
+	}
+	span.SetAttributes(
+		attribute.String("domain", d.Name),
+	)
+
+	return web.Respond(c, http.StatusCreated, d)
+}
+
+// Delete will disallow domain by given name
+func (dh *ShortDomainHandler) Delete(c echo.Context) error {
+	name := c.Param("id")
+
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := dh.tracer.Start(
+		ctx,
+		"http Delete",
+	)
+	defer span.End()
+
+	if err := dh.domainUsecase.Delete(ctx, name); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, dh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Stats will return totals of every domain, ?days= sets the number of days
+// clicks are counted for
+func (dh *ShortDomainHandler) Stats(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := dh.tracer.Start(
+		ctx,
+		"http Stats",
+	)
+	defer span.End()
+
+	filter := new(domain.DomainStatsFilter)
+	if err := c.Bind(filter); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(filter); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(dh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	stats, err := dh.domainUsecase.Stats(ctx, *filter)
+	if err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, domain.GetStatusCode(err, dh.logger), domain.ResponseError{Error: err.Error()})
+	}
+
+	return web.Respond(c, http.StatusOK, stats)
+}
@@ -0,0 +1,137 @@
+package http_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	shortdomainHttp "github.com/semka95/shortener/backend/shortdomain/delivery/http"
+	"github.com/semka95/shortener/backend/shortdomain/mock"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestShortDomainHTTP(t *testing.T) {
+	tDomain := tests.NewShortDomain()
+	adminClaims := auth.NewClaims(tDomain.CreatedBy, []string{auth.RoleAdmin}, time.Now(), time.Hour)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	adminToken, err := authenticator.GenerateToken(adminClaims)
+	require.NoError(t, err)
+	userToken, err := authenticator.GenerateToken(auth.NewClaims(tDomain.CreatedBy, []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockShortDomainUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler := shortdomainHttp.NewShortDomainHandler(uc, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+
+	e := echo.New()
+	e.Validator = v
+	handler.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	serve := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Store success", func(t *testing.T) {
+		uc.EXPECT().Store(gomock.Any(), domain.CreateShortDomain{Name: "go.example.com"}, gomock.Any()).Return(tDomain, nil)
+
+		rec := serve(echo.POST, "/v1/admin/domains", `{"name":"go.example.com"}`, adminToken)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		body := new(domain.ShortDomain)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, tDomain.Name, body.Name)
+	})
+
+	t.Run("Store already exists", func(t *testing.T) {
+		uc.EXPECT().Store(gomock.Any(), domain.CreateShortDomain{Name: "go.example.com"}, gomock.Any()).Return(nil, domain.ErrConflict)
+
+		rec := serve(echo.POST, "/v1/admin/domains", `{"name":"go.example.com"}`, adminToken)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("Store not valid domain", func(t *testing.T) {
+		rec := serve(echo.POST, "/v1/admin/domains", `{"name":"https://go.example.com"}`, adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Store by user is forbidden", func(t *testing.T) {
+		rec := serve(echo.POST, "/v1/admin/domains", `{"name":"go.example.com"}`, userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Fetch success", func(t *testing.T) {
+		uc.EXPECT().Fetch(gomock.Any()).Return([]*domain.ShortDomain{tDomain}, nil)
+
+		rec := serve(echo.GET, "/v1/admin/domains", "", adminToken)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "1", rec.Header().Get(web.HeaderXTotalCount))
+		var body []*domain.ShortDomain
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		require.Len(t, body, 1)
+		assert.Equal(t, tDomain.Name, body[0].Name)
+	})
+
+	t.Run("Stats success", func(t *testing.T) {
+		stats := []*domain.DomainStats{{Domain: tDomain.Name, Links: 2, ClicksPerDay: map[string]int64{"2026-10-15": 3}, TopLinks: []*domain.LinkClicks{{URLID: "test123", Clicks: 3}}}}
+		uc.EXPECT().Stats(gomock.Any(), domain.DomainStatsFilter{Days: 7}).Return(stats, nil)
+
+		rec := serve(echo.GET, "/v1/admin/domains/stats?days=7", "", adminToken)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body []*domain.DomainStats
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, stats, body)
+	})
+
+	t.Run("Stats not valid days", func(t *testing.T) {
+		rec := serve(echo.GET, "/v1/admin/domains/stats?days=365", "", adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	casesDelete := []struct {
+		description string
+		err         error
+		code        int
+	}{
+		{"Delete success", nil, http.StatusNoContent},
+		{"Delete not found", domain.ErrNoAffected, http.StatusNotFound},
+	}
+
+	for _, tc := range casesDelete {
+		t.Run(tc.description, func(t *testing.T) {
+			uc.EXPECT().Delete(gomock.Any(), tDomain.Name).Return(tc.err)
+
+			rec := serve(echo.DELETE, "/v1/admin/domains/"+tDomain.Name, "", adminToken)
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+type mongoShortDomainRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	logger *zap.Logger
+	tracer trace.Tracer
+}
+
+// NewMongoShortDomainRepository will create an object that represent the
+// domain.ShortDomainRepository interface
+func NewMongoShortDomainRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.ShortDomainRepository {
+	return &mongoShortDomainRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		logger: logger,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoShortDomainRepository) Fetch(ctx context.Context) ([]*domain.ShortDomain, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	opts := options.Find().SetSort(bson.D{primitive.E{Key: "_id", Value: 1}})
+	cur, err := m.Conn.Collection(m.cols.Name(store.DomainCollection)).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("domain fetch error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]*domain.ShortDomain, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("domain cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+func (m *mongoShortDomainRepository) Store(ctx context.Context, d *domain.ShortDomain) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("domain", d.Name)),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.DomainCollection)).InsertOne(ctx, d)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return fmt.Errorf("domain %s already exists: %w", d.Name, domain.ErrConflict)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("domain store error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return nil
+}
+
+func (m *mongoShortDomainRepository) Delete(ctx context.Context, name string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("domain", name)),
+	)
+	defer span.End()
+
+	delRes, err := m.Conn.Collection(m.cols.Name(store.DomainCollection)).DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: name}})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("domain delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	if delRes.DeletedCount == 0 {
+		err = fmt.Errorf("domain was not deleted: %w", domain.ErrNoAffected)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// Stats counts URLs grouped by domain field, clicks are read from hourly
+// rollups joined with their URLs, clicks of deleted URLs are not counted
+func (m *mongoShortDomainRepository) Stats(ctx context.Context, from time.Time, top int) ([]*domain.DomainStats, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Stats",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	links, err := m.countLinks(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	clicks, err := m.countClicks(ctx, from, top)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	byDomain := make(map[string]*domain.DomainStats)
+	stats := func(name string) *domain.DomainStats {
+		s, ok := byDomain[name]
+		if !ok {
+			s = &domain.DomainStats{Domain: name, LinksBySource: make(map[string]int64), ClicksPerDay: make(map[string]int64), TopLinks: make([]*domain.LinkClicks, 0)}
+			byDomain[name] = s
+		}
+		return s
+	}
+	for _, l := range links {
+		s := stats(l.ID.Domain)
+		s.Links += l.Links
+		s.LinksBySource[l.ID.Source] = l.Links
+	}
+	if len(clicks) > 0 {
+		for _, d := range clicks[0].Daily {
+			stats(d.ID.Domain).ClicksPerDay[d.ID.Day] = d.Clicks
+		}
+		for _, t := range clicks[0].Top {
+			stats(t.Domain).TopLinks = t.Links
+		}
+	}
+
+	result := make([]*domain.DomainStats, 0, len(byDomain))
+	for _, s := range byDomain {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Domain < result[j].Domain })
+
+	return result, nil
+}
+
+type domainLinks struct {
+	ID struct {
+		Domain string `bson:"domain"`
+		Source string `bson:"source"`
+	} `bson:"_id"`
+	Links int64 `bson:"links"`
+}
+
+func (m *mongoShortDomainRepository) countLinks(ctx context.Context) ([]domainLinks, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{
+				primitive.E{Key: "domain", Value: bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$domain", ""}}}},
+				// URLs created before sources were stored have no source
+				primitive.E{Key: "source", Value: bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$source", domain.URLSourceUnknown}}}},
+			}},
+			primitive.E{Key: "links", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("domain link count error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]domainLinks, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("domain link count cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
+
+type domainClicks struct {
+	Daily []struct {
+		ID struct {
+			Domain string `bson:"domain"`
+			Day    string `bson:"day"`
+		} `bson:"_id"`
+		Clicks int64 `bson:"clicks"`
+	} `bson:"daily"`
+	Top []struct {
+		Domain string               `bson:"_id"`
+		Links  []*domain.LinkClicks `bson:"links"`
+	} `bson:"top"`
+}
+
+func (m *mongoShortDomainRepository) countClicks(ctx context.Context, from time.Time, top int) ([]domainClicks, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "hour", Value: bson.D{primitive.E{Key: "$gte", Value: from.UTC().Truncate(time.Hour)}}},
+		}}},
+		// rollups are combined by day before they are joined with URLs
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{
+				primitive.E{Key: "url_id", Value: "$url_id"},
+				primitive.E{Key: "day", Value: bson.D{primitive.E{Key: "$dateToString", Value: bson.D{
+					primitive.E{Key: "format", Value: "%Y-%m-%d"},
+					primitive.E{Key: "date", Value: "$hour"},
+				}}}},
+			}},
+			primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: "$clicks"}}},
+		}}},
+		bson.D{primitive.E{Key: "$lookup", Value: bson.D{
+			primitive.E{Key: "from", Value: m.cols.Name(store.URLCollection)},
+			primitive.E{Key: "localField", Value: "_id.url_id"},
+			primitive.E{Key: "foreignField", Value: "_id"},
+			primitive.E{Key: "as", Value: "url"},
+		}}},
+		bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "url", Value: bson.D{primitive.E{Key: "$ne", Value: bson.A{}}}}}}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{
+			primitive.E{Key: "_id", Value: 0},
+			primitive.E{Key: "url_id", Value: "$_id.url_id"},
+			primitive.E{Key: "day", Value: "$_id.day"},
+			primitive.E{Key: "clicks", Value: 1},
+			primitive.E{Key: "domain", Value: bson.D{primitive.E{Key: "$ifNull", Value: bson.A{
+				bson.D{primitive.E{Key: "$arrayElemAt", Value: bson.A{"$url.domain", 0}}}, "",
+			}}}},
+		}}},
+		bson.D{primitive.E{Key: "$facet", Value: bson.D{
+			primitive.E{Key: "daily", Value: bson.A{
+				bson.D{primitive.E{Key: "$group", Value: bson.D{
+					primitive.E{Key: "_id", Value: bson.D{
+						primitive.E{Key: "domain", Value: "$domain"},
+						primitive.E{Key: "day", Value: "$day"},
+					}},
+					primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: "$clicks"}}},
+				}}},
+			}},
+			primitive.E{Key: "top", Value: bson.A{
+				bson.D{primitive.E{Key: "$group", Value: bson.D{
+					primitive.E{Key: "_id", Value: bson.D{
+						primitive.E{Key: "domain", Value: "$domain"},
+						primitive.E{Key: "url_id", Value: "$url_id"},
+					}},
+					primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$sum", Value: "$clicks"}}},
+				}}},
+				bson.D{primitive.E{Key: "$sort", Value: bson.D{
+					primitive.E{Key: "clicks", Value: -1},
+					primitive.E{Key: "_id.url_id", Value: 1},
+				}}},
+				bson.D{primitive.E{Key: "$group", Value: bson.D{
+					primitive.E{Key: "_id", Value: "$_id.domain"},
+					primitive.E{Key: "links", Value: bson.D{primitive.E{Key: "$push", Value: bson.D{
+						primitive.E{Key: "url_id", Value: "$_id.url_id"},
+						primitive.E{Key: "clicks", Value: "$clicks"},
+					}}}},
+				}}},
+				bson.D{primitive.E{Key: "$project", Value: bson.D{
+					primitive.E{Key: "links", Value: bson.D{primitive.E{Key: "$slice", Value: bson.A{"$links", top}}}},
+				}}},
+			}},
+		}}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.ClickRollupCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("domain click count error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	result := make([]domainClicks, 0, 1)
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("domain click count cursor error: %w: %s", domain.ErrInternalServerError, err.Error())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,173 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/shortdomain/repository"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+var noopCtx = context.Background()
+
+func TestMongoShortDomainRepository_Fetch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tDomain := tests.NewShortDomain()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "test.domain", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: tDomain.Name},
+				{Key: "created_by", Value: tDomain.CreatedBy},
+				{Key: "created_at", Value: tDomain.CreatedAt},
+			}),
+			mtest.CreateCursorResponse(0, "test.domain", mtest.NextBatch),
+		)
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		domains, err := r.Fetch(noopCtx)
+
+		require.NoError(mt, err)
+		require.Len(mt, domains, 1)
+		assert.EqualValues(mt, tDomain, domains[0])
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		domains, err := r.Fetch(noopCtx)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, domains)
+	})
+}
+
+func TestMongoShortDomainRepository_Store(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tDomain := tests.NewShortDomain()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tDomain)
+
+		require.NoError(mt, err)
+	})
+
+	mt.Run("duplicate domain", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tDomain)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+	})
+}
+
+func TestMongoShortDomainRepository_Delete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tDomain := tests.NewShortDomain()
+
+	mt.Run("not found", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "acknowledged", Value: true},
+			{Key: "n", Value: 0},
+		})
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tDomain.Name)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "acknowledged", Value: true},
+			{Key: "n", Value: 1},
+		})
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Delete(noopCtx, tDomain.Name)
+
+		require.NoError(mt, err)
+	})
+}
+
+func TestMongoShortDomainRepository_Stats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.url", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: bson.D{{Key: "domain", Value: ""}, {Key: "source", Value: "web"}}}, {Key: "links", Value: int64(4)}},
+				bson.D{{Key: "_id", Value: bson.D{{Key: "domain", Value: ""}, {Key: "source", Value: "unknown"}}}, {Key: "links", Value: int64(1)}},
+				bson.D{{Key: "_id", Value: bson.D{{Key: "domain", Value: "go.example.com"}, {Key: "source", Value: "api"}}}, {Key: "links", Value: int64(2)}},
+			),
+			mtest.CreateCursorResponse(0, "test.click_rollup", mtest.FirstBatch, bson.D{
+				{Key: "daily", Value: bson.A{
+					bson.D{{Key: "_id", Value: bson.D{{Key: "domain", Value: "go.example.com"}, {Key: "day", Value: "2026-10-14"}}}, {Key: "clicks", Value: int64(3)}},
+					bson.D{{Key: "_id", Value: bson.D{{Key: "domain", Value: "go.example.com"}, {Key: "day", Value: "2026-10-15"}}}, {Key: "clicks", Value: int64(4)}},
+				}},
+				{Key: "top", Value: bson.A{
+					bson.D{{Key: "_id", Value: "go.example.com"}, {Key: "links", Value: bson.A{
+						bson.D{{Key: "url_id", Value: "test123"}, {Key: "clicks", Value: int64(6)}},
+						bson.D{{Key: "url_id", Value: "test456"}, {Key: "clicks", Value: int64(1)}},
+					}}},
+				}},
+			}),
+		)
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.Stats(noopCtx, time.Now().AddDate(0, 0, -30), 10)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []*domain.DomainStats{
+			{Domain: "", Links: 5, LinksBySource: map[string]int64{"web": 4, "unknown": 1}, ClicksPerDay: map[string]int64{}, TopLinks: []*domain.LinkClicks{}},
+			{
+				Domain:        "go.example.com",
+				Links:         2,
+				LinksBySource: map[string]int64{"api": 2},
+				ClicksPerDay:  map[string]int64{"2026-10-14": 3, "2026-10-15": 4},
+				TopLinks:      []*domain.LinkClicks{{URLID: "test123", Clicks: 6}, {URLID: "test456", Clicks: 1}},
+			},
+		}, stats)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoShortDomainRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.Stats(noopCtx, time.Now(), 10)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, stats)
+	})
+}
@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// topLinks is the number of top links listed in statistics of every domain
+const topLinks = 10
+
+type shortDomainUsecase struct {
+	domainRepo     domain.ShortDomainRepository
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+}
+
+// NewShortDomainUsecase will create new an shortDomainUsecase object representation of domain.ShortDomainUsecase interface.
+// Domains are read from repository on every check, so domains added by any
+// instance are allowed right away.
+func NewShortDomainUsecase(d domain.ShortDomainRepository, timeout time.Duration, tracer trace.Tracer) domain.ShortDomainUsecase {
+	return &shortDomainUsecase{
+		domainRepo:     d,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+	}
+}
+
+func (uc *shortDomainUsecase) Fetch(c context.Context) ([]*domain.ShortDomain, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	domains, err := uc.domainRepo.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+func (uc *shortDomainUsecase) Store(c context.Context, createDomain domain.CreateShortDomain, admin *auth.Claims) (*domain.ShortDomain, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Store",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	d := &domain.ShortDomain{
+		Name:      domain.NormalizeDomain(createDomain.Name),
+		CreatedBy: admin.Subject,
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	span.SetAttributes(attribute.String("domain", d.Name))
+
+	if err := uc.domainRepo.Store(ctx, d); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Delete stops domain from being used for new URLs, URLs created on it keep
+// the domain
+func (uc *shortDomainUsecase) Delete(c context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	name = domain.NormalizeDomain(name)
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Delete",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("domain", name)),
+	)
+	defer span.End()
+
+	if err := uc.domainRepo.Delete(ctx, name); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (uc *shortDomainUsecase) CheckDomain(c context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	name = domain.NormalizeDomain(name)
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase CheckDomain",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("domain", name)),
+	)
+	defer span.End()
+
+	domains, err := uc.domainRepo.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("can't check %s domain: %w", name, err)
+	}
+
+	allowed := make([]string, 0, len(domains))
+	for _, d := range domains {
+		if d.Name == name {
+			return nil
+		}
+		allowed = append(allowed, d.Name)
+	}
+
+	err = &domain.UnknownDomainError{Domain: name, Allowed: allowed}
+	span.RecordError(err)
+	return err
+}
+
+// Stats lists the default domain first and allowed domains without URLs with
+// zero totals
+func (uc *shortDomainUsecase) Stats(c context.Context, filter domain.DomainStatsFilter) ([]*domain.DomainStats, error) {
+	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Stats",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if filter.Days <= 0 {
+		filter.Days = domain.DefaultDomainStatsDays
+	}
+	// today is counted as one of the days
+	from := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-filter.Days)
+
+	domains, err := uc.domainRepo.Fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	stats, err := uc.domainRepo.Stats(ctx, from, topLinks)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(stats))
+	for _, s := range stats {
+		found[s.Domain] = true
+	}
+	for _, name := range append([]string{""}, domainNames(domains)...) {
+		if !found[name] {
+			stats = append(stats, &domain.DomainStats{Domain: name, LinksBySource: make(map[string]int64), ClicksPerDay: make(map[string]int64), TopLinks: make([]*domain.LinkClicks, 0)})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Domain < stats[j].Domain })
+
+	return stats, nil
+}
+
+func domainNames(domains []*domain.ShortDomain) []string {
+	names := make([]string, 0, len(domains))
+	for _, d := range domains {
+		names = append(names, d.Name)
+	}
+	return names
+}
@@ -0,0 +1,110 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/shortdomain/mock"
+	"github.com/semka95/shortener/backend/shortdomain/usecase"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+var tracer = sdktrace.NewTracerProvider().Tracer("")
+
+func TestShortDomainUsecase_Store(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockShortDomainRepository(controller)
+	uc := usecase.NewShortDomainUsecase(repository, 10*time.Second, tracer)
+	admin := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+
+	t.Run("name is normalized", func(t *testing.T) {
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, d *domain.ShortDomain) error {
+			assert.Equal(t, "go.example.com", d.Name)
+			assert.Equal(t, admin.Subject, d.CreatedBy)
+			return nil
+		})
+
+		d, err := uc.Store(context.Background(), domain.CreateShortDomain{Name: "Go.Example.com."}, admin)
+		require.NoError(t, err)
+		assert.Equal(t, "go.example.com", d.Name)
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(domain.ErrConflict)
+
+		d, err := uc.Store(context.Background(), domain.CreateShortDomain{Name: "go.example.com"}, admin)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, d)
+	})
+}
+
+func TestShortDomainUsecase_CheckDomain(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockShortDomainRepository(controller)
+	uc := usecase.NewShortDomainUsecase(repository, 10*time.Second, tracer)
+	other := tests.NewShortDomain()
+	other.Name = "s.example.org"
+	domains := []*domain.ShortDomain{tests.NewShortDomain(), other}
+
+	t.Run("default domain", func(t *testing.T) {
+		require.NoError(t, uc.CheckDomain(context.Background(), ""))
+	})
+
+	t.Run("allowed domain", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any()).Return(domains, nil)
+		require.NoError(t, uc.CheckDomain(context.Background(), "GO.example.com"))
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any()).Return(domains, nil)
+
+		err := uc.CheckDomain(context.Background(), "evil.example.net")
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		var domainErr *domain.UnknownDomainError
+		require.True(t, errors.As(err, &domainErr))
+		assert.Equal(t, "domain must be one of go.example.com, s.example.org", domainErr.Field())
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any()).Return(nil, domain.ErrInternalServerError)
+		assert.ErrorIs(t, uc.CheckDomain(context.Background(), "go.example.com"), domain.ErrInternalServerError)
+	})
+}
+
+func TestShortDomainUsecase_Stats(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockShortDomainRepository(controller)
+	uc := usecase.NewShortDomainUsecase(repository, 10*time.Second, tracer)
+	unused := tests.NewShortDomain()
+	unused.Name = "unused.example.org"
+
+	found := &domain.DomainStats{Domain: "go.example.com", Links: 2, ClicksPerDay: map[string]int64{"2026-10-15": 1}, TopLinks: []*domain.LinkClicks{{URLID: "test123", Clicks: 1}}}
+	repository.EXPECT().Fetch(gomock.Any()).Return([]*domain.ShortDomain{tests.NewShortDomain(), unused}, nil)
+	repository.EXPECT().Stats(gomock.Any(), gomock.Any(), 10).DoAndReturn(func(_ context.Context, from time.Time, _ int) ([]*domain.DomainStats, error) {
+		// today is the seventh day
+		assert.Equal(t, time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -6), from)
+		return []*domain.DomainStats{found}, nil
+	})
+
+	stats, err := uc.Stats(context.Background(), domain.DomainStatsFilter{Days: 7})
+	require.NoError(t, err)
+	empty := func(name string) *domain.DomainStats {
+		return &domain.DomainStats{Domain: name, LinksBySource: map[string]int64{}, ClicksPerDay: map[string]int64{}, TopLinks: []*domain.LinkClicks{}}
+	}
+	assert.Equal(t, []*domain.DomainStats{empty(""), found, empty(unused.Name)}, stats)
+}
@@ -0,0 +1,396 @@
+// Package smoketest checks deployed service end to end: it creates anonymous
+// URL, follows its redirect, fetches and deletes it as admin and checks status
+// endpoints. URL it creates is deleted even when checks fail.
+package smoketest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/pow"
+)
+
+// DefaultLink is the link of created URL used when Config.Link is not set
+const DefaultLink = "https://example.com/"
+
+// DefaultTimeout is the timeout of every request used when Config.Timeout is
+// not set
+const DefaultTimeout = 10 * time.Second
+
+// Names of steps
+const (
+	StepStatus   = "status"
+	StepVersion  = "version"
+	StepLogin    = "login"
+	StepCreate   = "create"
+	StepRedirect = "redirect"
+	StepFetch    = "fetch"
+	StepDelete   = "delete"
+	StepCleanup  = "cleanup"
+)
+
+// Results of steps
+const (
+	ResultPass = "pass"
+	ResultFail = "fail"
+	ResultSkip = "skip"
+)
+
+// Config stores smoke test configuration. Admin token is used when it is set,
+// otherwise admin logs in with Email and Password.
+type Config struct {
+	BaseURL  string
+	Email    string
+	Password string
+	Token    string
+	// Link is the link of created URL, it must pass blocklist and spam
+	// checks of the service
+	Link    string
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// StepResult represents result of step, Error is set for failed steps
+type StepResult struct {
+	Name       string `json:"name"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report represents results of all steps, it passes when no step failed
+type Report struct {
+	BaseURL string       `json:"base_url"`
+	Passed  bool         `json:"passed"`
+	Steps   []StepResult `json:"steps"`
+}
+
+// WriteText writes result of every step on its own line
+func (r *Report) WriteText(w io.Writer) error {
+	for _, s := range r.Steps {
+		line := fmt.Sprintf("%-4s %-8s %dms", strings.ToUpper(s.Result), s.Name, s.DurationMS)
+		if s.Error != "" {
+			line += " " + s.Error
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	result := "PASS"
+	if !r.Passed {
+		result = "FAIL"
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", result, r.BaseURL)
+	return err
+}
+
+// WriteJSON writes report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type runner struct {
+	cfg    Config
+	client *http.Client
+	report *Report
+	token  string
+	url    *domain.URL
+}
+
+// Run runs all steps, steps depending on failed one are skipped. Created URL
+// is deleted by cleanup step when delete step didn't delete it.
+func Run(ctx context.Context, cfg Config) *Report {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Link == "" {
+		cfg.Link = DefaultLink
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	// redirect is checked, not followed
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	r := &runner{
+		cfg:    cfg,
+		client: &noRedirect,
+		report: &Report{BaseURL: cfg.BaseURL, Passed: true},
+	}
+
+	r.step(ctx, StepStatus, r.status)
+	r.step(ctx, StepVersion, r.version)
+
+	// URL is created only when admin can delete it
+	steps := []struct {
+		name string
+		fn   func(context.Context) error
+	}{
+		{StepLogin, r.login},
+		{StepCreate, r.create},
+		{StepRedirect, r.redirect},
+		{StepFetch, r.fetch},
+		{StepDelete, r.delete},
+	}
+	failed := false
+	for _, s := range steps {
+		if failed {
+			r.skip(s.name)
+			continue
+		}
+		failed = !r.step(ctx, s.name, s.fn)
+	}
+
+	if r.url != nil {
+		// cleanup runs even when ctx is canceled
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+		r.step(cleanupCtx, StepCleanup, r.delete)
+	}
+
+	return r.report
+}
+
+// step runs fn and records its result, it reports whether fn passed
+func (r *runner) step(ctx context.Context, name string, fn func(context.Context) error) bool {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(ctx)
+	res := StepResult{Name: name, Result: ResultPass, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Result = ResultFail
+		res.Error = err.Error()
+		r.report.Passed = false
+	}
+	r.report.Steps = append(r.report.Steps, res)
+
+	return err == nil
+}
+
+func (r *runner) skip(name string) {
+	r.report.Steps = append(r.report.Steps, StepResult{Name: name, Result: ResultSkip})
+}
+
+func (r *runner) status(ctx context.Context) error {
+	_, err := r.do(ctx, http.MethodGet, "/v1/status", nil, nil, http.StatusOK)
+	return err
+}
+
+func (r *runner) version(ctx context.Context) error {
+	_, err := r.do(ctx, http.MethodGet, "/version", nil, nil, http.StatusOK)
+	return err
+}
+
+func (r *runner) login(ctx context.Context) error {
+	if r.cfg.Token != "" {
+		r.token = r.cfg.Token
+		return nil
+	}
+	if r.cfg.Email == "" || r.cfg.Password == "" {
+		return errors.New("admin token or email and password are required to delete created URL")
+	}
+
+	req, err := r.newRequest(ctx, http.MethodGet, "/v1/user/token", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.cfg.Email, r.cfg.Password)
+	body, err := r.send(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	if err = json.Unmarshal(body, &tkn); err != nil {
+		return fmt.Errorf("can't decode token: %w", err)
+	}
+	r.token = tkn.Token
+	return nil
+}
+
+// create creates anonymous URL, proof-of-work challenge is solved when the
+// service requires it
+func (r *runner) create(ctx context.Context) error {
+	payload, err := json.Marshal(domain.CreateURL{Link: r.cfg.Link})
+	if err != nil {
+		return err
+	}
+
+	body, err := r.do(ctx, http.MethodPost, "/v1/url/create", payload, nil, http.StatusCreated)
+	var challengeErr *statusError
+	if errors.As(err, &challengeErr) && challengeErr.code == domain.ErrCodeChallengeRequired {
+		header, cerr := r.solveChallenge(ctx)
+		if cerr != nil {
+			return cerr
+		}
+		body, err = r.do(ctx, http.MethodPost, "/v1/url/create", payload, header, http.StatusCreated)
+	}
+	if err != nil {
+		return err
+	}
+
+	u := new(domain.URL)
+	if err = json.Unmarshal(body, u); err != nil {
+		return fmt.Errorf("can't decode created URL: %w", err)
+	}
+	if u.ID == "" {
+		return errors.New("created URL has no id")
+	}
+	r.url = u
+	return nil
+}
+
+func (r *runner) solveChallenge(ctx context.Context) (http.Header, error) {
+	body, err := r.do(ctx, http.MethodGet, "/v1/url/challenge", nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	ch := pow.Challenge{}
+	if err = json.Unmarshal(body, &ch); err != nil {
+		return nil, fmt.Errorf("can't decode challenge: %w", err)
+	}
+	if ch.Difficulty > pow.MaxDifficulty {
+		return nil, fmt.Errorf("challenge difficulty %d can't be solved", ch.Difficulty)
+	}
+
+	header := http.Header{}
+	header.Set(pow.HeaderChallenge, ch.ID)
+	header.Set(pow.HeaderNonce, pow.Solve(ch))
+	return header, nil
+}
+
+func (r *runner) redirect(ctx context.Context) error {
+	req, err := r.newRequest(ctx, http.MethodGet, "/"+r.url.ID, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return fmt.Errorf("expected redirect, got %d status", resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); location != r.url.Link {
+		return fmt.Errorf("redirected to %q instead of %q", location, r.url.Link)
+	}
+	return nil
+}
+
+func (r *runner) fetch(ctx context.Context) error {
+	body, err := r.do(ctx, http.MethodGet, "/v1/url/"+r.url.ID, nil, r.authorization(), http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	u := new(domain.URL)
+	if err = json.Unmarshal(body, u); err != nil {
+		return fmt.Errorf("can't decode URL: %w", err)
+	}
+	if u.ID != r.url.ID || u.Link != r.url.Link {
+		return fmt.Errorf("fetched URL %s with %q link differs from created one", u.ID, u.Link)
+	}
+	return nil
+}
+
+// delete deletes created URL, it is forgotten once deleted, so cleanup
+// doesn't delete it again
+func (r *runner) delete(ctx context.Context) error {
+	if r.token == "" {
+		return errors.New("no admin token to delete created URL " + r.url.ID)
+	}
+	if _, err := r.do(ctx, http.MethodDelete, "/v1/url/"+r.url.ID, nil, r.authorization(), http.StatusNoContent); err != nil {
+		return err
+	}
+	r.url = nil
+	return nil
+}
+
+func (r *runner) authorization() http.Header {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+r.token)
+	return header
+}
+
+// statusError is returned for responses of unexpected status, code is the
+// code of response error if any
+type statusError struct {
+	status int
+	code   string
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected %d status: %s", e.status, e.body)
+}
+
+// do sends request and returns body of response with expected status
+func (r *runner) do(ctx context.Context, method, path string, body []byte, header http.Header, status int) ([]byte, error) {
+	req, err := r.newRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return r.send(req, status)
+}
+
+func (r *runner) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.cfg.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func (r *runner) send(req *http.Request, status int) ([]byte, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("can't read response: %w", err)
+	}
+	if resp.StatusCode != status {
+		serr := &statusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+		var respErr domain.ResponseError
+		if json.Unmarshal(body, &respErr) == nil {
+			serr.code = respErr.Code
+		}
+		return nil, serr
+	}
+	return body, nil
+}
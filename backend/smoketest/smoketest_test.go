@@ -0,0 +1,196 @@
+package smoketest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/pow"
+	"github.com/semka95/shortener/backend/smoketest"
+)
+
+// fakeService serves the endpoints smoke test uses, failing endpoint
+// responds with 500
+type fakeService struct {
+	mu        sync.Mutex
+	urls      map[string]string
+	challenge bool
+	failing   string
+}
+
+func (f *fakeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	route := r.Method + " " + r.URL.Path
+	if strings.HasPrefix(r.URL.Path, "/v1/url/") && r.URL.Path != "/v1/url/create" && r.URL.Path != "/v1/url/challenge" {
+		route = r.Method + " /v1/url/:id"
+	} else if !strings.HasPrefix(r.URL.Path, "/v1/") && r.URL.Path != "/version" {
+		route = r.Method + " /:id"
+	}
+	if route == f.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	admin := r.Header.Get("Authorization") == "Bearer admin-token"
+
+	switch route {
+	case "GET /v1/status", "GET /version":
+		w.WriteHeader(http.StatusOK)
+	case "GET /v1/user/token":
+		if email, password, _ := r.BasicAuth(); email != "admin@example.com" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "admin-token"})
+	case "GET /v1/url/challenge":
+		_ = json.NewEncoder(w).Encode(pow.Challenge{ID: "challenge", Difficulty: 4})
+	case "POST /v1/url/create":
+		if f.challenge && !pow.Solves(r.Header.Get(pow.HeaderChallenge), r.Header.Get(pow.HeaderNonce), 4) {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(domain.ResponseError{Error: "challenge is not solved", Code: domain.ErrCodeChallengeRequired})
+			return
+		}
+		cu := domain.CreateURL{}
+		_ = json.NewDecoder(r.Body).Decode(&cu)
+		f.urls["abcdefg"] = cu.Link
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(domain.URL{ID: "abcdefg", Link: cu.Link})
+	case "GET /:id":
+		link, ok := f.urls[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, link, http.StatusMovedPermanently)
+	case "GET /v1/url/:id", "DELETE /v1/url/:id":
+		id := strings.TrimPrefix(r.URL.Path, "/v1/url/")
+		link, ok := f.urls[id]
+		switch {
+		case !admin:
+			w.WriteHeader(http.StatusUnauthorized)
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodDelete:
+			delete(f.urls, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			_ = json.NewEncoder(w).Encode(domain.URL{ID: id, Link: link})
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func results(r *smoketest.Report) map[string]string {
+	res := make(map[string]string, len(r.Steps))
+	for _, s := range r.Steps {
+		res[s.Name] = s.Result
+	}
+	return res
+}
+
+func TestRun(t *testing.T) {
+	newService := func() (*fakeService, *httptest.Server) {
+		f := &fakeService{urls: make(map[string]string)}
+		srv := httptest.NewServer(f)
+		t.Cleanup(srv.Close)
+		return f, srv
+	}
+	cfg := func(srv *httptest.Server) smoketest.Config {
+		return smoketest.Config{BaseURL: srv.URL + "/", Email: "admin@example.com", Password: "password", Client: srv.Client()}
+	}
+
+	t.Run("pass", func(t *testing.T) {
+		f, srv := newService()
+		f.challenge = true
+
+		report := smoketest.Run(context.Background(), cfg(srv))
+		assert.True(t, report.Passed, report.Steps)
+		assert.Equal(t, map[string]string{
+			smoketest.StepStatus:   smoketest.ResultPass,
+			smoketest.StepVersion:  smoketest.ResultPass,
+			smoketest.StepLogin:    smoketest.ResultPass,
+			smoketest.StepCreate:   smoketest.ResultPass,
+			smoketest.StepRedirect: smoketest.ResultPass,
+			smoketest.StepFetch:    smoketest.ResultPass,
+			smoketest.StepDelete:   smoketest.ResultPass,
+		}, results(report))
+		assert.Empty(t, f.urls)
+	})
+
+	t.Run("cleanup after failure", func(t *testing.T) {
+		f, srv := newService()
+		f.failing = "GET /:id"
+
+		report := smoketest.Run(context.Background(), cfg(srv))
+		assert.False(t, report.Passed)
+		assert.Equal(t, map[string]string{
+			smoketest.StepStatus:   smoketest.ResultPass,
+			smoketest.StepVersion:  smoketest.ResultPass,
+			smoketest.StepLogin:    smoketest.ResultPass,
+			smoketest.StepCreate:   smoketest.ResultPass,
+			smoketest.StepRedirect: smoketest.ResultFail,
+			smoketest.StepFetch:    smoketest.ResultSkip,
+			smoketest.StepDelete:   smoketest.ResultSkip,
+			smoketest.StepCleanup:  smoketest.ResultPass,
+		}, results(report))
+		assert.Empty(t, f.urls)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		f, srv := newService()
+		c := cfg(srv)
+		c.Email, c.Password = "", ""
+
+		report := smoketest.Run(context.Background(), c)
+		assert.False(t, report.Passed)
+		res := results(report)
+		assert.Equal(t, smoketest.ResultFail, res[smoketest.StepLogin])
+		assert.Equal(t, smoketest.ResultSkip, res[smoketest.StepCreate])
+		assert.NotContains(t, res, smoketest.StepCleanup)
+		assert.Empty(t, f.urls)
+	})
+
+	t.Run("token", func(t *testing.T) {
+		_, srv := newService()
+		c := cfg(srv)
+		c.Email, c.Password, c.Token = "", "", "admin-token"
+
+		report := smoketest.Run(context.Background(), c)
+		assert.True(t, report.Passed, report.Steps)
+	})
+
+	t.Run("status down", func(t *testing.T) {
+		f, srv := newService()
+		f.failing = "GET /v1/status"
+
+		report := smoketest.Run(context.Background(), cfg(srv))
+		assert.False(t, report.Passed)
+		res := results(report)
+		assert.Equal(t, smoketest.ResultFail, res[smoketest.StepStatus])
+		assert.Equal(t, smoketest.ResultPass, res[smoketest.StepDelete])
+	})
+
+	t.Run("json report", func(t *testing.T) {
+		f, srv := newService()
+		f.failing = "GET /version"
+
+		var buf bytes.Buffer
+		require.NoError(t, smoketest.Run(context.Background(), cfg(srv)).WriteJSON(&buf))
+		report := new(smoketest.Report)
+		require.NoError(t, json.Unmarshal(buf.Bytes(), report))
+		assert.False(t, report.Passed)
+		assert.Equal(t, smoketest.StepVersion, report.Steps[1].Name)
+		assert.Contains(t, report.Steps[1].Error, "unexpected 500 status")
+	})
+}
@@ -0,0 +1,210 @@
+// Package spam scores links of new URLs by local heuristics, so obvious
+// abuse is caught without external safety APIs. Score is a pure function of
+// its Input, all weights and limits of signals are kept in this file.
+package spam
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Signals link may be scored for
+const (
+	// SignalNestedShortener is set for links to other URL shorteners, they
+	// hide real destination
+	SignalNestedShortener = "nested_shortener"
+	// SignalIPHost is set for links to raw IP addresses
+	SignalIPHost = "ip_host"
+	// SignalDeepSubdomains is set for hosts with more than MaxHostLabels
+	// labels, e.g. paypal.com.login.example.ru
+	SignalDeepSubdomains = "deep_subdomains"
+	// SignalHomograph is set for internationalized hosts that look like
+	// popular brands
+	SignalHomograph = "homograph"
+	// SignalVelocity is set when creator made more than VelocityLimit URLs
+	// recently
+	SignalVelocity = "velocity"
+)
+
+// Weights are scores of signals, score of link is the sum of its signals
+var Weights = map[string]int{
+	SignalNestedShortener: 40,
+	SignalIPHost:          30,
+	SignalDeepSubdomains:  20,
+	SignalHomograph:       60,
+	SignalVelocity:        40,
+}
+
+// MaxHostLabels is the number of host labels allowed without
+// SignalDeepSubdomains, e.g. www.example.co.uk has 4 labels
+const MaxHostLabels = 4
+
+// VelocityLimit is the number of recent URLs of creator allowed without
+// SignalVelocity
+const VelocityLimit = 10
+
+// Shorteners lists domains of popular URL shorteners, their subdomains are
+// matched too
+var Shorteners = []string{
+	"bit.ly", "bitly.com", "tinyurl.com", "t.co", "goo.gl", "ow.ly", "is.gd",
+	"v.gd", "buff.ly", "cutt.ly", "rebrand.ly", "shorturl.at", "tiny.cc",
+	"rb.gy", "s.id", "t.ly", "lnkd.in", "bl.ink", "short.io",
+}
+
+// Brands lists names of popular brands phishing hosts imitate
+var Brands = []string{
+	"google", "gmail", "youtube", "paypal", "apple", "icloud", "microsoft",
+	"outlook", "office", "amazon", "facebook", "instagram", "whatsapp",
+	"netflix", "github", "linkedin", "twitter", "yahoo", "binance",
+	"coinbase", "steam", "telegram",
+}
+
+// confusables maps characters of other scripts to latin letters they look
+// like
+var confusables = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i',
+	'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'һ': 'h', 'ӏ': 'l', 'ԛ': 'q',
+	'ԝ': 'w', 'ɡ': 'g',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	// latin lookalikes
+	'ı': 'i', 'ł': 'l', 'ș': 's', 'ţ': 't', 'à': 'a', 'á': 'a', 'â': 'a',
+	'ä': 'a', 'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ì': 'i', 'í': 'i',
+	'ï': 'i', 'ò': 'o', 'ó': 'o', 'ô': 'o', 'ö': 'o', 'ù': 'u', 'ú': 'u',
+	'ü': 'u', 'ç': 'c', 'ñ': 'n', 'ý': 'y',
+}
+
+// Input represents URL being created
+type Input struct {
+	Link string
+	// RecentFromCreator is the number of URLs made recently by the creator,
+	// including this one
+	RecentFromCreator int
+	// Shorteners lists domains matched as URL shorteners besides Shorteners,
+	// e.g. domain of the service itself
+	Shorteners []string
+}
+
+// Result represents score of the link and signals it was scored for in
+// alphabetical order
+type Result struct {
+	Score   int
+	Signals []string
+}
+
+// Score scores link of the URL, link that can't be parsed scores zero as it
+// is rejected by validation anyway
+func Score(in Input) Result {
+	var signals []string
+	if in.RecentFromCreator > VelocityLimit {
+		signals = append(signals, SignalVelocity)
+	}
+
+	u, err := url.Parse(in.Link)
+	if err == nil {
+		signals = append(signals, hostSignals(u.Hostname(), in.Shorteners)...)
+	}
+
+	sort.Strings(signals)
+	r := Result{Signals: signals}
+	for _, s := range signals {
+		r.Score += Weights[s]
+	}
+	return r
+}
+
+// hostSignals returns signals of host
+func hostSignals(host string, shorteners []string) []string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return nil
+	}
+	if isIP(host) {
+		return []string{SignalIPHost}
+	}
+
+	var signals []string
+	if matchesDomain(host, Shorteners) || matchesDomain(host, shorteners) {
+		signals = append(signals, SignalNestedShortener)
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) > MaxHostLabels {
+		signals = append(signals, SignalDeepSubdomains)
+	}
+	for _, l := range labels {
+		if isHomograph(l) {
+			signals = append(signals, SignalHomograph)
+			break
+		}
+	}
+	return signals
+}
+
+// isIP reports whether host is IP address, including numeric forms browsers
+// accept, e.g. 3232235777 and 0xC0A80101
+func isIP(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	digits := strings.TrimPrefix(host, "0x")
+	if digits == "" {
+		return false
+	}
+	for _, r := range digits {
+		isHex := host != digits && (r >= 'a' && r <= 'f')
+		if !(r >= '0' && r <= '9' || isHex) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesDomain reports whether host is one of domains or their subdomain
+func matchesDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHomograph reports whether host label is internationalized and looks like
+// one of Brands once characters of other scripts are replaced with latin
+// letters they look like. Labels may be both punycode and unicode.
+func isHomograph(label string) bool {
+	unicode, err := idna.ToUnicode(label)
+	if err != nil {
+		return false
+	}
+	skeleton := make([]rune, 0, len(unicode))
+	ascii := true
+	for _, r := range unicode {
+		if r >= 0x80 {
+			ascii = false
+			if c, ok := confusables[r]; ok {
+				r = c
+			}
+		}
+		skeleton = append(skeleton, r)
+	}
+	if ascii {
+		return false
+	}
+
+	s := string(skeleton)
+	for _, b := range Brands {
+		if strings.Contains(s, b) {
+			return true
+		}
+	}
+	return false
+}
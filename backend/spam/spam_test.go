@@ -0,0 +1,58 @@
+package spam_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/semka95/shortener/backend/spam"
+)
+
+func TestScore(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      spam.Input
+		signals []string
+	}{
+		{name: "plain link", in: spam.Input{Link: "https://www.example.co.uk/path?q=1"}},
+		{name: "unparsable link", in: spam.Input{Link: "http://[::1"}},
+		{name: "nested shortener", in: spam.Input{Link: "https://bit.ly/3xYz"}, signals: []string{spam.SignalNestedShortener}},
+		{name: "shortener subdomain", in: spam.Input{Link: "https://go.Rebrand.ly./abc"}, signals: []string{spam.SignalNestedShortener}},
+		{name: "shortener lookalike", in: spam.Input{Link: "https://notbit.ly/abc"}},
+		{name: "configured shortener", in: spam.Input{Link: "https://sho.rt/abc", Shorteners: []string{"sho.rt"}}, signals: []string{spam.SignalNestedShortener}},
+		{name: "ipv4 host", in: spam.Input{Link: "http://192.168.1.1:8080/login"}, signals: []string{spam.SignalIPHost}},
+		{name: "ipv6 host", in: spam.Input{Link: "http://[2001:db8::1]/"}, signals: []string{spam.SignalIPHost}},
+		{name: "decimal ip host", in: spam.Input{Link: "http://3232235777/"}, signals: []string{spam.SignalIPHost}},
+		{name: "hex ip host", in: spam.Input{Link: "http://0xC0A80101/"}, signals: []string{spam.SignalIPHost}},
+		{name: "deep subdomains", in: spam.Input{Link: "https://paypal.com.login.secure.example.ru/"}, signals: []string{spam.SignalDeepSubdomains}},
+		{name: "punycode homograph", in: spam.Input{Link: "https://xn--pypal-4ve.com/signin"}, signals: []string{spam.SignalHomograph}},
+		{name: "unicode homograph", in: spam.Input{Link: "https://аррӏе-id.com/"}, signals: []string{spam.SignalHomograph}},
+		{name: "internationalized host", in: spam.Input{Link: "https://пример.рф/"}},
+		{name: "brand in ascii host", in: spam.Input{Link: "https://paypal.com/"}},
+		{name: "velocity", in: spam.Input{Link: "https://example.com", RecentFromCreator: spam.VelocityLimit + 1}, signals: []string{spam.SignalVelocity}},
+		{name: "velocity limit", in: spam.Input{Link: "https://example.com", RecentFromCreator: spam.VelocityLimit}},
+		{
+			name:    "signals add up",
+			in:      spam.Input{Link: "https://a.b.c.d.tinyurl.com/x", RecentFromCreator: 50},
+			signals: []string{spam.SignalDeepSubdomains, spam.SignalNestedShortener, spam.SignalVelocity},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := spam.Score(tc.in)
+			assert.Equal(t, tc.signals, r.Signals)
+			score := 0
+			for _, s := range tc.signals {
+				score += spam.Weights[s]
+			}
+			assert.Equal(t, score, r.Score)
+		})
+	}
+}
+
+func TestWeights(t *testing.T) {
+	for _, s := range []string{spam.SignalNestedShortener, spam.SignalIPHost, spam.SignalDeepSubdomains, spam.SignalHomograph, spam.SignalVelocity} {
+		assert.Positive(t, spam.Weights[s], "weight of %s", s)
+	}
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BloomFilter is a probabilistic set of keys. Added keys are always reported
+// as contained, other keys are reported as contained with false positive rate
+// the filter was sized for. Keys can't be removed from it.
+type BloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewBloomFilter creates empty BloomFilter sized for capacity keys with given
+// false positive rate
+func NewBloomFilter(capacity int, falsePositiveRate float64) *BloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = DefaultBloomFalsePositiveRate
+	}
+
+	m := math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/float64(capacity)*math.Ln2))
+
+	return &BloomFilter{
+		bits: make([]uint64, (uint64(m)+63)/64),
+		m:    uint64(m),
+		k:    uint64(k),
+	}
+}
+
+// Add adds key to the filter
+func (f *BloomFilter) Add(key string) {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain returns false if key was never added to the filter
+func (f *BloomFilter) MayContain(key string) bool {
+	h1, h2 := bloomHash(key)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHash returns two hashes of the key that derive all k hashes
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum(nil)
+	// second hash must be odd, so derived hashes never repeat the first one
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// DefaultBloomFalsePositiveRate is the false positive rate of BloomFilter
+// used when given rate is out of (0, 1) range
+const DefaultBloomFalsePositiveRate = 0.01
+
+// ExistenceFilter tells which keys are definitely missing from backend, so it
+// doesn't have to be asked about them. Keys are loaded by Rebuild, until it
+// first succeeds every key may exist. Keys stored in backend must be added
+// before they are stored, deleted keys stay in the filter until next Rebuild.
+type ExistenceFilter struct {
+	name              string
+	capacity          int
+	falsePositiveRate float64
+
+	rebuild  sync.Mutex
+	mu       sync.RWMutex
+	filter   *BloomFilter
+	building *BloomFilter
+	checks   atomic.Int64
+	skips    atomic.Int64
+}
+
+// NewExistenceFilter creates ExistenceFilter for backend with given name, its
+// bloom filter is sized for capacity keys with given false positive rate
+func NewExistenceFilter(name string, capacity int, falsePositiveRate float64) *ExistenceFilter {
+	return &ExistenceFilter{
+		name:              name,
+		capacity:          capacity,
+		falsePositiveRate: falsePositiveRate,
+	}
+}
+
+// Name returns name of the backend
+func (f *ExistenceFilter) Name() string {
+	return f.name
+}
+
+// Checks returns number of keys checked since creation
+func (f *ExistenceFilter) Checks() int64 {
+	return f.checks.Load()
+}
+
+// Skips returns number of keys reported as missing since creation
+func (f *ExistenceFilter) Skips() int64 {
+	return f.skips.Load()
+}
+
+// Add adds key to the filter and to the one being rebuilt
+func (f *ExistenceFilter) Add(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.filter != nil {
+		f.filter.Add(key)
+	}
+	if f.building != nil {
+		f.building.Add(key)
+	}
+}
+
+// MayExist returns false if key is definitely missing from backend
+func (f *ExistenceFilter) MayExist(key string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.filter == nil {
+		return true
+	}
+
+	f.checks.Add(1)
+	if f.filter.MayContain(key) {
+		return true
+	}
+	f.skips.Add(1)
+	return false
+}
+
+// Rebuild replaces the filter with new one made of keys returned by scan and
+// keys added while scan runs. Failed rebuild leaves the filter as it was.
+func (f *ExistenceFilter) Rebuild(ctx context.Context, scan func(ctx context.Context, fn func(key string) error) error) error {
+	f.rebuild.Lock()
+	defer f.rebuild.Unlock()
+
+	f.mu.Lock()
+	f.building = NewBloomFilter(f.capacity, f.falsePositiveRate)
+	f.mu.Unlock()
+
+	err := scan(ctx, func(key string) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.building.Add(key)
+		return nil
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		f.filter = f.building
+	}
+	f.building = nil
+
+	return err
+}
+
+// RunRebuild rebuilds filter right away and then every interval until
+// context is canceled, non-positive interval disables periodic rebuilds
+func RunRebuild(ctx context.Context, f *ExistenceFilter, scan func(ctx context.Context, fn func(key string) error) error, interval time.Duration, logger *zap.Logger) {
+	rebuild := func() {
+		start := time.Now()
+		if err := f.Rebuild(ctx, scan); err != nil {
+			logger.Error("can't rebuild existence filter", zap.String("filter", f.name), zap.Error(err))
+			return
+		}
+		logger.Info("existence filter rebuilt", zap.String("filter", f.name), zap.Duration("duration", time.Since(start)))
+	}
+
+	rebuild()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rebuild()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestBloomFilter_NoFalseNegatives(t *testing.T) {
+	const n = 100000
+	f := store.NewBloomFilter(n, 0.01)
+
+	for i := 0; i < n; i++ {
+		f.Add(fmt.Sprintf("id%07d", i))
+	}
+	for i := 0; i < n; i++ {
+		require.True(t, f.MayContain(fmt.Sprintf("id%07d", i)), "stored id %d is reported missing", i)
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.MayContain(fmt.Sprintf("missing%07d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, n*2/100)
+}
+
+func TestBloomFilter_Overfilled(t *testing.T) {
+	f := store.NewBloomFilter(10, 0.01)
+
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("id%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		require.True(t, f.MayContain(fmt.Sprintf("id%d", i)))
+	}
+}
+
+// scanKeys returns scan that returns given keys and calls during after the
+// first key
+func scanKeys(keys []string, during func(), err error) func(ctx context.Context, fn func(key string) error) error {
+	return func(ctx context.Context, fn func(key string) error) error {
+		for i, key := range keys {
+			if err := fn(key); err != nil {
+				return err
+			}
+			if i == 0 && during != nil {
+				during()
+			}
+		}
+		return err
+	}
+}
+
+func TestExistenceFilter(t *testing.T) {
+	f := store.NewExistenceFilter("url", 100, 0.01)
+
+	// nothing is known before first rebuild
+	assert.True(t, f.MayExist("a"))
+	assert.Zero(t, f.Checks())
+
+	err := f.Rebuild(context.Background(), scanKeys([]string{"a", "b"}, func() { f.Add("c") }, nil))
+	require.NoError(t, err)
+
+	assert.True(t, f.MayExist("a"))
+	assert.True(t, f.MayExist("b"))
+	assert.True(t, f.MayExist("c"), "key added during rebuild is lost")
+	assert.False(t, f.MayExist("d"))
+
+	f.Add("d")
+	assert.True(t, f.MayExist("d"))
+
+	assert.EqualValues(t, 5, f.Checks())
+	assert.EqualValues(t, 1, f.Skips())
+
+	// deleted key is dropped by rebuild
+	err = f.Rebuild(context.Background(), scanKeys([]string{"b", "c", "d"}, nil, nil))
+	require.NoError(t, err)
+	assert.False(t, f.MayExist("a"))
+}
+
+func TestExistenceFilter_FailedRebuild(t *testing.T) {
+	f := store.NewExistenceFilter("url", 100, 0.01)
+
+	err := f.Rebuild(context.Background(), scanKeys([]string{"a"}, nil, errBackend))
+	assert.ErrorIs(t, err, errBackend)
+	assert.True(t, f.MayExist("b"))
+
+	err = f.Rebuild(context.Background(), scanKeys([]string{"a"}, nil, nil))
+	require.NoError(t, err)
+	err = f.Rebuild(context.Background(), scanKeys([]string{"b"}, func() { f.Add("c") }, errBackend))
+	assert.ErrorIs(t, err, errBackend)
+
+	assert.True(t, f.MayExist("a"))
+	assert.False(t, f.MayExist("b"))
+	assert.True(t, f.MayExist("c"))
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// BreakerState is the state of CircuitBreaker
+type BreakerState int64
+
+const (
+	// BreakerClosed lets all calls through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all calls until open timeout passes
+	BreakerOpen
+	// BreakerHalfOpen lets single probe call through
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int64(s))
+	}
+}
+
+// CircuitBreaker stops calling failing backend. After threshold of consecutive
+// failures it opens and rejects calls with domain.ErrUnavailable,
+// once open timeout passes single probe call is let through, its success
+// closes the breaker and failure opens it again. Zero threshold disables
+// the breaker.
+type CircuitBreaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+	logger      *zap.Logger
+	now         func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	transitions atomic.Int64
+}
+
+// NewCircuitBreaker creates closed CircuitBreaker for backend with given name
+func NewCircuitBreaker(name string, threshold int, openTimeout time.Duration, logger *zap.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:        name,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// SetClock replaces clock used to measure open timeout
+func (cb *CircuitBreaker) SetClock(now func() time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.now = now
+}
+
+// Name returns name of the backend
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// State returns current state of the breaker
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Transitions returns number of state changes since creation
+func (cb *CircuitBreaker) Transitions() int64 {
+	return cb.transitions.Load()
+}
+
+// RejectingFor returns how long calls are going to be rejected without
+// reaching backend, it is zero when the next call is let through. Probe in
+// flight rejects calls for a second, it is expected to finish by then.
+func (cb *CircuitBreaker) RejectingFor() time.Duration {
+	if cb.threshold <= 0 {
+		return 0
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch {
+	case cb.state == BreakerOpen:
+		if d := cb.openTimeout - cb.now().Sub(cb.openedAt); d > 0 {
+			return d
+		}
+		return 0
+	case cb.state == BreakerHalfOpen && cb.probing:
+		return time.Second
+	default:
+		return 0
+	}
+}
+
+// Do calls op if breaker allows it and records its result
+func (cb *CircuitBreaker) Do(op func() error) error {
+	if cb.threshold <= 0 {
+		return op()
+	}
+
+	if !cb.allow() {
+		return fmt.Errorf("%s circuit breaker is open: %w", cb.name, domain.ErrUnavailable)
+	}
+
+	// panicking call is recorded as failure so probe is not left running forever
+	failed := true
+	defer func() { cb.record(failed) }()
+
+	err := op()
+	failed = isBackendFailure(err)
+
+	return err
+}
+
+func (cb *CircuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.openTimeout {
+			return false
+		}
+		cb.setState(BreakerHalfOpen)
+		cb.probing = true
+		return true
+	case BreakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (cb *CircuitBreaker) record(failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerHalfOpen:
+		cb.probing = false
+		if failed {
+			cb.open()
+			return
+		}
+		cb.failures = 0
+		cb.setState(BreakerClosed)
+	case BreakerClosed:
+		if !failed {
+			cb.failures = 0
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.threshold {
+			cb.open()
+		}
+	}
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.openedAt = cb.now()
+	cb.setState(BreakerOpen)
+}
+
+func (cb *CircuitBreaker) setState(state BreakerState) {
+	if cb.state == state {
+		return
+	}
+
+	cb.logger.Warn("circuit breaker state changed",
+		zap.String("breaker", cb.name),
+		zap.Stringer("from", cb.state),
+		zap.Stringer("to", state),
+		zap.Int("failures", cb.failures),
+	)
+	cb.state = state
+	cb.transitions.Add(1)
+}
+
+// isBackendFailure reports whether error means that backend is unhealthy,
+// errors caused by request itself are not failures
+func isBackendFailure(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, domain.ErrNotFound),
+		errors.Is(err, domain.ErrNoAffected),
+		errors.Is(err, domain.ErrConflict),
+		errors.Is(err, domain.ErrBadParamInput),
+		errors.Is(err, context.Canceled):
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,184 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+// fakeClock is manually advanced clock
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+var errBackend = errors.New("connection refused")
+
+func newTestBreaker(threshold int) (*store.CircuitBreaker, *fakeClock, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cb := store.NewCircuitBreaker("url", threshold, 5*time.Second, zap.New(core))
+	cb.SetClock(clock.Now)
+	return cb, clock, logs
+}
+
+// script returns operation that returns given errors one by one and counts calls
+func script(calls *int, errs ...error) func() error {
+	return func() error {
+		err := errs[*calls]
+		*calls++
+		return err
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("opens after threshold of consecutive failures", func(t *testing.T) {
+		cb, _, logs := newTestBreaker(3)
+		calls := 0
+		op := script(&calls, errBackend, nil, errBackend, errBackend, errBackend, nil)
+
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, store.BreakerClosed, cb.State())
+			_ = cb.Do(op)
+		}
+		assert.Equal(t, store.BreakerOpen, cb.State())
+
+		err := cb.Do(op)
+		assert.ErrorIs(t, err, domain.ErrUnavailable)
+		assert.Equal(t, 5, calls)
+
+		require.Equal(t, 1, logs.Len())
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, "url", fields["breaker"])
+		assert.Equal(t, "closed", fields["from"])
+		assert.Equal(t, "open", fields["to"])
+		assert.EqualValues(t, 1, cb.Transitions())
+	})
+
+	t.Run("request errors are not failures", func(t *testing.T) {
+		cb, _, _ := newTestBreaker(1)
+		calls := 0
+		op := script(&calls, domain.ErrNotFound, domain.ErrConflict, domain.ErrNoAffected, context.Canceled)
+
+		for i := 0; i < 4; i++ {
+			_ = cb.Do(op)
+		}
+		assert.Equal(t, store.BreakerClosed, cb.State())
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("successful probe closes breaker", func(t *testing.T) {
+		cb, clock, logs := newTestBreaker(1)
+		calls := 0
+		op := script(&calls, errBackend, nil, nil)
+
+		_ = cb.Do(op)
+		clock.Advance(4 * time.Second)
+		assert.ErrorIs(t, cb.Do(op), domain.ErrUnavailable)
+		assert.Equal(t, 1, calls)
+
+		clock.Advance(time.Second)
+		require.NoError(t, cb.Do(op))
+		assert.Equal(t, store.BreakerClosed, cb.State())
+		require.NoError(t, cb.Do(op))
+		assert.Equal(t, 3, calls)
+
+		var states []string
+		for _, l := range logs.All() {
+			states = append(states, l.ContextMap()["to"].(string))
+		}
+		assert.Equal(t, []string{"open", "half-open", "closed"}, states)
+	})
+
+	t.Run("failed probe opens breaker again", func(t *testing.T) {
+		cb, clock, _ := newTestBreaker(1)
+		calls := 0
+		op := script(&calls, errBackend, errBackend, nil)
+
+		_ = cb.Do(op)
+		clock.Advance(5 * time.Second)
+		assert.ErrorIs(t, cb.Do(op), errBackend)
+		assert.Equal(t, store.BreakerOpen, cb.State())
+
+		clock.Advance(4 * time.Second)
+		assert.ErrorIs(t, cb.Do(op), domain.ErrUnavailable)
+		assert.Equal(t, 2, calls)
+
+		clock.Advance(time.Second)
+		require.NoError(t, cb.Do(op))
+		assert.Equal(t, store.BreakerClosed, cb.State())
+		assert.EqualValues(t, 5, cb.Transitions())
+	})
+
+	t.Run("only one probe at a time", func(t *testing.T) {
+		cb, clock, _ := newTestBreaker(1)
+		_ = cb.Do(func() error { return errBackend })
+		clock.Advance(5 * time.Second)
+
+		err := cb.Do(func() error {
+			assert.Equal(t, store.BreakerHalfOpen, cb.State())
+			assert.ErrorIs(t, cb.Do(func() error { return nil }), domain.ErrUnavailable)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, store.BreakerClosed, cb.State())
+	})
+
+	t.Run("panicking probe opens breaker", func(t *testing.T) {
+		cb, clock, _ := newTestBreaker(1)
+		_ = cb.Do(func() error { return errBackend })
+		clock.Advance(5 * time.Second)
+
+		assert.Panics(t, func() {
+			_ = cb.Do(func() error { panic("boom") })
+		})
+		assert.Equal(t, store.BreakerOpen, cb.State())
+	})
+
+	t.Run("rejecting until probe", func(t *testing.T) {
+		cb, clock, _ := newTestBreaker(1)
+		assert.Zero(t, cb.RejectingFor())
+
+		_ = cb.Do(func() error { return errBackend })
+		assert.Equal(t, 5*time.Second, cb.RejectingFor())
+		clock.Advance(3 * time.Second)
+		assert.Equal(t, 2*time.Second, cb.RejectingFor())
+
+		clock.Advance(2 * time.Second)
+		assert.Zero(t, cb.RejectingFor(), "next call probes backend")
+		err := cb.Do(func() error {
+			assert.Equal(t, time.Second, cb.RejectingFor())
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Zero(t, cb.RejectingFor())
+	})
+
+	t.Run("zero threshold disables breaker", func(t *testing.T) {
+		cb, _, _ := newTestBreaker(0)
+		calls := 0
+		op := script(&calls, errBackend, errBackend, errBackend)
+
+		for i := 0; i < 3; i++ {
+			assert.ErrorIs(t, cb.Do(op), errBackend)
+		}
+		assert.Equal(t, store.BreakerClosed, cb.State())
+	})
+}
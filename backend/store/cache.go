@@ -0,0 +1,212 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheResult is the result of Cache lookup
+type CacheResult int
+
+const (
+	// CacheMiss means that key is not cached
+	CacheMiss CacheResult = iota
+	// CacheHit means that value of the key is cached
+	CacheHit
+	// CacheNegativeHit means that key is cached as missing from backend
+	CacheNegativeHit
+	// CacheStaleHit means that expired value of the key is served as backend
+	// can't be reached
+	CacheStaleHit
+)
+
+func (r CacheResult) String() string {
+	switch r {
+	case CacheMiss:
+		return "miss"
+	case CacheHit:
+		return "hit"
+	case CacheNegativeHit:
+		return "negative_hit"
+	case CacheStaleHit:
+		return "stale_hit"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+type cacheEntry struct {
+	value     interface{}
+	missing   bool
+	expiresAt time.Time
+}
+
+// Cache keeps values read from backend and keys missing from it for a short
+// time. Values are kept for ttl and missing keys for negativeTTL, zero
+// duration disables caching of that kind. Once cache holds size entries an
+// arbitrary one is evicted for a new one, zero size disables the cache.
+//
+// Reads racing with writes must not cache stale results, so Generation is
+// taken before backend is read and results are cached only if no key was
+// deleted since then.
+//
+// Expired values are kept for stale duration set by SetStaleTTL, GetStale
+// returns them while backend can't be reached.
+type Cache struct {
+	name        string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	gen     uint64
+	stale   time.Duration
+	lookups [CacheStaleHit + 1]atomic.Int64
+}
+
+// NewCache creates empty Cache for backend with given name
+func NewCache(name string, ttl, negativeTTL time.Duration, size int) *Cache {
+	return &Cache{
+		name:        name,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		size:        size,
+		now:         time.Now,
+		entries:     make(map[string]cacheEntry),
+	}
+}
+
+// SetClock replaces clock used to expire entries
+func (c *Cache) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// SetStaleTTL keeps values for stale duration after they expire, so they can
+// be served by GetStale
+func (c *Cache) SetStaleTTL(stale time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stale = stale
+}
+
+// Name returns name of the backend
+func (c *Cache) Name() string {
+	return c.name
+}
+
+// Lookups returns number of lookups with given result since creation
+func (c *Cache) Lookups(result CacheResult) int64 {
+	if result < CacheMiss || result > CacheStaleHit {
+		return 0
+	}
+	return c.lookups[result].Load()
+}
+
+// Get returns cached value of the key, value is nil unless result is CacheHit
+func (c *Cache) Get(key string) (interface{}, CacheResult) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && !c.now().Before(e.expiresAt) {
+		// missing keys are never served stale
+		if e.missing || !c.now().Before(e.expiresAt.Add(c.stale)) {
+			delete(c.entries, key)
+		}
+		ok = false
+	}
+	c.mu.Unlock()
+
+	result := CacheMiss
+	switch {
+	case !ok:
+	case e.missing:
+		result = CacheNegativeHit
+	default:
+		result = CacheHit
+	}
+	c.lookups[result].Add(1)
+
+	return e.value, result
+}
+
+// GetStale returns value of the key even if it expired no longer than stale
+// duration ago, it is used when backend can't be reached
+func (c *Cache) GetStale(key string) (interface{}, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && (e.missing || !c.now().Before(e.expiresAt.Add(c.stale))) {
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	c.lookups[CacheStaleHit].Add(1)
+
+	return e.value, true
+}
+
+// Generation returns current generation of the cache, it changes whenever
+// keys are deleted
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// Set caches value of the key read from backend at generation gen
+func (c *Cache) Set(key string, value interface{}, gen uint64) {
+	c.put(key, cacheEntry{value: value}, c.ttl, gen)
+}
+
+// SetMissing caches that key was missing from backend at generation gen
+func (c *Cache) SetMissing(key string, gen uint64) {
+	c.put(key, cacheEntry{missing: true}, c.negativeTTL, gen)
+}
+
+// Delete removes the key from cache, it must be called when backend value of
+// the key is changed or created
+func (c *Cache) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+// Clear removes all keys from cache
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = make(map[string]cacheEntry)
+}
+
+func (c *Cache) put(key string, e cacheEntry, ttl time.Duration, gen uint64) {
+	if c.size <= 0 || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	e.expiresAt = c.now().Add(ttl)
+	c.entries[key] = e
+}
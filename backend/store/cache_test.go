@@ -0,0 +1,148 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func newTestCache(size int) (*store.Cache, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := store.NewCache("url", 5*time.Second, 30*time.Second, size)
+	c.SetClock(clock.Now)
+	return c, clock
+}
+
+func TestCache_GetSet(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	_, result := c.Get("a")
+	assert.Equal(t, store.CacheMiss, result)
+
+	c.Set("a", 1, c.Generation())
+	c.SetMissing("b", c.Generation())
+
+	v, result := c.Get("a")
+	assert.Equal(t, store.CacheHit, result)
+	assert.Equal(t, 1, v)
+	v, result = c.Get("b")
+	assert.Equal(t, store.CacheNegativeHit, result)
+	assert.Nil(t, v)
+
+	// values expire before missing keys
+	clock.Advance(5 * time.Second)
+	_, result = c.Get("a")
+	assert.Equal(t, store.CacheMiss, result)
+	_, result = c.Get("b")
+	assert.Equal(t, store.CacheNegativeHit, result)
+
+	clock.Advance(25 * time.Second)
+	_, result = c.Get("b")
+	assert.Equal(t, store.CacheMiss, result)
+
+	assert.EqualValues(t, 1, c.Lookups(store.CacheHit))
+	assert.EqualValues(t, 2, c.Lookups(store.CacheNegativeHit))
+	assert.EqualValues(t, 3, c.Lookups(store.CacheMiss))
+}
+
+func TestCache_Delete(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	c.SetMissing("a", c.Generation())
+	c.Set("b", 1, c.Generation())
+	c.Delete("a")
+
+	_, result := c.Get("a")
+	assert.Equal(t, store.CacheMiss, result)
+	_, result = c.Get("b")
+	assert.Equal(t, store.CacheHit, result)
+
+	c.Clear()
+	_, result = c.Get("b")
+	assert.Equal(t, store.CacheMiss, result)
+}
+
+func TestCache_StaleGeneration(t *testing.T) {
+	c, _ := newTestCache(10)
+
+	// key is created while it is being read as missing
+	gen := c.Generation()
+	c.Delete("a")
+	c.SetMissing("a", gen)
+
+	_, result := c.Get("a")
+	assert.Equal(t, store.CacheMiss, result)
+}
+
+func TestCache_GetStale(t *testing.T) {
+	c, clock := newTestCache(10)
+	c.SetStaleTTL(time.Minute)
+
+	c.Set("a", 1, c.Generation())
+	c.SetMissing("b", c.Generation())
+
+	// expired value is a miss, but it is kept for stale reads
+	clock.Advance(30 * time.Second)
+	_, result := c.Get("a")
+	assert.Equal(t, store.CacheMiss, result)
+	v, ok := c.GetStale("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	// missing keys are never served stale
+	_, result = c.Get("b")
+	assert.Equal(t, store.CacheMiss, result)
+	_, ok = c.GetStale("b")
+	assert.False(t, ok)
+
+	clock.Advance(35 * time.Second)
+	_, ok = c.GetStale("a")
+	assert.False(t, ok)
+	_, ok = c.GetStale("c")
+	assert.False(t, ok)
+
+	assert.EqualValues(t, 1, c.Lookups(store.CacheStaleHit))
+}
+
+func TestCache_GetStaleDisabled(t *testing.T) {
+	c, clock := newTestCache(10)
+
+	c.Set("a", 1, c.Generation())
+	clock.Advance(5 * time.Second)
+
+	_, ok := c.GetStale("a")
+	assert.False(t, ok)
+}
+
+func TestCache_Size(t *testing.T) {
+	c, _ := newTestCache(2)
+
+	c.SetMissing("a", c.Generation())
+	c.SetMissing("b", c.Generation())
+	c.SetMissing("c", c.Generation())
+
+	cached := 0
+	for _, key := range []string{"a", "b", "c"} {
+		if _, result := c.Get(key); result == store.CacheNegativeHit {
+			cached++
+		}
+	}
+	assert.Equal(t, 2, cached)
+	_, result := c.Get("c")
+	assert.Equal(t, store.CacheNegativeHit, result)
+}
+
+func TestCache_Disabled(t *testing.T) {
+	c, _ := newTestCache(0)
+
+	c.Set("a", 1, c.Generation())
+	c.SetMissing("b", c.Generation())
+
+	_, result := c.Get("a")
+	assert.Equal(t, store.CacheMiss, result)
+	_, result = c.Get("b")
+	assert.Equal(t, store.CacheMiss, result)
+}
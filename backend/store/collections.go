@@ -0,0 +1,243 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Default names of collections
+const (
+	URLCollection       = "url"
+	UserCollection      = "user"
+	AuditCollection     = "audit"
+	BlocklistCollection = "blocklist"
+	ClickCollection     = "click"
+	// ClickRollupCollection stores clicks on URL made during hour. Visitors
+	// of the hour are kept instead of their number, so hours can be combined
+	// without counting visitor twice.
+	ClickRollupCollection = "click_rollup"
+	ShareCollection       = "share"
+	APIKeyCollection      = "apikey"
+	LockCollection        = "lock"
+	// LimitCollection stores state of limits shared by instances, e.g. used
+	// proof-of-work challenges
+	LimitCollection  = "limit"
+	ReportCollection = "report"
+	// SnapshotCollection stores the last snapshot of counts exported as
+	// metrics
+	SnapshotCollection = "snapshot"
+	// DomainCollection stores short domains URLs may be created on
+	DomainCollection = "domain"
+	// AliasCollection stores former short codes of renamed URLs
+	AliasCollection = "alias"
+	// MigrationsCollection tracks applied migrations
+	MigrationsCollection = "schema_migrations"
+	// MigrationsLockCollection holds advisory lock of migrations
+	MigrationsLockCollection = "migrate_advisory_lock"
+)
+
+// collectionNames lists default names of all collections
+var collectionNames = []string{
+	URLCollection,
+	UserCollection,
+	AuditCollection,
+	BlocklistCollection,
+	ClickCollection,
+	ClickRollupCollection,
+	ShareCollection,
+	APIKeyCollection,
+	LockCollection,
+	LimitCollection,
+	ReportCollection,
+	SnapshotCollection,
+	DomainCollection,
+	AliasCollection,
+	MigrationsCollection,
+	MigrationsLockCollection,
+}
+
+// Collections configures names of collections, so several deployments, e.g.
+// staging and production, can share one database. Zero value keeps default
+// names.
+type Collections struct {
+	// Prefix is prepended to name of every collection
+	Prefix string `yaml:"prefix"`
+	// Names renames collections, keys are default names
+	Names map[string]string `yaml:"names"`
+}
+
+// Name returns name of collection with default name
+func (c Collections) Name(collection string) string {
+	if name, ok := c.Names[collection]; ok {
+		collection = name
+	}
+	return c.Prefix + collection
+}
+
+// Validate checks that collection names are accepted by MongoDB and don't
+// collide
+func (c Collections) Validate() error {
+	if c.Prefix != "" {
+		if err := validCollectionName(c.Prefix); err != nil {
+			return fmt.Errorf("invalid collection prefix: %w", err)
+		}
+	}
+
+	known := make(map[string]bool, len(collectionNames))
+	for _, name := range collectionNames {
+		known[name] = true
+	}
+	for collection, name := range c.Names {
+		if !known[collection] {
+			return fmt.Errorf("unknown collection %q", collection)
+		}
+		if err := validCollectionName(name); err != nil {
+			return fmt.Errorf("invalid name of %s collection: %w", collection, err)
+		}
+	}
+
+	used := make(map[string]string, len(collectionNames))
+	for _, collection := range collectionNames {
+		name := c.Name(collection)
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("collections %s and %s are both named %q", other, collection, name)
+		}
+		used[name] = collection
+	}
+
+	return nil
+}
+
+func validCollectionName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("name is empty")
+	case strings.ContainsAny(name, ".$\x00"):
+		return fmt.Errorf("%q must not contain dots, $ or null characters", name)
+	case strings.HasPrefix(name, "system"):
+		return fmt.Errorf("%q must not start with system", name)
+	}
+	return nil
+}
+
+// commands whose value is name of collection they operate on
+var collectionCommands = map[string]bool{
+	"create":        true,
+	"createIndexes": true,
+	"dropIndexes":   true,
+	"drop":          true,
+	"collMod":       true,
+	"find":          true,
+	"insert":        true,
+	"update":        true,
+	"delete":        true,
+	"aggregate":     true,
+	"count":         true,
+	"distinct":      true,
+	"findAndModify": true,
+}
+
+// userCommands manage database users, which are shared by all collection
+// sets of the database
+var userCommands = map[string]bool{
+	"createUser": true,
+	"dropUser":   true,
+}
+
+// rewriteMigration renames collections in migration commands. Commands
+// managing database users are dropped for prefixed collections, users are
+// created by migrations of collections without prefix.
+func (c Collections) rewriteMigration(data []byte) ([]byte, error) {
+	var cmds []bson.D
+	if err := bson.UnmarshalExtJSON(data, true, &cmds); err != nil {
+		return nil, fmt.Errorf("can't parse migration: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for _, cmd := range cmds {
+		if len(cmd) > 0 && userCommands[cmd[0].Key] && c.Prefix != "" {
+			continue
+		}
+		if len(cmd) > 0 && collectionCommands[cmd[0].Key] {
+			if name, ok := cmd[0].Value.(string); ok {
+				cmd[0].Value = c.Name(name)
+			}
+		}
+		c.renameStages(cmd)
+
+		doc, err := bson.MarshalExtJSON(cmd, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("can't write migration: %w", err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(doc)
+	}
+	buf.WriteByte(']')
+
+	return buf.Bytes(), nil
+}
+
+// renameStages renames collections referred to by pipeline stages, e.g.
+// $lookup and $merge
+func (c Collections) renameStages(v interface{}) {
+	switch v := v.(type) {
+	case bson.D:
+		for i, e := range v {
+			switch name := e.Value.(type) {
+			case string:
+				if e.Key == "from" || e.Key == "into" || e.Key == "$out" {
+					v[i].Value = c.Name(name)
+				}
+			default:
+				c.renameStages(e.Value)
+			}
+		}
+	case bson.A:
+		for _, e := range v {
+			c.renameStages(e)
+		}
+	}
+}
+
+// migrationFS renames collections in migrations read from fs
+type migrationFS struct {
+	fs.FS
+	collections Collections
+}
+
+func (m migrationFS) Open(name string) (fs.File, error) {
+	f, err := m.FS.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".json") {
+		return f, err
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if data, err = m.collections.rewriteMigration(data); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("migration %s: %w", name, err)
+	}
+
+	return &migrationFile{File: f, r: bytes.NewReader(data)}, nil
+}
+
+// migrationFile is migration file with rewritten content
+type migrationFile struct {
+	fs.File
+	r *bytes.Reader
+}
+
+func (f *migrationFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
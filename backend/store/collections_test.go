@@ -0,0 +1,104 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestCollections_Name(t *testing.T) {
+	assert.Equal(t, "url", store.Collections{}.Name(store.URLCollection))
+	assert.Equal(t, "staging_url", store.Collections{Prefix: "staging_"}.Name(store.URLCollection))
+
+	cols := store.Collections{Prefix: "staging_", Names: map[string]string{store.UserCollection: "account"}}
+	assert.Equal(t, "staging_account", cols.Name(store.UserCollection))
+	assert.Equal(t, "staging_click", cols.Name(store.ClickCollection))
+}
+
+func TestCollections_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		cols store.Collections
+		err  string
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "prefix and names",
+			cols: store.Collections{Prefix: "staging_", Names: map[string]string{store.UserCollection: "account"}},
+		},
+		{
+			name: "prefix with dot",
+			cols: store.Collections{Prefix: "staging."},
+			err:  `invalid collection prefix: "staging." must not contain dots, $ or null characters`,
+		},
+		{
+			name: "name with dollar",
+			cols: store.Collections{Names: map[string]string{store.URLCollection: "$url"}},
+			err:  `invalid name of url collection: "$url" must not contain dots, $ or null characters`,
+		},
+		{
+			name: "empty name",
+			cols: store.Collections{Names: map[string]string{store.URLCollection: ""}},
+			err:  "invalid name of url collection: name is empty",
+		},
+		{
+			name: "system name",
+			cols: store.Collections{Prefix: "system_"},
+			err:  `invalid collection prefix: "system_" must not start with system`,
+		},
+		{
+			name: "unknown collection",
+			cols: store.Collections{Names: map[string]string{"links": "url"}},
+			err:  `unknown collection "links"`,
+		},
+		{
+			name: "same names",
+			cols: store.Collections{Names: map[string]string{store.URLCollection: "user"}},
+			err:  `collections url and user are both named "user"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cols.Validate()
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestRunMigrations_Collections(t *testing.T) {
+	instance, err := stub.WithInstance(nil, &stub.Config{})
+	require.NoError(t, err)
+	s := instance.(*stub.Stub)
+
+	err = store.RunMigrations(instance, "shortener", store.Collections{Prefix: "staging_"}, zap.NewNop())
+	require.NoError(t, err)
+
+	for _, m := range s.MigrationSequence {
+		var cmds []bson.D
+		require.NoError(t, bson.UnmarshalExtJSON([]byte(m), true, &cmds))
+		for _, cmd := range cmds {
+			assert.NotEqual(t, "createUser", cmd[0].Key, "users are created without prefix")
+			if name, ok := cmd[0].Value.(string); ok {
+				assert.Regexp(t, "^staging_", name, "collection of %s command", cmd[0].Key)
+			}
+		}
+	}
+
+	rollups := s.MigrationSequence[12]
+	assert.Contains(t, rollups, `"aggregate":"staging_click"`)
+	assert.Contains(t, rollups, `"into":"staging_click_rollup"`)
+	assert.NotContains(t, s.MigrationSequence[0], "createUser")
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix starts every encrypted value, it is followed by key version
+// and base64 of nonce and ciphertext separated by colons
+const encryptedPrefix = "enc:"
+
+// KeySize is the size of AES-256 keys
+const KeySize = 32
+
+// EncryptionConfig stores keys of encryption at rest, encryption is disabled
+// when no key is set
+type EncryptionConfig struct {
+	// CurrentKey is the version of key new values are encrypted with
+	CurrentKey string `yaml:"current_key"`
+	// Keys has base64 encoded 32 bytes keys by version, old keys are kept
+	// until values encrypted with them are rotated
+	Keys map[string]string `yaml:"keys"`
+}
+
+// Enabled reports whether encryption at rest is configured
+func (cfg EncryptionConfig) Enabled() bool {
+	return cfg.CurrentKey != "" || len(cfg.Keys) > 0
+}
+
+// KeyProvider provides versioned encryption keys, e.g. by fetching them from
+// key management service
+type KeyProvider interface {
+	// CurrentKey returns version and key new values are encrypted with
+	CurrentKey(ctx context.Context) (string, []byte, error)
+	// Key returns key of version
+	Key(ctx context.Context, version string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider returns KeyProvider of keys set in configuration
+func NewStaticKeyProvider(cfg EncryptionConfig) (KeyProvider, error) {
+	p := &staticKeyProvider{
+		current: cfg.CurrentKey,
+		keys:    make(map[string][]byte, len(cfg.Keys)),
+	}
+	for version, encoded := range cfg.Keys {
+		if version == "" || strings.Contains(version, ":") {
+			return nil, fmt.Errorf("invalid encryption key version %q", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode encryption key %s: %w", version, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("encryption key %s must be %d bytes long, got %d", version, KeySize, len(key))
+		}
+		p.keys[version] = key
+	}
+	if _, ok := p.keys[p.current]; !ok {
+		return nil, fmt.Errorf("current encryption key %q is not set", p.current)
+	}
+
+	return p, nil
+}
+
+func (p *staticKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *staticKeyProvider) Key(ctx context.Context, version string) ([]byte, error) {
+	key, ok := p.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %q is not set", version)
+	}
+	return key, nil
+}
+
+// Cipher encrypts values with AES-256-GCM. Encrypted value carries version
+// of its key, so keys can be rotated, and is bound to id of its document, so
+// it can't be moved to another document. Values without encryption prefix
+// are stored before encryption was enabled and are returned as is.
+type Cipher struct {
+	keys KeyProvider
+
+	mu    sync.Mutex
+	aeads map[string]cipher.AEAD
+}
+
+// NewCipher creates Cipher of keys provided by p
+func NewCipher(p KeyProvider) *Cipher {
+	return &Cipher{
+		keys:  p,
+		aeads: make(map[string]cipher.AEAD),
+	}
+}
+
+// IsEncrypted reports whether value is encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// KeyVersion returns version of key value is encrypted with, it returns false
+// for plain value
+func KeyVersion(value string) (string, bool) {
+	if !IsEncrypted(value) {
+		return "", false
+	}
+	version, _, ok := strings.Cut(value[len(encryptedPrefix):], ":")
+	return version, ok
+}
+
+// CurrentVersion returns version of key values are encrypted with
+func (c *Cipher) CurrentVersion(ctx context.Context) (string, error) {
+	version, _, err := c.keys.CurrentKey(ctx)
+	return version, err
+}
+
+// Encrypt encrypts value of document id with current key, empty value is
+// kept empty
+func (c *Cipher) Encrypt(ctx context.Context, id, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	version, key, err := c.keys.CurrentKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("can't get current encryption key: %w", err)
+	}
+	aead, err := c.aead(ctx, version, key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("can't generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(id))
+
+	return encryptedPrefix + version + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts value of document id, plain value is returned as is
+func (c *Cipher) Decrypt(ctx context.Context, id, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	version, encoded, ok := strings.Cut(value[len(encryptedPrefix):], ":")
+	if !ok {
+		return "", errors.New("encrypted value has no key version")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("can't decode encrypted value: %w", err)
+	}
+
+	aead, err := c.aead(ctx, version, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt value with key %s: %w", version, err)
+	}
+
+	return string(plain), nil
+}
+
+// aead returns cached AEAD of key version, key is fetched from provider when
+// it is not passed
+func (c *Cipher) aead(ctx context.Context, version string, key []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	aead, ok := c.aeads[version]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	if key == nil {
+		var err error
+		if key, err = c.keys.Key(ctx, version); err != nil {
+			return nil, fmt.Errorf("can't get encryption key: %w", err)
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %s: %w", version, err)
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("can't create cipher of key %s: %w", version, err)
+	}
+
+	c.mu.Lock()
+	c.aeads[version] = aead
+	c.mu.Unlock()
+
+	return aead, nil
+}
@@ -0,0 +1,127 @@
+package store_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), store.KeySize)))
+}
+
+func TestNewStaticKeyProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  store.EncryptionConfig
+		err  string
+	}{
+		{
+			name: "success",
+			cfg:  store.EncryptionConfig{CurrentKey: "v1", Keys: map[string]string{"v1": testKey('a')}},
+		},
+		{
+			name: "current key missing",
+			cfg:  store.EncryptionConfig{CurrentKey: "v2", Keys: map[string]string{"v1": testKey('a')}},
+			err:  `current encryption key "v2" is not set`,
+		},
+		{
+			name: "short key",
+			cfg:  store.EncryptionConfig{CurrentKey: "v1", Keys: map[string]string{"v1": base64.StdEncoding.EncodeToString([]byte("short"))}},
+			err:  "encryption key v1 must be 32 bytes long, got 5",
+		},
+		{
+			name: "invalid base64",
+			cfg:  store.EncryptionConfig{CurrentKey: "v1", Keys: map[string]string{"v1": "!"}},
+			err:  "can't decode encryption key v1",
+		},
+		{
+			name: "version with colon",
+			cfg:  store.EncryptionConfig{CurrentKey: "v:1", Keys: map[string]string{"v:1": testKey('a')}},
+			err:  `invalid encryption key version "v:1"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := store.NewStaticKeyProvider(test.cfg)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			version, key, err := p.CurrentKey(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "v1", version)
+			assert.Len(t, key, store.KeySize)
+		})
+	}
+}
+
+func TestCipher(t *testing.T) {
+	ctx := context.Background()
+	link := "https://example.com/secret?token=1"
+	p1, err := store.NewStaticKeyProvider(store.EncryptionConfig{CurrentKey: "v1", Keys: map[string]string{"v1": testKey('a')}})
+	require.NoError(t, err)
+	p2, err := store.NewStaticKeyProvider(store.EncryptionConfig{CurrentKey: "v2", Keys: map[string]string{"v1": testKey('a'), "v2": testKey('b')}})
+	require.NoError(t, err)
+	c1 := store.NewCipher(p1)
+	c2 := store.NewCipher(p2)
+
+	enc, err := c1.Encrypt(ctx, "id1", link)
+	require.NoError(t, err)
+	assert.True(t, store.IsEncrypted(enc))
+	assert.NotContains(t, enc, "example.com")
+	version, ok := store.KeyVersion(enc)
+	assert.True(t, ok)
+	assert.Equal(t, "v1", version)
+
+	t.Run("nonce is random", func(t *testing.T) {
+		again, err := c1.Encrypt(ctx, "id1", link)
+		require.NoError(t, err)
+		assert.NotEqual(t, enc, again)
+	})
+
+	t.Run("decrypt with old key after rotation", func(t *testing.T) {
+		plain, err := c2.Decrypt(ctx, "id1", enc)
+		require.NoError(t, err)
+		assert.Equal(t, link, plain)
+
+		rotated, err := c2.Encrypt(ctx, "id1", plain)
+		require.NoError(t, err)
+		version, _ := store.KeyVersion(rotated)
+		assert.Equal(t, "v2", version)
+	})
+
+	t.Run("value is bound to id", func(t *testing.T) {
+		_, err := c1.Decrypt(ctx, "id2", enc)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		rotated, err := c2.Encrypt(ctx, "id1", link)
+		require.NoError(t, err)
+		_, err = c1.Decrypt(ctx, "id1", rotated)
+		assert.ErrorContains(t, err, `encryption key "v2" is not set`)
+	})
+
+	t.Run("plain value", func(t *testing.T) {
+		plain, err := c1.Decrypt(ctx, "id1", link)
+		require.NoError(t, err)
+		assert.Equal(t, link, plain)
+		_, ok := store.KeyVersion(link)
+		assert.False(t, ok)
+	})
+
+	t.Run("empty value", func(t *testing.T) {
+		enc, err := c1.Encrypt(ctx, "id1", "")
+		require.NoError(t, err)
+		assert.Empty(t, enc)
+	})
+}
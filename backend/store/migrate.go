@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/mongodb"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// migrations are applied in order of their version, applied versions are
+// tracked in schema_migrations collection. Collections are renamed as
+// configured when migrations are read.
+//
+//go:embed migrations/*.json
+var migrations embed.FS
+
+// Migrate applies all pending migrations to the database. Advisory lock is
+// held while migrating, so only one instance runs migrations at a time.
+func Migrate(client *mongo.Client, dbName string, cols Collections, logger *zap.Logger) error {
+	instance, err := mongodb.WithInstance(client, &mongodb.Config{
+		DatabaseName:         dbName,
+		MigrationsCollection: cols.Name(MigrationsCollection),
+		Locking: mongodb.Locking{
+			CollectionName: cols.Name(MigrationsLockCollection),
+			Enabled:        true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("can't create migration driver: %w", err)
+	}
+
+	version, _, err := instance.Version()
+	if err != nil {
+		return fmt.Errorf("can't get migration version: %w", err)
+	}
+	if err = preflight(context.Background(), client.Database(dbName), cols, version, logger); err != nil {
+		return err
+	}
+
+	return RunMigrations(instance, dbName, cols, logger)
+}
+
+// preflights check data migration of the version would fail on, so conflicts
+// are reported to be resolved by hand instead of being merged
+var preflights = map[int]func(ctx context.Context, db *mongo.Database, cols Collections, logger *zap.Logger) error{
+	15: checkDuplicateEmails,
+}
+
+// preflight runs checks of migrations pending after version
+func preflight(ctx context.Context, db *mongo.Database, cols Collections, version int, logger *zap.Logger) error {
+	for v, check := range preflights {
+		if v <= version {
+			continue
+		}
+		if err := check(ctx, db, cols, logger); err != nil {
+			return fmt.Errorf("migration %d preflight failed: %w", v, err)
+		}
+	}
+	return nil
+}
+
+// DuplicateEmail represents users whose emails differ only in case or
+// surrounding spaces
+type DuplicateEmail struct {
+	Email  string               `bson:"_id"`
+	Emails []string             `bson:"emails"`
+	Users  []primitive.ObjectID `bson:"users"`
+}
+
+// FindDuplicateEmails returns groups of users whose emails are the same once
+// normalized
+func FindDuplicateEmails(ctx context.Context, db *mongo.Database, cols Collections) ([]DuplicateEmail, error) {
+	pipeline := bson.A{
+		bson.D{primitive.E{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$toLower", Value: bson.D{
+				primitive.E{Key: "$trim", Value: bson.D{primitive.E{Key: "input", Value: "$email"}}},
+			}}}},
+			primitive.E{Key: "emails", Value: bson.D{primitive.E{Key: "$push", Value: "$email"}}},
+			primitive.E{Key: "users", Value: bson.D{primitive.E{Key: "$push", Value: "$_id"}}},
+			primitive.E{Key: "n", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "n", Value: bson.D{primitive.E{Key: "$gt", Value: 1}}}}}},
+		bson.D{primitive.E{Key: "$sort", Value: bson.D{primitive.E{Key: "_id", Value: 1}}}},
+	}
+
+	cur, err := db.Collection(cols.Name(UserCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("can't find duplicate emails: %w", err)
+	}
+
+	result := make([]DuplicateEmail, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("duplicate emails cursor error: %w", err)
+	}
+
+	return result, nil
+}
+
+// checkDuplicateEmails logs every group of duplicate emails, unique index
+// can't be created until they are resolved
+func checkDuplicateEmails(ctx context.Context, db *mongo.Database, cols Collections, logger *zap.Logger) error {
+	dups, err := FindDuplicateEmails(ctx, db, cols)
+	if err != nil {
+		return err
+	}
+	if len(dups) == 0 {
+		return nil
+	}
+
+	emails := make([]string, 0, len(dups))
+	for _, d := range dups {
+		ids := make([]string, 0, len(d.Users))
+		for _, id := range d.Users {
+			ids = append(ids, id.Hex())
+		}
+		logger.Error("users have the same email", zap.String("email", d.Email), zap.Strings("emails", d.Emails), zap.Strings("userids", ids))
+		emails = append(emails, d.Email)
+	}
+
+	return fmt.Errorf("%d emails are used by several users, change or delete them: %s", len(dups), strings.Join(emails, ", "))
+}
+
+// RunMigrations applies all pending migrations using given database driver
+func RunMigrations(instance database.Driver, dbName string, cols Collections, logger *zap.Logger) error {
+	src, err := iofs.New(migrationFS{FS: migrations, collections: cols}, "migrations")
+	if err != nil {
+		return fmt.Errorf("can't read migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, dbName, instance)
+	if err != nil {
+		return fmt.Errorf("can't create migrator: %w", err)
+	}
+
+	err = m.Up()
+	if errors.Is(err, migrate.ErrNoChange) {
+		logger.Info("migrations: no change")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't apply migrations: %w", err)
+	}
+
+	version, _, err := m.Version()
+	if err != nil {
+		return fmt.Errorf("can't get migration version: %w", err)
+	}
+	logger.Info("migrations applied", zap.Uint("version", version))
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestRunMigrations(t *testing.T) {
+	instance, err := stub.WithInstance(nil, &stub.Config{})
+	require.NoError(t, err)
+	s := instance.(*stub.Stub)
+
+	err = store.RunMigrations(instance, "shortener", store.Collections{}, zap.NewNop())
+	require.NoError(t, err)
+	files, err := filepath.Glob("migrations/*.up.json")
+	require.NoError(t, err)
+	assert.Len(t, s.MigrationSequence, len(files))
+	assert.Equal(t, len(files), s.CurrentVersion)
+	assert.False(t, s.IsDirty)
+
+	// second run must not apply anything
+	err = store.RunMigrations(instance, "shortener", store.Collections{}, zap.NewNop())
+	require.NoError(t, err)
+	assert.Len(t, s.MigrationSequence, len(files))
+	assert.Equal(t, len(files), s.CurrentVersion)
+}
+
+func TestMigrationFiles(t *testing.T) {
+	files, err := filepath.Glob("migrations/*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, f := range files {
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			data, err := os.ReadFile(f)
+			require.NoError(t, err)
+
+			var commands []map[string]interface{}
+			assert.NoError(t, json.Unmarshal(data, &commands))
+		})
+	}
+}
+
+func TestFindDuplicateEmails(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("duplicates", func(mt *mtest.T) {
+		first, second := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "shortener.user", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "user@example.com"},
+				{Key: "emails", Value: bson.A{"user@example.com", "User@Example.com"}},
+				{Key: "users", Value: bson.A{first, second}},
+				{Key: "n", Value: 2},
+			}),
+			mtest.CreateCursorResponse(0, "shortener.user", mtest.NextBatch),
+		)
+
+		dups, err := store.FindDuplicateEmails(context.Background(), mt.DB, store.Collections{})
+
+		require.NoError(mt, err)
+		require.Len(mt, dups, 1)
+		assert.Equal(mt, "user@example.com", dups[0].Email)
+		assert.Equal(mt, []string{"user@example.com", "User@Example.com"}, dups[0].Emails)
+		assert.Equal(mt, []primitive.ObjectID{first, second}, dups[0].Users)
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		assert.Equal(mt, "$email", pipeline.Index(0).Value().Document().Lookup("$group", "_id", "$toLower", "$trim", "input").StringValue())
+	})
+
+	mt.Run("none", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "shortener.user", mtest.FirstBatch))
+
+		dups, err := store.FindDuplicateEmails(context.Background(), mt.DB, store.Collections{})
+
+		require.NoError(mt, err)
+		assert.Empty(mt, dups)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+
+		_, err := store.FindDuplicateEmails(context.Background(), mt.DB, store.Collections{})
+
+		assert.Error(mt, err)
+	})
+}
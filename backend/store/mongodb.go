@@ -2,19 +2,16 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
+	"time"
 
-	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/zap"
-
-	"github.com/semka95/shortener/backend/domain"
 )
 
 // MongoConfig stores MongoDB configuration
@@ -23,75 +20,126 @@ type MongoConfig struct {
 	User     string `yaml:"user"`
 	Password string `yaml:"pwd"`
 	HostPort string `yaml:"host_port"`
+	// SlowOpThreshold is the duration in milliseconds after which repository
+	// operation is logged as slow, zero disables logging
+	SlowOpThreshold int `yaml:"slow_op_threshold_ms"`
+	// BreakerThreshold is the number of consecutive failed repository
+	// operations that opens circuit breaker, zero disables breaker
+	BreakerThreshold int `yaml:"breaker_failure_threshold"`
+	// BreakerOpenTimeout is the duration in milliseconds after which open
+	// breaker lets probe operation through
+	BreakerOpenTimeout int `yaml:"breaker_open_timeout_ms"`
+	// CacheSize is the number of URLs cached by id, zero disables the cache
+	CacheSize int `yaml:"cache_size"`
+	// CacheTTL is the duration in milliseconds URLs are cached for
+	CacheTTL int `yaml:"cache_ttl_ms"`
+	// CacheNegativeTTL is the duration in milliseconds ids of missing URLs
+	// are cached for
+	CacheNegativeTTL int `yaml:"cache_negative_ttl_ms"`
+	// OwnerCacheSize is the number of URL owners whose status is cached for
+	// redirects, zero disables the cache
+	OwnerCacheSize int `yaml:"owner_cache_size"`
+	// OwnerCacheTTL is the duration in milliseconds status of URL owners is
+	// cached for, owner disabled through other instance keeps redirecting
+	// until then
+	OwnerCacheTTL int `yaml:"owner_cache_ttl_ms"`
+	// CacheStaleTTL is the duration in milliseconds expired URLs are kept
+	// for, they are served while breaker is open, so redirects survive
+	// database outage
+	CacheStaleTTL int `yaml:"cache_stale_ttl_ms"`
+	// CacheWarmupSize is the number of URLs with most clicks loaded into the
+	// cache before serving, zero disables warm-up
+	CacheWarmupSize int `yaml:"cache_warmup_size"`
+	// CacheWarmupBudget is the duration in milliseconds warm-up may take,
+	// zero disables warm-up
+	CacheWarmupBudget int `yaml:"cache_warmup_budget_ms"`
+	// BloomCapacity is the number of URL ids bloom filter is sized for, zero
+	// disables the filter
+	BloomCapacity int `yaml:"bloom_capacity"`
+	// BloomFalsePositiveRate is the rate of missing ids bloom filter lets
+	// through to the backend when it holds BloomCapacity ids
+	BloomFalsePositiveRate float64 `yaml:"bloom_false_positive_rate"`
+	// BloomRebuild is the interval of bloom filter rebuild in seconds
+	BloomRebuild int `yaml:"bloom_rebuild_seconds"`
+	// RedirectReadPreference is read preference mode of redirect lookups,
+	// e.g. nearest or secondaryPreferred, other reads are served by primary
+	RedirectReadPreference string `yaml:"redirect_read_preference"`
+	// RedirectMaxStaleness is how far in seconds secondary serving redirect
+	// lookups may lag behind primary
+	RedirectMaxStaleness int `yaml:"redirect_max_staleness_seconds"`
+	// Encryption configures encryption of URL destinations at rest
+	Encryption EncryptionConfig `yaml:"encryption"`
+	// Shadow configures shadowing of collections by name, e.g. url or user
+	Shadow map[string]ShadowConfig `yaml:"shadow"`
+	// Collections configures names of collections
+	Collections Collections `yaml:"collections"`
 }
 
-// Open creates MongoDB client
-func Open(ctx context.Context, cfg MongoConfig, logger *zap.Logger) (*mongo.Client, error) {
-	uri := url.URL{
-		Scheme: "mongodb",
-		User:   url.UserPassword(cfg.User, cfg.Password),
-		Host:   cfg.HostPort,
-	}
+// Bounds of MongoConfig.RedirectMaxStaleness, MongoDB doesn't accept max
+// staleness below 90 seconds
+const (
+	DefaultMaxStaleness = 90
+	MinMaxStaleness     = 90
+	MaxMaxStaleness     = 3600
+)
 
-	if cfg.User == "" || cfg.Password == "" {
-		uri.User = nil
+// RedirectReadPref returns read preference of redirect lookups, secondary
+// reads are always bounded by max staleness
+func (cfg MongoConfig) RedirectReadPref() (*readpref.ReadPref, error) {
+	if cfg.RedirectReadPreference == "" {
+		cfg.RedirectReadPreference = readpref.PrimaryMode.String()
 	}
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri.String()))
+	mode, err := readpref.ModeFromString(cfg.RedirectReadPreference)
 	if err != nil {
-		return nil, fmt.Errorf("mongodb connection problem: %w", err)
+		return nil, fmt.Errorf("invalid redirect read preference: %w", err)
 	}
 
-	if err = client.Ping(ctx, readpref.Primary()); err != nil {
-		return nil, fmt.Errorf("ping error: %w", err)
+	if mode == readpref.PrimaryMode {
+		if cfg.RedirectMaxStaleness != 0 {
+			return nil, errors.New("redirect max staleness can't be used with primary read preference")
+		}
+		return readpref.Primary(), nil
 	}
-	logger.Info("mongodb ping: ok")
-
-	return client, nil
-}
-
-// StatusHandler represent the http handler for status check
-type StatusHandler struct {
-	DB *mongo.Database
-}
 
-// NewStatusHandler will initialize the /status endpoint
-func NewStatusHandler(e *echo.Echo, db *mongo.Database) {
-	handler := &StatusHandler{
-		DB: db,
+	staleness := cfg.RedirectMaxStaleness
+	if staleness == 0 {
+		staleness = DefaultMaxStaleness
+	}
+	if staleness < MinMaxStaleness || staleness > MaxMaxStaleness {
+		return nil, fmt.Errorf("redirect max staleness must be from %d to %d seconds", MinMaxStaleness, MaxMaxStaleness)
 	}
 
-	e.GET("/v1/status", handler.StatusCheckHandler)
+	return readpref.New(mode, readpref.WithMaxStaleness(time.Duration(staleness)*time.Second))
 }
 
-// StatusCheckHandler will get status of the database
-func (h *StatusHandler) StatusCheckHandler(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
+// Open creates MongoDB client, opts are applied after options of cfg
+func Open(ctx context.Context, cfg MongoConfig, logger *zap.Logger, opts ...*options.ClientOptions) (*mongo.Client, error) {
+	if err := cfg.Collections.Validate(); err != nil {
+		return nil, err
 	}
 
-	res, err := StatusCheck(ctx, h.DB)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, domain.ResponseError{Error: err.Error()})
+	uri := url.URL{
+		Scheme: "mongodb",
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   cfg.HostPort,
 	}
 
-	return c.JSON(http.StatusOK, res)
-}
+	if cfg.User == "" || cfg.Password == "" {
+		uri.User = nil
+	}
 
-// StatusCheck gets database status and metrics
-func StatusCheck(ctx context.Context, db *mongo.Database) (*bson.M, error) {
-	statCmd := bson.D{
-		primitive.E{Key: "serverStatus", Value: 1},
-		primitive.E{Key: "metrics", Value: 1},
+	opts = append([]*options.ClientOptions{options.Client().ApplyURI(uri.String())}, opts...)
+	client, err := mongo.Connect(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("mongodb connection problem: %w", err)
 	}
 
-	result := new(bson.M)
-	if err := db.RunCommand(ctx, statCmd).Decode(result); err != nil {
-		return nil, err
+	if err = client.Ping(ctx, readpref.Primary()); err != nil {
+		return nil, fmt.Errorf("ping error: %w", err)
 	}
+	logger.Info("mongodb ping: ok")
 
-	return result, nil
+	return client, nil
 }
 
 // StructToDoc transforms any struct to bson.D document
@@ -1,68 +1,50 @@
 package store_test
 
 import (
-	"encoding/json"
-	"net/http/httptest"
 	"testing"
+	"time"
 
-	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"github.com/semka95/shortener/backend/store"
 )
 
-func TestStatusCheck(t *testing.T) {
-	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
-	defer mt.Close()
-	mt.Run("success", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateSuccessResponse())
-		e := echo.New()
-		req := httptest.NewRequest(echo.GET, "/v1/status", nil)
+func TestMongoConfig_RedirectReadPref(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		staleness int
+		expected  readpref.Mode
+		maxStale  time.Duration
+		wantErr   bool
+	}{
+		{name: "default", expected: readpref.PrimaryMode},
+		{name: "primary", mode: "primary", expected: readpref.PrimaryMode},
+		{name: "primary with staleness", mode: "primary", staleness: 90, wantErr: true},
+		{name: "nearest default staleness", mode: "nearest", expected: readpref.NearestMode, maxStale: 90 * time.Second},
+		{name: "secondary preferred", mode: "secondaryPreferred", staleness: 120, expected: readpref.SecondaryPreferredMode, maxStale: 120 * time.Second},
+		{name: "staleness too low", mode: "nearest", staleness: 60, wantErr: true},
+		{name: "staleness too high", mode: "nearest", staleness: 3601, wantErr: true},
+		{name: "invalid mode", mode: "anywhere", wantErr: true},
+	}
 
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-		c.SetPath("/v1/status")
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := store.MongoConfig{RedirectReadPreference: tc.mode, RedirectMaxStaleness: tc.staleness}
 
-		handler := store.StatusHandler{
-			DB: mt.Client.Database("shortener"),
-		}
-
-		err := handler.StatusCheckHandler(c)
-		assert.NoError(t, err)
-
-		body := make(map[string]interface{})
-		err = json.NewDecoder(rec.Body).Decode(&body)
-		require.NoError(t, err)
-
-	})
-	mt.Run("error", func(mt *mtest.T) {
-		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
-			Code:    1,
-			Message: "test",
-			Name:    "123",
-			Labels:  []string{},
-		}))
-		e := echo.New()
-		req := httptest.NewRequest(echo.GET, "/v1/status", nil)
-
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-		c.SetPath("/v1/status")
-
-		handler := store.StatusHandler{
-			DB: mt.Client.Database("shortener"),
-		}
-
-		err := handler.StatusCheckHandler(c)
-		assert.NoError(t, err)
-
-		body := make(map[string]interface{})
-		err = json.NewDecoder(rec.Body).Decode(&body)
-		require.NoError(t, err)
-		assert.Equal(mt, "(123) test", body["error"])
-	})
+			rp, err := cfg.RedirectReadPref()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, rp.Mode())
+			maxStale, _ := rp.MaxStaleness()
+			assert.Equal(t, tc.maxStale, maxStale)
+		})
+	}
 }
 
 // func TestDatabase__ConnectionError(t *testing.T) {
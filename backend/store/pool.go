@@ -0,0 +1,55 @@
+package store
+
+import (
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// PoolStats counts connections of MongoDB connection pools by events of the
+// driver pool monitor, pass Monitor to Open to collect them
+type PoolStats struct {
+	open             atomic.Int64
+	inUse            atomic.Int64
+	checkoutFailures atomic.Int64
+}
+
+// NewPoolStats creates empty PoolStats
+func NewPoolStats() *PoolStats {
+	return &PoolStats{}
+}
+
+// Monitor returns pool monitor which updates stats
+func (p *PoolStats) Monitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: p.handle}
+}
+
+func (p *PoolStats) handle(e *event.PoolEvent) {
+	switch e.Type {
+	case event.ConnectionCreated:
+		p.open.Add(1)
+	case event.ConnectionClosed:
+		p.open.Add(-1)
+	case event.GetSucceeded:
+		p.inUse.Add(1)
+	case event.ConnectionReturned:
+		p.inUse.Add(-1)
+	case event.GetFailed:
+		p.checkoutFailures.Add(1)
+	}
+}
+
+// Open returns number of open connections
+func (p *PoolStats) Open() int64 {
+	return p.open.Load()
+}
+
+// InUse returns number of connections checked out of pools
+func (p *PoolStats) InUse() int64 {
+	return p.inUse.Load()
+}
+
+// CheckoutFailures returns number of failed connection checkouts
+func (p *PoolStats) CheckoutFailures() int64 {
+	return p.checkoutFailures.Load()
+}
@@ -0,0 +1,32 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestPoolStats(t *testing.T) {
+	stats := store.NewPoolStats()
+	monitor := stats.Monitor()
+
+	for _, typ := range []string{
+		event.ConnectionCreated,
+		event.ConnectionCreated,
+		event.GetSucceeded,
+		event.GetSucceeded,
+		event.ConnectionReturned,
+		event.GetFailed,
+		event.ConnectionClosed,
+		event.PoolCleared,
+	} {
+		monitor.Event(&event.PoolEvent{Type: typ})
+	}
+
+	assert.EqualValues(t, 1, stats.Open())
+	assert.EqualValues(t, 1, stats.InUse())
+	assert.EqualValues(t, 1, stats.CheckoutFailures())
+}
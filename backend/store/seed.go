@@ -12,13 +12,13 @@ import (
 )
 
 // Seed inserts data in database for development purposes
-func Seed(ctx context.Context, db *mongo.Database) error {
+func Seed(ctx context.Context, db *mongo.Database, cols Collections) error {
 	collections := make(map[string][]interface{}, 2)
 	timeNow := time.Now().Truncate(time.Millisecond).UTC()
 	expTime := time.Now().Add(time.Hour).Truncate(time.Millisecond).UTC()
 	roles := []string{auth.RoleUser}
 
-	collections["url"] = []interface{}{
+	collections[URLCollection] = []interface{}{
 		domain.URL{
 			ID:             "google",
 			Link:           "https://www.google.com",
@@ -63,7 +63,7 @@ func Seed(ctx context.Context, db *mongo.Database) error {
 		},
 	}
 
-	collections["user"] = []interface{}{
+	collections[UserCollection] = []interface{}{
 		domain.User{
 			ID:             primitive.NewObjectID(),
 			FullName:       "User 1",
@@ -121,7 +121,7 @@ func Seed(ctx context.Context, db *mongo.Database) error {
 	}
 
 	for k, v := range collections {
-		res, err := db.Collection(k).InsertMany(ctx, v)
+		res, err := db.Collection(cols.Name(k)).InsertMany(ctx, v)
 		if err != nil || len(res.InsertedIDs) == 0 {
 			return err
 		}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// DefaultShadowQueueSize is the number of reads waiting to be repeated used
+// when ShadowConfig.QueueSize is not set
+const DefaultShadowQueueSize = 1000
+
+// ShadowConfig configures shadowing of collection by repository in another
+// database, e.g. the one collection is migrated to
+type ShadowConfig struct {
+	// Database is the name of MongoDB database reads are repeated against and
+	// writes are copied to, empty name disables shadowing
+	Database string `yaml:"database"`
+	// TimestampTolerance is the difference in milliseconds between timestamps
+	// of compared documents which is not reported as mismatch
+	TimestampTolerance int `yaml:"timestamp_tolerance_ms"`
+	// QueueSize is the number of reads waiting to be repeated, reads are not
+	// repeated while queue is full
+	QueueSize int `yaml:"queue_size"`
+}
+
+// ShadowResult is the result of read repeated against secondary repository
+type ShadowResult int
+
+const (
+	// ShadowMatch means that secondary returned the same result
+	ShadowMatch ShadowResult = iota
+	// ShadowMismatch means that secondary returned different result
+	ShadowMismatch
+	// ShadowFailed means that secondary failed to read
+	ShadowFailed
+	// ShadowDropped means that read was not repeated as queue was full
+	ShadowDropped
+)
+
+func (r ShadowResult) String() string {
+	switch r {
+	case ShadowMatch:
+		return "match"
+	case ShadowMismatch:
+		return "mismatch"
+	case ShadowFailed:
+		return "failed"
+	case ShadowDropped:
+		return "dropped"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+type shadowRead struct {
+	op         string
+	primary    interface{}
+	primaryErr error
+	secondary  func(ctx context.Context) (interface{}, error)
+}
+
+// Shadow verifies secondary repository against primary one. Reads served by
+// primary are repeated against secondary in background and their results
+// are compared, timestamps may differ by tolerance. Writes are copied to
+// secondary after primary succeeded, errors of secondary are logged but not
+// returned. Primary results are copied before they are queued, so callers
+// may change them.
+type Shadow struct {
+	name      string
+	tolerance time.Duration
+	timeout   time.Duration
+	logger    *zap.Logger
+	queue     chan shadowRead
+
+	reads       [ShadowDropped + 1]atomic.Int64
+	writeErrors atomic.Int64
+}
+
+// NewShadow creates Shadow of collection name, secondary reads and writes
+// are given timeout. Reads are repeated once Run is called.
+func NewShadow(name string, tolerance, timeout time.Duration, queueSize int, logger *zap.Logger) *Shadow {
+	if queueSize <= 0 {
+		queueSize = DefaultShadowQueueSize
+	}
+
+	return &Shadow{
+		name:      name,
+		tolerance: tolerance,
+		timeout:   timeout,
+		logger:    logger.With(zap.String("collection", name)),
+		queue:     make(chan shadowRead, queueSize),
+	}
+}
+
+// Name returns name of shadowed collection
+func (s *Shadow) Name() string {
+	return s.name
+}
+
+// Reads returns number of reads repeated against secondary with result
+func (s *Shadow) Reads(r ShadowResult) int64 {
+	return s.reads[r].Load()
+}
+
+// WriteErrors returns number of writes secondary failed
+func (s *Shadow) WriteErrors() int64 {
+	return s.writeErrors.Load()
+}
+
+// Read queues read of operation op to be repeated by secondary, primary is
+// the result and primaryErr is the error returned by primary. Read never
+// blocks, it is dropped when queue is full.
+func (s *Shadow) Read(op string, primary interface{}, primaryErr error, secondary func(ctx context.Context) (interface{}, error)) {
+	read := shadowRead{
+		op:         op,
+		primaryErr: primaryErr,
+		secondary:  secondary,
+	}
+	if primary != nil {
+		read.primary = deepCopy(reflect.ValueOf(primary)).Interface()
+	}
+
+	select {
+	case s.queue <- read:
+	default:
+		s.reads[ShadowDropped].Add(1)
+	}
+}
+
+// Write copies write of operation op to secondary
+func (s *Shadow) Write(ctx context.Context, op string, secondary func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if err := secondary(ctx); err != nil {
+		s.writeErrors.Add(1)
+		s.logger.Warn("shadow write failed", zap.String("operation", op), zap.Error(err))
+	}
+}
+
+// Run repeats queued reads until ctx is done
+func (s *Shadow) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case read := <-s.queue:
+			s.compare(ctx, read)
+		}
+	}
+}
+
+func (s *Shadow) compare(ctx context.Context, read shadowRead) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	secondary, err := read.secondary(ctx)
+	primaryClass, secondaryClass := errorClass(read.primaryErr), errorClass(err)
+	switch {
+	case secondaryClass == errClassFailed && primaryClass != errClassFailed:
+		s.reads[ShadowFailed].Add(1)
+		s.logger.Warn("shadow read failed", zap.String("operation", read.op), zap.Error(err))
+	case primaryClass != secondaryClass:
+		s.reads[ShadowMismatch].Add(1)
+		s.logger.Warn("shadow read mismatch",
+			zap.String("operation", read.op),
+			zap.NamedError("primary_error", read.primaryErr),
+			zap.NamedError("secondary_error", err),
+		)
+	case primaryClass != errClassNone:
+		s.reads[ShadowMatch].Add(1)
+	default:
+		path, equal := shadowDiff(reflect.ValueOf(read.primary), reflect.ValueOf(secondary), s.tolerance, "")
+		if equal {
+			s.reads[ShadowMatch].Add(1)
+			return
+		}
+		s.reads[ShadowMismatch].Add(1)
+		s.logger.Warn("shadow read mismatch",
+			zap.String("operation", read.op),
+			zap.String("field", strings.TrimPrefix(path, ".")),
+		)
+	}
+}
+
+// classes of errors compared by shadow reads
+const (
+	errClassNone = iota
+	errClassNotFound
+	errClassFailed
+)
+
+func errorClass(err error) int {
+	switch {
+	case err == nil:
+		return errClassNone
+	case errors.Is(err, domain.ErrNotFound), errors.Is(err, domain.ErrNoAffected):
+		return errClassNotFound
+	default:
+		return errClassFailed
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// shadowDiff compares exported fields of a and b, timestamps are equal when
+// they differ by tolerance at most. It returns path of the first different
+// field.
+func shadowDiff(a, b reflect.Value, tolerance time.Duration, path string) (string, bool) {
+	if !a.IsValid() || !b.IsValid() {
+		return path, a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return path, false
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return path, a.IsNil() == b.IsNil()
+		}
+		return shadowDiff(a.Elem(), b.Elem(), tolerance, path)
+	case reflect.Struct:
+		if a.Type() == timeType {
+			d := a.Interface().(time.Time).Sub(b.Interface().(time.Time))
+			return path, d <= tolerance && d >= -tolerance
+		}
+		for i := 0; i < a.NumField(); i++ {
+			f := a.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if p, ok := shadowDiff(a.Field(i), b.Field(i), tolerance, path+"."+f.Name); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return path, false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if p, ok := shadowDiff(a.Index(i), b.Index(i), tolerance, fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return path, false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			if p, ok := shadowDiff(iter.Value(), b.MapIndex(iter.Key()), tolerance, fmt.Sprintf("%s[%v]", path, iter.Key())); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	default:
+		return path, a.Interface() == b.Interface()
+	}
+}
+
+// deepCopy copies v along with values its exported fields refer to
+func deepCopy(v reflect.Value) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+		}
+		return c
+	default:
+		return v
+	}
+}
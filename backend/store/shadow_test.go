@@ -0,0 +1,191 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type shadowDoc struct {
+	ID        string
+	Tags      []string
+	Meta      map[string]string
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+	hidden    int
+}
+
+func TestShadow_Read(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Minute)
+	doc := func() *shadowDoc {
+		return &shadowDoc{ID: "a", Tags: []string{"x"}, Meta: map[string]string{"k": "v"}, UpdatedAt: now, hidden: 1}
+	}
+
+	tests := []struct {
+		name         string
+		primaryErr   error
+		secondary    func(d *shadowDoc) *shadowDoc
+		secondaryErr error
+		result       store.ShadowResult
+		field        string
+	}{
+		{
+			name:      "equal",
+			secondary: func(d *shadowDoc) *shadowDoc { return d },
+			result:    store.ShadowMatch,
+		},
+		{
+			name: "timestamp within tolerance",
+			secondary: func(d *shadowDoc) *shadowDoc {
+				d.UpdatedAt = now.Add(500 * time.Millisecond)
+				return d
+			},
+			result: store.ShadowMatch,
+		},
+		{
+			name: "unexported field is ignored",
+			secondary: func(d *shadowDoc) *shadowDoc {
+				d.hidden = 2
+				return d
+			},
+			result: store.ShadowMatch,
+		},
+		{
+			name: "timestamp beyond tolerance",
+			secondary: func(d *shadowDoc) *shadowDoc {
+				d.UpdatedAt = now.Add(2 * time.Second)
+				return d
+			},
+			result: store.ShadowMismatch,
+			field:  "UpdatedAt",
+		},
+		{
+			name: "different slice element",
+			secondary: func(d *shadowDoc) *shadowDoc {
+				d.Tags = []string{"y"}
+				return d
+			},
+			result: store.ShadowMismatch,
+			field:  "Tags[0]",
+		},
+		{
+			name: "different map value",
+			secondary: func(d *shadowDoc) *shadowDoc {
+				d.Meta = map[string]string{"k": "w"}
+				return d
+			},
+			result: store.ShadowMismatch,
+			field:  "Meta[k]",
+		},
+		{
+			name: "nil pointer",
+			secondary: func(d *shadowDoc) *shadowDoc {
+				d.DeletedAt = &later
+				return d
+			},
+			result: store.ShadowMismatch,
+			field:  "DeletedAt",
+		},
+		{
+			name:         "missing in secondary",
+			secondary:    func(d *shadowDoc) *shadowDoc { return nil },
+			secondaryErr: domain.ErrNotFound,
+			result:       store.ShadowMismatch,
+		},
+		{
+			name:         "missing in both",
+			primaryErr:   domain.ErrNotFound,
+			secondary:    func(d *shadowDoc) *shadowDoc { return nil },
+			secondaryErr: fmt.Errorf("URL was not found: %w", domain.ErrNotFound),
+			result:       store.ShadowMatch,
+		},
+		{
+			name:         "secondary failed",
+			secondary:    func(d *shadowDoc) *shadowDoc { return nil },
+			secondaryErr: errors.New("connection refused"),
+			result:       store.ShadowFailed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			s := store.NewShadow("url", time.Second, time.Second, 10, zap.New(core))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go s.Run(ctx)
+
+			primary := doc()
+			if test.primaryErr != nil {
+				primary = nil
+			}
+			s.Read("GetByID", primary, test.primaryErr, func(ctx context.Context) (interface{}, error) {
+				return test.secondary(doc()), test.secondaryErr
+			})
+
+			require.Eventually(t, func() bool { return s.Reads(test.result) == 1 }, time.Second, time.Millisecond)
+			if test.result == store.ShadowMatch {
+				assert.Zero(t, logs.Len())
+				return
+			}
+			require.Equal(t, 1, logs.Len())
+			assert.Equal(t, "GetByID", logs.All()[0].ContextMap()["operation"])
+			if test.field != "" {
+				assert.Equal(t, test.field, logs.All()[0].ContextMap()["field"])
+			}
+		})
+	}
+}
+
+func TestShadow_ReadCopiesPrimary(t *testing.T) {
+	s := store.NewShadow("url", 0, time.Second, 10, zap.NewNop())
+	primary := &shadowDoc{ID: "a", Tags: []string{"x"}}
+	s.Read("GetByID", primary, nil, func(ctx context.Context) (interface{}, error) {
+		return &shadowDoc{ID: "a", Tags: []string{"x"}}, nil
+	})
+	// caller changes result before it is compared
+	primary.ID = "b"
+	primary.Tags[0] = "y"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	require.Eventually(t, func() bool { return s.Reads(store.ShadowMatch) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestShadow_ReadDropped(t *testing.T) {
+	s := store.NewShadow("url", 0, time.Second, 1, zap.NewNop())
+	read := func(ctx context.Context) (interface{}, error) { return 1, nil }
+
+	s.Read("Count", 1, nil, read)
+	s.Read("Count", 1, nil, read)
+
+	assert.EqualValues(t, 1, s.Reads(store.ShadowDropped))
+}
+
+func TestShadow_Write(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := store.NewShadow("url", 0, time.Second, 1, zap.New(core))
+
+	s.Write(context.Background(), "Store", func(ctx context.Context) error { return nil })
+	assert.Zero(t, s.WriteErrors())
+
+	s.Write(context.Background(), "Store", func(ctx context.Context) error { return errors.New("test") })
+	assert.EqualValues(t, 1, s.WriteErrors())
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "url", logs.All()[0].ContextMap()["collection"])
+	assert.Equal(t, "test", logs.All()[0].ContextMap()["error"])
+}
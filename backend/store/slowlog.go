@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// maxFilterLength is the maximum length of filter written to slow operation log
+const maxFilterLength = 200
+
+// SlowOpLogger measures repository operations and logs ones that take longer
+// than threshold. Zero threshold disables logging, durations are still added
+// to the active span.
+type SlowOpLogger struct {
+	threshold time.Duration
+	logger    *zap.Logger
+}
+
+// NewSlowOpLogger creates SlowOpLogger with given threshold
+func NewSlowOpLogger(threshold time.Duration, logger *zap.Logger) *SlowOpLogger {
+	return &SlowOpLogger{
+		threshold: threshold,
+		logger:    logger,
+	}
+}
+
+// Start starts timing of operation on collection, returned function must be
+// called when operation is finished
+func (s *SlowOpLogger) Start(ctx context.Context, op, collection string, filter interface{}) func() {
+	start := time.Now()
+
+	return func() {
+		d := time.Since(start)
+
+		trace.SpanFromContext(ctx).AddEvent("repository operation", trace.WithAttributes(
+			attribute.String("db.operation", op),
+			attribute.String("db.collection", collection),
+			attribute.Int64("db.duration_ms", d.Milliseconds()),
+		))
+
+		if s.threshold <= 0 || d < s.threshold {
+			return
+		}
+
+		f := fmt.Sprintf("%+v", filter)
+		if len(f) > maxFilterLength {
+			f = f[:maxFilterLength] + "..."
+		}
+		s.logger.Warn("slow repository operation",
+			zap.String("operation", op),
+			zap.String("collection", collection),
+			zap.String("duration", d.String()),
+			zap.String("filter", f),
+		)
+	}
+}
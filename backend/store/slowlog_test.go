@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestSlowOpLogger(t *testing.T) {
+	t.Run("slow operation is logged", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		s := store.NewSlowOpLogger(time.Millisecond, zap.New(core))
+
+		done := s.Start(context.Background(), "GetByID", "url", strings.Repeat("a", 300))
+		time.Sleep(2 * time.Millisecond)
+		done()
+
+		require.Equal(t, 1, logs.Len())
+		entry := logs.All()[0]
+		assert.Equal(t, zapcore.WarnLevel, entry.Level)
+		fields := entry.ContextMap()
+		assert.Equal(t, "GetByID", fields["operation"])
+		assert.Equal(t, "url", fields["collection"])
+		assert.Equal(t, strings.Repeat("a", 200)+"...", fields["filter"])
+	})
+
+	t.Run("fast operation is not logged", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		s := store.NewSlowOpLogger(time.Hour, zap.New(core))
+
+		s.Start(context.Background(), "GetByID", "url", "id")()
+
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("zero threshold disables logging", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		s := store.NewSlowOpLogger(0, zap.New(core))
+
+		s.Start(context.Background(), "GetByID", "url", "id")()
+
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("duration is added to span", func(t *testing.T) {
+		sr := tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("")
+		ctx, span := tracer.Start(context.Background(), "usecase GetByID")
+		s := store.NewSlowOpLogger(0, zap.NewNop())
+
+		s.Start(ctx, "GetByID", "url", "id")()
+		span.End()
+
+		spans := sr.Ended()
+		require.Len(t, spans, 1)
+		require.Len(t, spans[0].Events(), 1)
+		assert.Equal(t, "repository operation", spans[0].Events()[0].Name)
+	})
+}
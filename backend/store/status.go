@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/semka95/shortener/backend/buildinfo"
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Statuses of repositories reported by status check
+const (
+	RepositoryUp   = "up"
+	RepositoryDown = "down"
+)
+
+// RepositoryStatus represents status of repository storage, Stats are
+// reported only when storage is up
+type RepositoryStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	*domain.RepositoryStats
+}
+
+// Status represents status of the service
+type Status struct {
+	Build        buildinfo.Info              `json:"build"`
+	Repositories map[string]RepositoryStatus `json:"repositories"`
+}
+
+// StatusHandler represent the http handler for status check, Repos are
+// checked by name
+type StatusHandler struct {
+	Repos map[string]domain.HealthChecker
+}
+
+// NewStatusHandler will initialize the /status endpoint
+func NewStatusHandler(e *echo.Echo, repos map[string]domain.HealthChecker) {
+	handler := &StatusHandler{
+		Repos: repos,
+	}
+
+	e.GET("/v1/status", handler.StatusCheckHandler)
+}
+
+// StatusCheckHandler will check storage of every repository, it responds with
+// 503 when any of them is down
+func (h *StatusHandler) StatusCheckHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	res := Status{
+		Build:        buildinfo.Get(),
+		Repositories: make(map[string]RepositoryStatus, len(h.Repos)),
+	}
+	code := http.StatusOK
+	for name, repo := range h.Repos {
+		status := StatusCheck(ctx, repo)
+		if status.Status != RepositoryUp {
+			code = http.StatusServiceUnavailable
+		}
+		res.Repositories[name] = status
+	}
+
+	return c.JSON(code, res)
+}
+
+// StatusCheck pings repository storage and gets its statistics
+func StatusCheck(ctx context.Context, repo domain.HealthChecker) RepositoryStatus {
+	if err := repo.Ping(ctx); err != nil {
+		return RepositoryStatus{Status: RepositoryDown, Error: err.Error()}
+	}
+
+	stats, err := repo.Stats(ctx)
+	if err != nil {
+		return RepositoryStatus{Status: RepositoryDown, Error: err.Error()}
+	}
+
+	return RepositoryStatus{Status: RepositoryUp, RepositoryStats: stats}
+}
@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/buildinfo"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+)
+
+func TestStatusCheck(t *testing.T) {
+	check := func(t *testing.T, repos map[string]domain.HealthChecker) (int, store.Status) {
+		e := echo.New()
+		req := httptest.NewRequest(echo.GET, "/v1/status", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/v1/status")
+
+		handler := store.StatusHandler{Repos: repos}
+		require.NoError(t, handler.StatusCheckHandler(c))
+
+		var body store.Status
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		return rec.Code, body
+	}
+
+	t.Run("success", func(t *testing.T) {
+		urls := tests.NewMemoryURLRepository()
+		require.NoError(t, urls.Store(context.Background(), tests.NewURL()))
+
+		code, body := check(t, map[string]domain.HealthChecker{
+			"url":  urls,
+			"user": tests.NewMemoryUserRepository(),
+		})
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, buildinfo.Default, body.Build.Version)
+		require.Contains(t, body.Repositories, "url")
+		assert.Equal(t, store.RepositoryUp, body.Repositories["url"].Status)
+		assert.EqualValues(t, 1, body.Repositories["url"].Documents)
+		require.Contains(t, body.Repositories, "user")
+		assert.Equal(t, store.RepositoryUp, body.Repositories["user"].Status)
+		assert.Zero(t, body.Repositories["user"].Documents)
+	})
+
+	t.Run("ping error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		urls := mock.NewMockURLRepository(ctrl)
+		urls.EXPECT().Ping(gomock.Any()).Return(errors.New("test"))
+
+		code, body := check(t, map[string]domain.HealthChecker{
+			"url":  urls,
+			"user": tests.NewMemoryUserRepository(),
+		})
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, store.RepositoryDown, body.Repositories["url"].Status)
+		assert.Equal(t, "test", body.Repositories["url"].Error)
+		assert.Nil(t, body.Repositories["url"].RepositoryStats)
+		assert.Equal(t, store.RepositoryUp, body.Repositories["user"].Status)
+	})
+
+	t.Run("stats error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		urls := mock.NewMockURLRepository(ctrl)
+		urls.EXPECT().Ping(gomock.Any()).Return(nil)
+		urls.EXPECT().Stats(gomock.Any()).Return(nil, errors.New("test"))
+
+		code, body := check(t, map[string]domain.HealthChecker{"url": urls})
+
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, store.RepositoryDown, body.Repositories["url"].Status)
+		assert.Equal(t, "test", body.Repositories["url"].Error)
+	})
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// illegalOperation is the code of error standalone server rejects
+// transactions with
+const illegalOperation = 20
+
+type mongoTransactor struct {
+	client *mongo.Client
+}
+
+// NewTransactor creates domain.Transactor running transactions in sessions
+// of client, transactions require replica set or sharded cluster
+func NewTransactor(client *mongo.Client) domain.Transactor {
+	return &mongoTransactor{client: client}
+}
+
+func (t *mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	sess, err := t.client.StartSession()
+	if err != nil {
+		return domain.InternalError("can't start session", err)
+	}
+	defer sess.EndSession(context.Background())
+
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == illegalOperation {
+		return domain.InternalError("transactions require replica set", err)
+	}
+	return err
+}
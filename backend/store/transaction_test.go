@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestTransactor_WithTransaction(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("commit", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}},
+		)
+
+		err := store.NewTransactor(mt.Client).WithTransaction(context.Background(), func(ctx context.Context) error {
+			_, err := mt.Coll.InsertOne(ctx, bson.D{{Key: "_id", Value: "test123"}})
+			return err
+		})
+
+		require.NoError(mt, err)
+		insert := mt.GetStartedEvent()
+		assert.Equal(mt, "insert", insert.CommandName)
+		assert.True(mt, insert.Command.Lookup("startTransaction").Boolean())
+		assert.Equal(mt, "commitTransaction", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("abort", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}},
+		)
+
+		err := store.NewTransactor(mt.Client).WithTransaction(context.Background(), func(ctx context.Context) error {
+			if _, err := mt.Coll.InsertOne(ctx, bson.D{{Key: "_id", Value: "test123"}}); err != nil {
+				return err
+			}
+			return domain.ErrConflict
+		})
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+		mt.GetStartedEvent()
+		assert.Equal(mt, "abortTransaction", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("standalone server", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    20,
+			Message: "Transaction numbers are only allowed on a replica set member or mongos",
+		}))
+
+		err := store.NewTransactor(mt.Client).WithTransaction(context.Background(), func(ctx context.Context) error {
+			_, err := mt.Coll.InsertOne(ctx, bson.D{{Key: "_id", Value: "test123"}})
+			return err
+		})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.ErrorContains(mt, err, "replica set")
+	})
+}
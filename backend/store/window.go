@@ -0,0 +1,101 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindow counts events of keys that happened within the last window,
+// e.g. failed logins of an account. At most limit latest events are kept for
+// every key, older ones are dropped. Keys with no events within the window
+// are removed, so memory is bounded by keys active within the window.
+type SlidingWindow struct {
+	window time.Duration
+	limit  int
+	now    func() time.Time
+
+	mu        sync.Mutex
+	events    map[string][]time.Time
+	lastSweep time.Time
+}
+
+// NewSlidingWindow creates empty SlidingWindow
+func NewSlidingWindow(window time.Duration, limit int) *SlidingWindow {
+	return &SlidingWindow{
+		window:    window,
+		limit:     limit,
+		now:       time.Now,
+		events:    make(map[string][]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetClock replaces clock used to expire events
+func (w *SlidingWindow) SetClock(now func() time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.now = now
+	w.lastSweep = now()
+}
+
+// Add records event of the key and returns number of its events within the
+// window, including the new one
+func (w *SlidingWindow) Add(key string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	w.sweep(now)
+	events := append(w.recent(key, now), now)
+	if len(events) > w.limit {
+		events = events[len(events)-w.limit:]
+	}
+	w.events[key] = events
+	return len(events)
+}
+
+// Count returns number of events of the key within the window
+func (w *SlidingWindow) Count(key string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	events := w.recent(key, w.now())
+	if len(events) == 0 {
+		delete(w.events, key)
+	} else {
+		w.events[key] = events
+	}
+	return len(events)
+}
+
+// Reset removes events of the key
+func (w *SlidingWindow) Reset(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.events, key)
+}
+
+// recent returns events of the key that are within the window at now
+func (w *SlidingWindow) recent(key string, now time.Time) []time.Time {
+	events := w.events[key]
+	start := now.Add(-w.window)
+	i := 0
+	for i < len(events) && !events[i].After(start) {
+		i++
+	}
+	return events[i:]
+}
+
+// sweep removes keys without events within the window, it runs at most once
+// per window
+func (w *SlidingWindow) sweep(now time.Time) {
+	if now.Sub(w.lastSweep) < w.window {
+		return
+	}
+	w.lastSweep = now
+	for key := range w.events {
+		if len(w.recent(key, now)) == 0 {
+			delete(w.events, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+func newTestWindow(limit int) (*store.SlidingWindow, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	w := store.NewSlidingWindow(time.Minute, limit)
+	w.SetClock(clock.Now)
+	return w, clock
+}
+
+func TestSlidingWindow_Count(t *testing.T) {
+	w, clock := newTestWindow(10)
+
+	assert.Equal(t, 0, w.Count("a"))
+	assert.Equal(t, 1, w.Add("a"))
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 2, w.Add("a"))
+	assert.Equal(t, 1, w.Add("b"))
+	assert.Equal(t, 2, w.Count("a"))
+
+	// events leave the window one by one
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 1, w.Count("a"))
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 0, w.Count("a"))
+	assert.Equal(t, 0, w.Count("b"))
+}
+
+func TestSlidingWindow_Limit(t *testing.T) {
+	w, clock := newTestWindow(3)
+
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, i, w.Add("a"))
+		clock.Advance(10 * time.Second)
+	}
+	// only the latest events are kept
+	assert.Equal(t, 3, w.Add("a"))
+	clock.Advance(45 * time.Second)
+	assert.Equal(t, 2, w.Count("a"))
+}
+
+func TestSlidingWindow_Reset(t *testing.T) {
+	w, _ := newTestWindow(10)
+
+	w.Add("a")
+	w.Add("a")
+	w.Add("b")
+	w.Reset("a")
+
+	assert.Equal(t, 0, w.Count("a"))
+	assert.Equal(t, 1, w.Count("b"))
+}
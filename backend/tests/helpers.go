@@ -95,7 +95,7 @@ func NewCreateURL() domain.CreateURL {
 func NewUpdateURL() domain.UpdateURL {
 	return domain.UpdateURL{
 		ID:             "test123",
-		ExpirationDate: time.Now().Add(time.Hour).Truncate(time.Millisecond).UTC(),
+		ExpirationDate: DatePointer(time.Now().Add(time.Hour).Truncate(time.Millisecond).UTC()),
 	}
 }
 
@@ -110,3 +110,38 @@ func NewURLBsonD() bson.D {
 		{Key: "updated_at", Value: time.Now().Truncate(time.Millisecond).UTC()},
 	}
 }
+
+// NewAuditEntry creates instance of AuditEntry model
+func NewAuditEntry() *domain.AuditEntry {
+	id, _ := primitive.ObjectIDFromHex("507f191e810c19729de860eb")
+	return &domain.AuditEntry{
+		ID:           id,
+		Action:       "DELETE /v1/url/:id",
+		ActorID:      "507f191e810c19729de860ea",
+		Impersonator: "507f191e810c19729de860ec",
+		EntityID:     "test123",
+		Status:       204,
+		CreatedAt:    time.Now().Truncate(time.Millisecond).UTC(),
+	}
+}
+
+// NewShortDomain creates instance of ShortDomain model
+func NewShortDomain() *domain.ShortDomain {
+	return &domain.ShortDomain{
+		Name:      "go.example.com",
+		CreatedBy: "507f191e810c19729de860ea",
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+}
+
+// NewBlockedDomain creates instance of BlockedDomain model
+func NewBlockedDomain() *domain.BlockedDomain {
+	id, _ := primitive.ObjectIDFromHex("507f191e810c19729de860ed")
+	return &domain.BlockedDomain{
+		ID:        id,
+		Domain:    "*.example.org",
+		Reason:    "phishing",
+		CreatedBy: "507f191e810c19729de860ea",
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+}
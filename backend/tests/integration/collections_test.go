@@ -0,0 +1,58 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/lock"
+	"github.com/semka95/shortener/backend/store"
+	_URLRepo "github.com/semka95/shortener/backend/url/repository"
+	_UserRepo "github.com/semka95/shortener/backend/user/repository"
+)
+
+// TestPrefixedCollections runs repository tests against prefixed collections
+// of empty database, so collection created under default name means it is
+// still hard-coded somewhere
+func TestPrefixedCollections(t *testing.T) {
+	ctx := context.Background()
+	cols := store.Collections{Prefix: "staging_"}
+	require.NoError(t, cols.Validate())
+	db := client.Database(dbName + "_prefixed")
+	defer func() {
+		require.NoError(t, db.Drop(ctx))
+	}()
+
+	require.NoError(t, store.Migrate(client, db.Name(), cols, zap.NewNop()))
+	// unique email index must be created on prefixed collection
+	indexes, err := db.Collection("staging_user").Indexes().ListSpecifications(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, len(indexes), 1)
+
+	t.Run("url", func(t *testing.T) {
+		testURLRepository(t, _URLRepo.NewMongoURLRepository(client, db.Name(), cols, zap.NewNop(), tracer))
+	})
+	t.Run("user", func(t *testing.T) {
+		testUserRepository(t, _UserRepo.NewMongoUserRepository(client, db.Name(), cols, zap.NewNop(), tracer))
+	})
+	t.Run("lock", func(t *testing.T) {
+		held, err := lock.NewMongoLocker(db, cols).AcquireLock(ctx, "test", time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, held.Release(ctx))
+	})
+
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	require.NoError(t, err)
+	require.NotEmpty(t, names)
+	for _, name := range names {
+		assert.True(t, strings.HasPrefix(name, cols.Prefix), "collection %s has no prefix", name)
+	}
+}
@@ -0,0 +1,229 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/store"
+	_URLHttpDelivery "github.com/semka95/shortener/backend/url/delivery/http"
+	_URLRepo "github.com/semka95/shortener/backend/url/repository"
+	_URLUcase "github.com/semka95/shortener/backend/url/usecase"
+	_UserRepo "github.com/semka95/shortener/backend/user/repository"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// outageProxy forwards TCP connections to MongoDB, killing it drops all
+// connections and refuses new ones the way stopped database does
+type outageProxy struct {
+	ln       net.Listener
+	upstream string
+
+	mu    sync.Mutex
+	down  bool
+	conns []net.Conn
+}
+
+func newOutageProxy(t *testing.T, upstream string) *outageProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &outageProxy{ln: ln, upstream: upstream}
+	t.Cleanup(func() {
+		_ = ln.Close()
+		p.kill()
+	})
+	go p.serve()
+	return p
+}
+
+func (p *outageProxy) serve() {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.forward(conn)
+	}
+}
+
+func (p *outageProxy) forward(conn net.Conn) {
+	p.mu.Lock()
+	if p.down {
+		p.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	upstream, err := net.Dial("tcp", p.upstream)
+	if err != nil {
+		p.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	p.conns = append(p.conns, conn, upstream)
+	p.mu.Unlock()
+
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+	_ = conn.Close()
+}
+
+func (p *outageProxy) kill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = true
+	for _, c := range p.conns {
+		_ = c.Close()
+	}
+	p.conns = nil
+}
+
+func (p *outageProxy) restore() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = false
+}
+
+func TestDegradedMode(t *testing.T) {
+	clean(t, "url", "user")
+	logger := zap.NewNop()
+
+	cs, err := connstring.ParseAndValidate(mongoURI)
+	require.NoError(t, err)
+	require.NotEmpty(t, cs.Hosts)
+	proxy := newOutageProxy(t, cs.Hosts[0])
+
+	// client talks to the proxy only, so killing it is database outage
+	opts := options.Client().ApplyURI(mongoURI).SetHosts([]string{proxy.ln.Addr().String()}).SetDirect(true).SetServerSelectionTimeout(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	proxied, err := mongo.Connect(ctx, opts)
+	require.NoError(t, err)
+	defer func() { _ = proxied.Disconnect(context.Background()) }()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	authenticator, err := auth.NewAuthenticator(key, "1", "RS256", auth.NewSimpleKeyLookupFunc("1", &key.PublicKey))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+
+	openTimeout := 300 * time.Millisecond
+	urlBreaker := store.NewCircuitBreaker("url", 1, openTimeout, logger)
+	userBreaker := store.NewCircuitBreaker("user", 1, openTimeout, logger)
+	cacheTTL := 50 * time.Millisecond
+	urlCache := store.NewCache("url", cacheTTL, 0, 100)
+	urlCache.SetStaleTTL(time.Minute)
+
+	e := echo.New()
+	e.Validator = v
+	e.JSONSerializer = web.JSONSerializer{}
+	e.Use(_MyMiddleware.InitMiddleware(logger).Degraded(urlBreaker, userBreaker))
+
+	usr := _UserRepo.NewBreakerUserRepository(_UserRepo.NewMongoUserRepository(proxied, dbName, store.Collections{}, logger, tracer), userBreaker)
+	ur := _URLRepo.NewCachedURLRepository(_URLRepo.NewBreakerURLRepository(_URLRepo.NewMongoURLRepository(proxied, dbName, store.Collections{}, logger, tracer), urlBreaker), urlCache)
+	uu := _URLUcase.NewURLUsecase(ur, usr, domain.NewTimeouts(10*time.Second), tracer, 1, _URLUcase.LinkConfig{}, nil, nil, nil, nil)
+	uh, err := _URLHttpDelivery.NewURLHandler(uu, nil, authenticator, v, logger, tracer)
+	require.NoError(t, err)
+	uh.RegisterRoutes(e)
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	httpClient := srv.Client()
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	create := func() (int, *domain.URL) {
+		body, err := json.Marshal(domain.CreateURL{Link: "https://www.example.org"})
+		require.NoError(t, err)
+		res, err := httpClient.Post(srv.URL+"/v1/url/create", echo.MIMEApplicationJSON, bytes.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		created := new(domain.URL)
+		if res.StatusCode == http.StatusCreated {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(created))
+		}
+		return res.StatusCode, created
+	}
+	redirect := func(id string) int {
+		res, err := httpClient.Get(srv.URL + "/" + id)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return res.StatusCode
+	}
+
+	code, cached := create()
+	require.Equal(t, http.StatusCreated, code)
+	code, uncached := create()
+	require.Equal(t, http.StatusCreated, code)
+	// cached URL is resolved once before outage
+	require.Equal(t, http.StatusMovedPermanently, redirect(cached.ID))
+	time.Sleep(2 * cacheTTL)
+
+	proxy.kill()
+
+	// the first failing call opens the breaker
+	assert.NotEqual(t, http.StatusMovedPermanently, redirect(uncached.ID))
+	require.Equal(t, store.BreakerOpen, urlBreaker.State())
+
+	t.Run("cached url redirects", func(t *testing.T) {
+		assert.Equal(t, http.StatusMovedPermanently, redirect(cached.ID))
+		assert.EqualValues(t, 1, urlCache.Lookups(store.CacheStaleHit))
+	})
+
+	t.Run("uncached url is unavailable", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, redirect(uncached.ID))
+	})
+
+	t.Run("create is unavailable", func(t *testing.T) {
+		body, err := json.Marshal(domain.CreateURL{Link: "https://www.example.org"})
+		require.NoError(t, err)
+		res, err := httpClient.Post(srv.URL+"/v1/url/create", echo.MIMEApplicationJSON, bytes.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.NotEmpty(t, res.Header.Get(echo.HeaderRetryAfter))
+		re := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(re))
+		assert.Equal(t, domain.ErrCodeUnavailable, re.Code)
+	})
+
+	t.Run("recovers when database is back", func(t *testing.T) {
+		proxy.restore()
+		// breaker probes database once open timeout passes, driver may need
+		// a few probes to reconnect
+		require.Eventually(t, func() bool {
+			code, _ := create()
+			return code == http.StatusCreated
+		}, 15*time.Second, openTimeout)
+		assert.Equal(t, store.BreakerClosed, urlBreaker.State())
+		assert.Equal(t, http.StatusMovedPermanently, redirect(uncached.ID))
+	})
+}
@@ -0,0 +1,100 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/store"
+	_URLHttpDelivery "github.com/semka95/shortener/backend/url/delivery/http"
+	_URLRepo "github.com/semka95/shortener/backend/url/repository"
+	_URLUcase "github.com/semka95/shortener/backend/url/usecase"
+	_UserRepo "github.com/semka95/shortener/backend/user/repository"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	logger := zap.NewNop()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	authenticator, err := auth.NewAuthenticator(key, "1", "RS256", auth.NewSimpleKeyLookupFunc("1", &key.PublicKey))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.JSONSerializer = web.JSONSerializer{}
+
+	usr := _UserRepo.NewMongoUserRepository(client, dbName, store.Collections{}, logger, tracer)
+	ur := _URLRepo.NewMongoURLRepository(client, dbName, store.Collections{}, logger, tracer)
+	uu := _URLUcase.NewURLUsecase(ur, usr, domain.NewTimeouts(10*time.Second), tracer, 1, _URLUcase.LinkConfig{}, nil, nil, nil, nil)
+	uh, err := _URLHttpDelivery.NewURLHandler(uu, nil, authenticator, v, logger, tracer)
+	require.NoError(t, err)
+	uh.RegisterRoutes(e)
+
+	return httptest.NewServer(e)
+}
+
+func TestCreateAndRedirect(t *testing.T) {
+	clean(t, "url", "user")
+	srv := newServer(t)
+	defer srv.Close()
+	httpClient := srv.Client()
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	// create
+	body, err := json.Marshal(domain.CreateURL{Link: "https://www.example.org"})
+	require.NoError(t, err)
+	res, err := httpClient.Post(srv.URL+"/v1/url/create", echo.MIMEApplicationJSON, bytes.NewReader(body))
+	require.NoError(t, err)
+	created := new(domain.URL)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(created))
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.NotEmpty(t, created.ID)
+
+	// redirect
+	res, err = httpClient.Get(srv.URL + "/" + created.ID)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+	assert.Equal(t, "https://www.example.org", res.Header.Get(echo.HeaderLocation))
+
+	// get
+	res, err = httpClient.Get(srv.URL + "/v1/url/" + created.ID)
+	require.NoError(t, err)
+	got := new(domain.URL)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(got))
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, created.Link, got.Link)
+
+	// missing
+	res, err = httpClient.Get(srv.URL + "/v1/url/missing1")
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
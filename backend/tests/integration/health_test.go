@@ -0,0 +1,85 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	_URLRepo "github.com/semka95/shortener/backend/url/repository"
+	_UserRepo "github.com/semka95/shortener/backend/user/repository"
+)
+
+// healthCase is repository implementation checked by health conformance test,
+// store adds n documents to the empty repository
+type healthCase struct {
+	name  string
+	repo  domain.HealthChecker
+	store func(t *testing.T, n int)
+}
+
+func storeURLs(r domain.URLRepository) func(t *testing.T, n int) {
+	return func(t *testing.T, n int) {
+		for i := 0; i < n; i++ {
+			u := tests.NewURL()
+			u.ID = fmt.Sprintf("health%d", i)
+			require.NoError(t, r.Store(context.Background(), u))
+		}
+	}
+}
+
+func storeUsers(r domain.UserRepository) func(t *testing.T, n int) {
+	return func(t *testing.T, n int) {
+		for i := 0; i < n; i++ {
+			u := tests.NewUser()
+			u.ID = primitive.NewObjectID()
+			u.Email = fmt.Sprintf("health%d@example.com", i)
+			require.NoError(t, r.Create(context.Background(), u))
+		}
+	}
+}
+
+func TestHealthCheckerConformance(t *testing.T) {
+	clean(t, "url", "user")
+	mongoURLs := _URLRepo.NewMongoURLRepository(client, dbName, store.Collections{}, zap.NewNop(), tracer)
+	mongoUsers := _UserRepo.NewMongoUserRepository(client, dbName, store.Collections{}, zap.NewNop(), tracer)
+	memoryURLs := tests.NewMemoryURLRepository()
+	memoryUsers := tests.NewMemoryUserRepository()
+
+	cases := []healthCase{
+		{name: "mongo url", repo: mongoURLs, store: storeURLs(mongoURLs)},
+		{name: "mongo user", repo: mongoUsers, store: storeUsers(mongoUsers)},
+		{name: "memory url", repo: memoryURLs, store: storeURLs(memoryURLs)},
+		{name: "memory user", repo: memoryUsers, store: storeUsers(memoryUsers)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			require.NoError(t, tc.repo.Ping(ctx))
+
+			stats, err := tc.repo.Stats(ctx)
+			require.NoError(t, err)
+			assert.Zero(t, stats.Documents)
+
+			tc.store(t, 3)
+			stats, err = tc.repo.Stats(ctx)
+			require.NoError(t, err)
+			assert.EqualValues(t, 3, stats.Documents)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			assert.Error(t, tc.repo.Ping(canceled))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/lock"
+	"github.com/semka95/shortener/backend/store"
+)
+
+func TestMongoLocker(t *testing.T) {
+	clean(t, "lock")
+	ctx := context.Background()
+	l := lock.NewMongoLocker(client.Database(dbName), store.Collections{})
+
+	t.Run("double acquire is rejected", func(t *testing.T) {
+		held, err := l.AcquireLock(ctx, "double", time.Minute)
+		require.NoError(t, err)
+
+		_, err = l.AcquireLock(ctx, "double", time.Minute)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+
+		require.NoError(t, held.Release(ctx))
+		again, err := l.AcquireLock(ctx, "double", time.Minute)
+		require.NoError(t, err)
+		assert.Greater(t, again.Token(), held.Token())
+	})
+
+	t.Run("expired lease is taken over", func(t *testing.T) {
+		crashed, err := l.AcquireLock(ctx, "takeover", 50*time.Millisecond)
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+
+		held, err := l.AcquireLock(ctx, "takeover", time.Minute)
+		require.NoError(t, err)
+		assert.Greater(t, held.Token(), crashed.Token())
+
+		assert.ErrorIs(t, crashed.Refresh(ctx, time.Minute), domain.ErrConflict)
+		// release of taken over lease leaves lock held
+		require.NoError(t, crashed.Release(ctx))
+		_, err = l.AcquireLock(ctx, "takeover", time.Minute)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("refresh extends lease", func(t *testing.T) {
+		held, err := l.AcquireLock(ctx, "refresh", 50*time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, held.Refresh(ctx, time.Minute))
+		time.Sleep(100 * time.Millisecond)
+
+		_, err = l.AcquireLock(ctx, "refresh", time.Minute)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+}
@@ -0,0 +1,90 @@
+//go:build integration
+
+// Package integration_test runs repositories and HTTP API against real MongoDB.
+// MongoDB address is taken from SHORTENER_TEST_MONGO_URI environment variable.
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/store"
+)
+
+var (
+	client   *mongo.Client
+	mongoURI string
+	dbName   string
+	tracer   = sdktrace.NewTracerProvider().Tracer("")
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	uri, ok := os.LookupEnv("SHORTENER_TEST_MONGO_URI")
+	if !ok {
+		uri = "mongodb://localhost:27017"
+	}
+	mongoURI = uri
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var err error
+	client, err = mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		log.Println("can't connect to mongodb: ", err)
+		return 1
+	}
+	defer func() {
+		if err := client.Disconnect(context.Background()); err != nil {
+			log.Println("mongodb client disconnect error: ", err)
+		}
+	}()
+	if err = client.Ping(ctx, readpref.Primary()); err != nil {
+		log.Println("mongodb ping error: ", err)
+		return 1
+	}
+
+	// every run uses its own database, so runs do not affect each other
+	dbName = fmt.Sprintf("shortener_it_%d", time.Now().UnixNano())
+	defer func() {
+		db := client.Database(dbName)
+		if err := db.RunCommand(context.Background(), bson.D{{Key: "dropAllUsersFromDatabase", Value: 1}}).Err(); err != nil {
+			log.Println("can't drop test database users: ", err)
+		}
+		if err := db.Drop(context.Background()); err != nil {
+			log.Println("can't drop test database: ", err)
+		}
+	}()
+
+	if err = store.Migrate(client, dbName, store.Collections{}, zap.NewNop()); err != nil {
+		log.Println("can't apply migrations: ", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// clean removes all documents from collections, indexes are kept
+func clean(t *testing.T, collections ...string) {
+	t.Helper()
+	for _, c := range collections {
+		_, err := client.Database(dbName).Collection(c).DeleteMany(context.Background(), bson.D{})
+		require.NoError(t, err)
+	}
+}
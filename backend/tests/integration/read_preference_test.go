@@ -0,0 +1,98 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+// commandRecorder keeps started find commands
+type commandRecorder struct {
+	mu     sync.Mutex
+	events []*event.CommandStartedEvent
+}
+
+func (r *commandRecorder) started(_ context.Context, e *event.CommandStartedEvent) {
+	if e.CommandName != "find" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// last returns the last find command and forgets recorded ones
+func (r *commandRecorder) last(t *testing.T) *event.CommandStartedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	require.NotEmpty(t, r.events)
+	e := r.events[len(r.events)-1]
+	r.events = nil
+	return e
+}
+
+func TestURLRepository_ReadPreference(t *testing.T) {
+	ctx := context.Background()
+
+	var hello bson.M
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	require.NoError(t, err)
+	if _, ok := hello["setName"]; !ok {
+		t.Skip("read preference is only sent to replica set members")
+	}
+
+	recorder := new(commandRecorder)
+	monitored, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(mongoURI).
+		SetMonitor(&event.CommandMonitor{Started: recorder.started}))
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, monitored.Disconnect(context.Background()))
+	}()
+
+	clean(t, "url")
+	rp, err := readpref.New(readpref.NearestMode, readpref.WithMaxStaleness(90*time.Second))
+	require.NoError(t, err)
+	r := repository.NewMongoURLRepository(monitored, dbName, store.Collections{}, zap.NewNop(), tracer, repository.WithReadPreference(domain.ReadRedirect, rp))
+	tURL := tests.NewURL()
+	require.NoError(t, repository.NewMongoURLRepository(client, dbName, store.Collections{}, zap.NewNop(), tracer).Store(ctx, tURL))
+
+	t.Run("redirect", func(t *testing.T) {
+		// secondary may not have replicated the URL yet, only the command
+		// is checked
+		_, _ = r.GetByID(domain.WithReadClass(ctx, domain.ReadRedirect), tURL.ID)
+
+		readPref := recorder.last(t).Command.Lookup("$readPreference").Document()
+		assert.Equal(t, "nearest", readPref.Lookup("mode").StringValue())
+		assert.EqualValues(t, 90, readPref.Lookup("maxStalenessSeconds").AsInt64())
+	})
+
+	t.Run("read for update", func(t *testing.T) {
+		u, err := r.GetByID(domain.WithReadClass(ctx, domain.ReadForUpdate), tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL.ID, u.ID)
+
+		// primary is the default, so driver may leave read preference out
+		readPref, err := recorder.last(t).Command.LookupErr("$readPreference")
+		if err == nil {
+			assert.Equal(t, "primary", readPref.Document().Lookup("mode").StringValue())
+		}
+	})
+}
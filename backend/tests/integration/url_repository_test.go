@@ -0,0 +1,95 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestURLRepository(t *testing.T) {
+	clean(t, "url")
+	testURLRepository(t, repository.NewMongoURLRepository(client, dbName, store.Collections{}, zap.NewNop(), tracer))
+}
+
+// testURLRepository checks URL repository backed by empty collection
+func testURLRepository(t *testing.T, r domain.URLRepository) {
+	ctx := context.Background()
+	tURL := tests.NewURL()
+
+	t.Run("get missing", func(t *testing.T) {
+		_, err := r.GetByID(ctx, "missing")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("store and get", func(t *testing.T) {
+		require.NoError(t, r.Store(ctx, tURL))
+
+		u, err := r.GetByID(ctx, tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL, u)
+	})
+
+	t.Run("store duplicate id", func(t *testing.T) {
+		err := r.Store(ctx, tURL)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		tURL.ExpirationDate = tURL.ExpirationDate.Add(time.Hour)
+		require.NoError(t, r.Update(ctx, tURL, tURL.UserID))
+
+		u, err := r.GetByID(ctx, tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL.ExpirationDate, u.ExpirationDate)
+	})
+
+	t.Run("update without changes", func(t *testing.T) {
+		err := r.Update(ctx, tURL, domain.AnyOwner)
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+	})
+
+	t.Run("update by another user", func(t *testing.T) {
+		changed := *tURL
+		changed.Link = "https://example.com/other"
+		err := r.Update(ctx, &changed, "507f191e810c19729de860eb")
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+
+		err = r.UpdateIfUnchanged(ctx, &changed, tURL.UpdatedAt, "507f191e810c19729de860eb")
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+
+		u, err := r.GetByID(ctx, tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL.Link, u.Link)
+	})
+
+	t.Run("delete by another user", func(t *testing.T) {
+		err := r.Delete(ctx, tURL.ID, "507f191e810c19729de860eb")
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+
+		_, err = r.GetByID(ctx, tURL.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, r.Delete(ctx, tURL.ID, tURL.UserID))
+
+		_, err := r.GetByID(ctx, tURL.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("delete missing", func(t *testing.T) {
+		err := r.Delete(ctx, tURL.ID, domain.AnyOwner)
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+	})
+}
@@ -0,0 +1,135 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/repository"
+)
+
+func TestUserRepository(t *testing.T) {
+	clean(t, "user")
+	testUserRepository(t, repository.NewMongoUserRepository(client, dbName, store.Collections{}, zap.NewNop(), tracer))
+}
+
+// testUserRepository checks user repository backed by empty collection
+func testUserRepository(t *testing.T, r domain.UserRepository) {
+	ctx := context.Background()
+	tUser := tests.NewUser()
+
+	t.Run("create and get", func(t *testing.T) {
+		require.NoError(t, r.Create(ctx, tUser))
+
+		u, err := r.GetByID(ctx, tUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, u)
+
+		u, err = r.GetByEmail(ctx, tUser.Email)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, u)
+	})
+
+	t.Run("create duplicate email", func(t *testing.T) {
+		dup := tests.NewUser()
+		dup.ID = primitive.NewObjectID()
+
+		err := r.Create(ctx, dup)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("email differing in case", func(t *testing.T) {
+		dup := tests.NewUser()
+		dup.ID = primitive.NewObjectID()
+		dup.Email = strings.ToUpper(tUser.Email)
+
+		err := r.Create(ctx, dup)
+		assert.ErrorIs(t, err, domain.ErrEmailTaken)
+
+		u, err := r.GetByEmail(ctx, dup.Email)
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID, u.ID)
+	})
+
+	t.Run("get missing", func(t *testing.T) {
+		_, err := r.GetByID(ctx, primitive.NewObjectID())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		_, err = r.GetByEmail(ctx, "missing@example.com")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		tUser.FullName = "Jane Doe"
+		require.NoError(t, r.Update(ctx, tUser))
+
+		u, err := r.GetByID(ctx, tUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Jane Doe", u.FullName)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, r.Delete(ctx, tUser.ID))
+
+		_, err := r.GetByID(ctx, tUser.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		err = r.Delete(ctx, tUser.ID)
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+	})
+}
+
+func TestUserRepositoryFetch(t *testing.T) {
+	clean(t, "user")
+	ctx := context.Background()
+	r := repository.NewMongoUserRepository(client, dbName, store.Collections{}, zap.NewNop(), tracer)
+
+	users := make([]*domain.User, 5)
+	for i := range users {
+		u := tests.NewUser()
+		u.ID = primitive.NewObjectID()
+		u.Email = fmt.Sprintf("user%d@example.com", i)
+		if i%2 == 0 {
+			u.DisabledAt = tests.DatePointer(time.Now().Truncate(time.Millisecond).UTC())
+		}
+		require.NoError(t, r.Create(ctx, u))
+		users[i] = u
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var got []*domain.User
+		filter := domain.UserFilter{Limit: 2}
+		for {
+			page, err := r.Fetch(ctx, filter)
+			require.NoError(t, err)
+			got = append(got, page...)
+			if int64(len(page)) < filter.Limit {
+				break
+			}
+			filter.Cursor = page[len(page)-1].ID.Hex()
+		}
+		assert.Equal(t, users, got)
+	})
+
+	t.Run("status filter", func(t *testing.T) {
+		disabled, err := r.Fetch(ctx, domain.UserFilter{Status: domain.UserStatusDisabled, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []*domain.User{users[0], users[2], users[4]}, disabled)
+
+		active, err := r.Fetch(ctx, domain.UserFilter{Status: domain.UserStatusActive, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []*domain.User{users[1], users[3]}, active)
+	})
+}
@@ -0,0 +1,635 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// MemoryURLRepository is in-memory implementation of domain.URLRepository
+// used in benchmarks
+type MemoryURLRepository struct {
+	mu   sync.RWMutex
+	urls map[string]domain.URL
+}
+
+// NewMemoryURLRepository creates empty MemoryURLRepository
+func NewMemoryURLRepository() *MemoryURLRepository {
+	return &MemoryURLRepository{urls: make(map[string]domain.URL)}
+}
+
+// Ping returns error only when context is done
+func (r *MemoryURLRepository) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Stats returns number of stored URLs
+func (r *MemoryURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &domain.RepositoryStats{Documents: int64(len(r.urls))}, nil
+}
+
+// GetByID returns copy of stored URL, all fields are returned
+func (r *MemoryURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.urls[id]
+	if !ok {
+		return nil, fmt.Errorf("URL was not found: %w", domain.ErrNotFound)
+	}
+	return &u, nil
+}
+
+// GetByIDs returns copies of stored URLs with given ids
+func (r *MemoryURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*domain.URL, 0, len(ids))
+	for _, id := range ids {
+		if u, ok := r.urls[id]; ok {
+			result = append(result, &u)
+		}
+	}
+	return result, nil
+}
+
+// Update replaces stored URL owned by ownerID
+func (r *MemoryURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.urls[url.ID]; !ok || !ownedBy(stored, ownerID) {
+		return fmt.Errorf("URL was not updated: %w", domain.ErrNoAffected)
+	}
+	r.urls[url.ID] = *url
+	return nil
+}
+
+// UpdateIfUnchanged replaces URL owned by ownerID unless it was updated
+// after updatedAt
+func (r *MemoryURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.urls[url.ID]
+	if !ok {
+		return fmt.Errorf("URL was not found: %w", domain.ErrNotFound)
+	}
+	if !ownedBy(stored, ownerID) {
+		return fmt.Errorf("URL belongs to another user: %w", domain.ErrNoAffected)
+	}
+	if !stored.UpdatedAt.Equal(updatedAt) {
+		return fmt.Errorf("URL was changed by another request: %w", domain.ErrConflict)
+	}
+	r.urls[url.ID] = *url
+	return nil
+}
+
+// Store saves copy of URL
+func (r *MemoryURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.urls[url.ID]; ok {
+		return fmt.Errorf("URL %s already exists: %w", url.ID, domain.ErrConflict)
+	}
+	r.urls[url.ID] = *url
+	return nil
+}
+
+// Delete removes URL owned by ownerID
+func (r *MemoryURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.urls[id]; !ok || !ownedBy(stored, ownerID) {
+		return fmt.Errorf("URL was not deleted: %w", domain.ErrNoAffected)
+	}
+	delete(r.urls, id)
+	return nil
+}
+
+func ownedBy(u domain.URL, ownerID string) bool {
+	return ownerID == domain.AnyOwner || u.UserID == ownerID
+}
+
+// BlockByPattern marks URLs whose links match case-insensitive pattern as
+// blocked by rule
+func (r *MemoryURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w: %s", domain.ErrBadParamInput, err.Error())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	for id, u := range r.urls {
+		if u.BlockedBy != "" || !re.MatchString(u.Link) {
+			continue
+		}
+		u.BlockedBy = rule
+		r.urls[id] = u
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// Fetch lists URLs matching the filter in id order, owner emails and clicks
+// are not known to the repository and are left empty
+func (r *MemoryURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	domainRe := regexp.MustCompile("(?i)" + filter.DomainPattern())
+	q := strings.ToLower(filter.Q)
+	now := time.Now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*domain.AdminURL, 0)
+	for id, u := range r.urls {
+		switch {
+		case filter.Cursor != "" && id <= filter.Cursor,
+			filter.OwnerID != "" && u.UserID != filter.OwnerID,
+			filter.Domain != "" && !domainRe.MatchString(u.Link),
+			filter.CreatedAfter != nil && u.CreatedAt.Before(*filter.CreatedAfter),
+			filter.CreatedBefore != nil && !u.CreatedAt.Before(*filter.CreatedBefore),
+			filter.Status != "" && u.Status(now) != filter.Status,
+			q != "" && !strings.Contains(strings.ToLower(id), q) && !strings.Contains(strings.ToLower(u.Link), q):
+			continue
+		}
+		list = append(list, &domain.AdminURL{URL: u})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if filter.Limit > 0 && int64(len(list)) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+
+	return list, nil
+}
+
+// CountPurgeable returns number of URLs matching purge filter, owners are not
+// known to the repository, so no URL is orphaned
+func (r *MemoryURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.purgeable(filter, -1))), nil
+}
+
+// PurgeBatch deletes up to limit URLs matching purge filter
+func (r *MemoryURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := r.purgeable(filter, limit)
+	for _, id := range ids {
+		delete(r.urls, id)
+	}
+	return int64(len(ids)), nil
+}
+
+func (r *MemoryURLRepository) purgeable(filter domain.PurgeFilter, limit int64) []string {
+	var ids []string
+	if filter.Orphaned || filter.ExpiredBefore.IsZero() && filter.UserID == "" {
+		return ids
+	}
+	for id, u := range r.urls {
+		if int64(len(ids)) == limit {
+			break
+		}
+		if filter.UserID != "" && u.UserID != filter.UserID {
+			continue
+		}
+		if filter.ExpiredBefore.IsZero() || u.ExpirationDate.Before(filter.ExpiredBefore) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ScanIDs calls fn with ids of URLs stored when scan started
+func (r *MemoryURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	r.mu.RLock()
+	ids := make([]string, 0, len(r.urls))
+	for id := range r.urls {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchExpired returns copies of URLs expired by now in order of expiration
+func (r *MemoryURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*domain.URL, 0)
+	for _, u := range r.urls {
+		if u.BlockedBy == "" && expiredClaimable(u, now, claimedBefore) {
+			u := u
+			result = append(result, &u)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ExpirationDate.Before(result[j].ExpirationDate) })
+	if int64(len(result)) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// ClaimExpired claims notification of URL expired by now
+func (r *MemoryURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.urls[id]
+	if !ok || !expiredClaimable(u, now, claimedBefore) {
+		return false, nil
+	}
+	u.NotifyingAt = &now
+	r.urls[id] = u
+	return true, nil
+}
+
+// MarkExpiredNotified marks URL as notified and removes its claim
+func (r *MemoryURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.urls[id]; ok {
+		u.ExpiredNotified = true
+		u.NotifyingAt = nil
+		r.urls[id] = u
+	}
+	return nil
+}
+
+// ReleaseExpired removes claim of URL
+func (r *MemoryURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.urls[id]; ok {
+		u.NotifyingAt = nil
+		r.urls[id] = u
+	}
+	return nil
+}
+
+func expiredClaimable(u domain.URL, now, claimedBefore time.Time) bool {
+	return !u.ExpiredNotified && !u.ExpirationDate.After(now) && (u.NotifyingAt == nil || !u.NotifyingAt.After(claimedBefore))
+}
+
+// MemoryUserRepository is in-memory implementation of domain.UserRepository
+// used in benchmarks
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]domain.User
+}
+
+// NewMemoryUserRepository creates empty MemoryUserRepository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: make(map[primitive.ObjectID]domain.User)}
+}
+
+// Ping returns error only when context is done
+func (r *MemoryUserRepository) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Stats returns number of stored users
+func (r *MemoryUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &domain.RepositoryStats{Documents: int64(len(r.users))}, nil
+}
+
+// GetByID returns copy of stored user
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user was not found: %w", domain.ErrNotFound)
+	}
+	return &u, nil
+}
+
+// GetByEmail returns copy of stored user with given email, emails are
+// compared case-insensitively
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("user with email %s was not found: %w", email, domain.ErrNotFound)
+}
+
+// emailTaken reports whether another user has the email, r.mu must be held
+func (r *MemoryUserRepository) emailTaken(user *domain.User) bool {
+	for id, u := range r.users {
+		if id != user.ID && strings.EqualFold(u.Email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update replaces stored user, deletion claim is kept like mongo repository
+// does
+func (r *MemoryUserRepository) Update(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return fmt.Errorf("user was not updated: %w", domain.ErrNoAffected)
+	}
+	if r.emailTaken(user) {
+		return fmt.Errorf("user with email %s already exists: %w", user.Email, domain.ErrEmailTaken)
+	}
+	u := *user
+	if u.DeletingAt == nil {
+		u.DeletingAt = stored.DeletingAt
+	}
+	r.users[user.ID] = u
+	return nil
+}
+
+// Restore replaces stored user unless its deletion was claimed
+func (r *MemoryUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.users[user.ID]; !ok || u.IsBeingDeleted() {
+		return fmt.Errorf("user was not restored: %w", domain.ErrNoAffected)
+	}
+	r.users[user.ID] = *user
+	return nil
+}
+
+// UpdatePasswordHash replaces password hash of the user if it is still oldHash
+func (r *MemoryUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.HashedPassword != oldHash {
+		return fmt.Errorf("user password was not updated: %w", domain.ErrNoAffected)
+	}
+	u.HashedPassword = newHash
+	r.users[id] = u
+	return nil
+}
+
+// Create saves copy of user
+func (r *MemoryUserRepository) Create(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.ID]; ok {
+		return fmt.Errorf("user already exists: %w", domain.ErrConflict)
+	}
+	if r.emailTaken(user) {
+		return fmt.Errorf("user with email %s already exists: %w", user.Email, domain.ErrEmailTaken)
+	}
+	r.users[user.ID] = *user
+	return nil
+}
+
+// Delete removes user
+func (r *MemoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return fmt.Errorf("user was not deleted: %w", domain.ErrNoAffected)
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// ClaimDeletion marks user whose deletion was scheduled before now as being
+// deleted
+func (r *MemoryUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.DeleteAfter == nil || u.DeleteAfter.After(now) {
+		return fmt.Errorf("user deletion was not claimed: %w", domain.ErrNoAffected)
+	}
+	u.DeletingAt = &now
+	r.users[id] = u
+	return nil
+}
+
+// DeleteScheduled deletes user whose deletion was scheduled before now
+func (r *MemoryUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.DeleteAfter == nil || u.DeleteAfter.After(now) {
+		return fmt.Errorf("user was not deleted: %w", domain.ErrNoAffected)
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// Fetch returns users ordered by id
+func (r *MemoryUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*domain.User, 0, len(r.users))
+	for _, u := range r.users {
+		u := u
+		if filter.Cursor != "" && u.ID.Hex() <= filter.Cursor {
+			continue
+		}
+		if filter.Before != "" && u.ID.Hex() >= filter.Before {
+			continue
+		}
+		if !matchesFilter(&u, filter) {
+			continue
+		}
+		result = append(result, &u)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID.Hex() < result[j].ID.Hex()
+	})
+	if filter.Limit > 0 && int64(len(result)) > filter.Limit {
+		if filter.Before != "" {
+			result = result[int64(len(result))-filter.Limit:]
+		} else {
+			result = result[:filter.Limit]
+		}
+	}
+
+	return result, nil
+}
+
+// Count returns number of users matching the filter
+func (r *MemoryUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int64
+	for _, u := range r.users {
+		u := u
+		if matchesFilter(&u, filter) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// FetchDeletable returns users whose deletion was scheduled before now
+func (r *MemoryUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*domain.User, 0)
+	for _, u := range r.users {
+		u := u
+		if u.DeleteAfter != nil && !u.DeleteAfter.After(now) {
+			result = append(result, &u)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeleteAfter.Before(*result[j].DeleteAfter)
+	})
+	if int64(len(result)) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func matchesFilter(u *domain.User, filter domain.UserFilter) bool {
+	if filter.ClickRetention && u.Settings.ClickRetentionDays <= 0 {
+		return false
+	}
+	switch filter.Status {
+	case domain.UserStatusActive:
+		if u.IsDisabled() {
+			return false
+		}
+	case domain.UserStatusDisabled:
+		if !u.IsDisabled() {
+			return false
+		}
+	}
+	switch filter.Type {
+	case domain.UserTypeUser:
+		return !u.IsService()
+	case domain.UserTypeService:
+		return u.IsService()
+	}
+	return true
+}
+
+// MemoryLimitStore is in-memory implementation of domain.LimitStore shared by
+// instances created in tests
+type MemoryLimitStore struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	used   map[string]time.Time
+	events map[string][]time.Time
+}
+
+// NewMemoryLimitStore creates empty MemoryLimitStore
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{
+		now:    time.Now,
+		used:   make(map[string]time.Time),
+		events: make(map[string][]time.Time),
+	}
+}
+
+// SetClock replaces clock used keys are expired by
+func (s *MemoryLimitStore) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Use records key unless it is recorded and not expired
+func (s *MemoryLimitStore) Use(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.used[key]; ok && s.now().Before(e) {
+		return false, nil
+	}
+	s.used[key] = expiresAt
+	return true, nil
+}
+
+// Add records event of key and returns number of its events within window
+func (s *MemoryLimitStore) Add(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events[key] = append(s.recent(key, now, window), now)
+	return len(s.events[key]), nil
+}
+
+// Count returns number of events of key within window
+func (s *MemoryLimitStore) Count(ctx context.Context, key string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.recent(key, now, window)), nil
+}
+
+// Reset removes events of key
+func (s *MemoryLimitStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, key)
+	return nil
+}
+
+// recent returns events of key within window ending at now, s.mu must be held
+func (s *MemoryLimitStore) recent(key string, now time.Time, window time.Duration) []time.Time {
+	var recent []time.Time
+	for _, at := range s.events[key] {
+		if at.After(now.Add(-window)) {
+			recent = append(recent, at)
+		}
+	}
+	return recent
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer returns tracer, no-op tracer is returned when tracer is nil, so
+// components work without tracing configured
+func Tracer(tracer trace.Tracer) trace.Tracer {
+	if tracer == nil {
+		return trace.NewNoopTracerProvider().Tracer("")
+	}
+	return tracer
+}
+
+// StartHandler starts server span of handler serving c, span is child of the
+// request span
+func StartHandler(c echo.Context, tracer trace.Tracer, name string) (context.Context, trace.Span) {
+	ctx := c.Request().Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer(tracer).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// Fail records err on span and returns it, nil err is returned as is
+func Fail(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// Success marks span as succeeded
+func Success(span trace.Span) {
+	span.SetStatus(codes.Ok, "success")
+}
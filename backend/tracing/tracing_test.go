@@ -0,0 +1,63 @@
+package tracing_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+func TestTracer(t *testing.T) {
+	t.Run("nil tracer", func(t *testing.T) {
+		tracer := tracing.Tracer(nil)
+		require.NotNil(t, tracer)
+
+		_, span := tracer.Start(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "test")
+		defer span.End()
+		assert.False(t, span.IsRecording())
+	})
+
+	t.Run("configured tracer", func(t *testing.T) {
+		tracer := sdktrace.NewTracerProvider().Tracer("")
+		assert.Equal(t, tracer, tracing.Tracer(tracer))
+	})
+}
+
+func TestStartHandler(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("")
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	ctx, span := tracing.StartHandler(c, tracer, "http Test")
+	assert.Equal(t, span.SpanContext(), trace.SpanContextFromContext(ctx))
+	err := errors.New("test error")
+	assert.Equal(t, err, tracing.Fail(span, err))
+	assert.NoError(t, tracing.Fail(span, nil))
+	tracing.Success(span)
+	span.End()
+
+	require.Len(t, sr.Ended(), 1)
+	ended := sr.Ended()[0]
+	assert.Equal(t, "http Test", ended.Name())
+	assert.Equal(t, trace.SpanKindServer, ended.SpanKind())
+	assert.Equal(t, codes.Ok, ended.Status().Code)
+	require.Len(t, ended.Events(), 1)
+	assert.Equal(t, "exception", ended.Events()[0].Name)
+
+	t.Run("nil tracer", func(t *testing.T) {
+		ctx, span := tracing.StartHandler(c, nil, "http Test")
+		defer span.End()
+		assert.NotNil(t, ctx)
+		assert.False(t, span.IsRecording())
+	})
+}
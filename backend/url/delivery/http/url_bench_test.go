@@ -0,0 +1,147 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tests"
+	urlHttp "github.com/semka95/shortener/backend/url/delivery/http"
+	"github.com/semka95/shortener/backend/url/usecase"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// benchStack is the full HTTP stack backed by in-memory repositories
+type benchStack struct {
+	e             *echo.Echo
+	validator     *web.AppValidator
+	authenticator *auth.Authenticator
+	urls          *tests.MemoryURLRepository
+	url           *domain.URL
+}
+
+func newBenchStack(tb testing.TB) *benchStack {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(tb, err)
+	authenticator, err := auth.NewAuthenticator(key, "1", "RS256", auth.NewSimpleKeyLookupFunc("1", &key.PublicKey))
+	require.NoError(tb, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	v, err := web.NewAppValidator()
+	require.NoError(tb, err)
+
+	urlRepo := tests.NewMemoryURLRepository()
+	userRepo := tests.NewMemoryUserRepository()
+	tURL := tests.NewURL()
+	require.NoError(tb, urlRepo.Store(context.Background(), tURL))
+	require.NoError(tb, userRepo.Create(context.Background(), tests.NewUser()))
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	uc := usecase.NewURLUsecase(urlRepo, userRepo, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), tracer)
+	require.NoError(tb, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	e.HTTPErrorHandler = web.HTTPErrorHandler(e.DefaultHTTPErrorHandler)
+	handler.RegisterRoutes(e)
+	handler.RegisterAPIRoutes(e.Group("/v2"))
+
+	return &benchStack{e: e, validator: v, authenticator: authenticator, urls: urlRepo, url: tURL}
+}
+
+func (s *benchStack) redirect() *httptest.ResponseRecorder {
+	req := httptest.NewRequest(echo.GET, "/"+s.url.ID, nil)
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// BenchmarkRedirect measures redirect request through router, handler, usecase
+// and in-memory repositories. Expected ~15-30µs/op and ~80 allocs/op.
+func BenchmarkRedirect(b *testing.B) {
+	s := newBenchStack(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if rec := s.redirect(); rec.Code != http.StatusMovedPermanently {
+			b.Fatalf("unexpected status %d", rec.Code)
+		}
+	}
+}
+
+// BenchmarkStore measures anonymous URL creation with custom id through the
+// full HTTP stack, including binding and validation. Expected ~25-50µs/op and
+// ~100 allocs/op.
+func BenchmarkStore(b *testing.B) {
+	s := newBenchStack(b)
+	bodies := make([][]byte, b.N)
+	for i := range bodies {
+		bodies[i] = []byte(fmt.Sprintf(`{"id":"custom%08d","link":"https://www.example.org"}`, i))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(echo.POST, "/v1/url/create", bytes.NewReader(bodies[i]))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			b.Fatalf("unexpected status %d", rec.Code)
+		}
+	}
+}
+
+// BenchmarkValidator_CreateURL measures validation of the create request
+// including linkid check and url parsing. Expected ~5-15µs/op and ~40 allocs/op.
+func BenchmarkValidator_CreateURL(b *testing.B) {
+	s := newBenchStack(b)
+	id := "example1"
+	exp := time.Now().Add(time.Hour)
+	createURL := domain.CreateURL{ID: &id, Link: "https://www.example.org/path?q=1", ExpirationDate: &exp}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.validator.Validate(createURL); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// maxRedirectAllocs is the allocation budget of a single redirect request,
+// including httptest request and recorder. It was measured at 82, raise it only
+// together with an explanation of the new allocations.
+const maxRedirectAllocs = 100
+
+func TestRedirectAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocation check is skipped in short mode")
+	}
+	s := newBenchStack(t)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.redirect()
+	})
+	if allocs > maxRedirectAllocs {
+		t.Errorf("redirect allocates %.0f times per request, budget is %d", allocs, maxRedirectAllocs)
+	}
+}
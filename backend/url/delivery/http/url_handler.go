@@ -2,42 +2,89 @@ package http
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
+	"reflect"
 	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v4"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/featureflag"
+	"github.com/semka95/shortener/backend/i18n"
+	"github.com/semka95/shortener/backend/metrics"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/pow"
+	"github.com/semka95/shortener/backend/tracing"
 	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
 )
 
+// DefaultCreateRateLimit is the number of URLs per second a client can create
+// used when CreateRateLimitConfig.RateLimit is not set
+const DefaultCreateRateLimit = 1.0
+
+// DefaultCreateBurst is the number of URLs a client can create at once used
+// when CreateRateLimitConfig.Burst is not set
+const DefaultCreateBurst = 10
+
+// CreateRateLimitConfig stores rate limit of URL creation
+type CreateRateLimitConfig struct {
+	// RateLimit is the number of URLs per second a client can create
+	RateLimit float64 `yaml:"rate_limit"`
+	// Burst is the number of URLs a client can create at once
+	Burst int `yaml:"burst"`
+}
+
 // URLHandler represent the http handler for url
 type URLHandler struct {
-	urlUsecase    domain.URLUsecase
-	authenticator *auth.Authenticator
-	validator     *web.AppValidator
-	logger        *zap.Logger
-	tracer        trace.Tracer
+	urlUsecase      domain.URLUsecase
+	clicks          domain.ClickRecorder
+	authenticator   *auth.Authenticator
+	validator       *web.AppValidator
+	logger          *zap.Logger
+	tracer          trace.Tracer
+	anonymousDenied atomic.Bool
+	apiKeys         domain.APIKeyAuthenticator
+	anonymizeIP     bool
+	expirations     domain.ExpirationNotifier
+	shortLinks      *domain.ShortLinks
+	flags           featureflag.Flags
+	challenges      *pow.Challenges
+	redirects       *metrics.RedirectMetrics
+	aliases         domain.AliasUsecase
+	// limiters are shared by routes of all API versions
+	createLimiter    echo.MiddlewareFunc
+	challengeLimiter echo.MiddlewareFunc
 }
 
-// NewURLHandler will initialize the url/ resources endpoint
-func NewURLHandler(us domain.URLUsecase, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) (*URLHandler, error) {
+// NewURLHandler will initialize the url/ resources endpoint, clicks records
+// redirects and may be nil
+func NewURLHandler(us domain.URLUsecase, clicks domain.ClickRecorder, authenticator *auth.Authenticator, v *web.AppValidator, logger *zap.Logger, tracer trace.Tracer) (*URLHandler, error) {
 	handler := &URLHandler{
 		urlUsecase:    us,
+		clicks:        clicks,
 		authenticator: authenticator,
 		validator:     v,
 		logger:        logger,
-		tracer:        tracer,
+		tracer:        tracing.Tracer(tracer),
+		flags:         featureflag.NewStatic(nil),
 	}
 
 	err := handler.RegisterValidation()
@@ -50,13 +97,175 @@ func NewURLHandler(us domain.URLUsecase, authenticator *auth.Authenticator, v *w
 
 // RegisterRoutes registers routes for a path with matching handler
 func (uh *URLHandler) RegisterRoutes(e *echo.Echo) {
-	e.POST("/v1/url/create", uh.Store)
-	e.POST("/v1/user/url/create", uh.StoreUserURL, echojwt.WithConfig(uh.authenticator.JWTConfig))
 	e.GET("/:id", uh.Redirect)
-	e.GET("/v1/url/:id", uh.GetByID)
-	e.DELETE("/v1/url/:id", uh.Delete, echojwt.WithConfig(uh.authenticator.JWTConfig))
-	e.PUT("/v1/url", uh.Update, echojwt.WithConfig(uh.authenticator.JWTConfig))
+	uh.RegisterAPIRoutes(e.Group("/v1"))
+}
 
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2
+func (uh *URLHandler) RegisterAPIRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(uh.logger)
+	jwtAuth, optionalAuth := echojwt.WithConfig(uh.authenticator.JWTConfig), uh.optionalAuth()
+	// service accounts work with URLs of their own using API keys
+	if uh.apiKeys != nil {
+		jwtAuth = myMiddl.APIKeyOr(uh.apiKeys, jwtAuth)
+		optionalAuth = myMiddl.APIKeyOr(uh.apiKeys, optionalAuth)
+	}
+	read := []echo.MiddlewareFunc{optionalAuth, myMiddl.RequireScope(auth.ScopeURLRead)}
+	write := []echo.MiddlewareFunc{jwtAuth, myMiddl.SpanIdentity("urlid"), myMiddl.RequireScope(auth.ScopeURLWrite)}
+	g.POST("/url/create", uh.Store, limits(uh.createLimiter)...)
+	g.POST("/user/url/create", uh.StoreUserURL, write...)
+	g.GET("/url/:id", uh.GetByID, read...)
+	g.POST("/url/lookup", uh.Lookup, read...)
+	g.DELETE("/url/:id", uh.Delete, write...)
+	g.PUT("/url", uh.Update, write...)
+	g.PATCH("/url/:id", uh.Patch, write...)
+	if uh.challenges != nil {
+		g.GET("/url/challenge", uh.Challenge, append(limits(uh.challengeLimiter), myMiddl.NoStore)...)
+	}
+	if uh.apiKeys != nil {
+		shorten := append(limits(uh.createLimiter), myMiddl.NoStore, myMiddl.APIKey(uh.apiKeys), myMiddl.SpanIdentity("urlid"), myMiddl.RequireScope(auth.ScopeURLWrite))
+		g.GET("/url/shorten", uh.Shorten, shorten...)
+	}
+}
+
+// limits returns middlewares of rate limiter, they are empty when rate is not
+// limited
+func limits(limiter echo.MiddlewareFunc) []echo.MiddlewareFunc {
+	if limiter == nil {
+		return nil
+	}
+	return []echo.MiddlewareFunc{limiter}
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (uh *URLHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(uh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(uh.authenticator.JWTConfig), myMiddl.SpanIdentity("urlid"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.GET("/urls", uh.Fetch, admin...)
+}
+
+// optionalAuth authenticates requests with Authorization header, requests
+// without it are served as anonymous
+func (uh *URLHandler) optionalAuth() echo.MiddlewareFunc {
+	cfg := uh.authenticator.JWTConfig
+	cfg.Skipper = func(c echo.Context) bool {
+		return c.Request().Header.Get(echo.HeaderAuthorization) == ""
+	}
+	return echojwt.WithConfig(cfg)
+}
+
+// SetAnonymousCreation allows or denies creation of URLs by unauthenticated users.
+// It is safe to call while the server is handling requests.
+func (uh *URLHandler) SetAnonymousCreation(allow bool) {
+	uh.anonymousDenied.Store(!allow)
+}
+
+// SetAPIKeyAuthenticator enables creation of URLs with API keys via GET
+// /url/shorten. It must be called before routes are registered.
+func (uh *URLHandler) SetAPIKeyAuthenticator(a domain.APIKeyAuthenticator) {
+	uh.apiKeys = a
+}
+
+// SetProofOfWork makes anonymous clients solve challenge issued by GET
+// /url/challenge before creating URL. It must be called before routes are
+// registered.
+func (uh *URLHandler) SetProofOfWork(c *pow.Challenges) {
+	uh.challenges = c
+}
+
+// SetCreateRateLimit limits rate URLs are created at by POST /url/create and
+// GET /url/shorten from one client address, see web.ClientIP. Challenges of
+// GET /url/challenge are limited to the same rate separately, so getting one
+// doesn't use up creation. Requests are counted in limits shared by all
+// instances. It must be called before routes are registered.
+func (uh *URLHandler) SetCreateRateLimit(cfg CreateRateLimitConfig, limits domain.LimitStore) {
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = DefaultCreateRateLimit
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultCreateBurst
+	}
+
+	uh.createLimiter = newRateLimiter(cfg, limits, "create")
+	uh.challengeLimiter = newRateLimiter(cfg, limits, "challenge")
+}
+
+// newRateLimiter limits rate of requests from one client address
+func newRateLimiter(cfg CreateRateLimitConfig, limits domain.LimitStore, name string) echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		IdentifierExtractor: web.ClientIdentifier,
+		Store:               _MyMiddleware.NewRateLimiterStore(limits, name, cfg.RateLimit, cfg.Burst),
+	})
+}
+
+// SetCreatorIPAnonymization enables anonymization of IP addresses URLs are
+// created from. It must be called before requests are served.
+func (uh *URLHandler) SetCreatorIPAnonymization(anonymize bool) {
+	uh.anonymizeIP = anonymize
+}
+
+// SetExpirationNotifier sets notifier of URLs found expired on redirect. It
+// must be called before requests are served.
+func (uh *URLHandler) SetExpirationNotifier(n domain.ExpirationNotifier) {
+	uh.expirations = n
+}
+
+// SetShortLinks sets builder of short URLs returned to clients, short URLs are
+// built of request host when it is not set. It must be called before requests
+// are served.
+func (uh *URLHandler) SetShortLinks(l *domain.ShortLinks) {
+	uh.shortLinks = l
+}
+
+// SetFeatureFlags sets flags features of handler are rolled out by. It must
+// be called before requests are served.
+func (uh *URLHandler) SetFeatureFlags(f featureflag.Flags) {
+	uh.flags = f
+}
+
+// SetRedirectMetrics sets metrics redirect latencies are recorded by. It must
+// be called before requests are served.
+func (uh *URLHandler) SetRedirectMetrics(m *metrics.RedirectMetrics) {
+	uh.redirects = m
+}
+
+// SetAliases sets usecase former short codes of renamed URLs are resolved by
+// on redirect. It must be called before requests are served.
+func (uh *URLHandler) SetAliases(a domain.AliasUsecase) {
+	uh.aliases = a
+}
+
+// links returns builder of short URLs of the request, it is nil when base URL
+// is not set and request has no host
+func (uh *URLHandler) links(c echo.Context) *domain.ShortLinks {
+	if uh.shortLinks != nil {
+		return uh.shortLinks
+	}
+
+	l, err := domain.NewShortLinks(c.Scheme() + "://" + c.Request().Host)
+	if err != nil {
+		return nil
+	}
+	return l
+}
+
+// maxUserAgentLength is the maximum length of stored user agent, longer ones
+// are truncated
+const maxUserAgentLength = 512
+
+// creationInfo returns request metadata stored along with URL created through
+// source
+func (uh *URLHandler) creationInfo(c echo.Context, source string) domain.CreationInfo {
+	ip := web.ClientIP(c)
+	if uh.anonymizeIP {
+		ip = domain.AnonymizeIP(ip)
+	}
+	ua := c.Request().UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = strings.ToValidUTF8(ua[:maxUserAgentLength], "")
+	}
+	return domain.CreationInfo{IP: ip, UserAgent: ua, Source: source}
 }
 
 // RegisterValidation will initialize validation for url handler
@@ -76,67 +285,290 @@ func (uh *URLHandler) RegisterValidation() error {
 		return err
 	}
 
+	err = uh.validator.V.RegisterValidation("future", checkFuture)
+	if err != nil {
+		return err
+	}
+
+	err = uh.validator.V.RegisterTranslation("future", uh.validator.Translator, func(ut ut.Translator) error {
+		return ut.Add("future", "{0} must be at least 1 minute in the future", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("future", fe.Field())
+		return t
+	})
+	if err != nil {
+		return err
+	}
+
+	err = uh.validator.V.RegisterValidation("link", checkLink)
+	if err != nil {
+		return err
+	}
+
+	uh.validator.V.RegisterCustomTypeFunc(optionalValue, domain.Optional[string]{}, domain.Optional[time.Time]{})
+
+	err = uh.validator.V.RegisterTranslation("link", uh.validator.Translator, func(ut ut.Translator) error {
+		return ut.Add("link", "{0} must be an http or https URL with host", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("link", fe.Field())
+		return t
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// maxLinkIDLength is the maximum length of URL id, longer ids are rejected
+// before regexp matching
+const maxLinkIDLength = 20
+
+var linkIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
 func checkURL(fl validator.FieldLevel) bool {
-	r := regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
-	return r.MatchString(fl.Field().String())
+	id := fl.Field().String()
+	if len(id) > maxLinkIDLength {
+		return false
+	}
+	return linkIDRegexp.MatchString(id)
 }
 
-// Redirect will redirect to link by given id
+// expirationGrace is the minimum time URL must stay valid after it is created
+// or updated
+const expirationGrace = time.Minute
+
+// checkFuture allows only time after now plus expirationGrace
+func checkFuture(fl validator.FieldLevel) bool {
+	t, ok := fl.Field().Interface().(time.Time)
+	return ok && t.After(time.Now().Add(expirationGrace))
+}
+
+// optionalValue makes validator check value of optional field, absent and null
+// fields are empty
+func optionalValue(field reflect.Value) interface{} {
+	if o, ok := field.Interface().(interface{ ValidationValue() interface{} }); ok {
+		return o.ValidationValue()
+	}
+	return nil
+}
+
+// checkLink allows only http and https links with host, link may omit scheme
+// as it is normalized by usecase
+func checkLink(fl validator.FieldLevel) bool {
+	_, err := domain.NormalizeLink(fl.Field().String(), false)
+	return err == nil
+}
+
+// Redirect will redirect to link by given id, its latency is recorded once
+// response is written
 func (uh *URLHandler) Redirect(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
+	start := time.Now()
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Redirect")
+	defer span.End()
+
+	observation := &domain.RedirectObservation{}
+	outcome := domain.RedirectError
+	defer func() {
+		uh.redirects.Record(ctx, start, outcome, observation.CacheHit)
+	}()
+
+	c.Set(_MyMiddleware.ShortIDKey, c.Param("id"))
+
+	// redirect may be served by secondary, see store.MongoConfig
+	readCtx := domain.WithRedirectObservation(domain.WithReadClass(ctx, domain.ReadRedirect), observation)
+	u, code, re := uh.findByID(readCtx, c)
+	// short code of renamed URL keeps redirecting to it until alias is retired
+	if u == nil && code == http.StatusNotFound && !observation.Disabled && uh.aliases != nil {
+		u, code, re = uh.findByAlias(readCtx, c.Param("id"))
 	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Redirect",
-		trace.WithSpanKind(trace.SpanKindServer),
-	)
+	if u == nil {
+		switch {
+		case code == http.StatusBadRequest:
+			outcome = domain.RedirectInvalid
+		case code == http.StatusNotFound && observation.Disabled:
+			outcome = domain.RedirectDisabled
+		case code == http.StatusNotFound:
+			outcome = domain.RedirectMiss
+		}
+		// browsers get page in locale of the user instead of JSON
+		if code == http.StatusNotFound && web.AcceptsHTML(c.Request()) {
+			return web.RespondHTML(c, code, notFoundPage, c.Param("id"))
+		}
+		return web.RespondError(c, code, re)
+	}
+
+	if uh.clicks != nil {
+		uh.clicks.Record(domain.ClickRequest{
+			URLID:     u.ID,
+			Query:     c.QueryParams(),
+			IP:        c.RealIP(),
+			UserAgent: c.Request().UserAgent(),
+			Referrer:  c.Request().Referer(),
+			// client that asked not to be tracked is only counted
+			DoNotTrack: domain.DoNotTrack(c.Request().Header),
+		})
+	}
+	if uh.expirations != nil {
+		uh.expirations.NotifyExpired(u)
+	}
+	tracing.Success(span)
+	// links flagged as spam are followed through warning page until admin
+	// reviews them, so the page must not be cached
+	if u.Flag != nil {
+		outcome = domain.RedirectFlagged
+		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+		return web.RespondHTML(c, http.StatusOK, interstitialPage, u.Link)
+	}
+	outcome = domain.RedirectHit
+	if u.Status(start) == domain.URLStatusExpired {
+		outcome = domain.RedirectExpired
+	}
+	if uh.flags.EnabledFor(ctx, featureflag.TemporaryRedirect, u.UserID) {
+		return c.Redirect(http.StatusFound, u.Link)
+	}
+	return c.Redirect(http.StatusMovedPermanently, u.Link)
+}
+
+// urlDetail represents URL shown to its owner and admins
+type urlDetail struct {
+	*domain.URL
+	domain.CreationInfo
+}
+
+func newURLDetail(u *domain.URL) urlDetail {
+	info := u.Creation
+	// URLs created before sources were stored have none
+	if info.Source == "" {
+		info.Source = domain.URLSourceUnknown
+	}
+	return urlDetail{URL: u, CreationInfo: info}
+}
+
+// GetByID will get url by given id, ?fields= query parameter selects returned
+// fields. Owner and admins get creation metadata along with all fields.
+// Request with If-Modified-Since gets 304 when URL was not updated since.
+func (uh *URLHandler) GetByID(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http GetByID")
 	defer span.End()
 
-	u, err := uh.getByID(ctx, c)
+	fields, err := domain.ParseURLFields(c.QueryParam("fields"))
 	if err != nil {
 		span.RecordError(err)
-		return err
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: map[string]string{"fields": err.Error()}})
 	}
 
-	if u != nil {
-		span.SetStatus(codes.Ok, "success")
-		return c.Redirect(http.StatusMovedPermanently, u.Link)
+	// claims are nil for anonymous caller
+	user, _ := requestctx.ClaimsFrom(ctx)
+
+	// only metadata is read first, so unchanged URL is never fetched in full
+	if since, ok := ifModifiedSince(c.Request().Header); ok {
+		meta, err := uh.getByID(ctx, c, "updated_at")
+		if err != nil {
+			return tracing.Fail(span, err)
+		}
+		if meta == nil {
+			return nil
+		}
+		if !meta.UpdatedAt.IsZero() && !meta.UpdatedAt.Truncate(time.Second).After(since) {
+			span.SetStatus(codes.Ok, "not modified")
+			setValidators(c, meta)
+			return c.NoContent(http.StatusNotModified)
+		}
 	}
-	return nil
-}
 
-// GetByID will get url by given id
-func (uh *URLHandler) GetByID(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
+	u, err := uh.getByID(ctx, c, fields...)
+	if err != nil {
+		return tracing.Fail(span, err)
 	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http GetByID",
-		trace.WithSpanKind(trace.SpanKindServer),
-	)
-	defer span.End()
 
-	u, err := uh.getByID(ctx, c)
+	if u == nil {
+		return nil
+	}
+	tracing.Success(span)
+	if len(fields) == 0 {
+		uh.links(c).Set(u)
+		setValidators(c, u)
+		if u.OwnedBy(user) {
+			return web.Respond(c, http.StatusOK, newURLDetail(u))
+		}
+		return web.Respond(c, http.StatusOK, u)
+	}
+
+	sparse, err := web.SelectFields(u, fields)
 	if err != nil {
+		return tracing.Fail(span, err)
+	}
+	return web.Respond(c, http.StatusOK, sparse)
+}
+
+// lookupResponse represents URLs lookup result
+type lookupResponse struct {
+	URLs    []interface{} `json:"urls"`
+	Missing []string      `json:"missing"`
+}
+
+// Lookup will get URLs by ids from request body, URLs not owned by caller have
+// only public fields
+func (uh *URLHandler) Lookup(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Lookup")
+	defer span.End()
+
+	l := new(domain.LookupURLs)
+	if err := c.Bind(l); err != nil {
 		span.RecordError(err)
-		return err
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
 	}
 
-	if u != nil {
-		span.SetStatus(codes.Ok, "success")
-		return c.JSON(http.StatusOK, u)
+	if err := c.Validate(l); err != nil {
+		span.RecordError(err)
+		// errors of ids are reported by their index
+		items, fields := uh.validator.TranslateItems(err)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields, Items: items})
 	}
-	return nil
+
+	// claims are nil for anonymous caller
+	user, _ := requestctx.ClaimsFrom(ctx)
+
+	result, err := uh.urlUsecase.Lookup(ctx, l.IDs, user)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	uh.links(c).Set(result.URLs...)
+	resp := lookupResponse{
+		URLs:    make([]interface{}, 0, len(result.URLs)),
+		Missing: result.Missing,
+	}
+	for i, u := range result.URLs {
+		if result.Owned[i] {
+			resp.URLs = append(resp.URLs, u)
+			continue
+		}
+		public, err := web.SelectFields(u, domain.PublicURLFields)
+		if err != nil {
+			return tracing.Fail(span, err)
+		}
+		resp.URLs = append(resp.URLs, public)
+	}
+
+	tracing.Success(span)
+	return web.Respond(c, http.StatusOK, resp)
+}
+
+// getByID gets URL by id of request path, error response is written when URL
+// can't be got and nil URL is returned then
+func (uh *URLHandler) getByID(ctx context.Context, c echo.Context, fields ...string) (*domain.URL, error) {
+	u, code, re := uh.findByID(ctx, c, fields...)
+	if u == nil {
+		return nil, web.RespondError(c, code, re)
+	}
+	return u, nil
 }
 
-func (uh *URLHandler) getByID(ctx context.Context, c echo.Context) (*domain.URL, error) {
+// findByID gets URL by id of request path, status code and response of error
+// are returned when URL can't be got
+func (uh *URLHandler) findByID(ctx context.Context, c echo.Context, fields ...string) (*domain.URL, int, domain.ResponseError) {
 	id := c.Param("id")
 
 	ctx, span := uh.tracer.Start(
@@ -146,77 +578,105 @@ func (uh *URLHandler) getByID(ctx context.Context, c echo.Context) (*domain.URL,
 	)
 	defer span.End()
 
-	err := uh.validator.V.Var(id, "required,linkid,max=20")
+	err := uh.validator.V.Var(id, "required,max=20,linkid")
 	if err != nil {
 		span.RecordError(err)
 		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
-		return nil, c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		return nil, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields}
 	}
 
-	u, err := uh.urlUsecase.GetByID(ctx, id)
+	u, err := uh.urlUsecase.GetByID(ctx, id, fields...)
 	if err != nil {
 		span.RecordError(err)
-		return nil, c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return nil, domain.GetStatusCode(err, uh.logger), domain.NewResponseError(err)
 	}
 	span.SetAttributes(
 		attribute.String("urlid", id),
 	)
 
-	return u, nil
+	return u, http.StatusOK, domain.ResponseError{}
+}
+
+// findByAlias finds URL id is an alias of, redirect through alias is counted
+func (uh *URLHandler) findByAlias(ctx context.Context, id string) (*domain.URL, int, domain.ResponseError) {
+	urlID, err := uh.aliases.Resolve(ctx, id)
+	if err == nil {
+		var u *domain.URL
+		if u, err = uh.urlUsecase.GetByID(ctx, urlID); err == nil {
+			return u, http.StatusOK, domain.ResponseError{}
+		}
+	}
+
+	return nil, domain.GetStatusCode(err, uh.logger), domain.NewResponseError(err)
 }
 
 // Store will store the URL by given request body
 func (uh *URLHandler) Store(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Store",
-		trace.WithSpanKind(trace.SpanKindServer),
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Store")
 	defer span.End()
 
+	if uh.anonymousDenied.Load() {
+		// clients are directed to create endpoint of the API version they called
+		prefix, _ := strings.CutSuffix(c.Path(), "/url/create")
+		err := fmt.Errorf("anonymous URL creation is disabled, use %s/user/url/create: %w", prefix, domain.ErrAuthenticationFailure)
+		span.RecordError(err)
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+		return web.RespondError(c, http.StatusUnauthorized, domain.ResponseError{Error: err.Error()})
+	}
+
+	if uh.challenges != nil {
+		err := uh.challenges.Verify(ctx, c.Request().Header.Get(pow.HeaderChallenge), c.Request().Header.Get(pow.HeaderNonce))
+		if err != nil && !errors.Is(err, domain.ErrForbidden) {
+			return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+		}
+		if err != nil {
+			span.RecordError(err)
+			return web.RespondError(c, http.StatusForbidden, domain.ResponseError{Error: err.Error(), Code: domain.ErrCodeChallengeRequired})
+		}
+	}
+
 	u := new(domain.CreateURL)
-	return uh.storeURL(ctx, c, u)
+	return uh.storeURL(ctx, c, u, domain.URLSourceWeb)
+}
+
+// Challenge will issue proof-of-work challenge for anonymous URL creation,
+// solution is sent in pow.HeaderChallenge and pow.HeaderNonce headers
+func (uh *URLHandler) Challenge(c echo.Context) error {
+	_, span := tracing.StartHandler(c, uh.tracer, "http Challenge")
+	defer span.End()
+
+	ch, err := uh.challenges.Issue()
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	tracing.Success(span)
+	return web.Respond(c, http.StatusOK, ch)
 }
 
 // StoreUserURL will store the URL of authenticated user by given request body
 func (uh *URLHandler) StoreUserURL(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http StoreUserURL",
-		trace.WithSpanKind(trace.SpanKindServer),
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http StoreUserURL")
 	defer span.End()
 
 	u := new(domain.CreateURL)
-	token, ok := c.Get("user").(*jwt.Token)
-	if !ok || token == nil {
-		span.RecordError(domain.ErrForbidden)
-		return c.JSON(http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
-	}
-	user, ok := token.Claims.(*auth.Claims)
-	if !ok {
-		span.RecordError(domain.ErrInternalServerError)
-		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	user, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
 	u.UserID = user.Subject
 
-	span.SetAttributes(
-		attribute.String("userid", user.ID),
-	)
+	// service accounts and scripts authenticate with API keys, web UI with JWT
+	source := domain.URLSourceWeb
+	if c.Request().Header.Get(_MyMiddleware.HeaderAPIKey) != "" {
+		source = domain.URLSourceAPI
+	}
 
-	return uh.storeURL(ctx, c, u)
+	return uh.storeURL(ctx, c, u, source)
 }
 
-func (uh *URLHandler) storeURL(ctx context.Context, c echo.Context, u *domain.CreateURL) error {
+func (uh *URLHandler) storeURL(ctx context.Context, c echo.Context, u *domain.CreateURL, source string) error {
 	ctx, span := uh.tracer.Start(
 		ctx,
 		"http storeURL",
@@ -226,119 +686,339 @@ func (uh *URLHandler) storeURL(ctx context.Context, c echo.Context, u *domain.Cr
 
 	if err := c.Bind(u); err != nil {
 		span.RecordError(err)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: err.Error()})
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
 	}
 
 	if err := c.Validate(u); err != nil {
 		span.RecordError(err)
 		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
 	}
+	u.Creation = uh.creationInfo(c, source)
 
 	result, err := uh.urlUsecase.Store(ctx, *u)
+	var domainErr *domain.UnknownDomainError
+	if errors.As(err, &domainErr) {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: map[string]string{"domain": domainErr.Field()}})
+	}
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	span.SetAttributes(
+		attribute.String("urlid", result.ID),
+	)
+
+	uh.links(c).Set(result)
+	if result.ShortURL != "" {
+		c.Response().Header().Set(echo.HeaderLocation, result.ShortURL)
+	}
+	return web.Respond(c, http.StatusCreated, result)
+}
+
+// Shorten will create URL of API key owner for ?link= query parameter, so it
+// can be used by bookmarklets. Response is HTML page with the short URL, or
+// the short URL as plain text when client accepts text/plain.
+func (uh *URLHandler) Shorten(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Shorten")
+	defer span.End()
+
+	// URL is created with safe method, so it is audited explicitly
+	c.Set(_MyMiddleware.AuditKey, true)
+
+	user, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return uh.respondShorten(c, domain.GetStatusCode(err, uh.logger), "", err.Error())
+	}
+
+	u := domain.CreateURL{Link: strings.TrimSpace(c.QueryParam("link")), UserID: user.Subject, Creation: uh.creationInfo(c, domain.URLSourceBookmarklet)}
+	if err := c.Validate(u); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		msgs := make([]string, 0, len(fields))
+		for _, msg := range fields {
+			msgs = append(msgs, msg)
+		}
+		sort.Strings(msgs)
+		return uh.respondShorten(c, http.StatusBadRequest, "", strings.Join(msgs, "; "))
+	}
+
+	result, err := uh.urlUsecase.Store(ctx, u)
 	if err != nil {
 		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return uh.respondShorten(c, domain.GetStatusCode(err, uh.logger), "", err.Error())
 	}
 
 	span.SetAttributes(
 		attribute.String("urlid", result.ID),
 	)
+	tracing.Success(span)
+
+	uh.links(c).Set(result)
+	if result.ShortURL != "" {
+		c.Response().Header().Set(echo.HeaderLocation, result.ShortURL)
+	}
+	return uh.respondShorten(c, http.StatusCreated, result.ShortURL, "")
+}
+
+// respondShorten writes result of Shorten as plain text or HTML page
+func (uh *URLHandler) respondShorten(c echo.Context, status int, shortURL, errMsg string) error {
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMETextPlain) {
+		if errMsg != "" {
+			return c.String(status, "error: "+errMsg)
+		}
+		return c.String(status, shortURL)
+	}
+
+	return web.RespondHTML(c, status, shortenPage, struct {
+		URL   string
+		Error string
+	}{URL: shortURL, Error: errMsg})
+}
+
+var shortenPage = template.Must(template.New("shorten").Funcs(i18n.Funcs(i18n.DefaultLocale)).Parse(`<!DOCTYPE html>
+<html lang="{{locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{t "shorten.title"}}</title>
+</head>
+<body>
+{{if .Error}}<p>{{t "shorten.error" .Error}}</p>
+{{else}}<input id="url" value="{{.URL}}" size="40" readonly>
+<button onclick="navigator.clipboard.writeText(document.getElementById('url').value)">{{t "shorten.copy"}}</button>
+{{end}}</body>
+</html>
+`))
+
+// notFoundPage is shown to browsers following short links that don't exist
+var notFoundPage = template.Must(template.New("not_found").Funcs(i18n.Funcs(i18n.DefaultLocale)).Parse(`<!DOCTYPE html>
+<html lang="{{locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{t "not_found.title"}}</title>
+</head>
+<body>
+<h1>{{t "not_found.title"}}</h1>
+<p>{{t "not_found.text" .}}</p>
+<p><a href="/">{{t "not_found.home"}}</a></p>
+</body>
+</html>
+`))
+
+// interstitialPage is shown instead of redirect for links flagged as spam
+var interstitialPage = template.Must(template.New("interstitial").Funcs(i18n.Funcs(i18n.DefaultLocale)).Parse(`<!DOCTYPE html>
+<html lang="{{locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{t "interstitial.title"}}</title>
+</head>
+<body>
+<h1>{{t "interstitial.title"}}</h1>
+<p>{{t "interstitial.text" .}}</p>
+<p><a href="{{.}}" rel="noopener noreferrer nofollow">{{t "interstitial.continue"}}</a></p>
+</body>
+</html>
+`))
+
+// Fetch will list URLs of all users by given filter
+func (uh *URLHandler) Fetch(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Fetch")
+	defer span.End()
+
+	filter := new(domain.URLFilter)
+	if err := c.Bind(filter); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
 
-	return c.JSON(http.StatusCreated, result)
+	if err := c.Validate(filter); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	page, err := uh.urlUsecase.Fetch(ctx, *filter)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	links := uh.links(c)
+	for _, u := range page.URLs {
+		links.Set(&u.URL)
+	}
+
+	var next url.Values
+	if page.NextCursor != "" {
+		next = url.Values{"cursor": {page.NextCursor}}
+	}
+	web.SetPageHeaders(c, nil, next, nil, "cursor")
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = domain.DefaultURLPageLimit
+	}
+	return web.RespondList(c, http.StatusOK, page, page.URLs, web.Pagination{
+		Count:      len(page.URLs),
+		Limit:      limit,
+		NextCursor: page.NextCursor,
+	})
 }
 
 // Delete will delete URL by given id
 func (uh *URLHandler) Delete(c echo.Context) error {
 	id := c.Param("id")
 
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Delete",
-		trace.WithSpanKind(trace.SpanKindServer),
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Delete")
 	defer span.End()
 
-	err := uh.validator.V.Var(id, "required,linkid,max=20")
+	err := uh.validator.V.Var(id, "required,max=20,linkid")
 	if err != nil {
 		span.RecordError(err)
 		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
 	}
 
-	token, ok := c.Get("user").(*jwt.Token)
-	if !ok || token == nil {
-		span.RecordError(domain.ErrForbidden)
-		return c.JSON(http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
-	}
-	user, ok := token.Claims.(*auth.Claims)
-	if !ok {
-		span.RecordError(domain.ErrInternalServerError)
-		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	user, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
 	if err = uh.urlUsecase.Delete(ctx, id, user); err != nil {
-		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
-	span.SetAttributes(
-		attribute.String("userid", user.ID),
-		attribute.String("urlid", id),
-	)
-
-	return c.JSON(http.StatusNoContent, nil)
+	return c.NoContent(http.StatusNoContent)
 }
 
 // Update will update the URL by given request body
 func (uh *URLHandler) Update(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Update",
-		trace.WithSpanKind(trace.SpanKindServer),
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Update")
 	defer span.End()
 
 	u := new(domain.UpdateURL)
 	if err := c.Bind(u); err != nil {
 		span.RecordError(err)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: err.Error()})
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
 	}
 
 	if err := c.Validate(u); err != nil {
 		span.RecordError(err)
 		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
 	}
 
-	token, ok := c.Get("user").(*jwt.Token)
-	if !ok || token == nil {
-		span.RecordError(domain.ErrForbidden)
-		return c.JSON(http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
-	}
-	user, ok := token.Claims.(*auth.Claims)
-	if !ok {
-		span.RecordError(domain.ErrInternalServerError)
-		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	user, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
 	if err := uh.urlUsecase.Update(ctx, *u, user); err != nil {
-		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
 	span.SetAttributes(
-		attribute.String("userid", user.ID),
 		attribute.String("urlid", u.ID),
 	)
 
-	return c.JSON(http.StatusNoContent, nil)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Patch will change fields of the URL present in request body. If-Match header
+// with ETag of the URL makes patch fail with 409 when URL was changed since.
+func (uh *URLHandler) Patch(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Patch")
+	defer span.End()
+
+	patch := new(domain.PatchURL)
+	if err := c.Bind(patch); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+	patch.ID = c.Param("id")
+	span.SetAttributes(attribute.String("urlid", patch.ID))
+
+	version, ok := ifMatchVersion(c.Request().Header.Get("If-Match"))
+	if !ok {
+		err := fmt.Errorf("If-Match doesn't match current URL version: %w", domain.ErrConflict)
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusConflict, domain.ResponseError{Error: err.Error()})
+	}
+	patch.Version = version
+
+	if err := c.Validate(patch); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+	if patch.Link.Null {
+		span.RecordError(domain.ErrBadParamInput)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: map[string]string{"link": "link can't be null"}})
+	}
+
+	user, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	u, err := uh.urlUsecase.Patch(ctx, *patch, user)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	tracing.Success(span)
+	uh.links(c).Set(u)
+	c.Response().Header().Set("ETag", etag(u))
+	return web.Respond(c, http.StatusOK, u)
+}
+
+// etag returns strong ETag of URL version
+func etag(u *domain.URL) string {
+	return `"` + u.Version() + `"`
+}
+
+// setValidators sets ETag and Last-Modified headers of URL version, HTTP dates
+// have second granularity, so Last-Modified is truncated to seconds
+func setValidators(c echo.Context, u *domain.URL) {
+	c.Response().Header().Set("ETag", etag(u))
+	if !u.UpdatedAt.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified, u.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// ifModifiedSince returns time of If-Modified-Since header, it is ignored
+// when header is absent or malformed, or when request has If-None-Match
+func ifModifiedSince(header http.Header) (time.Time, bool) {
+	value := header.Get(echo.HeaderIfModifiedSince)
+	if value == "" || header.Get("If-None-Match") != "" {
+		return time.Time{}, false
+	}
+	since, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return since.Truncate(time.Second), true
+}
+
+// ifMatchVersion returns URL version from If-Match header, version is empty
+// when header is absent or "*". Weak and malformed ETags can't match any
+// version.
+func ifMatchVersion(header string) (string, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return "", true
+	}
+	version, ok := strings.CutPrefix(header, `"`)
+	if !ok {
+		return "", false
+	}
+	version, ok = strings.CutSuffix(version, `"`)
+	if !ok || version == "" {
+		return "", false
+	}
+	return version, true
 }
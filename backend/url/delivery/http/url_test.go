@@ -2,9 +2,18 @@ package http_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,14 +23,28 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
 
+	aliasmock "github.com/semka95/shortener/backend/alias/mock"
+	apikeymock "github.com/semka95/shortener/backend/apikey/mock"
+	clickmock "github.com/semka95/shortener/backend/click/mock"
 	"github.com/semka95/shortener/backend/domain"
+	eventmock "github.com/semka95/shortener/backend/event/mock"
+	"github.com/semka95/shortener/backend/featureflag"
+	"github.com/semka95/shortener/backend/metrics"
+	myMiddl "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/pow"
 	"github.com/semka95/shortener/backend/tests"
 	urlHttp "github.com/semka95/shortener/backend/url/delivery/http"
 	"github.com/semka95/shortener/backend/url/mock"
 	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
 )
 
 func TestURLHTTP(t *testing.T) {
@@ -36,7 +59,7 @@ func TestURLHTTP(t *testing.T) {
 	v, err := web.NewAppValidator()
 	require.NoError(t, err)
 
-	handler, err := urlHttp.NewURLHandler(uc, nil, v, nil, tracer)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, nil, tracer)
 	require.NoError(t, err)
 
 	e := echo.New()
@@ -57,7 +80,11 @@ func TestURLHTTP(t *testing.T) {
 		{
 			description: "Redirect success",
 			mockCalls: func(muc *mock.MockURLUsecase) {
-				uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+				uc.EXPECT().GetByID(gomock.Any(), tURL.ID).DoAndReturn(func(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+					// redirect lookups may be served by secondaries
+					assert.Equal(t, domain.ReadRedirect, domain.ReadClassFromContext(ctx))
+					return tURL, nil
+				})
 			},
 			param: tURL.ID,
 			handler: func(t *testing.T, c echo.Context) {
@@ -142,9 +169,12 @@ func TestURLHTTP(t *testing.T) {
 	}
 
 	// Test URLHandler.Store
+	// httptest requests come from 192.0.2.1 without user agent
 	tCreateUserURL := tests.NewCreateURL()
+	tCreateUserURL.Creation = domain.CreationInfo{IP: "192.0.2.1", Source: domain.URLSourceWeb}
 	tCreateURL := tests.NewCreateURL()
 	tCreateURL.UserID = ""
+	tCreateURL.Creation = domain.CreationInfo{IP: "192.0.2.1", Source: domain.URLSourceWeb}
 	tURLCr := tests.NewURL()
 	tURLCr.UserID = ""
 	tCreateURLBadID := tests.NewCreateURL()
@@ -197,8 +227,8 @@ func TestURLHTTP(t *testing.T) {
 				body := new(domain.ResponseError)
 				err = json.NewDecoder(rec.Body).Decode(body)
 				require.NoError(t, err)
-				assert.Equal(t, domain.ErrForbidden.Error(), body.Error)
-				assert.Equal(t, http.StatusForbidden, rec.Code)
+				assert.Equal(t, requestctx.ErrNoClaims.Error(), body.Error)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
 			},
 		},
 		{
@@ -274,6 +304,44 @@ func TestURLHTTP(t *testing.T) {
 				assert.Equal(t, http.StatusBadRequest, rec.Code)
 			},
 		},
+		{
+			description: "Store anonymous creation disabled",
+			mockCalls:   func(muc *mock.MockURLUsecase) {},
+			reqBody:     bytes.NewBuffer(createURLB),
+			auth:        false,
+			handler: func(t *testing.T, c echo.Context) {
+				handler.SetAnonymousCreation(false)
+				defer handler.SetAnonymousCreation(true)
+				c.SetPath("/v2/url/create")
+				err = handler.Store(c)
+				require.NoError(t, err)
+			},
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Contains(t, body.Error, "use /v2/user/url/create")
+				assert.Equal(t, "Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			},
+		},
+		{
+			description: "StoreUserURL success with anonymous creation disabled",
+			mockCalls: func(muc *mock.MockURLUsecase) {
+				uc.EXPECT().Store(gomock.Any(), tCreateUserURL).Return(tURL, nil)
+			},
+			reqBody: bytes.NewBuffer(createUserURLB),
+			auth:    true,
+			handler: func(t *testing.T, c echo.Context) {
+				handler.SetAnonymousCreation(false)
+				defer handler.SetAnonymousCreation(true)
+				err = handler.StoreUserURL(c)
+				require.NoError(t, err)
+			},
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusCreated, rec.Code)
+			},
+		},
 	}
 	for _, tc := range casesCreate {
 		t.Run(tc.description, func(t *testing.T) {
@@ -286,6 +354,7 @@ func TestURLHTTP(t *testing.T) {
 			c.SetPath("/user/url/create")
 			if tc.auth {
 				c.Set("user", token)
+				myMiddl.StoreClaims(c)
 			}
 
 			tc.handler(t, c)
@@ -325,8 +394,8 @@ func TestURLHTTP(t *testing.T) {
 				body := new(domain.ResponseError)
 				err = json.NewDecoder(rec.Body).Decode(body)
 				require.NoError(t, err)
-				assert.Equal(t, domain.ErrForbidden.Error(), body.Error)
-				assert.Equal(t, http.StatusForbidden, rec.Code)
+				assert.Equal(t, requestctx.ErrNoClaims.Error(), body.Error)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
 			},
 		},
 		{
@@ -371,6 +440,7 @@ func TestURLHTTP(t *testing.T) {
 			c.SetParamValues(tc.url.ID)
 			if tc.auth {
 				c.Set("user", token)
+				myMiddl.StoreClaims(c)
 			}
 
 			err = handler.Delete(c)
@@ -417,8 +487,8 @@ func TestURLHTTP(t *testing.T) {
 				body := new(domain.ResponseError)
 				err = json.NewDecoder(rec.Body).Decode(body)
 				require.NoError(t, err)
-				assert.Equal(t, domain.ErrForbidden.Error(), body.Error)
-				assert.Equal(t, http.StatusForbidden, rec.Code)
+				assert.Equal(t, requestctx.ErrNoClaims.Error(), body.Error)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
 			},
 		},
 		{
@@ -475,6 +545,7 @@ func TestURLHTTP(t *testing.T) {
 			c.Reset(req, rec)
 			c.SetPath("/url/update")
 			c.Set("user", tc.token)
+			myMiddl.StoreClaims(c)
 
 			err = handler.Update(c)
 			require.NoError(t, err)
@@ -496,12 +567,6 @@ func TestURLHTTP(t *testing.T) {
 			data:        domain.CreateURL{ID: tests.StringPointer("test1/,!")},
 			want:        "id must contain only a-z, A-Z, 0-9, _, - characters",
 		},
-		{
-			description: "validate CreateURL id too short",
-			fieldName:   "CreateURL.id",
-			data:        domain.CreateURL{ID: tests.StringPointer("tes")},
-			want:        "id must be at least 7 characters in length",
-		},
 		{
 			description: "validate CreateURL id too long",
 			fieldName:   "CreateURL.id",
@@ -518,7 +583,13 @@ func TestURLHTTP(t *testing.T) {
 			description: "validate CreateURL link has wrong format",
 			fieldName:   "CreateURL.link",
 			data:        domain.CreateURL{ID: tests.StringPointer("test123"), Link: "not url"},
-			want:        "link must be a valid URL",
+			want:        "link must be an http or https URL with host",
+		},
+		{
+			description: "validate CreateURL link has not allowed scheme",
+			fieldName:   "CreateURL.link",
+			data:        domain.CreateURL{ID: tests.StringPointer("test123"), Link: "javascript:alert(1)"},
+			want:        "link must be an http or https URL with host",
 		},
 		{
 			description: "validate CreateURL expiration date has wrong format",
@@ -528,7 +599,7 @@ func TestURLHTTP(t *testing.T) {
 				Link:           "https://www.example.org",
 				ExpirationDate: tests.DatePointer(time.Now().AddDate(0, 0, -1)),
 			},
-			want: "expiration_date must be greater than the current Date & Time",
+			want: "expiration_date must be at least 1 minute in the future",
 		},
 	}
 
@@ -556,19 +627,33 @@ func TestURLHTTP(t *testing.T) {
 			want:        "id must be a maximum of 20 characters in length",
 		},
 		{
-			description: "validate UpdateURL expiration date not set",
+			description: "validate UpdateURL nothing to update",
 			fieldName:   "UpdateURL.expiration_date",
 			data:        domain.UpdateURL{ID: "test123"},
-			want:        "expiration_date is a required field",
+			want:        "expiration_date is required when link is not set",
+		},
+		{
+			description: "validate UpdateURL link has wrong format",
+			fieldName:   "UpdateURL.link",
+			data:        domain.UpdateURL{ID: "test123", Link: tests.StringPointer("not url")},
+			want:        "link must be an http or https URL with host",
 		},
+		{
+			description: "validate UpdateURL expiration date within grace period",
+			fieldName:   "UpdateURL.expiration_date",
+			data: domain.UpdateURL{
+				ID:             "test123",
+				ExpirationDate: tests.DatePointer(time.Now().Add(30 * time.Second)),
+			},
+			want: "expiration_date must be at least 1 minute in the future"},
 		{
 			description: "validate UpdateURL expiration date has wrong format",
 			fieldName:   "UpdateURL.expiration_date",
 			data: domain.UpdateURL{
 				ID:             "test123",
-				ExpirationDate: time.Now().AddDate(0, 0, -1),
+				ExpirationDate: tests.DatePointer(time.Now().AddDate(0, 0, -1)),
 			},
-			want: "expiration_date must be greater than the current Date & Time"},
+			want: "expiration_date must be at least 1 minute in the future"},
 	}
 
 	for _, tc := range casesCreateURL {
@@ -589,3 +674,1709 @@ func TestURLHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestURLHTTPSpanIdentity(t *testing.T) {
+	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, nil, tracer)
+	require.NoError(t, err)
+	h := myMiddl.InitMiddleware(nil).SpanIdentity("urlid")(handler.Update)
+
+	e := echo.New()
+	e.Validator = v
+	tUpdateURL := tests.NewUpdateURL()
+	tUpdateURLB, err := json.Marshal(tUpdateURL)
+	require.NoError(t, err)
+
+	cases := []struct {
+		description string
+		token       *jwt.Token
+		code        int
+		attributes  map[attribute.Key]string
+	}{
+		{
+			description: "authenticated request",
+			token:       token,
+			code:        http.StatusNoContent,
+			attributes: map[attribute.Key]string{
+				"enduser.id":   claims.Subject,
+				"enduser.role": auth.RoleUser,
+				"http.route":   "/v1/url",
+			},
+		},
+		{
+			description: "unauthenticated request",
+			code:        http.StatusUnauthorized,
+			attributes:  map[attribute.Key]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.token != nil {
+				uc.EXPECT().Update(gomock.Any(), tUpdateURL, claims).Return(nil)
+			}
+			ctx, span := tracer.Start(context.Background(), "http request")
+			req := httptest.NewRequest(echo.PUT, "/v1/url", bytes.NewBuffer(tUpdateURLB)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/v1/url")
+			if tc.token != nil {
+				c.Set("user", tc.token)
+				myMiddl.StoreClaims(c)
+			}
+
+			err := h(c)
+			require.NoError(t, err)
+			span.End()
+			assert.Equal(t, tc.code, rec.Code)
+
+			var root sdktrace.ReadOnlySpan
+			for _, s := range sr.Ended() {
+				if s.SpanContext().SpanID() == span.SpanContext().SpanID() {
+					root = s
+				}
+			}
+			require.NotNil(t, root)
+
+			got := make(map[attribute.Key]string)
+			for _, attr := range root.Attributes() {
+				got[attr.Key] = attr.Value.AsString()
+			}
+			assert.Equal(t, tc.attributes, got)
+		})
+	}
+}
+
+func TestURLHTTPExpirationDate(t *testing.T) {
+	s := newBenchStack(t)
+	now := time.Now()
+	plus5 := time.FixedZone("UTC+5", 5*60*60)
+	minus7 := time.FixedZone("UTC-7", -7*60*60)
+
+	cases := []struct {
+		description string
+		date        string
+		code        int
+	}{
+		{"future date with positive offset", now.Add(2 * time.Hour).In(plus5).Format(time.RFC3339), http.StatusCreated},
+		{"future date with negative offset", now.Add(2 * time.Hour).In(minus7).Format(time.RFC3339), http.StatusCreated},
+		{"date within grace period", now.Add(30 * time.Second).In(plus5).Format(time.RFC3339), http.StatusBadRequest},
+		{"past date that looks like future in local time", now.Add(-time.Hour).In(plus5).Format(time.RFC3339), http.StatusBadRequest},
+		{"past date with negative offset", now.AddDate(-1, 0, 0).In(minus7).Format(time.RFC3339), http.StatusBadRequest},
+		{"date without offset", now.Add(2 * time.Hour).UTC().Format("2006-01-02T15:04:05"), http.StatusBadRequest},
+	}
+
+	for i, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			body := fmt.Sprintf(`{"id":"expdate%d","link":"https://www.example.org","expiration_date":%q}`, i, tc.date)
+
+			// create path
+			req := httptest.NewRequest(echo.POST, "/v1/url/create", bytes.NewBufferString(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			s.e.ServeHTTP(rec, req)
+			require.Equal(t, tc.code, rec.Code, rec.Body.String())
+
+			if tc.code == http.StatusCreated {
+				want, err := time.Parse(time.RFC3339, tc.date)
+				require.NoError(t, err)
+				result := new(domain.URL)
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), result))
+				assert.True(t, want.Equal(result.ExpirationDate))
+			}
+
+			// update path
+			u := new(domain.UpdateURL)
+			err := json.Unmarshal([]byte(fmt.Sprintf(`{"id":"test123","expiration_date":%q}`, tc.date)), u)
+			if tc.code == http.StatusCreated {
+				require.NoError(t, err)
+				assert.NoError(t, s.validator.V.Struct(u))
+				return
+			}
+			if err == nil {
+				assert.Error(t, s.validator.V.Struct(u))
+			}
+		})
+	}
+}
+
+func TestURLHTTPVersions(t *testing.T) {
+	s := newBenchStack(t)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXRequestID, "req-1")
+		rec := httptest.NewRecorder()
+		rec.Header().Set(echo.HeaderXRequestID, "req-1")
+		s.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("get", func(t *testing.T) {
+		v1 := do(echo.GET, "/v1/url/"+s.url.ID, "")
+		require.Equal(t, http.StatusOK, v1.Code)
+		u := new(domain.URL)
+		require.NoError(t, json.NewDecoder(v1.Body).Decode(u))
+		assert.Equal(t, s.url.Link, u.Link)
+
+		v2 := do(echo.GET, "/v2/url/"+s.url.ID, "")
+		require.Equal(t, http.StatusOK, v2.Code)
+		env := struct {
+			Data *domain.URL `json:"data"`
+		}{}
+		require.NoError(t, json.NewDecoder(v2.Body).Decode(&env))
+		require.NotNil(t, env.Data)
+		assert.Equal(t, u, env.Data)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		v1 := do(echo.GET, "/v1/url/missing1", "")
+		require.Equal(t, http.StatusNotFound, v1.Code)
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, v1.Header().Get(echo.HeaderContentType))
+		re := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(v1.Body).Decode(re))
+		assert.Contains(t, re.Error, domain.ErrNotFound.Error())
+
+		v2 := do(echo.GET, "/v2/url/missing1", "")
+		require.Equal(t, http.StatusNotFound, v2.Code)
+		assert.Equal(t, web.MIMEApplicationProblemJSON, v2.Header().Get(echo.HeaderContentType))
+		p := new(web.Problem)
+		require.NoError(t, json.NewDecoder(v2.Body).Decode(p))
+		assert.Equal(t, web.Problem{
+			Type:     "about:blank",
+			Title:    "Not Found",
+			Status:   http.StatusNotFound,
+			Detail:   re.Error,
+			Instance: "req-1",
+		}, *p)
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		body := `{"link":"javascript:alert(1)"}`
+		v1 := do(echo.POST, "/v1/url/create", body)
+		require.Equal(t, http.StatusBadRequest, v1.Code)
+		re := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(v1.Body).Decode(re))
+
+		v2 := do(echo.POST, "/v2/url/create", body)
+		require.Equal(t, http.StatusBadRequest, v2.Code)
+		p := new(web.Problem)
+		require.NoError(t, json.NewDecoder(v2.Body).Decode(p))
+		assert.Equal(t, re.Error, p.Detail)
+		assert.Equal(t, re.Fields, p.Errors)
+		assert.NotEmpty(t, p.Errors)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		v1 := do(echo.DELETE, "/v1/url/"+s.url.ID, "")
+		require.Equal(t, http.StatusUnauthorized, v1.Code)
+		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, v1.Header().Get(echo.HeaderContentType))
+
+		v2 := do(echo.DELETE, "/v2/url/"+s.url.ID, "")
+		require.Equal(t, http.StatusUnauthorized, v2.Code)
+		p := new(web.Problem)
+		require.NoError(t, json.NewDecoder(v2.Body).Decode(p))
+		assert.Equal(t, http.StatusUnauthorized, p.Status)
+		assert.Equal(t, "Unauthorized", p.Title)
+		assert.NotEmpty(t, p.Detail)
+	})
+}
+
+func TestURLHTTPFields(t *testing.T) {
+	s := newBenchStack(t)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, target, nil)
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("v1 selected fields", func(t *testing.T) {
+		rec := get("/v1/url/" + s.url.ID + "?fields=id,%20link,id")
+		require.Equal(t, http.StatusOK, rec.Code)
+		body := make(map[string]interface{})
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"id": s.url.ID, "link": s.url.Link}, body)
+	})
+
+	t.Run("v2 selected fields", func(t *testing.T) {
+		rec := get("/v2/url/" + s.url.ID + "?fields=link")
+		require.Equal(t, http.StatusOK, rec.Code)
+		env := struct {
+			Data map[string]interface{} `json:"data"`
+		}{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&env))
+		assert.Equal(t, map[string]interface{}{"link": s.url.Link}, env.Data)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		v1 := get("/v1/url/" + s.url.ID + "?fields=id,password")
+		require.Equal(t, http.StatusBadRequest, v1.Code)
+		re := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(v1.Body).Decode(re))
+		assert.Contains(t, re.Fields["fields"], `"password"`)
+		assert.Contains(t, re.Fields["fields"], "expiration_date")
+
+		v2 := get("/v2/url/" + s.url.ID + "?fields=id,password")
+		require.Equal(t, http.StatusBadRequest, v2.Code)
+		p := new(web.Problem)
+		require.NoError(t, json.NewDecoder(v2.Body).Decode(p))
+		assert.Equal(t, re.Fields, p.Errors)
+	})
+}
+
+func TestURLHTTPIfModifiedSince(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/v1/url/:id", handler.GetByID)
+	tURL := tests.NewURL()
+	tURL.UpdatedAt = time.Date(2023, 5, 10, 12, 30, 15, 500*int(time.Millisecond), time.UTC)
+	lastModified := "Wed, 10 May 2023 12:30:15 GMT"
+
+	get := func(ifModifiedSince string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID, nil)
+		req.Header.Set(echo.HeaderIfModifiedSince, ifModifiedSince)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("last modified", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		rec := get("")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, lastModified, rec.Header().Get(echo.HeaderLastModified))
+	})
+
+	// milliseconds of updated_at are truncated, so the same second is unmodified
+	for _, since := range []string{lastModified, "Wed, 10 May 2023 12:31:00 GMT"} {
+		t.Run("unmodified since "+since, func(t *testing.T) {
+			uc.EXPECT().GetByID(gomock.Any(), tURL.ID, "updated_at").Return(tURL, nil)
+
+			rec := get(since)
+			assert.Equal(t, http.StatusNotModified, rec.Code)
+			assert.Empty(t, rec.Body.String())
+			assert.Equal(t, lastModified, rec.Header().Get(echo.HeaderLastModified))
+			assert.Equal(t, `"`+tURL.Version()+`"`, rec.Header().Get("ETag"))
+		})
+	}
+
+	t.Run("modified", func(t *testing.T) {
+		gomock.InOrder(
+			uc.EXPECT().GetByID(gomock.Any(), tURL.ID, "updated_at").Return(tURL, nil),
+			uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil),
+		)
+
+		rec := get("Wed, 10 May 2023 12:30:14 GMT")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), tURL.Link)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		rec := get("yesterday")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID, "updated_at").Return(nil, domain.ErrNotFound)
+
+		rec := get(lastModified)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestURLHTTPLookup(t *testing.T) {
+	s := newBenchStack(t)
+	anonURL := tests.NewURL()
+	anonURL.ID = "anon123"
+	anonURL.UserID = ""
+	require.NoError(t, s.urls.Store(context.Background(), anonURL))
+
+	type response struct {
+		URLs    []map[string]interface{} `json:"urls"`
+		Missing []string                 `json:"missing"`
+	}
+	lookup := func(target, body, subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, target, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if subject != "" {
+			token, err := s.authenticator.GenerateToken(auth.NewClaims(subject, []string{auth.RoleUser}, time.Now(), time.Minute))
+			require.NoError(t, err)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		return rec
+	}
+	body := fmt.Sprintf(`{"ids":["missing","%s","%s"]}`, anonURL.ID, s.url.ID)
+
+	t.Run("anonymous", func(t *testing.T) {
+		rec := lookup("/v1/url/lookup", body, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		resp := new(response)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(resp))
+		assert.Equal(t, []map[string]interface{}{
+			{"id": anonURL.ID, "link": anonURL.Link, "short_url": "http://example.com/" + anonURL.ID},
+			{"id": s.url.ID, "link": s.url.Link, "short_url": "http://example.com/" + s.url.ID},
+		}, resp.URLs)
+		assert.Equal(t, []string{"missing"}, resp.Missing)
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		rec := lookup("/v2/url/lookup", body, s.url.UserID)
+		require.Equal(t, http.StatusOK, rec.Code)
+		env := struct {
+			Data response `json:"data"`
+		}{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&env))
+		require.Len(t, env.Data.URLs, 2)
+		assert.Len(t, env.Data.URLs[0], 3)
+		assert.Equal(t, s.url.ID, env.Data.URLs[1]["id"])
+		assert.Equal(t, s.url.UserID, env.Data.URLs[1]["user_id"])
+		assert.Contains(t, env.Data.URLs[1], "expiration_date")
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		req := httptest.NewRequest(echo.POST, "/v1/url/lookup", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer invalid")
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		ids := make([]string, domain.MaxLookupIDs+1)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("id%05d", i)
+		}
+		tooMany, err := json.Marshal(domain.LookupURLs{IDs: ids})
+		require.NoError(t, err)
+
+		for _, body := range []string{`{"ids":[]}`, string(tooMany)} {
+			rec := lookup("/v1/url/lookup", body, "")
+			assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+			re := new(domain.ResponseError)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+			assert.Equal(t, "validation error", re.Error)
+			assert.NotEmpty(t, re.Fields)
+			assert.Empty(t, re.Items)
+		}
+	})
+
+	t.Run("invalid ids", func(t *testing.T) {
+		rec := lookup("/v1/url/lookup", `{"ids":["test123","te!t","","test456","x!"]}`, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		re := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+		assert.Equal(t, "validation error", re.Error)
+		assert.Empty(t, re.Fields)
+		require.Len(t, re.Items, 3)
+		for i, index := range []int{1, 2, 4} {
+			assert.Equal(t, index, re.Items[i].Index)
+			assert.Empty(t, re.Items[i].Field)
+			assert.NotEmpty(t, re.Items[i].Message)
+		}
+	})
+}
+
+func TestURLHTTPUnknownFields(t *testing.T) {
+	s := newBenchStack(t)
+	token, err := s.authenticator.GenerateToken(auth.NewClaims(s.url.UserID, []string{auth.RoleUser}, time.Now(), time.Minute))
+	require.NoError(t, err)
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	cases := []struct {
+		description string
+		method      string
+		target      string
+		body        string
+		field       string
+	}{
+		{
+			description: "create",
+			method:      echo.POST,
+			target:      "/v1/url/create",
+			body:        `{"link":"https://example.com","expirationdate":"` + expiration + `"}`,
+			field:       "expirationdate",
+		},
+		{
+			description: "create user url",
+			method:      echo.POST,
+			target:      "/v1/user/url/create",
+			body:        `{"link":"https://example.com","ID":"custom1","user_id":"507f191e810c19729de860eb"}`,
+			field:       "user_id",
+		},
+		{
+			description: "create with source",
+			method:      echo.POST,
+			target:      "/v1/url/create",
+			body:        `{"link":"https://example.com","source":"import"}`,
+			field:       "source",
+		},
+		{
+			description: "update",
+			method:      echo.PUT,
+			target:      "/v1/url",
+			body:        `{"id":"` + s.url.ID + `","expiration":"` + expiration + `"}`,
+			field:       "expiration",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			rec := httptest.NewRecorder()
+			s.e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			re := new(domain.ResponseError)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+			assert.Equal(t, "validation error", re.Error)
+			assert.Contains(t, re.Fields, tc.field)
+		})
+	}
+
+	t.Run("trailing data", func(t *testing.T) {
+		req := httptest.NewRequest(echo.POST, "/v2/url/create", bytes.NewBufferString(`{"link":"https://example.com"}}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		p := new(web.Problem)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(p))
+		assert.Contains(t, p.Detail, "unexpected data after JSON document")
+	})
+}
+
+func TestURLHTTPRedirectRecordsClick(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	clicks := clickmock.NewMockClickRecorder(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, clicks, nil, v, nil, sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/:id", handler.Redirect)
+	tURL := tests.NewURL()
+
+	t.Run("found", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		clicks.EXPECT().Record(domain.ClickRequest{
+			URLID:     tURL.ID,
+			Query:     url.Values{"utm_source": {"newsletter"}},
+			IP:        "192.0.2.1",
+			UserAgent: "test-agent",
+			Referrer:  "https://news.example.com/",
+		})
+
+		req := httptest.NewRequest(echo.GET, "/"+tURL.ID+"?utm_source=newsletter", nil)
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("Referer", "https://news.example.com/")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	})
+
+	t.Run("do not track", func(t *testing.T) {
+		for _, header := range []string{"DNT", "Sec-GPC"} {
+			uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+			clicks.EXPECT().Record(domain.ClickRequest{URLID: tURL.ID, Query: url.Values{}, IP: "192.0.2.1", DoNotTrack: true})
+
+			req := httptest.NewRequest(echo.GET, "/"+tURL.ID, nil)
+			req.Header.Set(header, "1")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(nil, domain.ErrNotFound)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/"+tURL.ID, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden compares page with testdata/<name>.golden
+func assertGolden(t *testing.T, name, page string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		require.NoError(t, os.WriteFile(path, []byte(page), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), page)
+}
+
+func TestURLHTTPRedirectNotFoundPage(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(myMiddl.InitMiddleware(zap.NewNop()).Locale)
+	e.GET("/:id", handler.Redirect)
+
+	redirect := func(accept, acceptLanguage string) *httptest.ResponseRecorder {
+		uc.EXPECT().GetByID(gomock.Any(), "missing").Return(nil, domain.ErrNotFound)
+		req := httptest.NewRequest(echo.GET, "/missing", nil)
+		req.Header.Set(echo.HeaderAccept, accept)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	cases := []struct {
+		description    string
+		acceptLanguage string
+		golden         string
+	}{
+		{description: "english", acceptLanguage: "en-US,en;q=0.9", golden: "not_found.en"},
+		{description: "russian", acceptLanguage: "ru-RU,ru;q=0.9,en;q=0.8", golden: "not_found.ru"},
+		{description: "unsupported language", acceptLanguage: "de-DE", golden: "not_found.en"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			rec := redirect(browser, tc.acceptLanguage)
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, "Accept-Language", rec.Header().Get(echo.HeaderVary))
+			assertGolden(t, tc.golden, rec.Body.String())
+		})
+	}
+
+	t.Run("api client", func(t *testing.T) {
+		rec := redirect(echo.MIMEApplicationJSON, "ru")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+	})
+}
+
+func TestURLHTTPRedirectAlias(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	aliases := aliasmock.NewMockAliasUsecase(controller)
+	tURL := tests.NewURL()
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	handler.SetAliases(aliases)
+
+	e := echo.New()
+	e.GET("/:id", handler.Redirect)
+
+	redirect := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/"+id, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("alias", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), "oldcode").Return(nil, domain.ErrNotFound)
+		aliases.EXPECT().Resolve(gomock.Any(), "oldcode").Return(tURL.ID, nil)
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		rec := redirect("oldcode")
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, tURL.Link, rec.Header().Get(echo.HeaderLocation))
+	})
+
+	t.Run("retired alias", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), "oldcode").Return(nil, domain.ErrNotFound)
+		aliases.EXPECT().Resolve(gomock.Any(), "oldcode").Return("", domain.ErrNotFound)
+
+		rec := redirect("oldcode")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("url found", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		rec := redirect(tURL.ID)
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	})
+}
+
+func TestURLHTTPRedirectFlagged(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Use(myMiddl.InitMiddleware(zap.NewNop()).Locale)
+	e.GET("/:id", handler.Redirect)
+
+	flagged := &domain.URL{ID: "test123", Link: "https://bit.ly/abc?a=1&b=2", Flag: &domain.URLFlag{Score: 40, Signals: []string{"nested_shortener"}}}
+	cases := []struct {
+		description    string
+		acceptLanguage string
+		golden         string
+	}{
+		{description: "english", acceptLanguage: "en", golden: "interstitial.en"},
+		{description: "russian", acceptLanguage: "ru", golden: "interstitial.ru"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			uc.EXPECT().GetByID(gomock.Any(), "test123").Return(flagged, nil)
+			req := httptest.NewRequest(echo.GET, "/test123", nil)
+			req.Header.Set("Accept-Language", tc.acceptLanguage)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, rec.Header().Get(echo.HeaderLocation))
+			assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+			assertGolden(t, tc.golden, rec.Body.String())
+		})
+	}
+}
+
+func TestURLHTTPCanonicalPath(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Pre(myMiddl.InitMiddleware(zap.NewNop()).CanonicalPath("/v1", "/v2"))
+	e.GET("/:id", handler.Redirect)
+	e.GET("/v1/url/:id", handler.GetByID)
+	tURL := tests.NewURL()
+
+	for _, path := range []string{"/" + tURL.ID + "/", "//" + tURL.ID} {
+		t.Run("redirect "+path, func(t *testing.T) {
+			uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(echo.GET, path, nil))
+			assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+			assert.Equal(t, tURL.Link, rec.Header().Get("Location"))
+		})
+	}
+
+	t.Run("redirect with path", func(t *testing.T) {
+		// path after id is left as is, so it can be forwarded to destination
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/"+tURL.ID+"/docs/", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	for path, location := range map[string]string{
+		"/v1/url/" + tURL.ID + "/":             "/v1/url/" + tURL.ID,
+		"/v1//url/" + tURL.ID + "?fields=link": "/v1/url/" + tURL.ID + "?fields=link",
+	} {
+		t.Run("api "+path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(echo.GET, path, nil))
+			assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+			assert.Equal(t, location, rec.Header().Get("Location"))
+		})
+	}
+
+	t.Run("api canonical", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestURLHTTPRedirectNotifiesExpiration(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	expirations := eventmock.NewMockExpirationNotifier(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, nil, sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	handler.SetExpirationNotifier(expirations)
+
+	e := echo.New()
+	e.GET("/:id", handler.Redirect)
+	tURL := tests.NewURL()
+	tURL.ExpirationDate = time.Now().Add(-time.Minute)
+
+	uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+	expirations.EXPECT().NotifyExpired(tURL)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/"+tURL.ID, nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+}
+
+func TestURLHTTPNilTracer(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), nil)
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.GET("/:id", handler.Redirect)
+	e.GET("/v1/url/:id", handler.GetByID)
+	tURL := tests.NewURL()
+
+	uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil).Times(2)
+	uc.EXPECT().GetByID(gomock.Any(), "missing").Return(nil, domain.NotFoundError(domain.EntityURL, "missing", "URL was not found"))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/"+tURL.ID, nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/v1/url/missing", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	re := new(domain.ResponseError)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+	assert.Equal(t, domain.EntityURL, re.Entity)
+	assert.Equal(t, "missing", re.ID)
+}
+
+func TestURLHTTPRedirectTemporary(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, nil, sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	tURL := tests.NewURL()
+	anonymous := tests.NewURL()
+	anonymous.UserID = ""
+	handler.SetFeatureFlags(featureflag.NewStatic(featureflag.Config{
+		featureflag.TemporaryRedirect: {Percentage: featureflag.Bucket(featureflag.TemporaryRedirect, tURL.UserID) + 1},
+	}))
+
+	e := echo.New()
+	e.GET("/:id", handler.Redirect)
+
+	uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/"+tURL.ID, nil))
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	// URLs of anonymous users are only rolled out when flag is enabled
+	uc.EXPECT().GetByID(gomock.Any(), anonymous.ID).Return(anonymous, nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/"+anonymous.ID, nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+}
+
+func TestURLHTTPShortURL(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	links, err := domain.NewShortLinks("https://sho.rt/s/")
+	require.NoError(t, err)
+	handler.SetShortLinks(links)
+
+	e := echo.New()
+	e.Validator = v
+	e.POST("/v1/url/create", handler.Store)
+	e.GET("/v1/url/:id", handler.GetByID)
+	tURL := tests.NewURL()
+	shortURL := "https://sho.rt/s/" + tURL.ID
+
+	t.Run("create", func(t *testing.T) {
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(tURL, nil)
+
+		req := httptest.NewRequest(echo.POST, "/v1/url/create", strings.NewReader(`{"link":"`+tURL.Link+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, shortURL, rec.Header().Get(echo.HeaderLocation))
+		body := make(map[string]interface{})
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, shortURL, body["short_url"])
+	})
+
+	t.Run("get", func(t *testing.T) {
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID, nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		body := make(map[string]interface{})
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, shortURL, body["short_url"])
+	})
+
+	t.Run("invalid base URL", func(t *testing.T) {
+		for _, base := range []string{"", "sho.rt", "ftp://sho.rt", "https://", "https://sho.rt/?a=1", "https://sho.rt/#top", "https://user@sho.rt"} {
+			_, err := domain.NewShortLinks(base)
+			assert.Error(t, err, base)
+		}
+	})
+}
+
+func TestURLHTTPPatch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
+	e := echo.New()
+	e.Validator = v
+	e.PATCH("/v1/url/:id", handler.Patch, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", jwt.NewWithClaims(jwt.SigningMethodHS256, claims))
+			myMiddl.StoreClaims(c)
+			return next(c)
+		}
+	})
+
+	tURL := tests.NewURL()
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+
+	cases := []struct {
+		description string
+		body        string
+		ifMatch     string
+		mockCalls   func()
+		wantStatus  int
+		wantFields  map[string]string
+	}{
+		{
+			description: "absent fields are not patched",
+			body:        `{"link":"https://example.com/new"}`,
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), domain.PatchURL{
+					ID:   tURL.ID,
+					Link: domain.Optional[string]{Set: true, Value: "https://example.com/new"},
+				}, claims).Return(tURL, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			description: "null expiration date is cleared",
+			body:        `{"expiration_date":null}`,
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), domain.PatchURL{
+					ID:             tURL.ID,
+					ExpirationDate: domain.Optional[time.Time]{Set: true, Null: true},
+				}, claims).Return(tURL, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			description: "expiration date",
+			body:        `{"expiration_date":"` + expiration.Format(time.RFC3339) + `"}`,
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), domain.PatchURL{
+					ID:             tURL.ID,
+					ExpirationDate: domain.Optional[time.Time]{Set: true, Value: expiration},
+				}, claims).Return(tURL, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			description: "If-Match version is passed",
+			body:        `{"link":"example.com"}`,
+			ifMatch:     `"` + tURL.Version() + `"`,
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), domain.PatchURL{
+					ID:      tURL.ID,
+					Link:    domain.Optional[string]{Set: true, Value: "example.com"},
+					Version: tURL.Version(),
+				}, claims).Return(tURL, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			description: "If-Match any version",
+			body:        `{"link":"example.com"}`,
+			ifMatch:     "*",
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), domain.PatchURL{
+					ID:   tURL.ID,
+					Link: domain.Optional[string]{Set: true, Value: "example.com"},
+				}, claims).Return(tURL, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			description: "version mismatch",
+			body:        `{"link":"example.com"}`,
+			ifMatch:     `"1"`,
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), gomock.Any(), claims).Return(nil, domain.ErrConflict)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			description: "weak If-Match never matches",
+			body:        `{"link":"example.com"}`,
+			ifMatch:     `W/"` + tURL.Version() + `"`,
+			mockCalls:   func() {},
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			description: "null link",
+			body:        `{"link":null}`,
+			mockCalls:   func() {},
+			wantStatus:  http.StatusBadRequest,
+			wantFields:  map[string]string{"link": "link can't be null"},
+		},
+		{
+			description: "invalid link",
+			body:        `{"link":"ftp://example.com"}`,
+			mockCalls:   func() {},
+			wantStatus:  http.StatusBadRequest,
+			wantFields:  map[string]string{"PatchURL.link": "link must be an http or https URL with host"},
+		},
+		{
+			description: "expiration date in the past",
+			body:        `{"expiration_date":"2000-01-01T00:00:00Z"}`,
+			mockCalls:   func() {},
+			wantStatus:  http.StatusBadRequest,
+			wantFields:  map[string]string{"PatchURL.expiration_date": "expiration_date must be at least 1 minute in the future"},
+		},
+		{
+			description: "forbidden",
+			body:        `{"link":"example.com"}`,
+			mockCalls: func() {
+				uc.EXPECT().Patch(gomock.Any(), gomock.Any(), claims).Return(nil, domain.ErrForbidden)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls()
+			req := httptest.NewRequest(http.MethodPatch, "/v1/url/"+tURL.ID, strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, tc.wantStatus, rec.Code, rec.Body.String())
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, `"`+tURL.Version()+`"`, rec.Header().Get("ETag"))
+				return
+			}
+			if tc.wantFields != nil {
+				body := new(domain.ResponseError)
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+				assert.EqualValues(t, tc.wantFields, body.Fields)
+			}
+		})
+	}
+}
+
+func TestURLHTTPShorten(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	apiKeys := apikeymock.NewMockAPIKeyAuthenticator(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	handler.SetAPIKeyAuthenticator(apiKeys)
+
+	e := echo.New()
+	e.Validator = v
+	handler.RegisterRoutes(e)
+
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	shorten := func(link, apiKey, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/v1/url/shorten?"+url.Values{"link": {link}, "api_key": {apiKey}}.Encode(), nil)
+		req.Host = "sho.rt"
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("html page", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_valid").Return(claims, nil)
+		uc.EXPECT().Store(gomock.Any(), domain.CreateURL{Link: tURL.Link, UserID: tURL.UserID, Creation: domain.CreationInfo{IP: "192.0.2.1", Source: domain.URLSourceBookmarklet}}).Return(tURL, nil)
+
+		rec := shorten(tURL.Link, "shk_valid", "text/html,*/*")
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+		assert.Contains(t, rec.Body.String(), `value="http://sho.rt/`+tURL.ID+`"`)
+		assert.Contains(t, rec.Body.String(), "navigator.clipboard")
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_valid").Return(claims, nil)
+		uc.EXPECT().Store(gomock.Any(), domain.CreateURL{Link: tURL.Link, UserID: tURL.UserID, Creation: domain.CreationInfo{IP: "192.0.2.1", Source: domain.URLSourceBookmarklet}}).Return(tURL, nil)
+
+		rec := shorten(" "+tURL.Link+" ", "shk_valid", echo.MIMETextPlain)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "http://sho.rt/"+tURL.ID, rec.Body.String())
+		assert.Equal(t, "http://sho.rt/"+tURL.ID, rec.Header().Get(echo.HeaderLocation))
+	})
+
+	t.Run("invalid link", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_valid").Return(claims, nil)
+
+		rec := shorten("not a link", "shk_valid", echo.MIMETextPlain)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Body.String(), "error: "))
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+	})
+
+	t.Run("usecase error", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_valid").Return(claims, nil)
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil, domain.ErrBlocked)
+
+		rec := shorten(tURL.Link, "shk_valid", "")
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Can&#39;t shorten the link: "+domain.ErrBlocked.Error())
+	})
+
+	t.Run("invalid api key", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_invalid").Return(nil, domain.ErrAuthenticationFailure)
+
+		rec := shorten(tURL.Link, "shk_invalid", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+	})
+
+	t.Run("missing api key", func(t *testing.T) {
+		rec := shorten(tURL.Link, "", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestURLHTTPCreateRateLimit(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	apiKeys := apikeymock.NewMockAPIKeyAuthenticator(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	handler.SetAPIKeyAuthenticator(apiKeys)
+	limits := tests.NewMemoryLimitStore()
+	handler.SetCreateRateLimit(urlHttp.CreateRateLimitConfig{RateLimit: 0.001, Burst: 2}, limits)
+	challenges, err := pow.New(pow.Config{Difficulty: 1}, limits)
+	require.NoError(t, err)
+	handler.SetProofOfWork(challenges)
+
+	e := echo.New()
+	e.Validator = v
+	e.IPExtractor = myMiddl.IPExtractor(nil)
+	handler.RegisterRoutes(e)
+	handler.RegisterAPIRoutes(e.Group("/v2"))
+
+	tURL := tests.NewURL()
+	claims := auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Minute)
+	apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_valid").Return(claims, nil).Times(2)
+	uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(tURL, nil).Times(2)
+
+	serve := func(req *http.Request, i int) int {
+		req.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("203.0.113.%d", i))
+		req.Header.Set(echo.HeaderXRealIP, fmt.Sprintf("198.51.100.%d", i))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	shorten := func(version string, i int) int {
+		req := httptest.NewRequest(echo.GET, "/"+version+"/url/shorten?"+url.Values{"link": {tURL.Link}, "api_key": {"shk_valid"}}.Encode(), nil)
+		return serve(req, i)
+	}
+	create := func(i int) int {
+		req := httptest.NewRequest(echo.POST, "/v1/url/create", strings.NewReader(`{"link":"`+tURL.Link+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		return serve(req, i)
+	}
+
+	assert.Equal(t, http.StatusCreated, shorten("v1", 0))
+	assert.Equal(t, http.StatusCreated, shorten("v2", 1))
+	assert.Equal(t, http.StatusTooManyRequests, shorten("v1", 2), "forwarded headers of untrusted peer are ignored")
+	assert.Equal(t, http.StatusTooManyRequests, create(3), "creation routes share the limit")
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, serve(httptest.NewRequest(echo.GET, "/v1/url/challenge", nil), i), "challenges are limited separately")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve(httptest.NewRequest(echo.GET, "/v2/url/challenge", nil), 2))
+}
+
+func TestURLHTTPServiceAccountScopes(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	apiKeys := apikeymock.NewMockAPIKeyAuthenticator(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	handler.SetAPIKeyAuthenticator(apiKeys)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+
+	tURL := tests.NewURL()
+	serviceClaims := func(scopes ...string) *auth.Claims {
+		claims := auth.NewClaims(tURL.UserID, []string{}, time.Now(), time.Minute)
+		claims.Type = auth.TypeService
+		claims.Scopes = scopes
+		return claims
+	}
+	do := func(method, target, body, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(myMiddl.HeaderAPIKey, apiKey)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	createBody := `{"link":"` + tURL.Link + `"}`
+
+	t.Run("read scope", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_read").Return(serviceClaims(auth.ScopeURLRead), nil).Times(5)
+		uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		assert.Equal(t, http.StatusOK, do(echo.GET, "/v1/url/"+tURL.ID, "", "shk_read").Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.POST, "/v1/user/url/create", createBody, "shk_read").Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.DELETE, "/v1/url/"+tURL.ID, "", "shk_read").Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.PATCH, "/v1/url/"+tURL.ID, `{"link":"`+tURL.Link+`"}`, "shk_read").Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.GET, "/v1/url/shorten?"+url.Values{"link": {tURL.Link}, "api_key": {"shk_read"}}.Encode(), "", "").Code)
+	})
+
+	t.Run("write scope", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_write").Return(serviceClaims(auth.ScopeURLWrite), nil).Times(2)
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u domain.CreateURL) (*domain.URL, error) {
+			assert.Equal(t, tURL.UserID, u.UserID)
+			assert.Equal(t, domain.URLSourceAPI, u.Creation.Source)
+			return tURL, nil
+		})
+
+		assert.Equal(t, http.StatusCreated, do(echo.POST, "/v1/user/url/create", createBody, "shk_write").Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.GET, "/v1/url/"+tURL.ID, "", "shk_write").Code)
+	})
+
+	t.Run("invalid api key", func(t *testing.T) {
+		apiKeys.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "shk_invalid").Return(nil, domain.ErrAuthenticationFailure)
+
+		assert.Equal(t, http.StatusUnauthorized, do(echo.POST, "/v1/user/url/create", createBody, "shk_invalid").Code)
+	})
+}
+
+func TestURLHTTPFetch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+	adminToken, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleUser, auth.RoleAdmin}, time.Now(), time.Hour))
+	require.NoError(t, err)
+	userToken, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	fetch := func(query, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.GET, "/v1/admin/urls?"+query, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("success", func(t *testing.T) {
+		tURL := tests.NewURL()
+		after := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		filter := domain.URLFilter{
+			Owner:        "owner@example.com",
+			Domain:       "example.org",
+			CreatedAfter: &after,
+			Status:       domain.URLStatusActive,
+			Source:       domain.URLSourceAPI,
+			Q:            "test",
+			Limit:        1,
+		}
+		page := &domain.URLPage{
+			URLs:       []*domain.AdminURL{{URL: *tURL, CreationInfo: domain.CreationInfo{IP: "203.0.113.0", Source: domain.URLSourceAPI}, Status: domain.URLStatusActive, OwnerEmail: "owner@example.com", Clicks: 7}},
+			NextCursor: tURL.ID,
+		}
+		uc.EXPECT().Fetch(gomock.Any(), filter).Return(page, nil)
+
+		rec := fetch("owner=owner@example.com&domain=example.org&created_after=2023-01-01T00:00:00Z&status=active&source=api&q=test&limit=1", adminToken)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Header().Get("Link"), "cursor="+tURL.ID)
+		body := struct {
+			URLs []struct {
+				ID         string `json:"id"`
+				Status     string `json:"status"`
+				OwnerEmail string `json:"owner_email"`
+				Clicks     int64  `json:"clicks"`
+				CreatedIP  string `json:"created_ip"`
+				Source     string `json:"source"`
+			} `json:"urls"`
+			NextCursor string `json:"next_cursor"`
+		}{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		require.Len(t, body.URLs, 1)
+		assert.Equal(t, tURL.ID, body.URLs[0].ID)
+		assert.Equal(t, domain.URLStatusActive, body.URLs[0].Status)
+		assert.Equal(t, "owner@example.com", body.URLs[0].OwnerEmail)
+		assert.EqualValues(t, 7, body.URLs[0].Clicks)
+		assert.Equal(t, "203.0.113.0", body.URLs[0].CreatedIP)
+		assert.Equal(t, domain.URLSourceAPI, body.URLs[0].Source)
+		assert.Equal(t, tURL.ID, body.NextCursor)
+	})
+
+	t.Run("validation errors", func(t *testing.T) {
+		rec := fetch("owner=nobody&domain=-bad-&status=deleted&source=email&limit=500", adminToken)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		re := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+		assert.Equal(t, "validation error", re.Error)
+		assert.Contains(t, re.Fields, "URLFilter.owner")
+		assert.Contains(t, re.Fields, "URLFilter.domain")
+		assert.Contains(t, re.Fields, "URLFilter.status")
+		assert.Contains(t, re.Fields, "URLFilter.source")
+		assert.Contains(t, re.Fields, "URLFilter.limit")
+	})
+
+	t.Run("invalid date", func(t *testing.T) {
+		rec := fetch("created_after=yesterday", adminToken)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		rec := fetch("", userToken)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestURLHTTPCreationInfo(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+
+	tURL := tests.NewURL()
+	tURL.Creation = domain.CreationInfo{IP: "203.0.113.57", UserAgent: "curl/8.0", Source: domain.URLSourceAPI}
+
+	cases := []struct {
+		description string
+		anonymize   bool
+		remoteAddr  string
+		forwarded   string
+		want        string
+	}{
+		{"ipv4", false, "203.0.113.57:4321", "", "203.0.113.57"},
+		{"ipv4 anonymized", true, "203.0.113.57:4321", "", "203.0.113.0"},
+		{"ipv6", false, "[2001:db8:1:2:3:4:5:6]:4321", "", "2001:db8:1:2:3:4:5:6"},
+		{"ipv6 anonymized", true, "[2001:db8:1:2:3:4:5:6]:4321", "", "2001:db8:1:2::"},
+		{"spoofed forwarded for", false, "203.0.113.57:4321", "198.51.100.7", "203.0.113.57"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			handler.SetCreatorIPAnonymization(tc.anonymize)
+			want := domain.CreateURL{Link: tURL.Link, Creation: domain.CreationInfo{IP: tc.want, UserAgent: "curl/8.0", Source: domain.URLSourceWeb}}
+			uc.EXPECT().Store(gomock.Any(), want).Return(tURL, nil)
+
+			req := httptest.NewRequest(echo.POST, "/v1/url/create", strings.NewReader(`{"link":"`+tURL.Link+`"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("User-Agent", "curl/8.0")
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tc.forwarded)
+				req.Header.Set(echo.HeaderXRealIP, tc.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusCreated, rec.Code)
+			assert.NotContains(t, rec.Body.String(), "created_ip")
+			assert.NotContains(t, rec.Body.String(), "curl")
+		})
+	}
+
+	ownerToken, err := authenticator.GenerateToken(auth.NewClaims(tURL.UserID, []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+	otherToken, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860eb", []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+
+	detailCases := []struct {
+		description string
+		token       string
+		shown       bool
+	}{
+		{"owner", ownerToken, true},
+		{"other user", otherToken, false},
+		{"anonymous", "", false},
+	}
+
+	for _, tc := range detailCases {
+		t.Run("detail of "+tc.description, func(t *testing.T) {
+			uc.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+			req := httptest.NewRequest(echo.GET, "/v1/url/"+tURL.ID, nil)
+			if tc.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			body := make(map[string]interface{})
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Equal(t, tURL.ID, body["id"])
+			if tc.shown {
+				assert.Equal(t, "203.0.113.57", body["created_ip"])
+				assert.Equal(t, "curl/8.0", body["created_user_agent"])
+				assert.Equal(t, domain.URLSourceAPI, body["source"])
+			} else {
+				assert.NotContains(t, body, "created_ip")
+				assert.NotContains(t, body, "created_user_agent")
+				assert.NotContains(t, body, "source")
+			}
+		})
+	}
+}
+
+func TestURLHTTPProofOfWork(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = myMiddl.StoreClaims
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, authenticator, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	challenges, err := pow.New(pow.Config{Difficulty: 8}, tests.NewMemoryLimitStore())
+	require.NoError(t, err)
+	handler.SetProofOfWork(challenges)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+
+	issue := func() pow.Challenge {
+		req := httptest.NewRequest(echo.GET, "/v1/url/challenge", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+		ch := pow.Challenge{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&ch))
+		return ch
+	}
+	create := func(challenge, nonce string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/url/create", strings.NewReader(`{"link":"https://www.example.org"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(pow.HeaderChallenge, challenge)
+		req.Header.Set(pow.HeaderNonce, nonce)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("solved", func(t *testing.T) {
+		ch := issue()
+		assert.Equal(t, 8, ch.Difficulty)
+		nonce := pow.Solve(ch)
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(tests.NewURL(), nil)
+
+		rec := create(ch.ID, nonce)
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		rec = create(ch.ID, nonce)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "challenge is single use")
+		assert.Contains(t, rec.Body.String(), domain.ErrCodeChallengeRequired)
+	})
+
+	t.Run("without challenge", func(t *testing.T) {
+		rec := create("", "")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), domain.ErrCodeChallengeRequired)
+	})
+
+	t.Run("authenticated user", func(t *testing.T) {
+		token, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Hour))
+		require.NoError(t, err)
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(tests.NewURL(), nil)
+
+		req := httptest.NewRequest(echo.POST, "/v1/user/url/create", strings.NewReader(`{"link":"https://www.example.org"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+}
+
+func TestURLHTTPRedirectMetrics(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	reader := sdkmetric.NewManualReader()
+	m, err := metrics.NewRedirectMetrics(metrics.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	handler.SetRedirectMetrics(m)
+
+	e := echo.New()
+	e.GET("/:id", handler.Redirect)
+
+	active := tests.NewURL()
+	expired := tests.NewURL()
+	expired.ID = "expired"
+	expired.ExpirationDate = time.Now().Add(-time.Minute)
+	flagged := tests.NewURL()
+	flagged.ID = "flagged"
+	flagged.Flag = &domain.URLFlag{Score: 10, At: time.Now()}
+
+	// serve returns URL or error as usecase does, marking observation the way
+	// cache and usecase do
+	serve := func(u *domain.URL, err error, cacheHit, disabled bool) func(context.Context, string, ...string) (*domain.URL, error) {
+		return func(ctx context.Context, _ string, _ ...string) (*domain.URL, error) {
+			o := domain.RedirectObservationFromContext(ctx)
+			require.NotNil(t, o)
+			o.CacheHit = cacheHit
+			o.Disabled = disabled
+			return u, err
+		}
+	}
+
+	uc.EXPECT().GetByID(gomock.Any(), active.ID).DoAndReturn(serve(active, nil, true, false))
+	uc.EXPECT().GetByID(gomock.Any(), "missing").DoAndReturn(serve(nil, domain.ErrNotFound, false, false))
+	uc.EXPECT().GetByID(gomock.Any(), "missingcached").DoAndReturn(serve(nil, domain.ErrNotFound, true, false))
+	uc.EXPECT().GetByID(gomock.Any(), expired.ID).DoAndReturn(serve(expired, nil, false, false))
+	uc.EXPECT().GetByID(gomock.Any(), "blocked").DoAndReturn(serve(nil, domain.ErrNotFound, false, true))
+	uc.EXPECT().GetByID(gomock.Any(), flagged.ID).DoAndReturn(serve(flagged, nil, false, false))
+	uc.EXPECT().GetByID(gomock.Any(), "failed").DoAndReturn(serve(nil, domain.ErrInternalServerError, false, false))
+
+	for _, id := range []string{active.ID, "missing", "missingcached", expired.ID, "blocked", flagged.ID, "failed", "te!t"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.GET, "/"+id, nil))
+	}
+
+	rm, err := reader.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+	metric := rm.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "redirect_duration_milliseconds", metric.Name)
+
+	counts := make(map[attribute.Set]uint64)
+	for _, dp := range metric.Data.(metricdata.Histogram).DataPoints {
+		counts[dp.Attributes] = dp.Count
+	}
+	labels := func(outcome string, cacheHit bool) attribute.Set {
+		return attribute.NewSet(attribute.String("outcome", outcome), attribute.Bool("cache_hit", cacheHit))
+	}
+	assert.Equal(t, map[attribute.Set]uint64{
+		labels(domain.RedirectHit, true):       1,
+		labels(domain.RedirectMiss, false):     1,
+		labels(domain.RedirectMiss, true):      1,
+		labels(domain.RedirectExpired, false):  1,
+		labels(domain.RedirectDisabled, false): 1,
+		labels(domain.RedirectFlagged, false):  1,
+		labels(domain.RedirectError, false):    1,
+		labels(domain.RedirectInvalid, false):  1,
+	}, counts)
+}
+
+func TestURLHTTPShortDomain(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler, err := urlHttp.NewURLHandler(uc, nil, nil, v, zap.NewNop(), sdktrace.NewTracerProvider().Tracer(""))
+	require.NoError(t, err)
+	links, err := domain.NewShortLinks("https://sho.rt/s/")
+	require.NoError(t, err)
+	handler.SetShortLinks(links)
+
+	e := echo.New()
+	e.Validator = v
+	e.POST("/v1/url/create", handler.Store)
+	tURL := tests.NewURL()
+	tURL.Domain = "go.example.com"
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/url/create", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("created on domain", func(t *testing.T) {
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, createURL domain.CreateURL) (*domain.URL, error) {
+			assert.Equal(t, tURL.Domain, createURL.Domain)
+			return tURL, nil
+		})
+
+		rec := create(`{"link":"` + tURL.Link + `","domain":"go.example.com"}`)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "https://go.example.com/"+tURL.ID, rec.Header().Get(echo.HeaderLocation))
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil, &domain.UnknownDomainError{Domain: "evil.example.net", Allowed: []string{"go.example.com"}})
+
+		rec := create(`{"link":"` + tURL.Link + `","domain":"evil.example.net"}`)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		body := new(domain.ResponseError)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(body))
+		assert.Equal(t, "domain must be one of go.example.com", body.Fields["domain"])
+	})
+}
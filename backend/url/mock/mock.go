@@ -7,6 +7,7 @@ package mock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	domain "github.com/semka95/shortener/backend/domain"
@@ -50,19 +51,69 @@ func (mr *MockURLUsecaseMockRecorder) Delete(ctx, id, user interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockURLUsecase)(nil).Delete), ctx, id, user)
 }
 
+// Fetch mocks base method.
+func (m *MockURLUsecase) Fetch(ctx context.Context, filter domain.URLFilter) (*domain.URLPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", ctx, filter)
+	ret0, _ := ret[0].(*domain.URLPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockURLUsecaseMockRecorder) Fetch(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockURLUsecase)(nil).Fetch), ctx, filter)
+}
+
 // GetByID mocks base method.
-func (m *MockURLUsecase) GetByID(ctx context.Context, id string) (*domain.URL, error) {
+func (m *MockURLUsecase) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	varargs := []interface{}{ctx, id}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetByID", varargs...)
 	ret0, _ := ret[0].(*domain.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetByID indicates an expected call of GetByID.
-func (mr *MockURLUsecaseMockRecorder) GetByID(ctx, id interface{}) *gomock.Call {
+func (mr *MockURLUsecaseMockRecorder) GetByID(ctx, id interface{}, fields ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockURLUsecase)(nil).GetByID), ctx, id)
+	varargs := append([]interface{}{ctx, id}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockURLUsecase)(nil).GetByID), varargs...)
+}
+
+// Lookup mocks base method.
+func (m *MockURLUsecase) Lookup(ctx context.Context, ids []string, user *auth.Claims) (*domain.URLLookup, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lookup", ctx, ids, user)
+	ret0, _ := ret[0].(*domain.URLLookup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lookup indicates an expected call of Lookup.
+func (mr *MockURLUsecaseMockRecorder) Lookup(ctx, ids, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lookup", reflect.TypeOf((*MockURLUsecase)(nil).Lookup), ctx, ids, user)
+}
+
+// Patch mocks base method.
+func (m *MockURLUsecase) Patch(ctx context.Context, patch domain.PatchURL, user *auth.Claims) (*domain.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Patch", ctx, patch, user)
+	ret0, _ := ret[0].(*domain.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Patch indicates an expected call of Patch.
+func (mr *MockURLUsecaseMockRecorder) Patch(ctx, patch, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Patch", reflect.TypeOf((*MockURLUsecase)(nil).Patch), ctx, patch, user)
 }
 
 // Store mocks base method.
@@ -117,33 +168,214 @@ func (m *MockURLRepository) EXPECT() *MockURLRepositoryMockRecorder {
 	return m.recorder
 }
 
+// BlockByPattern mocks base method.
+func (m *MockURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BlockByPattern", ctx, pattern, rule)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BlockByPattern indicates an expected call of BlockByPattern.
+func (mr *MockURLRepositoryMockRecorder) BlockByPattern(ctx, pattern, rule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BlockByPattern", reflect.TypeOf((*MockURLRepository)(nil).BlockByPattern), ctx, pattern, rule)
+}
+
+// ClaimExpired mocks base method.
+func (m *MockURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimExpired", ctx, id, now, claimedBefore)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimExpired indicates an expected call of ClaimExpired.
+func (mr *MockURLRepositoryMockRecorder) ClaimExpired(ctx, id, now, claimedBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimExpired", reflect.TypeOf((*MockURLRepository)(nil).ClaimExpired), ctx, id, now, claimedBefore)
+}
+
+// CountPurgeable mocks base method.
+func (m *MockURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPurgeable", ctx, filter)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountPurgeable indicates an expected call of CountPurgeable.
+func (mr *MockURLRepositoryMockRecorder) CountPurgeable(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPurgeable", reflect.TypeOf((*MockURLRepository)(nil).CountPurgeable), ctx, filter)
+}
+
 // Delete mocks base method.
-func (m *MockURLRepository) Delete(ctx context.Context, id string) error {
+func (m *MockURLRepository) Delete(ctx context.Context, id, ownerID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret := m.ctrl.Call(m, "Delete", ctx, id, ownerID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Delete indicates an expected call of Delete.
-func (mr *MockURLRepositoryMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) Delete(ctx, id, ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockURLRepository)(nil).Delete), ctx, id, ownerID)
+}
+
+// Fetch mocks base method.
+func (m *MockURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", ctx, filter)
+	ret0, _ := ret[0].([]*domain.AdminURL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockURLRepositoryMockRecorder) Fetch(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockURLRepository)(nil).Fetch), ctx, filter)
+}
+
+// FetchExpired mocks base method.
+func (m *MockURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchExpired", ctx, now, claimedBefore, limit)
+	ret0, _ := ret[0].([]*domain.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchExpired indicates an expected call of FetchExpired.
+func (mr *MockURLRepositoryMockRecorder) FetchExpired(ctx, now, claimedBefore, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockURLRepository)(nil).Delete), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchExpired", reflect.TypeOf((*MockURLRepository)(nil).FetchExpired), ctx, now, claimedBefore, limit)
 }
 
 // GetByID mocks base method.
-func (m *MockURLRepository) GetByID(ctx context.Context, id string) (*domain.URL, error) {
+func (m *MockURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetByID", ctx, id)
+	varargs := []interface{}{ctx, id}
+	for _, a := range fields {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetByID", varargs...)
 	ret0, _ := ret[0].(*domain.URL)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetByID indicates an expected call of GetByID.
-func (mr *MockURLRepositoryMockRecorder) GetByID(ctx, id interface{}) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) GetByID(ctx, id interface{}, fields ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockURLRepository)(nil).GetByID), ctx, id)
+	varargs := append([]interface{}{ctx, id}, fields...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockURLRepository)(nil).GetByID), varargs...)
+}
+
+// GetByIDs mocks base method.
+func (m *MockURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByIDs", ctx, ids)
+	ret0, _ := ret[0].([]*domain.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByIDs indicates an expected call of GetByIDs.
+func (mr *MockURLRepositoryMockRecorder) GetByIDs(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByIDs", reflect.TypeOf((*MockURLRepository)(nil).GetByIDs), ctx, ids)
+}
+
+// MarkExpiredNotified mocks base method.
+func (m *MockURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkExpiredNotified", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkExpiredNotified indicates an expected call of MarkExpiredNotified.
+func (mr *MockURLRepositoryMockRecorder) MarkExpiredNotified(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkExpiredNotified", reflect.TypeOf((*MockURLRepository)(nil).MarkExpiredNotified), ctx, id)
+}
+
+// Ping mocks base method.
+func (m *MockURLRepository) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockURLRepositoryMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockURLRepository)(nil).Ping), ctx)
+}
+
+// PurgeBatch mocks base method.
+func (m *MockURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeBatch", ctx, filter, limit)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeBatch indicates an expected call of PurgeBatch.
+func (mr *MockURLRepositoryMockRecorder) PurgeBatch(ctx, filter, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeBatch", reflect.TypeOf((*MockURLRepository)(nil).PurgeBatch), ctx, filter, limit)
+}
+
+// ReleaseExpired mocks base method.
+func (m *MockURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseExpired", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseExpired indicates an expected call of ReleaseExpired.
+func (mr *MockURLRepositoryMockRecorder) ReleaseExpired(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseExpired", reflect.TypeOf((*MockURLRepository)(nil).ReleaseExpired), ctx, id)
+}
+
+// ScanIDs mocks base method.
+func (m *MockURLRepository) ScanIDs(ctx context.Context, fn func(string) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanIDs", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ScanIDs indicates an expected call of ScanIDs.
+func (mr *MockURLRepositoryMockRecorder) ScanIDs(ctx, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanIDs", reflect.TypeOf((*MockURLRepository)(nil).ScanIDs), ctx, fn)
+}
+
+// Stats mocks base method.
+func (m *MockURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats", ctx)
+	ret0, _ := ret[0].(*domain.RepositoryStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockURLRepositoryMockRecorder) Stats(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockURLRepository)(nil).Stats), ctx)
 }
 
 // Store mocks base method.
@@ -161,15 +393,29 @@ func (mr *MockURLRepositoryMockRecorder) Store(ctx, u interface{}) *gomock.Call
 }
 
 // Update mocks base method.
-func (m *MockURLRepository) Update(ctx context.Context, url *domain.URL) error {
+func (m *MockURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Update", ctx, url)
+	ret := m.ctrl.Call(m, "Update", ctx, url, ownerID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Update indicates an expected call of Update.
-func (mr *MockURLRepositoryMockRecorder) Update(ctx, url interface{}) *gomock.Call {
+func (mr *MockURLRepositoryMockRecorder) Update(ctx, url, ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockURLRepository)(nil).Update), ctx, url, ownerID)
+}
+
+// UpdateIfUnchanged mocks base method.
+func (m *MockURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateIfUnchanged", ctx, url, updatedAt, ownerID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateIfUnchanged indicates an expected call of UpdateIfUnchanged.
+func (mr *MockURLRepositoryMockRecorder) UpdateIfUnchanged(ctx, url, updatedAt, ownerID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockURLRepository)(nil).Update), ctx, url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateIfUnchanged", reflect.TypeOf((*MockURLRepository)(nil).UpdateIfUnchanged), ctx, url, updatedAt, ownerID)
 }
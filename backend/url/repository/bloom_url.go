@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type bloomURLRepository struct {
+	next   domain.URLRepository
+	filter *store.ExistenceFilter
+}
+
+// NewBloomURLRepository wraps repository with existence filter of URL ids, so
+// ids that were never stored are not looked up in backend
+func NewBloomURLRepository(next domain.URLRepository, filter *store.ExistenceFilter) domain.URLRepository {
+	return &bloomURLRepository{
+		next:   next,
+		filter: filter,
+	}
+}
+
+func (r *bloomURLRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+func (r *bloomURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	return r.next.Stats(ctx)
+}
+
+func (r *bloomURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	if !r.filter.MayExist(id) {
+		return nil, domain.NotFoundError(domain.EntityURL, id, "URL was not found")
+	}
+	return r.next.GetByID(ctx, id, fields...)
+}
+
+func (r *bloomURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	return r.next.GetByIDs(ctx, ids)
+}
+
+func (r *bloomURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	return r.next.Update(ctx, url, ownerID)
+}
+
+func (r *bloomURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	return r.next.UpdateIfUnchanged(ctx, url, updatedAt, ownerID)
+}
+
+// Store adds id to the filter before URL is stored, so it is never reported
+// missing once stored
+func (r *bloomURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	r.filter.Add(url.ID)
+	return r.next.Store(ctx, url)
+}
+
+func (r *bloomURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	return r.next.Delete(ctx, id, ownerID)
+}
+
+func (r *bloomURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	return r.next.BlockByPattern(ctx, pattern, rule)
+}
+
+func (r *bloomURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	return r.next.Fetch(ctx, filter)
+}
+
+func (r *bloomURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	return r.next.CountPurgeable(ctx, filter)
+}
+
+func (r *bloomURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	return r.next.PurgeBatch(ctx, filter, limit)
+}
+
+func (r *bloomURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	return r.next.ScanIDs(ctx, fn)
+}
+
+func (r *bloomURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	return r.next.FetchExpired(ctx, now, claimedBefore, limit)
+}
+
+func (r *bloomURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	return r.next.ClaimExpired(ctx, id, now, claimedBefore)
+}
+
+func (r *bloomURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	return r.next.MarkExpiredNotified(ctx, id)
+}
+
+func (r *bloomURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	return r.next.ReleaseExpired(ctx, id)
+}
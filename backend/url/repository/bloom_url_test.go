@@ -0,0 +1,74 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestBloomURLRepository_GetByID(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+
+	filter := store.NewExistenceFilter("url", 100, 0.01)
+	r := repository.NewBloomURLRepository(next, filter)
+
+	// ids are looked up in backend until filter is loaded
+	next.EXPECT().GetByID(gomock.Any(), "missing").Return(nil, domain.ErrNotFound)
+	_, err := r.GetByID(noopCtx, "missing")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	err = filter.Rebuild(noopCtx, func(_ context.Context, fn func(string) error) error {
+		return fn(tURL.ID)
+	})
+	require.NoError(t, err)
+
+	next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+	u, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL, u)
+
+	// backend is skipped for missing id
+	u, err = r.GetByID(noopCtx, "missing")
+	assert.Nil(t, u)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.EqualValues(t, 1, filter.Skips())
+}
+
+func TestBloomURLRepository_StoredIDsExist(t *testing.T) {
+	backend := tests.NewMemoryURLRepository()
+	filter := store.NewExistenceFilter("url", 10, 0.01)
+	r := repository.NewBloomURLRepository(backend, filter)
+
+	for i := 0; i < 50; i++ {
+		u := tests.NewURL()
+		u.ID = fmt.Sprintf("stored%d", i)
+		require.NoError(t, r.Store(noopCtx, u))
+		if i == 25 {
+			require.NoError(t, filter.Rebuild(noopCtx, r.ScanIDs))
+		}
+	}
+	require.NoError(t, r.Delete(noopCtx, "stored0", domain.AnyOwner))
+	require.NoError(t, filter.Rebuild(noopCtx, r.ScanIDs))
+
+	// every stored id must pass even when filter holds more ids than it was
+	// sized for
+	for i := 1; i < 50; i++ {
+		_, err := r.GetByID(noopCtx, fmt.Sprintf("stored%d", i))
+		require.NoError(t, err)
+	}
+	_, err := r.GetByID(noopCtx, "stored0")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type breakerURLRepository struct {
+	next domain.URLRepository
+	cb   *store.CircuitBreaker
+}
+
+// NewBreakerURLRepository wraps repository with circuit breaker, so calls fail
+// fast while backend is unhealthy
+func NewBreakerURLRepository(next domain.URLRepository, cb *store.CircuitBreaker) domain.URLRepository {
+	return &breakerURLRepository{
+		next: next,
+		cb:   cb,
+	}
+}
+
+// Ping goes through the breaker, so health check fails fast while it is open
+// and probes backend when it is half-open
+func (r *breakerURLRepository) Ping(ctx context.Context) error {
+	return r.cb.Do(func() error {
+		return r.next.Ping(ctx)
+	})
+}
+
+func (r *breakerURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	var stats *domain.RepositoryStats
+	err := r.cb.Do(func() (err error) {
+		stats, err = r.next.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+func (r *breakerURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	var u *domain.URL
+	err := r.cb.Do(func() (err error) {
+		u, err = r.next.GetByID(ctx, id, fields...)
+		return err
+	})
+	return u, err
+}
+
+func (r *breakerURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	var urls []*domain.URL
+	err := r.cb.Do(func() (err error) {
+		urls, err = r.next.GetByIDs(ctx, ids)
+		return err
+	})
+	return urls, err
+}
+
+func (r *breakerURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	return r.cb.Do(func() error {
+		return r.next.Update(ctx, url, ownerID)
+	})
+}
+
+func (r *breakerURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	return r.cb.Do(func() error {
+		return r.next.UpdateIfUnchanged(ctx, url, updatedAt, ownerID)
+	})
+}
+
+func (r *breakerURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	return r.cb.Do(func() error {
+		return r.next.Store(ctx, url)
+	})
+}
+
+func (r *breakerURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	return r.cb.Do(func() error {
+		return r.next.Delete(ctx, id, ownerID)
+	})
+}
+
+func (r *breakerURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	var ids []string
+	err := r.cb.Do(func() (err error) {
+		ids, err = r.next.BlockByPattern(ctx, pattern, rule)
+		return err
+	})
+	return ids, err
+}
+
+func (r *breakerURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	var urls []*domain.AdminURL
+	err := r.cb.Do(func() (err error) {
+		urls, err = r.next.Fetch(ctx, filter)
+		return err
+	})
+	return urls, err
+}
+
+func (r *breakerURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	var n int64
+	err := r.cb.Do(func() (err error) {
+		n, err = r.next.CountPurgeable(ctx, filter)
+		return err
+	})
+	return n, err
+}
+
+func (r *breakerURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	var n int64
+	err := r.cb.Do(func() (err error) {
+		n, err = r.next.PurgeBatch(ctx, filter, limit)
+		return err
+	})
+	return n, err
+}
+
+func (r *breakerURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	return r.cb.Do(func() error {
+		return r.next.ScanIDs(ctx, fn)
+	})
+}
+
+func (r *breakerURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	var urls []*domain.URL
+	err := r.cb.Do(func() (err error) {
+		urls, err = r.next.FetchExpired(ctx, now, claimedBefore, limit)
+		return err
+	})
+	return urls, err
+}
+
+func (r *breakerURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	var ok bool
+	err := r.cb.Do(func() (err error) {
+		ok, err = r.next.ClaimExpired(ctx, id, now, claimedBefore)
+		return err
+	})
+	return ok, err
+}
+
+func (r *breakerURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	return r.cb.Do(func() error {
+		return r.next.MarkExpiredNotified(ctx, id)
+	})
+}
+
+func (r *breakerURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	return r.cb.Do(func() error {
+		return r.next.ReleaseExpired(ctx, id)
+	})
+}
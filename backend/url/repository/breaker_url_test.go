@@ -0,0 +1,55 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestBreakerURLRepository(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+	errBackend := errors.New("server selection timeout")
+
+	now := time.Now()
+	cb := store.NewCircuitBreaker("url", 2, time.Minute, zap.NewNop())
+	cb.SetClock(func() time.Time { return now })
+	r := repository.NewBreakerURLRepository(next, cb)
+
+	gomock.InOrder(
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(nil, errBackend),
+		next.EXPECT().Store(gomock.Any(), tURL).Return(errBackend),
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil),
+	)
+
+	_, err := r.GetByID(noopCtx, tURL.ID)
+	assert.ErrorIs(t, err, errBackend)
+	err = r.Store(noopCtx, tURL)
+	assert.ErrorIs(t, err, errBackend)
+
+	// breaker is open, repository is not called
+	u, err := r.GetByID(noopCtx, tURL.ID)
+	assert.Nil(t, u)
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+	assert.ErrorIs(t, r.Update(noopCtx, tURL, domain.AnyOwner), domain.ErrUnavailable)
+	assert.ErrorIs(t, r.Delete(noopCtx, tURL.ID, domain.AnyOwner), domain.ErrUnavailable)
+
+	now = now.Add(time.Minute)
+	u, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL, u)
+	assert.Equal(t, store.BreakerClosed, cb.State())
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type cachedURLRepository struct {
+	next  domain.URLRepository
+	cache *store.Cache
+}
+
+// NewCachedURLRepository wraps repository with cache of URLs found and not
+// found by GetByID, so redirects and scans of unused ids don't reach backend
+// every time. URLs expired from cache are served while backend is
+// unavailable.
+func NewCachedURLRepository(next domain.URLRepository, cache *store.Cache) domain.URLRepository {
+	return &cachedURLRepository{
+		next:  next,
+		cache: cache,
+	}
+}
+
+// GetByID skips the cache for reads made before URL is changed, so cached
+// URL read from lagging secondary isn't acted on
+func (r *cachedURLRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+func (r *cachedURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	return r.next.Stats(ctx)
+}
+
+func (r *cachedURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	if domain.ReadClassFromContext(ctx) == domain.ReadForUpdate {
+		return r.next.GetByID(ctx, id, fields...)
+	}
+
+	v, result := r.cache.Get(id)
+	if o := domain.RedirectObservationFromContext(ctx); o != nil {
+		o.CacheHit = result == store.CacheHit || result == store.CacheNegativeHit
+	}
+	switch result {
+	case store.CacheHit:
+		u := *v.(*domain.URL)
+		return &u, nil
+	case store.CacheNegativeHit:
+		return nil, domain.NotFoundError(domain.EntityURL, id, "URL was not found")
+	}
+
+	gen := r.cache.Generation()
+	u, err := r.next.GetByID(ctx, id, fields...)
+	switch {
+	case errors.Is(err, domain.ErrUnavailable):
+		// redirects survive database outage for URLs resolved recently
+		if v, ok := r.cache.GetStale(id); ok {
+			if o := domain.RedirectObservationFromContext(ctx); o != nil {
+				o.CacheHit = true
+			}
+			u := *v.(*domain.URL)
+			return &u, nil
+		}
+	case errors.Is(err, domain.ErrNotFound):
+		r.cache.SetMissing(id, gen)
+	case err == nil && len(fields) == 0:
+		// cached URL is copied, so callers can't change it
+		cached := *u
+		r.cache.Set(id, &cached, gen)
+	}
+
+	return u, err
+}
+
+func (r *cachedURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	return r.next.GetByIDs(ctx, ids)
+}
+
+func (r *cachedURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	defer r.cache.Delete(url.ID)
+	return r.next.Update(ctx, url, ownerID)
+}
+
+func (r *cachedURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	defer r.cache.Delete(url.ID)
+	return r.next.UpdateIfUnchanged(ctx, url, updatedAt, ownerID)
+}
+
+// Store drops cached miss of the id, so new URL is found right away
+func (r *cachedURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	defer r.cache.Delete(url.ID)
+	return r.next.Store(ctx, url)
+}
+
+func (r *cachedURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	defer r.cache.Delete(id)
+	return r.next.Delete(ctx, id, ownerID)
+}
+
+func (r *cachedURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	ids, err := r.next.BlockByPattern(ctx, pattern, rule)
+	r.cache.Delete(ids...)
+	return ids, err
+}
+
+func (r *cachedURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	return r.next.Fetch(ctx, filter)
+}
+
+func (r *cachedURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	return r.next.CountPurgeable(ctx, filter)
+}
+
+// PurgeBatch clears the whole cache as ids of deleted URLs are not known
+func (r *cachedURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	n, err := r.next.PurgeBatch(ctx, filter, limit)
+	if n > 0 {
+		r.cache.Clear()
+	}
+	return n, err
+}
+
+func (r *cachedURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	return r.next.ScanIDs(ctx, fn)
+}
+
+func (r *cachedURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	return r.next.FetchExpired(ctx, now, claimedBefore, limit)
+}
+
+func (r *cachedURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	return r.next.ClaimExpired(ctx, id, now, claimedBefore)
+}
+
+// MarkExpiredNotified drops cached URL, so redirects don't notify it again
+func (r *cachedURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	defer r.cache.Delete(id)
+	return r.next.MarkExpiredNotified(ctx, id)
+}
+
+func (r *cachedURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	return r.next.ReleaseExpired(ctx, id)
+}
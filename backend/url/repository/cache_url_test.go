@@ -0,0 +1,206 @@
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestCachedURLRepository_GetByID(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+
+	cache := store.NewCache("url", time.Minute, time.Minute, 10)
+	r := repository.NewCachedURLRepository(next, cache)
+
+	// each id reaches backend once, partial URL is not cached
+	gomock.InOrder(
+		next.EXPECT().GetByID(gomock.Any(), "missing").Return(nil, domain.ErrNotFound),
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID, "link").Return(&domain.URL{ID: tURL.ID, Link: tURL.Link}, nil),
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil),
+	)
+
+	for i := 0; i < 2; i++ {
+		u, err := r.GetByID(noopCtx, "missing")
+		assert.Nil(t, u)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	}
+
+	u, err := r.GetByID(noopCtx, tURL.ID, "link")
+	require.NoError(t, err)
+	assert.Empty(t, u.UserID)
+
+	for i := 0; i < 2; i++ {
+		u, err = r.GetByID(noopCtx, tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL, u)
+	}
+
+	// changes of returned URL don't reach the cache
+	u.Link = "https://example.org"
+	u, err = r.GetByID(noopCtx, tURL.ID, "link")
+	require.NoError(t, err)
+	assert.Equal(t, tURL.Link, u.Link)
+
+	assert.EqualValues(t, 3, cache.Lookups(store.CacheMiss))
+	assert.EqualValues(t, 2, cache.Lookups(store.CacheHit))
+	assert.EqualValues(t, 1, cache.Lookups(store.CacheNegativeHit))
+}
+
+func TestCachedURLRepository_StoreAfterMiss(t *testing.T) {
+	tURL := tests.NewURL()
+	cache := store.NewCache("url", time.Minute, time.Minute, 10)
+	r := repository.NewCachedURLRepository(tests.NewMemoryURLRepository(), cache)
+
+	_, err := r.GetByID(noopCtx, tURL.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = r.GetByID(noopCtx, tURL.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.EqualValues(t, 1, cache.Lookups(store.CacheNegativeHit))
+
+	err = r.Store(noopCtx, tURL)
+	require.NoError(t, err)
+
+	u, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL.Link, u.Link)
+}
+
+func TestCachedURLRepository_ReadForUpdate(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+
+	cache := store.NewCache("url", time.Minute, time.Minute, 10)
+	r := repository.NewCachedURLRepository(next, cache)
+
+	// reads before update reach backend although URL is cached
+	next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil).Times(3)
+
+	_, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		u, err := r.GetByID(domain.WithReadClass(noopCtx, domain.ReadForUpdate), tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL, u)
+	}
+
+	assert.EqualValues(t, 1, cache.Lookups(store.CacheMiss))
+	assert.EqualValues(t, 0, cache.Lookups(store.CacheHit))
+}
+
+func TestCachedURLRepository_Invalidate(t *testing.T) {
+	tURL := tests.NewURL()
+	cache := store.NewCache("url", time.Minute, time.Minute, 10)
+	r := repository.NewCachedURLRepository(tests.NewMemoryURLRepository(), cache)
+
+	err := r.Store(noopCtx, tURL)
+	require.NoError(t, err)
+	_, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+
+	updated := *tURL
+	updated.ExpirationDate = tURL.ExpirationDate.Add(time.Hour)
+	err = r.Update(noopCtx, &updated, domain.AnyOwner)
+	require.NoError(t, err)
+	u, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, updated.ExpirationDate, u.ExpirationDate)
+
+	patched := updated
+	patched.Link = "https://example.com/patched"
+	patched.UpdatedAt = updated.UpdatedAt.Add(time.Millisecond)
+	err = r.UpdateIfUnchanged(noopCtx, &patched, updated.UpdatedAt, domain.AnyOwner)
+	require.NoError(t, err)
+	u, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, patched.Link, u.Link)
+
+	ids, err := r.BlockByPattern(noopCtx, ".*", "rule")
+	require.NoError(t, err)
+	assert.Equal(t, []string{tURL.ID}, ids)
+	u, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "rule", u.BlockedBy)
+
+	err = r.Delete(noopCtx, tURL.ID, domain.AnyOwner)
+	require.NoError(t, err)
+	_, err = r.GetByID(noopCtx, tURL.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestCachedURLRepository_RedirectObservation(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+
+	r := repository.NewCachedURLRepository(next, store.NewCache("url", time.Minute, time.Minute, 10))
+	next.EXPECT().GetByID(gomock.Any(), "missing").Return(nil, domain.ErrNotFound)
+	next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+	// cached misses are cache hits too
+	for _, id := range []string{"missing", tURL.ID} {
+		observation := &domain.RedirectObservation{}
+		_, _ = r.GetByID(domain.WithRedirectObservation(noopCtx, observation), id)
+		assert.False(t, observation.CacheHit, id)
+
+		_, _ = r.GetByID(domain.WithRedirectObservation(noopCtx, observation), id)
+		assert.True(t, observation.CacheHit, id)
+	}
+}
+
+func TestCachedURLRepository_Unavailable(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := store.NewCache("url", time.Minute, time.Minute, 10)
+	cache.SetClock(func() time.Time { return now })
+	cache.SetStaleTTL(time.Hour)
+	r := repository.NewCachedURLRepository(next, cache)
+	unavailable := fmt.Errorf("url circuit breaker is open: %w", domain.ErrUnavailable)
+	errBackend := errors.New("server selection timeout")
+
+	gomock.InOrder(
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil),
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(nil, unavailable),
+		next.EXPECT().GetByID(gomock.Any(), "uncached").Return(nil, unavailable),
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(nil, errBackend),
+	)
+
+	_, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+
+	// expired URL is served while backend is unavailable
+	observation := &domain.RedirectObservation{}
+	u, err := r.GetByID(domain.WithRedirectObservation(noopCtx, observation), tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL, u)
+	assert.True(t, observation.CacheHit)
+	assert.EqualValues(t, 1, cache.Lookups(store.CacheStaleHit))
+
+	_, err = r.GetByID(noopCtx, "uncached")
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+
+	// other backend errors are not covered by stale URLs
+	_, err = r.GetByID(noopCtx, tURL.ID)
+	assert.ErrorIs(t, err, errBackend)
+}
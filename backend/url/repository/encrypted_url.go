@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+// scanBatchSize is the number of URLs read at once when URLs are matched by
+// destination after decryption
+const scanBatchSize = 100
+
+type encryptedURLRepository struct {
+	next   domain.URLRepository
+	cipher *store.Cipher
+}
+
+// NewEncryptedURLRepository wraps repository with encryption of URL links,
+// links are encrypted before they are written and decrypted after they are
+// read, other fields stay queryable. Database can't match encrypted links,
+// so blocking and searching by destination scan URLs and match decrypted
+// links instead, which is as slow as the number of scanned URLs.
+func NewEncryptedURLRepository(next domain.URLRepository, cipher *store.Cipher) domain.URLRepository {
+	return &encryptedURLRepository{
+		next:   next,
+		cipher: cipher,
+	}
+}
+
+func (r *encryptedURLRepository) encrypt(ctx context.Context, url *domain.URL) (*domain.URL, error) {
+	link, err := r.cipher.Encrypt(ctx, url.ID, url.Link)
+	if err != nil {
+		return nil, domain.InternalError(fmt.Sprintf("can't encrypt link of URL %s", url.ID), err)
+	}
+	encrypted := *url
+	encrypted.Link = link
+
+	return &encrypted, nil
+}
+
+func (r *encryptedURLRepository) decrypt(ctx context.Context, url *domain.URL) error {
+	link, err := r.cipher.Decrypt(ctx, url.ID, url.Link)
+	if err != nil {
+		return domain.InternalError(fmt.Sprintf("can't decrypt link of URL %s", url.ID), err)
+	}
+	url.Link = link
+
+	return nil
+}
+
+func (r *encryptedURLRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+func (r *encryptedURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	return r.next.Stats(ctx)
+}
+
+func (r *encryptedURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	url, err := r.next.GetByID(ctx, id, fields...)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.decrypt(ctx, url); err != nil {
+		return nil, err
+	}
+
+	return url, nil
+}
+
+func (r *encryptedURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	urls, err := r.next.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range urls {
+		if err = r.decrypt(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+
+	return urls, nil
+}
+
+func (r *encryptedURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	encrypted, err := r.encrypt(ctx, url)
+	if err != nil {
+		return err
+	}
+	return r.next.Update(ctx, encrypted, ownerID)
+}
+
+func (r *encryptedURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	encrypted, err := r.encrypt(ctx, url)
+	if err != nil {
+		return err
+	}
+	return r.next.UpdateIfUnchanged(ctx, encrypted, updatedAt, ownerID)
+}
+
+func (r *encryptedURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	encrypted, err := r.encrypt(ctx, url)
+	if err != nil {
+		return err
+	}
+	return r.next.Store(ctx, encrypted)
+}
+
+func (r *encryptedURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	return r.next.Delete(ctx, id, ownerID)
+}
+
+// BlockByPattern scans all URLs, stored links are written back untouched
+func (r *encryptedURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, domain.NewError(domain.ErrBadParamInput, "invalid pattern").Wrap(err)
+	}
+
+	var ids []string
+	err = scanURLs(ctx, r.next, scanBatchSize, func(urls []*domain.URL) error {
+		for _, u := range urls {
+			if u.BlockedBy != "" {
+				continue
+			}
+			link, err := r.cipher.Decrypt(ctx, u.ID, u.Link)
+			if err != nil {
+				return domain.InternalError(fmt.Sprintf("can't decrypt link of URL %s", u.ID), err)
+			}
+			if !re.MatchString(link) {
+				continue
+			}
+
+			u.BlockedBy = rule
+			err = r.next.Update(ctx, u, domain.AnyOwner)
+			if errors.Is(err, domain.ErrNoAffected) {
+				// deleted meanwhile
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			ids = append(ids, u.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Fetch matches URLs by destination after decryption, database is asked for
+// URLs matching the rest of the filter page by page until the page is filled
+func (r *encryptedURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	if filter.Domain == "" && filter.Q == "" {
+		urls, err := r.next.Fetch(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range urls {
+			if err = r.decrypt(ctx, &u.URL); err != nil {
+				return nil, err
+			}
+		}
+		return urls, nil
+	}
+
+	domainRe, err := regexp.Compile("(?i)" + filter.DomainPattern())
+	if err != nil {
+		return nil, domain.NewError(domain.ErrBadParamInput, "invalid domain").Wrap(err)
+	}
+	q := strings.ToLower(filter.Q)
+
+	scan := filter
+	scan.Domain = ""
+	scan.Q = ""
+	scan.Limit = scanBatchSize
+	result := make([]*domain.AdminURL, 0)
+	for {
+		urls, err := r.next.Fetch(ctx, scan)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range urls {
+			if err = r.decrypt(ctx, &u.URL); err != nil {
+				return nil, err
+			}
+			switch {
+			case filter.Domain != "" && !domainRe.MatchString(u.Link),
+				q != "" && !strings.Contains(strings.ToLower(u.ID), q) && !strings.Contains(strings.ToLower(u.Link), q):
+				continue
+			}
+			result = append(result, u)
+			if filter.Limit > 0 && int64(len(result)) == filter.Limit {
+				return result, nil
+			}
+		}
+
+		if int64(len(urls)) < scan.Limit {
+			return result, nil
+		}
+		scan.Cursor = urls[len(urls)-1].ID
+	}
+}
+
+func (r *encryptedURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	return r.next.CountPurgeable(ctx, filter)
+}
+
+func (r *encryptedURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	return r.next.PurgeBatch(ctx, filter, limit)
+}
+
+func (r *encryptedURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	return r.next.ScanIDs(ctx, fn)
+}
+
+func (r *encryptedURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	urls, err := r.next.FetchExpired(ctx, now, claimedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range urls {
+		if err = r.decrypt(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+
+	return urls, nil
+}
+
+func (r *encryptedURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	return r.next.ClaimExpired(ctx, id, now, claimedBefore)
+}
+
+func (r *encryptedURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	return r.next.MarkExpiredNotified(ctx, id)
+}
+
+func (r *encryptedURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	return r.next.ReleaseExpired(ctx, id)
+}
+
+// scanURLs calls fn with batches of up to size URLs until all URLs stored
+// when scan started are passed, URLs deleted meanwhile are skipped
+func scanURLs(ctx context.Context, repo domain.URLRepository, size int, fn func(urls []*domain.URL) error) error {
+	ids := make([]string, 0, size)
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		urls, err := repo.GetByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+		ids = ids[:0]
+		return fn(urls)
+	}
+
+	err := repo.ScanIDs(ctx, func(id string) error {
+		ids = append(ids, id)
+		if len(ids) < size {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// ReencryptLinks encrypts links of URLs stored in repo with current key of
+// cipher, links encrypted with other keys are rotated and plain links are
+// encrypted. Repo must not encrypt links itself. URLs are read in batches and
+// written back only if they were not updated meanwhile, URLs updated
+// meanwhile were encrypted with current key already, so rotation can run
+// alongside the service and is resumed by running it again. It returns
+// number of rewritten URLs.
+func ReencryptLinks(ctx context.Context, repo domain.URLRepository, cipher *store.Cipher, batchSize int, logger *zap.Logger) (int64, error) {
+	current, err := cipher.CurrentVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("can't get current encryption key: %w", err)
+	}
+
+	var rotated, skipped int64
+	err = scanURLs(ctx, repo, batchSize, func(urls []*domain.URL) error {
+		for _, u := range urls {
+			if version, ok := store.KeyVersion(u.Link); u.Link == "" || ok && version == current {
+				continue
+			}
+
+			link, err := cipher.Decrypt(ctx, u.ID, u.Link)
+			if err != nil {
+				return fmt.Errorf("can't decrypt link of URL %s: %w", u.ID, err)
+			}
+			if u.Link, err = cipher.Encrypt(ctx, u.ID, link); err != nil {
+				return fmt.Errorf("can't encrypt link of URL %s: %w", u.ID, err)
+			}
+
+			err = repo.UpdateIfUnchanged(ctx, u, u.UpdatedAt, domain.AnyOwner)
+			if errors.Is(err, domain.ErrConflict) || errors.Is(err, domain.ErrNotFound) {
+				skipped++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			rotated++
+		}
+
+		logger.Info("re-encrypted batch of URLs", zap.Int64("rotated", rotated), zap.Int64("skipped", skipped))
+		return nil
+	})
+
+	return rotated, err
+}
@@ -0,0 +1,170 @@
+package repository_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func newTestCipher(t *testing.T, current string, versions ...string) *store.Cipher {
+	cfg := store.EncryptionConfig{CurrentKey: current, Keys: make(map[string]string)}
+	for i, v := range versions {
+		cfg.Keys[v] = base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune('a'+i)), store.KeySize)))
+	}
+	p, err := store.NewStaticKeyProvider(cfg)
+	require.NoError(t, err)
+	return store.NewCipher(p)
+}
+
+func TestEncryptedURLRepository(t *testing.T) {
+	next := tests.NewMemoryURLRepository()
+	r := repository.NewEncryptedURLRepository(next, newTestCipher(t, "v1", "v1"))
+	tURL := tests.NewURL()
+
+	require.NoError(t, r.Store(noopCtx, tURL))
+	assert.Equal(t, "http://www.example.org", tURL.Link, "stored URL must not be changed")
+
+	stored, err := next.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.True(t, store.IsEncrypted(stored.Link))
+	assert.Equal(t, tURL.UserID, stored.UserID)
+
+	u, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL, u)
+
+	tURL.Link = "http://www.example.com"
+	require.NoError(t, r.UpdateIfUnchanged(noopCtx, tURL, tURL.UpdatedAt, domain.AnyOwner))
+	urls, err := r.GetByIDs(noopCtx, []string{tURL.ID})
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "http://www.example.com", urls[0].Link)
+
+	page, err := r.Fetch(noopCtx, domain.URLFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "http://www.example.com", page[0].Link)
+
+	t.Run("plain link stored before encryption", func(t *testing.T) {
+		plain := tests.NewURL()
+		plain.ID = "plain12"
+		require.NoError(t, next.Store(noopCtx, plain))
+
+		u, err := r.GetByID(noopCtx, plain.ID)
+		require.NoError(t, err)
+		assert.Equal(t, plain.Link, u.Link)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		other := repository.NewEncryptedURLRepository(next, newTestCipher(t, "v2", "v2"))
+		_, err := other.GetByID(noopCtx, tURL.ID)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestEncryptedURLRepository_SearchByDestination(t *testing.T) {
+	next := tests.NewMemoryURLRepository()
+	r := repository.NewEncryptedURLRepository(next, newTestCipher(t, "v1", "v1"))
+
+	// more URLs than scanned at once
+	for i := 0; i < 250; i++ {
+		u := tests.NewURL()
+		u.ID = fmt.Sprintf("url%04d", i)
+		u.Link = fmt.Sprintf("https://other.org/%d", i)
+		if i%50 == 0 {
+			u.Link = fmt.Sprintf("https://docs.Example.com/%d", i)
+		}
+		require.NoError(t, r.Store(noopCtx, u))
+	}
+
+	t.Run("domain", func(t *testing.T) {
+		page, err := r.Fetch(noopCtx, domain.URLFilter{Domain: "example.com", Limit: 3})
+		require.NoError(t, err)
+		require.Len(t, page, 3)
+		assert.Equal(t, "url0000", page[0].ID)
+		assert.Equal(t, "url0100", page[2].ID)
+		assert.Equal(t, "https://docs.Example.com/100", page[2].Link)
+
+		page, err = r.Fetch(noopCtx, domain.URLFilter{Domain: "example.com", Limit: 3, Cursor: page[2].ID})
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, "url0150", page[0].ID)
+		assert.Equal(t, "url0200", page[1].ID)
+	})
+
+	t.Run("q matches id and link", func(t *testing.T) {
+		page, err := r.Fetch(noopCtx, domain.URLFilter{Q: "/249", Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, "url0249", page[0].ID)
+
+		page, err = r.Fetch(noopCtx, domain.URLFilter{Q: "URL024", Limit: 100})
+		require.NoError(t, err)
+		assert.Len(t, page, 10)
+	})
+
+	t.Run("block by pattern", func(t *testing.T) {
+		rule := domain.BlockedDomain{Domain: "*.example.com"}
+		ids, err := r.BlockByPattern(noopCtx, rule.LinkPattern(), rule.Domain)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"url0000", "url0050", "url0100", "url0150", "url0200"}, ids)
+
+		u, err := r.GetByID(noopCtx, "url0050")
+		require.NoError(t, err)
+		assert.Equal(t, "*.example.com", u.BlockedBy)
+		assert.Equal(t, "https://docs.Example.com/50", u.Link)
+
+		ids, err = r.BlockByPattern(noopCtx, rule.LinkPattern(), rule.Domain)
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+	})
+}
+
+func TestReencryptLinks(t *testing.T) {
+	next := tests.NewMemoryURLRepository()
+	old := repository.NewEncryptedURLRepository(next, newTestCipher(t, "v1", "v1"))
+	for i := 0; i < 5; i++ {
+		u := tests.NewURL()
+		u.ID = fmt.Sprintf("url%04d", i)
+		u.Link = fmt.Sprintf("https://example.com/%d", i)
+		require.NoError(t, old.Store(noopCtx, u))
+	}
+	plain := tests.NewURL()
+	require.NoError(t, next.Store(noopCtx, plain))
+
+	cipher := newTestCipher(t, "v2", "v1", "v2")
+	n, err := repository.ReencryptLinks(noopCtx, next, cipher, 2, zap.NewNop())
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, n)
+
+	r := repository.NewEncryptedURLRepository(next, cipher)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("url%04d", i)
+		stored, err := next.GetByID(noopCtx, id)
+		require.NoError(t, err)
+		version, _ := store.KeyVersion(stored.Link)
+		assert.Equal(t, "v2", version)
+
+		u, err := r.GetByID(noopCtx, id)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("https://example.com/%d", i), u.Link)
+	}
+	u, err := r.GetByID(noopCtx, plain.ID)
+	require.NoError(t, err)
+	assert.Equal(t, plain.Link, u.Link)
+
+	// rotated URLs are skipped
+	n, err = repository.ReencryptLinks(noopCtx, next, cipher, 2, zap.NewNop())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/metrics"
+)
+
+type meteredURLRepository struct {
+	next    domain.URLRepository
+	metrics *metrics.RepositoryMetrics
+}
+
+// NewMeteredURLRepository wraps repository and records duration and errors
+// of its operations
+func NewMeteredURLRepository(next domain.URLRepository, m *metrics.RepositoryMetrics) domain.URLRepository {
+	return &meteredURLRepository{
+		next:    next,
+		metrics: m,
+	}
+}
+
+func (r *meteredURLRepository) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := r.next.Ping(ctx)
+	r.metrics.Record(ctx, "url.Ping", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	start := time.Now()
+	res, err := r.next.Stats(ctx)
+	r.metrics.Record(ctx, "url.Stats", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	start := time.Now()
+	res, err := r.next.GetByID(ctx, id, fields...)
+	r.metrics.Record(ctx, "url.GetByID", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	start := time.Now()
+	res, err := r.next.GetByIDs(ctx, ids)
+	r.metrics.Record(ctx, "url.GetByIDs", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	start := time.Now()
+	err := r.next.Update(ctx, url, ownerID)
+	r.metrics.Record(ctx, "url.Update", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	start := time.Now()
+	err := r.next.UpdateIfUnchanged(ctx, url, updatedAt, ownerID)
+	r.metrics.Record(ctx, "url.UpdateIfUnchanged", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	start := time.Now()
+	err := r.next.Store(ctx, url)
+	r.metrics.Record(ctx, "url.Store", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	start := time.Now()
+	err := r.next.Delete(ctx, id, ownerID)
+	r.metrics.Record(ctx, "url.Delete", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	start := time.Now()
+	res, err := r.next.BlockByPattern(ctx, pattern, rule)
+	r.metrics.Record(ctx, "url.BlockByPattern", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	start := time.Now()
+	res, err := r.next.Fetch(ctx, filter)
+	r.metrics.Record(ctx, "url.Fetch", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	start := time.Now()
+	res, err := r.next.CountPurgeable(ctx, filter)
+	r.metrics.Record(ctx, "url.CountPurgeable", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	start := time.Now()
+	res, err := r.next.PurgeBatch(ctx, filter, limit)
+	r.metrics.Record(ctx, "url.PurgeBatch", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	start := time.Now()
+	err := r.next.ScanIDs(ctx, fn)
+	r.metrics.Record(ctx, "url.ScanIDs", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	start := time.Now()
+	res, err := r.next.FetchExpired(ctx, now, claimedBefore, limit)
+	r.metrics.Record(ctx, "url.FetchExpired", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	start := time.Now()
+	res, err := r.next.ClaimExpired(ctx, id, now, claimedBefore)
+	r.metrics.Record(ctx, "url.ClaimExpired", start, err)
+	return res, err
+}
+
+func (r *meteredURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.next.MarkExpiredNotified(ctx, id)
+	r.metrics.Record(ctx, "url.MarkExpiredNotified", start, err)
+	return err
+}
+
+func (r *meteredURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.next.ReleaseExpired(ctx, id)
+	r.metrics.Record(ctx, "url.ReleaseExpired", start, err)
+	return err
+}
@@ -0,0 +1,66 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/metrics"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestMeteredURLRepository(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m, err := metrics.NewRepositoryMetrics(metrics.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	r := repository.NewMeteredURLRepository(tests.NewMemoryURLRepository(), m)
+	tURL := tests.NewURL()
+
+	require.NoError(t, r.Store(noopCtx, tURL))
+	_, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	_, err = r.GetByID(noopCtx, "missing")
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	err = r.Store(noopCtx, tURL)
+	assert.ErrorIs(t, err, domain.ErrConflict)
+
+	rm, err := reader.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	durations := make(map[attribute.Set]uint64)
+	errs := make(map[attribute.Set]int64)
+	for _, metric := range rm.ScopeMetrics[0].Metrics {
+		switch metric.Name {
+		case "repository_operation_duration_milliseconds":
+			for _, dp := range metric.Data.(metricdata.Histogram).DataPoints {
+				durations[dp.Attributes] = dp.Count
+			}
+		case "repository_operation_errors_total":
+			for _, dp := range metric.Data.(metricdata.Sum[int64]).DataPoints {
+				errs[dp.Attributes] = dp.Value
+			}
+		}
+	}
+
+	labels := func(op, outcome string) attribute.Set {
+		return attribute.NewSet(attribute.String("operation", op), attribute.String("outcome", outcome))
+	}
+	assert.Equal(t, map[attribute.Set]uint64{
+		labels("url.Store", metrics.OutcomeSuccess):    1,
+		labels("url.Store", metrics.OutcomeConflict):   1,
+		labels("url.GetByID", metrics.OutcomeSuccess):  1,
+		labels("url.GetByID", metrics.OutcomeNotFound): 1,
+	}, durations)
+	assert.Equal(t, map[attribute.Set]int64{
+		labels("url.Store", metrics.OutcomeConflict):   1,
+		labels("url.GetByID", metrics.OutcomeNotFound): 1,
+	}, errs)
+}
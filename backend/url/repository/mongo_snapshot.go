@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// linkSnapshotID is the id of the snapshot document of URL counts
+const linkSnapshotID = "links"
+
+type mongoLinkSnapshotRepository struct {
+	Conn   *mongo.Database
+	cols   store.Collections
+	tracer trace.Tracer
+}
+
+// NewMongoLinkSnapshotRepository will create an object that represent the
+// domain.LinkSnapshotRepository interface
+func NewMongoLinkSnapshotRepository(c *mongo.Client, db string, cols store.Collections, tracer trace.Tracer) domain.LinkSnapshotRepository {
+	return &mongoLinkSnapshotRepository{
+		Conn:   c.Database(db),
+		cols:   cols,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+// Count counts URLs by expiration_date and created_at indexes
+func (m *mongoLinkSnapshotRepository) Count(ctx context.Context, now time.Time) (*domain.LinkSnapshot, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository CountLinks",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	now = now.UTC()
+	col := m.Conn.Collection(m.cols.Name(store.URLCollection))
+	active, err := col.CountDocuments(ctx, bson.D{
+		primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$gt", Value: now}}},
+		primitive.E{Key: "blocked_by", Value: bson.D{primitive.E{Key: "$exists", Value: false}}},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("active URL count error", err)
+	}
+
+	created, err := col.CountDocuments(ctx, bson.D{
+		primitive.E{Key: "created_at", Value: bson.D{primitive.E{Key: "$gt", Value: now.Add(-time.Hour)}}},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("created URL count error", err)
+	}
+
+	return &domain.LinkSnapshot{Active: active, CreatedLastHour: created, TakenAt: now}, nil
+}
+
+func (m *mongoLinkSnapshotRepository) Save(ctx context.Context, snapshot *domain.LinkSnapshot) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository SaveLinkSnapshot",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	_, err := m.Conn.Collection(m.cols.Name(store.SnapshotCollection)).ReplaceOne(
+		ctx,
+		bson.D{primitive.E{Key: "_id", Value: linkSnapshotID}},
+		snapshot,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("link snapshot save error", err)
+	}
+
+	return nil
+}
+
+func (m *mongoLinkSnapshotRepository) Last(ctx context.Context) (*domain.LinkSnapshot, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository LastLinkSnapshot",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	snapshot := new(domain.LinkSnapshot)
+	err := m.Conn.Collection(m.cols.Name(store.SnapshotCollection)).FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: linkSnapshotID}}).Decode(snapshot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(domain.ErrNotFound)
+		return nil, domain.NewError(domain.ErrNotFound, "link snapshot was not found")
+	}
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("link snapshot get error", err)
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,90 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestMongoLinkSnapshotRepository(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("count", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(42)}}),
+			mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(3)}}),
+		)
+		r := repository.NewMongoLinkSnapshotRepository(mt.Client, mt.DB.Name(), store.Collections{}, tracer)
+
+		result, err := r.Count(noopCtx, now)
+		require.NoError(mt, err)
+		assert.Equal(mt, &domain.LinkSnapshot{Active: 42, CreatedLastHour: 3, TakenAt: now}, result)
+
+		started := mt.GetAllStartedEvents()
+		require.Len(mt, started, 2)
+		match := started[0].Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+		assert.Equal(mt, now, match.Lookup("expiration_date", "$gt").Time().UTC())
+		match = started[1].Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+		assert.Equal(mt, now.Add(-time.Hour), match.Lookup("created_at", "$gt").Time().UTC())
+	})
+
+	mt.Run("count error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "count error"}))
+		r := repository.NewMongoLinkSnapshotRepository(mt.Client, mt.DB.Name(), store.Collections{}, tracer)
+
+		result, err := r.Count(noopCtx, now)
+		assert.Nil(mt, result)
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+
+	mt.Run("save", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoLinkSnapshotRepository(mt.Client, mt.DB.Name(), store.Collections{Prefix: "prod_"}, tracer)
+
+		require.NoError(mt, r.Save(noopCtx, &domain.LinkSnapshot{Active: 42, CreatedLastHour: 3, TakenAt: now}))
+
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(mt, "prod_snapshot", cmd.Lookup("update").StringValue())
+		update := cmd.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, "links", update.Lookup("q", "_id").StringValue())
+		assert.True(mt, update.Lookup("upsert").Boolean())
+		assert.Equal(mt, int64(42), update.Lookup("u", "active").Int64())
+	})
+
+	mt.Run("last", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "shortener.snapshot", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "links"},
+				{Key: "active", Value: int64(42)},
+				{Key: "created_last_hour", Value: int64(3)},
+				{Key: "taken_at", Value: now},
+			}),
+		)
+		r := repository.NewMongoLinkSnapshotRepository(mt.Client, mt.DB.Name(), store.Collections{}, tracer)
+
+		result, err := r.Last(noopCtx)
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(42), result.Active)
+		assert.Equal(mt, int64(3), result.CreatedLastHour)
+		assert.True(mt, now.Equal(result.TakenAt))
+	})
+
+	mt.Run("no snapshot", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "shortener.snapshot", mtest.FirstBatch))
+		r := repository.NewMongoLinkSnapshotRepository(mt.Client, mt.DB.Name(), store.Collections{}, tracer)
+
+		result, err := r.Last(noopCtx)
+		assert.Nil(mt, result)
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+	})
+}
@@ -2,32 +2,104 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/semka95/shortener/backend/domain"
 	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
 )
 
 type mongoURLRepository struct {
 	Conn   *mongo.Database
+	cols   store.Collections
 	logger *zap.Logger
 	tracer trace.Tracer
+	// readPrefs has read preferences of read classes, reads of other classes
+	// are served by primary
+	readPrefs map[domain.ReadClass]*readpref.ReadPref
+}
+
+// Option configures MongoDB URL repository
+type Option func(*mongoURLRepository)
+
+// WithReadPreference makes reads of read class use read preference, read
+// class is taken from context of the call
+func WithReadPreference(class domain.ReadClass, rp *readpref.ReadPref) Option {
+	return func(m *mongoURLRepository) {
+		m.readPrefs[class] = rp
+	}
 }
 
 // NewMongoURLRepository will create an object that represent the url.Repository interface
-func NewMongoURLRepository(c *mongo.Client, db string, logger *zap.Logger, tracer trace.Tracer) domain.URLRepository {
-	return &mongoURLRepository{
-		Conn:   c.Database(db),
-		logger: logger,
-		tracer: tracer,
+func NewMongoURLRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer, opts ...Option) domain.URLRepository {
+	m := &mongoURLRepository{
+		Conn:      c.Database(db),
+		cols:      cols,
+		logger:    logger,
+		tracer:    tracing.Tracer(tracer),
+		readPrefs: make(map[domain.ReadClass]*readpref.ReadPref),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+
+	return m
+}
+
+// readPref returns read preference of read class of ctx
+func (m *mongoURLRepository) readPref(ctx context.Context) *readpref.ReadPref {
+	if rp, ok := m.readPrefs[domain.ReadClassFromContext(ctx)]; ok {
+		return rp
+	}
+	return readpref.Primary()
+}
+
+func (m *mongoURLRepository) Ping(ctx context.Context) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Ping",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := m.Conn.Client().Ping(ctx, readpref.Primary()); err != nil {
+		span.RecordError(err)
+		return domain.InternalError("URL storage ping error", err)
+	}
+
+	return nil
+}
+
+// Stats counts URLs by collection metadata, so it is cheap however many URLs
+// there are
+func (m *mongoURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Stats",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	n, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).EstimatedDocumentCount(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("URL count error", err)
+	}
+
+	return &domain.RepositoryStats{Documents: n}, nil
 }
 
 func (m *mongoURLRepository) fetch(ctx context.Context, command interface{}) ([]*domain.URL, error) {
@@ -38,7 +110,7 @@ func (m *mongoURLRepository) fetch(ctx context.Context, command interface{}) ([]
 	)
 	defer span.End()
 
-	cur, err := m.Conn.RunCommandCursor(ctx, command)
+	cur, err := m.Conn.RunCommandCursor(ctx, command, options.RunCmd().SetReadPreference(m.readPref(ctx)))
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("can't execute command: %w", err)
@@ -47,7 +119,7 @@ func (m *mongoURLRepository) fetch(ctx context.Context, command interface{}) ([]
 	defer func(ctx context.Context) {
 		err = cur.Close(ctx)
 		if err != nil {
-			m.logger.Error("can't close cursor: ", zap.Error(err))
+			web.LoggerFromContext(ctx).Error("can't close cursor: ", zap.Error(err))
 		}
 	}(ctx)
 
@@ -71,7 +143,7 @@ func (m *mongoURLRepository) fetch(ctx context.Context, command interface{}) ([]
 	return result, nil
 }
 
-func (m *mongoURLRepository) GetByID(ctx context.Context, id string) (*domain.URL, error) {
+func (m *mongoURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
 	ctx, span := m.tracer.Start(
 		ctx,
 		"repository GetByID",
@@ -82,25 +154,52 @@ func (m *mongoURLRepository) GetByID(ctx context.Context, id string) (*domain.UR
 	defer span.End()
 
 	command := bson.D{
-		primitive.E{Key: "find", Value: "url"},
+		primitive.E{Key: "find", Value: m.cols.Name(store.URLCollection)},
 		primitive.E{Key: "limit", Value: 1},
 		primitive.E{Key: "filter", Value: bson.D{primitive.E{Key: "_id", Value: id}}},
 	}
+	if len(fields) > 0 {
+		command = append(command, primitive.E{Key: "projection", Value: urlProjection(fields)})
+	}
 
 	list, err := m.fetch(ctx, command)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("URL get error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return nil, domain.InternalError("URL get error", err)
 	}
 
 	if len(list) == 0 {
 		span.RecordError(domain.ErrNotFound)
-		return nil, fmt.Errorf("URL was not found: %w", domain.ErrNotFound)
+		return nil, domain.NotFoundError(domain.EntityURL, id, "URL was not found")
 	}
 
 	return list[0], nil
 }
 
+func (m *mongoURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository GetByIDs",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Int("count", len(ids))),
+	)
+	defer span.End()
+
+	command := bson.D{
+		primitive.E{Key: "find", Value: m.cols.Name(store.URLCollection)},
+		primitive.E{Key: "filter", Value: bson.D{primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$in", Value: ids}}}}},
+	}
+
+	list, err := m.fetch(ctx, command)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("URL get error", err)
+	}
+
+	return list, nil
+}
+
 func (m *mongoURLRepository) Store(ctx context.Context, url *domain.URL) error {
 	ctx, span := m.tracer.Start(
 		ctx,
@@ -111,16 +210,20 @@ func (m *mongoURLRepository) Store(ctx context.Context, url *domain.URL) error {
 	)
 	defer span.End()
 
-	_, err := m.Conn.Collection("url").InsertOne(ctx, url)
+	_, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).InsertOne(ctx, url)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return domain.NewError(domain.ErrConflict, fmt.Sprintf("URL %s already exists", url.ID)).WithEntity(domain.EntityURL, url.ID)
+	}
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("URL store error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return domain.InternalError("URL store error", err)
 	}
 
 	return nil
 }
 
-func (m *mongoURLRepository) Delete(ctx context.Context, id string) error {
+func (m *mongoURLRepository) Delete(ctx context.Context, id, ownerID string) error {
 	ctx, span := m.tracer.Start(
 		ctx,
 		"repository Delete",
@@ -130,18 +233,16 @@ func (m *mongoURLRepository) Delete(ctx context.Context, id string) error {
 	)
 	defer span.End()
 
-	filter := bson.D{
-		primitive.E{Key: "_id", Value: id},
-	}
+	filter := ownedFilter(id, ownerID)
 
-	delRes, err := m.Conn.Collection("url").DeleteOne(ctx, filter)
+	delRes, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).DeleteOne(ctx, filter)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("URL delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return domain.InternalError("URL delete error", err)
 	}
 
 	if delRes.DeletedCount == 0 {
-		err = fmt.Errorf("URL was not deleted: %w", domain.ErrNoAffected)
+		err = domain.NewError(domain.ErrNoAffected, "URL was not deleted").WithEntity(domain.EntityURL, id)
 		span.RecordError(err)
 		return err
 	}
@@ -149,7 +250,7 @@ func (m *mongoURLRepository) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (m *mongoURLRepository) Update(ctx context.Context, url *domain.URL) error {
+func (m *mongoURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
 	ctx, span := m.tracer.Start(
 		ctx,
 		"repository Update",
@@ -159,28 +260,563 @@ func (m *mongoURLRepository) Update(ctx context.Context, url *domain.URL) error
 	)
 	defer span.End()
 
+	filter := ownedFilter(url.ID, ownerID)
+
+	updRes, err := m.update(ctx, filter, url, false)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if updRes.ModifiedCount == 0 {
+		err = domain.NewError(domain.ErrNoAffected, "URL was not updated").WithEntity(domain.EntityURL, url.ID)
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository UpdateIfUnchanged",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", url.ID)),
+	)
+	defer span.End()
+
+	filter := append(ownedFilter(url.ID, ownerID), primitive.E{Key: "updated_at", Value: updatedAt})
+
+	// URL read unblocked can't be blocked meanwhile, blocking updates it, so
+	// the update unblocks URL only when caller cleared BlockedBy
+	updRes, err := m.update(ctx, filter, url, true)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if updRes.MatchedCount > 0 {
+		return nil
+	}
+
+	// URL is either changed, deleted or given to another user
+	stored := new(domain.URL)
+	err = m.Conn.Collection(m.cols.Name(store.URLCollection)).FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: url.ID}}, options.FindOne().SetProjection(bson.D{primitive.E{Key: "user_id", Value: 1}})).Decode(stored)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		err = domain.NotFoundError(domain.EntityURL, url.ID, "URL was not found")
+	case err != nil:
+		span.RecordError(err)
+		return domain.InternalError("URL owner get error", err)
+	case ownerID != domain.AnyOwner && stored.UserID != ownerID:
+		err = domain.NewError(domain.ErrNoAffected, "URL belongs to another user").WithEntity(domain.EntityURL, url.ID)
+	default:
+		err = domain.NewError(domain.ErrConflict, "URL was changed by another request").WithEntity(domain.EntityURL, url.ID)
+	}
+	span.RecordError(err)
+	return err
+}
+
+// ownedFilter matches URL with id, it matches URL of owner with ownerID only
+// unless ownerID is AnyOwner
+func ownedFilter(id, ownerID string) bson.D {
 	filter := bson.D{
-		primitive.E{Key: "_id", Value: url.ID},
+		primitive.E{Key: "_id", Value: id},
 	}
+	if ownerID != domain.AnyOwner {
+		filter = append(filter, primitive.E{Key: "user_id", Value: ownerID})
+	}
+	return filter
+}
 
+// update sets all fields of URL document matching filter, blocked_by is
+// unset when unblock is set and URL isn't blocked
+func (m *mongoURLRepository) update(ctx context.Context, filter bson.D, url *domain.URL, unblock bool) (*mongo.UpdateResult, error) {
 	doc, err := store.StructToDoc(&url)
 	if err != nil {
-		span.RecordError(err)
-		return fmt.Errorf("can't convert URL to bson.D: %w, %s", domain.ErrInternalServerError, err.Error())
+		return nil, domain.InternalError("can't convert URL to bson.D", err)
 	}
 	update := bson.D{primitive.E{Key: "$set", Value: doc}}
+	if unblock && url.BlockedBy == "" {
+		update = append(update, primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: "blocked_by", Value: ""}}})
+	}
 
-	updRes, err := m.Conn.Collection("url").UpdateOne(ctx, filter, update)
+	updRes, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, domain.InternalError("URL update error", err)
+	}
+
+	return updRes, nil
+}
+
+func (m *mongoURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository BlockByPattern",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rule", rule)),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "link", Value: primitive.Regex{Pattern: pattern, Options: "i"}},
+		primitive.E{Key: "blocked_by", Value: bson.D{primitive.E{Key: "$exists", Value: false}}},
+	}
+	command := bson.D{
+		primitive.E{Key: "find", Value: m.cols.Name(store.URLCollection)},
+		primitive.E{Key: "filter", Value: filter},
+		primitive.E{Key: "projection", Value: bson.D{primitive.E{Key: "_id", Value: 1}}},
+	}
+
+	list, err := m.fetch(ctx, command)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("URL update error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return nil, domain.InternalError("URL block error", err)
+	}
+	if len(list) == 0 {
+		return nil, nil
 	}
 
-	if updRes.ModifiedCount == 0 {
-		err = fmt.Errorf("URL was not updated: %w", domain.ErrNoAffected)
+	ids := make([]string, 0, len(list))
+	for _, u := range list {
+		ids = append(ids, u.ID)
+	}
+
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "blocked_by", Value: rule},
+		primitive.E{Key: "updated_at", Value: time.Now().Truncate(time.Millisecond).UTC()},
+	}}}
+	_, err = m.Conn.Collection(m.cols.Name(store.URLCollection)).UpdateMany(ctx, bson.D{primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$in", Value: ids}}}}, update)
+	if err != nil {
 		span.RecordError(err)
-		return err
+		return nil, domain.InternalError("URL block error", err)
+	}
+
+	return ids, nil
+}
+
+func (m *mongoURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("status", filter.Status)),
+	)
+	defer span.End()
+
+	// owners and clicks are joined to the page only, not to all matching URLs
+	pipeline := mongo.Pipeline{
+		bson.D{primitive.E{Key: "$match", Value: urlQuery(filter, time.Now().UTC())}},
+		bson.D{primitive.E{Key: "$sort", Value: bson.D{primitive.E{Key: "_id", Value: 1}}}},
+		bson.D{primitive.E{Key: "$limit", Value: filter.Limit}},
+		bson.D{primitive.E{Key: "$lookup", Value: bson.D{
+			primitive.E{Key: "from", Value: m.cols.Name(store.UserCollection)},
+			primitive.E{Key: "let", Value: bson.D{primitive.E{Key: "user_id", Value: "$user_id"}}},
+			primitive.E{Key: "pipeline", Value: bson.A{
+				bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "$expr", Value: bson.D{
+					primitive.E{Key: "$eq", Value: bson.A{bson.D{primitive.E{Key: "$toString", Value: "$_id"}}, "$$user_id"}},
+				}}}}},
+				bson.D{primitive.E{Key: "$project", Value: bson.D{primitive.E{Key: "email", Value: 1}}}},
+			}},
+			primitive.E{Key: "as", Value: "owner"},
+		}}},
+		bson.D{primitive.E{Key: "$lookup", Value: bson.D{
+			primitive.E{Key: "from", Value: m.cols.Name(store.ClickCollection)},
+			primitive.E{Key: "localField", Value: "_id"},
+			primitive.E{Key: "foreignField", Value: "url_id"},
+			primitive.E{Key: "pipeline", Value: bson.A{
+				bson.D{primitive.E{Key: "$count", Value: "n"}},
+			}},
+			primitive.E{Key: "as", Value: "clicks"},
+		}}},
+		bson.D{primitive.E{Key: "$set", Value: bson.D{
+			primitive.E{Key: "owner_email", Value: bson.D{primitive.E{Key: "$first", Value: "$owner.email"}}},
+			primitive.E{Key: "clicks", Value: bson.D{primitive.E{Key: "$ifNull", Value: bson.A{bson.D{primitive.E{Key: "$first", Value: "$clicks.n"}}, 0}}}},
+			primitive.E{Key: "source", Value: bson.D{primitive.E{Key: "$ifNull", Value: bson.A{"$source", domain.URLSourceUnknown}}}},
+		}}},
+		bson.D{primitive.E{Key: "$unset", Value: "owner"}},
+	}
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("URL fetch error", err)
+	}
+
+	result := make([]*domain.AdminURL, 0)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("URL cursor error", err)
+	}
+
+	return result, nil
+}
+
+func (m *mongoURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository CountPurgeable",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Bool("orphaned", filter.Orphaned)),
+	)
+	defer span.End()
+
+	pipeline, err := m.purgePipeline(filter)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	pipeline = append(pipeline, bson.D{primitive.E{Key: "$count", Value: "n"}})
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return 0, domain.InternalError("URL purge count error", err)
+	}
+
+	result := make([]struct {
+		N int64 `bson:"n"`
+	}, 0, 1)
+	if err = cur.All(ctx, &result); err != nil {
+		span.RecordError(err)
+		return 0, domain.InternalError("URL cursor error", err)
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].N, nil
+}
+
+func (m *mongoURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository PurgeBatch",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.Bool("orphaned", filter.Orphaned)),
+	)
+	defer span.End()
+
+	pipeline, err := m.purgePipeline(filter)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	pipeline = append(pipeline,
+		bson.D{primitive.E{Key: "$limit", Value: limit}},
+		bson.D{primitive.E{Key: "$project", Value: bson.D{primitive.E{Key: "_id", Value: 1}}}},
+	)
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return 0, domain.InternalError("URL purge error", err)
+	}
+	batch := make([]struct {
+		ID string `bson:"_id"`
+	}, 0, limit)
+	if err = cur.All(ctx, &batch); err != nil {
+		span.RecordError(err)
+		return 0, domain.InternalError("URL cursor error", err)
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(batch))
+	for _, u := range batch {
+		ids = append(ids, u.ID)
+	}
+	query := bson.D{primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$in", Value: ids}}}}
+	// URL could be renewed after it was selected
+	if !filter.ExpiredBefore.IsZero() {
+		query = append(query, primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$lt", Value: filter.ExpiredBefore.UTC()}}})
+	}
+
+	delRes, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).DeleteMany(ctx, query)
+	if err != nil {
+		span.RecordError(err)
+		return 0, domain.InternalError("URL purge error", err)
+	}
+	span.SetAttributes(attribute.Int64("deleted", delRes.DeletedCount))
+
+	return delRes.DeletedCount, nil
+}
+
+func (m *mongoURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository ScanIDs",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	cur, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{primitive.E{Key: "_id", Value: 1}}))
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("URL scan error", err)
+	}
+	defer func(ctx context.Context) {
+		err := cur.Close(ctx)
+		if err != nil {
+			web.LoggerFromContext(ctx).Error("can't close cursor: ", zap.Error(err))
+		}
+	}(ctx)
+
+	var count int64
+	for cur.Next(ctx) {
+		id, ok := cur.Current.Lookup("_id").StringValueOK()
+		if !ok {
+			continue
+		}
+		if err = fn(id); err != nil {
+			span.RecordError(err)
+			return err
+		}
+		count++
+	}
+	span.SetAttributes(attribute.Int64("count", count))
+
+	if err = cur.Err(); err != nil {
+		span.RecordError(err)
+		return domain.InternalError("URL cursor error", err)
 	}
 
 	return nil
 }
+
+func (m *mongoURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository FetchExpired",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	command := bson.D{
+		primitive.E{Key: "find", Value: m.cols.Name(store.URLCollection)},
+		primitive.E{Key: "filter", Value: append(expiredClaimable(now, claimedBefore),
+			primitive.E{Key: "blocked_by", Value: bson.D{primitive.E{Key: "$exists", Value: false}}},
+		)},
+		primitive.E{Key: "sort", Value: bson.D{primitive.E{Key: "expiration_date", Value: 1}}},
+		primitive.E{Key: "limit", Value: limit},
+	}
+
+	list, err := m.fetch(ctx, command)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("URL fetch expired error", err)
+	}
+
+	return list, nil
+}
+
+func (m *mongoURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository ClaimExpired",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", id)),
+	)
+	defer span.End()
+
+	// the filter makes the update a compare-and-set, only one caller
+	// claims the URL until the claim times out
+	filter := append(bson.D{primitive.E{Key: "_id", Value: id}}, expiredClaimable(now, claimedBefore)...)
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "notifying_at", Value: now.UTC()}}}}
+
+	updRes, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).UpdateOne(ctx, filter, update)
+	if err != nil {
+		span.RecordError(err)
+		return false, domain.InternalError("URL claim expired error", err)
+	}
+
+	return updRes.ModifiedCount == 1, nil
+}
+
+func (m *mongoURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository MarkExpiredNotified",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", id)),
+	)
+	defer span.End()
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	update := bson.D{
+		primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "expired_notified", Value: true}}},
+		primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: "notifying_at", Value: ""}}},
+	}
+
+	if _, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).UpdateOne(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return domain.InternalError("URL mark expired error", err)
+	}
+
+	return nil
+}
+
+func (m *mongoURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository ReleaseExpired",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("urlid", id)),
+	)
+	defer span.End()
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	update := bson.D{primitive.E{Key: "$unset", Value: bson.D{primitive.E{Key: "notifying_at", Value: ""}}}}
+
+	if _, err := m.Conn.Collection(m.cols.Name(store.URLCollection)).UpdateOne(ctx, filter, update); err != nil {
+		span.RecordError(err)
+		return domain.InternalError("URL release expired error", err)
+	}
+
+	return nil
+}
+
+// expiredClaimable returns filter of URLs expired by now which are not
+// notified and not claimed after claimedBefore
+func expiredClaimable(now, claimedBefore time.Time) bson.D {
+	return bson.D{
+		primitive.E{Key: "expired_notified", Value: nil},
+		primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$lte", Value: now.UTC()}}},
+		primitive.E{Key: "$or", Value: bson.A{
+			bson.D{primitive.E{Key: "notifying_at", Value: nil}},
+			bson.D{primitive.E{Key: "notifying_at", Value: bson.D{primitive.E{Key: "$lte", Value: claimedBefore.UTC()}}}},
+		}},
+	}
+}
+
+// purgePipeline returns aggregation stages that select URLs matching purge
+// filter, filter must select something, so all URLs are never purged
+func (m *mongoURLRepository) purgePipeline(filter domain.PurgeFilter) (mongo.Pipeline, error) {
+	if filter.ExpiredBefore.IsZero() && !filter.Orphaned && filter.UserID == "" {
+		return nil, domain.NewError(domain.ErrBadParamInput, "purge filter is empty")
+	}
+
+	pipeline := mongo.Pipeline{}
+	if filter.UserID != "" {
+		pipeline = append(pipeline, bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "user_id", Value: filter.UserID},
+		}}})
+	}
+	if !filter.ExpiredBefore.IsZero() {
+		pipeline = append(pipeline, bson.D{primitive.E{Key: "$match", Value: bson.D{
+			primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$lt", Value: filter.ExpiredBefore.UTC()}}},
+		}}})
+	}
+	if filter.Orphaned {
+		// anonymous URLs have no owner, owner ids which are not ObjectIDs
+		// are converted to null and never match a user
+		pipeline = append(pipeline,
+			bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "user_id", Value: bson.D{primitive.E{Key: "$ne", Value: ""}}}}}},
+			bson.D{primitive.E{Key: "$set", Value: bson.D{primitive.E{Key: "owner_id", Value: bson.D{primitive.E{Key: "$convert", Value: bson.D{
+				primitive.E{Key: "input", Value: "$user_id"},
+				primitive.E{Key: "to", Value: "objectId"},
+				primitive.E{Key: "onError", Value: nil},
+				primitive.E{Key: "onNull", Value: nil},
+			}}}}}}},
+			bson.D{primitive.E{Key: "$lookup", Value: bson.D{
+				primitive.E{Key: "from", Value: m.cols.Name(store.UserCollection)},
+				primitive.E{Key: "localField", Value: "owner_id"},
+				primitive.E{Key: "foreignField", Value: "_id"},
+				primitive.E{Key: "pipeline", Value: bson.A{
+					bson.D{primitive.E{Key: "$project", Value: bson.D{primitive.E{Key: "_id", Value: 1}}}},
+				}},
+				primitive.E{Key: "as", Value: "owner"},
+			}}},
+			bson.D{primitive.E{Key: "$match", Value: bson.D{primitive.E{Key: "owner", Value: bson.D{primitive.E{Key: "$size", Value: 0}}}}}},
+		)
+	}
+
+	return pipeline, nil
+}
+
+// urlQuery returns query that matches URLs by filter at given time
+func urlQuery(filter domain.URLFilter, now time.Time) bson.D {
+	query := bson.D{}
+	if filter.Cursor != "" {
+		query = append(query, primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: "$gt", Value: filter.Cursor}}})
+	}
+	if filter.OwnerID != "" {
+		query = append(query, primitive.E{Key: "user_id", Value: filter.OwnerID})
+	}
+	if filter.Domain != "" {
+		query = append(query, primitive.E{Key: "link", Value: primitive.Regex{Pattern: filter.DomainPattern(), Options: "i"}})
+	}
+	switch filter.Source {
+	case "":
+	case domain.URLSourceUnknown:
+		// URLs created before sources were stored have no source
+		query = append(query, primitive.E{Key: "source", Value: bson.D{primitive.E{Key: "$in", Value: bson.A{nil, domain.URLSourceUnknown}}}})
+	default:
+		query = append(query, primitive.E{Key: "source", Value: filter.Source})
+	}
+
+	created := bson.D{}
+	if filter.CreatedAfter != nil {
+		created = append(created, primitive.E{Key: "$gte", Value: filter.CreatedAfter.UTC()})
+	}
+	if filter.CreatedBefore != nil {
+		created = append(created, primitive.E{Key: "$lt", Value: filter.CreatedBefore.UTC()})
+	}
+	if len(created) > 0 {
+		query = append(query, primitive.E{Key: "created_at", Value: created})
+	}
+
+	notBlocked := bson.D{primitive.E{Key: "$exists", Value: false}}
+	switch filter.Status {
+	case domain.URLStatusActive:
+		query = append(query,
+			primitive.E{Key: "blocked_by", Value: notBlocked},
+			primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$gt", Value: now}}},
+		)
+	case domain.URLStatusExpired:
+		query = append(query,
+			primitive.E{Key: "blocked_by", Value: notBlocked},
+			primitive.E{Key: "expiration_date", Value: bson.D{primitive.E{Key: "$lte", Value: now}}},
+		)
+	case domain.URLStatusDisabled:
+		query = append(query, primitive.E{Key: "blocked_by", Value: bson.D{primitive.E{Key: "$exists", Value: true}}})
+	}
+
+	if filter.Q != "" {
+		q := primitive.Regex{Pattern: regexp.QuoteMeta(filter.Q), Options: "i"}
+		query = append(query, primitive.E{Key: "$or", Value: bson.A{
+			bson.D{primitive.E{Key: "_id", Value: q}},
+			bson.D{primitive.E{Key: "link", Value: q}},
+		}})
+	}
+
+	return query
+}
+
+// urlProjection returns projection of URL fields, owner and blocklist rule are
+// always fetched as usecase checks them
+func urlProjection(fields []string) bson.D {
+	projection := bson.D{
+		primitive.E{Key: "user_id", Value: 1},
+		primitive.E{Key: "blocked_by", Value: 1},
+	}
+	for _, f := range fields {
+		switch f {
+		case "id", "user_id":
+			// _id is always returned
+		default:
+			projection = append(projection, primitive.E{Key: f, Value: 1})
+		}
+	}
+
+	return projection
+}
@@ -2,15 +2,20 @@ package repository_test
 
 import (
 	"context"
+	"errors"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
 	"github.com/semka95/shortener/backend/tests"
 	"github.com/semka95/shortener/backend/url/repository"
 )
@@ -31,12 +36,16 @@ func TestMongoURLRepository_GetByID(t *testing.T) {
 			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch),
 			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
 		)
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByID(noopCtx, "none")
 
 		assert.Nil(mt, result)
-		require.Error(mt, err, domain.ErrNotFound)
+		require.ErrorIs(mt, err, domain.ErrNotFound)
+		var de *domain.Error
+		require.ErrorAs(mt, err, &de)
+		assert.Equal(mt, domain.EntityURL, de.Entity)
+		assert.Equal(mt, "none", de.ID)
 	})
 
 	mt.Run("success", func(mt *mtest.T) {
@@ -44,12 +53,72 @@ func TestMongoURLRepository_GetByID(t *testing.T) {
 			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tURLBsonD),
 			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
 		)
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByID(noopCtx, tURL.ID)
 
 		require.NoError(mt, err)
 		assert.EqualValues(t, tURL, result)
+		_, err = mt.GetStartedEvent().Command.LookupErr("projection")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("success with fields", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: tURL.ID},
+				{Key: "link", Value: tURL.Link},
+				{Key: "user_id", Value: tURL.UserID},
+			}),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.GetByID(noopCtx, tURL.ID, "id", "link")
+
+		require.NoError(mt, err)
+		assert.Equal(mt, tURL.Link, result.Link)
+		assert.True(mt, result.ExpirationDate.IsZero())
+
+		projection := mt.GetStartedEvent().Command.Lookup("projection").Document()
+		elems, err := projection.Elements()
+		require.NoError(mt, err)
+		keys := make([]string, 0, len(elems))
+		for _, e := range elems {
+			keys = append(keys, e.Key())
+		}
+		assert.Equal(mt, []string{"user_id", "blocked_by", "link"}, keys)
+	})
+
+	mt.Run("redirect read preference", func(mt *mtest.T) {
+		rp, err := readpref.New(readpref.NearestMode, readpref.WithMaxStaleness(90*time.Second))
+		require.NoError(mt, err)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer, repository.WithReadPreference(domain.ReadRedirect, rp))
+
+		// mock server is standalone, so driver sends primary reads as
+		// primaryPreferred
+		expected := map[domain.ReadClass]string{
+			domain.ReadRedirect:  "nearest",
+			domain.ReadPrimary:   "primaryPreferred",
+			domain.ReadForUpdate: "primaryPreferred",
+		}
+		for class, mode := range expected {
+			mt.ClearEvents()
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tURLBsonD),
+				mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+			)
+			_, err = r.GetByID(domain.WithReadClass(noopCtx, class), tURL.ID)
+			require.NoError(mt, err)
+
+			readPref := mt.GetStartedEvent().Command.Lookup("$readPreference").Document()
+			assert.Equal(mt, mode, readPref.Lookup("mode").StringValue())
+			staleness, ok := readPref.Lookup("maxStalenessSeconds").AsInt64OK()
+			assert.Equal(mt, class == domain.ReadRedirect, ok)
+			if ok {
+				assert.EqualValues(mt, 90, staleness)
+			}
+		}
 	})
 
 	mt.Run("server error", func(mt *mtest.T) {
@@ -58,7 +127,7 @@ func TestMongoURLRepository_GetByID(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByID(noopCtx, tURL.ID)
 
@@ -67,6 +136,45 @@ func TestMongoURLRepository_GetByID(t *testing.T) {
 	})
 }
 
+func TestMongoURLRepository_GetByIDs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tURL := tests.NewURL()
+	tURLBsonD := tests.NewURLBsonD()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tURLBsonD),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.GetByIDs(noopCtx, []string{tURL.ID, "missing"})
+
+		require.NoError(mt, err)
+		require.Len(mt, result, 1)
+		assert.EqualValues(mt, tURL, result[0])
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		in := filter.Lookup("_id", "$in").Array()
+		values, err := in.Values()
+		require.NoError(mt, err)
+		require.Len(mt, values, 2)
+		assert.Equal(mt, tURL.ID, values[0].StringValue())
+		assert.Equal(mt, "missing", values[1].StringValue())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.GetByIDs(noopCtx, []string{tURL.ID})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, result)
+	})
+}
+
 func TestMongoURLRepository_Store(t *testing.T) {
 	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
@@ -74,11 +182,28 @@ func TestMongoURLRepository_Store(t *testing.T) {
 
 	mt.Run("success", func(mt *mtest.T) {
 		mt.AddMockResponses(mtest.CreateSuccessResponse())
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Store(noopCtx, tURL)
 
 		require.NoError(mt, err)
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		_, err = doc.LookupErr("created_ip")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("success with creation info", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		u := *tURL
+		u.Creation = domain.CreationInfo{IP: "203.0.113.0", UserAgent: "curl/8.0"}
+
+		err := r.Store(noopCtx, &u)
+
+		require.NoError(mt, err)
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		assert.Equal(mt, "203.0.113.0", doc.Lookup("created_ip").StringValue())
+		assert.Equal(mt, "curl/8.0", doc.Lookup("created_user_agent").StringValue())
 	})
 
 	mt.Run("server error", func(mt *mtest.T) {
@@ -87,12 +212,29 @@ func TestMongoURLRepository_Store(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Store(noopCtx, tURL)
 
 		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
 	})
+
+	mt.Run("duplicate id", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Store(noopCtx, tURL)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+		var de *domain.Error
+		require.ErrorAs(mt, err, &de)
+		assert.Equal(mt, domain.EntityURL, de.Entity)
+		assert.Equal(mt, tURL.ID, de.ID)
+	})
 }
 
 func TestMongoURLRepository_Delete(t *testing.T) {
@@ -108,9 +250,9 @@ func TestMongoURLRepository_Delete(t *testing.T) {
 				{Key: "n", Value: 0},
 			},
 		)
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
-		err := r.Delete(noopCtx, "none")
+		err := r.Delete(noopCtx, "none", domain.AnyOwner)
 
 		require.Error(mt, err, domain.ErrNoAffected)
 	})
@@ -123,9 +265,9 @@ func TestMongoURLRepository_Delete(t *testing.T) {
 				{Key: "n", Value: 1},
 			},
 		)
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
-		err := r.Delete(noopCtx, tURL.ID)
+		err := r.Delete(noopCtx, tURL.ID, domain.AnyOwner)
 
 		require.NoError(mt, err)
 	})
@@ -136,9 +278,9 @@ func TestMongoURLRepository_Delete(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
-		err := r.Delete(noopCtx, tURL.ID)
+		err := r.Delete(noopCtx, tURL.ID, domain.AnyOwner)
 
 		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
 	})
@@ -155,9 +297,9 @@ func TestMongoURLRepository_Update(t *testing.T) {
 			{Key: "ok", Value: 1},
 			{Key: "nModified", Value: 0},
 		})
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
-		err := r.Update(noopCtx, tURL)
+		err := r.Update(noopCtx, tURL, domain.AnyOwner)
 
 		require.Error(mt, err, domain.ErrNoAffected)
 	})
@@ -168,9 +310,9 @@ func TestMongoURLRepository_Update(t *testing.T) {
 			{Key: "value", Value: tURLBsonD},
 			{Key: "nModified", Value: 1},
 		})
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
-		err := r.Update(noopCtx, tURL)
+		err := r.Update(noopCtx, tURL, domain.AnyOwner)
 
 		require.NoError(mt, err)
 	})
@@ -181,10 +323,627 @@ func TestMongoURLRepository_Update(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Update(noopCtx, tURL, domain.AnyOwner)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_UpdateIfUnchanged(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tURL := tests.NewURL()
+	updatedAt := tURL.UpdatedAt.Add(-time.Minute)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdateIfUnchanged(noopCtx, tURL, updatedAt, domain.AnyOwner)
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		q := update.Lookup("q").Document()
+		assert.Equal(mt, tURL.ID, q.Lookup("_id").StringValue())
+		assert.Equal(mt, updatedAt, q.Lookup("updated_at").Time().UTC())
+		_, err = update.Lookup("u").Document().LookupErr("$unset", "blocked_by")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("blocked", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		blocked := *tURL
+		blocked.BlockedBy = "report"
+
+		err := r.UpdateIfUnchanged(noopCtx, &blocked, updatedAt, domain.AnyOwner)
+
+		require.NoError(mt, err)
+		u := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u").Document()
+		assert.Equal(mt, "report", u.Lookup("$set", "blocked_by").StringValue())
+		_, err = u.LookupErr("$unset")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("changed", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "n", Value: 0},
+				{Key: "nModified", Value: 0},
+			},
+			mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(1)}}),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdateIfUnchanged(noopCtx, tURL, updatedAt, domain.AnyOwner)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+	})
+
+	mt.Run("deleted", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "n", Value: 0},
+				{Key: "nModified", Value: 0},
+			},
+			mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdateIfUnchanged(noopCtx, tURL, updatedAt, domain.AnyOwner)
+
+		assert.ErrorIs(mt, err, domain.ErrNotFound)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   1,
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdateIfUnchanged(noopCtx, tURL, updatedAt, domain.AnyOwner)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_Fetch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tURL := tests.NewURL()
+	tURLBsonD := tests.NewURLBsonD()
+	after := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mt.Run("success", func(mt *mtest.T) {
+		doc := append(bson.D{}, tURLBsonD...)
+		doc = append(doc, bson.E{Key: "owner_email", Value: "owner@example.com"}, bson.E{Key: "clicks", Value: int64(42)})
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, doc),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.Fetch(noopCtx, domain.URLFilter{Limit: 10})
+
+		require.NoError(mt, err)
+		require.Len(mt, result, 1)
+		assert.Equal(mt, tURL.ID, result[0].ID)
+		assert.Equal(mt, tURL.Link, result[0].Link)
+		assert.Equal(mt, "owner@example.com", result[0].OwnerEmail)
+		assert.EqualValues(mt, 42, result[0].Clicks)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		assert.EqualValues(mt, 10, pipeline.Index(2).Value().Document().Lookup("$limit").AsInt64())
+		assert.Equal(mt, "user", pipeline.Index(3).Value().Document().Lookup("$lookup", "from").StringValue())
+		assert.Equal(mt, "click", pipeline.Index(4).Value().Document().Lookup("$lookup", "from").StringValue())
+	})
+
+	cases := []struct {
+		description string
+		filter      domain.URLFilter
+		check       func(mt *mtest.T, match bson.Raw)
+	}{
+		{
+			description: "no filter matches everything",
+			filter:      domain.URLFilter{},
+			check: func(mt *mtest.T, match bson.Raw) {
+				elems, err := match.Elements()
+				require.NoError(mt, err)
+				assert.Empty(mt, elems)
+			},
+		},
+		{
+			description: "owner and cursor",
+			filter:      domain.URLFilter{Owner: "owner@example.com", OwnerID: tURL.UserID, Cursor: "abc1234"},
+			check: func(mt *mtest.T, match bson.Raw) {
+				assert.Equal(mt, tURL.UserID, match.Lookup("user_id").StringValue())
+				assert.Equal(mt, "abc1234", match.Lookup("_id", "$gt").StringValue())
+				_, err := match.LookupErr("owner")
+				assert.Error(mt, err)
+			},
+		},
+		{
+			description: "domain and creation window",
+			filter:      domain.URLFilter{Domain: "example.com", CreatedAfter: &after, CreatedBefore: &before},
+			check: func(mt *mtest.T, match bson.Raw) {
+				pattern, options := match.Lookup("link").Regex()
+				assert.Equal(mt, "i", options)
+				re := regexp.MustCompile(pattern)
+				assert.True(mt, re.MatchString("https://example.com/page"))
+				assert.True(mt, re.MatchString("http://www.example.com:8080"))
+				assert.False(mt, re.MatchString("https://notexample.com/"))
+				assert.False(mt, re.MatchString("https://example.com.evil.org/"))
+				assert.Equal(mt, after, match.Lookup("created_at", "$gte").Time().UTC())
+				assert.Equal(mt, before, match.Lookup("created_at", "$lt").Time().UTC())
+			},
+		},
+		{
+			description: "created after only",
+			filter:      domain.URLFilter{CreatedAfter: &after},
+			check: func(mt *mtest.T, match bson.Raw) {
+				assert.Equal(mt, after, match.Lookup("created_at", "$gte").Time().UTC())
+				_, err := match.LookupErr("created_at", "$lt")
+				assert.Error(mt, err)
+			},
+		},
+		{
+			description: "active status",
+			filter:      domain.URLFilter{Status: domain.URLStatusActive},
+			check: func(mt *mtest.T, match bson.Raw) {
+				assert.False(mt, match.Lookup("blocked_by", "$exists").Boolean())
+				assert.WithinDuration(mt, time.Now(), match.Lookup("expiration_date", "$gt").Time(), time.Minute)
+			},
+		},
+		{
+			description: "expired status",
+			filter:      domain.URLFilter{Status: domain.URLStatusExpired},
+			check: func(mt *mtest.T, match bson.Raw) {
+				assert.False(mt, match.Lookup("blocked_by", "$exists").Boolean())
+				assert.WithinDuration(mt, time.Now(), match.Lookup("expiration_date", "$lte").Time(), time.Minute)
+			},
+		},
+		{
+			description: "source",
+			filter:      domain.URLFilter{Source: domain.URLSourceAPI},
+			check: func(mt *mtest.T, match bson.Raw) {
+				assert.Equal(mt, domain.URLSourceAPI, match.Lookup("source").StringValue())
+			},
+		},
+		{
+			description: "unknown source matches URLs without source",
+			filter:      domain.URLFilter{Source: domain.URLSourceUnknown},
+			check: func(mt *mtest.T, match bson.Raw) {
+				in := match.Lookup("source", "$in").Array()
+				assert.Equal(mt, bson.TypeNull, in.Index(0).Value().Type)
+				assert.Equal(mt, domain.URLSourceUnknown, in.Index(1).Value().StringValue())
+			},
+		},
+		{
+			description: "disabled status with search",
+			filter:      domain.URLFilter{Status: domain.URLStatusDisabled, Q: "a.b"},
+			check: func(mt *mtest.T, match bson.Raw) {
+				assert.True(mt, match.Lookup("blocked_by", "$exists").Boolean())
+				_, err := match.LookupErr("expiration_date")
+				assert.Error(mt, err)
+				or := match.Lookup("$or").Array()
+				pattern, _ := or.Index(0).Value().Document().Lookup("_id").Regex()
+				assert.Equal(mt, `a\.b`, pattern)
+				pattern, _ = or.Index(1).Value().Document().Lookup("link").Regex()
+				assert.Equal(mt, `a\.b`, pattern)
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		mt.Run(tc.description, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch))
+			r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+			result, err := r.Fetch(noopCtx, tc.filter)
+
+			require.NoError(mt, err)
+			assert.NotNil(mt, result)
+			assert.Empty(mt, result)
+			pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+			tc.check(mt, pipeline.Index(0).Value().Document().Lookup("$match").Document())
+		})
+	}
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.Fetch(noopCtx, domain.URLFilter{Limit: 10})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, result)
+	})
+}
+
+func TestMongoURLRepository_CountPurgeable(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	before := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mt.Run("expired", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(3)}}),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.CountPurgeable(noopCtx, domain.PurgeFilter{ExpiredBefore: before})
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 3, n)
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		assert.Equal(mt, before, pipeline.Index(0).Value().Document().Lookup("$match", "expiration_date", "$lt").Time().UTC())
+		assert.Equal(mt, "n", pipeline.Index(1).Value().Document().Lookup("$count").StringValue())
+	})
+
+	mt.Run("orphaned", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch))
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.CountPurgeable(noopCtx, domain.PurgeFilter{Orphaned: true})
+
+		require.NoError(mt, err)
+		assert.Zero(mt, n)
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		assert.Equal(mt, "", pipeline.Index(0).Value().Document().Lookup("$match", "user_id", "$ne").StringValue())
+		assert.Equal(mt, "user", pipeline.Index(2).Value().Document().Lookup("$lookup", "from").StringValue())
+		assert.EqualValues(mt, 0, pipeline.Index(3).Value().Document().Lookup("$match", "owner", "$size").AsInt64())
+	})
+
+	mt.Run("user", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, bson.D{{Key: "n", Value: int64(2)}}),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.CountPurgeable(noopCtx, domain.PurgeFilter{UserID: "507f191e810c19729de860ea"})
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 2, n)
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		assert.Equal(mt, "507f191e810c19729de860ea", pipeline.Index(0).Value().Document().Lookup("$match", "user_id").StringValue())
+		assert.Equal(mt, "n", pipeline.Index(1).Value().Document().Lookup("$count").StringValue())
+	})
+
+	mt.Run("empty filter", func(mt *mtest.T) {
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		_, err := r.CountPurgeable(noopCtx, domain.PurgeFilter{})
+
+		assert.ErrorIs(mt, err, domain.ErrBadParamInput)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		_, err := r.CountPurgeable(noopCtx, domain.PurgeFilter{Orphaned: true})
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_PurgeBatch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	before := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, bson.D{{Key: "_id", Value: "test123"}}, bson.D{{Key: "_id", Value: "test456"}}),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+			bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 2}},
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.PurgeBatch(noopCtx, domain.PurgeFilter{ExpiredBefore: before}, 2)
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 2, n)
+		events := mt.GetAllStartedEvents()
+		pipeline := events[0].Command.Lookup("pipeline").Array()
+		assert.EqualValues(mt, 2, pipeline.Index(1).Value().Document().Lookup("$limit").AsInt64())
+		filter := events[len(events)-1].Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		ids, err := filter.Lookup("_id", "$in").Array().Values()
+		require.NoError(mt, err)
+		assert.Len(mt, ids, 2)
+		assert.Equal(mt, before, filter.Lookup("expiration_date", "$lt").Time().UTC())
+	})
+
+	mt.Run("nothing to purge", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch))
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.PurgeBatch(noopCtx, domain.PurgeFilter{Orphaned: true}, 2)
+
+		require.NoError(mt, err)
+		assert.Zero(mt, n)
+		assert.Len(mt, mt.GetAllStartedEvents(), 1)
+	})
+
+	mt.Run("delete error", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch, bson.D{{Key: "_id", Value: "test123"}}),
+			bson.D{{Key: "ok", Value: 0}},
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		_, err := r.PurgeBatch(noopCtx, domain.PurgeFilter{Orphaned: true}, 2)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_ScanIDs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, bson.D{{Key: "_id", Value: "test123"}}, bson.D{{Key: "_id", Value: "test456"}}),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch, bson.D{{Key: "_id", Value: "test789"}}),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		var ids []string
+		err := r.ScanIDs(noopCtx, func(id string) error {
+			ids = append(ids, id)
+			return nil
+		})
+
+		require.NoError(mt, err)
+		assert.Equal(mt, []string{"test123", "test456", "test789"}, ids)
+		projection := mt.GetStartedEvent().Command.Lookup("projection").Document()
+		assert.EqualValues(mt, 1, projection.Lookup("_id").AsInt64())
+	})
+
+	mt.Run("callback error", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch, bson.D{{Key: "_id", Value: "test123"}}, bson.D{{Key: "_id", Value: "test456"}}),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+		errStop := errors.New("stop")
+
+		calls := 0
+		err := r.ScanIDs(noopCtx, func(id string) error {
+			calls++
+			return errStop
+		})
+
+		assert.ErrorIs(mt, err, errStop)
+		assert.Equal(mt, 1, calls)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.ScanIDs(noopCtx, func(id string) error { return nil })
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_FetchExpired(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tURL := tests.NewURL()
+	tURLBsonD := tests.NewURLBsonD()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tURLBsonD),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.FetchExpired(noopCtx, time.Now(), time.Now(), 10)
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, []*domain.URL{tURL}, result)
+		command := mt.GetStartedEvent().Command
+		assert.EqualValues(mt, 10, command.Lookup("limit").AsInt64())
+		filter := command.Lookup("filter").Document()
+		assert.Equal(mt, bson.TypeNull, filter.Lookup("expired_notified").Type)
+		_, err = filter.LookupErr("expiration_date", "$lte")
+		assert.NoError(mt, err)
+		_, err = filter.LookupErr("blocked_by", "$exists")
+		assert.NoError(mt, err)
+		_, err = filter.LookupErr("$or")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.FetchExpired(noopCtx, time.Now(), time.Now(), 10)
+
+		assert.Nil(mt, result)
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_ClaimExpired(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("claimed", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		now := time.Now()
+		claimed, err := r.ClaimExpired(noopCtx, "test123", now, now.Add(-time.Minute))
+
+		require.NoError(mt, err)
+		assert.True(mt, claimed)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		filter := update.Lookup("q").Document()
+		assert.Equal(mt, "test123", filter.Lookup("_id").StringValue())
+		assert.Equal(mt, bson.TypeNull, filter.Lookup("expired_notified").Type)
+		_, err = filter.LookupErr("$or")
+		assert.NoError(mt, err)
+		_, err = update.LookupErr("u", "$set", "notifying_at")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("claimed already", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+			{Key: "nModified", Value: 0},
+		})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		claimed, err := r.ClaimExpired(noopCtx, "test123", time.Now(), time.Now())
+
+		require.NoError(mt, err)
+		assert.False(mt, claimed)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		claimed, err := r.ClaimExpired(noopCtx, "test123", time.Now(), time.Now())
+
+		assert.False(mt, claimed)
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_MarkExpiredNotified(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.MarkExpiredNotified(noopCtx, "test123")
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.True(mt, update.Lookup("u", "$set", "expired_notified").Boolean())
+		_, err = update.LookupErr("u", "$unset", "notifying_at")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.MarkExpiredNotified(noopCtx, "test123")
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_ReleaseExpired(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.ReleaseExpired(noopCtx, "test123")
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		_, err = update.LookupErr("u", "$unset", "notifying_at")
+		assert.NoError(mt, err)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.ReleaseExpired(noopCtx, "test123")
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_Ping(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Ping(noopCtx)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, "ping", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Ping(noopCtx)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoURLRepository_Stats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int64(42)}))
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.Stats(noopCtx)
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 42, stats.Documents)
+		assert.Equal(mt, "url", mt.GetStartedEvent().Command.Lookup("count").StringValue())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoURLRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
-		err := r.Update(noopCtx, tURL)
+		stats, err := r.Stats(noopCtx)
 
 		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, stats)
 	})
 }
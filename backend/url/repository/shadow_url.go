@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type shadowURLRepository struct {
+	primary   domain.URLRepository
+	secondary domain.URLRepository
+	shadow    *store.Shadow
+}
+
+// NewShadowURLRepository wraps primary repository with shadow, so reads are
+// repeated against secondary in background and writes are copied to it.
+// Callers get results and errors of primary only.
+func NewShadowURLRepository(primary, secondary domain.URLRepository, shadow *store.Shadow) domain.URLRepository {
+	return &shadowURLRepository{
+		primary:   primary,
+		secondary: secondary,
+		shadow:    shadow,
+	}
+}
+
+func (r *shadowURLRepository) Ping(ctx context.Context) error {
+	return r.primary.Ping(ctx)
+}
+
+func (r *shadowURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	return r.primary.Stats(ctx)
+}
+
+func (r *shadowURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	url, err := r.primary.GetByID(ctx, id, fields...)
+	r.shadow.Read("GetByID", url, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.GetByID(ctx, id, fields...)
+	})
+	return url, err
+}
+
+// GetByIDs compares URLs by id, as they are returned in no particular order
+func (r *shadowURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	urls, err := r.primary.GetByIDs(ctx, ids)
+	ids = append([]string(nil), ids...)
+	r.shadow.Read("GetByIDs", urlsByID(urls), err, func(ctx context.Context) (interface{}, error) {
+		urls, err := r.secondary.GetByIDs(ctx, ids)
+		return urlsByID(urls), err
+	})
+	return urls, err
+}
+
+func urlsByID(urls []*domain.URL) map[string]*domain.URL {
+	m := make(map[string]*domain.URL, len(urls))
+	for _, u := range urls {
+		m[u.ID] = u
+	}
+	return m
+}
+
+func (r *shadowURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	if err := r.primary.Update(ctx, url, ownerID); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Update", func(ctx context.Context) error {
+		return r.secondary.Update(ctx, url, ownerID)
+	})
+	return nil
+}
+
+// UpdateIfUnchanged updates secondary unconditionally, primary has checked
+// the URL is unchanged and owned already
+func (r *shadowURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	if err := r.primary.UpdateIfUnchanged(ctx, url, updatedAt, ownerID); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "UpdateIfUnchanged", func(ctx context.Context) error {
+		return r.secondary.Update(ctx, url, domain.AnyOwner)
+	})
+	return nil
+}
+
+func (r *shadowURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	if err := r.primary.Store(ctx, url); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Store", func(ctx context.Context) error {
+		return r.secondary.Store(ctx, url)
+	})
+	return nil
+}
+
+func (r *shadowURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	if err := r.primary.Delete(ctx, id, ownerID); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Delete", func(ctx context.Context) error {
+		return r.secondary.Delete(ctx, id, ownerID)
+	})
+	return nil
+}
+
+func (r *shadowURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	ids, err := r.primary.BlockByPattern(ctx, pattern, rule)
+	if err != nil {
+		return nil, err
+	}
+	r.shadow.Write(ctx, "BlockByPattern", func(ctx context.Context) error {
+		_, err := r.secondary.BlockByPattern(ctx, pattern, rule)
+		return err
+	})
+	return ids, nil
+}
+
+func (r *shadowURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	urls, err := r.primary.Fetch(ctx, filter)
+	r.shadow.Read("Fetch", urls, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.Fetch(ctx, filter)
+	})
+	return urls, err
+}
+
+func (r *shadowURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	n, err := r.primary.CountPurgeable(ctx, filter)
+	r.shadow.Read("CountPurgeable", n, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.CountPurgeable(ctx, filter)
+	})
+	return n, err
+}
+
+func (r *shadowURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	n, err := r.primary.PurgeBatch(ctx, filter, limit)
+	if err != nil {
+		return 0, err
+	}
+	r.shadow.Write(ctx, "PurgeBatch", func(ctx context.Context) error {
+		_, err := r.secondary.PurgeBatch(ctx, filter, limit)
+		return err
+	})
+	return n, nil
+}
+
+func (r *shadowURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	return r.primary.ScanIDs(ctx, fn)
+}
+
+func (r *shadowURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	urls, err := r.primary.FetchExpired(ctx, now, claimedBefore, limit)
+	r.shadow.Read("FetchExpired", urls, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.FetchExpired(ctx, now, claimedBefore, limit)
+	})
+	return urls, err
+}
+
+func (r *shadowURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	claimed, err := r.primary.ClaimExpired(ctx, id, now, claimedBefore)
+	if err != nil {
+		return false, err
+	}
+	r.shadow.Write(ctx, "ClaimExpired", func(ctx context.Context) error {
+		_, err := r.secondary.ClaimExpired(ctx, id, now, claimedBefore)
+		return err
+	})
+	return claimed, nil
+}
+
+func (r *shadowURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	if err := r.primary.MarkExpiredNotified(ctx, id); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "MarkExpiredNotified", func(ctx context.Context) error {
+		return r.secondary.MarkExpiredNotified(ctx, id)
+	})
+	return nil
+}
+
+func (r *shadowURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	if err := r.primary.ReleaseExpired(ctx, id); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "ReleaseExpired", func(ctx context.Context) error {
+		return r.secondary.ReleaseExpired(ctx, id)
+	})
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestShadowURLRepository(t *testing.T) {
+	primary := tests.NewMemoryURLRepository()
+	secondary := tests.NewMemoryURLRepository()
+	shadow := store.NewShadow("url", time.Second, time.Second, 100, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go shadow.Run(ctx)
+	r := repository.NewShadowURLRepository(primary, secondary, shadow)
+	tURL := tests.NewURL()
+
+	// writes are copied, so reads match
+	require.NoError(t, r.Store(noopCtx, tURL))
+	u, err := r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL, u)
+	_, err = r.GetByIDs(noopCtx, []string{tURL.ID, "missing"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return shadow.Reads(store.ShadowMatch) == 2 }, time.Second, time.Millisecond)
+
+	// secondary diverges
+	diverged := *tURL
+	diverged.Link = "http://www.example.com"
+	diverged.UpdatedAt = tURL.UpdatedAt.Add(100 * time.Millisecond)
+	require.NoError(t, secondary.Update(noopCtx, &diverged, domain.AnyOwner))
+	u, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tURL.Link, u.Link, "primary result is returned")
+	require.Eventually(t, func() bool { return shadow.Reads(store.ShadowMismatch) == 1 }, time.Second, time.Millisecond)
+
+	// only timestamp diverges within tolerance
+	diverged.Link = tURL.Link
+	require.NoError(t, secondary.Update(noopCtx, &diverged, domain.AnyOwner))
+	_, err = r.Fetch(noopCtx, domain.URLFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return shadow.Reads(store.ShadowMatch) == 3 }, time.Second, time.Millisecond)
+
+	// URL is missing from secondary
+	require.NoError(t, secondary.Delete(noopCtx, tURL.ID, domain.AnyOwner))
+	_, err = r.GetByID(noopCtx, tURL.ID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return shadow.Reads(store.ShadowMismatch) == 2 }, time.Second, time.Millisecond)
+
+	// failed secondary write is not returned
+	require.NoError(t, r.Update(noopCtx, tURL, domain.AnyOwner))
+	assert.EqualValues(t, 1, shadow.WriteErrors())
+}
+
+func TestShadowURLRepository_PrimaryError(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	primary := mock.NewMockURLRepository(controller)
+	secondary := mock.NewMockURLRepository(controller)
+	shadow := store.NewShadow("url", 0, time.Second, 100, zap.NewNop())
+	r := repository.NewShadowURLRepository(primary, secondary, shadow)
+	tURL := tests.NewURL()
+
+	// failed writes are not copied
+	primary.EXPECT().Store(gomock.Any(), tURL).Return(errors.New("test"))
+	err := r.Store(noopCtx, tURL)
+	assert.EqualError(t, err, "test")
+}
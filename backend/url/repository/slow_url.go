@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+const urlCollection = "url"
+
+type slowURLRepository struct {
+	next domain.URLRepository
+	slow *store.SlowOpLogger
+}
+
+// NewSlowURLRepository wraps repository and logs its operations that exceed
+// SlowOpLogger threshold
+func NewSlowURLRepository(next domain.URLRepository, slow *store.SlowOpLogger) domain.URLRepository {
+	return &slowURLRepository{
+		next: next,
+		slow: slow,
+	}
+}
+
+func (r *slowURLRepository) Ping(ctx context.Context) error {
+	defer r.slow.Start(ctx, "Ping", urlCollection, nil)()
+	return r.next.Ping(ctx)
+}
+
+func (r *slowURLRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	defer r.slow.Start(ctx, "Stats", urlCollection, nil)()
+	return r.next.Stats(ctx)
+}
+
+func (r *slowURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	defer r.slow.Start(ctx, "GetByID", urlCollection, id)()
+	return r.next.GetByID(ctx, id, fields...)
+}
+
+func (r *slowURLRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.URL, error) {
+	defer r.slow.Start(ctx, "GetByIDs", urlCollection, ids)()
+	return r.next.GetByIDs(ctx, ids)
+}
+
+func (r *slowURLRepository) Update(ctx context.Context, url *domain.URL, ownerID string) error {
+	defer r.slow.Start(ctx, "Update", urlCollection, url.ID)()
+	return r.next.Update(ctx, url, ownerID)
+}
+
+func (r *slowURLRepository) UpdateIfUnchanged(ctx context.Context, url *domain.URL, updatedAt time.Time, ownerID string) error {
+	defer r.slow.Start(ctx, "UpdateIfUnchanged", urlCollection, url.ID)()
+	return r.next.UpdateIfUnchanged(ctx, url, updatedAt, ownerID)
+}
+
+func (r *slowURLRepository) Store(ctx context.Context, url *domain.URL) error {
+	defer r.slow.Start(ctx, "Store", urlCollection, url.ID)()
+	return r.next.Store(ctx, url)
+}
+
+func (r *slowURLRepository) Delete(ctx context.Context, id, ownerID string) error {
+	defer r.slow.Start(ctx, "Delete", urlCollection, id)()
+	return r.next.Delete(ctx, id, ownerID)
+}
+
+func (r *slowURLRepository) BlockByPattern(ctx context.Context, pattern, rule string) ([]string, error) {
+	defer r.slow.Start(ctx, "BlockByPattern", urlCollection, pattern)()
+	return r.next.BlockByPattern(ctx, pattern, rule)
+}
+
+func (r *slowURLRepository) Fetch(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+	defer r.slow.Start(ctx, "Fetch", urlCollection, filter.Cursor)()
+	return r.next.Fetch(ctx, filter)
+}
+
+func (r *slowURLRepository) CountPurgeable(ctx context.Context, filter domain.PurgeFilter) (int64, error) {
+	defer r.slow.Start(ctx, "CountPurgeable", urlCollection, filter)()
+	return r.next.CountPurgeable(ctx, filter)
+}
+
+func (r *slowURLRepository) PurgeBatch(ctx context.Context, filter domain.PurgeFilter, limit int64) (int64, error) {
+	defer r.slow.Start(ctx, "PurgeBatch", urlCollection, filter)()
+	return r.next.PurgeBatch(ctx, filter, limit)
+}
+
+func (r *slowURLRepository) ScanIDs(ctx context.Context, fn func(id string) error) error {
+	defer r.slow.Start(ctx, "ScanIDs", urlCollection, nil)()
+	return r.next.ScanIDs(ctx, fn)
+}
+
+func (r *slowURLRepository) FetchExpired(ctx context.Context, now, claimedBefore time.Time, limit int64) ([]*domain.URL, error) {
+	defer r.slow.Start(ctx, "FetchExpired", urlCollection, now)()
+	return r.next.FetchExpired(ctx, now, claimedBefore, limit)
+}
+
+func (r *slowURLRepository) ClaimExpired(ctx context.Context, id string, now, claimedBefore time.Time) (bool, error) {
+	defer r.slow.Start(ctx, "ClaimExpired", urlCollection, id)()
+	return r.next.ClaimExpired(ctx, id, now, claimedBefore)
+}
+
+func (r *slowURLRepository) MarkExpiredNotified(ctx context.Context, id string) error {
+	defer r.slow.Start(ctx, "MarkExpiredNotified", urlCollection, id)()
+	return r.next.MarkExpiredNotified(ctx, id)
+}
+
+func (r *slowURLRepository) ReleaseExpired(ctx context.Context, id string) error {
+	defer r.slow.Start(ctx, "ReleaseExpired", urlCollection, id)()
+	return r.next.ReleaseExpired(ctx, id)
+}
@@ -0,0 +1,57 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/repository"
+)
+
+func TestSlowURLRepository(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockURLRepository(controller)
+	tURL := tests.NewURL()
+
+	t.Run("slow operation is logged", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		r := repository.NewSlowURLRepository(next, store.NewSlowOpLogger(5*time.Millisecond, zap.New(core)))
+		next.EXPECT().GetByID(gomock.Any(), tURL.ID).DoAndReturn(func(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+			time.Sleep(10 * time.Millisecond)
+			return tURL, nil
+		})
+
+		u, err := r.GetByID(noopCtx, tURL.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tURL, u)
+
+		require.Equal(t, 1, logs.Len())
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, "GetByID", fields["operation"])
+		assert.Equal(t, "url", fields["collection"])
+		assert.Equal(t, tURL.ID, fields["filter"])
+	})
+
+	t.Run("fast operation is not logged", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		r := repository.NewSlowURLRepository(next, store.NewSlowOpLogger(time.Hour, zap.New(core)))
+		next.EXPECT().Delete(gomock.Any(), tURL.ID, domain.AnyOwner).Return(domain.ErrNoAffected)
+
+		err := r.Delete(noopCtx, tURL.ID, domain.AnyOwner)
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+
+		assert.Equal(t, 0, logs.Len())
+	})
+}
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// Defaults of SnapshotConfig fields that are not set
+const (
+	DefaultSnapshotInterval = 60
+	DefaultSnapshotJitter   = 10
+)
+
+// snapshotLock is the name of the lock held by the instance counting URLs
+const snapshotLock = "link_snapshot"
+
+// SnapshotConfig stores configuration of URL count snapshots
+type SnapshotConfig struct {
+	// Interval is the interval between snapshots in seconds
+	Interval int `yaml:"interval_seconds"`
+	// Jitter is the maximum random delay of every snapshot in seconds, so
+	// instances started together don't query storage at once
+	Jitter int `yaml:"jitter_seconds"`
+}
+
+// LinkSnapshots takes snapshots of URL counts exported as gauges. URLs are
+// counted by the instance holding the lock, it keeps the lock as long as it
+// keeps counting. Other instances export the snapshot it saved last, so all
+// of them export the same numbers.
+type LinkSnapshots struct {
+	repo           domain.LinkSnapshotRepository
+	locker         domain.Locker
+	contextTimeout time.Duration
+	logger         *zap.Logger
+	cfg            SnapshotConfig
+	now            func() time.Time
+	// lock is held by Run goroutine only
+	lock domain.Lock
+
+	mu   sync.RWMutex
+	last *domain.LinkSnapshot
+}
+
+// NewLinkSnapshots creates LinkSnapshots, call Run to take snapshots
+// periodically
+func NewLinkSnapshots(r domain.LinkSnapshotRepository, l domain.Locker, timeout time.Duration, logger *zap.Logger, cfg SnapshotConfig) *LinkSnapshots {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultSnapshotInterval
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+
+	return &LinkSnapshots{
+		repo:           r,
+		locker:         l,
+		contextTimeout: timeout,
+		logger:         logger,
+		cfg:            cfg,
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces clock snapshots are taken by
+func (s *LinkSnapshots) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Last returns the last snapshot, it is nil until the first one is taken or
+// loaded
+func (s *LinkSnapshots) Last() *domain.LinkSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last
+}
+
+// Run takes snapshot after random delay up to jitter and then every interval
+// until context is canceled, snapshots wait while service is read-only
+func (s *LinkSnapshots) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		if s.cfg.Jitter > 0 {
+			delay := time.NewTimer(time.Duration(random.Int63n(int64(s.cfg.Jitter) * int64(time.Second))))
+			select {
+			case <-ctx.Done():
+				delay.Stop()
+				return
+			case <-delay.C:
+			}
+		}
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		if err := s.Snapshot(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("can't take link snapshot", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot counts URLs and saves the snapshot when the lock is acquired,
+// otherwise it loads the snapshot saved by the lock holder. The last snapshot
+// is kept when counting or loading fails.
+func (s *LinkSnapshots) Snapshot(c context.Context) error {
+	ctx, cancel := context.WithTimeout(c, s.contextTimeout)
+	defer cancel()
+
+	// lock is not released, it expires when holder misses two snapshots
+	ttl := 2 * time.Duration(s.cfg.Interval+s.cfg.Jitter) * time.Second
+	err := s.hold(ctx, ttl)
+	if errors.Is(err, domain.ErrConflict) {
+		return s.load(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := s.repo.Count(ctx, s.now())
+	if err != nil {
+		return err
+	}
+	if err = s.repo.Save(ctx, snapshot); err != nil {
+		return err
+	}
+	s.set(snapshot)
+
+	return nil
+}
+
+// hold extends held lock or acquires it when none is held or held one was
+// taken over
+func (s *LinkSnapshots) hold(ctx context.Context, ttl time.Duration) error {
+	if s.lock != nil {
+		err := s.lock.Refresh(ctx, ttl)
+		if !errors.Is(err, domain.ErrConflict) {
+			return err
+		}
+		s.lock = nil
+	}
+
+	lock, err := s.locker.AcquireLock(ctx, snapshotLock, ttl)
+	if err != nil {
+		return err
+	}
+	s.lock = lock
+
+	return nil
+}
+
+// load loads snapshot saved by the lock holder, there is none until it saves
+// the first one
+func (s *LinkSnapshots) load(ctx context.Context) error {
+	snapshot, err := s.repo.Last(ctx)
+	if errors.Is(err, domain.ErrNotFound) {
+		s.logger.Debug("no link snapshot was saved yet")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.set(snapshot)
+
+	return nil
+}
+
+func (s *LinkSnapshots) set(snapshot *domain.LinkSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = snapshot
+}
@@ -0,0 +1,168 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	lockmock "github.com/semka95/shortener/backend/lock/mock"
+	"github.com/semka95/shortener/backend/metrics"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+// fakeSnapshotRepository counts URLs as set and keeps saved snapshot, it
+// fails while err is set
+type fakeSnapshotRepository struct {
+	mu      sync.Mutex
+	err     error
+	counts  domain.LinkSnapshot
+	saved   *domain.LinkSnapshot
+	counted int
+}
+
+func (r *fakeSnapshotRepository) Count(ctx context.Context, now time.Time) (*domain.LinkSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.counted++
+	s := r.counts
+	s.TakenAt = now
+	return &s, nil
+}
+
+func (r *fakeSnapshotRepository) Save(ctx context.Context, snapshot *domain.LinkSnapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	s := *snapshot
+	r.saved = &s
+	return nil
+}
+
+func (r *fakeSnapshotRepository) Last(ctx context.Context) (*domain.LinkSnapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.saved == nil {
+		return nil, fmt.Errorf("link snapshot was not found: %w", domain.ErrNotFound)
+	}
+	s := *r.saved
+	return &s, nil
+}
+
+// collectGauges returns values of link snapshot gauges by name
+func collectGauges(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	rm, err := reader.Collect(context.Background())
+	require.NoError(t, err)
+
+	gauges := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			for _, dp := range m.Data.(metricdata.Gauge[int64]).DataPoints {
+				gauges[m.Name] = dp.Value
+			}
+		}
+	}
+	return gauges
+}
+
+func TestLinkSnapshots_Snapshot(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	locker := lockmock.NewMockLocker(controller)
+	lock := lockmock.NewMockLock(controller)
+	repo := &fakeSnapshotRepository{counts: domain.LinkSnapshot{Active: 42, CreatedLastHour: 3}}
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	newSnapshots := func(t *testing.T) (*usecase.LinkSnapshots, sdkmetric.Reader) {
+		s := usecase.NewLinkSnapshots(repo, locker, 10*time.Second, zap.NewNop(), usecase.SnapshotConfig{Interval: 60, Jitter: 10})
+		s.SetClock(func() time.Time { return now })
+		reader := sdkmetric.NewManualReader()
+		require.NoError(t, metrics.RegisterLinkSnapshot(s.Last, metrics.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))))
+		return s, reader
+	}
+
+	counter, counterReader := newSnapshots(t)
+	other, otherReader := newSnapshots(t)
+
+	t.Run("nothing observed before snapshot", func(t *testing.T) {
+		assert.Empty(t, collectGauges(t, counterReader))
+	})
+
+	t.Run("no snapshot saved yet", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "link_snapshot", 140*time.Second).Return(nil, domain.ErrConflict)
+
+		require.NoError(t, other.Snapshot(context.Background()))
+		assert.Nil(t, other.Last())
+		assert.Empty(t, collectGauges(t, otherReader))
+	})
+
+	t.Run("lock holder counts", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "link_snapshot", 140*time.Second).Return(lock, nil)
+
+		require.NoError(t, counter.Snapshot(context.Background()))
+		assert.Equal(t, &domain.LinkSnapshot{Active: 42, CreatedLastHour: 3, TakenAt: now}, repo.saved)
+		assert.Equal(t, map[string]int64{"links_active": 42, "links_created_last_hour": 3}, collectGauges(t, counterReader))
+	})
+
+	t.Run("others export saved snapshot", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "link_snapshot", gomock.Any()).Return(nil, domain.ErrConflict)
+
+		require.NoError(t, other.Snapshot(context.Background()))
+		assert.Equal(t, 1, repo.counted)
+		assert.Equal(t, map[string]int64{"links_active": 42, "links_created_last_hour": 3}, collectGauges(t, otherReader))
+	})
+
+	t.Run("holder keeps lock", func(t *testing.T) {
+		repo.counts = domain.LinkSnapshot{Active: 40, CreatedLastHour: 1}
+		lock.EXPECT().Refresh(gomock.Any(), 140*time.Second).Return(nil)
+
+		require.NoError(t, counter.Snapshot(context.Background()))
+		assert.Equal(t, map[string]int64{"links_active": 40, "links_created_last_hour": 1}, collectGauges(t, counterReader))
+	})
+
+	t.Run("count error keeps last snapshot", func(t *testing.T) {
+		repo.err = domain.ErrInternalServerError
+		defer func() { repo.err = nil }()
+		lock.EXPECT().Refresh(gomock.Any(), gomock.Any()).Return(nil)
+
+		err := counter.Snapshot(context.Background())
+		require.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Equal(t, map[string]int64{"links_active": 40, "links_created_last_hour": 1}, collectGauges(t, counterReader))
+	})
+
+	t.Run("lock error", func(t *testing.T) {
+		locker.EXPECT().AcquireLock(gomock.Any(), "link_snapshot", gomock.Any()).Return(nil, domain.ErrInternalServerError)
+
+		err := other.Snapshot(context.Background())
+		require.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Equal(t, map[string]int64{"links_active": 42, "links_created_last_hour": 3}, collectGauges(t, otherReader))
+	})
+
+	t.Run("holder whose lock was taken over loads snapshot", func(t *testing.T) {
+		gomock.InOrder(
+			lock.EXPECT().Refresh(gomock.Any(), gomock.Any()).Return(domain.ErrConflict),
+			locker.EXPECT().AcquireLock(gomock.Any(), "link_snapshot", gomock.Any()).Return(nil, domain.ErrConflict),
+		)
+		counted := repo.counted
+
+		require.NoError(t, counter.Snapshot(context.Background()))
+		assert.Equal(t, counted, repo.counted)
+	})
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// DefaultAliasMinLength is the minimum length of custom aliases used when
+// AliasConfig.MinLength is not set
+const DefaultAliasMinLength = 4
+
+// Rules custom aliases are checked against, error of alias names the rule it
+// breaks
+const (
+	AliasRuleMinLength      = "min_length"
+	AliasRuleGeneratedSpace = "generated_space"
+	AliasRuleEdgeSeparator  = "edge_separator"
+	AliasRuleAuthenticated  = "authenticated"
+)
+
+// AliasConfig stores rules of custom aliases, aliases which look like
+// generated ids or start or end with separator are always rejected
+type AliasConfig struct {
+	// MinLength is the minimum length of custom alias
+	MinLength int `yaml:"min_length"`
+	// RequireAuth allows custom aliases to authenticated users only
+	RequireAuth bool `yaml:"require_auth"`
+}
+
+// checkAlias checks custom alias of URL created by user with userID,
+// anonymous users have empty userID
+func (cfg AliasConfig) checkAlias(alias, userID string) error {
+	if cfg.RequireAuth && userID == "" {
+		return aliasError(AliasRuleAuthenticated, "custom alias requires authentication")
+	}
+
+	if len(alias) < cfg.MinLength {
+		return aliasError(AliasRuleMinLength, fmt.Sprintf("custom alias must be at least %d characters long", cfg.MinLength))
+	}
+
+	// generated ids would collide with aliases of their length
+	if len(alias) == generatedIDLength && strings.Trim(alias, letterBytes) == "" {
+		return aliasError(AliasRuleGeneratedSpace, fmt.Sprintf("custom alias of %d characters is reserved for generated ids", generatedIDLength))
+	}
+
+	if strings.Trim(alias, "-_") != alias {
+		return aliasError(AliasRuleEdgeSeparator, "custom alias can't start or end with - or _")
+	}
+
+	return nil
+}
+
+func aliasError(rule, message string) error {
+	return domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("%s (%s rule)", message, rule)).WithField("id")
+}
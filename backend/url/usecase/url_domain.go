@@ -0,0 +1,30 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// ShortDomains refuses URLs created on domains which are not allowed, URLs
+// without domain are created on the default one
+type ShortDomains struct {
+	domain.URLUsecase
+	domains domain.DomainChecker
+}
+
+// NewShortDomains wraps u with checks of URL domain against domains
+func NewShortDomains(u domain.URLUsecase, domains domain.DomainChecker) *ShortDomains {
+	return &ShortDomains{
+		URLUsecase: u,
+		domains:    domains,
+	}
+}
+
+// Store returns domain.UnknownDomainError when URL domain is not allowed
+func (s *ShortDomains) Store(ctx context.Context, createURL domain.CreateURL) (*domain.URL, error) {
+	if err := s.domains.CheckDomain(ctx, createURL.Domain); err != nil {
+		return nil, err
+	}
+	return s.URLUsecase.Store(ctx, createURL)
+}
@@ -0,0 +1,42 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	shortdomainMock "github.com/semka95/shortener/backend/shortdomain/mock"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+func TestShortDomains_Store(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockURLUsecase(controller)
+	domains := shortdomainMock.NewMockDomainChecker(controller)
+	s := usecase.NewShortDomains(uc, domains)
+
+	t.Run("allowed domain", func(t *testing.T) {
+		createURL := domain.CreateURL{Link: "https://example.com", Domain: "go.example.com"}
+		domains.EXPECT().CheckDomain(gomock.Any(), "go.example.com").Return(nil)
+		uc.EXPECT().Store(gomock.Any(), createURL).Return(&domain.URL{ID: "test123", Domain: "go.example.com"}, nil)
+
+		u, err := s.Store(context.Background(), createURL)
+		require.NoError(t, err)
+		assert.Equal(t, "go.example.com", u.Domain)
+	})
+
+	t.Run("unknown domain", func(t *testing.T) {
+		createURL := domain.CreateURL{Link: "https://example.com", Domain: "evil.example.net"}
+		domains.EXPECT().CheckDomain(gomock.Any(), "evil.example.net").Return(&domain.UnknownDomainError{Domain: "evil.example.net"})
+
+		u, err := s.Store(context.Background(), createURL)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, u)
+	})
+}
@@ -0,0 +1,220 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// DefaultSweepInterval is the interval of expiration sweeps in seconds used
+// when ExpirationConfig.SweepInterval is not set
+const DefaultSweepInterval = 60
+
+// DefaultSweepBatchSize is the number of expired URLs fetched at once used
+// when ExpirationConfig.BatchSize is not set
+const DefaultSweepBatchSize = 100
+
+// DefaultExpiredQueueSize is the number of URLs found expired on redirect
+// waiting to be notified used when ExpirationConfig.QueueSize is not set
+const DefaultExpiredQueueSize = 256
+
+// DefaultClaimTimeout is the time in seconds after which claim of URL being
+// notified is taken over used when ExpirationConfig.ClaimTimeout is not set
+const DefaultClaimTimeout = 300
+
+// ExpirationConfig stores expiration notification configuration
+type ExpirationConfig struct {
+	// SweepInterval is the interval of searching for expired URLs in seconds
+	SweepInterval int `yaml:"sweep_seconds"`
+	// BatchSize is the number of expired URLs fetched at once
+	BatchSize int64 `yaml:"batch_size"`
+	// QueueSize is the number of URLs found expired on redirect waiting to
+	// be notified, URLs are left to the sweeper when the queue is full
+	QueueSize int `yaml:"queue_size"`
+	// ClaimTimeout is the time in seconds after which claim of URL being
+	// notified is taken over by the next sweep, it must be longer than
+	// publishing takes
+	ClaimTimeout int `yaml:"claim_timeout_seconds"`
+}
+
+// ExpirationNotifier publishes url.expired event for every expired URL.
+// Sweeper finds URLs expired since its last run, URLs found expired on
+// redirect are notified right away. URL is claimed before the event is
+// published, so only one caller publishes it, and marked as notified after
+// the event is published. Claim is released when publishing fails and is
+// taken over by a sweep once it times out, so event of URL claimed by process
+// that crashed is published later. Delivery is at least once, consumers
+// dedupe events by URL id.
+type ExpirationNotifier struct {
+	urlRepo        domain.URLRepository
+	clickRepo      domain.ClickRepository
+	publisher      domain.EventPublisher
+	contextTimeout time.Duration
+	logger         *zap.Logger
+	cfg            ExpirationConfig
+	queue          chan *domain.URL
+}
+
+// NewExpirationNotifier creates ExpirationNotifier, call Run to sweep expired
+// URLs and notify URLs passed to NotifyExpired
+func NewExpirationNotifier(u domain.URLRepository, c domain.ClickRepository, p domain.EventPublisher, timeout time.Duration, logger *zap.Logger, cfg ExpirationConfig) *ExpirationNotifier {
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = DefaultSweepInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultSweepBatchSize
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultExpiredQueueSize
+	}
+	if cfg.ClaimTimeout <= 0 {
+		cfg.ClaimTimeout = DefaultClaimTimeout
+	}
+
+	return &ExpirationNotifier{
+		urlRepo:        u,
+		clickRepo:      c,
+		publisher:      p,
+		contextTimeout: timeout,
+		logger:         logger,
+		cfg:            cfg,
+		queue:          make(chan *domain.URL, cfg.QueueSize),
+	}
+}
+
+// NotifyExpired queues URL to be notified if it is expired and was not
+// notified or claimed yet
+func (n *ExpirationNotifier) NotifyExpired(u *domain.URL) {
+	if u.ExpiredNotified || u.NotifyingAt != nil || u.ExpirationDate.After(time.Now()) {
+		return
+	}
+
+	select {
+	case n.queue <- u:
+	default:
+	}
+}
+
+// Run sweeps expired URLs right away and then every sweep interval, and
+// notifies queued URLs until context is canceled. Notifications claim URLs,
+// so they wait while service is read-only.
+func (n *ExpirationNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(n.cfg.SweepInterval) * time.Second)
+	defer ticker.Stop()
+
+	n.sweep(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-n.queue:
+			if err := domain.WaitWritable(ctx); err != nil {
+				return
+			}
+			if _, err := n.notify(ctx, u); err != nil {
+				n.logger.Error("can't notify expired url", zap.String("urlid", u.ID), zap.Error(err))
+			}
+		case <-ticker.C:
+			n.sweep(ctx)
+		}
+	}
+}
+
+func (n *ExpirationNotifier) sweep(ctx context.Context) {
+	if err := domain.WaitWritable(ctx); err != nil {
+		return
+	}
+	published, err := n.Sweep(ctx)
+	if err != nil && ctx.Err() == nil {
+		n.logger.Error("expiration sweep failed", zap.Int("published", published), zap.Error(err))
+	}
+}
+
+// Sweep notifies URLs expired by now and returns number of published events,
+// it stops at first URL that can't be notified
+func (n *ExpirationNotifier) Sweep(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, n.contextTimeout)
+		now := time.Now()
+		urls, err := n.urlRepo.FetchExpired(fetchCtx, now, n.claimedBefore(now), n.cfg.BatchSize)
+		cancel()
+		if err != nil {
+			return published, err
+		}
+
+		for _, u := range urls {
+			ok, err := n.notify(ctx, u)
+			if err != nil {
+				return published, fmt.Errorf("can't notify %s expired url: %w", u.ID, err)
+			}
+			if ok {
+				published++
+			}
+		}
+
+		if int64(len(urls)) < n.cfg.BatchSize {
+			return published, nil
+		}
+	}
+}
+
+// notify publishes url.expired event if URL is claimed by this call, it
+// reports whether event was published. URL is marked as notified only after
+// the event is published, if process crashes in between the claim times out
+// and the event is published again by a sweep.
+func (n *ExpirationNotifier) notify(c context.Context, u *domain.URL) (bool, error) {
+	ctx, cancel := context.WithTimeout(c, n.contextTimeout)
+	defer cancel()
+
+	now := time.Now()
+	claimed, err := n.urlRepo.ClaimExpired(ctx, u.ID, now, n.claimedBefore(now))
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	stats, err := n.clickRepo.ClickStats(ctx, u.ID, u.CreatedAt, now)
+	if err == nil {
+		err = n.publisher.Publish(ctx, domain.Event{
+			Type:       domain.EventURLExpired,
+			OccurredAt: u.ExpirationDate,
+			Data: domain.URLExpired{
+				ID:             u.ID,
+				Link:           u.Link,
+				UserID:         u.UserID,
+				ExpirationDate: u.ExpirationDate,
+				Clicks:         stats.Clicks,
+			},
+		})
+	}
+	if err != nil {
+		n.release(u.ID)
+		return false, err
+	}
+
+	if err = n.urlRepo.MarkExpiredNotified(ctx, u.ID); err != nil {
+		n.logger.Error("can't mark expired url as notified, it is notified again once claim times out", zap.String("urlid", u.ID), zap.Error(err))
+	}
+
+	return true, nil
+}
+
+// claimedBefore returns time before which claims made at now are timed out
+func (n *ExpirationNotifier) claimedBefore(now time.Time) time.Time {
+	return now.Add(-time.Duration(n.cfg.ClaimTimeout) * time.Second)
+}
+
+// release removes claim of URL with its own context, as context of notify
+// may be already done
+func (n *ExpirationNotifier) release(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.contextTimeout)
+	defer cancel()
+
+	if err := n.urlRepo.ReleaseExpired(ctx, id); err != nil {
+		n.logger.Error("can't release expired url, it is retried once claim times out", zap.String("urlid", id), zap.Error(err))
+	}
+}
@@ -0,0 +1,215 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	clickmock "github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+// recordingPublisher records published events, it fails while err is set
+type recordingPublisher struct {
+	mu     sync.Mutex
+	err    error
+	events []domain.Event
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event domain.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *recordingPublisher) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Published returns number of events published for every URL id
+func (p *recordingPublisher) Published() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	published := make(map[string]int, len(p.events))
+	for _, e := range p.events {
+		published[e.Data.(domain.URLExpired).ID]++
+	}
+	return published
+}
+
+func storeExpiredURL(t *testing.T, repo *tests.MemoryURLRepository, id string, expiredAgo time.Duration) *domain.URL {
+	u := tests.NewURL()
+	u.ID = id
+	u.ExpirationDate = time.Now().Add(-expiredAgo)
+	require.NoError(t, repo.Store(context.Background(), u))
+	return u
+}
+
+func TestExpirationNotifier_Sweep(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clicks := clickmock.NewMockClickRepository(controller)
+	clicks.EXPECT().ClickStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&domain.ClickStats{Clicks: 7}, nil).AnyTimes()
+
+	repo := tests.NewMemoryURLRepository()
+	publisher := &recordingPublisher{}
+	n := usecase.NewExpirationNotifier(repo, clicks, publisher, time.Second, zap.NewNop(), usecase.ExpirationConfig{BatchSize: 1})
+
+	first := storeExpiredURL(t, repo, "expired1", 2*time.Hour)
+	storeExpiredURL(t, repo, "expired2", time.Hour)
+	storeExpiredURL(t, repo, "active", -time.Hour)
+	blocked := storeExpiredURL(t, repo, "blocked", time.Hour)
+	blocked.BlockedBy = "rule"
+	require.NoError(t, repo.Update(context.Background(), blocked, domain.AnyOwner))
+
+	published, err := n.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, map[string]int{"expired1": 1, "expired2": 1}, publisher.Published())
+
+	event := publisher.events[0]
+	assert.Equal(t, domain.EventURLExpired, event.Type)
+	assert.Equal(t, domain.URLExpired{
+		ID:             first.ID,
+		Link:           first.Link,
+		UserID:         first.UserID,
+		ExpirationDate: first.ExpirationDate,
+		Clicks:         7,
+	}, event.Data)
+
+	published, err = n.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+}
+
+func TestExpirationNotifier_PublishFailure(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clicks := clickmock.NewMockClickRepository(controller)
+	clicks.EXPECT().ClickStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&domain.ClickStats{}, nil).AnyTimes()
+
+	repo := tests.NewMemoryURLRepository()
+	publisher := &recordingPublisher{}
+	n := usecase.NewExpirationNotifier(repo, clicks, publisher, time.Second, zap.NewNop(), usecase.ExpirationConfig{})
+	storeExpiredURL(t, repo, "expired", time.Hour)
+
+	publisher.SetErr(errors.New("webhook is down"))
+	published, err := n.Sweep(context.Background())
+	assert.Error(t, err)
+	assert.Zero(t, published)
+
+	publisher.SetErr(nil)
+	published, err = n.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, map[string]int{"expired": 1}, publisher.Published())
+}
+
+func TestExpirationNotifier_ExactlyOnce(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clicks := clickmock.NewMockClickRepository(controller)
+	clicks.EXPECT().ClickStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&domain.ClickStats{}, nil).AnyTimes()
+
+	repo := tests.NewMemoryURLRepository()
+	publisher := &recordingPublisher{}
+	cfg := usecase.ExpirationConfig{BatchSize: 3, QueueSize: 64}
+	// two notifiers stand for two instances sharing the database
+	n1 := usecase.NewExpirationNotifier(repo, clicks, publisher, time.Second, zap.NewNop(), cfg)
+	n2 := usecase.NewExpirationNotifier(repo, clicks, publisher, time.Second, zap.NewNop(), cfg)
+
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	urls := make([]*domain.URL, 0, len(ids))
+	for _, id := range ids {
+		urls = append(urls, storeExpiredURL(t, repo, id, time.Minute))
+	}
+	active := storeExpiredURL(t, repo, "active", -time.Hour)
+
+	// redirects found URLs expired before sweeper ran
+	for _, u := range urls {
+		n1.NotifyExpired(u)
+		n2.NotifyExpired(u)
+	}
+	n1.NotifyExpired(active)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, n := range []*usecase.ExpirationNotifier{n1, n2} {
+		n := n
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			n.Run(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := n.Sweep(ctx)
+			assert.NoError(t, err)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return len(publisher.Published()) == len(ids) }, time.Second, time.Millisecond)
+	published, err := n2.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+
+	cancel()
+	wg.Wait()
+
+	for _, id := range ids {
+		assert.Equal(t, 1, publisher.Published()[id], id)
+	}
+	assert.Len(t, publisher.Published(), len(ids))
+}
+
+func TestExpirationNotifier_CrashAfterClaim(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	clicks := clickmock.NewMockClickRepository(controller)
+	clicks.EXPECT().ClickStats(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(&domain.ClickStats{}, nil).AnyTimes()
+
+	repo := tests.NewMemoryURLRepository()
+	publisher := &recordingPublisher{}
+	n := usecase.NewExpirationNotifier(repo, clicks, publisher, time.Second, zap.NewNop(), usecase.ExpirationConfig{ClaimTimeout: 60})
+
+	// instances claimed URLs and died before publishing their events
+	storeExpiredURL(t, repo, "crashed", time.Hour)
+	claimedAt := time.Now().Add(-2 * time.Minute)
+	claimed, err := repo.ClaimExpired(context.Background(), "crashed", claimedAt, claimedAt)
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	storeExpiredURL(t, repo, "publishing", time.Hour)
+	claimed, err = repo.ClaimExpired(context.Background(), "publishing", time.Now(), time.Now())
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	published, err := n.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, map[string]int{"crashed": 1}, publisher.Published())
+
+	published, err = n.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+}
@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// idPoolRetryDelay is the pause after pool failed to check id in repository
+const idPoolRetryDelay = time.Second
+
+// IDPool keeps generated URL ids that were free when they were checked, so
+// Store doesn't check them on the request path. Ids taken by custom id URLs
+// are discarded from the pool, id may still be taken by other instance, so
+// Store must be ready for conflict.
+type IDPool struct {
+	urlRepo        domain.URLRepository
+	contextTimeout time.Duration
+	logger         *zap.Logger
+	ids            chan string
+
+	mu     sync.Mutex
+	pooled map[string]struct{}
+}
+
+// NewIDPool creates IDPool that holds up to size ids, pool is empty until Run
+// is started
+func NewIDPool(u domain.URLRepository, size int, timeout time.Duration, logger *zap.Logger) *IDPool {
+	return &IDPool{
+		urlRepo:        u,
+		contextTimeout: timeout,
+		logger:         logger,
+		ids:            make(chan string, size),
+		pooled:         make(map[string]struct{}, size),
+	}
+}
+
+// Run keeps the pool full until context is canceled
+func (p *IDPool) Run(ctx context.Context) {
+	src := rand.NewSource(time.Now().UnixNano())
+
+	for {
+		id := GenerateURLToken(generatedIDLength, src)
+
+		// id is reserved before it is checked, so custom id URL stored during
+		// the check discards it
+		p.mu.Lock()
+		p.pooled[id] = struct{}{}
+		p.mu.Unlock()
+
+		free, err := p.isFree(ctx, id)
+		if !free {
+			p.Discard(id)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.logger.Error("can't check pooled url id", zap.String("urlid", id), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(idPoolRetryDelay):
+			}
+			continue
+		}
+		if !free {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case p.ids <- id:
+		}
+	}
+}
+
+func (p *IDPool) isFree(c context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(c, p.contextTimeout)
+	defer cancel()
+
+	_, err := p.urlRepo.GetByID(ctx, id)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return true, nil
+	case err != nil:
+		return false, err
+	default:
+		return false, nil
+	}
+}
+
+// Take returns pooled id, it returns false when pool is empty
+func (p *IDPool) Take() (string, bool) {
+	for {
+		select {
+		case id := <-p.ids:
+			p.mu.Lock()
+			_, ok := p.pooled[id]
+			delete(p.pooled, id)
+			p.mu.Unlock()
+			if ok {
+				return id, true
+			}
+		default:
+			return "", false
+		}
+	}
+}
+
+// Discard removes id from the pool, it must be called before URL with custom
+// id is stored
+func (p *IDPool) Discard(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pooled, id)
+}
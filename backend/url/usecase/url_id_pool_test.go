@@ -0,0 +1,157 @@
+package usecase_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/featureflag"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+// checkedURLRepository records ids checked with GetByID
+type checkedURLRepository struct {
+	*tests.MemoryURLRepository
+	mu      sync.Mutex
+	checked []string
+}
+
+func (r *checkedURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	r.mu.Lock()
+	r.checked = append(r.checked, id)
+	r.mu.Unlock()
+	return r.MemoryURLRepository.GetByID(ctx, id, fields...)
+}
+
+func (r *checkedURLRepository) Checked() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.checked...)
+}
+
+// runPool runs pool until it is full and blocks on the next id, returned
+// function stops the pool and waits for it to return
+func runPool(t *testing.T, pool *usecase.IDPool, repo *checkedURLRepository, size int) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return len(repo.Checked()) > size }, time.Second, time.Millisecond)
+
+	return func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("pool didn't stop")
+		}
+	}
+}
+
+func TestIDPool(t *testing.T) {
+	repo := &checkedURLRepository{MemoryURLRepository: tests.NewMemoryURLRepository()}
+	pool := usecase.NewIDPool(repo, 2, time.Second, zap.NewNop())
+
+	_, ok := pool.Take()
+	assert.False(t, ok)
+
+	stop := runPool(t, pool, repo, 2)
+	stop()
+
+	checked := repo.Checked()
+	id, ok := pool.Take()
+	require.True(t, ok)
+	assert.Equal(t, checked[0], id)
+	id, ok = pool.Take()
+	require.True(t, ok)
+	assert.Equal(t, checked[1], id)
+	_, ok = pool.Take()
+	assert.False(t, ok)
+}
+
+func TestIDPool_CustomIDDiscarded(t *testing.T) {
+	repo := &checkedURLRepository{MemoryURLRepository: tests.NewMemoryURLRepository()}
+	pool := usecase.NewIDPool(repo, 2, time.Second, zap.NewNop())
+	uc := usecase.NewURLUsecase(repo, tests.NewMemoryUserRepository(), domain.NewTimeouts(time.Second), tracer, 1, usecase.LinkConfig{}, nil, pool, nil, nil)
+
+	stop := runPool(t, pool, repo, 2)
+	defer stop()
+	pooled := repo.Checked()[:2]
+
+	// custom ids can't take pooled ids, they are of generated length
+	_, err := uc.Store(context.Background(), domain.CreateURL{ID: &pooled[0], Link: "https://www.example.org"})
+	require.ErrorIs(t, err, domain.ErrBadParamInput)
+
+	u, err := uc.Store(context.Background(), domain.CreateURL{Link: "https://www.example.org"})
+	require.NoError(t, err)
+	assert.Equal(t, pooled[0], u.ID)
+}
+
+func TestURLUsecase_StorePooledID(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	repository := mock.NewMockURLRepository(controller)
+
+	backend := &checkedURLRepository{MemoryURLRepository: tests.NewMemoryURLRepository()}
+	pool := usecase.NewIDPool(backend, 2, time.Second, zap.NewNop())
+	runPool(t, pool, backend, 2)()
+	pooled := backend.Checked()[:2]
+
+	uc := usecase.NewURLUsecase(repository, nil, domain.NewTimeouts(time.Second), tracer, 1, usecase.LinkConfig{}, nil, pool, nil, nil)
+
+	t.Run("pooled id is not checked", func(t *testing.T) {
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		u, err := uc.Store(context.Background(), domain.CreateURL{Link: "https://www.example.org"})
+		require.NoError(t, err)
+		assert.Equal(t, pooled[0], u.ID)
+	})
+
+	t.Run("pooled id taken by other instance", func(t *testing.T) {
+		var generated string
+		gomock.InOrder(
+			repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(domain.ErrConflict),
+			repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, id string, _ ...string) (*domain.URL, error) {
+				generated = id
+				return nil, domain.ErrNotFound
+			}),
+			repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil),
+		)
+
+		u, err := uc.Store(context.Background(), domain.CreateURL{Link: "https://www.example.org"})
+		require.NoError(t, err)
+		assert.NotEqual(t, pooled[1], u.ID)
+		assert.Equal(t, generated, u.ID)
+	})
+}
+
+func TestURLUsecase_StoreIDPoolDisabled(t *testing.T) {
+	repo := &checkedURLRepository{MemoryURLRepository: tests.NewMemoryURLRepository()}
+	pool := usecase.NewIDPool(repo, 2, time.Second, zap.NewNop())
+	flags := featureflag.NewStatic(featureflag.Config{featureflag.IDPool: {}})
+	uc := usecase.NewURLUsecase(repo, tests.NewMemoryUserRepository(), domain.NewTimeouts(time.Second), tracer, 1, usecase.LinkConfig{}, nil, pool, flags, nil)
+
+	stop := runPool(t, pool, repo, 2)
+	defer stop()
+	pooled := repo.Checked()[:2]
+
+	u, err := uc.Store(context.Background(), domain.CreateURL{Link: "https://www.example.org"})
+	require.NoError(t, err)
+	assert.NotContains(t, pooled, u.ID)
+	// pooled ids are left for instances with the flag on
+	id, ok := pool.Take()
+	require.True(t, ok)
+	assert.Equal(t, pooled[0], id)
+}
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/spam"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/web"
+)
+
+// Default spam filter configuration used when SpamConfig fields are not set
+const (
+	DefaultSpamThreshold      = 50
+	DefaultSpamVelocityWindow = 600
+)
+
+// Spam filter actions
+const (
+	// SpamActionFlag stores spam URLs flagged, they redirect through
+	// interstitial page and are queued for admin review
+	SpamActionFlag = "flag"
+	// SpamActionReject refuses to store spam URLs
+	SpamActionReject = "reject"
+)
+
+// SpamConfig stores spam filter configuration
+type SpamConfig struct {
+	// Threshold is the score link is treated as spam from
+	Threshold int `yaml:"threshold"`
+	// Action is either flag or reject, URLs are flagged by default
+	Action string `yaml:"action"`
+	// VelocityWindow is the period URLs created from one IP are counted in,
+	// in seconds
+	VelocityWindow int `yaml:"velocity_window_seconds"`
+	// ShortenerDomains lists domains treated as URL shorteners besides well
+	// known ones, e.g. domain of the service itself
+	ShortenerDomains []string `yaml:"shortener_domains"`
+}
+
+// SpamFilter scores links of new URLs with spam heuristics, see package spam.
+// URLs scored at or above threshold are either rejected or stored flagged
+// and reported for admin review.
+type SpamFilter struct {
+	domain.URLUsecase
+	reports domain.ReportRepository
+	cfg     SpamConfig
+	recent  *store.SlidingWindow
+	now     func() time.Time
+}
+
+// NewSpamFilter wraps u with spam filter, flagged URLs are reported to reports
+func NewSpamFilter(u domain.URLUsecase, reports domain.ReportRepository, cfg SpamConfig) (*SpamFilter, error) {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultSpamThreshold
+	}
+	if cfg.Action == "" {
+		cfg.Action = SpamActionFlag
+	}
+	if cfg.Action != SpamActionFlag && cfg.Action != SpamActionReject {
+		return nil, fmt.Errorf("unknown spam action %q", cfg.Action)
+	}
+	if cfg.VelocityWindow <= 0 {
+		cfg.VelocityWindow = DefaultSpamVelocityWindow
+	}
+
+	return &SpamFilter{
+		URLUsecase: u,
+		reports:    reports,
+		cfg:        cfg,
+		// one event over the limit is enough to score velocity
+		recent: store.NewSlidingWindow(time.Duration(cfg.VelocityWindow)*time.Second, spam.VelocityLimit+1),
+		now:    time.Now,
+	}, nil
+}
+
+// SetClock replaces clock recent URLs are expired and flags are dated by
+func (f *SpamFilter) SetClock(now func() time.Time) {
+	f.recent.SetClock(now)
+	f.now = now
+}
+
+// Store scores link of the URL before storing it. Failure to report flagged
+// URL is logged only, the URL is stored anyway.
+func (f *SpamFilter) Store(ctx context.Context, createURL domain.CreateURL) (*domain.URL, error) {
+	in := spam.Input{Link: createURL.Link, Shorteners: f.cfg.ShortenerDomains}
+	if ip := createURL.Creation.IP; ip != "" {
+		in.RecentFromCreator = f.recent.Add(ip)
+	}
+
+	result := spam.Score(in)
+	if result.Score < f.cfg.Threshold {
+		return f.URLUsecase.Store(ctx, createURL)
+	}
+
+	logger := web.LoggerFromContext(ctx).With(zap.Int("spam_score", result.Score), zap.Strings("spam_signals", result.Signals))
+	if f.cfg.Action == SpamActionReject {
+		logger.Warn("url rejected as spam")
+		return nil, fmt.Errorf("%w: %s", domain.ErrSpam, strings.Join(result.Signals, ", "))
+	}
+
+	now := f.now().Truncate(time.Millisecond).UTC()
+	createURL.Flag = &domain.URLFlag{Score: result.Score, Signals: result.Signals, At: now}
+	u, err := f.URLUsecase.Store(ctx, createURL)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Warn("url flagged as spam", zap.String("urlid", u.ID))
+	err = f.reports.Store(ctx, u.ID, domain.ReportComment{
+		Reason:    domain.ReportReasonSpam,
+		Text:      fmt.Sprintf("spam score %d: %s", result.Score, strings.Join(result.Signals, ", ")),
+		CreatedAt: now,
+	})
+	if err != nil {
+		logger.Error("can't report flagged url", zap.String("urlid", u.ID), zap.Error(err))
+	}
+
+	return u, nil
+}
@@ -0,0 +1,121 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	reportMock "github.com/semka95/shortener/backend/report/mock"
+	"github.com/semka95/shortener/backend/spam"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+func newTestSpamFilter(t *testing.T, cfg usecase.SpamConfig) (*usecase.SpamFilter, *mock.MockURLUsecase, *reportMock.MockReportRepository, time.Time) {
+	t.Helper()
+	controller := gomock.NewController(t)
+	uc := mock.NewMockURLUsecase(controller)
+	reports := reportMock.NewMockReportRepository(controller)
+	f, err := usecase.NewSpamFilter(uc, reports, cfg)
+	require.NoError(t, err)
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.SetClock(func() time.Time { return now })
+	return f, uc, reports, now
+}
+
+func TestSpamFilter_Store(t *testing.T) {
+	t.Run("below threshold", func(t *testing.T) {
+		f, uc, _, _ := newTestSpamFilter(t, usecase.SpamConfig{})
+		createURL := domain.CreateURL{Link: "https://bit.ly/abc"}
+		uc.EXPECT().Store(gomock.Any(), createURL).Return(&domain.URL{ID: "test123"}, nil)
+
+		u, err := f.Store(context.Background(), createURL)
+		require.NoError(t, err)
+		assert.Nil(t, u.Flag)
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		f, uc, reports, now := newTestSpamFilter(t, usecase.SpamConfig{Threshold: 40})
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, createURL domain.CreateURL) (*domain.URL, error) {
+			return &domain.URL{ID: "test123", Link: createURL.Link, Flag: createURL.Flag}, nil
+		})
+		reports.EXPECT().Store(gomock.Any(), "test123", domain.ReportComment{
+			Reason:    domain.ReportReasonSpam,
+			Text:      "spam score 40: nested_shortener",
+			CreatedAt: now,
+		}).Return(nil)
+
+		u, err := f.Store(context.Background(), domain.CreateURL{Link: "https://bit.ly/abc"})
+		require.NoError(t, err)
+		assert.Equal(t, &domain.URLFlag{Score: 40, Signals: []string{spam.SignalNestedShortener}, At: now}, u.Flag)
+	})
+
+	t.Run("report error", func(t *testing.T) {
+		f, uc, reports, _ := newTestSpamFilter(t, usecase.SpamConfig{})
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(&domain.URL{ID: "test123"}, nil)
+		reports.EXPECT().Store(gomock.Any(), "test123", gomock.Any()).Return(errors.New("network error"))
+
+		u, err := f.Store(context.Background(), domain.CreateURL{Link: "https://xn--pypal-4ve.com/signin"})
+		require.NoError(t, err)
+		assert.Equal(t, "test123", u.ID)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		f, uc, _, _ := newTestSpamFilter(t, usecase.SpamConfig{})
+		uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil, domain.ErrConflict)
+
+		_, err := f.Store(context.Background(), domain.CreateURL{Link: "https://xn--pypal-4ve.com/signin"})
+		require.ErrorIs(t, err, domain.ErrConflict)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		f, _, _, _ := newTestSpamFilter(t, usecase.SpamConfig{Action: usecase.SpamActionReject})
+
+		_, err := f.Store(context.Background(), domain.CreateURL{Link: "https://xn--pypal-4ve.com/signin"})
+		require.ErrorIs(t, err, domain.ErrSpam)
+		assert.Contains(t, err.Error(), spam.SignalHomograph)
+	})
+
+	t.Run("configured shortener", func(t *testing.T) {
+		f, _, _, _ := newTestSpamFilter(t, usecase.SpamConfig{Action: usecase.SpamActionReject, Threshold: 40, ShortenerDomains: []string{"sho.rt"}})
+
+		_, err := f.Store(context.Background(), domain.CreateURL{Link: "https://sho.rt/abc"})
+		require.ErrorIs(t, err, domain.ErrSpam)
+	})
+}
+
+func TestSpamFilter_Velocity(t *testing.T) {
+	f, uc, _, now := newTestSpamFilter(t, usecase.SpamConfig{Action: usecase.SpamActionReject, Threshold: spam.Weights[spam.SignalVelocity], VelocityWindow: 60})
+	create := func(ip string) error {
+		_, err := f.Store(context.Background(), domain.CreateURL{Link: "https://example.com", Creation: domain.CreationInfo{IP: ip}})
+		return err
+	}
+
+	uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(&domain.URL{}, nil).Times(spam.VelocityLimit + 1)
+	for i := 0; i < spam.VelocityLimit; i++ {
+		require.NoError(t, create("192.0.2.1"))
+	}
+	require.ErrorIs(t, create("192.0.2.1"), domain.ErrSpam)
+	require.NoError(t, create("192.0.2.2"), "other ip")
+
+	// URLs without creator address are never counted
+	uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(&domain.URL{}, nil).Times(spam.VelocityLimit + 1)
+	for i := 0; i <= spam.VelocityLimit; i++ {
+		require.NoError(t, create(""))
+	}
+
+	f.SetClock(func() time.Time { return now.Add(time.Minute) })
+	uc.EXPECT().Store(gomock.Any(), gomock.Any()).Return(&domain.URL{}, nil)
+	require.NoError(t, create("192.0.2.1"), "window passed")
+}
+
+func TestNewSpamFilter_UnknownAction(t *testing.T) {
+	_, err := usecase.NewSpamFilter(nil, nil, usecase.SpamConfig{Action: "drop"})
+	require.Error(t, err)
+}
@@ -2,37 +2,81 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 
 	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/featureflag"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
 )
 
+// DefaultMaxLinkLength is the maximum length of destination link used when
+// LinkConfig.MaxLength is not set
+const DefaultMaxLinkLength = 2048
+
+// LinkConfig stores destination link and custom alias policy
+type LinkConfig struct {
+	// MaxLength is the maximum length of normalized link
+	MaxLength int `yaml:"max_link_length"`
+	// StripFragment removes fragment from links
+	StripFragment bool `yaml:"strip_link_fragment"`
+	// Aliases stores rules of custom aliases
+	Aliases AliasConfig `yaml:"custom_alias"`
+}
+
 type urlUsecase struct {
-	urlRepo        domain.URLRepository
-	contextTimeout time.Duration
-	tracer         trace.Tracer
-	urlExpiration  int
+	urlRepo       domain.URLRepository
+	userRepo      domain.UserRepository
+	timeouts      domain.Timeouts
+	tracer        trace.Tracer
+	urlExpiration int
+	links         LinkConfig
+	blocklist     domain.LinkMatcher
+	idPool        *IDPool
+	flags         featureflag.Flags
+	aliases       domain.AliasRepository
 }
 
-// NewURLUsecase will create new an urlUsecase object representation of url.Usecase interface
-func NewURLUsecase(u domain.URLRepository, timeout time.Duration, tracer trace.Tracer, urlExpiration int) domain.URLUsecase {
+// NewURLUsecase will create new an urlUsecase object representation of url.Usecase interface,
+// blocklist, idPool, flags and aliases may be nil
+func NewURLUsecase(u domain.URLRepository, usr domain.UserRepository, timeouts domain.Timeouts, tracer trace.Tracer, urlExpiration int, links LinkConfig, blocklist domain.LinkMatcher, idPool *IDPool, flags featureflag.Flags, aliases domain.AliasRepository) domain.URLUsecase {
+	if links.MaxLength <= 0 {
+		links.MaxLength = DefaultMaxLinkLength
+	}
+	if links.Aliases.MinLength <= 0 {
+		links.Aliases.MinLength = DefaultAliasMinLength
+	}
+	if flags == nil {
+		flags = featureflag.NewStatic(nil)
+	}
+
 	return &urlUsecase{
-		urlRepo:        u,
-		contextTimeout: timeout,
-		tracer:         tracer,
-		urlExpiration:  urlExpiration,
+		urlRepo:       u,
+		userRepo:      usr,
+		timeouts:      timeouts,
+		tracer:        tracing.Tracer(tracer),
+		urlExpiration: urlExpiration,
+		links:         links,
+		blocklist:     blocklist,
+		idPool:        idPool,
+		flags:         flags,
+		aliases:       aliases,
 	}
 }
 
-func (uc *urlUsecase) GetByID(c context.Context, id string) (*domain.URL, error) {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *urlUsecase) GetByID(c context.Context, id string, fields ...string) (_ *domain.URL, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -43,18 +87,70 @@ func (uc *urlUsecase) GetByID(c context.Context, id string) (*domain.URL, error)
 	)
 	defer span.End()
 
-	u, err := uc.urlRepo.GetByID(ctx, id)
+	u, err := uc.urlRepo.GetByID(ctx, id, fields...)
 	if err != nil {
 		span.RecordError(err)
 		return nil, err
 	}
 
+	if u.BlockedBy != "" {
+		markDisabled(ctx)
+		err = domain.NotFoundError(domain.EntityURL, u.ID, fmt.Sprintf("URL is blocked by %s rule", u.BlockedBy))
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if err = uc.checkOwner(ctx, u); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
 	return u, nil
 }
 
-func (uc *urlUsecase) Update(c context.Context, updateURL domain.UpdateURL, user *auth.Claims) error {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+// checkOwner hides URLs which belong to disabled user, URLs are not hidden
+// while owner can't be read. Owners of redirected URLs are read from cache,
+// see NewCachedUserRepository
+func (uc *urlUsecase) checkOwner(ctx context.Context, u *domain.URL) error {
+	if u.UserID == "" {
+		return nil
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(u.UserID)
+	if err != nil {
+		web.LoggerFromContext(ctx).Warn("url has invalid owner id", zap.String("urlid", u.ID), zap.String("userid", u.UserID))
+		return nil
+	}
+
+	owner, err := uc.userRepo.GetByID(ctx, ownerID)
+	// owner can't be checked during database outage, URL served from cache
+	// keeps redirecting
+	if errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrUnavailable) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if owner.IsDisabled() {
+		markDisabled(ctx)
+		return domain.NewError(domain.ErrNotFound, "URL owner is disabled")
+	}
+
+	return nil
+}
+
+// markDisabled tells redirect observation that URL is hidden, not missing
+func markDisabled(ctx context.Context) {
+	if o := domain.RedirectObservationFromContext(ctx); o != nil {
+		o.Disabled = true
+	}
+}
+
+func (uc *urlUsecase) Update(c context.Context, updateURL domain.UpdateURL, user *auth.Claims) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -63,29 +159,35 @@ func (uc *urlUsecase) Update(c context.Context, updateURL domain.UpdateURL, user
 	)
 	defer span.End()
 
-	u, err := uc.urlRepo.GetByID(ctx, updateURL.ID)
+	// owner is checked against primary, stale URL must not be changed
+	u, err := uc.urlRepo.GetByID(domain.WithReadClass(ctx, domain.ReadForUpdate), updateURL.ID)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("can't get %s user: %w", updateURL.ID, err)
+		return fmt.Errorf("can't get %s URL: %w", updateURL.ID, err)
 	}
 	span.SetAttributes(attribute.String("urlid", updateURL.ID))
 
-	if u.UserID == "" {
-		err = fmt.Errorf("this url was created by unauthorized user: %w", domain.ErrForbidden)
+	if err = checkOwner(u, user); err != nil {
 		span.RecordError(err)
 		return err
 	}
 
-	if !user.HasRole(auth.RoleAdmin) && u.UserID != user.Subject {
-		span.RecordError(domain.ErrForbidden)
-		return domain.ErrForbidden
+	if updateURL.Link != nil {
+		if u.Link, err = uc.normalizeLink(*updateURL.Link); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+	if updateURL.ExpirationDate != nil {
+		u.ExpirationDate = *updateURL.ExpirationDate
 	}
 
-	u.ExpirationDate = updateURL.ExpirationDate
-	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
-
-	err = uc.urlRepo.Update(ctx, u)
+	// fields which are not set must not overwrite concurrent changes
+	updatedAt := touch(u)
+	owner := ownerConstraint(user)
+	err = uc.urlRepo.UpdateIfUnchanged(ctx, u, updatedAt, owner)
 	if err != nil {
+		err = ownedWriteError(err, u.ID, owner)
 		span.RecordError(err)
 		return err
 	}
@@ -93,9 +195,124 @@ func (uc *urlUsecase) Update(c context.Context, updateURL domain.UpdateURL, user
 	return nil
 }
 
-func (uc *urlUsecase) Store(c context.Context, createURL domain.CreateURL) (*domain.URL, error) {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *urlUsecase) Patch(c context.Context, patch domain.PatchURL, user *auth.Claims) (_ *domain.URL, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Patch",
+		trace.WithAttributes(
+			attribute.String("urlid", patch.ID)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// owner and version are checked against primary
+	u, err := uc.urlRepo.GetByID(domain.WithReadClass(ctx, domain.ReadForUpdate), patch.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("can't get %s url: %w", patch.ID, err)
+	}
+
+	if err = checkOwner(u, user); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if patch.Version != "" && patch.Version != u.Version() {
+		err = domain.NewError(domain.ErrConflict, fmt.Sprintf("URL version is %s, not %s", u.Version(), patch.Version)).
+			WithEntity(domain.EntityURL, u.ID).WithField("version")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if patch.Link.Set {
+		if patch.Link.Null {
+			err = domain.NewError(domain.ErrBadParamInput, "link can't be null").WithField("link")
+			span.RecordError(err)
+			return nil, err
+		}
+		if u.Link, err = uc.normalizeLink(patch.Link.Value); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	if patch.ExpirationDate.Set {
+		u.ExpirationDate = patch.ExpirationDate.Value
+		if patch.ExpirationDate.Null {
+			if u.ExpirationDate, err = uc.defaultExpiration(ctx, u.UserID); err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+		}
+	}
+
+	if !patch.Link.Set && !patch.ExpirationDate.Set {
+		return u, nil
+	}
+
+	updatedAt := touch(u)
+	owner := ownerConstraint(user)
+	if err = uc.urlRepo.UpdateIfUnchanged(ctx, u, updatedAt, owner); err != nil {
+		err = ownedWriteError(err, u.ID, owner)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// touch sets update time of URL and returns the previous one. Version of URL
+// changes even when it is updated twice in a millisecond.
+func touch(u *domain.URL) time.Time {
+	updatedAt := u.UpdatedAt
+	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+	if !u.UpdatedAt.After(updatedAt) {
+		u.UpdatedAt = updatedAt.Add(time.Millisecond)
+	}
+	return updatedAt
+}
+
+// checkOwner allows changes of URL to its owner and admins, URLs created
+// anonymously can't be changed
+func checkOwner(u *domain.URL, user *auth.Claims) error {
+	if u.UserID == "" {
+		return domain.NewError(domain.ErrForbidden, "this url was created by unauthorized user")
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && u.UserID != user.Subject {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
+
+// ownerConstraint returns owner changes of user are restricted to, so URL
+// given to another user after checkOwner is not changed. Admins change URLs
+// of any user.
+func ownerConstraint(user *auth.Claims) string {
+	if user.HasRole(auth.RoleAdmin) {
+		return domain.AnyOwner
+	}
+	return user.Subject
+}
+
+// ownedWriteError reports change restricted to URLs of owner which affected
+// no URL, it was deleted or given to another user after it was checked
+func ownedWriteError(err error, id, ownerID string) error {
+	if ownerID != domain.AnyOwner && errors.Is(err, domain.ErrNoAffected) {
+		return domain.NewError(domain.ErrForbidden, "URL was deleted or belongs to another user").WithEntity(domain.EntityURL, id).Wrap(err)
+	}
+	return err
+}
+
+func (uc *urlUsecase) Store(c context.Context, createURL domain.CreateURL) (_ *domain.URL, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -104,29 +321,58 @@ func (uc *urlUsecase) Store(c context.Context, createURL domain.CreateURL) (*dom
 	)
 	defer span.End()
 
-	id, err := uc.getURLToken(ctx, createURL.ID)
+	link, err := uc.normalizeLink(createURL.Link)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if createURL.ID != nil {
+		if err = uc.links.Aliases.checkAlias(*createURL.ID, createURL.UserID); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	id, err := uc.getURLToken(ctx, createURL.ID, createURL.UserID)
 	if err != nil {
 		span.RecordError(err)
 		return nil, fmt.Errorf("can't get %s user: %w", *createURL.ID, err)
 	}
 
 	if createURL.ExpirationDate == nil {
-		expDate := time.Now().AddDate(uc.urlExpiration, 0, 0)
+		expDate, err := uc.defaultExpiration(ctx, createURL.UserID)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
 		createURL.ExpirationDate = &expDate
 	}
 
 	span.SetAttributes(attribute.String("urlid", id))
 
+	if createURL.Creation.Source == "" {
+		createURL.Creation.Source = domain.URLSourceUnknown
+	}
 	u := &domain.URL{
 		ID:             id,
-		Link:           createURL.Link,
+		Link:           link,
 		ExpirationDate: *createURL.ExpirationDate,
 		UserID:         createURL.UserID,
+		Domain:         domain.NormalizeDomain(createURL.Domain),
 		CreatedAt:      time.Now().Truncate(time.Millisecond).UTC(),
 		UpdatedAt:      time.Now().Truncate(time.Millisecond).UTC(),
+		Creation:       createURL.Creation,
+		Flag:           createURL.Flag,
 	}
 
 	err = uc.urlRepo.Store(ctx, u)
+	if errors.Is(err, domain.ErrConflict) && createURL.ID == nil {
+		// generated id was taken after it was checked
+		u.ID = uc.generateURLToken(ctx)
+		span.SetAttributes(attribute.String("urlid", u.ID))
+		err = uc.urlRepo.Store(ctx, u)
+	}
 	if err != nil {
 		span.RecordError(err)
 		return nil, err
@@ -135,9 +381,65 @@ func (uc *urlUsecase) Store(c context.Context, createURL domain.CreateURL) (*dom
 	return u, nil
 }
 
-func (uc *urlUsecase) Delete(c context.Context, id string, user *auth.Claims) error {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+// defaultExpiration returns expiration date of URL created without one, user
+// settings take precedence over configured expiration
+func (uc *urlUsecase) defaultExpiration(ctx context.Context, userID string) (time.Time, error) {
+	now := time.Now()
+	if userID != "" {
+		settings, err := uc.userSettings(ctx, userID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if exp := settings.DefaultExpiration(now); exp != nil {
+			return *exp, nil
+		}
+	}
+
+	return now.AddDate(uc.urlExpiration, 0, 0), nil
+}
+
+// userSettings returns settings of the user, unknown user has no settings
+func (uc *urlUsecase) userSettings(ctx context.Context, userID string) (*domain.UserSettings, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return &domain.UserSettings{}, nil
+	}
+
+	u, err := uc.userRepo.GetByID(ctx, id)
+	if errors.Is(err, domain.ErrNotFound) {
+		return &domain.UserSettings{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get settings of %s user: %w", userID, err)
+	}
+
+	return &u.Settings, nil
+}
+
+// normalizeLink normalizes link and checks it against link policy and blocklist
+func (uc *urlUsecase) normalizeLink(link string) (string, error) {
+	link, err := domain.NormalizeLink(link, uc.links.StripFragment)
+	if err != nil {
+		return "", err
+	}
+
+	if len(link) > uc.links.MaxLength {
+		return "", domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("link is longer than %d characters", uc.links.MaxLength)).WithField("link")
+	}
+
+	if uc.blocklist != nil {
+		if rule := uc.blocklist.Match(link); rule != nil {
+			return "", fmt.Errorf("%w by %s rule", domain.ErrBlocked, rule.Domain)
+		}
+	}
+
+	return link, nil
+}
+
+func (uc *urlUsecase) Delete(c context.Context, id string, user *auth.Claims) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -148,14 +450,15 @@ func (uc *urlUsecase) Delete(c context.Context, id string, user *auth.Claims) er
 	)
 	defer span.End()
 
-	u, err := uc.urlRepo.GetByID(ctx, id)
+	// owner is checked against primary, stale URL must not be deleted
+	u, err := uc.urlRepo.GetByID(domain.WithReadClass(ctx, domain.ReadForUpdate), id)
 	if err != nil {
 		span.RecordError(err)
 		return fmt.Errorf("can't get %s user: %w", id, err)
 	}
 
 	if u.UserID == "" {
-		err = fmt.Errorf("this url was created by unauthorized user: %w", domain.ErrForbidden)
+		err = domain.NewError(domain.ErrForbidden, "this url was created by unauthorized user")
 		span.RecordError(err)
 		return err
 	}
@@ -165,8 +468,10 @@ func (uc *urlUsecase) Delete(c context.Context, id string, user *auth.Claims) er
 		return domain.ErrForbidden
 	}
 
-	err = uc.urlRepo.Delete(ctx, id)
+	owner := ownerConstraint(user)
+	err = uc.urlRepo.Delete(ctx, id, owner)
 	if err != nil {
+		err = ownedWriteError(err, id, owner)
 		span.RecordError(err)
 		return err
 	}
@@ -174,7 +479,133 @@ func (uc *urlUsecase) Delete(c context.Context, id string, user *auth.Claims) er
 	return nil
 }
 
-func (uc *urlUsecase) getURLToken(ctx context.Context, createID *string) (id string, err error) {
+func (uc *urlUsecase) Lookup(c context.Context, ids []string, user *auth.Claims) (_ *domain.URLLookup, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Lookup",
+		trace.WithAttributes(
+			attribute.Int("count", len(ids))),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	unique := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > domain.MaxLookupIDs {
+		err := domain.NewError(domain.ErrBadParamInput, fmt.Sprintf("can't look up more than %d URLs", domain.MaxLookupIDs))
+		span.RecordError(err)
+		return nil, err
+	}
+
+	list, err := uc.urlRepo.GetByIDs(ctx, unique)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	found := make(map[string]*domain.URL, len(list))
+	for _, u := range list {
+		found[u.ID] = u
+	}
+
+	result := &domain.URLLookup{
+		URLs:    make([]*domain.URL, 0, len(list)),
+		Owned:   make([]bool, 0, len(list)),
+		Missing: make([]string, 0),
+	}
+	// owners caches checkOwner results as lookup usually has many URLs of
+	// the same user
+	owners := make(map[string]error)
+	for _, id := range unique {
+		u, ok := found[id]
+		if !ok || u.BlockedBy != "" {
+			result.Missing = append(result.Missing, id)
+			continue
+		}
+
+		ownerErr, checked := owners[u.UserID]
+		if !checked {
+			ownerErr = uc.checkOwner(ctx, u)
+			owners[u.UserID] = ownerErr
+		}
+		if errors.Is(ownerErr, domain.ErrNotFound) {
+			result.Missing = append(result.Missing, id)
+			continue
+		}
+		if ownerErr != nil {
+			span.RecordError(ownerErr)
+			return nil, ownerErr
+		}
+
+		result.URLs = append(result.URLs, u)
+		result.Owned = append(result.Owned, u.OwnedBy(user))
+	}
+
+	return result, nil
+}
+
+func (uc *urlUsecase) Fetch(c context.Context, filter domain.URLFilter) (_ *domain.URLPage, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationScan)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithAttributes(
+			attribute.String("status", filter.Status)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if filter.Limit == 0 {
+		filter.Limit = domain.DefaultURLPageLimit
+	}
+
+	page := &domain.URLPage{URLs: make([]*domain.AdminURL, 0)}
+	if filter.Owner != "" {
+		owner, err := uc.userRepo.GetByEmail(ctx, filter.Owner)
+		if errors.Is(err, domain.ErrNotFound) {
+			return page, nil
+		}
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		filter.OwnerID = owner.ID.Hex()
+	}
+
+	urls, err := uc.urlRepo.Fetch(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, u := range urls {
+		u.Status = u.URL.Status(now)
+		u.CreationInfo = u.URL.Creation
+	}
+	page.URLs = urls
+	if int64(len(urls)) == filter.Limit {
+		page.NextCursor = urls[len(urls)-1].ID
+	}
+
+	return page, nil
+}
+
+// getURLToken returns id of URL created by user, pooled ids are taken when
+// featureflag.IDPool is on for user
+func (uc *urlUsecase) getURLToken(ctx context.Context, createID *string, userID string) (id string, err error) {
 	ctx, span := uc.tracer.Start(
 		ctx,
 		"usecase getURLToken",
@@ -183,24 +614,71 @@ func (uc *urlUsecase) getURLToken(ctx context.Context, createID *string) (id str
 	defer span.End()
 
 	if createID != nil {
-		_, err = uc.GetByID(ctx, *createID)
+		if uc.idPool != nil {
+			uc.idPool.Discard(*createID)
+		}
+
+		_, err = uc.urlRepo.GetByID(ctx, *createID)
 		if err == nil {
 			span.RecordError(err)
-			return "", fmt.Errorf("can't store URL, already exists: %w", domain.ErrConflict)
+			return "", domain.NewError(domain.ErrConflict, "can't store URL, already exists").WithEntity(domain.EntityURL, *createID)
+		}
+
+		// URL would take redirects of renamed URL alias points to
+		isAlias, err := uc.isAlias(ctx, *createID)
+		if err != nil {
+			span.RecordError(err)
+			return "", err
+		}
+		if isAlias {
+			err = domain.NewError(domain.ErrConflict, "can't store URL, id is an alias of another URL").WithEntity(domain.EntityURL, *createID)
+			span.RecordError(err)
+			return "", err
 		}
 
 		return *createID, nil
 	}
 
+	if uc.idPool != nil && uc.flags.EnabledFor(ctx, featureflag.IDPool, userID) {
+		if id, ok := uc.idPool.Take(); ok {
+			return id, nil
+		}
+	}
+
+	return uc.generateURLToken(ctx), nil
+}
+
+// generatedIDLength is the length of generated URL ids
+const generatedIDLength = 6
+
+// generateURLToken generates id that is not taken
+func (uc *urlUsecase) generateURLToken(ctx context.Context) string {
 	for {
 		src := rand.NewSource(time.Now().UnixNano())
-		id = GenerateURLToken(6, src)
+		id := GenerateURLToken(generatedIDLength, src)
 
-		_, err = uc.GetByID(ctx, id)
+		_, err := uc.urlRepo.GetByID(ctx, id)
 		if err != nil {
-			break
+			if isAlias, _ := uc.isAlias(ctx, id); !isAlias {
+				return id
+			}
 		}
+		web.LoggerFromContext(ctx).Debug("generated url id already exists", zap.String("urlid", id))
+	}
+}
+
+// isAlias reports whether id is an alias of renamed URL
+func (uc *urlUsecase) isAlias(ctx context.Context, id string) (bool, error) {
+	if uc.aliases == nil {
+		return false, nil
 	}
 
-	return id, nil
+	_, err := uc.aliases.GetByID(ctx, id)
+	if errors.Is(err, domain.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("can't check %s alias: %w", id, err)
+	}
+	return true, nil
 }
@@ -0,0 +1,144 @@
+package usecase_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+// BenchmarkURLUsecase_Store measures URL creation with in-memory repositories.
+// Generated ids are dominated by seeding math/rand source on every attempt and
+// are expected to take ~10-20µs/op, custom ids ~2-5µs/op.
+func BenchmarkURLUsecase_Store(b *testing.B) {
+	b.Run("generated id", func(b *testing.B) {
+		uc := usecase.NewURLUsecase(tests.NewMemoryURLRepository(), tests.NewMemoryUserRepository(), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+		createURL := domain.CreateURL{Link: "https://www.example.org"}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := uc.Store(context.Background(), createURL); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("custom id", func(b *testing.B) {
+		uc := usecase.NewURLUsecase(tests.NewMemoryURLRepository(), tests.NewMemoryUserRepository(), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+		ids := make([]string, b.N)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("custom%08d", i)
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			createURL := domain.CreateURL{ID: &ids[i], Link: "https://www.example.org"}
+			if _, err := uc.Store(context.Background(), createURL); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkURLUsecase_GetByID measures the usecase part of the redirect path,
+// including owner lookup. Expected ~2-4µs/op and ~15 allocs/op.
+func BenchmarkURLUsecase_GetByID(b *testing.B) {
+	urlRepo := tests.NewMemoryURLRepository()
+	userRepo := tests.NewMemoryUserRepository()
+	tURL := tests.NewURL()
+	tUser := tests.NewUser()
+	if err := urlRepo.Store(context.Background(), tURL); err != nil {
+		b.Fatal(err)
+	}
+	if err := userRepo.Create(context.Background(), tUser); err != nil {
+		b.Fatal(err)
+	}
+	uc := usecase.NewURLUsecase(urlRepo, userRepo, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := uc.GetByID(context.Background(), tURL.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// latencyURLRepository adds database round trip to URL lookups and inserts
+type latencyURLRepository struct {
+	*tests.MemoryURLRepository
+	latency time.Duration
+}
+
+func (r *latencyURLRepository) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	time.Sleep(r.latency)
+	return r.MemoryURLRepository.GetByID(ctx, id, fields...)
+}
+
+func (r *latencyURLRepository) Store(ctx context.Context, u *domain.URL) error {
+	time.Sleep(r.latency)
+	return r.MemoryURLRepository.Store(ctx, u)
+}
+
+// BenchmarkURLUsecase_StoreParallel measures URL creation with generated ids
+// under parallel load with 500µs repository round trips and reports p99
+// latency. Without pool every Store makes two round trips, with pool that
+// keeps up only one, so p99 is expected to roughly halve.
+func BenchmarkURLUsecase_StoreParallel(b *testing.B) {
+	const latency = 500 * time.Microsecond
+
+	run := func(b *testing.B, uc domain.URLUsecase) {
+		var mu sync.Mutex
+		durations := make([]time.Duration, 0, b.N)
+		createURL := domain.CreateURL{Link: "https://www.example.org"}
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			local := make([]time.Duration, 0, 64)
+			for pb.Next() {
+				start := time.Now()
+				if _, err := uc.Store(context.Background(), createURL); err != nil {
+					b.Error(err)
+					return
+				}
+				local = append(local, time.Since(start))
+			}
+			mu.Lock()
+			durations = append(durations, local...)
+			mu.Unlock()
+		})
+		b.StopTimer()
+
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		if len(durations) > 0 {
+			b.ReportMetric(float64(durations[len(durations)*99/100].Microseconds()), "p99-µs")
+		}
+	}
+
+	b.Run("inline", func(b *testing.B) {
+		repo := &latencyURLRepository{MemoryURLRepository: tests.NewMemoryURLRepository(), latency: latency}
+		run(b, usecase.NewURLUsecase(repo, tests.NewMemoryUserRepository(), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil))
+	})
+
+	b.Run("pool", func(b *testing.B) {
+		repo := &latencyURLRepository{MemoryURLRepository: tests.NewMemoryURLRepository(), latency: latency}
+		// pool is checked without latency as it stands for pool backed by
+		// bloom filter, which rarely reaches database
+		pool := usecase.NewIDPool(repo.MemoryURLRepository, 1024, 10*time.Second, zap.NewNop())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go pool.Run(ctx)
+
+		run(b, usecase.NewURLUsecase(repo, tests.NewMemoryUserRepository(), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, pool, nil, nil))
+	})
+}
@@ -2,7 +2,9 @@ package usecase_test
 
 import (
 	"context"
+	"fmt"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,38 +12,116 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
+	aliasmock "github.com/semka95/shortener/backend/alias/mock"
+	blocklistmock "github.com/semka95/shortener/backend/blocklist/mock"
 	"github.com/semka95/shortener/backend/domain"
 	"github.com/semka95/shortener/backend/tests"
 	"github.com/semka95/shortener/backend/url/mock"
 	"github.com/semka95/shortener/backend/url/usecase"
+	usermock "github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
 )
 
 var tracer = sdktrace.NewTracerProvider().Tracer("")
 
+// readClass matches context of read class
+type readClass domain.ReadClass
+
+func (rc readClass) Matches(x interface{}) bool {
+	ctx, ok := x.(context.Context)
+	return ok && domain.ReadClassFromContext(ctx) == domain.ReadClass(rc)
+}
+
+func (rc readClass) String() string {
+	return fmt.Sprintf("context of read class %d", rc)
+}
+
 func TestURLUsecase_GetByID(t *testing.T) {
 	controller := gomock.NewController(t)
 	defer controller.Finish()
 
 	tURL := tests.NewURL()
+	tUser := tests.NewUser()
 
 	repository := mock.NewMockURLRepository(controller)
-	uc := usecase.NewURLUsecase(repository, 10*time.Second, tracer, 1)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
 
 	t.Run("url not found", func(t *testing.T) {
 		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(nil, domain.ErrNotFound)
-		result, err := uc.GetByID(context.Background(), tURL.ID)
+		observation := &domain.RedirectObservation{}
+		result, err := uc.GetByID(domain.WithRedirectObservation(context.Background(), observation), tURL.ID)
 		assert.Error(t, err, domain.ErrNotFound)
 		assert.Nil(t, result)
+		assert.False(t, observation.Disabled)
 	})
 
 	t.Run("success", func(t *testing.T) {
 		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		result, err := uc.GetByID(context.Background(), tURL.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, tURL, result)
+	})
+
+	t.Run("owner not found", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+		result, err := uc.GetByID(context.Background(), tURL.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, tURL, result)
+	})
+
+	t.Run("owner unavailable", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, fmt.Errorf("circuit breaker is open: %w", domain.ErrUnavailable))
 		result, err := uc.GetByID(context.Background(), tURL.ID)
 		require.NoError(t, err)
 		assert.EqualValues(t, tURL, result)
 	})
+
+	t.Run("owner disabled", func(t *testing.T) {
+		disabled := tests.NewUser()
+		disabled.DisabledAt = tests.DatePointer(time.Now())
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(disabled, nil)
+		observation := &domain.RedirectObservation{}
+		result, err := uc.GetByID(domain.WithRedirectObservation(context.Background(), observation), tURL.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, result)
+		assert.True(t, observation.Disabled)
+	})
+
+	t.Run("anonymous url", func(t *testing.T) {
+		anonURL := tests.NewURL()
+		anonURL.UserID = ""
+		repository.EXPECT().GetByID(gomock.Any(), anonURL.ID).Return(anonURL, nil)
+		result, err := uc.GetByID(context.Background(), anonURL.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, anonURL, result)
+	})
+
+	t.Run("invalid owner id is logged with request logger", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		ctx := web.WithLogger(context.Background(), zap.New(core).With(zap.String("request_id", "test-request")))
+		badURL := tests.NewURL()
+		badURL.UserID = "not an object id"
+		repository.EXPECT().GetByID(gomock.Any(), badURL.ID).Return(badURL, nil)
+
+		result, err := uc.GetByID(ctx, badURL.ID)
+		require.NoError(t, err)
+		assert.EqualValues(t, badURL, result)
+
+		require.Equal(t, 1, logs.Len())
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, "test-request", fields["request_id"])
+		assert.Equal(t, badURL.UserID, fields["userid"])
+	})
 }
 
 func TestURLUsecase_Store(t *testing.T) {
@@ -51,10 +131,12 @@ func TestURLUsecase_Store(t *testing.T) {
 	tCreateURL := tests.NewCreateURL()
 
 	repository := mock.NewMockURLRepository(controller)
-	uc := usecase.NewURLUsecase(repository, 10*time.Second, tracer, 1)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
 
 	t.Run("success empty url ID", func(t *testing.T) {
 		tCreateURL.ID = nil
+		tCreateURL.Creation = domain.CreationInfo{IP: "203.0.113.0", UserAgent: "curl/8.0", Source: domain.URLSourceAPI}
 
 		repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound)
 		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
@@ -65,6 +147,7 @@ func TestURLUsecase_Store(t *testing.T) {
 		assert.Regexp(t, regexp.MustCompile(`^[a-zA-Z0-9-_]{6}$`), result.ID)
 		assert.Equal(t, tCreateURL.Link, result.Link)
 		assert.Equal(t, *tCreateURL.ExpirationDate, result.ExpirationDate)
+		assert.Equal(t, tCreateURL.Creation, result.Creation)
 	})
 
 	t.Run("success filled url ID", func(t *testing.T) {
@@ -72,13 +155,17 @@ func TestURLUsecase_Store(t *testing.T) {
 
 		repository.EXPECT().GetByID(gomock.Any(), *tCreateURL.ID).Return(nil, domain.ErrNotFound)
 		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+		// source is set by handlers, URL created without it has unknown one
+		create := tCreateURL
+		create.Creation = domain.CreationInfo{}
 
-		result, err := uc.Store(context.Background(), tCreateURL)
+		result, err := uc.Store(context.Background(), create)
 		require.NoError(t, err)
 
 		assert.Equal(t, *tCreateURL.ID, result.ID)
 		assert.Equal(t, tCreateURL.Link, result.Link)
 		assert.Equal(t, *tCreateURL.ExpirationDate, result.ExpirationDate)
+		assert.Equal(t, domain.URLSourceUnknown, result.Creation.Source)
 	})
 
 	t.Run("url already exists", func(t *testing.T) {
@@ -102,6 +189,344 @@ func TestURLUsecase_Store(t *testing.T) {
 	})
 }
 
+func TestURLUsecase_StoreAliasTaken(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tCreateURL := tests.NewCreateURL()
+	repository := mock.NewMockURLRepository(controller)
+	aliases := aliasmock.NewMockAliasRepository(controller)
+	uc := usecase.NewURLUsecase(repository, usermock.NewMockUserRepository(controller), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, aliases)
+
+	t.Run("custom id is an alias", func(t *testing.T) {
+		tCreateURL.ID = tests.StringPointer("oldcode")
+		repository.EXPECT().GetByID(gomock.Any(), "oldcode").Return(nil, domain.ErrNotFound)
+		aliases.EXPECT().GetByID(gomock.Any(), "oldcode").Return(&domain.Alias{ID: "oldcode", URLID: "test123"}, nil)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, result)
+	})
+
+	t.Run("alias check error", func(t *testing.T) {
+		tCreateURL.ID = tests.StringPointer("oldcode")
+		repository.EXPECT().GetByID(gomock.Any(), "oldcode").Return(nil, domain.ErrNotFound)
+		aliases.EXPECT().GetByID(gomock.Any(), "oldcode").Return(nil, domain.ErrInternalServerError)
+
+		_, err := uc.Store(context.Background(), tCreateURL)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+
+	t.Run("generated id skips aliases", func(t *testing.T) {
+		tCreateURL.ID = nil
+		repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound).Times(2)
+		gomock.InOrder(
+			aliases.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(&domain.Alias{}, nil),
+			aliases.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound),
+		)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		_, err := uc.Store(context.Background(), tCreateURL)
+		require.NoError(t, err)
+	})
+}
+
+func TestURLUsecase_StoreUserDefaults(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockURLRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+
+	tUser := tests.NewUser()
+	tUser.Settings.DefaultExpirationDays = 90
+
+	t.Run("default expiration of user", func(t *testing.T) {
+		tCreateURL := tests.NewCreateURL()
+		tCreateURL.ExpirationDate = nil
+		tCreateURL.UserID = tUser.ID.Hex()
+
+		repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), result.ExpirationDate, time.Minute)
+	})
+
+	t.Run("explicit expiration wins", func(t *testing.T) {
+		tCreateURL := tests.NewCreateURL()
+		tCreateURL.UserID = tUser.ID.Hex()
+
+		repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		require.NoError(t, err)
+		assert.Equal(t, *tCreateURL.ExpirationDate, result.ExpirationDate)
+	})
+
+	t.Run("user without settings", func(t *testing.T) {
+		tCreateURL := tests.NewCreateURL()
+		tCreateURL.ExpirationDate = nil
+		tCreateURL.UserID = tUser.ID.Hex()
+
+		repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tests.NewUser(), nil)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().AddDate(1, 0, 0), result.ExpirationDate, time.Minute)
+	})
+
+	t.Run("user repository error", func(t *testing.T) {
+		tCreateURL := tests.NewCreateURL()
+		tCreateURL.ExpirationDate = nil
+		tCreateURL.UserID = tUser.ID.Hex()
+
+		repository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(nil, domain.ErrNotFound)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrInternalServerError)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+	})
+}
+
+func TestURLUsecase_StoreNormalizesLink(t *testing.T) {
+	cases := []struct {
+		description string
+		links       usecase.LinkConfig
+		link        string
+		want        string
+		err         bool
+	}{
+		{"link is kept as is", usecase.LinkConfig{}, "https://www.example.org/Path?q=A#Frag", "https://www.example.org/Path?q=A#Frag", false},
+		{"whitespace is trimmed", usecase.LinkConfig{}, " \thttps://www.example.org/path\n ", "https://www.example.org/path", false},
+		{"host and scheme are lowercased", usecase.LinkConfig{}, "HTTP://WWW.Example.ORG:8080/UPPER", "http://www.example.org:8080/UPPER", false},
+		{"https is added to host", usecase.LinkConfig{}, "www.example.org/path?q=1", "https://www.example.org/path?q=1", false},
+		{"https is added to host with port", usecase.LinkConfig{}, "example.org:8080", "https://example.org:8080", false},
+		{"https is added to localhost", usecase.LinkConfig{}, "localhost/path", "https://localhost/path", false},
+		{"https is added to ip address", usecase.LinkConfig{}, "127.0.0.1/path", "https://127.0.0.1/path", false},
+		{"fragment is stripped by config", usecase.LinkConfig{StripFragment: true}, "https://www.example.org/path#frag", "https://www.example.org/path", false},
+		{"space in query is escaped", usecase.LinkConfig{}, "https://www.example.org/?q=a b", "https://www.example.org/?q=a%20b", false},
+		{"word without scheme is rejected", usecase.LinkConfig{}, "example", "", true},
+		{"not http scheme is rejected", usecase.LinkConfig{}, "ftp://www.example.org", "", true},
+		{"javascript is rejected", usecase.LinkConfig{}, "javascript:alert(1)", "", true},
+		{"link without host is rejected", usecase.LinkConfig{}, "https:///path", "", true},
+		{"link over default length is rejected", usecase.LinkConfig{}, "https://www.example.org/" + strings.Repeat("a", 2048), "", true},
+		{"link over configured length is rejected", usecase.LinkConfig{MaxLength: 30}, "https://www.example.org/abcdefgh", "", true},
+		{"link of configured length is allowed", usecase.LinkConfig{MaxLength: 30}, "https://www.example.org/abcdef", "https://www.example.org/abcdef", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			controller := gomock.NewController(t)
+			defer controller.Finish()
+			repository := mock.NewMockURLRepository(controller)
+			uc := usecase.NewURLUsecase(repository, usermock.NewMockUserRepository(controller), domain.NewTimeouts(10*time.Second), tracer, 1, tc.links, nil, nil, nil, nil)
+
+			tCreateURL := tests.NewCreateURL()
+			tCreateURL.Link = tc.link
+
+			if tc.err {
+				result, err := uc.Store(context.Background(), tCreateURL)
+				assert.ErrorIs(t, err, domain.ErrBadParamInput)
+				assert.Nil(t, result)
+				return
+			}
+
+			repository.EXPECT().GetByID(gomock.Any(), *tCreateURL.ID).Return(nil, domain.ErrNotFound)
+			repository.EXPECT().Store(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u *domain.URL) error {
+				assert.Equal(t, tc.want, u.Link)
+				return nil
+			})
+
+			result, err := uc.Store(context.Background(), tCreateURL)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, result.Link)
+		})
+	}
+}
+
+func TestURLUsecase_StoreAliasRules(t *testing.T) {
+	cases := []struct {
+		description string
+		aliases     usecase.AliasConfig
+		alias       string
+		userID      string
+		rule        string
+	}{
+		{"alias of default min length is allowed", usecase.AliasConfig{}, "docs", "", ""},
+		{"alias under default min length is rejected", usecase.AliasConfig{}, "doc", "", usecase.AliasRuleMinLength},
+		{"one character alias is rejected", usecase.AliasConfig{}, "l", "", usecase.AliasRuleMinLength},
+		{"alias under configured min length is rejected", usecase.AliasConfig{MinLength: 8}, "release", "", usecase.AliasRuleMinLength},
+		{"alias of configured min length is allowed", usecase.AliasConfig{MinLength: 8}, "releases", "", ""},
+		{"alias of generated length is rejected", usecase.AliasConfig{}, "aB3-x_", "", usecase.AliasRuleGeneratedSpace},
+		{"alias shorter than generated length is allowed", usecase.AliasConfig{}, "aB3-x", "", ""},
+		{"alias longer than generated length is allowed", usecase.AliasConfig{}, "aB3-x_7", "", ""},
+		{"leading hyphen is rejected", usecase.AliasConfig{}, "-summer", "", usecase.AliasRuleEdgeSeparator},
+		{"trailing hyphen is rejected", usecase.AliasConfig{}, "summer-", "", usecase.AliasRuleEdgeSeparator},
+		{"leading underscore is rejected", usecase.AliasConfig{}, "_summer", "", usecase.AliasRuleEdgeSeparator},
+		{"trailing underscore is rejected", usecase.AliasConfig{}, "summer_", "", usecase.AliasRuleEdgeSeparator},
+		{"inner separators are allowed", usecase.AliasConfig{}, "summer-sale_23", "", ""},
+		{"anonymous alias is rejected when authentication is required", usecase.AliasConfig{RequireAuth: true}, "summer-sale", "", usecase.AliasRuleAuthenticated},
+		{"user alias is allowed when authentication is required", usecase.AliasConfig{RequireAuth: true}, "summer-sale", "507f191e810c19729de860ea", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			controller := gomock.NewController(t)
+			defer controller.Finish()
+			repository := mock.NewMockURLRepository(controller)
+			uc := usecase.NewURLUsecase(repository, usermock.NewMockUserRepository(controller), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{Aliases: tc.aliases}, nil, nil, nil, nil)
+
+			tCreateURL := tests.NewCreateURL()
+			tCreateURL.ID = &tc.alias
+			tCreateURL.UserID = tc.userID
+
+			if tc.rule != "" {
+				result, err := uc.Store(context.Background(), tCreateURL)
+				require.ErrorIs(t, err, domain.ErrBadParamInput)
+				assert.Nil(t, result)
+				re := domain.NewResponseError(err)
+				assert.Contains(t, re.Fields["id"], tc.rule)
+				return
+			}
+
+			repository.EXPECT().GetByID(gomock.Any(), tc.alias).Return(nil, domain.ErrNotFound)
+			repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+			result, err := uc.Store(context.Background(), tCreateURL)
+			require.NoError(t, err)
+			assert.Equal(t, tc.alias, result.ID)
+		})
+	}
+}
+
+func TestURLUsecase_Blocklist(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockURLRepository(controller)
+	blocklist := blocklistmock.NewMockLinkMatcher(controller)
+	uc := usecase.NewURLUsecase(repository, usermock.NewMockUserRepository(controller), domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, blocklist, nil, nil, nil)
+	rule := &domain.BlockedDomain{Domain: "*.example.org"}
+
+	t.Run("blocked link is rejected", func(t *testing.T) {
+		tCreateURL := tests.NewCreateURL()
+		tCreateURL.Link = "WWW.Example.org/path"
+		blocklist.EXPECT().Match("https://www.example.org/path").Return(rule)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		assert.ErrorIs(t, err, domain.ErrBlocked)
+		assert.Contains(t, err.Error(), rule.Domain)
+		assert.Nil(t, result)
+	})
+
+	t.Run("not blocked link is stored", func(t *testing.T) {
+		tCreateURL := tests.NewCreateURL()
+		blocklist.EXPECT().Match(tCreateURL.Link).Return(nil)
+		repository.EXPECT().GetByID(gomock.Any(), *tCreateURL.ID).Return(nil, domain.ErrNotFound)
+		repository.EXPECT().Store(gomock.Any(), gomock.Any()).Return(nil)
+
+		result, err := uc.Store(context.Background(), tCreateURL)
+		require.NoError(t, err)
+		assert.Equal(t, tCreateURL.Link, result.Link)
+	})
+
+	t.Run("blocked url is not found", func(t *testing.T) {
+		tURL := tests.NewURL()
+		tURL.BlockedBy = rule.Domain
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		observation := &domain.RedirectObservation{}
+		result, err := uc.GetByID(domain.WithRedirectObservation(context.Background(), observation), tURL.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, result)
+		assert.True(t, observation.Disabled)
+	})
+}
+
+func TestURLUsecase_Lookup(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	owned := tests.NewURL()
+	owned.ID = "owned01"
+	other := tests.NewURL()
+	other.ID = "other01"
+	other.UserID = "507f191e810c19729de860eb"
+	blocked := tests.NewURL()
+	blocked.ID = "blocked"
+	blocked.BlockedBy = "*.example.org"
+
+	repository := mock.NewMockURLRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+	claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+	ids := []string{"other01", "missing", "owned01", "blocked", "other01"}
+	unique := []string{"other01", "missing", "owned01", "blocked"}
+
+	expectFound := func() {
+		repository.EXPECT().GetByIDs(gomock.Any(), unique).Return([]*domain.URL{blocked, owned, other}, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), gomock.Not(tUser.ID)).Return(nil, domain.ErrNotFound)
+	}
+
+	t.Run("owner", func(t *testing.T) {
+		expectFound()
+		result, err := uc.Lookup(context.Background(), ids, claims)
+		require.NoError(t, err)
+		assert.Equal(t, &domain.URLLookup{
+			URLs:    []*domain.URL{other, owned},
+			Owned:   []bool{false, true},
+			Missing: []string{"missing", "blocked"},
+		}, result)
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		expectFound()
+		result, err := uc.Lookup(context.Background(), ids, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []*domain.URL{other, owned}, result.URLs)
+		assert.Equal(t, []bool{false, false}, result.Owned)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		expectFound()
+		admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Minute)
+		result, err := uc.Lookup(context.Background(), ids, admin)
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, true}, result.Owned)
+	})
+
+	t.Run("disabled owner", func(t *testing.T) {
+		disabled := tests.NewUser()
+		disabled.DisabledAt = tests.DatePointer(time.Now())
+		second := tests.NewURL()
+		second.ID = "owned02"
+		repository.EXPECT().GetByIDs(gomock.Any(), []string{owned.ID, second.ID}).Return([]*domain.URL{owned, second}, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(disabled, nil).Times(1)
+
+		result, err := uc.Lookup(context.Background(), []string{owned.ID, second.ID}, claims)
+		require.NoError(t, err)
+		assert.Empty(t, result.URLs)
+		assert.Equal(t, []string{owned.ID, second.ID}, result.Missing)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository.EXPECT().GetByIDs(gomock.Any(), []string{owned.ID}).Return(nil, domain.ErrInternalServerError)
+		result, err := uc.Lookup(context.Background(), []string{owned.ID}, claims)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+	})
+}
+
 func TestURLUsecase_Update(t *testing.T) {
 	controller := gomock.NewController(t)
 	defer controller.Finish()
@@ -110,17 +535,26 @@ func TestURLUsecase_Update(t *testing.T) {
 	tURL := tests.NewURL()
 
 	repository := mock.NewMockURLRepository(controller)
-	uc := usecase.NewURLUsecase(repository, 10*time.Second, tracer, 1)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
 	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
 
 	t.Run("success", func(t *testing.T) {
-		repository.EXPECT().GetByID(gomock.Any(), tUpdateURL.ID).Return(tURL, nil)
-		repository.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+		repository.EXPECT().GetByID(readClass(domain.ReadForUpdate), tUpdateURL.ID).Return(tURL, nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), claims.Subject).Return(nil)
 
 		err := uc.Update(context.Background(), tUpdateURL, claims)
 		require.NoError(t, err)
 	})
 
+	t.Run("url given to another user meanwhile", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUpdateURL.ID).Return(tURL, nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), claims.Subject).Return(domain.ErrNoAffected)
+
+		err := uc.Update(context.Background(), tUpdateURL, claims)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+	})
+
 	t.Run("url not found", func(t *testing.T) {
 		repository.EXPECT().GetByID(gomock.Any(), tUpdateURL.ID).Return(nil, domain.ErrNotFound)
 
@@ -139,7 +573,7 @@ func TestURLUsecase_Update(t *testing.T) {
 	t.Run("success by wrong user, but with admin role", func(t *testing.T) {
 		claims.Roles = append(claims.Roles, auth.RoleAdmin)
 		repository.EXPECT().GetByID(gomock.Any(), tUpdateURL.ID).Return(tURL, nil)
-		repository.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), gomock.Any(), gomock.Any(), domain.AnyOwner).Return(nil)
 
 		err := uc.Update(context.Background(), tUpdateURL, claims)
 		require.NoError(t, err)
@@ -152,6 +586,170 @@ func TestURLUsecase_Update(t *testing.T) {
 		err := uc.Update(context.Background(), tUpdateURL, claims)
 		assert.Error(t, domain.ErrForbidden, err)
 	})
+
+	t.Run("link only", func(t *testing.T) {
+		u := tests.NewURL()
+		expiration := u.ExpirationDate
+		repository.EXPECT().GetByID(gomock.Any(), u.ID).Return(u, nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), u, gomock.Any(), domain.AnyOwner).Return(nil)
+
+		err := uc.Update(context.Background(), domain.UpdateURL{ID: u.ID, Link: tests.StringPointer("example.com/new")}, claims)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/new", u.Link)
+		assert.Equal(t, expiration, u.ExpirationDate)
+	})
+}
+
+// concurrentLinkEdit changes link of URL right after it is read, as if other
+// request changed it meanwhile
+type concurrentLinkEdit struct {
+	*tests.MemoryURLRepository
+	link string
+}
+
+func (r *concurrentLinkEdit) GetByID(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+	u, err := r.MemoryURLRepository.GetByID(ctx, id, fields...)
+	if err != nil {
+		return nil, err
+	}
+	edited := *u
+	edited.Link = r.link
+	edited.UpdatedAt = u.UpdatedAt.Add(time.Millisecond)
+	return u, r.MemoryURLRepository.Update(ctx, &edited, domain.AnyOwner)
+}
+
+func TestURLUsecase_UpdateExpirationKeepsConcurrentLink(t *testing.T) {
+	repository := &concurrentLinkEdit{MemoryURLRepository: tests.NewMemoryURLRepository(), link: "https://example.com/new"}
+	uc := usecase.NewURLUsecase(repository, nil, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	tURL := tests.NewURL()
+	require.NoError(t, repository.Store(context.Background(), tURL))
+
+	err := uc.Update(context.Background(), domain.UpdateURL{ID: tURL.ID, ExpirationDate: tests.DatePointer(tURL.ExpirationDate.Add(time.Hour))}, claims)
+	assert.ErrorIs(t, err, domain.ErrConflict)
+
+	stored, err := repository.MemoryURLRepository.GetByID(context.Background(), tURL.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/new", stored.Link)
+	assert.Equal(t, tURL.ExpirationDate, stored.ExpirationDate)
+}
+
+func TestURLUsecase_Patch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockURLRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	t.Run("absent fields are left as is", func(t *testing.T) {
+		tURL := tests.NewURL()
+		expiration := tURL.ExpirationDate
+		updatedAt := tURL.UpdatedAt
+		patch := domain.PatchURL{ID: tURL.ID, Link: domain.Optional[string]{Set: true, Value: "https://example.com/new"}}
+
+		repository.EXPECT().GetByID(readClass(domain.ReadForUpdate), tURL.ID).Return(tURL, nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), tURL, updatedAt, claims.Subject).Return(nil)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/new", result.Link)
+		assert.Equal(t, expiration, result.ExpirationDate)
+		assert.True(t, result.UpdatedAt.After(updatedAt))
+		assert.NotEqual(t, patch.Version, result.Version())
+	})
+
+	t.Run("null expiration date resets it to default", func(t *testing.T) {
+		tURL := tests.NewURL()
+		link := tURL.Link
+		patch := domain.PatchURL{ID: tURL.ID, ExpirationDate: domain.Optional[time.Time]{Set: true, Null: true}}
+
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		userRepository.EXPECT().GetByID(gomock.Any(), gomock.Any()).Return(tests.NewUser(), nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), tURL, gomock.Any(), claims.Subject).Return(nil)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		require.NoError(t, err)
+		assert.Equal(t, link, result.Link)
+		assert.WithinDuration(t, time.Now().AddDate(1, 0, 0), result.ExpirationDate, time.Minute)
+	})
+
+	t.Run("empty patch", func(t *testing.T) {
+		tURL := tests.NewURL()
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		result, err := uc.Patch(context.Background(), domain.PatchURL{ID: tURL.ID}, claims)
+		require.NoError(t, err)
+		assert.Equal(t, tests.NewURL().Link, result.Link)
+	})
+
+	t.Run("matching version", func(t *testing.T) {
+		tURL := tests.NewURL()
+		patch := domain.PatchURL{ID: tURL.ID, Link: domain.Optional[string]{Set: true, Value: "example.com"}, Version: tURL.Version()}
+
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), tURL, gomock.Any(), claims.Subject).Return(nil)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", result.Link)
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		tURL := tests.NewURL()
+		patch := domain.PatchURL{ID: tURL.ID, Link: domain.Optional[string]{Set: true, Value: "example.com"}, Version: "1"}
+
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, result)
+	})
+
+	t.Run("concurrent update", func(t *testing.T) {
+		tURL := tests.NewURL()
+		patch := domain.PatchURL{ID: tURL.ID, Link: domain.Optional[string]{Set: true, Value: "example.com"}}
+
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		repository.EXPECT().UpdateIfUnchanged(gomock.Any(), tURL, gomock.Any(), claims.Subject).Return(domain.ErrConflict)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, result)
+	})
+
+	t.Run("null link", func(t *testing.T) {
+		tURL := tests.NewURL()
+		patch := domain.PatchURL{ID: tURL.ID, Link: domain.Optional[string]{Set: true, Null: true}}
+
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, result)
+	})
+
+	t.Run("user not authorized", func(t *testing.T) {
+		tURL := tests.NewURL()
+		tURL.UserID = "507f191e810c19729de860eb"
+		patch := domain.PatchURL{ID: tURL.ID, Link: domain.Optional[string]{Set: true, Value: "example.com"}}
+
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+
+		result, err := uc.Patch(context.Background(), patch, claims)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("url not found", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), "test123").Return(nil, domain.ErrNotFound)
+
+		result, err := uc.Patch(context.Background(), domain.PatchURL{ID: "test123"}, claims)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, result)
+	})
 }
 
 func TestURLUsecase_Delete(t *testing.T) {
@@ -161,16 +759,25 @@ func TestURLUsecase_Delete(t *testing.T) {
 	tURL := tests.NewURL()
 
 	repository := mock.NewMockURLRepository(controller)
-	uc := usecase.NewURLUsecase(repository, 10*time.Second, tracer, 1)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
 	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
 
 	t.Run("success", func(t *testing.T) {
-		repository.EXPECT().Delete(gomock.Any(), tURL.ID).Return(nil)
-		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		repository.EXPECT().Delete(gomock.Any(), tURL.ID, claims.Subject).Return(nil)
+		repository.EXPECT().GetByID(readClass(domain.ReadForUpdate), tURL.ID).Return(tURL, nil)
 		err := uc.Delete(context.Background(), tURL.ID, claims)
 		require.NoError(t, err)
 	})
 
+	t.Run("url given to another user meanwhile", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
+		repository.EXPECT().Delete(gomock.Any(), tURL.ID, claims.Subject).Return(domain.ErrNoAffected)
+
+		err := uc.Delete(context.Background(), tURL.ID, claims)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+	})
+
 	t.Run("url not found", func(t *testing.T) {
 		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(nil, domain.ErrNotFound)
 		err := uc.Delete(context.Background(), tURL.ID, claims)
@@ -188,7 +795,7 @@ func TestURLUsecase_Delete(t *testing.T) {
 	t.Run("success by wrong user, but with admin role", func(t *testing.T) {
 		claims.Roles = append(claims.Roles, auth.RoleAdmin)
 		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).Return(tURL, nil)
-		repository.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+		repository.EXPECT().Delete(gomock.Any(), gomock.Any(), domain.AnyOwner).Return(nil)
 
 		err := uc.Delete(context.Background(), tURL.ID, claims)
 		require.NoError(t, err)
@@ -202,3 +809,135 @@ func TestURLUsecase_Delete(t *testing.T) {
 		assert.Error(t, domain.ErrForbidden, err)
 	})
 }
+
+func TestURLUsecase_Fetch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	repository := mock.NewMockURLRepository(controller)
+	userRepository := usermock.NewMockUserRepository(controller)
+	uc := usecase.NewURLUsecase(repository, userRepository, domain.NewTimeouts(10*time.Second), tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+
+	active := tests.NewURL()
+	active.Creation = domain.CreationInfo{IP: "203.0.113.0"}
+	expired := tests.NewURL()
+	expired.ID = "test456"
+	expired.ExpirationDate = time.Now().Add(-time.Hour)
+
+	t.Run("default limit", func(t *testing.T) {
+		urls := []*domain.AdminURL{{URL: *active}, {URL: *expired}}
+		repository.EXPECT().Fetch(gomock.Any(), domain.URLFilter{Limit: domain.DefaultURLPageLimit}).Return(urls, nil)
+
+		page, err := uc.Fetch(context.Background(), domain.URLFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, urls, page.URLs)
+		assert.Equal(t, domain.URLStatusActive, page.URLs[0].Status)
+		assert.Equal(t, domain.URLStatusExpired, page.URLs[1].Status)
+		assert.Equal(t, active.Creation, page.URLs[0].CreationInfo)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("full page has next cursor", func(t *testing.T) {
+		urls := []*domain.AdminURL{{URL: *active}, {URL: *expired}}
+		repository.EXPECT().Fetch(gomock.Any(), domain.URLFilter{Limit: 2}).Return(urls, nil)
+
+		page, err := uc.Fetch(context.Background(), domain.URLFilter{Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, expired.ID, page.NextCursor)
+	})
+
+	t.Run("owner is resolved by email", func(t *testing.T) {
+		userRepository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		repository.EXPECT().Fetch(gomock.Any(), domain.URLFilter{Owner: tUser.Email, OwnerID: tUser.ID.Hex(), Limit: domain.DefaultURLPageLimit}).Return([]*domain.AdminURL{}, nil)
+
+		page, err := uc.Fetch(context.Background(), domain.URLFilter{Owner: tUser.Email})
+		require.NoError(t, err)
+		assert.Empty(t, page.URLs)
+	})
+
+	t.Run("unknown owner", func(t *testing.T) {
+		userRepository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(nil, domain.ErrNotFound)
+
+		page, err := uc.Fetch(context.Background(), domain.URLFilter{Owner: tUser.Email})
+		require.NoError(t, err)
+		assert.NotNil(t, page.URLs)
+		assert.Empty(t, page.URLs)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, domain.ErrInternalServerError)
+
+		page, err := uc.Fetch(context.Background(), domain.URLFilter{})
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, page)
+	})
+}
+
+func TestURLUsecase_Timeouts(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tURL := tests.NewURL()
+	repository := mock.NewMockURLRepository(controller)
+	timeouts := domain.Timeouts{Read: 20 * time.Millisecond, Write: time.Minute, Scan: time.Minute}
+	uc := usecase.NewURLUsecase(repository, usermock.NewMockUserRepository(controller), timeouts, tracer, 1, usecase.LinkConfig{}, nil, nil, nil, nil)
+
+	// repository call interrupted by deadline fails as mongo driver does
+	blocked := func(ctx context.Context) error {
+		<-ctx.Done()
+		return fmt.Errorf("URL find error: %w: %s", domain.ErrInternalServerError, ctx.Err())
+	}
+
+	t.Run("read expires mid-operation", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).DoAndReturn(func(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+			return nil, blocked(ctx)
+		})
+
+		start := time.Now()
+		result, err := uc.GetByID(context.Background(), tURL.ID)
+		assert.ErrorIs(t, err, domain.ErrTimeout)
+		assert.NotErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("scan gets scan budget", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+			return []*domain.AdminURL{}, nil
+		})
+
+		_, err := uc.Fetch(context.Background(), domain.URLFilter{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("shorter caller deadline is kept", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		callerDeadline, _ := ctx.Deadline()
+		repository.EXPECT().Fetch(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, filter domain.URLFilter) ([]*domain.AdminURL, error) {
+			deadline, _ := ctx.Deadline()
+			assert.Equal(t, callerDeadline, deadline)
+			return nil, blocked(ctx)
+		})
+
+		page, err := uc.Fetch(ctx, domain.URLFilter{})
+		assert.ErrorIs(t, err, domain.ErrTimeout)
+		assert.Nil(t, page)
+	})
+
+	t.Run("canceled caller is not timeout", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		repository.EXPECT().GetByID(gomock.Any(), tURL.ID).DoAndReturn(func(ctx context.Context, id string, fields ...string) (*domain.URL, error) {
+			return nil, blocked(ctx)
+		})
+
+		_, err := uc.GetByID(ctx, tURL.ID)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.NotErrorIs(t, err, domain.ErrTimeout)
+	})
+}
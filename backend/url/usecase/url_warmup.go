@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// warmupWindow is the period clicks are counted in when URLs to warm cache
+// with are picked
+const warmupWindow = 7 * 24 * time.Hour
+
+// WarmCache loads up to size URLs with most clicks through urls, so their
+// cache is filled before serving and redirects after deploy don't all reach
+// the database. It returns once URLs are loaded or budget is spent, number of
+// loaded URLs is returned. Zero size or budget disables warm-up.
+func WarmCache(ctx context.Context, urls domain.URLRepository, clicks domain.ClickRepository, size int, budget time.Duration, logger *zap.Logger) int {
+	if size <= 0 || budget <= 0 {
+		return 0
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	ids, err := clicks.TopURLs(ctx, start.Add(-warmupWindow), start, size)
+	if err != nil {
+		logger.Warn("can't find URLs to warm cache with", zap.Error(err))
+		return 0
+	}
+
+	// URLs are read the way redirects read them, so they are cached for
+	// redirects
+	readCtx := domain.WithReadClass(ctx, domain.ReadRedirect)
+	warmed := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err = urls.GetByID(readCtx, id); err == nil {
+			warmed++
+		}
+	}
+
+	logger.Info("URL cache warmed",
+		zap.Int("warmed", warmed),
+		zap.Int("found", len(ids)),
+		zap.Duration("took", time.Since(start)),
+		zap.Bool("budget_spent", ctx.Err() != nil),
+	)
+
+	return warmed
+}
@@ -0,0 +1,68 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	clickmock "github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/url/usecase"
+)
+
+func TestWarmCache(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	t.Run("disabled", func(t *testing.T) {
+		urls := mock.NewMockURLRepository(controller)
+		clicks := clickmock.NewMockClickRepository(controller)
+
+		assert.Zero(t, usecase.WarmCache(context.Background(), urls, clicks, 0, time.Second, zap.NewNop()))
+		assert.Zero(t, usecase.WarmCache(context.Background(), urls, clicks, 10, 0, zap.NewNop()))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		urls := mock.NewMockURLRepository(controller)
+		clicks := clickmock.NewMockClickRepository(controller)
+		clicks.EXPECT().TopURLs(gomock.Any(), gomock.Any(), gomock.Any(), 10).DoAndReturn(
+			func(_ context.Context, from, now time.Time, _ int) ([]string, error) {
+				assert.Equal(t, 7*24*time.Hour, now.Sub(from))
+				return []string{"popular", "deleted"}, nil
+			})
+		urls.EXPECT().GetByID(gomock.Any(), "popular").DoAndReturn(func(ctx context.Context, id string, _ ...string) (*domain.URL, error) {
+			assert.Equal(t, domain.ReadRedirect, domain.ReadClassFromContext(ctx))
+			return tests.NewURL(), nil
+		})
+		urls.EXPECT().GetByID(gomock.Any(), "deleted").Return(nil, domain.ErrNotFound)
+
+		assert.Equal(t, 1, usecase.WarmCache(context.Background(), urls, clicks, 10, time.Second, zap.NewNop()))
+	})
+
+	t.Run("budget spent", func(t *testing.T) {
+		urls := mock.NewMockURLRepository(controller)
+		clicks := clickmock.NewMockClickRepository(controller)
+		clicks.EXPECT().TopURLs(gomock.Any(), gomock.Any(), gomock.Any(), 10).Return([]string{"slow", "skipped"}, nil)
+		urls.EXPECT().GetByID(gomock.Any(), "slow").DoAndReturn(func(ctx context.Context, id string, _ ...string) (*domain.URL, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		assert.Zero(t, usecase.WarmCache(context.Background(), urls, clicks, 10, 10*time.Millisecond, zap.NewNop()))
+	})
+
+	t.Run("top urls error", func(t *testing.T) {
+		urls := mock.NewMockURLRepository(controller)
+		clicks := clickmock.NewMockClickRepository(controller)
+		clicks.EXPECT().TopURLs(gomock.Any(), gomock.Any(), gomock.Any(), 10).Return(nil, errors.New("unexpected error"))
+
+		assert.Zero(t, usecase.WarmCache(context.Background(), urls, clicks, 10, time.Second, zap.NewNop()))
+	})
+}
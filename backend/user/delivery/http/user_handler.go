@@ -1,13 +1,13 @@
 package http
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v4"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"go.opentelemetry.io/otel/attribute"
@@ -16,13 +16,16 @@ import (
 
 	"github.com/semka95/shortener/backend/domain"
 	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	"github.com/semka95/shortener/backend/tracing"
 	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
 )
 
 // UserHandler represent the http handler for user
 type UserHandler struct {
 	userUsecase   domain.UserUsecase
+	deletion      domain.AccountDeletionUsecase
 	authenticator *auth.Authenticator
 	validator     *web.AppValidator
 	logger        *zap.Logger
@@ -36,169 +39,329 @@ func NewUserHandler(us domain.UserUsecase, authenticator *auth.Authenticator, v
 		authenticator: authenticator,
 		validator:     v,
 		logger:        logger,
-		tracer:        tracer,
+		tracer:        tracing.Tracer(tracer),
 	}
 }
 
+// SetAccountDeletion enables deletion of accounts by their users via DELETE
+// /user. It must be called before routes are registered.
+func (uh *UserHandler) SetAccountDeletion(d domain.AccountDeletionUsecase) {
+	uh.deletion = d
+}
+
 // RegisterRoutes registers routes for a path with matching handler
 func (uh *UserHandler) RegisterRoutes(e *echo.Echo) {
+	uh.RegisterAPIRoutes(e.Group("/v1"))
+}
+
+// RegisterAPIRoutes registers API routes on a group mounted at /v1 or /v2
+func (uh *UserHandler) RegisterAPIRoutes(g *echo.Group) {
 	myMiddl := _MyMiddleware.InitMiddleware(uh.logger)
-	e.POST("/v1/user/create", uh.Create)
-	e.GET("/v1/user/:id", uh.GetByID, echojwt.WithConfig(uh.authenticator.JWTConfig))
-	e.GET("v1/user/token", uh.Token)
-	e.DELETE("/v1/user/:id", uh.Delete, echojwt.WithConfig(uh.authenticator.JWTConfig), myMiddl.HasRole(auth.RoleAdmin))
-	e.PUT("/v1/user", uh.Update, echojwt.WithConfig(uh.authenticator.JWTConfig))
+	authenticated := []echo.MiddlewareFunc{echojwt.WithConfig(uh.authenticator.JWTConfig), myMiddl.SpanIdentity("userid"), myMiddl.DenyService}
+	admin := append(authenticated, myMiddl.HasRole(auth.RoleAdmin))
+	g.POST("/user/create", uh.Create)
+	g.GET("/user/:id", uh.GetByID, authenticated...)
+	g.GET("/user/token", uh.Token)
+	g.DELETE("/user/:id", uh.Delete, admin...)
+	g.PUT("/user", uh.Update, echojwt.WithConfig(uh.authenticator.PasswordChangeConfig()), myMiddl.SpanIdentity("userid"), myMiddl.DenyService)
+	g.PUT("/user/settings", uh.UpdateSettings, authenticated...)
+	g.POST("/user/tos/accept", uh.AcceptTOS, authenticated...)
+	if uh.deletion != nil {
+		g.DELETE("/user", uh.ScheduleDeletion, authenticated...)
+		g.POST("/user/delete/cancel", uh.CancelDeletion, myMiddl.NoStore)
+	}
+}
+
+// RegisterAdminRoutes registers admin routes on a group mounted at /v1/admin
+// or /v2/admin
+func (uh *UserHandler) RegisterAdminRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(uh.logger)
+	admin := []echo.MiddlewareFunc{echojwt.WithConfig(uh.authenticator.JWTConfig), myMiddl.SpanIdentity("userid"), myMiddl.HasRole(auth.RoleAdmin)}
+	g.POST("/users/:id/impersonate", uh.Impersonate, admin...)
+	g.GET("/users", uh.Fetch, admin...)
+	g.POST("/users/:id/disable", uh.Disable, admin...)
+	g.POST("/users/:id/enable", uh.Enable, admin...)
+	g.POST("/users/:id/force-password-reset", uh.ForcePasswordReset, admin...)
+	g.POST("/service-accounts", uh.CreateServiceAccount, admin...)
+	g.GET("/service-accounts", uh.FetchServiceAccounts, admin...)
+	g.POST("/service-accounts/:id/disable", uh.Disable, admin...)
+	g.POST("/service-accounts/:id/enable", uh.Enable, admin...)
+}
+
+// RegisterIntrospectRoutes registers token introspection route for internal
+// services on a group mounted at /v1/auth, group must restrict access to them
+func (uh *UserHandler) RegisterIntrospectRoutes(g *echo.Group) {
+	myMiddl := _MyMiddleware.InitMiddleware(uh.logger)
+	g.POST("/introspect", uh.Introspect, myMiddl.NoStore)
 }
 
 // GetByID will get user by given id
 func (uh *UserHandler) GetByID(c echo.Context) error {
 	id := c.Param("id")
 
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http GetByID",
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http GetByID")
 	defer span.End()
 
 	u, err := uh.userUsecase.GetByID(ctx, id)
 	if err != nil {
-		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
-	span.SetAttributes(
-		attribute.String("userid", u.ID.Hex()),
-	)
 
-	return c.JSON(http.StatusOK, u)
+	return web.Respond(c, http.StatusOK, u)
 }
 
 // Create will store the User by given request body
 func (uh *UserHandler) Create(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Create",
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Create")
 	defer span.End()
 
 	newUser := new(domain.CreateUser)
 	if err := c.Bind(newUser); err != nil {
 		span.RecordError(domain.ErrForbidden)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: err.Error()})
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
 	}
 
 	if err := c.Validate(newUser); err != nil {
 		span.RecordError(domain.ErrForbidden)
 		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
 	}
 
 	u, err := uh.userUsecase.Create(ctx, *newUser)
 	if err != nil {
 		span.RecordError(domain.ErrForbidden)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		if errors.Is(err, domain.ErrEmailTaken) {
+			return web.RespondError(c, http.StatusConflict, emailTakenResponse(err))
+		}
+		if errors.Is(err, domain.ErrTOSOutdated) {
+			return web.RespondError(c, http.StatusUnprocessableEntity, domain.ResponseError{Error: err.Error(), Code: domain.ErrCodeTOSOutdated})
+		}
+		return web.RespondDomainError(c, err, uh.logger)
 	}
 	span.SetAttributes(
 		attribute.String("userid", u.ID.Hex()),
 	)
 
-	return c.JSON(http.StatusCreated, u)
+	return web.Respond(c, http.StatusCreated, u)
+}
+
+// emailTakenResponse returns response to request whose email is used by
+// another user
+func emailTakenResponse(err error) domain.ResponseError {
+	return domain.ResponseError{Error: err.Error(), Fields: map[string]string{"email": "email is already taken"}}
 }
 
 // Delete will delete User by given id
 func (uh *UserHandler) Delete(c echo.Context) error {
 	id := c.Param("id")
 
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Delete",
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Delete")
 	defer span.End()
 
 	if err := uh.userUsecase.Delete(ctx, id); err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ScheduleDeletion will disable account of the user and schedule its deletion
+func (uh *UserHandler) ScheduleDeletion(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http ScheduleDeletion")
+	defer span.End()
+
+	claims, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	u, err := uh.deletion.Schedule(ctx, claims)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return web.Respond(c, http.StatusAccepted, u)
+}
+
+// CancelDeletion will restore account scheduled for deletion, user is
+// authenticated by token from deletion email or by Basic auth
+func (uh *UserHandler) CancelDeletion(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http CancelDeletion")
+	defer span.End()
+
+	req := new(domain.CancelDeletion)
+	if err := c.Bind(req); err != nil {
 		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
 	}
 
-	return c.JSON(http.StatusNoContent, nil)
+	var err error
+	if req.Token != "" {
+		err = uh.deletion.CancelWithToken(ctx, req.Token)
+	} else {
+		email, pass, ok := c.Request().BasicAuth()
+		if !ok {
+			span.RecordError(domain.ErrBadParamInput)
+			return web.RespondError(c, http.StatusUnauthorized, domain.ResponseError{Error: "can't get token or email and password using Basic auth"})
+		}
+
+		var u *domain.User
+		if u, err = uh.userUsecase.VerifyPassword(ctx, email, pass); err == nil {
+			span.SetAttributes(attribute.String("userid", u.ID.Hex()))
+			err = uh.deletion.Cancel(ctx, u.ID.Hex())
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		msg := err.Error()
+		// cause of authentication failure is not disclosed
+		if errors.Is(err, domain.ErrAuthenticationFailure) {
+			msg = domain.ErrAuthenticationFailure.Error()
+		}
+		return web.RespondError(c, domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: msg})
+	}
+
+	return c.NoContent(http.StatusNoContent)
 }
 
 // Update will update the User by given request body
 func (uh *UserHandler) Update(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Update",
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Update")
 	defer span.End()
 
 	u := new(domain.UpdateUser)
 	if err := c.Bind(u); err != nil {
 		span.RecordError(err)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: err.Error()})
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
 	}
 
 	if err := c.Validate(u); err != nil {
 		span.RecordError(err)
 		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
-		return c.JSON(http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
 	}
 
-	token, ok := c.Get("user").(*jwt.Token)
-	if !ok || token == nil {
-		span.RecordError(domain.ErrForbidden)
-		return c.JSON(http.StatusForbidden, domain.ResponseError{Error: domain.ErrForbidden.Error()})
-	}
-	claims, ok := token.Claims.(*auth.Claims)
-	if !ok {
-		span.RecordError(domain.ErrInternalServerError)
-		return fmt.Errorf("%w can't convert jwt.Claims to auth.Claims", domain.ErrInternalServerError)
+	claims, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
 	if err := uh.userUsecase.Update(ctx, *u, claims); err != nil {
 		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		if errors.Is(err, domain.ErrPasswordReused) {
+			return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: map[string]string{"new_password": fmt.Sprintf("new_password must differ from the last %d passwords", domain.PasswordHistorySize)}})
+		}
+		if errors.Is(err, domain.ErrEmailTaken) {
+			return web.RespondError(c, http.StatusConflict, emailTakenResponse(err))
+		}
+		if errors.Is(err, domain.ErrTOSOutdated) {
+			return web.RespondError(c, http.StatusUnprocessableEntity, domain.ResponseError{Error: err.Error(), Code: domain.ErrCodeTOSOutdated})
+		}
+		return web.RespondDomainError(c, err, uh.logger)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UpdateSettings will replace defaults of URLs authenticated user creates
+func (uh *UserHandler) UpdateSettings(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http UpdateSettings")
+	defer span.End()
+
+	settings := new(domain.UserSettings)
+	if err := c.Bind(settings); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(settings); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	claims, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	result, err := uh.userUsecase.UpdateSettings(ctx, *settings, claims)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return web.Respond(c, http.StatusOK, result)
+}
+
+// AcceptTOS will record that user accepted terms of service of given version
+// and return jwt token carrying it, token expires when the current one does
+func (uh *UserHandler) AcceptTOS(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http AcceptTOS")
+	defer span.End()
+
+	accept := new(domain.AcceptTOS)
+	if err := c.Bind(accept); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(accept); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	claims, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	u, err := uh.userUsecase.AcceptTOS(ctx, accept.Version, claims)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, domain.ErrTOSOutdated) {
+			return web.RespondError(c, http.StatusUnprocessableEntity, domain.ResponseError{Error: err.Error(), Code: domain.ErrCodeTOSOutdated})
+		}
+		return web.RespondDomainError(c, err, uh.logger)
+	}
+	// request was marked by the token of outdated version
+	c.Response().Header().Del(auth.HeaderTOSOutdated)
+
+	accepted := *claims
+	accepted.TOSVersion = u.TOSVersion
+
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	tkn.Token, err = uh.authenticator.GenerateToken(&accepted)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
-	return c.JSON(http.StatusNoContent, nil)
+	return web.Respond(c, http.StatusOK, tkn)
 }
 
 // Token will return jwt token by given credentials
 func (uh *UserHandler) Token(c echo.Context) error {
-	ctx := c.Request().Context()
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	ctx, span := uh.tracer.Start(
-		ctx,
-		"http Token",
-	)
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Token")
 	defer span.End()
 
 	email, pass, ok := c.Request().BasicAuth()
 	if !ok {
 		span.RecordError(domain.ErrBadParamInput)
-		return c.JSON(http.StatusUnauthorized, domain.ResponseError{Error: "can't get email and password using Basic auth"})
+		return web.RespondError(c, http.StatusUnauthorized, domain.ResponseError{Error: "can't get email and password using Basic auth"})
 	}
 
 	claims, err := uh.userUsecase.Authenticate(ctx, time.Now(), email, pass)
 	if err != nil {
 		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		msg := err.Error()
+		// cause of authentication failure (unknown email, wrong password,
+		// throttled login) is not disclosed
+		if errors.Is(err, domain.ErrAuthenticationFailure) {
+			msg = domain.ErrAuthenticationFailure.Error()
+		}
+		return web.RespondError(c, domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: msg})
 	}
 
 	var tkn struct {
@@ -206,9 +369,218 @@ func (uh *UserHandler) Token(c echo.Context) error {
 	}
 	tkn.Token, err = uh.authenticator.GenerateToken(claims)
 	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return web.Respond(c, http.StatusOK, tkn)
+}
+
+// Impersonate will return short-lived jwt token that lets admin act as user by given id
+func (uh *UserHandler) Impersonate(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Impersonate")
+	defer span.End()
+
+	admin, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	claims, err := uh.userUsecase.Impersonate(ctx, time.Now(), id, admin)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+	span.SetAttributes(
+		attribute.String("userid", claims.Subject),
+		attribute.String("impersonator", claims.Impersonator),
+	)
+
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	tkn.Token, err = uh.authenticator.GenerateToken(claims)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return web.Respond(c, http.StatusOK, tkn)
+}
+
+// Fetch will list users by given filter
+func (uh *UserHandler) Fetch(c echo.Context) error {
+	return uh.fetch(c, "http Fetch", "")
+}
+
+// FetchServiceAccounts will list service accounts by given filter
+func (uh *UserHandler) FetchServiceAccounts(c echo.Context) error {
+	return uh.fetch(c, "http FetchServiceAccounts", domain.UserTypeService)
+}
+
+// fetch lists users by filter of the request, userType replaces its type
+// when set
+func (uh *UserHandler) fetch(c echo.Context, spanName, userType string) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, spanName)
+	defer span.End()
+
+	filter := new(domain.UserFilter)
+	if err := c.Bind(filter); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(filter); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+	if userType != "" {
+		filter.Type = userType
+	}
+
+	page, err := uh.userUsecase.Fetch(ctx, *filter)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	var next, prev url.Values
+	if page.NextCursor != "" {
+		next = url.Values{"cursor": {page.NextCursor}}
+	}
+	if page.PrevCursor != "" {
+		prev = url.Values{"before": {page.PrevCursor}}
+	}
+	web.SetPageHeaders(c, page.Total, next, prev, "cursor", "before")
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = domain.DefaultUserPageLimit
+	}
+	return web.RespondList(c, http.StatusOK, page, page.Users, web.Pagination{
+		Count:      len(page.Users),
+		Limit:      limit,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		Total:      page.Total,
+	})
+}
+
+// CreateServiceAccount will create service account by given request body, it
+// gets API keys from admin
+func (uh *UserHandler) CreateServiceAccount(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http CreateServiceAccount")
+	defer span.End()
+
+	account := new(domain.CreateServiceAccount)
+	if err := c.Bind(account); err != nil {
 		span.RecordError(err)
-		return c.JSON(domain.GetStatusCode(err, uh.logger), domain.ResponseError{Error: err.Error()})
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(account); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	u, err := uh.userUsecase.CreateServiceAccount(ctx, *account)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+	span.SetAttributes(
+		attribute.String("userid", u.ID.Hex()),
+	)
+
+	return web.Respond(c, http.StatusCreated, u)
+}
+
+// Disable will disable User by given id
+func (uh *UserHandler) Disable(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Disable")
+	defer span.End()
+
+	d := new(domain.DisableUser)
+	if err := c.Bind(d); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(d); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	admin, err := requestctx.RequireClaims(ctx)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	if err := uh.userUsecase.Disable(ctx, id, *d, admin); err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Enable will enable disabled User by given id
+func (uh *UserHandler) Enable(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Enable")
+	defer span.End()
+
+	if err := uh.userUsecase.Enable(ctx, id); err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ForcePasswordReset will require User with given id to change password
+func (uh *UserHandler) ForcePasswordReset(c echo.Context) error {
+	id := c.Param("id")
+
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http ForcePasswordReset")
+	defer span.End()
+
+	if err := uh.userUsecase.ForcePasswordReset(ctx, id); err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Introspect will report whether given token is active and whom it was issued
+// to, invalid and expired tokens are reported inactive
+func (uh *UserHandler) Introspect(c echo.Context) error {
+	ctx, span := tracing.StartHandler(c, uh.tracer, "http Introspect")
+	defer span.End()
+
+	it := new(domain.IntrospectToken)
+	if err := c.Bind(it); err != nil {
+		span.RecordError(err)
+		return web.RespondError(c, http.StatusBadRequest, web.BindErrorResponse(err))
+	}
+
+	if err := c.Validate(it); err != nil {
+		span.RecordError(err)
+		fields := err.(validator.ValidationErrors).Translate(uh.validator.Translator)
+		return web.RespondError(c, http.StatusBadRequest, domain.ResponseError{Error: "validation error", Fields: fields})
+	}
+
+	claims, err := uh.authenticator.ParseClaims(it.Token)
+	if err != nil {
+		span.RecordError(err)
+		return web.Respond(c, http.StatusOK, domain.TokenIntrospection{})
+	}
+
+	result, err := uh.userUsecase.Introspect(ctx, claims)
+	if err != nil {
+		return web.RespondDomainError(c, tracing.Fail(span, err), uh.logger)
 	}
 
-	return c.JSON(http.StatusOK, tkn)
+	return web.Respond(c, http.StatusOK, result)
 }
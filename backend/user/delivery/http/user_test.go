@@ -2,11 +2,16 @@ package http_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,15 +21,22 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 
+	apiKeyMock "github.com/semka95/shortener/backend/apikey/mock"
 	"github.com/semka95/shortener/backend/domain"
+	_MyMiddleware "github.com/semka95/shortener/backend/middleware"
+	notifierMock "github.com/semka95/shortener/backend/notifier/mock"
+	"github.com/semka95/shortener/backend/pwhash"
 	"github.com/semka95/shortener/backend/tests"
 	userHttp "github.com/semka95/shortener/backend/user/delivery/http"
 	"github.com/semka95/shortener/backend/user/mock"
+	userUcase "github.com/semka95/shortener/backend/user/usecase"
 	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
 )
 
 func TestUserHTTP(t *testing.T) {
@@ -40,6 +52,7 @@ func TestUserHTTP(t *testing.T) {
 	kf := auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey))
 	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", kf)
 	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
 
 	tokenStr, err := authenticator.GenerateToken(claims)
 	require.NoError(t, err)
@@ -160,6 +173,21 @@ func TestUserHTTP(t *testing.T) {
 				assert.Equal(t, http.StatusInternalServerError, rec.Code)
 			},
 		},
+		{
+			description: "Create email taken",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Create(gomock.Any(), tCreateUser).Return(nil, domain.ErrEmailTaken)
+			},
+			reqBody: bytes.NewBuffer(createUserB),
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, domain.ErrEmailTaken.Error(), body.Error)
+				assert.Equal(t, "email is already taken", body.Fields["email"])
+				assert.Equal(t, http.StatusConflict, rec.Code)
+			},
+		},
 		{
 			description: "Create validation error",
 			mockCalls:   func(muc *mock.MockUserUsecase) {},
@@ -289,8 +317,8 @@ func TestUserHTTP(t *testing.T) {
 				body := new(domain.ResponseError)
 				err = json.NewDecoder(rec.Body).Decode(body)
 				require.NoError(t, err)
-				assert.Equal(t, domain.ErrForbidden.Error(), body.Error)
-				assert.Equal(t, http.StatusForbidden, rec.Code)
+				assert.Equal(t, requestctx.ErrNoClaims.Error(), body.Error)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
 			},
 		},
 		{
@@ -308,6 +336,22 @@ func TestUserHTTP(t *testing.T) {
 				assert.Equal(t, http.StatusNotFound, rec.Code)
 			},
 		},
+		{
+			description: "Update password reused",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Update(gomock.Any(), tUpdateUser, claims).Return(domain.ErrPasswordReused)
+			},
+			reqBody: bytes.NewBuffer(tUpdateUserB),
+			token:   token,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(&body)
+				require.NoError(t, err)
+				assert.Equal(t, "validation error", body.Error)
+				assert.Equal(t, "new_password must differ from the last 5 passwords", body.Fields["new_password"])
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
 		{
 			description: "Update validation error",
 			mockCalls:   func(muc *mock.MockUserUsecase) {},
@@ -347,6 +391,7 @@ func TestUserHTTP(t *testing.T) {
 			c.Reset(req, rec)
 			c.SetPath("/user/")
 			c.Set("user", tc.token)
+			_MyMiddleware.StoreClaims(c)
 
 			err = handler.Update(c)
 			require.NoError(t, err)
@@ -402,6 +447,20 @@ func TestUserHTTP(t *testing.T) {
 				assert.Equal(t, http.StatusUnauthorized, rec.Code)
 			},
 		},
+		{
+			description: "Token authentication failure hides cause",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), tUser.Email, password).Return(nil, fmt.Errorf("too many failed logins: %w", domain.ErrAuthenticationFailure))
+			},
+			auth: true,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, "authentication failed", body.Error)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			},
+		},
 	}
 
 	for _, tc := range casesAuth {
@@ -423,6 +482,300 @@ func TestUserHTTP(t *testing.T) {
 		})
 	}
 
+	// Test UserHandler.Impersonate
+	adminClaims := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	adminToken := jwt.NewWithClaims(jwt.SigningMethodHS256, adminClaims)
+	impClaims := auth.NewImpersonationClaims(tUser.ID.Hex(), tUser.Roles, adminClaims.Subject, time.Now())
+
+	casesImpersonate := []struct {
+		description   string
+		mockCalls     func(muc *mock.MockUserUsecase)
+		token         *jwt.Token
+		checkResponse func(rec *httptest.ResponseRecorder)
+	}{
+		{
+			description: "Impersonate success",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Impersonate(gomock.Any(), gomock.Any(), tUser.ID.Hex(), adminClaims).Return(impClaims, nil)
+			},
+			token: adminToken,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				var body struct {
+					Token string `json:"token"`
+				}
+				err = json.NewDecoder(rec.Body).Decode(&body)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+
+				parsed := new(auth.Claims)
+				_, err = jwt.ParseWithClaims(body.Token, parsed, func(token *jwt.Token) (interface{}, error) {
+					return key.Public(), nil
+				})
+				require.NoError(t, err)
+				assert.Equal(t, tUser.ID.Hex(), parsed.Subject)
+				assert.Equal(t, adminClaims.Subject, parsed.Impersonator)
+			},
+		},
+		{
+			description: "Impersonate not authorized",
+			mockCalls:   func(muc *mock.MockUserUsecase) {},
+			token:       nil,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, requestctx.ErrNoClaims.Error(), body.Error)
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			},
+		},
+		{
+			description: "Impersonate admin forbidden",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Impersonate(gomock.Any(), gomock.Any(), tUser.ID.Hex(), adminClaims).Return(nil, domain.ErrForbidden)
+			},
+			token: adminToken,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, domain.ErrForbidden.Error(), body.Error)
+				assert.Equal(t, http.StatusForbidden, rec.Code)
+			},
+		},
+	}
+
+	for _, tc := range casesImpersonate {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls(uc)
+			req = httptest.NewRequest(echo.POST, "/v1/admin/users/"+tUser.ID.Hex()+"/impersonate", nil)
+
+			rec := httptest.NewRecorder()
+			c.Reset(req, rec)
+			c.SetPath("/v1/admin/users/:id/impersonate")
+			c.SetParamNames("id")
+			c.SetParamValues(tUser.ID.Hex())
+			c.Set("user", tc.token)
+			_MyMiddleware.StoreClaims(c)
+
+			err = handler.Impersonate(c)
+			require.NoError(t, err)
+
+			tc.checkResponse(rec)
+		})
+	}
+
+	// Test UserHandler.Fetch
+	casesFetch := []struct {
+		description   string
+		mockCalls     func(muc *mock.MockUserUsecase)
+		query         string
+		checkResponse func(rec *httptest.ResponseRecorder)
+	}{
+		{
+			description: "Fetch disabled success",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				filter := domain.UserFilter{Status: domain.UserStatusDisabled, Limit: 1}
+				uc.EXPECT().Fetch(gomock.Any(), filter).Return(&domain.UserPage{Users: []*domain.User{tUser}, NextCursor: tUser.ID.Hex()}, nil)
+			},
+			query: "?status=disabled&limit=1",
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.UserPage)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, tUser.ID.Hex(), body.NextCursor)
+				assert.Len(t, body.Users, 1)
+			},
+		},
+		{
+			description: "Fetch wrong status",
+			mockCalls:   func(muc *mock.MockUserUsecase) {},
+			query:       "?status=deleted",
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, "validation error", body.Error)
+				assert.Equal(t, "status must be one of [active disabled]", body.Fields["UserFilter.status"])
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
+	}
+
+	for _, tc := range casesFetch {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls(uc)
+			req = httptest.NewRequest(echo.GET, "/v1/admin/users"+tc.query, nil)
+
+			rec := httptest.NewRecorder()
+			c.Reset(req, rec)
+			c.SetPath("/v1/admin/users")
+
+			err = handler.Fetch(c)
+			require.NoError(t, err)
+
+			tc.checkResponse(rec)
+		})
+	}
+
+	// Test UserHandler.Disable and UserHandler.Enable
+	disableB, err := json.Marshal(domain.DisableUser{Reason: "spam"})
+	require.NoError(t, err)
+
+	casesDisable := []struct {
+		description   string
+		mockCalls     func(muc *mock.MockUserUsecase)
+		reqBody       *bytes.Buffer
+		handler       func(c echo.Context) error
+		checkResponse func(rec *httptest.ResponseRecorder)
+	}{
+		{
+			description: "Disable success",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Disable(gomock.Any(), tUser.ID.Hex(), domain.DisableUser{Reason: "spam"}, adminClaims).Return(nil)
+			},
+			reqBody: bytes.NewBuffer(disableB),
+			handler: handler.Disable,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+			},
+		},
+		{
+			description: "Disable without reason",
+			mockCalls:   func(muc *mock.MockUserUsecase) {},
+			reqBody:     bytes.NewBufferString("{}"),
+			handler:     handler.Disable,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, "reason is a required field", body.Fields["DisableUser.reason"])
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
+		{
+			description: "Disable not found",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Disable(gomock.Any(), tUser.ID.Hex(), domain.DisableUser{Reason: "spam"}, adminClaims).Return(domain.ErrNotFound)
+			},
+			reqBody: bytes.NewBuffer(disableB),
+			handler: handler.Disable,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			},
+		},
+		{
+			description: "Enable success",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Enable(gomock.Any(), tUser.ID.Hex()).Return(nil)
+			},
+			reqBody: bytes.NewBufferString(""),
+			handler: handler.Enable,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+			},
+		},
+		{
+			description: "Enable not disabled",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().Enable(gomock.Any(), tUser.ID.Hex()).Return(domain.ErrNoAffected)
+			},
+			reqBody: bytes.NewBufferString(""),
+			handler: handler.Enable,
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			},
+		},
+	}
+
+	for _, tc := range casesDisable {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls(uc)
+			req = httptest.NewRequest(echo.POST, "/v1/admin/users/"+tUser.ID.Hex()+"/disable", tc.reqBody)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c.Reset(req, rec)
+			c.SetPath("/v1/admin/users/:id/disable")
+			c.SetParamNames("id")
+			c.SetParamValues(tUser.ID.Hex())
+			c.Set("user", adminToken)
+			_MyMiddleware.StoreClaims(c)
+
+			err = tc.handler(c)
+			require.NoError(t, err)
+
+			tc.checkResponse(rec)
+		})
+	}
+
+	// Test UserHandler.UpdateSettings
+	settings := domain.UserSettings{DefaultExpirationDays: 90}
+	settingsB, err := json.Marshal(settings)
+	require.NoError(t, err)
+
+	casesSettings := []struct {
+		description   string
+		mockCalls     func(muc *mock.MockUserUsecase)
+		reqBody       *bytes.Buffer
+		checkResponse func(rec *httptest.ResponseRecorder)
+	}{
+		{
+			description: "UpdateSettings success",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(&settings, nil)
+			},
+			reqBody: bytes.NewBuffer(settingsB),
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.UserSettings)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, settings, *body)
+				assert.Equal(t, http.StatusOK, rec.Code)
+			},
+		},
+		{
+			description: "UpdateSettings negative expiration",
+			mockCalls:   func(muc *mock.MockUserUsecase) {},
+			reqBody:     bytes.NewBufferString(`{"default_expiration_days":-1}`),
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				body := new(domain.ResponseError)
+				err = json.NewDecoder(rec.Body).Decode(body)
+				require.NoError(t, err)
+				assert.Equal(t, "default_expiration_days must be 1 or greater", body.Fields["UserSettings.default_expiration_days"])
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			},
+		},
+		{
+			description: "UpdateSettings user not found",
+			mockCalls: func(muc *mock.MockUserUsecase) {
+				uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(nil, domain.ErrNotFound)
+			},
+			reqBody: bytes.NewBuffer(settingsB),
+			checkResponse: func(rec *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			},
+		},
+	}
+
+	for _, tc := range casesSettings {
+		t.Run(tc.description, func(t *testing.T) {
+			tc.mockCalls(uc)
+			req = httptest.NewRequest(echo.PUT, "/v1/user/settings", tc.reqBody)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+			rec := httptest.NewRecorder()
+			c.Reset(req, rec)
+			c.Set("user", token)
+			_MyMiddleware.StoreClaims(c)
+
+			err = handler.UpdateSettings(c)
+			require.NoError(t, err)
+
+			tc.checkResponse(rec)
+		})
+	}
+
 	// Test validation for models.CreateUser and models.UpdateUser structs
 	casesCreateUser := []struct {
 		description string
@@ -542,3 +895,766 @@ func TestUserHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestUserHTTPFetchPageHeaders(t *testing.T) {
+	repo := tests.NewMemoryUserRepository()
+	ids := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		u := tests.NewUser()
+		u.ID = primitive.NewObjectID()
+		u.Email = fmt.Sprintf("user%d@example.com", i)
+		require.NoError(t, repo.Create(context.Background(), u))
+		ids = append(ids, u.ID.Hex())
+	}
+	sort.Strings(ids)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	hasher, err := pwhash.New(pwhash.Config{})
+	require.NoError(t, err)
+	handler := userHttp.NewUserHandler(userUcase.NewUserUsecase(repo, domain.NewTimeouts(10*time.Second), tracer, hasher), nil, v, zap.NewNop(), tracer)
+
+	e := echo.New()
+	e.Validator = v
+
+	cases := []struct {
+		description string
+		query       string
+		users       []string
+		total       string
+		link        string
+	}{
+		{
+			description: "first page",
+			query:       "status=active&limit=2&with_count=true",
+			users:       ids[:2],
+			total:       "5",
+			link:        `</api/v1/admin/users?cursor=` + ids[1] + `&limit=2&status=active&with_count=true>; rel="next"`,
+		},
+		{
+			description: "middle page",
+			query:       "status=active&limit=2&cursor=" + ids[1],
+			users:       ids[2:4],
+			link: `</api/v1/admin/users?cursor=` + ids[3] + `&limit=2&status=active>; rel="next", ` +
+				`</api/v1/admin/users?before=` + ids[2] + `&limit=2&status=active>; rel="prev"`,
+		},
+		{
+			description: "last page",
+			query:       "limit=2&cursor=" + ids[3] + "&with_count=true",
+			users:       ids[4:],
+			total:       "5",
+			link:        `</api/v1/admin/users?before=` + ids[4] + `&limit=2&with_count=true>; rel="prev"`,
+		},
+		{
+			description: "middle page backwards",
+			query:       "limit=2&before=" + ids[4],
+			users:       ids[2:4],
+			link: `</api/v1/admin/users?cursor=` + ids[3] + `&limit=2>; rel="next", ` +
+				`</api/v1/admin/users?before=` + ids[2] + `&limit=2>; rel="prev"`,
+		},
+		{
+			description: "first page backwards",
+			query:       "limit=2&before=" + ids[1],
+			users:       ids[:1],
+			link:        `</api/v1/admin/users?cursor=` + ids[0] + `&limit=2>; rel="next"`,
+		},
+		{
+			description: "single page",
+			query:       "",
+			users:       ids,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(echo.GET, "/api/v1/admin/users?"+tc.query, nil)
+			// path is rewritten by /api/* rule, links keep path requested by client
+			req.URL.Path = "/v1/admin/users"
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/v1/admin/users")
+
+			require.NoError(t, handler.Fetch(c))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			page := new(domain.UserPage)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(page))
+			got := make([]string, 0, len(page.Users))
+			for _, u := range page.Users {
+				got = append(got, u.ID.Hex())
+			}
+			assert.Equal(t, tc.users, got)
+			assert.Equal(t, tc.total, rec.Header().Get(web.HeaderXTotalCount))
+			assert.Equal(t, tc.link, rec.Header().Get("Link"))
+		})
+	}
+}
+
+func TestUserHTTPNilTracer(t *testing.T) {
+	tUser := tests.NewUser()
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockUserUsecase(controller)
+
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler := userHttp.NewUserHandler(uc, nil, v, zap.NewNop(), nil)
+
+	e := echo.New()
+	e.GET("/user/:id", handler.GetByID)
+
+	uc.EXPECT().GetByID(gomock.Any(), tUser.ID.Hex()).Return(tUser, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/user/"+tUser.ID.Hex(), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	uc.EXPECT().GetByID(gomock.Any(), "missing").Return(nil, domain.ErrNotFound)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/user/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUserHTTPUnknownFields(t *testing.T) {
+	tUser := tests.NewUser()
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	uc := mock.NewMockUserUsecase(controller)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	handler := userHttp.NewUserHandler(uc, nil, v, zap.NewNop(), tracer)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+
+	cases := []struct {
+		description string
+		method      string
+		body        string
+		handler     echo.HandlerFunc
+		field       string
+	}{
+		{
+			description: "create",
+			method:      echo.POST,
+			body:        `{"email":"test@example.com","pasword":"password"}`,
+			handler:     handler.Create,
+			field:       "pasword",
+		},
+		{
+			description: "update",
+			method:      echo.PUT,
+			body:        `{"id":"` + tUser.ID.Hex() + `","current_password":"password","fullname":"Jane Doe"}`,
+			handler:     handler.Update,
+			field:       "fullname",
+		},
+		{
+			description: "disable",
+			method:      echo.POST,
+			body:        `{"reasn":"spam"}`,
+			handler:     handler.Disable,
+			field:       "reasn",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/", bytes.NewBufferString(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			require.NoError(t, tc.handler(c))
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			re := new(domain.ResponseError)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(re))
+			assert.Equal(t, "validation error", re.Error)
+			assert.Equal(t, tc.field+" is not a known field", re.Fields[tc.field])
+		})
+	}
+}
+
+func TestUserHTTPIntrospect(t *testing.T) {
+	now := time.Now()
+	repo := tests.NewMemoryUserRepository()
+	newUser := func(email string, roles ...string) *domain.User {
+		u := tests.NewUser()
+		u.ID = primitive.NewObjectID()
+		u.Email = email
+		u.Roles = roles
+		require.NoError(t, repo.Create(context.Background(), u))
+		return u
+	}
+	healthy := newUser("healthy@example.com", auth.RoleUser)
+	disabled := newUser("disabled@example.com", auth.RoleUser)
+	disabled.DisabledAt = tests.DatePointer(now)
+	require.NoError(t, repo.Update(context.Background(), disabled))
+	deleted := newUser("deleted@example.com", auth.RoleUser)
+	require.NoError(t, repo.Delete(context.Background(), deleted.ID))
+	admin := newUser("admin@example.com", auth.RoleAdmin)
+	demoted := newUser("demoted@example.com", auth.RoleUser)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	sign := func(claims *auth.Claims) string {
+		tkn, err := authenticator.GenerateToken(claims)
+		require.NoError(t, err)
+		return tkn
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := auth.NewAuthenticator(otherKey, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, otherKey.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	otherToken, err := other.GenerateToken(auth.NewClaims(healthy.ID.Hex(), healthy.Roles, now, time.Hour))
+	require.NoError(t, err)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	hasher, err := pwhash.New(pwhash.Config{})
+	require.NoError(t, err)
+	handler := userHttp.NewUserHandler(userUcase.NewUserUsecase(repo, domain.NewTimeouts(10*time.Second), tracer, hasher), authenticator, v, zap.NewNop(), tracer)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+
+	healthyClaims := auth.NewClaims(healthy.ID.Hex(), healthy.Roles, now, time.Hour)
+	inactive := &domain.TokenIntrospection{}
+
+	cases := []struct {
+		description string
+		token       string
+		json        bool
+		expected    *domain.TokenIntrospection
+	}{
+		{
+			description: "healthy",
+			token:       sign(healthyClaims),
+			expected: &domain.TokenIntrospection{
+				Active:    true,
+				Subject:   healthy.ID.Hex(),
+				Scope:     auth.RoleUser,
+				Roles:     []string{auth.RoleUser},
+				TokenType: "Bearer",
+				ExpiresAt: healthyClaims.ExpiresAt.Unix(),
+				IssuedAt:  healthyClaims.IssuedAt.Unix(),
+			},
+		},
+		{
+			description: "healthy json",
+			token:       sign(healthyClaims),
+			json:        true,
+			expected: &domain.TokenIntrospection{
+				Active:    true,
+				Subject:   healthy.ID.Hex(),
+				Scope:     auth.RoleUser,
+				Roles:     []string{auth.RoleUser},
+				TokenType: "Bearer",
+				ExpiresAt: healthyClaims.ExpiresAt.Unix(),
+				IssuedAt:  healthyClaims.IssuedAt.Unix(),
+			},
+		},
+		{
+			description: "expired",
+			token:       sign(auth.NewClaims(healthy.ID.Hex(), healthy.Roles, now.Add(-2*time.Hour), time.Hour)),
+			expected:    inactive,
+		},
+		{
+			description: "revoked, user deleted",
+			token:       sign(auth.NewClaims(deleted.ID.Hex(), deleted.Roles, now, time.Hour)),
+			expected:    inactive,
+		},
+		{
+			description: "user disabled",
+			token:       sign(auth.NewClaims(disabled.ID.Hex(), disabled.Roles, now, time.Hour)),
+			expected:    inactive,
+		},
+		{
+			description: "impersonation",
+			token:       sign(auth.NewImpersonationClaims(healthy.ID.Hex(), healthy.Roles, admin.ID.Hex(), now)),
+			expected: &domain.TokenIntrospection{
+				Active:       true,
+				Subject:      healthy.ID.Hex(),
+				Scope:        auth.RoleUser,
+				Roles:        []string{auth.RoleUser},
+				TokenType:    "Bearer",
+				ExpiresAt:    now.Add(auth.ImpersonationTTL).Unix(),
+				IssuedAt:     now.Unix(),
+				Impersonator: admin.ID.Hex(),
+			},
+		},
+		{
+			description: "impersonator is not admin anymore",
+			token:       sign(auth.NewImpersonationClaims(healthy.ID.Hex(), healthy.Roles, demoted.ID.Hex(), now)),
+			expected:    inactive,
+		},
+		{
+			description: "signed with other key",
+			token:       otherToken,
+			expected:    inactive,
+		},
+		{
+			description: "malformed",
+			token:       "not a token",
+			expected:    inactive,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			body := url.Values{"token": {tc.token}, "token_type_hint": {"access_token"}}.Encode()
+			contentType := echo.MIMEApplicationForm
+			if tc.json {
+				b, err := json.Marshal(domain.IntrospectToken{Token: tc.token})
+				require.NoError(t, err)
+				body, contentType = string(b), echo.MIMEApplicationJSON
+			}
+			req := httptest.NewRequest(echo.POST, "/v1/auth/introspect", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			require.NoError(t, handler.Introspect(c))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			result := new(domain.TokenIntrospection)
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(result))
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+
+	t.Run("token missing", func(t *testing.T) {
+		req := httptest.NewRequest(echo.POST, "/v1/auth/introspect", strings.NewReader(""))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		require.NoError(t, handler.Introspect(c))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestUserHTTPServiceAccounts(t *testing.T) {
+	repo := tests.NewMemoryUserRepository()
+	human := tests.NewUser()
+	require.NoError(t, repo.Create(context.Background(), human))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	sign := func(claims *auth.Claims) string {
+		tkn, err := authenticator.GenerateToken(claims)
+		require.NoError(t, err)
+		return tkn
+	}
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	hasher, err := pwhash.New(pwhash.Config{})
+	require.NoError(t, err)
+	handler := userHttp.NewUserHandler(userUcase.NewUserUsecase(repo, domain.NewTimeouts(10*time.Second), tracer, hasher), authenticator, v, zap.NewNop(), tracer)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+	handler.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	admin := sign(auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Hour))
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(echo.POST, "/v1/admin/service-accounts", `{"name":"crm"}`, admin)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	account := new(domain.User)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(account))
+	assert.Equal(t, domain.UserTypeService, account.Type)
+	assert.Equal(t, "crm", account.FullName)
+
+	t.Run("validation error", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/admin/service-accounts", `{"name":""}`, admin)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := do(echo.GET, "/v1/admin/service-accounts?type=user", "", admin)
+		require.Equal(t, http.StatusOK, rec.Code)
+		page := new(domain.UserPage)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(page))
+		require.Len(t, page.Users, 1)
+		assert.Equal(t, account.ID, page.Users[0].ID)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/admin/service-accounts/"+account.ID.Hex()+"/disable", `{"reason":"leaked key"}`, admin)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = do(echo.GET, "/v1/admin/service-accounts?status=disabled", "", admin)
+		require.Equal(t, http.StatusOK, rec.Code)
+		page := new(domain.UserPage)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(page))
+		require.Len(t, page.Users, 1)
+		assert.Equal(t, "leaked key", page.Users[0].DisabledReason)
+	})
+
+	t.Run("service account can't manage users", func(t *testing.T) {
+		service := auth.NewClaims(account.ID.Hex(), []string{auth.RoleAdmin}, time.Now(), time.Hour)
+		service.Type = auth.TypeService
+		token := sign(service)
+
+		assert.Equal(t, http.StatusForbidden, do(echo.GET, "/v1/user/"+account.ID.Hex(), "", token).Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.PUT, "/v1/user/settings", `{}`, token).Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.DELETE, "/v1/user/"+human.ID.Hex(), "", token).Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.GET, "/v1/admin/users", "", token).Code)
+		assert.Equal(t, http.StatusForbidden, do(echo.POST, "/v1/admin/service-accounts", `{"name":"crm"}`, token).Code)
+	})
+}
+
+func TestUserHTTPForcePasswordReset(t *testing.T) {
+	repo := tests.NewMemoryUserRepository()
+	user := tests.NewUser()
+	require.NoError(t, repo.Create(context.Background(), user))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	hasher, err := pwhash.New(pwhash.Config{})
+	require.NoError(t, err)
+	handler := userHttp.NewUserHandler(userUcase.NewUserUsecase(repo, domain.NewTimeouts(10*time.Second), tracer, hasher), authenticator, v, zap.NewNop(), tracer)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+	handler.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	admin, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Hour))
+	require.NoError(t, err)
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(password string) (string, *auth.Claims) {
+		req := httptest.NewRequest(echo.GET, "/v1/user/token", nil)
+		req.SetBasicAuth(user.Email, password)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var tkn struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&tkn))
+		claims, err := authenticator.ParseClaims(tkn.Token)
+		require.NoError(t, err)
+		return tkn.Token, claims
+	}
+	userPath := "/v1/user/" + user.ID.Hex()
+
+	t.Run("not admin", func(t *testing.T) {
+		token, _ := login("password")
+		rec := do(echo.POST, "/v1/admin/users/"+user.ID.Hex()+"/force-password-reset", "", token)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	rec := do(echo.POST, "/v1/admin/users/"+user.ID.Hex()+"/force-password-reset", "", admin)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	token, claims := login("password")
+	assert.True(t, claims.PasswordChangeRequired)
+
+	t.Run("other endpoints are rejected", func(t *testing.T) {
+		rec := do(echo.GET, userPath, "", token)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), auth.ErrPasswordChangeRequired.Error())
+		assert.Equal(t, http.StatusForbidden, do(echo.PUT, "/v1/user/settings", `{}`, token).Code)
+	})
+
+	t.Run("update without new password", func(t *testing.T) {
+		body := fmt.Sprintf(`{"id":%q,"full_name":"Jane Doe","current_password":"password"}`, user.ID.Hex())
+		rec := do(echo.PUT, "/v1/user", body, token)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), domain.ErrNewPasswordRequired.Error())
+	})
+
+	body := fmt.Sprintf(`{"id":%q,"current_password":"password","new_password":"new_password"}`, user.ID.Hex())
+	rec = do(echo.PUT, "/v1/user", body, token)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	stored, err := repo.GetByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.MustChangePassword)
+
+	token, claims = login("new_password")
+	assert.False(t, claims.PasswordChangeRequired)
+	rec = do(echo.GET, userPath, "", token)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestUserHTTPAccountDeletion(t *testing.T) {
+	repo := tests.NewMemoryUserRepository()
+	user := tests.NewUser()
+	require.NoError(t, repo.Create(context.Background(), user))
+	urls := tests.NewMemoryURLRepository()
+	require.NoError(t, urls.Store(context.Background(), tests.NewURL()))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	keys := apiKeyMock.NewMockAPIKeyRepository(controller)
+	sender := notifierMock.NewMockNotificationSender(controller)
+	var links []string
+	sender.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, n domain.Notification) error {
+		links = append(links, n.Data.(domain.AccountDeletion).CancelLink)
+		return nil
+	}).AnyTimes()
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	hasher, err := pwhash.New(pwhash.Config{})
+	require.NoError(t, err)
+	// tokens are verified with wall clock, so they must not be issued later
+	now := time.Now().Add(-time.Hour).Truncate(time.Second)
+	deletion := userUcase.NewAccountDeletion(repo, keys, urls, sender, authenticator, 10*time.Second, tracer, zap.NewNop(), userUcase.DeletionConfig{
+		CancelURL: "https://sho.rt/account/restore",
+	})
+	deletion.SetClock(func() time.Time { return now })
+	handler := userHttp.NewUserHandler(userUcase.NewUserUsecase(repo, domain.NewTimeouts(10*time.Second), tracer, hasher), authenticator, v, zap.NewNop(), tracer)
+	handler.SetAccountDeletion(deletion)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+
+	token, err := authenticator.GenerateToken(auth.NewClaims(user.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Hour))
+	require.NoError(t, err)
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(password string) int {
+		req := httptest.NewRequest(echo.GET, "/v1/user/token", nil)
+		req.SetBasicAuth(user.Email, password)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cancelByPassword := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/v1/user/delete/cancel", nil)
+		req.SetBasicAuth(user.Email, password)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	schedule := func() string {
+		rec := do(echo.DELETE, "/v1/user", "", token)
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"delete_after"`)
+		link, err := url.Parse(links[len(links)-1])
+		require.NoError(t, err)
+		return link.Query().Get("token")
+	}
+
+	t.Run("impersonated", func(t *testing.T) {
+		impersonated, err := authenticator.GenerateToken(auth.NewImpersonationClaims(user.ID.Hex(), []string{auth.RoleUser}, "507f191e810c19729de860ec", time.Now()))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, do(echo.DELETE, "/v1/user", "", impersonated).Code)
+	})
+
+	t.Run("not scheduled", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, cancelByPassword("password").Code)
+	})
+
+	first := schedule()
+	assert.Equal(t, http.StatusUnauthorized, login("password"))
+	assert.Equal(t, http.StatusConflict, do(echo.DELETE, "/v1/user", "", token).Code)
+
+	t.Run("cancel with invalid token", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/user/delete/cancel", `{"token":"not.a.token"}`, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), domain.ErrAuthenticationFailure.Error())
+	})
+
+	t.Run("cancel without credentials", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do(echo.POST, "/v1/user/delete/cancel", "", "").Code)
+	})
+
+	rec := do(echo.POST, "/v1/user/delete/cancel", fmt.Sprintf(`{"token":%q}`, first), "")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+	assert.Equal(t, http.StatusOK, login("password"))
+
+	now = now.Add(30 * time.Minute)
+	schedule()
+
+	t.Run("token of canceled deletion", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/user/delete/cancel", fmt.Sprintf(`{"token":%q}`, first), "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("cancel with wrong password", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, cancelByPassword("wrong").Code)
+	})
+
+	rec = cancelByPassword("password")
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, http.StatusOK, login("password"))
+
+	last := schedule()
+	now = now.AddDate(0, 0, userUcase.DefaultDeletionGraceDays)
+	assert.Equal(t, http.StatusForbidden, do(echo.POST, "/v1/user/delete/cancel", fmt.Sprintf(`{"token":%q}`, last), "").Code)
+
+	keys.EXPECT().DeleteByUser(gomock.Any(), user.ID.Hex()).Return(int64(1), nil)
+	deleted, err := deletion.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	_, err = repo.GetByID(context.Background(), user.ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = urls.GetByID(context.Background(), tests.NewURL().ID)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestUserHTTPTermsOfService(t *testing.T) {
+	repo := tests.NewMemoryUserRepository()
+	user := tests.NewUser()
+	user.TOSVersion = "1"
+	require.NoError(t, repo.Create(context.Background(), user))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+	authenticator.JWTConfig.SuccessHandler = _MyMiddleware.StoreClaims
+	authenticator.SetTOSVersion("2")
+
+	tracer := sdktrace.NewTracerProvider().Tracer("")
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	hasher, err := pwhash.New(pwhash.Config{})
+	require.NoError(t, err)
+	uc := userUcase.NewTermsOfService(userUcase.NewUserUsecase(repo, domain.NewTimeouts(10*time.Second), tracer, hasher), "2")
+	handler := userHttp.NewUserHandler(uc, authenticator, v, zap.NewNop(), tracer)
+
+	e := echo.New()
+	e.Validator = v
+	e.Binder = &web.Binder{}
+	handler.RegisterRoutes(e)
+	handler.RegisterAdminRoutes(e.Group("/v1/admin"))
+
+	do := func(method, target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	decodeToken := func(rec *httptest.ResponseRecorder) string {
+		var tkn struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&tkn))
+		return tkn.Token
+	}
+	userPath := "/v1/user/" + user.ID.Hex()
+
+	t.Run("sign up with outdated version", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/user/create", `{"email":"new@example.com","password":"password","tos_version":"1"}`, "")
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"tos_outdated"`)
+	})
+
+	t.Run("sign up", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/user/create", `{"email":"new@example.com","password":"password","tos_version":"2"}`, "")
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		created := new(domain.User)
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(created))
+		assert.Equal(t, "2", created.TOSVersion)
+		assert.NotNil(t, created.TOSAcceptedAt)
+	})
+
+	req := httptest.NewRequest(echo.GET, "/v1/user/token", nil)
+	req.SetBasicAuth(user.Email, "password")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	token := decodeToken(rec)
+
+	rec = do(echo.GET, userPath, "", token)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "2", rec.Header().Get(auth.HeaderTOSOutdated))
+
+	t.Run("accept outdated version", func(t *testing.T) {
+		rec := do(echo.POST, "/v1/user/tos/accept", `{"tos_version":"1"}`, token)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"code":"tos_outdated"`)
+	})
+
+	rec = do(echo.POST, "/v1/user/tos/accept", `{"tos_version":"2"}`, token)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Empty(t, rec.Header().Get(auth.HeaderTOSOutdated))
+	token = decodeToken(rec)
+
+	stored, err := repo.GetByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2", stored.TOSVersion)
+	assert.NotNil(t, stored.TOSAcceptedAt)
+
+	rec = do(echo.GET, userPath, "", token)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Empty(t, rec.Header().Get(auth.HeaderTOSOutdated))
+
+	t.Run("admin list", func(t *testing.T) {
+		admin, err := authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Hour))
+		require.NoError(t, err)
+		rec := do(echo.GET, "/v1/admin/users?email="+url.QueryEscape(user.Email), "", admin)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), `"tos_version":"2"`)
+		assert.Contains(t, rec.Body.String(), `"tos_accepted_at":`)
+	})
+}
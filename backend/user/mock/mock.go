@@ -38,6 +38,21 @@ func (m *MockUserUsecase) EXPECT() *MockUserUsecaseMockRecorder {
 	return m.recorder
 }
 
+// AcceptTOS mocks base method.
+func (m *MockUserUsecase) AcceptTOS(ctx context.Context, version string, claims *auth.Claims) (*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptTOS", ctx, version, claims)
+	ret0, _ := ret[0].(*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptTOS indicates an expected call of AcceptTOS.
+func (mr *MockUserUsecaseMockRecorder) AcceptTOS(ctx, version, claims interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptTOS", reflect.TypeOf((*MockUserUsecase)(nil).AcceptTOS), ctx, version, claims)
+}
+
 // Authenticate mocks base method.
 func (m *MockUserUsecase) Authenticate(ctx context.Context, now time.Time, email, password string) (*auth.Claims, error) {
 	m.ctrl.T.Helper()
@@ -68,6 +83,21 @@ func (mr *MockUserUsecaseMockRecorder) Create(ctx, user interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockUserUsecase)(nil).Create), ctx, user)
 }
 
+// CreateServiceAccount mocks base method.
+func (m *MockUserUsecase) CreateServiceAccount(ctx context.Context, account domain.CreateServiceAccount) (*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateServiceAccount", ctx, account)
+	ret0, _ := ret[0].(*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateServiceAccount indicates an expected call of CreateServiceAccount.
+func (mr *MockUserUsecaseMockRecorder) CreateServiceAccount(ctx, account interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateServiceAccount", reflect.TypeOf((*MockUserUsecase)(nil).CreateServiceAccount), ctx, account)
+}
+
 // Delete mocks base method.
 func (m *MockUserUsecase) Delete(ctx context.Context, id string) error {
 	m.ctrl.T.Helper()
@@ -82,6 +112,63 @@ func (mr *MockUserUsecaseMockRecorder) Delete(ctx, id interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockUserUsecase)(nil).Delete), ctx, id)
 }
 
+// Disable mocks base method.
+func (m *MockUserUsecase) Disable(ctx context.Context, id string, disableUser domain.DisableUser, admin *auth.Claims) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Disable", ctx, id, disableUser, admin)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Disable indicates an expected call of Disable.
+func (mr *MockUserUsecaseMockRecorder) Disable(ctx, id, disableUser, admin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disable", reflect.TypeOf((*MockUserUsecase)(nil).Disable), ctx, id, disableUser, admin)
+}
+
+// Enable mocks base method.
+func (m *MockUserUsecase) Enable(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enable", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Enable indicates an expected call of Enable.
+func (mr *MockUserUsecaseMockRecorder) Enable(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enable", reflect.TypeOf((*MockUserUsecase)(nil).Enable), ctx, id)
+}
+
+// Fetch mocks base method.
+func (m *MockUserUsecase) Fetch(ctx context.Context, filter domain.UserFilter) (*domain.UserPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", ctx, filter)
+	ret0, _ := ret[0].(*domain.UserPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockUserUsecaseMockRecorder) Fetch(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockUserUsecase)(nil).Fetch), ctx, filter)
+}
+
+// ForcePasswordReset mocks base method.
+func (m *MockUserUsecase) ForcePasswordReset(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForcePasswordReset", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForcePasswordReset indicates an expected call of ForcePasswordReset.
+func (mr *MockUserUsecaseMockRecorder) ForcePasswordReset(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForcePasswordReset", reflect.TypeOf((*MockUserUsecase)(nil).ForcePasswordReset), ctx, id)
+}
+
 // GetByID mocks base method.
 func (m *MockUserUsecase) GetByID(ctx context.Context, id string) (*domain.User, error) {
 	m.ctrl.T.Helper()
@@ -97,6 +184,51 @@ func (mr *MockUserUsecaseMockRecorder) GetByID(ctx, id interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockUserUsecase)(nil).GetByID), ctx, id)
 }
 
+// GrantRole mocks base method.
+func (m *MockUserUsecase) GrantRole(ctx context.Context, email, role string) (*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantRole", ctx, email, role)
+	ret0, _ := ret[0].(*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GrantRole indicates an expected call of GrantRole.
+func (mr *MockUserUsecaseMockRecorder) GrantRole(ctx, email, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantRole", reflect.TypeOf((*MockUserUsecase)(nil).GrantRole), ctx, email, role)
+}
+
+// Impersonate mocks base method.
+func (m *MockUserUsecase) Impersonate(ctx context.Context, now time.Time, id string, admin *auth.Claims) (*auth.Claims, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Impersonate", ctx, now, id, admin)
+	ret0, _ := ret[0].(*auth.Claims)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Impersonate indicates an expected call of Impersonate.
+func (mr *MockUserUsecaseMockRecorder) Impersonate(ctx, now, id, admin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Impersonate", reflect.TypeOf((*MockUserUsecase)(nil).Impersonate), ctx, now, id, admin)
+}
+
+// Introspect mocks base method.
+func (m *MockUserUsecase) Introspect(ctx context.Context, claims *auth.Claims) (*domain.TokenIntrospection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Introspect", ctx, claims)
+	ret0, _ := ret[0].(*domain.TokenIntrospection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Introspect indicates an expected call of Introspect.
+func (mr *MockUserUsecaseMockRecorder) Introspect(ctx, claims interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Introspect", reflect.TypeOf((*MockUserUsecase)(nil).Introspect), ctx, claims)
+}
+
 // Update mocks base method.
 func (m *MockUserUsecase) Update(ctx context.Context, user domain.UpdateUser, claims *auth.Claims) error {
 	m.ctrl.T.Helper()
@@ -111,6 +243,168 @@ func (mr *MockUserUsecaseMockRecorder) Update(ctx, user, claims interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockUserUsecase)(nil).Update), ctx, user, claims)
 }
 
+// UpdateSettings mocks base method.
+func (m *MockUserUsecase) UpdateSettings(ctx context.Context, settings domain.UserSettings, claims *auth.Claims) (*domain.UserSettings, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSettings", ctx, settings, claims)
+	ret0, _ := ret[0].(*domain.UserSettings)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateSettings indicates an expected call of UpdateSettings.
+func (mr *MockUserUsecaseMockRecorder) UpdateSettings(ctx, settings, claims interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSettings", reflect.TypeOf((*MockUserUsecase)(nil).UpdateSettings), ctx, settings, claims)
+}
+
+// VerifyPassword mocks base method.
+func (m *MockUserUsecase) VerifyPassword(ctx context.Context, email, password string) (*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyPassword", ctx, email, password)
+	ret0, _ := ret[0].(*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyPassword indicates an expected call of VerifyPassword.
+func (mr *MockUserUsecaseMockRecorder) VerifyPassword(ctx, email, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyPassword", reflect.TypeOf((*MockUserUsecase)(nil).VerifyPassword), ctx, email, password)
+}
+
+// MockAccountDeletionUsecase is a mock of AccountDeletionUsecase interface.
+type MockAccountDeletionUsecase struct {
+	ctrl     *gomock.Controller
+	recorder *MockAccountDeletionUsecaseMockRecorder
+}
+
+// MockAccountDeletionUsecaseMockRecorder is the mock recorder for MockAccountDeletionUsecase.
+type MockAccountDeletionUsecaseMockRecorder struct {
+	mock *MockAccountDeletionUsecase
+}
+
+// NewMockAccountDeletionUsecase creates a new mock instance.
+func NewMockAccountDeletionUsecase(ctrl *gomock.Controller) *MockAccountDeletionUsecase {
+	mock := &MockAccountDeletionUsecase{ctrl: ctrl}
+	mock.recorder = &MockAccountDeletionUsecaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAccountDeletionUsecase) EXPECT() *MockAccountDeletionUsecaseMockRecorder {
+	return m.recorder
+}
+
+// Cancel mocks base method.
+func (m *MockAccountDeletionUsecase) Cancel(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockAccountDeletionUsecaseMockRecorder) Cancel(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockAccountDeletionUsecase)(nil).Cancel), ctx, id)
+}
+
+// CancelWithToken mocks base method.
+func (m *MockAccountDeletionUsecase) CancelWithToken(ctx context.Context, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelWithToken", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelWithToken indicates an expected call of CancelWithToken.
+func (mr *MockAccountDeletionUsecaseMockRecorder) CancelWithToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelWithToken", reflect.TypeOf((*MockAccountDeletionUsecase)(nil).CancelWithToken), ctx, token)
+}
+
+// Schedule mocks base method.
+func (m *MockAccountDeletionUsecase) Schedule(ctx context.Context, claims *auth.Claims) (*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Schedule", ctx, claims)
+	ret0, _ := ret[0].(*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Schedule indicates an expected call of Schedule.
+func (mr *MockAccountDeletionUsecaseMockRecorder) Schedule(ctx, claims interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockAccountDeletionUsecase)(nil).Schedule), ctx, claims)
+}
+
+// MockPasswordHasher is a mock of PasswordHasher interface.
+type MockPasswordHasher struct {
+	ctrl     *gomock.Controller
+	recorder *MockPasswordHasherMockRecorder
+}
+
+// MockPasswordHasherMockRecorder is the mock recorder for MockPasswordHasher.
+type MockPasswordHasherMockRecorder struct {
+	mock *MockPasswordHasher
+}
+
+// NewMockPasswordHasher creates a new mock instance.
+func NewMockPasswordHasher(ctrl *gomock.Controller) *MockPasswordHasher {
+	mock := &MockPasswordHasher{ctrl: ctrl}
+	mock.recorder = &MockPasswordHasherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPasswordHasher) EXPECT() *MockPasswordHasherMockRecorder {
+	return m.recorder
+}
+
+// Hash mocks base method.
+func (m *MockPasswordHasher) Hash(password string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Hash", password)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Hash indicates an expected call of Hash.
+func (mr *MockPasswordHasherMockRecorder) Hash(password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Hash", reflect.TypeOf((*MockPasswordHasher)(nil).Hash), password)
+}
+
+// NeedsRehash mocks base method.
+func (m *MockPasswordHasher) NeedsRehash(hash string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NeedsRehash", hash)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// NeedsRehash indicates an expected call of NeedsRehash.
+func (mr *MockPasswordHasherMockRecorder) NeedsRehash(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NeedsRehash", reflect.TypeOf((*MockPasswordHasher)(nil).NeedsRehash), hash)
+}
+
+// Verify mocks base method.
+func (m *MockPasswordHasher) Verify(hash, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", hash, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockPasswordHasherMockRecorder) Verify(hash, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockPasswordHasher)(nil).Verify), hash, password)
+}
+
 // MockUserRepository is a mock of UserRepository interface.
 type MockUserRepository struct {
 	ctrl     *gomock.Controller
@@ -134,6 +428,35 @@ func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
 	return m.recorder
 }
 
+// ClaimDeletion mocks base method.
+func (m *MockUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimDeletion", ctx, id, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClaimDeletion indicates an expected call of ClaimDeletion.
+func (mr *MockUserRepositoryMockRecorder) ClaimDeletion(ctx, id, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimDeletion", reflect.TypeOf((*MockUserRepository)(nil).ClaimDeletion), ctx, id, now)
+}
+
+// Count mocks base method.
+func (m *MockUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", ctx, filter)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockUserRepositoryMockRecorder) Count(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockUserRepository)(nil).Count), ctx, filter)
+}
+
 // Create mocks base method.
 func (m *MockUserRepository) Create(ctx context.Context, user *domain.User) error {
 	m.ctrl.T.Helper()
@@ -162,6 +485,50 @@ func (mr *MockUserRepositoryMockRecorder) Delete(ctx, id interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockUserRepository)(nil).Delete), ctx, id)
 }
 
+// DeleteScheduled mocks base method.
+func (m *MockUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteScheduled", ctx, id, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteScheduled indicates an expected call of DeleteScheduled.
+func (mr *MockUserRepositoryMockRecorder) DeleteScheduled(ctx, id, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteScheduled", reflect.TypeOf((*MockUserRepository)(nil).DeleteScheduled), ctx, id, now)
+}
+
+// Fetch mocks base method.
+func (m *MockUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", ctx, filter)
+	ret0, _ := ret[0].([]*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockUserRepositoryMockRecorder) Fetch(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockUserRepository)(nil).Fetch), ctx, filter)
+}
+
+// FetchDeletable mocks base method.
+func (m *MockUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchDeletable", ctx, now, limit)
+	ret0, _ := ret[0].([]*domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchDeletable indicates an expected call of FetchDeletable.
+func (mr *MockUserRepositoryMockRecorder) FetchDeletable(ctx, now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchDeletable", reflect.TypeOf((*MockUserRepository)(nil).FetchDeletable), ctx, now, limit)
+}
+
 // GetByEmail mocks base method.
 func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	m.ctrl.T.Helper()
@@ -192,6 +559,49 @@ func (mr *MockUserRepositoryMockRecorder) GetByID(ctx, id interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockUserRepository)(nil).GetByID), ctx, id)
 }
 
+// Ping mocks base method.
+func (m *MockUserRepository) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockUserRepositoryMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockUserRepository)(nil).Ping), ctx)
+}
+
+// Restore mocks base method.
+func (m *MockUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", ctx, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockUserRepositoryMockRecorder) Restore(ctx, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockUserRepository)(nil).Restore), ctx, user)
+}
+
+// Stats mocks base method.
+func (m *MockUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats", ctx)
+	ret0, _ := ret[0].(*domain.RepositoryStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockUserRepositoryMockRecorder) Stats(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockUserRepository)(nil).Stats), ctx)
+}
+
 // Update mocks base method.
 func (m *MockUserRepository) Update(ctx context.Context, user *domain.User) error {
 	m.ctrl.T.Helper()
@@ -205,3 +615,17 @@ func (mr *MockUserRepositoryMockRecorder) Update(ctx, user interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockUserRepository)(nil).Update), ctx, user)
 }
+
+// UpdatePasswordHash mocks base method.
+func (m *MockUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePasswordHash", ctx, id, oldHash, newHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePasswordHash indicates an expected call of UpdatePasswordHash.
+func (mr *MockUserRepositoryMockRecorder) UpdatePasswordHash(ctx, id, oldHash, newHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePasswordHash", reflect.TypeOf((*MockUserRepository)(nil).UpdatePasswordHash), ctx, id, oldHash, newHash)
+}
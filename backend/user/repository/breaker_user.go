@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type breakerUserRepository struct {
+	next domain.UserRepository
+	cb   *store.CircuitBreaker
+}
+
+// NewBreakerUserRepository wraps repository with circuit breaker, so calls
+// fail fast while backend is unhealthy
+func NewBreakerUserRepository(next domain.UserRepository, cb *store.CircuitBreaker) domain.UserRepository {
+	return &breakerUserRepository{
+		next: next,
+		cb:   cb,
+	}
+}
+
+// Ping goes through the breaker, so health check fails fast while it is open
+// and probes backend when it is half-open
+func (r *breakerUserRepository) Ping(ctx context.Context) error {
+	return r.cb.Do(func() error {
+		return r.next.Ping(ctx)
+	})
+}
+
+func (r *breakerUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	var stats *domain.RepositoryStats
+	err := r.cb.Do(func() (err error) {
+		stats, err = r.next.Stats(ctx)
+		return err
+	})
+	return stats, err
+}
+
+func (r *breakerUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	var u *domain.User
+	err := r.cb.Do(func() (err error) {
+		u, err = r.next.GetByID(ctx, id)
+		return err
+	})
+	return u, err
+}
+
+func (r *breakerUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	var u *domain.User
+	err := r.cb.Do(func() (err error) {
+		u, err = r.next.GetByEmail(ctx, email)
+		return err
+	})
+	return u, err
+}
+
+func (r *breakerUserRepository) Update(ctx context.Context, user *domain.User) error {
+	return r.cb.Do(func() error {
+		return r.next.Update(ctx, user)
+	})
+}
+
+func (r *breakerUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	return r.cb.Do(func() error {
+		return r.next.Restore(ctx, user)
+	})
+}
+
+func (r *breakerUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	return r.cb.Do(func() error {
+		return r.next.UpdatePasswordHash(ctx, id, oldHash, newHash)
+	})
+}
+
+func (r *breakerUserRepository) Create(ctx context.Context, user *domain.User) error {
+	return r.cb.Do(func() error {
+		return r.next.Create(ctx, user)
+	})
+}
+
+func (r *breakerUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.cb.Do(func() error {
+		return r.next.Delete(ctx, id)
+	})
+}
+
+func (r *breakerUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	return r.cb.Do(func() error {
+		return r.next.ClaimDeletion(ctx, id, now)
+	})
+}
+
+func (r *breakerUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	return r.cb.Do(func() error {
+		return r.next.DeleteScheduled(ctx, id, now)
+	})
+}
+
+func (r *breakerUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.cb.Do(func() (err error) {
+		users, err = r.next.Fetch(ctx, filter)
+		return err
+	})
+	return users, err
+}
+
+func (r *breakerUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	var n int64
+	err := r.cb.Do(func() (err error) {
+		n, err = r.next.Count(ctx, filter)
+		return err
+	})
+	return n, err
+}
+
+func (r *breakerUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.cb.Do(func() (err error) {
+		users, err = r.next.FetchDeletable(ctx, now, limit)
+		return err
+	})
+	return users, err
+}
@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/repository"
+)
+
+func TestBreakerUserRepository(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockUserRepository(controller)
+	tUser := tests.NewUser()
+	errBackend := errors.New("server selection timeout")
+
+	now := time.Now()
+	cb := store.NewCircuitBreaker("user", 1, time.Minute, zap.NewNop())
+	cb.SetClock(func() time.Time { return now })
+	r := repository.NewBreakerUserRepository(next, cb)
+
+	gomock.InOrder(
+		next.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(nil, domain.ErrNotFound),
+		next.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(nil, errBackend),
+		next.EXPECT().Fetch(gomock.Any(), domain.UserFilter{}).Return([]*domain.User{tUser}, nil),
+	)
+
+	// not found is not a backend failure
+	_, err := r.GetByEmail(noopCtx, tUser.Email)
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	_, err = r.GetByEmail(noopCtx, tUser.Email)
+	assert.ErrorIs(t, err, errBackend)
+
+	_, err = r.GetByID(noopCtx, tUser.ID)
+	assert.ErrorIs(t, err, domain.ErrUnavailable)
+	assert.ErrorIs(t, r.Create(noopCtx, tUser), domain.ErrUnavailable)
+	assert.ErrorIs(t, r.Update(noopCtx, tUser), domain.ErrUnavailable)
+	assert.ErrorIs(t, r.Delete(noopCtx, tUser.ID), domain.ErrUnavailable)
+
+	now = now.Add(time.Minute)
+	users, err := r.Fetch(noopCtx, domain.UserFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []*domain.User{tUser}, users)
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type cachedUserRepository struct {
+	next  domain.UserRepository
+	cache *store.Cache
+}
+
+// NewCachedUserRepository wraps repository with cache of users read by
+// GetByID to serve redirects, so status of URL owner doesn't reach backend on
+// every redirect. Other reads skip the cache and writes drop cached user, users
+// changed through other instances are seen after the ttl.
+func NewCachedUserRepository(next domain.UserRepository, cache *store.Cache) domain.UserRepository {
+	return &cachedUserRepository{
+		next:  next,
+		cache: cache,
+	}
+}
+
+func (r *cachedUserRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+func (r *cachedUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	return r.next.Stats(ctx)
+}
+
+func (r *cachedUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	if domain.ReadClassFromContext(ctx) != domain.ReadRedirect {
+		return r.next.GetByID(ctx, id)
+	}
+
+	key := id.Hex()
+	v, result := r.cache.Get(key)
+	switch result {
+	case store.CacheHit:
+		u := *v.(*domain.User)
+		return &u, nil
+	case store.CacheNegativeHit:
+		return nil, domain.NotFoundError(domain.EntityUser, key, "user was not found")
+	}
+
+	gen := r.cache.Generation()
+	u, err := r.next.GetByID(ctx, id)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		r.cache.SetMissing(key, gen)
+	case err == nil:
+		// cached user is copied, so callers can't change it
+		cached := *u
+		r.cache.Set(key, &cached, gen)
+	}
+
+	return u, err
+}
+
+func (r *cachedUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *cachedUserRepository) Update(ctx context.Context, user *domain.User) error {
+	defer r.cache.Delete(user.ID.Hex())
+	return r.next.Update(ctx, user)
+}
+
+func (r *cachedUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	defer r.cache.Delete(user.ID.Hex())
+	return r.next.Restore(ctx, user)
+}
+
+func (r *cachedUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	defer r.cache.Delete(id.Hex())
+	return r.next.UpdatePasswordHash(ctx, id, oldHash, newHash)
+}
+
+// Create drops cached miss of the id, so new user is found right away
+func (r *cachedUserRepository) Create(ctx context.Context, user *domain.User) error {
+	defer r.cache.Delete(user.ID.Hex())
+	return r.next.Create(ctx, user)
+}
+
+func (r *cachedUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	defer r.cache.Delete(id.Hex())
+	return r.next.Delete(ctx, id)
+}
+
+func (r *cachedUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	defer r.cache.Delete(id.Hex())
+	return r.next.ClaimDeletion(ctx, id, now)
+}
+
+func (r *cachedUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	defer r.cache.Delete(id.Hex())
+	return r.next.DeleteScheduled(ctx, id, now)
+}
+
+func (r *cachedUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	return r.next.Fetch(ctx, filter)
+}
+
+func (r *cachedUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	return r.next.Count(ctx, filter)
+}
+
+func (r *cachedUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	return r.next.FetchDeletable(ctx, now, limit)
+}
@@ -0,0 +1,82 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/repository"
+)
+
+func TestCachedUserRepository_GetByID(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockUserRepository(controller)
+	tUser := tests.NewUser()
+
+	cache := store.NewCache("user", time.Minute, time.Minute, 10)
+	r := repository.NewCachedUserRepository(next, cache)
+	redirectCtx := domain.WithReadClass(noopCtx, domain.ReadRedirect)
+
+	// redirects reach backend once, other reads every time
+	gomock.InOrder(
+		next.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil),
+		next.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil).Times(2),
+	)
+
+	for i := 0; i < 2; i++ {
+		u, err := r.GetByID(redirectCtx, tUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, u)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := r.GetByID(noopCtx, tUser.ID)
+		require.NoError(t, err)
+	}
+
+	// changes of returned user don't reach the cache
+	u, err := r.GetByID(redirectCtx, tUser.ID)
+	require.NoError(t, err)
+	u.DisabledAt = tests.DatePointer(time.Now())
+	u, err = r.GetByID(redirectCtx, tUser.ID)
+	require.NoError(t, err)
+	assert.False(t, u.IsDisabled())
+
+	assert.EqualValues(t, 1, cache.Lookups(store.CacheMiss))
+	assert.EqualValues(t, 3, cache.Lookups(store.CacheHit))
+}
+
+func TestCachedUserRepository_Update(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockUserRepository(controller)
+	tUser := tests.NewUser()
+	disabled := *tUser
+	disabled.DisabledAt = tests.DatePointer(time.Now())
+
+	cache := store.NewCache("user", time.Minute, time.Minute, 10)
+	r := repository.NewCachedUserRepository(next, cache)
+	redirectCtx := domain.WithReadClass(noopCtx, domain.ReadRedirect)
+
+	gomock.InOrder(
+		next.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil),
+		next.EXPECT().Update(gomock.Any(), &disabled).Return(nil),
+		next.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(&disabled, nil),
+	)
+
+	_, err := r.GetByID(redirectCtx, tUser.ID)
+	require.NoError(t, err)
+
+	// disabled owner is seen by the next redirect
+	require.NoError(t, r.Update(noopCtx, &disabled))
+	u, err := r.GetByID(redirectCtx, tUser.ID)
+	require.NoError(t, err)
+	assert.True(t, u.IsDisabled())
+}
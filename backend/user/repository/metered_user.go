@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/metrics"
+)
+
+type meteredUserRepository struct {
+	next    domain.UserRepository
+	metrics *metrics.RepositoryMetrics
+}
+
+// NewMeteredUserRepository wraps repository and records duration and errors
+// of its operations
+func NewMeteredUserRepository(next domain.UserRepository, m *metrics.RepositoryMetrics) domain.UserRepository {
+	return &meteredUserRepository{
+		next:    next,
+		metrics: m,
+	}
+}
+
+func (r *meteredUserRepository) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := r.next.Ping(ctx)
+	r.metrics.Record(ctx, "user.Ping", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	start := time.Now()
+	res, err := r.next.Stats(ctx)
+	r.metrics.Record(ctx, "user.Stats", start, err)
+	return res, err
+}
+
+func (r *meteredUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	start := time.Now()
+	res, err := r.next.GetByID(ctx, id)
+	r.metrics.Record(ctx, "user.GetByID", start, err)
+	return res, err
+}
+
+func (r *meteredUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	start := time.Now()
+	res, err := r.next.GetByEmail(ctx, email)
+	r.metrics.Record(ctx, "user.GetByEmail", start, err)
+	return res, err
+}
+
+func (r *meteredUserRepository) Update(ctx context.Context, user *domain.User) error {
+	start := time.Now()
+	err := r.next.Update(ctx, user)
+	r.metrics.Record(ctx, "user.Update", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	start := time.Now()
+	err := r.next.Restore(ctx, user)
+	r.metrics.Record(ctx, "user.Restore", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	start := time.Now()
+	err := r.next.UpdatePasswordHash(ctx, id, oldHash, newHash)
+	r.metrics.Record(ctx, "user.UpdatePasswordHash", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) Create(ctx context.Context, user *domain.User) error {
+	start := time.Now()
+	err := r.next.Create(ctx, user)
+	r.metrics.Record(ctx, "user.Create", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	start := time.Now()
+	err := r.next.Delete(ctx, id)
+	r.metrics.Record(ctx, "user.Delete", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	start := time.Now()
+	err := r.next.ClaimDeletion(ctx, id, now)
+	r.metrics.Record(ctx, "user.ClaimDeletion", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	start := time.Now()
+	err := r.next.DeleteScheduled(ctx, id, now)
+	r.metrics.Record(ctx, "user.DeleteScheduled", start, err)
+	return err
+}
+
+func (r *meteredUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	start := time.Now()
+	res, err := r.next.Fetch(ctx, filter)
+	r.metrics.Record(ctx, "user.Fetch", start, err)
+	return res, err
+}
+
+func (r *meteredUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	start := time.Now()
+	res, err := r.next.Count(ctx, filter)
+	r.metrics.Record(ctx, "user.Count", start, err)
+	return res, err
+}
+
+func (r *meteredUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	start := time.Now()
+	res, err := r.next.FetchDeletable(ctx, now, limit)
+	r.metrics.Record(ctx, "user.FetchDeletable", start, err)
+	return res, err
+}
@@ -0,0 +1,55 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/semka95/shortener/backend/metrics"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/repository"
+)
+
+func TestMeteredUserRepository(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m, err := metrics.NewRepositoryMetrics(metrics.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	require.NoError(t, err)
+	r := repository.NewMeteredUserRepository(tests.NewMemoryUserRepository(), m)
+	tUser := tests.NewUser()
+
+	require.NoError(t, r.Create(noopCtx, tUser))
+	err = r.Update(noopCtx, tests.NewUser())
+	require.NoError(t, err)
+	err = r.Delete(noopCtx, tUser.ID)
+	require.NoError(t, err)
+	err = r.Update(noopCtx, tUser)
+	require.Error(t, err)
+
+	rm, err := reader.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	durations := make(map[string]uint64)
+	for _, metric := range rm.ScopeMetrics[0].Metrics {
+		if metric.Name != "repository_operation_duration_milliseconds" {
+			continue
+		}
+		for _, dp := range metric.Data.(metricdata.Histogram).DataPoints {
+			op, _ := dp.Attributes.Value(attribute.Key("operation"))
+			outcome, _ := dp.Attributes.Value(attribute.Key("outcome"))
+			durations[op.AsString()+" "+outcome.AsString()] = dp.Count
+		}
+	}
+
+	assert.Equal(t, map[string]uint64{
+		"user.Create success":   1,
+		"user.Update success":   1,
+		"user.Update not_found": 1,
+		"user.Delete success":   1,
+	}, durations)
+}
@@ -3,31 +3,70 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/semka95/shortener/backend/domain"
 	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tracing"
 )
 
+// emailCollation compares emails case-insensitively, unique email index has
+// it, so queries by email must use it to be served by the index
+var emailCollation = bson.D{
+	primitive.E{Key: "locale", Value: "en"},
+	primitive.E{Key: "strength", Value: 2},
+}
+
 type mongoUserRepository struct {
 	Conn   *mongo.Database
+	cols   store.Collections
 	logger *zap.Logger
 	tracer trace.Tracer
 }
 
 // NewMongoUserRepository will create an object that represent the user.Repository interface
-func NewMongoUserRepository(c *mongo.Client, db string, logger *zap.Logger, tracer trace.Tracer) domain.UserRepository {
+func NewMongoUserRepository(c *mongo.Client, db string, cols store.Collections, logger *zap.Logger, tracer trace.Tracer) domain.UserRepository {
 	return &mongoUserRepository{
 		Conn:   c.Database(db),
+		cols:   cols,
 		logger: logger,
-		tracer: tracer,
+		tracer: tracing.Tracer(tracer),
+	}
+}
+
+func (m *mongoUserRepository) Ping(ctx context.Context) error {
+	ctx, span := m.tracer.Start(ctx, "repository Ping")
+	defer span.End()
+
+	if err := m.Conn.Client().Ping(ctx, readpref.Primary()); err != nil {
+		span.RecordError(err)
+		return domain.InternalError("user storage ping error", err)
 	}
+
+	return nil
+}
+
+// Stats counts users by collection metadata, so it is cheap however many
+// users there are
+func (m *mongoUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	ctx, span := m.tracer.Start(ctx, "repository Stats")
+	defer span.End()
+
+	n, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).EstimatedDocumentCount(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("user count error", err)
+	}
+
+	return &domain.RepositoryStats{Documents: n}, nil
 }
 
 func (m *mongoUserRepository) fetch(ctx context.Context, command interface{}) ([]*domain.User, error) {
@@ -77,7 +116,7 @@ func (m *mongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID
 	defer span.End()
 
 	command := bson.D{
-		primitive.E{Key: "find", Value: "user"},
+		primitive.E{Key: "find", Value: m.cols.Name(store.UserCollection)},
 		primitive.E{Key: "limit", Value: 1},
 		primitive.E{Key: "filter", Value: bson.D{primitive.E{Key: "_id", Value: id}}},
 	}
@@ -85,12 +124,12 @@ func (m *mongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID
 	list, err := m.fetch(ctx, command)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("user get error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return nil, domain.InternalError("user get error", err)
 	}
 
 	if len(list) == 0 {
 		span.RecordError(domain.ErrNotFound)
-		return nil, fmt.Errorf("user was not found: %w", domain.ErrNotFound)
+		return nil, domain.NotFoundError(domain.EntityUser, id.Hex(), "user was not found")
 	}
 
 	return list[0], nil
@@ -105,10 +144,14 @@ func (m *mongoUserRepository) Create(ctx context.Context, user *domain.User) err
 	)
 	defer span.End()
 
-	_, err := m.Conn.Collection("user").InsertOne(ctx, user)
+	_, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return domain.NewError(domain.ErrEmailTaken, fmt.Sprintf("user with email %s already exists", user.Email)).WithField("email")
+	}
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("user store error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return domain.InternalError("user store error", err)
 	}
 
 	return nil
@@ -127,20 +170,84 @@ func (m *mongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID)
 		primitive.E{Key: "_id", Value: id},
 	}
 
-	delRes, err := m.Conn.Collection("user").DeleteOne(ctx, filter)
+	delRes, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).DeleteOne(ctx, filter)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("user delete error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return domain.InternalError("user delete error", err)
 	}
 
 	if delRes.DeletedCount == 0 {
-		err = fmt.Errorf("user was not deleted: %w", domain.ErrNoAffected)
+		err = domain.NewError(domain.ErrNoAffected, "user was not deleted").WithEntity(domain.EntityUser, id.Hex())
 		span.RecordError(err)
 		return err
 	}
 
 	return nil
 }
+
+func (m *mongoUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository ClaimDeletion",
+		trace.WithAttributes(
+			attribute.String("userid", id.Hex())),
+	)
+	defer span.End()
+
+	// the filter makes the claim atomic with Restore, which clears
+	// delete_after only while deleting_at is not set
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "delete_after", Value: bson.D{primitive.E{Key: "$lte", Value: now.UTC()}}},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "deleting_at", Value: now.UTC()},
+	}}}
+
+	updRes, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).UpdateOne(ctx, filter, update)
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("user claim deletion error", err)
+	}
+
+	if updRes.MatchedCount == 0 {
+		err = domain.NewError(domain.ErrNoAffected, "user deletion was not claimed").WithEntity(domain.EntityUser, id.Hex())
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository DeleteScheduled",
+		trace.WithAttributes(
+			attribute.String("userid", id.Hex())),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "delete_after", Value: bson.D{primitive.E{Key: "$lte", Value: now.UTC()}}},
+	}
+
+	delRes, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).DeleteOne(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("user delete error", err)
+	}
+
+	if delRes.DeletedCount == 0 {
+		err = domain.NewError(domain.ErrNoAffected, "user was not deleted").WithEntity(domain.EntityUser, id.Hex())
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
 func (m *mongoUserRepository) Update(ctx context.Context, user *domain.User) error {
 	ctx, span := m.tracer.Start(
 		ctx,
@@ -157,18 +264,90 @@ func (m *mongoUserRepository) Update(ctx context.Context, user *domain.User) err
 	doc, err := store.StructToDoc(&user)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("can't convert User to bson.D: %w, %s", domain.ErrInternalServerError, err.Error())
+		return domain.InternalError("can't convert User to bson.D", err)
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: doc}}
+
+	updRes, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		span.RecordError(err)
+		return domain.NewError(domain.ErrEmailTaken, fmt.Sprintf("user with email %s already exists", user.Email)).WithField("email")
+	}
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("user update error", err)
+	}
+
+	if updRes.ModifiedCount == 0 {
+		err = domain.NewError(domain.ErrNoAffected, "user was not updated").WithEntity(domain.EntityUser, user.ID.Hex())
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Restore",
+		trace.WithAttributes(
+			attribute.String("userid", user.ID.Hex())),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: user.ID},
+		primitive.E{Key: "deleting_at", Value: nil},
+	}
+
+	doc, err := store.StructToDoc(&user)
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("can't convert User to bson.D", err)
 	}
 	update := bson.D{primitive.E{Key: "$set", Value: doc}}
 
-	updRes, err := m.Conn.Collection("user").UpdateOne(ctx, filter, update)
+	updRes, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).UpdateOne(ctx, filter, update)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("user update error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return domain.InternalError("user restore error", err)
 	}
 
 	if updRes.ModifiedCount == 0 {
-		err = fmt.Errorf("user was not updated: %w", domain.ErrNoAffected)
+		err = domain.NewError(domain.ErrNoAffected, "user was not restored").WithEntity(domain.EntityUser, user.ID.Hex())
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (m *mongoUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository UpdatePasswordHash",
+		trace.WithAttributes(
+			attribute.String("userid", id.Hex())),
+	)
+	defer span.End()
+
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "hashed_password", Value: oldHash},
+	}
+	update := bson.D{primitive.E{Key: "$set", Value: bson.D{
+		primitive.E{Key: "hashed_password", Value: newHash},
+	}}}
+
+	updRes, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).UpdateOne(ctx, filter, update)
+	if err != nil {
+		span.RecordError(err)
+		return domain.InternalError("user password update error", err)
+	}
+
+	if updRes.ModifiedCount == 0 {
+		err = domain.NewError(domain.ErrNoAffected, "user password was not updated").WithEntity(domain.EntityUser, id.Hex())
 		span.RecordError(err)
 		return err
 	}
@@ -184,23 +363,140 @@ func (m *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*do
 	defer span.End()
 
 	command := bson.D{
-		primitive.E{Key: "find", Value: "user"},
+		primitive.E{Key: "find", Value: m.cols.Name(store.UserCollection)},
 		primitive.E{Key: "limit", Value: 1},
 		primitive.E{Key: "filter", Value: bson.D{primitive.E{Key: "email", Value: email}}},
+		primitive.E{Key: "collation", Value: emailCollation},
 	}
 
 	list, err := m.fetch(ctx, command)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("user get error: %w: %s", domain.ErrInternalServerError, err.Error())
+		return nil, domain.InternalError("user get error", err)
 	}
 
 	if len(list) == 0 {
 		span.RecordError(domain.ErrNotFound)
-		return nil, fmt.Errorf("user with email %s was not found: %w", email, domain.ErrNotFound)
+		return nil, domain.NewError(domain.ErrNotFound, fmt.Sprintf("user with email %s was not found", email)).WithField("email")
 	}
 
 	span.SetAttributes(attribute.String("userid", list[0].ID.Hex()))
 
 	return list[0], nil
 }
+
+func (m *mongoUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Fetch",
+		trace.WithAttributes(
+			attribute.String("status", filter.Status),
+			attribute.String("type", filter.Type)),
+	)
+	defer span.End()
+
+	query := filterQuery(filter)
+	// users before cursor are fetched in reverse order and reversed back
+	order := 1
+	cursorID, op := filter.Cursor, "$gt"
+	if filter.Before != "" {
+		cursorID, op, order = filter.Before, "$lt", -1
+	}
+	if cursorID != "" {
+		cursor, err := primitive.ObjectIDFromHex(cursorID)
+		if err != nil {
+			span.RecordError(err)
+			return nil, domain.NewError(domain.ErrBadParamInput, "cursor is not valid ObjectID").WithField("cursor").Wrap(err)
+		}
+		query = append(query, primitive.E{Key: "_id", Value: bson.D{primitive.E{Key: op, Value: cursor}}})
+	}
+
+	command := bson.D{
+		primitive.E{Key: "find", Value: m.cols.Name(store.UserCollection)},
+		primitive.E{Key: "filter", Value: query},
+		primitive.E{Key: "sort", Value: bson.D{primitive.E{Key: "_id", Value: order}}},
+		primitive.E{Key: "limit", Value: filter.Limit},
+	}
+
+	list, err := m.fetch(ctx, command)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("user fetch error", err)
+	}
+
+	if order < 0 {
+		for l, r := 0, len(list)-1; l < r; l, r = l+1, r-1 {
+			list[l], list[r] = list[r], list[l]
+		}
+	}
+
+	return list, nil
+}
+
+func (m *mongoUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository Count",
+		trace.WithAttributes(
+			attribute.String("status", filter.Status),
+			attribute.String("type", filter.Type)),
+	)
+	defer span.End()
+
+	n, err := m.Conn.Collection(m.cols.Name(store.UserCollection)).CountDocuments(ctx, filterQuery(filter))
+	if err != nil {
+		span.RecordError(err)
+		return 0, domain.InternalError("user count error", err)
+	}
+
+	return n, nil
+}
+
+func (m *mongoUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	ctx, span := m.tracer.Start(
+		ctx,
+		"repository FetchDeletable",
+	)
+	defer span.End()
+
+	command := bson.D{
+		primitive.E{Key: "find", Value: m.cols.Name(store.UserCollection)},
+		primitive.E{Key: "filter", Value: bson.D{
+			primitive.E{Key: "delete_after", Value: bson.D{primitive.E{Key: "$lte", Value: now.UTC()}}},
+		}},
+		primitive.E{Key: "sort", Value: bson.D{primitive.E{Key: "delete_after", Value: 1}}},
+		primitive.E{Key: "limit", Value: limit},
+	}
+
+	list, err := m.fetch(ctx, command)
+	if err != nil {
+		span.RecordError(err)
+		return nil, domain.InternalError("user fetch error", err)
+	}
+
+	return list, nil
+}
+
+// filterQuery returns query that matches users with status and type of the
+// filter
+func filterQuery(filter domain.UserFilter) bson.D {
+	query := bson.D{}
+	switch filter.Status {
+	case domain.UserStatusActive:
+		query = append(query, primitive.E{Key: "disabled_at", Value: nil})
+	case domain.UserStatusDisabled:
+		query = append(query, primitive.E{Key: "disabled_at", Value: bson.D{primitive.E{Key: "$ne", Value: nil}}})
+	}
+	// users have no type stored
+	switch filter.Type {
+	case domain.UserTypeUser:
+		query = append(query, primitive.E{Key: "type", Value: bson.D{primitive.E{Key: "$ne", Value: domain.UserTypeService}}})
+	case domain.UserTypeService:
+		query = append(query, primitive.E{Key: "type", Value: domain.UserTypeService})
+	}
+	if filter.ClickRetention {
+		query = append(query, primitive.E{Key: "settings.click_retention_days", Value: bson.D{primitive.E{Key: "$gt", Value: 0}}})
+	}
+
+	return query
+}
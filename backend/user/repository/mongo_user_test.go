@@ -3,14 +3,17 @@ package repository_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
 	"github.com/semka95/shortener/backend/tests"
 	"github.com/semka95/shortener/backend/user/repository"
 )
@@ -32,12 +35,16 @@ func TestMongoUserRepository_GetByID(t *testing.T) {
 			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch),
 			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
 		)
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByID(noopCtx, tUser.ID)
 
 		assert.Nil(mt, result)
 		assert.ErrorIs(mt, err, domain.ErrNotFound)
+		var de *domain.Error
+		require.ErrorAs(mt, err, &de)
+		assert.Equal(mt, domain.EntityUser, de.Entity)
+		assert.Equal(mt, tUser.ID.Hex(), de.ID)
 	})
 
 	mt.Run("success", func(mt *mtest.T) {
@@ -45,7 +52,7 @@ func TestMongoUserRepository_GetByID(t *testing.T) {
 			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tUserBsonD),
 			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
 		)
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByID(noopCtx, tUser.ID)
 
@@ -59,7 +66,7 @@ func TestMongoUserRepository_GetByID(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByID(noopCtx, tUser.ID)
 
@@ -75,7 +82,7 @@ func TestMongoUserRepository_Create(t *testing.T) {
 
 	mt.Run("success", func(mt *mtest.T) {
 		mt.AddMockResponses(mtest.CreateSuccessResponse())
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Create(noopCtx, tUser)
 
@@ -88,12 +95,29 @@ func TestMongoUserRepository_Create(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Create(noopCtx, tUser)
 
 		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
 	})
+
+	mt.Run("duplicate email", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Create(noopCtx, tUser)
+
+		assert.ErrorIs(mt, err, domain.ErrConflict)
+		assert.ErrorIs(mt, err, domain.ErrEmailTaken)
+		var de *domain.Error
+		require.ErrorAs(mt, err, &de)
+		assert.Equal(mt, "email", de.Field)
+	})
 }
 
 func TestMongoUserRepository_Delete(t *testing.T) {
@@ -109,7 +133,7 @@ func TestMongoUserRepository_Delete(t *testing.T) {
 				{Key: "n", Value: 0},
 			},
 		)
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Delete(noopCtx, tUser.ID)
 
@@ -124,7 +148,7 @@ func TestMongoUserRepository_Delete(t *testing.T) {
 				{Key: "n", Value: 1},
 			},
 		)
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Delete(noopCtx, tUser.ID)
 
@@ -137,7 +161,7 @@ func TestMongoUserRepository_Delete(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Delete(noopCtx, tUser.ID)
 
@@ -145,6 +169,124 @@ func TestMongoUserRepository_Delete(t *testing.T) {
 	})
 }
 
+func TestMongoUserRepository_DeleteScheduled(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tUser := tests.NewUser()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+
+	mt.Run("not scheduled", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "acknowledged", Value: true},
+				{Key: "n", Value: 0},
+			},
+		)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.DeleteScheduled(noopCtx, tUser.ID, now)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "acknowledged", Value: true},
+				{Key: "n", Value: 1},
+			},
+		)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.DeleteScheduled(noopCtx, tUser.ID, now)
+
+		require.NoError(mt, err)
+		filter := mt.GetStartedEvent().Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, now, filter.Lookup("delete_after", "$lte").Time().UTC())
+	})
+}
+
+func TestMongoUserRepository_ClaimDeletion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tUser := tests.NewUser()
+	now := time.Now().Truncate(time.Millisecond).UTC()
+
+	mt.Run("not scheduled", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+			{Key: "nModified", Value: 0},
+		})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.ClaimDeletion(noopCtx, tUser.ID, now)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.ClaimDeletion(noopCtx, tUser.ID, now)
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, now, update.Lookup("q", "delete_after", "$lte").Time().UTC())
+		assert.Equal(mt, now, update.Lookup("u", "$set", "deleting_at").Time().UTC())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.ClaimDeletion(noopCtx, tUser.ID, now)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoUserRepository_Restore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tUser := tests.NewUser()
+
+	mt.Run("being deleted", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+			{Key: "nModified", Value: 0},
+		})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Restore(noopCtx, tUser)
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		assert.Equal(mt, bson.TypeNull, filter.Lookup("deleting_at").Type)
+	})
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Restore(noopCtx, tUser)
+
+		require.NoError(mt, err)
+	})
+}
+
 func TestMongoUserRepository_Update(t *testing.T) {
 	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
@@ -156,7 +298,7 @@ func TestMongoUserRepository_Update(t *testing.T) {
 			{Key: "ok", Value: 1},
 			{Key: "nModified", Value: 0},
 		})
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Update(noopCtx, tUser)
 
@@ -169,7 +311,7 @@ func TestMongoUserRepository_Update(t *testing.T) {
 			{Key: "value", Value: tUserBsonD},
 			{Key: "nModified", Value: 1},
 		})
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Update(noopCtx, tUser)
 
@@ -182,12 +324,73 @@ func TestMongoUserRepository_Update(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		err := r.Update(noopCtx, tUser)
 
 		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
 	})
+
+	mt.Run("duplicate email", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "duplicate key error",
+		}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Update(noopCtx, tUser)
+
+		assert.ErrorIs(mt, err, domain.ErrEmailTaken)
+	})
+}
+
+func TestMongoUserRepository_UpdatePasswordHash(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tUser := tests.NewUser()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 1},
+			{Key: "nModified", Value: 1},
+		})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdatePasswordHash(noopCtx, tUser.ID, tUser.HashedPassword, "new hash")
+
+		require.NoError(mt, err)
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(mt, tUser.HashedPassword, update.Lookup("q", "hashed_password").StringValue())
+		assert.Equal(mt, "new hash", update.Lookup("u", "$set", "hashed_password").StringValue())
+	})
+
+	mt.Run("password changed", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "n", Value: 0},
+			{Key: "nModified", Value: 0},
+		})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdatePasswordHash(noopCtx, tUser.ID, tUser.HashedPassword, "new hash")
+
+		assert.ErrorIs(mt, err, domain.ErrNoAffected)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   1,
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.UpdatePasswordHash(noopCtx, tUser.ID, tUser.HashedPassword, "new hash")
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
 }
 
 //nolint:dupl // test getbyid and getbyemail separately
@@ -202,7 +405,7 @@ func TestMongoUserRepository_GetByEmail(t *testing.T) {
 			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch),
 			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
 		)
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByEmail(noopCtx, tUser.Email)
 
@@ -215,12 +418,15 @@ func TestMongoUserRepository_GetByEmail(t *testing.T) {
 			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tUserBsonD),
 			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
 		)
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByEmail(noopCtx, tUser.Email)
 
 		assert.NoError(mt, err)
 		assert.EqualValues(t, tUser, result)
+		collation := mt.GetStartedEvent().Command.Lookup("collation").Document()
+		assert.Equal(mt, "en", collation.Lookup("locale").StringValue())
+		assert.EqualValues(mt, 2, collation.Lookup("strength").AsInt64())
 	})
 
 	mt.Run("server error", func(mt *mtest.T) {
@@ -229,7 +435,7 @@ func TestMongoUserRepository_GetByEmail(t *testing.T) {
 			Code:    123,
 			Message: "server error",
 		}))
-		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), nil, tracer)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
 
 		result, err := r.GetByEmail(noopCtx, tUser.Email)
 
@@ -237,3 +443,226 @@ func TestMongoUserRepository_GetByEmail(t *testing.T) {
 		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
 	})
 }
+
+func TestMongoUserRepository_Fetch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tUser := tests.NewUser()
+	tUserBsonD := tests.NewUserBsonD()
+
+	mt.Run("success disabled with cursor", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tUserBsonD),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		filter := domain.UserFilter{Status: domain.UserStatusDisabled, Cursor: "507f191e810c19729de860e0", Limit: 10}
+		result, err := r.Fetch(noopCtx, filter)
+
+		require.NoError(mt, err)
+		require.Len(mt, result, 1)
+		assert.EqualValues(t, tUser, result[0])
+
+		command := mt.GetStartedEvent().Command
+		query := command.Lookup("filter").Document()
+		assert.Equal(mt, "$ne", query.Lookup("disabled_at").Document().Index(0).Key())
+		assert.NotNil(mt, query.Lookup("_id", "$gt"))
+		assert.Equal(mt, int64(10), command.Lookup("limit").Int64())
+	})
+
+	mt.Run("success before cursor", func(mt *mtest.T) {
+		second := tests.NewUserBsonD()
+		secondID, _ := primitive.ObjectIDFromHex("507f191e810c19729de860e9")
+		second[0].Value = secondID
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tUserBsonD, second),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		filter := domain.UserFilter{Before: "507f191e810c19729de860eb", Limit: 2}
+		result, err := r.Fetch(noopCtx, filter)
+
+		require.NoError(mt, err)
+		require.Len(mt, result, 2)
+		assert.Equal(mt, secondID, result[0].ID)
+		assert.Equal(mt, tUser.ID, result[1].ID)
+
+		command := mt.GetStartedEvent().Command
+		assert.NotNil(mt, command.Lookup("filter", "_id", "$lt"))
+		assert.Equal(mt, int32(-1), command.Lookup("sort", "_id").Int32())
+	})
+
+	mt.Run("success by type", func(mt *mtest.T) {
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch))
+		_, err := r.Fetch(noopCtx, domain.UserFilter{Type: domain.UserTypeService})
+		require.NoError(mt, err)
+		assert.Equal(mt, domain.UserTypeService, mt.GetStartedEvent().Command.Lookup("filter", "type").StringValue())
+
+		// users have no type stored
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch))
+		_, err = r.Fetch(noopCtx, domain.UserFilter{Type: domain.UserTypeUser})
+		require.NoError(mt, err)
+		assert.Equal(mt, domain.UserTypeService, mt.GetStartedEvent().Command.Lookup("filter", "type", "$ne").StringValue())
+	})
+
+	mt.Run("success with click retention", func(mt *mtest.T) {
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, tableName, mtest.FirstBatch))
+		_, err := r.Fetch(noopCtx, domain.UserFilter{ClickRetention: true})
+		require.NoError(mt, err)
+		assert.Equal(mt, int32(0), mt.GetStartedEvent().Command.Lookup("filter", "settings.click_retention_days", "$gt").Int32())
+	})
+
+	mt.Run("invalid cursor", func(mt *mtest.T) {
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.Fetch(noopCtx, domain.UserFilter{Cursor: "wrong"})
+
+		assert.Nil(mt, result)
+		assert.ErrorIs(mt, err, domain.ErrBadParamInput)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   1,
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.Fetch(noopCtx, domain.UserFilter{Status: domain.UserStatusActive})
+
+		assert.Nil(mt, result)
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoUserRepository_FetchDeletable(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	tUser := tests.NewUser()
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, tests.NewUserBsonD()),
+			mtest.CreateCursorResponse(0, tableName, mtest.NextBatch),
+		)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.FetchDeletable(noopCtx, now, 50)
+
+		require.NoError(mt, err)
+		require.Len(mt, result, 1)
+		assert.EqualValues(t, tUser, result[0])
+
+		command := mt.GetStartedEvent().Command
+		assert.Equal(mt, now, command.Lookup("filter", "delete_after", "$lte").Time().UTC())
+		assert.Equal(mt, int32(1), command.Lookup("sort", "delete_after").Int32())
+		assert.Equal(mt, int64(50), command.Lookup("limit").Int64())
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		result, err := r.FetchDeletable(noopCtx, now, 50)
+
+		assert.Nil(mt, result)
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoUserRepository_Count(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, tableName, mtest.FirstBatch, bson.D{{Key: "n", Value: int32(3)}}),
+		)
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.Count(noopCtx, domain.UserFilter{Status: domain.UserStatusDisabled, Cursor: "507f191e810c19729de860e0"})
+
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(3), n)
+
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline").Array()
+		match := pipeline.Index(0).Value().Document().Lookup("$match").Document()
+		assert.NotNil(mt, match.Lookup("disabled_at", "$ne"))
+		_, err = match.LookupErr("_id")
+		assert.Error(mt, err)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    123,
+			Message: "server error",
+		}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		n, err := r.Count(noopCtx, domain.UserFilter{})
+
+		assert.Zero(mt, n)
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoUserRepository_Ping(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Ping(noopCtx)
+
+		require.NoError(mt, err)
+		assert.Equal(mt, "ping", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		err := r.Ping(noopCtx)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+	})
+}
+
+func TestMongoUserRepository_Stats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: int64(42)}))
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.Stats(noopCtx)
+
+		require.NoError(mt, err)
+		assert.EqualValues(mt, 42, stats.Documents)
+		assert.Equal(mt, "user", mt.GetStartedEvent().Command.Lookup("count").StringValue())
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+		r := repository.NewMongoUserRepository(mt.Client, mt.DB.Name(), store.Collections{}, nil, tracer)
+
+		stats, err := r.Stats(noopCtx)
+
+		assert.ErrorIs(mt, err, domain.ErrInternalServerError)
+		assert.Nil(mt, stats)
+	})
+}
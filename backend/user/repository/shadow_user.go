@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+type shadowUserRepository struct {
+	primary   domain.UserRepository
+	secondary domain.UserRepository
+	shadow    *store.Shadow
+}
+
+// NewShadowUserRepository wraps primary repository with shadow, so reads are
+// repeated against secondary in background and writes are copied to it.
+// Callers get results and errors of primary only.
+func NewShadowUserRepository(primary, secondary domain.UserRepository, shadow *store.Shadow) domain.UserRepository {
+	return &shadowUserRepository{
+		primary:   primary,
+		secondary: secondary,
+		shadow:    shadow,
+	}
+}
+
+func (r *shadowUserRepository) Ping(ctx context.Context) error {
+	return r.primary.Ping(ctx)
+}
+
+func (r *shadowUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	return r.primary.Stats(ctx)
+}
+
+func (r *shadowUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	user, err := r.primary.GetByID(ctx, id)
+	r.shadow.Read("GetByID", user, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.GetByID(ctx, id)
+	})
+	return user, err
+}
+
+func (r *shadowUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := r.primary.GetByEmail(ctx, email)
+	r.shadow.Read("GetByEmail", user, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.GetByEmail(ctx, email)
+	})
+	return user, err
+}
+
+func (r *shadowUserRepository) Update(ctx context.Context, user *domain.User) error {
+	if err := r.primary.Update(ctx, user); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Update", func(ctx context.Context) error {
+		return r.secondary.Update(ctx, user)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	if err := r.primary.Restore(ctx, user); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Restore", func(ctx context.Context) error {
+		return r.secondary.Restore(ctx, user)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	if err := r.primary.UpdatePasswordHash(ctx, id, oldHash, newHash); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "UpdatePasswordHash", func(ctx context.Context) error {
+		return r.secondary.UpdatePasswordHash(ctx, id, oldHash, newHash)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) Create(ctx context.Context, user *domain.User) error {
+	if err := r.primary.Create(ctx, user); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Create", func(ctx context.Context) error {
+		return r.secondary.Create(ctx, user)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if err := r.primary.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "Delete", func(ctx context.Context) error {
+		return r.secondary.Delete(ctx, id)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	if err := r.primary.ClaimDeletion(ctx, id, now); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "ClaimDeletion", func(ctx context.Context) error {
+		return r.secondary.ClaimDeletion(ctx, id, now)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	if err := r.primary.DeleteScheduled(ctx, id, now); err != nil {
+		return err
+	}
+	r.shadow.Write(ctx, "DeleteScheduled", func(ctx context.Context) error {
+		return r.secondary.DeleteScheduled(ctx, id, now)
+	})
+	return nil
+}
+
+func (r *shadowUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	users, err := r.primary.Fetch(ctx, filter)
+	r.shadow.Read("Fetch", users, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.Fetch(ctx, filter)
+	})
+	return users, err
+}
+
+func (r *shadowUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	n, err := r.primary.Count(ctx, filter)
+	r.shadow.Read("Count", n, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.Count(ctx, filter)
+	})
+	return n, err
+}
+
+func (r *shadowUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	users, err := r.primary.FetchDeletable(ctx, now, limit)
+	r.shadow.Read("FetchDeletable", users, err, func(ctx context.Context) (interface{}, error) {
+		return r.secondary.FetchDeletable(ctx, now, limit)
+	})
+	return users, err
+}
@@ -0,0 +1,46 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/repository"
+)
+
+func TestShadowUserRepository(t *testing.T) {
+	primary := tests.NewMemoryUserRepository()
+	secondary := tests.NewMemoryUserRepository()
+	shadow := store.NewShadow("user", time.Second, time.Second, 100, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go shadow.Run(ctx)
+	r := repository.NewShadowUserRepository(primary, secondary, shadow)
+	tUser := tests.NewUser()
+
+	require.NoError(t, r.Create(noopCtx, tUser))
+	u, err := r.GetByEmail(noopCtx, tUser.Email)
+	require.NoError(t, err)
+	assert.Equal(t, tUser.ID, u.ID)
+	require.Eventually(t, func() bool { return shadow.Reads(store.ShadowMatch) == 1 }, time.Second, time.Millisecond)
+
+	// roles diverge
+	diverged := *tUser
+	diverged.Roles = []string{"admin"}
+	require.NoError(t, secondary.Update(noopCtx, &diverged))
+	_, err = r.Fetch(noopCtx, domain.UserFilter{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return shadow.Reads(store.ShadowMismatch) == 1 }, time.Second, time.Millisecond)
+
+	// failed secondary write is not returned
+	require.NoError(t, secondary.Delete(noopCtx, tUser.ID))
+	require.NoError(t, r.Delete(noopCtx, tUser.ID))
+	assert.EqualValues(t, 1, shadow.WriteErrors())
+}
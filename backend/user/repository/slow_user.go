@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+)
+
+const userCollection = "user"
+
+type slowUserRepository struct {
+	next domain.UserRepository
+	slow *store.SlowOpLogger
+}
+
+// NewSlowUserRepository wraps repository and logs its operations that exceed
+// SlowOpLogger threshold
+func NewSlowUserRepository(next domain.UserRepository, slow *store.SlowOpLogger) domain.UserRepository {
+	return &slowUserRepository{
+		next: next,
+		slow: slow,
+	}
+}
+
+func (r *slowUserRepository) Ping(ctx context.Context) error {
+	defer r.slow.Start(ctx, "Ping", userCollection, nil)()
+	return r.next.Ping(ctx)
+}
+
+func (r *slowUserRepository) Stats(ctx context.Context) (*domain.RepositoryStats, error) {
+	defer r.slow.Start(ctx, "Stats", userCollection, nil)()
+	return r.next.Stats(ctx)
+}
+
+func (r *slowUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+	defer r.slow.Start(ctx, "GetByID", userCollection, id.Hex())()
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *slowUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	defer r.slow.Start(ctx, "GetByEmail", userCollection, email)()
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *slowUserRepository) Update(ctx context.Context, user *domain.User) error {
+	defer r.slow.Start(ctx, "Update", userCollection, user.ID.Hex())()
+	return r.next.Update(ctx, user)
+}
+
+func (r *slowUserRepository) Restore(ctx context.Context, user *domain.User) error {
+	defer r.slow.Start(ctx, "Restore", userCollection, user.ID.Hex())()
+	return r.next.Restore(ctx, user)
+}
+
+func (r *slowUserRepository) UpdatePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	defer r.slow.Start(ctx, "UpdatePasswordHash", userCollection, id.Hex())()
+	return r.next.UpdatePasswordHash(ctx, id, oldHash, newHash)
+}
+
+func (r *slowUserRepository) Create(ctx context.Context, user *domain.User) error {
+	defer r.slow.Start(ctx, "Create", userCollection, user.ID.Hex())()
+	return r.next.Create(ctx, user)
+}
+
+func (r *slowUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	defer r.slow.Start(ctx, "Delete", userCollection, id.Hex())()
+	return r.next.Delete(ctx, id)
+}
+
+func (r *slowUserRepository) ClaimDeletion(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	defer r.slow.Start(ctx, "ClaimDeletion", userCollection, id.Hex())()
+	return r.next.ClaimDeletion(ctx, id, now)
+}
+
+func (r *slowUserRepository) DeleteScheduled(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	defer r.slow.Start(ctx, "DeleteScheduled", userCollection, id.Hex())()
+	return r.next.DeleteScheduled(ctx, id, now)
+}
+
+func (r *slowUserRepository) Fetch(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+	defer r.slow.Start(ctx, "Fetch", userCollection, filter)()
+	return r.next.Fetch(ctx, filter)
+}
+
+func (r *slowUserRepository) Count(ctx context.Context, filter domain.UserFilter) (int64, error) {
+	defer r.slow.Start(ctx, "Count", userCollection, filter)()
+	return r.next.Count(ctx, filter)
+}
+
+func (r *slowUserRepository) FetchDeletable(ctx context.Context, now time.Time, limit int64) ([]*domain.User, error) {
+	defer r.slow.Start(ctx, "FetchDeletable", userCollection, now)()
+	return r.next.FetchDeletable(ctx, now, limit)
+}
@@ -0,0 +1,57 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/store"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/repository"
+)
+
+func TestSlowUserRepository(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+	next := mock.NewMockUserRepository(controller)
+	tUser := tests.NewUser()
+
+	t.Run("slow operation is logged", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		r := repository.NewSlowUserRepository(next, store.NewSlowOpLogger(5*time.Millisecond, zap.New(core)))
+		next.EXPECT().Update(gomock.Any(), tUser).DoAndReturn(func(ctx context.Context, user *domain.User) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+
+		err := r.Update(noopCtx, tUser)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, logs.Len())
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, "Update", fields["operation"])
+		assert.Equal(t, "user", fields["collection"])
+		assert.Equal(t, tUser.ID.Hex(), fields["filter"])
+	})
+
+	t.Run("fast operation is not logged", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		r := repository.NewSlowUserRepository(next, store.NewSlowOpLogger(time.Hour, zap.New(core)))
+		next.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+
+		u, err := r.GetByEmail(noopCtx, tUser.Email)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, u)
+
+		assert.Equal(t, 0, logs.Len())
+	})
+}
@@ -0,0 +1,431 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Defaults of DeletionConfig fields that are not set
+const (
+	DefaultDeletionGraceDays     = 14
+	DefaultDeletionSweepInterval = 300
+	DefaultDeletionBatchSize     = 100
+)
+
+// DeletionConfig stores account deletion configuration
+type DeletionConfig struct {
+	// GraceDays is the number of days account can be restored after its
+	// user requested deletion
+	GraceDays int `yaml:"grace_days"`
+	// SweepInterval is the interval of deleting accounts whose grace period
+	// is over in seconds
+	SweepInterval int `yaml:"sweep_seconds"`
+	// BatchSize is the number of accounts, and URLs of an account, deleted at
+	// once
+	BatchSize int64 `yaml:"batch_size"`
+	// CancelURL is the page linked from deletion email, cancellation token is
+	// passed to it in token query parameter
+	CancelURL string `yaml:"cancel_url"`
+}
+
+// DeletionTokens issues and verifies tokens canceling account deletion
+type DeletionTokens interface {
+	GenerateDeletionToken(claims *auth.DeletionClaims) (string, error)
+	ParseDeletionClaims(token string) (*auth.DeletionClaims, error)
+}
+
+// AccountDeletion is domain.AccountDeletionUsecase. Account is disabled when
+// its user requests deletion and is deleted with its API keys and URLs by
+// sweeper when grace period is over. Sweeper claims account before deleting
+// its API keys and URLs, claimed account can't be restored. Account deleted by
+// several instances at once is deleted only once, so sweeps need no lock.
+type AccountDeletion struct {
+	userRepo       domain.UserRepository
+	apiKeyRepo     domain.APIKeyRepository
+	urlRepo        domain.URLRepository
+	sender         domain.NotificationSender
+	tokens         DeletionTokens
+	contextTimeout time.Duration
+	tracer         trace.Tracer
+	logger         *zap.Logger
+	cfg            DeletionConfig
+	now            func() time.Time
+}
+
+var _ domain.AccountDeletionUsecase = (*AccountDeletion)(nil)
+
+// NewAccountDeletion creates AccountDeletion, call Run to delete accounts
+// whose grace period is over
+func NewAccountDeletion(u domain.UserRepository, k domain.APIKeyRepository, ur domain.URLRepository, sender domain.NotificationSender, tokens DeletionTokens, timeout time.Duration, tracer trace.Tracer, logger *zap.Logger, cfg DeletionConfig) *AccountDeletion {
+	if cfg.GraceDays <= 0 {
+		cfg.GraceDays = DefaultDeletionGraceDays
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = DefaultDeletionSweepInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultDeletionBatchSize
+	}
+
+	return &AccountDeletion{
+		userRepo:       u,
+		apiKeyRepo:     k,
+		urlRepo:        ur,
+		sender:         sender,
+		tokens:         tokens,
+		contextTimeout: timeout,
+		tracer:         tracing.Tracer(tracer),
+		logger:         logger,
+		cfg:            cfg,
+		now:            time.Now,
+	}
+}
+
+// SetClock replaces clock grace period is measured by
+func (d *AccountDeletion) SetClock(now func() time.Time) {
+	d.now = now
+}
+
+func (d *AccountDeletion) Schedule(c context.Context, claims *auth.Claims) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	ctx, span := d.tracer.Start(
+		ctx,
+		"usecase ScheduleDeletion",
+		trace.WithAttributes(
+			attribute.String("userid", claims.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if claims.IsImpersonated() {
+		err := domain.NewError(domain.ErrForbidden, "account can't be deleted while impersonated")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	u, err := d.getUser(ctx, claims.Subject)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	if u.IsDeletionScheduled() {
+		err = domain.NewError(domain.ErrConflict, "account deletion is already scheduled")
+		span.RecordError(err)
+		return nil, err
+	}
+	// account disabled by admin must not be restored by canceling deletion
+	if u.IsDisabled() {
+		err = domain.NewError(domain.ErrForbidden, "account is disabled")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	now := d.now().Truncate(time.Millisecond).UTC()
+	deleteAfter := now.AddDate(0, 0, d.cfg.GraceDays)
+	u.DisabledAt = &now
+	u.DisabledBy = u.ID.Hex()
+	u.DisabledReason = domain.DeletionReason
+	u.DeleteAfter = &deleteAfter
+	u.UpdatedAt = now
+
+	if err = d.userRepo.Update(ctx, u); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	// account can be restored with password when email is not delivered
+	if err = d.notify(ctx, u, now); err != nil {
+		span.RecordError(err)
+		d.logger.Error("can't send account deletion email", zap.String("userid", u.ID.Hex()), zap.Error(err))
+	}
+
+	return u, nil
+}
+
+// notify emails cancellation link to the user
+func (d *AccountDeletion) notify(ctx context.Context, u *domain.User, now time.Time) error {
+	token, err := d.tokens.GenerateDeletionToken(auth.NewDeletionClaims(u.ID.Hex(), now, *u.DeleteAfter))
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(d.cfg.CancelURL)
+	if err != nil {
+		return fmt.Errorf("invalid cancel url: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return d.sender.Send(ctx, domain.Notification{
+		To:       u.Email,
+		Template: domain.NotificationAccountDeletion,
+		Data: domain.AccountDeletion{
+			Name:        u.FullName,
+			DeleteAfter: *u.DeleteAfter,
+			CancelLink:  link.String(),
+		},
+	})
+}
+
+func (d *AccountDeletion) Cancel(c context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	ctx, span := d.tracer.Start(
+		ctx,
+		"usecase CancelDeletion",
+		trace.WithAttributes(
+			attribute.String("userid", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if err := d.restore(ctx, id, nil); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (d *AccountDeletion) CancelWithToken(c context.Context, token string) error {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	ctx, span := d.tracer.Start(
+		ctx,
+		"usecase CancelDeletionWithToken",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	claims, err := d.tokens.ParseDeletionClaims(token)
+	if err != nil {
+		span.RecordError(err)
+		return domain.NewError(domain.ErrAuthenticationFailure, "").Wrap(err)
+	}
+	span.SetAttributes(attribute.String("userid", claims.Subject))
+
+	deleteAfter := claims.ExpiresAt.Time
+	if err = d.restore(ctx, claims.Subject, &deleteAfter); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// restore enables account whose deletion is scheduled, deleteAfter of token
+// must match the schedule, so token of canceled deletion can't cancel the
+// next one
+func (d *AccountDeletion) restore(ctx context.Context, id string, deleteAfter *time.Time) error {
+	u, err := d.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !u.IsDeletionScheduled() {
+		return domain.NewError(domain.ErrNoAffected, "account deletion is not scheduled")
+	}
+	if u.IsBeingDeleted() {
+		return errBeingDeleted
+	}
+	if deleteAfter != nil && deleteAfter.Unix() != u.DeleteAfter.Unix() {
+		return domain.NewError(domain.ErrAuthenticationFailure, "deletion token was issued for other deletion")
+	}
+	if !d.now().Before(*u.DeleteAfter) {
+		return domain.NewError(domain.ErrForbidden, "account deletion grace period is over")
+	}
+	// admin could disable account after its user requested deletion
+	if u.DisabledBy != u.ID.Hex() {
+		return domain.NewError(domain.ErrForbidden, "account is disabled by admin")
+	}
+
+	u.DisabledAt = nil
+	u.DisabledBy = ""
+	u.DisabledReason = ""
+	u.DeleteAfter = nil
+	u.UpdatedAt = d.now().Truncate(time.Millisecond).UTC()
+
+	// sweeper could claim account after it was read
+	err = d.userRepo.Restore(ctx, u)
+	if errors.Is(err, domain.ErrNoAffected) {
+		return errBeingDeleted
+	}
+	return err
+}
+
+// errBeingDeleted is returned when account whose deletion was claimed by
+// sweeper is restored
+var errBeingDeleted = domain.NewError(domain.ErrConflict, "account is being deleted")
+
+func (d *AccountDeletion) getUser(ctx context.Context, id string) (*domain.User, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, domain.NewError(domain.ErrBadParamInput, "user ID is not valid ObjectID").WithEntity(domain.EntityUser, id).Wrap(err)
+	}
+
+	return d.userRepo.GetByID(ctx, objID)
+}
+
+// Run deletes accounts whose grace period is over right away and then every
+// sweep interval until context is canceled, sweep waits while service is
+// read-only
+func (d *AccountDeletion) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(d.cfg.SweepInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := domain.WaitWritable(ctx); err != nil {
+			return
+		}
+		deleted, err := d.Sweep(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error("account deletion sweep failed", zap.Int("deleted", deleted), zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes accounts whose grace period is over and returns their
+// number, it stops at first account that can't be deleted
+func (d *AccountDeletion) Sweep(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, d.contextTimeout)
+		users, err := d.userRepo.FetchDeletable(fetchCtx, d.now(), d.cfg.BatchSize)
+		cancel()
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, u := range users {
+			ok, err := d.delete(ctx, u)
+			if err != nil {
+				return deleted, fmt.Errorf("can't delete %s account: %w", u.ID.Hex(), err)
+			}
+			if ok {
+				deleted++
+			}
+		}
+
+		if int64(len(users)) < d.cfg.BatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// delete claims the user and deletes its API keys and URLs and then the user,
+// so interrupted deletion is resumed by the next sweep, it reports whether the
+// user was deleted. Claim succeeds only while deletion is still scheduled, so
+// account restored after it was fetched keeps its data, and claimed account
+// can't be restored. Timeout is applied to every repository call, as user may
+// have many URLs.
+func (d *AccountDeletion) delete(c context.Context, u *domain.User) (bool, error) {
+	ctx, span := d.tracer.Start(
+		c,
+		"usecase DeleteAccount",
+		trace.WithAttributes(
+			attribute.String("userid", u.ID.Hex())),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	now := d.now()
+	err := d.claim(ctx, u.ID, now)
+	if errors.Is(err, domain.ErrNoAffected) {
+		return false, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		return false, err
+	}
+
+	id := u.ID.Hex()
+	keys, err := d.deleteAPIKeys(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return false, err
+	}
+
+	var urls int64
+	for {
+		n, err := d.purgeBatch(ctx, id)
+		if err != nil {
+			span.RecordError(err)
+			return false, err
+		}
+		urls += n
+		if n == 0 {
+			break
+		}
+	}
+
+	delCtx, cancel := context.WithTimeout(ctx, d.contextTimeout)
+	defer cancel()
+	err = d.userRepo.DeleteScheduled(delCtx, u.ID, now)
+	if errors.Is(err, domain.ErrNoAffected) {
+		d.logger.Warn("account was not deleted, it was deleted by another instance",
+			zap.String("userid", id),
+			zap.Int64("api_keys", keys),
+			zap.Int64("urls", urls),
+		)
+		return false, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		return false, err
+	}
+
+	d.logger.Info("deleted account",
+		zap.String("userid", id),
+		zap.Int64("api_keys", keys),
+		zap.Int64("urls", urls),
+	)
+	return true, nil
+}
+
+// claim marks the user as being deleted while its deletion is scheduled
+// before now, ErrNoAffected is returned otherwise, e.g. user was restored or
+// deleted meanwhile
+func (d *AccountDeletion) claim(c context.Context, id primitive.ObjectID, now time.Time) error {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	return d.userRepo.ClaimDeletion(ctx, id, now)
+}
+
+func (d *AccountDeletion) deleteAPIKeys(c context.Context, userID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	return d.apiKeyRepo.DeleteByUser(ctx, userID)
+}
+
+func (d *AccountDeletion) purgeBatch(c context.Context, userID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	return d.urlRepo.PurgeBatch(ctx, domain.PurgeFilter{UserID: userID}, d.cfg.BatchSize)
+}
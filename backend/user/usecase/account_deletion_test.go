@@ -0,0 +1,411 @@
+package usecase_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	apiKeyMock "github.com/semka95/shortener/backend/apikey/mock"
+	"github.com/semka95/shortener/backend/domain"
+	notifierMock "github.com/semka95/shortener/backend/notifier/mock"
+	"github.com/semka95/shortener/backend/tests"
+	urlMock "github.com/semka95/shortener/backend/url/mock"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/usecase"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+type deletionStack struct {
+	uc            *usecase.AccountDeletion
+	users         *mock.MockUserRepository
+	keys          *apiKeyMock.MockAPIKeyRepository
+	urls          *urlMock.MockURLRepository
+	sender        *notifierMock.MockNotificationSender
+	authenticator *auth.Authenticator
+	now           time.Time
+}
+
+func newDeletionStack(t *testing.T) *deletionStack {
+	t.Helper()
+	controller := gomock.NewController(t)
+	t.Cleanup(controller.Finish)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	kid := "4754d86b-7a6d-4df5-9c65-224741361492"
+	authenticator, err := auth.NewAuthenticator(key, kid, "RS256", auth.NewSimpleKeyLookupFunc(kid, key.Public().(*rsa.PublicKey)))
+	require.NoError(t, err)
+
+	s := &deletionStack{
+		users:         mock.NewMockUserRepository(controller),
+		keys:          apiKeyMock.NewMockAPIKeyRepository(controller),
+		urls:          urlMock.NewMockURLRepository(controller),
+		sender:        notifierMock.NewMockNotificationSender(controller),
+		authenticator: authenticator,
+		// tokens are verified with wall clock
+		now: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	s.uc = usecase.NewAccountDeletion(s.users, s.keys, s.urls, s.sender, authenticator, 10*time.Second, tracer, zap.NewNop(), usecase.DeletionConfig{
+		GraceDays: 14,
+		BatchSize: 2,
+		CancelURL: "https://sho.rt/account/restore?lang=en",
+	})
+	s.uc.SetClock(func() time.Time { return s.now })
+	return s
+}
+
+// scheduled returns user whose deletion was requested at requestedAt
+func scheduled(requestedAt time.Time) *domain.User {
+	u := tests.NewUser()
+	deleteAfter := requestedAt.AddDate(0, 0, 14)
+	u.DisabledAt = tests.DatePointer(requestedAt)
+	u.DisabledBy = u.ID.Hex()
+	u.DisabledReason = domain.DeletionReason
+	u.DeleteAfter = &deleteAfter
+	return u
+}
+
+func TestAccountDeletion_Schedule(t *testing.T) {
+	s := newDeletionStack(t)
+
+	t.Run("success", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, s.now, time.Hour)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		s.users.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+
+		var sent domain.Notification
+		s.sender.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, n domain.Notification) error {
+			sent = n
+			return nil
+		})
+
+		result, err := s.uc.Schedule(context.Background(), claims)
+		require.NoError(t, err)
+		assert.True(t, result.IsDisabled())
+		assert.True(t, result.IsDeletionScheduled())
+		assert.Equal(t, tUser.ID.Hex(), result.DisabledBy)
+		assert.Equal(t, domain.DeletionReason, result.DisabledReason)
+		assert.Equal(t, s.now.AddDate(0, 0, 14), *result.DeleteAfter)
+
+		assert.Equal(t, tUser.Email, sent.To)
+		assert.Equal(t, domain.NotificationAccountDeletion, sent.Template)
+		data, ok := sent.Data.(domain.AccountDeletion)
+		require.True(t, ok)
+		assert.Equal(t, *result.DeleteAfter, data.DeleteAfter)
+
+		link, err := url.Parse(data.CancelLink)
+		require.NoError(t, err)
+		assert.Equal(t, "/account/restore", link.Path)
+		assert.Equal(t, "en", link.Query().Get("lang"))
+		dc, err := s.authenticator.ParseDeletionClaims(link.Query().Get("token"))
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), dc.Subject)
+		assert.Equal(t, result.DeleteAfter.Unix(), dc.ExpiresAt.Unix())
+	})
+
+	t.Run("email is not sent", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, s.now, time.Hour)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		s.users.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+		s.sender.EXPECT().Send(gomock.Any(), gomock.Any()).Return(errors.New("queue is full"))
+
+		result, err := s.uc.Schedule(context.Background(), claims)
+		require.NoError(t, err)
+		assert.True(t, result.IsDeletionScheduled())
+	})
+
+	t.Run("already scheduled", func(t *testing.T) {
+		tUser := scheduled(s.now.Add(-time.Hour))
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, s.now, time.Hour)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+
+		result, err := s.uc.Schedule(context.Background(), claims)
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.Nil(t, result)
+	})
+
+	t.Run("disabled by admin", func(t *testing.T) {
+		tUser := tests.NewUser()
+		tUser.DisabledAt = tests.DatePointer(s.now)
+		tUser.DisabledBy = "507f191e810c19729de860ec"
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, s.now, time.Hour)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+
+		result, err := s.uc.Schedule(context.Background(), claims)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("impersonated", func(t *testing.T) {
+		claims := auth.NewImpersonationClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, "507f191e810c19729de860ec", s.now)
+		result, err := s.uc.Schedule(context.Background(), claims)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, s.now, time.Hour)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		s.users.EXPECT().Update(gomock.Any(), tUser).Return(domain.ErrInternalServerError)
+
+		result, err := s.uc.Schedule(context.Background(), claims)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+	})
+}
+
+func TestAccountDeletion_Cancel(t *testing.T) {
+	s := newDeletionStack(t)
+
+	t.Run("success", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -3))
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		s.users.EXPECT().Restore(gomock.Any(), tUser).Return(nil)
+
+		require.NoError(t, s.uc.Cancel(context.Background(), tUser.ID.Hex()))
+		assert.False(t, tUser.IsDisabled())
+		assert.False(t, tUser.IsDeletionScheduled())
+		assert.Empty(t, tUser.DisabledBy)
+		assert.Empty(t, tUser.DisabledReason)
+	})
+
+	t.Run("not scheduled", func(t *testing.T) {
+		tUser := tests.NewUser()
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		assert.ErrorIs(t, s.uc.Cancel(context.Background(), tUser.ID.Hex()), domain.ErrNoAffected)
+	})
+
+	t.Run("grace period is over", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -14))
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		assert.ErrorIs(t, s.uc.Cancel(context.Background(), tUser.ID.Hex()), domain.ErrForbidden)
+	})
+
+	t.Run("disabled by admin after request", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -3))
+		tUser.DisabledBy = "507f191e810c19729de860ec"
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		assert.ErrorIs(t, s.uc.Cancel(context.Background(), tUser.ID.Hex()), domain.ErrForbidden)
+	})
+
+	t.Run("account is being deleted", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -3))
+		tUser.DeletingAt = tests.DatePointer(s.now)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		assert.ErrorIs(t, s.uc.Cancel(context.Background(), tUser.ID.Hex()), domain.ErrConflict)
+	})
+
+	t.Run("account is claimed for deletion after it was read", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -3))
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		s.users.EXPECT().Restore(gomock.Any(), tUser).Return(domain.ErrNoAffected)
+		assert.ErrorIs(t, s.uc.Cancel(context.Background(), tUser.ID.Hex()), domain.ErrConflict)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		assert.ErrorIs(t, s.uc.Cancel(context.Background(), "not valid id"), domain.ErrBadParamInput)
+	})
+}
+
+func TestAccountDeletion_CancelWithToken(t *testing.T) {
+	s := newDeletionStack(t)
+	requestedAt := s.now.AddDate(0, 0, -3)
+
+	token := func(t *testing.T, u *domain.User, deleteAfter time.Time) string {
+		t.Helper()
+		tkn, err := s.authenticator.GenerateDeletionToken(auth.NewDeletionClaims(u.ID.Hex(), requestedAt, deleteAfter))
+		require.NoError(t, err)
+		return tkn
+	}
+
+	t.Run("success", func(t *testing.T) {
+		tUser := scheduled(requestedAt)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		s.users.EXPECT().Restore(gomock.Any(), tUser).Return(nil)
+
+		require.NoError(t, s.uc.CancelWithToken(context.Background(), token(t, tUser, *tUser.DeleteAfter)))
+		assert.False(t, tUser.IsDeletionScheduled())
+	})
+
+	t.Run("token of other deletion", func(t *testing.T) {
+		tUser := scheduled(requestedAt)
+		s.users.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+
+		err := s.uc.CancelWithToken(context.Background(), token(t, tUser, tUser.DeleteAfter.AddDate(0, 0, -1)))
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.True(t, tUser.IsDeletionScheduled())
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		err := s.uc.CancelWithToken(context.Background(), "not.a.token")
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	})
+
+	t.Run("session token", func(t *testing.T) {
+		tkn, err := s.authenticator.GenerateToken(auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, s.now, time.Hour))
+		require.NoError(t, err)
+		assert.ErrorIs(t, s.uc.CancelWithToken(context.Background(), tkn), domain.ErrAuthenticationFailure)
+	})
+}
+
+func TestAccountDeletion_Sweep(t *testing.T) {
+	s := newDeletionStack(t)
+
+	t.Run("success", func(t *testing.T) {
+		first := scheduled(s.now.AddDate(0, 0, -20))
+		second := scheduled(s.now.AddDate(0, 0, -15))
+		third := scheduled(s.now.AddDate(0, 0, -14))
+
+		gomock.InOrder(
+			s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{first, second}, nil),
+			s.users.EXPECT().ClaimDeletion(gomock.Any(), first.ID, s.now).Return(nil),
+			s.keys.EXPECT().DeleteByUser(gomock.Any(), first.ID.Hex()).Return(int64(1), nil),
+			s.urls.EXPECT().PurgeBatch(gomock.Any(), domain.PurgeFilter{UserID: first.ID.Hex()}, int64(2)).Return(int64(2), nil),
+			s.urls.EXPECT().PurgeBatch(gomock.Any(), domain.PurgeFilter{UserID: first.ID.Hex()}, int64(2)).Return(int64(1), nil),
+			s.urls.EXPECT().PurgeBatch(gomock.Any(), domain.PurgeFilter{UserID: first.ID.Hex()}, int64(2)).Return(int64(0), nil),
+			s.users.EXPECT().DeleteScheduled(gomock.Any(), first.ID, s.now).Return(nil),
+			// deleted by other instance
+			s.users.EXPECT().ClaimDeletion(gomock.Any(), second.ID, s.now).Return(domain.ErrNoAffected),
+			s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{third}, nil),
+			s.users.EXPECT().ClaimDeletion(gomock.Any(), third.ID, s.now).Return(nil),
+			s.keys.EXPECT().DeleteByUser(gomock.Any(), third.ID.Hex()).Return(int64(0), nil),
+			s.urls.EXPECT().PurgeBatch(gomock.Any(), domain.PurgeFilter{UserID: third.ID.Hex()}, int64(2)).Return(int64(0), nil),
+			s.users.EXPECT().DeleteScheduled(gomock.Any(), third.ID, s.now).Return(nil),
+		)
+
+		deleted, err := s.uc.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+	})
+
+	t.Run("nothing to delete", func(t *testing.T) {
+		s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{}, nil)
+
+		deleted, err := s.uc.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+	})
+
+	t.Run("account canceled after fetch keeps its data", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -20))
+		s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{tUser}, nil)
+		// API keys and URLs are not deleted, the mocks fail on such calls
+		s.users.EXPECT().ClaimDeletion(gomock.Any(), tUser.ID, s.now).Return(domain.ErrNoAffected)
+
+		deleted, err := s.uc.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+	})
+
+	t.Run("account deleted by other instance meanwhile", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -20))
+		s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{tUser}, nil)
+		s.users.EXPECT().ClaimDeletion(gomock.Any(), tUser.ID, s.now).Return(nil)
+		s.keys.EXPECT().DeleteByUser(gomock.Any(), tUser.ID.Hex()).Return(int64(0), nil)
+		s.urls.EXPECT().PurgeBatch(gomock.Any(), domain.PurgeFilter{UserID: tUser.ID.Hex()}, int64(2)).Return(int64(0), nil)
+		s.users.EXPECT().DeleteScheduled(gomock.Any(), tUser.ID, s.now).Return(domain.ErrNoAffected)
+
+		deleted, err := s.uc.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+	})
+
+	t.Run("claim error", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -20))
+		s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{tUser}, nil)
+		s.users.EXPECT().ClaimDeletion(gomock.Any(), tUser.ID, s.now).Return(domain.ErrInternalServerError)
+
+		deleted, err := s.uc.Sweep(context.Background())
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Zero(t, deleted)
+	})
+
+	t.Run("user is kept when URLs are not deleted", func(t *testing.T) {
+		tUser := scheduled(s.now.AddDate(0, 0, -20))
+		s.users.EXPECT().FetchDeletable(gomock.Any(), s.now, int64(2)).Return([]*domain.User{tUser}, nil)
+		s.users.EXPECT().ClaimDeletion(gomock.Any(), tUser.ID, s.now).Return(nil)
+		s.keys.EXPECT().DeleteByUser(gomock.Any(), tUser.ID.Hex()).Return(int64(0), nil)
+		s.urls.EXPECT().PurgeBatch(gomock.Any(), domain.PurgeFilter{UserID: tUser.ID.Hex()}, int64(2)).Return(int64(0), domain.ErrInternalServerError)
+
+		deleted, err := s.uc.Sweep(context.Background())
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Zero(t, deleted)
+	})
+}
+
+func TestAccountDeletion_CancelRace(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	users := tests.NewMemoryUserRepository()
+	urls := tests.NewMemoryURLRepository()
+	keys := apiKeyMock.NewMockAPIKeyRepository(controller)
+	requestedAt := time.Now().AddDate(0, 0, -14).Add(time.Minute)
+	// instances with clocks on both sides of the end of grace period
+	newInstance := func(now time.Time) *usecase.AccountDeletion {
+		d := usecase.NewAccountDeletion(users, keys, urls, nil, nil, time.Second, tracer, zap.NewNop(), usecase.DeletionConfig{BatchSize: 2})
+		d.SetClock(func() time.Time { return now })
+		return d
+	}
+	canceler := newInstance(requestedAt.AddDate(0, 0, 14).Add(-time.Second))
+	sweeper := newInstance(requestedAt.AddDate(0, 0, 14).Add(time.Second))
+
+	store := func(t *testing.T) *domain.User {
+		t.Helper()
+		u := scheduled(requestedAt)
+		u.ID = primitive.NewObjectID()
+		u.Email = u.ID.Hex() + "@example.com"
+		u.DisabledBy = u.ID.Hex()
+		require.NoError(t, users.Create(context.Background(), u))
+		tURL := tests.NewURL()
+		tURL.ID = u.ID.Hex()
+		tURL.UserID = u.ID.Hex()
+		require.NoError(t, urls.Store(context.Background(), tURL))
+		return u
+	}
+
+	t.Run("canceled account keeps its data", func(t *testing.T) {
+		u := store(t)
+		require.NoError(t, canceler.Cancel(context.Background(), u.ID.Hex()))
+
+		deleted, err := sweeper.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+		restored, err := users.GetByID(context.Background(), u.ID)
+		require.NoError(t, err)
+		assert.False(t, restored.IsDisabled())
+		count, err := urls.CountPurgeable(context.Background(), domain.PurgeFilter{UserID: u.ID.Hex()})
+		require.NoError(t, err)
+		assert.EqualValues(t, 1, count)
+	})
+
+	t.Run("account being deleted is not restored", func(t *testing.T) {
+		u := store(t)
+		keys.EXPECT().DeleteByUser(gomock.Any(), u.ID.Hex()).DoAndReturn(func(ctx context.Context, userID string) (int64, error) {
+			assert.ErrorIs(t, canceler.Cancel(ctx, userID), domain.ErrConflict)
+			return 0, nil
+		})
+
+		deleted, err := sweeper.Sweep(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		_, err = users.GetByID(context.Background(), u.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		count, err := urls.CountPurgeable(context.Background(), domain.PurgeFilter{UserID: u.ID.Hex()})
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	})
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// ClickRetentionSettings checks click retention users set against service
+// bounds. Clicks are purged in background as soon as retention is shortened,
+// instead of waiting for the next purge.
+type ClickRetentionSettings struct {
+	domain.UserUsecase
+	retention domain.ClickRetentionUsecase
+}
+
+// NewClickRetentionSettings wraps u with click retention checks, clicks are
+// purged by retention
+func NewClickRetentionSettings(u domain.UserUsecase, retention domain.ClickRetentionUsecase) *ClickRetentionSettings {
+	return &ClickRetentionSettings{
+		UserUsecase: u,
+		retention:   retention,
+	}
+}
+
+// UpdateSettings refuses click retention out of service bounds and purges
+// clicks when retention becomes shorter
+func (s *ClickRetentionSettings) UpdateSettings(ctx context.Context, settings domain.UserSettings, claims *auth.Claims) (*domain.UserSettings, error) {
+	days := settings.ClickRetentionDays
+	if days > 0 {
+		if err := s.retention.CheckRetention(days); err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := s.UserUsecase.GetByID(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	previous := u.Settings.ClickRetentionDays
+
+	result, err := s.UserUsecase.UpdateSettings(ctx, settings, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if days > 0 && (previous <= 0 || days < previous) {
+		logger := web.LoggerFromContext(ctx).With(zap.String("userid", claims.Subject), zap.Int("click_retention_days", days))
+		// purge outlives the request
+		go func() {
+			if err := s.retention.PurgeUser(context.Background(), claims.Subject, days); err != nil {
+				logger.Error("can't purge clicks after retention was shortened", zap.Error(err))
+			}
+		}()
+	}
+
+	return result, nil
+}
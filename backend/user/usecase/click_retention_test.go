@@ -0,0 +1,113 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	clickmock "github.com/semka95/shortener/backend/click/mock"
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/usecase"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestClickRetentionSettings_UpdateSettings(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	uc := mock.NewMockUserUsecase(controller)
+	retention := clickmock.NewMockClickRetentionUsecase(controller)
+	s := usecase.NewClickRetentionSettings(uc, retention)
+
+	tUser := tests.NewUser()
+	claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+	withRetention := func(days int) *domain.User {
+		u := *tUser
+		u.Settings.ClickRetentionDays = days
+		return &u
+	}
+
+	t.Run("shortened", func(t *testing.T) {
+		settings := domain.UserSettings{ClickRetentionDays: 30}
+		purged := make(chan int, 1)
+		retention.EXPECT().CheckRetention(30).Return(nil)
+		uc.EXPECT().GetByID(gomock.Any(), claims.Subject).Return(withRetention(90), nil)
+		uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(&settings, nil)
+		retention.EXPECT().PurgeUser(gomock.Any(), claims.Subject, 30).DoAndReturn(func(ctx context.Context, userID string, days int) error {
+			purged <- days
+			return nil
+		})
+
+		result, err := s.UpdateSettings(context.Background(), settings, claims)
+		require.NoError(t, err)
+		assert.Equal(t, &settings, result)
+		select {
+		case <-purged:
+		case <-time.After(time.Second):
+			t.Fatal("clicks were not purged")
+		}
+	})
+
+	t.Run("set first time", func(t *testing.T) {
+		settings := domain.UserSettings{ClickRetentionDays: 90}
+		purged := make(chan int, 1)
+		retention.EXPECT().CheckRetention(90).Return(nil)
+		uc.EXPECT().GetByID(gomock.Any(), claims.Subject).Return(withRetention(0), nil)
+		uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(&settings, nil)
+		retention.EXPECT().PurgeUser(gomock.Any(), claims.Subject, 90).DoAndReturn(func(ctx context.Context, userID string, days int) error {
+			purged <- days
+			return nil
+		})
+
+		_, err := s.UpdateSettings(context.Background(), settings, claims)
+		require.NoError(t, err)
+		select {
+		case <-purged:
+		case <-time.After(time.Second):
+			t.Fatal("clicks were not purged")
+		}
+	})
+
+	t.Run("lengthened", func(t *testing.T) {
+		settings := domain.UserSettings{ClickRetentionDays: 90}
+		retention.EXPECT().CheckRetention(90).Return(nil)
+		uc.EXPECT().GetByID(gomock.Any(), claims.Subject).Return(withRetention(30), nil)
+		uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(&settings, nil)
+
+		_, err := s.UpdateSettings(context.Background(), settings, claims)
+		require.NoError(t, err)
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		settings := domain.UserSettings{DefaultExpirationDays: 7}
+		uc.EXPECT().GetByID(gomock.Any(), claims.Subject).Return(withRetention(30), nil)
+		uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(&settings, nil)
+
+		_, err := s.UpdateSettings(context.Background(), settings, claims)
+		require.NoError(t, err)
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		retention.EXPECT().CheckRetention(1000).Return(domain.ErrBadParamInput)
+
+		result, err := s.UpdateSettings(context.Background(), domain.UserSettings{ClickRetentionDays: 1000}, claims)
+		require.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, result)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		settings := domain.UserSettings{ClickRetentionDays: 30}
+		retention.EXPECT().CheckRetention(30).Return(nil)
+		uc.EXPECT().GetByID(gomock.Any(), claims.Subject).Return(withRetention(90), nil)
+		uc.EXPECT().UpdateSettings(gomock.Any(), settings, claims).Return(nil, domain.ErrInternalServerError)
+
+		_, err := s.UpdateSettings(context.Background(), settings, claims)
+		require.ErrorIs(t, err, domain.ErrInternalServerError)
+	})
+}
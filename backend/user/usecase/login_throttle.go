@@ -0,0 +1,173 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// Default login throttle configuration used when ThrottleConfig fields are
+// not set
+const (
+	DefaultThrottleWindow       = 900
+	DefaultThrottleFreeFailures = 3
+	DefaultThrottleBaseDelay    = 500
+	DefaultThrottleMaxDelay     = 8000
+	DefaultThrottleRefuseAfter  = 10
+)
+
+// ThrottleConfig stores per account login throttle configuration
+type ThrottleConfig struct {
+	// Window is the period failed logins are counted in, in seconds
+	Window int `yaml:"window_seconds"`
+	// FreeFailures is the number of failed logins allowed without delay
+	FreeFailures int `yaml:"free_failures"`
+	// BaseDelay is the delay after FreeFailures failed logins in
+	// milliseconds, it doubles with every next failure
+	BaseDelay int `yaml:"base_delay_ms"`
+	// MaxDelay caps the delay in milliseconds
+	MaxDelay int `yaml:"max_delay_ms"`
+	// RefuseAfter is the number of failed logins after which logins are
+	// refused until the oldest of them leaves the window
+	RefuseAfter int `yaml:"refuse_after"`
+}
+
+// LoginThrottle slows down and then refuses logins to the account that had
+// too many failed logins recently, regardless of client address. Refused
+// login fails the same way wrong password does. Successful login resets
+// failures of the account. Failures are counted in the shared limit store, so
+// the account is throttled whichever instance serves the login.
+type LoginThrottle struct {
+	domain.UserUsecase
+	cfg      ThrottleConfig
+	failures domain.LimitStore
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// NewLoginThrottle wraps u with per account login throttle, failures are
+// counted in limits
+func NewLoginThrottle(u domain.UserUsecase, cfg ThrottleConfig, limits domain.LimitStore) *LoginThrottle {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultThrottleWindow
+	}
+	if cfg.FreeFailures <= 0 {
+		cfg.FreeFailures = DefaultThrottleFreeFailures
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = DefaultThrottleBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = DefaultThrottleMaxDelay
+	}
+	if cfg.RefuseAfter <= 0 {
+		cfg.RefuseAfter = DefaultThrottleRefuseAfter
+	}
+
+	return &LoginThrottle{
+		UserUsecase: u,
+		cfg:         cfg,
+		failures:    limits,
+		now:         time.Now,
+		sleep:       sleep,
+	}
+}
+
+// SetClock replaces clock failures are expired by and the way delays are
+// waited out
+func (t *LoginThrottle) SetClock(now func() time.Time, sleep func(ctx context.Context, d time.Duration) error) {
+	t.now = now
+	t.sleep = sleep
+}
+
+// Authenticate delays authentication by number of recent failed logins to
+// the account and refuses it when there were too many of them
+func (t *LoginThrottle) Authenticate(ctx context.Context, now time.Time, email, password string) (*auth.Claims, error) {
+	var claims *auth.Claims
+	err := t.throttle(ctx, email, func() (err error) {
+		claims, err = t.UserUsecase.Authenticate(ctx, now, email, password)
+		return err
+	})
+	return claims, err
+}
+
+// VerifyPassword is throttled as Authenticate, failures of both are counted
+// together
+func (t *LoginThrottle) VerifyPassword(ctx context.Context, email, password string) (*domain.User, error) {
+	var u *domain.User
+	err := t.throttle(ctx, email, func() (err error) {
+		u, err = t.UserUsecase.VerifyPassword(ctx, email, password)
+		return err
+	})
+	return u, err
+}
+
+// throttle delays login by number of recent failed logins to the account,
+// refuses it when there were too many of them and counts failure of login
+func (t *LoginThrottle) throttle(ctx context.Context, email string, login func() error) error {
+	key := "login:" + domain.NormalizeEmail(email)
+	window := time.Duration(t.cfg.Window) * time.Second
+	failed, err := t.failures.Count(ctx, key, t.now(), window)
+	if err != nil {
+		return err
+	}
+
+	if err := t.sleep(ctx, t.delay(failed)); err != nil {
+		return err
+	}
+
+	if failed >= t.cfg.RefuseAfter {
+		web.LoggerFromContext(ctx).Warn("login refused, too many failed logins", zap.Int("failures", failed))
+		return domain.NewError(domain.ErrAuthenticationFailure, "too many failed logins")
+	}
+
+	err = login()
+	switch {
+	case err == nil:
+		if rerr := t.failures.Reset(ctx, key); rerr != nil {
+			web.LoggerFromContext(ctx).Warn("can't reset failed logins", zap.Error(rerr))
+		}
+	case errors.Is(err, domain.ErrAuthenticationFailure):
+		if _, aerr := t.failures.Add(ctx, key, t.now(), window); aerr != nil {
+			web.LoggerFromContext(ctx).Warn("can't count failed login", zap.Error(aerr))
+		}
+	}
+	return err
+}
+
+// delay returns delay of login after given number of failed logins
+func (t *LoginThrottle) delay(failed int) time.Duration {
+	if failed < t.cfg.FreeFailures {
+		return 0
+	}
+	d := time.Duration(t.cfg.BaseDelay) * time.Millisecond
+	max := time.Duration(t.cfg.MaxDelay) * time.Millisecond
+	for i := t.cfg.FreeFailures; i < failed && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,198 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/usecase"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// throttleClock is manually advanced clock, sleeping advances it and records
+// the delay
+type throttleClock struct {
+	now    time.Time
+	delays []time.Duration
+}
+
+func (c *throttleClock) Now() time.Time {
+	return c.now
+}
+
+func (c *throttleClock) Sleep(_ context.Context, d time.Duration) error {
+	c.delays = append(c.delays, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+var throttleConfig = usecase.ThrottleConfig{
+	Window:       600,
+	FreeFailures: 2,
+	BaseDelay:    1000,
+	MaxDelay:     4000,
+	RefuseAfter:  6,
+}
+
+func newTestThrottle(t *testing.T) (*usecase.LoginThrottle, *mock.MockUserUsecase, *throttleClock) {
+	t.Helper()
+	uc := mock.NewMockUserUsecase(gomock.NewController(t))
+	clock := &throttleClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	th := usecase.NewLoginThrottle(uc, throttleConfig, tests.NewMemoryLimitStore())
+	th.SetClock(clock.Now, clock.Sleep)
+	return th, uc, clock
+}
+
+func TestLoginThrottle_Delays(t *testing.T) {
+	th, uc, clock := newTestThrottle(t)
+	wrongPassword := fmt.Errorf("compare password error: %w", domain.ErrAuthenticationFailure)
+
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword).Times(6)
+	for i := 0; i < 6; i++ {
+		_, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}, clock.delays)
+
+	// refused without checking password, failing the same way
+	clock.delays = nil
+	_, err := th.Authenticate(context.Background(), clock.Now(), "User@Example.com ", "right")
+	require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	assert.Equal(t, []time.Duration{4 * time.Second}, clock.delays)
+
+	// other accounts aren't throttled
+	clock.delays = nil
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "other@example.com", "wrong").Return(nil, wrongPassword)
+	_, err = th.Authenticate(context.Background(), clock.Now(), "other@example.com", "wrong")
+	require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	assert.Equal(t, []time.Duration{0}, clock.delays)
+}
+
+func TestLoginThrottle_Window(t *testing.T) {
+	th, uc, clock := newTestThrottle(t)
+	wrongPassword := fmt.Errorf("compare password error: %w", domain.ErrAuthenticationFailure)
+
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword).Times(6)
+	for i := 0; i < 6; i++ {
+		_, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	}
+
+	// first two failures without delay leave the window together, then the
+	// account gets back below the refusal limit
+	clock.now = clock.now.Add(10*time.Minute - 11*time.Second)
+	clock.delays = nil
+	claims := auth.NewClaims("1", nil, clock.Now(), time.Hour)
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "right").Return(claims, nil)
+	result, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "right")
+	require.NoError(t, err)
+	assert.Equal(t, claims, result)
+	assert.Equal(t, []time.Duration{4 * time.Second}, clock.delays)
+}
+
+func TestLoginThrottle_SuccessResets(t *testing.T) {
+	th, uc, clock := newTestThrottle(t)
+	wrongPassword := fmt.Errorf("compare password error: %w", domain.ErrAuthenticationFailure)
+	claims := auth.NewClaims("1", nil, clock.Now(), time.Hour)
+
+	gomock.InOrder(
+		uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword).Times(3),
+		uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "right").Return(claims, nil),
+		uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword),
+	)
+	for i := 0; i < 3; i++ {
+		_, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	}
+	_, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "right")
+	require.NoError(t, err)
+	_, err = th.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+	require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+
+	assert.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 0}, clock.delays)
+}
+
+func TestLoginThrottle_OtherErrorsNotCounted(t *testing.T) {
+	th, uc, clock := newTestThrottle(t)
+	errInternal := errors.New("connection refused")
+
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "right").Return(nil, errInternal).Times(4)
+	for i := 0; i < 4; i++ {
+		_, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "right")
+		require.ErrorIs(t, err, errInternal)
+	}
+	assert.Equal(t, []time.Duration{0, 0, 0, 0}, clock.delays)
+}
+
+func TestLoginThrottle_VerifyPassword(t *testing.T) {
+	th, uc, clock := newTestThrottle(t)
+	wrongPassword := fmt.Errorf("compare password error: %w", domain.ErrAuthenticationFailure)
+
+	// failures of both are counted together
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword).Times(2)
+	uc.EXPECT().VerifyPassword(gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword).Times(4)
+	for i := 0; i < 2; i++ {
+		_, err := th.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	}
+	for i := 0; i < 4; i++ {
+		_, err := th.VerifyPassword(context.Background(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}, clock.delays)
+
+	u, err := th.VerifyPassword(context.Background(), "user@example.com", "wrong")
+	assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	assert.Nil(t, u)
+}
+
+func TestLoginThrottle_SharedAcrossInstances(t *testing.T) {
+	uc := mock.NewMockUserUsecase(gomock.NewController(t))
+	clock := &throttleClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limits := tests.NewMemoryLimitStore()
+	first := usecase.NewLoginThrottle(uc, throttleConfig, limits)
+	first.SetClock(clock.Now, clock.Sleep)
+	second := usecase.NewLoginThrottle(uc, throttleConfig, limits)
+	second.SetClock(clock.Now, clock.Sleep)
+	wrongPassword := fmt.Errorf("compare password error: %w", domain.ErrAuthenticationFailure)
+
+	uc.EXPECT().Authenticate(gomock.Any(), gomock.Any(), "user@example.com", "wrong").Return(nil, wrongPassword).Times(6)
+	for i := 0; i < 3; i++ {
+		_, err := first.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		_, err = second.Authenticate(context.Background(), clock.Now(), "user@example.com", "wrong")
+		require.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}, clock.delays)
+
+	// refused by the instance that saw only half of failures
+	_, err := first.Authenticate(context.Background(), clock.Now(), "user@example.com", "right")
+	assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+}
+
+// failingLimits fails to count events
+type failingLimits struct {
+	domain.LimitStore
+}
+
+func (failingLimits) Count(context.Context, string, time.Time, time.Duration) (int, error) {
+	return 0, domain.ErrInternalServerError
+}
+
+func TestLoginThrottle_StoreError(t *testing.T) {
+	uc := mock.NewMockUserUsecase(gomock.NewController(t))
+	th := usecase.NewLoginThrottle(uc, throttleConfig, failingLimits{})
+
+	// password isn't checked when failures can't be counted
+	_, err := th.Authenticate(context.Background(), time.Now(), "user@example.com", "right")
+	assert.ErrorIs(t, err, domain.ErrInternalServerError)
+}
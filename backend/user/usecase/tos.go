@@ -0,0 +1,49 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// TermsOfService requires users to accept terms of service of the configured
+// version on sign up and when they re-accept them after the version is
+// bumped. Users who accepted an older version keep working, their responses
+// are marked by the authenticator until they re-accept.
+type TermsOfService struct {
+	domain.UserUsecase
+	version string
+}
+
+// NewTermsOfService wraps u with terms of service checks against version
+func NewTermsOfService(u domain.UserUsecase, version string) *TermsOfService {
+	return &TermsOfService{
+		UserUsecase: u,
+		version:     version,
+	}
+}
+
+// Create refuses users who don't accept the current terms of service
+func (t *TermsOfService) Create(ctx context.Context, user domain.CreateUser) (*domain.User, error) {
+	if err := t.check(user.TOSVersion); err != nil {
+		return nil, err
+	}
+	return t.UserUsecase.Create(ctx, user)
+}
+
+// AcceptTOS refuses versions other than the current one
+func (t *TermsOfService) AcceptTOS(ctx context.Context, version string, claims *auth.Claims) (*domain.User, error) {
+	if err := t.check(version); err != nil {
+		return nil, err
+	}
+	return t.UserUsecase.AcceptTOS(ctx, version, claims)
+}
+
+func (t *TermsOfService) check(version string) error {
+	if version != t.version {
+		return domain.NewError(domain.ErrTOSOutdated, fmt.Sprintf("terms of service version %s must be accepted", t.version))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tests"
+	"github.com/semka95/shortener/backend/user/mock"
+	"github.com/semka95/shortener/backend/user/usecase"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestTermsOfService(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	uc := mock.NewMockUserUsecase(controller)
+	tos := usecase.NewTermsOfService(uc, "2")
+
+	tUser := tests.NewUser()
+	claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	t.Run("create", func(t *testing.T) {
+		cu := domain.CreateUser{Email: tUser.Email, Password: "password", TOSVersion: "2"}
+		uc.EXPECT().Create(gomock.Any(), cu).Return(tUser, nil)
+
+		u, err := tos.Create(context.Background(), cu)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, u)
+	})
+
+	t.Run("create without acceptance", func(t *testing.T) {
+		for _, version := range []string{"", "1"} {
+			u, err := tos.Create(context.Background(), domain.CreateUser{Email: tUser.Email, Password: "password", TOSVersion: version})
+			assert.ErrorIs(t, err, domain.ErrTOSOutdated)
+			assert.Nil(t, u)
+		}
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		uc.EXPECT().AcceptTOS(gomock.Any(), "2", claims).Return(tUser, nil)
+
+		u, err := tos.AcceptTOS(context.Background(), "2", claims)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, u)
+	})
+
+	t.Run("accept outdated", func(t *testing.T) {
+		u, err := tos.AcceptTOS(context.Background(), "1", claims)
+		assert.ErrorIs(t, err, domain.ErrTOSOutdated)
+		assert.Nil(t, u)
+	})
+}
@@ -4,35 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
 
 	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/tracing"
+	"github.com/semka95/shortener/backend/web"
 	"github.com/semka95/shortener/backend/web/auth"
 )
 
 type userUsecase struct {
-	userRepo       domain.UserRepository
-	contextTimeout time.Duration
-	tracer         trace.Tracer
+	userRepo domain.UserRepository
+	timeouts domain.Timeouts
+	tracer   trace.Tracer
+	hasher   domain.PasswordHasher
 }
 
-// NewUserUsecase will create new an userUsecase object representation of user.Usecase interface
-func NewUserUsecase(u domain.UserRepository, timeout time.Duration, tracer trace.Tracer) domain.UserUsecase {
+// NewUserUsecase will create new an userUsecase object representation of user.Usecase interface,
+// passwords are hashed and verified by hasher
+func NewUserUsecase(u domain.UserRepository, timeouts domain.Timeouts, tracer trace.Tracer, hasher domain.PasswordHasher) domain.UserUsecase {
 	return &userUsecase{
-		userRepo:       u,
-		contextTimeout: timeout,
-		tracer:         tracer,
+		userRepo: u,
+		timeouts: timeouts,
+		tracer:   tracing.Tracer(tracer),
+		hasher:   hasher,
 	}
 }
 
-func (uc *userUsecase) GetByID(c context.Context, id string) (*domain.User, error) {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *userUsecase) GetByID(c context.Context, id string) (_ *domain.User, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -46,15 +53,16 @@ func (uc *userUsecase) GetByID(c context.Context, id string) (*domain.User, erro
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("user ID is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		return nil, domain.NewError(domain.ErrBadParamInput, "user ID is not valid ObjectID").WithEntity(domain.EntityUser, id).Wrap(err)
 	}
 
 	return uc.userRepo.GetByID(ctx, objID)
 }
 
-func (uc *userUsecase) Update(c context.Context, updateUser domain.UpdateUser, claims *auth.Claims) error {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *userUsecase) Update(c context.Context, updateUser domain.UpdateUser, claims *auth.Claims) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -69,9 +77,9 @@ func (uc *userUsecase) Update(c context.Context, updateUser domain.UpdateUser, c
 		return fmt.Errorf("can't get %s user: %w", updateUser.ID.Hex(), err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.HashedPassword), []byte(updateUser.CurrentPassword)); err != nil {
+	if err := uc.hasher.Verify(u.HashedPassword, updateUser.CurrentPassword); err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("compare password error: %w: %s", domain.ErrAuthenticationFailure, err.Error())
+		return domain.NewError(domain.ErrAuthenticationFailure, "compare password error").Wrap(err)
 	}
 
 	if !claims.HasRole(auth.RoleAdmin) && u.ID.Hex() != claims.Subject {
@@ -84,16 +92,26 @@ func (uc *userUsecase) Update(c context.Context, updateUser domain.UpdateUser, c
 	}
 
 	if updateUser.Email != nil {
-		u.Email = *updateUser.Email
+		u.Email = domain.NormalizeEmail(*updateUser.Email)
+	}
+
+	if u.MustChangePassword && updateUser.NewPassword == nil {
+		span.RecordError(domain.ErrNewPasswordRequired)
+		return domain.ErrNewPasswordRequired
 	}
 
 	if updateUser.NewPassword != nil {
-		hashedPwd, err := generateHash(*updateUser.NewPassword)
+		if uc.usedPassword(u, *updateUser.NewPassword) {
+			span.RecordError(domain.ErrPasswordReused)
+			return domain.ErrPasswordReused
+		}
+
+		hashedPwd, err := uc.hasher.Hash(*updateUser.NewPassword)
 		if err != nil {
 			span.RecordError(err)
-			return fmt.Errorf("can't generate hash from this password - %s: %w: %s", *updateUser.NewPassword, domain.ErrInternalServerError, err.Error())
+			return domain.InternalError(fmt.Sprintf("can't generate hash from this password - %s", *updateUser.NewPassword), err)
 		}
-		u.HashedPassword = hashedPwd
+		setPassword(u, hashedPwd)
 	}
 
 	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
@@ -101,9 +119,10 @@ func (uc *userUsecase) Update(c context.Context, updateUser domain.UpdateUser, c
 	return uc.userRepo.Update(ctx, u)
 }
 
-func (uc *userUsecase) Create(c context.Context, m domain.CreateUser) (*domain.User, error) {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *userUsecase) Create(c context.Context, m domain.CreateUser) (_ *domain.User, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -112,21 +131,22 @@ func (uc *userUsecase) Create(c context.Context, m domain.CreateUser) (*domain.U
 	)
 	defer span.End()
 
+	m.Email = domain.NormalizeEmail(m.Email)
 	ue, err := uc.userRepo.GetByEmail(ctx, m.Email)
-	if errors.Is(err, domain.ErrInternalServerError) {
+	if errors.Is(err, domain.ErrInternalServerError) || errors.Is(err, domain.ErrUnavailable) {
 		span.RecordError(err)
 		return nil, err
 	}
 	if ue != nil && err == nil {
-		err = fmt.Errorf("user with %s email already exists, try another one, %w", m.Email, domain.ErrBadParamInput)
+		err = domain.NewError(domain.ErrEmailTaken, fmt.Sprintf("user with %s email already exists, try another one", m.Email)).WithField("email")
 		span.RecordError(err)
 		return nil, err
 	}
 
-	hashedPwd, err := generateHash(m.Password)
+	hashedPwd, err := uc.hasher.Hash(m.Password)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("can't generate hash from this password - %s: %w: %s", m.Password, domain.ErrInternalServerError, err.Error())
+		return nil, domain.InternalError(fmt.Sprintf("can't generate hash from this password - %s", m.Password), err)
 	}
 
 	u := &domain.User{
@@ -135,9 +155,14 @@ func (uc *userUsecase) Create(c context.Context, m domain.CreateUser) (*domain.U
 		Email:          m.Email,
 		HashedPassword: hashedPwd,
 		Roles:          []string{auth.RoleUser},
+		TOSVersion:     m.TOSVersion,
 		CreatedAt:      time.Now().Truncate(time.Millisecond).UTC(),
 		UpdatedAt:      time.Now().Truncate(time.Millisecond).UTC(),
 	}
+	if u.TOSVersion != "" {
+		acceptedAt := u.CreatedAt
+		u.TOSAcceptedAt = &acceptedAt
+	}
 	span.SetAttributes(attribute.String("urlid", u.ID.Hex()))
 
 	err = uc.userRepo.Create(ctx, u)
@@ -149,9 +174,44 @@ func (uc *userUsecase) Create(c context.Context, m domain.CreateUser) (*domain.U
 	return u, nil
 }
 
-func (uc *userUsecase) Delete(c context.Context, id string) error {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *userUsecase) CreateServiceAccount(c context.Context, m domain.CreateServiceAccount) (_ *domain.User, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase CreateServiceAccount",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// service accounts have generated email, so they don't take emails of
+	// users, and no password hash, so no password matches
+	id := primitive.NewObjectID()
+	u := &domain.User{
+		ID:        id,
+		FullName:  m.Name,
+		Email:     id.Hex() + "@" + domain.ServiceAccountEmailDomain,
+		Roles:     []string{},
+		Type:      domain.UserTypeService,
+		CreatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+		UpdatedAt: time.Now().Truncate(time.Millisecond).UTC(),
+	}
+	span.SetAttributes(attribute.String("userid", u.ID.Hex()))
+
+	if err := uc.userRepo.Create(ctx, u); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (uc *userUsecase) Delete(c context.Context, id string) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -165,15 +225,16 @@ func (uc *userUsecase) Delete(c context.Context, id string) error {
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("user ID is not valid ObjectID: %w: %s", domain.ErrBadParamInput, err.Error())
+		return domain.NewError(domain.ErrBadParamInput, "user ID is not valid ObjectID").WithEntity(domain.EntityUser, id).Wrap(err)
 	}
 
 	return uc.userRepo.Delete(ctx, objID)
 }
 
-func (uc *userUsecase) Authenticate(c context.Context, now time.Time, email, password string) (*auth.Claims, error) {
-	ctx, cancel := context.WithTimeout(c, uc.contextTimeout)
+func (uc *userUsecase) Authenticate(c context.Context, now time.Time, email, password string) (_ *auth.Claims, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
 	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
 
 	ctx, span := uc.tracer.Start(
 		ctx,
@@ -182,27 +243,522 @@ func (uc *userUsecase) Authenticate(c context.Context, now time.Time, email, pas
 	)
 	defer span.End()
 
-	u, err := uc.userRepo.GetByEmail(ctx, email)
+	u, err := uc.userByPassword(ctx, email, password)
 	if err != nil {
 		span.RecordError(err)
-		return nil, fmt.Errorf("%w: %s", domain.ErrAuthenticationFailure, err.Error())
+		return nil, err
 	}
 	span.SetAttributes(attribute.String("userid", u.ID.Hex()))
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.HashedPassword), []byte(password)); err != nil {
+	if u.IsDisabled() {
+		err = domain.NewError(domain.ErrAuthenticationFailure, "user account is disabled")
 		span.RecordError(err)
-		return nil, fmt.Errorf("compare password error: %w: %s", domain.ErrAuthenticationFailure, err.Error())
+		return nil, err
+	}
+
+	if uc.hasher.NeedsRehash(u.HashedPassword) {
+		go uc.rehashPassword(trace.ContextWithSpanContext(context.Background(), span.SpanContext()), web.LoggerFromContext(ctx), u, password)
 	}
 
-	claims := auth.NewClaims(u.ID.Hex(), u.Roles, now, time.Hour)
+	claims := auth.NewClaims(u.ID.Hex(), u.Roles, now, time.Hour).WithProfile(u.Email, u.FullName)
+	claims.PasswordChangeRequired = u.MustChangePassword
+	claims.TOSVersion = u.TOSVersion
 	return claims, nil
 }
 
-func generateHash(pass string) (string, error) {
-	result, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+func (uc *userUsecase) VerifyPassword(c context.Context, email, password string) (_ *domain.User, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase VerifyPassword",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	u, err := uc.userByPassword(ctx, email, password)
 	if err != nil {
-		return "", err
+		span.RecordError(err)
+		return nil, err
 	}
+	span.SetAttributes(attribute.String("userid", u.ID.Hex()))
 
-	return string(result), nil
+	return u, nil
+}
+
+// userByPassword returns user with given credentials, service accounts have
+// no password
+func (uc *userUsecase) userByPassword(ctx context.Context, email, password string) (*domain.User, error) {
+	u, err := uc.userRepo.GetByEmail(ctx, domain.NormalizeEmail(email))
+	if err != nil {
+		return nil, domain.NewError(domain.ErrAuthenticationFailure, "").Wrap(err)
+	}
+
+	if u.IsService() {
+		return nil, domain.NewError(domain.ErrAuthenticationFailure, "service account can't log in with password")
+	}
+
+	if err := uc.hasher.Verify(u.HashedPassword, password); err != nil {
+		return nil, domain.NewError(domain.ErrAuthenticationFailure, "compare password error").Wrap(err)
+	}
+
+	return u, nil
+}
+
+func (uc *userUsecase) Impersonate(c context.Context, now time.Time, id string, admin *auth.Claims) (_ *auth.Claims, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Impersonate",
+		trace.WithAttributes(
+			attribute.String("userid", id),
+			attribute.String("impersonator", admin.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if admin.IsImpersonated() {
+		err := domain.NewError(domain.ErrForbidden, "impersonation token can't be used to impersonate")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	u, err := uc.getUser(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	target := auth.Claims{Roles: u.Roles}
+	if target.HasRole(auth.RoleAdmin) {
+		err = domain.NewError(domain.ErrForbidden, "admin can't be impersonated")
+		span.RecordError(err)
+		return nil, err
+	}
+	if u.IsService() {
+		err = domain.NewError(domain.ErrForbidden, "service account can't be impersonated")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	claims := auth.NewImpersonationClaims(u.ID.Hex(), u.Roles, admin.Subject, now).WithProfile(u.Email, u.FullName)
+	claims.TOSVersion = u.TOSVersion
+	return claims, nil
+}
+
+func (uc *userUsecase) Disable(c context.Context, id string, disableUser domain.DisableUser, admin *auth.Claims) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Disable",
+		trace.WithAttributes(
+			attribute.String("userid", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if id == admin.Subject {
+		err := domain.NewError(domain.ErrBadParamInput, "admin can't disable own account")
+		span.RecordError(err)
+		return err
+	}
+
+	u, err := uc.getUser(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	u.DisabledAt = &now
+	u.DisabledBy = admin.Subject
+	u.DisabledReason = disableUser.Reason
+	u.UpdatedAt = now
+
+	return uc.userRepo.Update(ctx, u)
+}
+
+func (uc *userUsecase) ForcePasswordReset(c context.Context, id string) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase ForcePasswordReset",
+		trace.WithAttributes(
+			attribute.String("userid", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	u, err := uc.getUser(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if u.IsService() {
+		err = domain.NewError(domain.ErrBadParamInput, "service account has no password")
+		span.RecordError(err)
+		return err
+	}
+
+	u.MustChangePassword = true
+	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+
+	return uc.userRepo.Update(ctx, u)
+}
+
+func (uc *userUsecase) Enable(c context.Context, id string) (err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Enable",
+		trace.WithAttributes(
+			attribute.String("userid", id)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	u, err := uc.getUser(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if !u.IsDisabled() {
+		err = domain.NewError(domain.ErrNoAffected, fmt.Sprintf("user %s is not disabled", id)).WithEntity(domain.EntityUser, id)
+		span.RecordError(err)
+		return err
+	}
+	if u.IsBeingDeleted() {
+		err = domain.NewError(domain.ErrConflict, fmt.Sprintf("user %s is being deleted", id)).WithEntity(domain.EntityUser, id)
+		span.RecordError(err)
+		return err
+	}
+
+	u.DisabledAt = nil
+	u.DisabledBy = ""
+	u.DisabledReason = ""
+	// enabled account is not deleted even if its user requested deletion
+	u.DeleteAfter = nil
+	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+
+	// deletion sweeper could claim account after it was read
+	err = uc.userRepo.Restore(ctx, u)
+	if errors.Is(err, domain.ErrNoAffected) {
+		err = domain.NewError(domain.ErrConflict, fmt.Sprintf("user %s is being deleted", id)).WithEntity(domain.EntityUser, id)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+func (uc *userUsecase) Fetch(c context.Context, filter domain.UserFilter) (_ *domain.UserPage, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationScan)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Fetch",
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	if filter.Limit == 0 {
+		filter.Limit = domain.DefaultUserPageLimit
+	}
+
+	users, err := uc.userRepo.Fetch(ctx, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	page := &domain.UserPage{Users: users}
+	if len(users) > 0 {
+		full := int64(len(users)) == filter.Limit
+		// page before cursor always has next page, page after cursor always
+		// has previous page
+		if full || filter.Before != "" {
+			page.NextCursor = users[len(users)-1].ID.Hex()
+		}
+		if full && filter.Before != "" || filter.Cursor != "" {
+			page.PrevCursor = users[0].ID.Hex()
+		}
+	}
+
+	if filter.WithCount {
+		total, err := uc.userRepo.Count(ctx, filter)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func (uc *userUsecase) GrantRole(c context.Context, email string, role string) (_ *domain.User, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase GrantRole",
+		trace.WithAttributes(
+			attribute.String("role", role)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	u, err := uc.userRepo.GetByEmail(ctx, domain.NormalizeEmail(email))
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	for _, r := range u.Roles {
+		if r == role {
+			return u, nil
+		}
+	}
+
+	u.Roles = append(u.Roles, role)
+	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+
+	if err = uc.userRepo.Update(ctx, u); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (uc *userUsecase) UpdateSettings(c context.Context, settings domain.UserSettings, claims *auth.Claims) (_ *domain.UserSettings, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase UpdateSettings",
+		trace.WithAttributes(
+			attribute.String("userid", claims.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	u, err := uc.getUser(ctx, claims.Subject)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	u.Settings = settings
+	u.UpdatedAt = time.Now().Truncate(time.Millisecond).UTC()
+
+	if err = uc.userRepo.Update(ctx, u); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return &u.Settings, nil
+}
+
+func (uc *userUsecase) AcceptTOS(c context.Context, version string, claims *auth.Claims) (_ *domain.User, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase AcceptTOS",
+		trace.WithAttributes(
+			attribute.String("userid", claims.Subject),
+			attribute.String("tos_version", version)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	// only the user may accept terms of service, not admin acting as one
+	if claims.IsImpersonated() {
+		err = domain.NewError(domain.ErrForbidden, "terms of service can't be accepted while impersonated")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	u, err := uc.getUser(ctx, claims.Subject)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	now := time.Now().Truncate(time.Millisecond).UTC()
+	u.TOSVersion = version
+	u.TOSAcceptedAt = &now
+	u.UpdatedAt = now
+
+	if err = uc.userRepo.Update(ctx, u); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (uc *userUsecase) Introspect(c context.Context, claims *auth.Claims) (_ *domain.TokenIntrospection, err error) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationRead)
+	defer cancel()
+	defer domain.WrapTimeout(ctx, &err)
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase Introspect",
+		trace.WithAttributes(
+			attribute.String("userid", claims.Subject)),
+		trace.WithSpanKind(trace.SpanKindServer),
+	)
+	defer span.End()
+
+	inactive := &domain.TokenIntrospection{}
+
+	active, err := uc.activeUser(ctx, claims.Subject)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	if !active {
+		return inactive, nil
+	}
+
+	// impersonation token is valid only while admin who got it is
+	if claims.IsImpersonated() {
+		active, err = uc.activeUser(ctx, claims.Impersonator, auth.RoleAdmin)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		if !active {
+			return inactive, nil
+		}
+	}
+
+	result := &domain.TokenIntrospection{
+		Active:       true,
+		Subject:      claims.Subject,
+		Scope:        strings.Join(claims.Roles, " "),
+		Roles:        claims.Roles,
+		TokenType:    "Bearer",
+		Impersonator: claims.Impersonator,
+	}
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return result, nil
+}
+
+// activeUser reports whether user by given id exists, isn't disabled and has
+// one of roles if any are given
+func (uc *userUsecase) activeUser(ctx context.Context, id string, roles ...string) (bool, error) {
+	u, err := uc.getUser(ctx, id)
+	if errors.Is(err, domain.ErrBadParamInput) || errors.Is(err, domain.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if u.IsDisabled() {
+		return false, nil
+	}
+	if len(roles) > 0 && !(&auth.Claims{Roles: u.Roles}).HasRole(roles...) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (uc *userUsecase) getUser(ctx context.Context, id string) (*domain.User, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, domain.NewError(domain.ErrBadParamInput, "user ID is not valid ObjectID").WithEntity(domain.EntityUser, id).Wrap(err)
+	}
+
+	u, err := uc.userRepo.GetByID(ctx, objID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get %s user: %w", id, err)
+	}
+
+	return u, nil
+}
+
+// rehashPassword stores password hash made with configured scheme, so scheme
+// and its parameters can be changed without password resets. Errors are only
+// logged, login doesn't wait for rehash.
+func (uc *userUsecase) rehashPassword(c context.Context, logger *zap.Logger, u *domain.User, password string) {
+	ctx, cancel := uc.timeouts.WithTimeout(c, domain.OperationWrite)
+	defer cancel()
+
+	ctx, span := uc.tracer.Start(
+		ctx,
+		"usecase rehashPassword",
+		trace.WithAttributes(
+			attribute.String("userid", u.ID.Hex())),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	hashedPwd, err := uc.hasher.Hash(password)
+	if err == nil {
+		err = uc.userRepo.UpdatePasswordHash(ctx, u.ID, u.HashedPassword, hashedPwd)
+	}
+	if err != nil && !errors.Is(err, domain.ErrNoAffected) {
+		span.RecordError(err)
+		logger.Warn("can't rehash password", zap.String("userid", u.ID.Hex()), zap.Error(err))
+	}
+}
+
+// usedPassword reports whether password is the current or one of previous
+// passwords of the user
+func (uc *userUsecase) usedPassword(u *domain.User, password string) bool {
+	hashes := append([]string{u.HashedPassword}, u.PasswordHistory...)
+	for _, hash := range hashes {
+		if uc.hasher.Verify(hash, password) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// setPassword replaces password hash of the user and moves the current one to
+// history, history keeps hashes of PasswordHistorySize-1 previous passwords.
+// It clears password change requirement.
+func setPassword(u *domain.User, hashedPwd string) {
+	history := append([]string{u.HashedPassword}, u.PasswordHistory...)
+	if len(history) > domain.PasswordHistorySize-1 {
+		history = history[:domain.PasswordHistorySize-1]
+	}
+	u.PasswordHistory = history
+	u.HashedPassword = hashedPwd
+	u.MustChangePassword = false
 }
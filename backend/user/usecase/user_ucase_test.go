@@ -2,16 +2,22 @@ package usecase_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/pwhash"
 	"github.com/semka95/shortener/backend/tests"
 	"github.com/semka95/shortener/backend/user/mock"
 	"github.com/semka95/shortener/backend/user/usecase"
@@ -20,6 +26,13 @@ import (
 
 var tracer = sdktrace.NewTracerProvider().Tracer("")
 
+func newHasher(t *testing.T, cfg pwhash.Config) *pwhash.Hasher {
+	t.Helper()
+	h, err := pwhash.New(cfg)
+	require.NoError(t, err)
+	return h
+}
+
 func TestUserUsecase_GetByID(t *testing.T) {
 	controller := gomock.NewController(t)
 	defer controller.Finish()
@@ -27,7 +40,7 @@ func TestUserUsecase_GetByID(t *testing.T) {
 	tUser := tests.NewUser()
 
 	repository := mock.NewMockUserRepository(controller)
-	uc := usecase.NewUserUsecase(repository, 10*time.Second, tracer)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
 
 	t.Run("user id is not valid", func(t *testing.T) {
 		result, err := uc.GetByID(context.Background(), "not valid id")
@@ -58,7 +71,7 @@ func TestUserUsecase_Update(t *testing.T) {
 	tUpdateUser := tests.NewUpdateUser()
 
 	repository := mock.NewMockUserRepository(controller)
-	uc := usecase.NewUserUsecase(repository, 10*time.Second, tracer)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
 	claims := auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, time.Now(), time.Minute)
 
 	t.Run("user not exists", func(t *testing.T) {
@@ -133,6 +146,95 @@ func TestUserUsecase_Update(t *testing.T) {
 	})
 }
 
+func TestUserUsecase_UpdatePasswordHistory(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	repository := mock.NewMockUserRepository(controller)
+	repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil).AnyTimes()
+	repository.EXPECT().Update(gomock.Any(), tUser).Return(nil).AnyTimes()
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+	claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+
+	current := "password"
+	changePassword := func(password string) error {
+		err := uc.Update(context.Background(), domain.UpdateUser{ID: tUser.ID, CurrentPassword: current, NewPassword: &password}, claims)
+		if err == nil {
+			current = password
+		}
+		return err
+	}
+
+	t.Run("current password", func(t *testing.T) {
+		assert.ErrorIs(t, changePassword("password"), domain.ErrPasswordReused)
+	})
+
+	t.Run("previous passwords", func(t *testing.T) {
+		for i := 1; i < domain.PasswordHistorySize; i++ {
+			require.NoError(t, changePassword(fmt.Sprintf("password%d", i)))
+		}
+		assert.Len(t, tUser.PasswordHistory, domain.PasswordHistorySize-1)
+
+		for i := 0; i < domain.PasswordHistorySize; i++ {
+			password := "password"
+			if i > 0 {
+				password = fmt.Sprintf("password%d", i)
+			}
+			assert.ErrorIs(t, changePassword(password), domain.ErrPasswordReused, password)
+		}
+	})
+
+	t.Run("oldest password is rotated out by the 6th one", func(t *testing.T) {
+		require.NoError(t, changePassword(fmt.Sprintf("password%d", domain.PasswordHistorySize)))
+		assert.Len(t, tUser.PasswordHistory, domain.PasswordHistorySize-1)
+		assert.ErrorIs(t, changePassword("password1"), domain.ErrPasswordReused)
+
+		require.NoError(t, changePassword("password"))
+		err := bcrypt.CompareHashAndPassword([]byte(tUser.HashedPassword), []byte("password"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("history is not serialized", func(t *testing.T) {
+		b, err := json.Marshal(tUser)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "password")
+		for _, hash := range tUser.PasswordHistory {
+			assert.NotContains(t, string(b), hash)
+		}
+	})
+}
+
+func TestUserUsecase_UpdateMustChangePassword(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	tUser.MustChangePassword = true
+	repository := mock.NewMockUserRepository(controller)
+	repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil).AnyTimes()
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+	claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+	claims.PasswordChangeRequired = true
+
+	t.Run("new password required", func(t *testing.T) {
+		fullName := "Jane Doe"
+		err := uc.Update(context.Background(), domain.UpdateUser{ID: tUser.ID, CurrentPassword: "password", FullName: &fullName}, claims)
+		assert.ErrorIs(t, err, domain.ErrNewPasswordRequired)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.True(t, tUser.MustChangePassword)
+	})
+
+	t.Run("password change clears flag", func(t *testing.T) {
+		repository.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+		newPassword := "new_password"
+		err := uc.Update(context.Background(), domain.UpdateUser{ID: tUser.ID, CurrentPassword: "password", NewPassword: &newPassword}, claims)
+		require.NoError(t, err)
+		assert.False(t, tUser.MustChangePassword)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(tUser.HashedPassword), []byte(newPassword)))
+	})
+}
+
 func TestUserUsecase_Create(t *testing.T) {
 	controller := gomock.NewController(t)
 	defer controller.Finish()
@@ -140,7 +242,7 @@ func TestUserUsecase_Create(t *testing.T) {
 	tCreateUser := tests.NewCreateUser()
 
 	repository := mock.NewMockUserRepository(controller)
-	uc := usecase.NewUserUsecase(repository, 10*time.Second, tracer)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
 
 	t.Run("internal server error", func(t *testing.T) {
 		repository.EXPECT().GetByEmail(gomock.Any(), tCreateUser.Email).Return(nil, domain.ErrNotFound)
@@ -154,10 +256,28 @@ func TestUserUsecase_Create(t *testing.T) {
 		tUser := tests.NewUser()
 		repository.EXPECT().GetByEmail(gomock.Any(), tCreateUser.Email).Return(tUser, nil)
 		result, err := uc.Create(context.Background(), tCreateUser)
-		assert.Error(t, err, domain.ErrBadParamInput)
+		assert.ErrorIs(t, err, domain.ErrEmailTaken)
 		assert.Empty(t, result)
 	})
 
+	t.Run("email is normalized", func(t *testing.T) {
+		mixedCase := tCreateUser
+		mixedCase.Email = " " + strings.ToUpper(tCreateUser.Email) + " "
+		repository.EXPECT().GetByEmail(gomock.Any(), tCreateUser.Email).Return(nil, domain.ErrNotFound)
+		repository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+		result, err := uc.Create(context.Background(), mixedCase)
+		require.NoError(t, err)
+		assert.Equal(t, tCreateUser.Email, result.Email)
+	})
+
+	t.Run("email taken concurrently", func(t *testing.T) {
+		repository.EXPECT().GetByEmail(gomock.Any(), tCreateUser.Email).Return(nil, domain.ErrNotFound)
+		repository.EXPECT().Create(gomock.Any(), gomock.Any()).Return(fmt.Errorf("user with email %s already exists: %w", tCreateUser.Email, domain.ErrEmailTaken))
+		result, err := uc.Create(context.Background(), tCreateUser)
+		assert.ErrorIs(t, err, domain.ErrEmailTaken)
+		assert.Nil(t, result)
+	})
+
 	t.Run("email check server error", func(t *testing.T) {
 		repository.EXPECT().GetByEmail(gomock.Any(), tCreateUser.Email).Return(nil, domain.ErrInternalServerError)
 		result, err := uc.Create(context.Background(), tCreateUser)
@@ -186,7 +306,7 @@ func TestUserUsecase_Delete(t *testing.T) {
 	tUser := tests.NewUser()
 
 	repository := mock.NewMockUserRepository(controller)
-	uc := usecase.NewUserUsecase(repository, 10*time.Second, tracer)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
 
 	t.Run("user id is not valid", func(t *testing.T) {
 		err := uc.Delete(context.Background(), "not valid id")
@@ -215,7 +335,7 @@ func TestUserUsecase_Authenticate(t *testing.T) {
 	password := "password"
 
 	repository := mock.NewMockUserRepository(controller)
-	uc := usecase.NewUserUsecase(repository, 10*time.Second, tracer)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
 
 	t.Run("user not found", func(t *testing.T) {
 		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(nil, domain.ErrNotFound)
@@ -238,5 +358,671 @@ func TestUserUsecase_Authenticate(t *testing.T) {
 		assert.Equal(t, result.Roles[0], auth.RoleUser)
 		assert.Equal(t, result.Subject, tUser.ID.Hex())
 		assert.Equal(t, result.IssuedAt, jwt.NewNumericDate(now))
+		assert.Equal(t, tUser.Email, result.Email)
+		assert.Equal(t, tUser.FullName, result.Name)
+		assert.False(t, result.PasswordChangeRequired)
+	})
+
+	t.Run("email is normalized", func(t *testing.T) {
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		result, err := uc.Authenticate(context.Background(), now, " "+strings.ToUpper(tUser.Email), password)
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), result.Subject)
+	})
+
+	t.Run("password change required", func(t *testing.T) {
+		forced := tests.NewUser()
+		forced.MustChangePassword = true
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(forced, nil)
+		result, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		require.NoError(t, err)
+		assert.True(t, result.PasswordChangeRequired)
+		assert.Equal(t, forced.ID.Hex(), result.Subject)
+	})
+
+	t.Run("user disabled", func(t *testing.T) {
+		disabled := tests.NewUser()
+		disabled.DisabledAt = tests.DatePointer(now)
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(disabled, nil)
+		result, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, result)
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		service := tests.NewUser()
+		service.Type = domain.UserTypeService
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(service, nil)
+		result, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, result)
+	})
+}
+
+func TestUserUsecase_VerifyPassword(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	password := "password"
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		result, err := uc.VerifyPassword(context.Background(), tUser.Email, password)
+		require.NoError(t, err)
+		assert.Equal(t, tUser, result)
+	})
+
+	// accounts scheduled for deletion are restored with password
+	t.Run("user disabled", func(t *testing.T) {
+		disabled := tests.NewUser()
+		disabled.DisabledAt = tests.DatePointer(time.Now())
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(disabled, nil)
+		result, err := uc.VerifyPassword(context.Background(), tUser.Email, password)
+		require.NoError(t, err)
+		assert.Equal(t, disabled, result)
+	})
+
+	t.Run("incorrect password", func(t *testing.T) {
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		result, err := uc.VerifyPassword(context.Background(), tUser.Email, "incorrect_pwd")
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, result)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(nil, domain.ErrNotFound)
+		result, err := uc.VerifyPassword(context.Background(), tUser.Email, password)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, result)
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		service := tests.NewUser()
+		service.Type = domain.UserTypeService
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(service, nil)
+		result, err := uc.VerifyPassword(context.Background(), tUser.Email, password)
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+		assert.Nil(t, result)
+	})
+}
+
+func TestUserUsecase_CreateServiceAccount(t *testing.T) {
+	repository := tests.NewMemoryUserRepository()
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	first, err := uc.CreateServiceAccount(context.Background(), domain.CreateServiceAccount{Name: "crm"})
+	require.NoError(t, err)
+	assert.True(t, first.IsService())
+	assert.Equal(t, "crm", first.FullName)
+	assert.Empty(t, first.Roles)
+	assert.Empty(t, first.HashedPassword)
+	assert.Equal(t, first.ID.Hex()+"@"+domain.ServiceAccountEmailDomain, first.Email)
+
+	second, err := uc.CreateServiceAccount(context.Background(), domain.CreateServiceAccount{Name: "crm"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Email, second.Email)
+
+	stored, err := repository.GetByID(context.Background(), first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first, stored)
+
+	page, err := uc.Fetch(context.Background(), domain.UserFilter{Type: domain.UserTypeService})
+	require.NoError(t, err)
+	assert.Len(t, page.Users, 2)
+}
+
+func TestUserUsecase_Introspect(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	now := time.Now()
+	claims := auth.NewClaims(tUser.ID.Hex(), tUser.Roles, now, time.Hour)
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		result, err := uc.Introspect(context.Background(), claims)
+		require.NoError(t, err)
+		assert.True(t, result.Active)
+		assert.Equal(t, tUser.ID.Hex(), result.Subject)
+		assert.Equal(t, auth.RoleUser, result.Scope)
+		assert.Equal(t, claims.ExpiresAt.Unix(), result.ExpiresAt)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+		result, err := uc.Introspect(context.Background(), claims)
+		require.NoError(t, err)
+		assert.Equal(t, &domain.TokenIntrospection{}, result)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrInternalServerError)
+		result, err := uc.Introspect(context.Background(), claims)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+	})
+}
+
+func TestUserUsecase_AuthenticateRehash(t *testing.T) {
+	now := time.Now()
+	password := "password"
+
+	t.Run("hash of lower cost is replaced", func(t *testing.T) {
+		repository := tests.NewMemoryUserRepository()
+		tUser := tests.NewUser()
+		require.NoError(t, repository.Create(context.Background(), tUser))
+		uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{BcryptCost: bcrypt.DefaultCost + 1}))
+
+		result, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), result.Subject)
+
+		assert.Eventually(t, func() bool {
+			u, err := repository.GetByID(context.Background(), tUser.ID)
+			require.NoError(t, err)
+			cost, err := bcrypt.Cost([]byte(u.HashedPassword))
+			require.NoError(t, err)
+			return cost == bcrypt.DefaultCost+1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		_, err = uc.Authenticate(context.Background(), now, tUser.Email, password)
+		assert.NoError(t, err)
+	})
+
+	t.Run("bcrypt hash is migrated to argon2id", func(t *testing.T) {
+		repository := tests.NewMemoryUserRepository()
+		tUser := tests.NewUser()
+		require.NoError(t, repository.Create(context.Background(), tUser))
+		hasher := newHasher(t, pwhash.Config{
+			Scheme:   pwhash.SchemeArgon2id,
+			Argon2id: pwhash.Argon2idParams{Memory: 256, Iterations: 1, Parallelism: 1},
+		})
+		uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, hasher)
+
+		_, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			u, err := repository.GetByID(context.Background(), tUser.ID)
+			require.NoError(t, err)
+			return strings.HasPrefix(u.HashedPassword, "$argon2id$v=19$m=256,t=1,p=1$")
+		}, 5*time.Second, 10*time.Millisecond)
+
+		_, err = uc.Authenticate(context.Background(), now, tUser.Email, password)
+		assert.NoError(t, err)
+		_, err = uc.Authenticate(context.Background(), now, tUser.Email, "wrong password")
+		assert.ErrorIs(t, err, domain.ErrAuthenticationFailure)
+	})
+
+	t.Run("hash of higher cost is kept", func(t *testing.T) {
+		controller := gomock.NewController(t)
+		defer controller.Finish()
+		repository := mock.NewMockUserRepository(controller)
+		uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{BcryptCost: bcrypt.MinCost}))
+		tUser := tests.NewUser()
+
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		_, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		require.NoError(t, err)
+	})
+
+	t.Run("failed rehash doesn't fail login", func(t *testing.T) {
+		controller := gomock.NewController(t)
+		defer controller.Finish()
+		repository := mock.NewMockUserRepository(controller)
+		uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{BcryptCost: bcrypt.DefaultCost + 1}))
+		tUser := tests.NewUser()
+
+		rehashed := make(chan struct{})
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		repository.EXPECT().UpdatePasswordHash(gomock.Any(), tUser.ID, tUser.HashedPassword, gomock.Any()).DoAndReturn(
+			func(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+				close(rehashed)
+				return domain.ErrInternalServerError
+			})
+
+		result, err := uc.Authenticate(context.Background(), now, tUser.Email, password)
+		require.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), result.Subject)
+		<-rehashed
+	})
+}
+
+func TestUserUsecase_Impersonate(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	now := time.Now()
+	adminID := "507f191e810c19729de860ec"
+	admin := auth.NewClaims(adminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("user id is not valid", func(t *testing.T) {
+		result, err := uc.Impersonate(context.Background(), now, "not valid id", admin)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.Nil(t, result)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+		result, err := uc.Impersonate(context.Background(), now, tUser.ID.Hex(), admin)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, result)
+	})
+
+	t.Run("target is admin", func(t *testing.T) {
+		tAdmin := tests.NewUser()
+		tAdmin.Roles = []string{auth.RoleUser, auth.RoleAdmin}
+		repository.EXPECT().GetByID(gomock.Any(), tAdmin.ID).Return(tAdmin, nil)
+		result, err := uc.Impersonate(context.Background(), now, tAdmin.ID.Hex(), admin)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("target is service account", func(t *testing.T) {
+		service := tests.NewUser()
+		service.Type = domain.UserTypeService
+		repository.EXPECT().GetByID(gomock.Any(), service.ID).Return(service, nil)
+		result, err := uc.Impersonate(context.Background(), now, service.ID.Hex(), admin)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("impersonation token can't impersonate", func(t *testing.T) {
+		impersonated := auth.NewImpersonationClaims(adminID, []string{auth.RoleAdmin}, "507f191e810c19729de860ed", now)
+		result, err := uc.Impersonate(context.Background(), now, tUser.ID.Hex(), impersonated)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, result)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		result, err := uc.Impersonate(context.Background(), now, tUser.ID.Hex(), admin)
+		assert.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), result.Subject)
+		assert.Equal(t, tUser.Email, result.Email)
+		assert.Equal(t, adminID, result.Impersonator)
+		assert.Equal(t, tUser.Roles, result.Roles)
+		assert.Equal(t, jwt.NewNumericDate(now.Add(auth.ImpersonationTTL)), result.ExpiresAt)
+	})
+}
+
+func TestUserUsecase_Disable(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	admin := auth.NewClaims("507f191e810c19729de860ec", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	disableUser := domain.DisableUser{Reason: "spam"}
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("user id is not valid", func(t *testing.T) {
+		err := uc.Disable(context.Background(), "not valid id", disableUser, admin)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+
+	t.Run("admin disables himself", func(t *testing.T) {
+		err := uc.Disable(context.Background(), admin.Subject, disableUser, admin)
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+		err := uc.Disable(context.Background(), tUser.ID.Hex(), disableUser, admin)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		repository.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+
+		err := uc.Disable(context.Background(), tUser.ID.Hex(), disableUser, admin)
+		assert.NoError(t, err)
+		assert.True(t, tUser.IsDisabled())
+		assert.Equal(t, admin.Subject, tUser.DisabledBy)
+		assert.Equal(t, disableUser.Reason, tUser.DisabledReason)
+	})
+}
+
+func TestUserUsecase_Enable(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("user is not disabled", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		err := uc.Enable(context.Background(), tUser.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNoAffected)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		tUser.DisabledAt = tests.DatePointer(time.Now())
+		tUser.DisabledBy = "507f191e810c19729de860ec"
+		tUser.DisabledReason = "spam"
+		tUser.DeleteAfter = tests.DatePointer(time.Now().AddDate(0, 0, 14))
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		repository.EXPECT().Restore(gomock.Any(), tUser).Return(nil)
+
+		err := uc.Enable(context.Background(), tUser.ID.Hex())
+		assert.NoError(t, err)
+		assert.False(t, tUser.IsDisabled())
+		assert.False(t, tUser.IsDeletionScheduled())
+		assert.Empty(t, tUser.DisabledBy)
+		assert.Empty(t, tUser.DisabledReason)
+	})
+
+	t.Run("user is being deleted", func(t *testing.T) {
+		deleting := tests.NewUser()
+		deleting.DisabledAt = tests.DatePointer(time.Now().AddDate(0, 0, -20))
+		deleting.DeleteAfter = tests.DatePointer(time.Now().AddDate(0, 0, -6))
+		deleting.DeletingAt = tests.DatePointer(time.Now())
+		repository.EXPECT().GetByID(gomock.Any(), deleting.ID).Return(deleting, nil)
+
+		err := uc.Enable(context.Background(), deleting.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrConflict)
+		assert.True(t, deleting.IsDeletionScheduled())
+	})
+
+	t.Run("user is claimed for deletion after it was read", func(t *testing.T) {
+		deleting := tests.NewUser()
+		deleting.DisabledAt = tests.DatePointer(time.Now().AddDate(0, 0, -20))
+		deleting.DeleteAfter = tests.DatePointer(time.Now().AddDate(0, 0, -6))
+		repository.EXPECT().GetByID(gomock.Any(), deleting.ID).Return(deleting, nil)
+		repository.EXPECT().Restore(gomock.Any(), deleting).Return(domain.ErrNoAffected)
+
+		err := uc.Enable(context.Background(), deleting.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrConflict)
+	})
+}
+
+func TestUserUsecase_ForcePasswordReset(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("success", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		repository.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+
+		err := uc.ForcePasswordReset(context.Background(), tUser.ID.Hex())
+		assert.NoError(t, err)
+		assert.True(t, tUser.MustChangePassword)
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		service := tests.NewUser()
+		service.Type = domain.UserTypeService
+		repository.EXPECT().GetByID(gomock.Any(), service.ID).Return(service, nil)
+
+		err := uc.ForcePasswordReset(context.Background(), service.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+		assert.False(t, service.MustChangePassword)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+
+		err := uc.ForcePasswordReset(context.Background(), tUser.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		err := uc.ForcePasswordReset(context.Background(), "wrong")
+		assert.ErrorIs(t, err, domain.ErrBadParamInput)
+	})
+}
+
+func TestUserUsecase_Fetch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("full page returns cursor", func(t *testing.T) {
+		filter := domain.UserFilter{Status: domain.UserStatusDisabled, Limit: 1}
+		repository.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.User{tUser}, nil)
+
+		result, err := uc.Fetch(context.Background(), filter)
+		assert.NoError(t, err)
+		assert.Equal(t, tUser.ID.Hex(), result.NextCursor)
+		assert.Len(t, result.Users, 1)
+	})
+
+	t.Run("default limit, last page", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any(), domain.UserFilter{Limit: 20}).Return([]*domain.User{tUser}, nil)
+
+		result, err := uc.Fetch(context.Background(), domain.UserFilter{})
+		assert.NoError(t, err)
+		assert.Empty(t, result.NextCursor)
+	})
+
+	t.Run("page after cursor has prev cursor", func(t *testing.T) {
+		filter := domain.UserFilter{Cursor: "507f191e810c19729de860e0", Limit: 2}
+		repository.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.User{tUser}, nil)
+
+		result, err := uc.Fetch(context.Background(), filter)
+		require.NoError(t, err)
+		assert.Empty(t, result.NextCursor)
+		assert.Equal(t, tUser.ID.Hex(), result.PrevCursor)
+		assert.Nil(t, result.Total)
+	})
+
+	t.Run("page before cursor", func(t *testing.T) {
+		first, second := tests.NewUser(), tests.NewUser()
+		second.ID = primitive.NewObjectID()
+		filter := domain.UserFilter{Before: "ffffffffffffffffffffffff", Limit: 2}
+		repository.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.User{first, second}, nil)
+
+		result, err := uc.Fetch(context.Background(), filter)
+		require.NoError(t, err)
+		assert.Equal(t, second.ID.Hex(), result.NextCursor)
+		assert.Equal(t, first.ID.Hex(), result.PrevCursor)
+
+		filter.Limit = 3
+		repository.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.User{first, second}, nil)
+
+		result, err = uc.Fetch(context.Background(), filter)
+		require.NoError(t, err)
+		assert.Equal(t, second.ID.Hex(), result.NextCursor)
+		assert.Empty(t, result.PrevCursor)
+	})
+
+	t.Run("with count", func(t *testing.T) {
+		filter := domain.UserFilter{Status: domain.UserStatusActive, Limit: 1, WithCount: true}
+		repository.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.User{tUser}, nil)
+		repository.EXPECT().Count(gomock.Any(), filter).Return(int64(5), nil)
+
+		result, err := uc.Fetch(context.Background(), filter)
+		require.NoError(t, err)
+		require.NotNil(t, result.Total)
+		assert.Equal(t, int64(5), *result.Total)
+	})
+
+	t.Run("count error", func(t *testing.T) {
+		filter := domain.UserFilter{Limit: 1, WithCount: true}
+		repository.EXPECT().Fetch(gomock.Any(), filter).Return([]*domain.User{tUser}, nil)
+		repository.EXPECT().Count(gomock.Any(), filter).Return(int64(0), domain.ErrInternalServerError)
+
+		result, err := uc.Fetch(context.Background(), filter)
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repository.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, domain.ErrInternalServerError)
+
+		result, err := uc.Fetch(context.Background(), domain.UserFilter{})
+		assert.ErrorIs(t, err, domain.ErrInternalServerError)
+		assert.Nil(t, result)
+	})
+}
+
+func TestUserUsecase_GrantRole(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("success", func(t *testing.T) {
+		tUser := tests.NewUser()
+		tUser.Roles = []string{auth.RoleUser}
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+		repository.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+
+		u, err := uc.GrantRole(context.Background(), tUser.Email, auth.RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, []string{auth.RoleUser, auth.RoleAdmin}, u.Roles)
+	})
+
+	t.Run("role already granted", func(t *testing.T) {
+		tUser := tests.NewUser()
+		tUser.Roles = []string{auth.RoleUser, auth.RoleAdmin}
+		repository.EXPECT().GetByEmail(gomock.Any(), tUser.Email).Return(tUser, nil)
+
+		u, err := uc.GrantRole(context.Background(), tUser.Email, auth.RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, []string{auth.RoleUser, auth.RoleAdmin}, u.Roles)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		repository.EXPECT().GetByEmail(gomock.Any(), "missing@example.com").Return(nil, domain.ErrNotFound)
+
+		u, err := uc.GrantRole(context.Background(), "missing@example.com", auth.RoleAdmin)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, u)
+	})
+}
+
+func TestUserUsecase_UpdateSettings(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+	settings := domain.UserSettings{DefaultExpirationDays: 90}
+
+	t.Run("success", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		repository.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+
+		result, err := uc.UpdateSettings(context.Background(), settings, claims)
+		require.NoError(t, err)
+		assert.Equal(t, settings, *result)
+		assert.Equal(t, settings, tUser.Settings)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(nil, domain.ErrNotFound)
+
+		result, err := uc.UpdateSettings(context.Background(), settings, claims)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.Nil(t, result)
+	})
+}
+
+func TestUserUsecase_AcceptTOS(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	repository := mock.NewMockUserRepository(controller)
+	uc := usecase.NewUserUsecase(repository, domain.NewTimeouts(10*time.Second), tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("success", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewClaims(tUser.ID.Hex(), []string{auth.RoleUser}, time.Now(), time.Minute)
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).Return(tUser, nil)
+		repository.EXPECT().Update(gomock.Any(), tUser).Return(nil)
+
+		u, err := uc.AcceptTOS(context.Background(), "2", claims)
+		require.NoError(t, err)
+		assert.Equal(t, "2", u.TOSVersion)
+		require.NotNil(t, u.TOSAcceptedAt)
+		assert.WithinDuration(t, time.Now(), *u.TOSAcceptedAt, time.Second)
+	})
+
+	t.Run("impersonated", func(t *testing.T) {
+		tUser := tests.NewUser()
+		claims := auth.NewImpersonationClaims(tUser.ID.Hex(), []string{auth.RoleUser}, "507f191e810c19729de860ec", time.Now())
+
+		u, err := uc.AcceptTOS(context.Background(), "2", claims)
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		assert.Nil(t, u)
+	})
+}
+
+func TestUserUsecase_Timeouts(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	tUser := tests.NewUser()
+	repository := mock.NewMockUserRepository(controller)
+	timeouts := domain.Timeouts{Read: time.Minute, Write: 20 * time.Millisecond, Scan: time.Minute}
+	uc := usecase.NewUserUsecase(repository, timeouts, tracer, newHasher(t, pwhash.Config{}))
+
+	t.Run("write expires mid-operation", func(t *testing.T) {
+		repository.EXPECT().Delete(gomock.Any(), tUser.ID).DoAndReturn(func(ctx context.Context, id primitive.ObjectID) error {
+			<-ctx.Done()
+			return fmt.Errorf("user delete error: %w: %s", domain.ErrInternalServerError, ctx.Err())
+		})
+
+		err := uc.Delete(context.Background(), tUser.ID.Hex())
+		assert.ErrorIs(t, err, domain.ErrTimeout)
+		assert.NotErrorIs(t, err, domain.ErrInternalServerError)
+	})
+
+	t.Run("read gets read budget", func(t *testing.T) {
+		repository.EXPECT().GetByID(gomock.Any(), tUser.ID).DoAndReturn(func(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+			return tUser, nil
+		})
+
+		_, err := uc.GetByID(context.Background(), tUser.ID.Hex())
+		assert.NoError(t, err)
+	})
+
+	t.Run("shorter caller deadline is kept", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		repository.EXPECT().Fetch(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, filter domain.UserFilter) ([]*domain.User, error) {
+			<-ctx.Done()
+			return nil, fmt.Errorf("can't execute command: %w", ctx.Err())
+		})
+
+		start := time.Now()
+		page, err := uc.Fetch(ctx, domain.UserFilter{})
+		assert.ErrorIs(t, err, domain.ErrTimeout)
+		assert.Nil(t, page)
+		assert.Less(t, time.Since(start), time.Second)
 	})
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/golang-jwt/jwt/v4"
 	echojwt "github.com/labstack/echo-jwt/v4"
@@ -21,6 +22,14 @@ import (
 // endpoint. See https://auth0.com/docs/jwks for more details.
 type KeyLookupFunc func(kid string) (*rsa.PublicKey, error)
 
+// ErrPasswordChangeRequired is returned by JWTConfig for tokens of users who
+// must change password, such tokens are accepted only by PasswordChangeConfig.
+var ErrPasswordChangeRequired = errors.New("password change required")
+
+// HeaderTOSOutdated is set to the current terms of service version in
+// responses to users who accepted an older one
+const HeaderTOSOutdated = "X-TOS-Outdated"
+
 // NewSimpleKeyLookupFunc is a simple implementation of KeyFunc that only ever
 // supports one key. This is easy for development but in production should be
 // replaced with a caching layer that calls a JWKS endpoint.
@@ -44,6 +53,11 @@ type Authenticator struct {
 	algorithm        string
 	pubKeyLookupFunc KeyLookupFunc
 	parser           *jwt.Parser
+	shareKey         []byte
+	deletionKey      []byte
+	downloadKey      []byte
+	hmacParser       *jwt.Parser
+	tosVersion       string
 }
 
 // NewAuthenticator creates an *Authenticator for use. It will error if:
@@ -72,26 +86,82 @@ func NewAuthenticator(privateKey *rsa.PrivateKey, activeKID, algorithm string, p
 		ValidMethods: []string{algorithm},
 	}
 
-	jwtConfig := echojwt.Config{
-		SigningMethod: algorithm,
-		SigningKey:    privateKey.Public().(*rsa.PublicKey),
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(Claims)
-		},
-	}
-
 	a := Authenticator{
-		JWTConfig:        jwtConfig,
 		privateKey:       privateKey,
 		activeKID:        activeKID,
 		algorithm:        algorithm,
 		pubKeyLookupFunc: publicKeyLookupFunc,
 		parser:           &parser,
+		shareKey:         derivedKey(privateKey, shareAudience),
+		deletionKey:      derivedKey(privateKey, deletionAudience),
+		downloadKey:      derivedKey(privateKey, downloadAudience),
+		hmacParser:       &jwt.Parser{ValidMethods: []string{hmacSigningMethod.Alg()}},
+	}
+	a.JWTConfig = echojwt.Config{
+		ParseTokenFunc: a.parseToken(false),
+		ErrorHandler:   jwtErrorHandler,
 	}
 
 	return &a, nil
 }
 
+// PasswordChangeConfig returns JWT middleware config that, unlike JWTConfig,
+// accepts tokens of users who must change password. It is meant for password
+// change route only.
+func (a *Authenticator) PasswordChangeConfig() echojwt.Config {
+	cfg := a.JWTConfig
+	cfg.ParseTokenFunc = a.parseToken(true)
+	return cfg
+}
+
+// SetTOSVersion sets the current terms of service version, responses to users
+// whose claims carry another version are marked with HeaderTOSOutdated. Empty
+// version disables the marker. It must be called before tokens are parsed.
+func (a *Authenticator) SetTOSVersion(version string) {
+	a.tosVersion = version
+}
+
+// parseToken returns JWT middleware token parser, it verifies token with the
+// active key and rejects tokens requiring password change unless allowed.
+func (a *Authenticator) parseToken(allowPasswordChange bool) func(c echo.Context, auth string) (interface{}, error) {
+	publicKey := a.privateKey.Public()
+	keyFunc := func(*jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	}
+
+	return func(c echo.Context, auth string) (interface{}, error) {
+		claims := new(Claims)
+		tkn, err := a.parser.ParseWithClaims(auth, claims, keyFunc)
+		if err != nil {
+			return nil, err
+		}
+		if !tkn.Valid {
+			return nil, errors.New("invalid token")
+		}
+		if claims.PasswordChangeRequired && !allowPasswordChange {
+			return nil, ErrPasswordChangeRequired
+		}
+		if a.tosVersion != "" && claims.Type != TypeService && claims.TOSVersion != a.tosVersion {
+			c.Response().Header().Set(HeaderTOSOutdated, a.tosVersion)
+		}
+		return tkn, nil
+	}
+}
+
+// jwtErrorHandler responds with the same errors as JWT middleware does by
+// default, except for tokens requiring password change which are forbidden.
+func jwtErrorHandler(c echo.Context, err error) error {
+	if errors.Is(err, ErrPasswordChangeRequired) {
+		return echo.NewHTTPError(http.StatusForbidden, ErrPasswordChangeRequired.Error()).SetInternal(err)
+	}
+
+	var extractErr *echojwt.TokenExtractionError
+	if errors.As(err, &extractErr) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt").SetInternal(err)
+	}
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(err)
+}
+
 // GenerateToken generates a signed JWT token string representing the user Claims.
 func (a *Authenticator) GenerateToken(claims *Claims) (string, error) {
 	method := jwt.GetSigningMethod(a.algorithm)
@@ -106,3 +176,32 @@ func (a *Authenticator) GenerateToken(claims *Claims) (string, error) {
 
 	return str, nil
 }
+
+// ParseClaims recreates the Claims that were used to generate a token. It
+// verifies that the token was signed using our key.
+func (a *Authenticator) ParseClaims(tknStr string) (*Claims, error) {
+	f := func(t *jwt.Token) (interface{}, error) {
+		kid, ok := t.Header["kid"]
+		if !ok {
+			return nil, errors.New("missing key id (kid) in token header")
+		}
+		kidID, ok := kid.(string)
+		if !ok {
+			return nil, errors.New("user token key id (kid) must be string")
+		}
+
+		return a.pubKeyLookupFunc(kidID)
+	}
+
+	claims := new(Claims)
+	tkn, err := a.parser.ParseWithClaims(tknStr, claims, f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing token: %w", err)
+	}
+
+	if !tkn.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
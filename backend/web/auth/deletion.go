@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// deletionAudience is the audience of account deletion cancellation tokens
+const deletionAudience = "account_deletion"
+
+// DeletionClaims represents the claims of token canceling scheduled deletion
+// of Subject's account, token expires when account is deleted
+type DeletionClaims struct {
+	jwt.RegisteredClaims
+}
+
+// NewDeletionClaims constructs a DeletionClaims value for account scheduled
+// to be deleted after deleteAfter
+func NewDeletionClaims(subject string, now, deleteAfter time.Time) *DeletionClaims {
+	return &DeletionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{deletionAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(deleteAfter),
+		},
+	}
+}
+
+// GenerateDeletionToken generates a signed JWT token string representing the
+// DeletionClaims.
+func (a *Authenticator) GenerateDeletionToken(claims *DeletionClaims) (string, error) {
+	str, err := jwt.NewWithClaims(hmacSigningMethod, claims).SignedString(a.deletionKey)
+	if err != nil {
+		return "", fmt.Errorf("can't sign deletion token: %w", err)
+	}
+
+	return str, nil
+}
+
+// ParseDeletionClaims recreates the DeletionClaims that were used to generate
+// a deletion token. It verifies that the token was signed using our key and
+// is not expired.
+func (a *Authenticator) ParseDeletionClaims(tknStr string) (*DeletionClaims, error) {
+	claims := new(DeletionClaims)
+	tkn, err := a.hmacParser.ParseWithClaims(tknStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.deletionKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing deletion token: %w", err)
+	}
+
+	if !tkn.Valid || !claims.VerifyAudience(deletionAudience, true) || claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid deletion token")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,60 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestAuthenticator_ParseDeletionClaims(t *testing.T) {
+	a := newAuthenticator(t)
+	now := time.Now()
+	claims := auth.NewDeletionClaims("507f191e810c19729de860ea", now, now.Add(14*24*time.Hour))
+
+	t.Run("success", func(t *testing.T) {
+		tkn, err := a.GenerateDeletionToken(claims)
+		require.NoError(t, err)
+
+		parsed, err := a.ParseDeletionClaims(tkn)
+		require.NoError(t, err)
+		assert.Equal(t, claims.Subject, parsed.Subject)
+		assert.Equal(t, claims.ExpiresAt.Unix(), parsed.ExpiresAt.Unix())
+	})
+
+	t.Run("signed with other key", func(t *testing.T) {
+		tkn, err := newAuthenticator(t).GenerateDeletionToken(claims)
+		require.NoError(t, err)
+
+		_, err = a.ParseDeletionClaims(tkn)
+		assert.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := auth.NewDeletionClaims("507f191e810c19729de860ea", now.Add(-time.Hour), now.Add(-time.Minute))
+		tkn, err := a.GenerateDeletionToken(expired)
+		require.NoError(t, err)
+
+		_, err = a.ParseDeletionClaims(tkn)
+		assert.Error(t, err)
+	})
+
+	t.Run("share token", func(t *testing.T) {
+		tkn, err := a.GenerateShareToken(auth.NewShareClaims("640f1c3b5f1d2c0a9e8b7a61", "507f191e810c19729de860ea", nil, now, now.Add(time.Hour)))
+		require.NoError(t, err)
+
+		_, err = a.ParseDeletionClaims(tkn)
+		assert.Error(t, err)
+	})
+
+	t.Run("deletion token is not user token", func(t *testing.T) {
+		tkn, err := a.GenerateDeletionToken(claims)
+		require.NoError(t, err)
+
+		_, err = a.ParseClaims(tkn)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// downloadAudience is the audience of export download tokens
+const downloadAudience = "download"
+
+// ErrDownloadExpired is returned for download token that is signed by us but
+// expired
+var ErrDownloadExpired = errors.New("download link expired")
+
+// DownloadClaims represents the claims of token granting download of export of
+// Subject's data without authentication. Params are the exact parameters of
+// the export, so token can't be used to download other data.
+type DownloadClaims struct {
+	Export string          `json:"export"`
+	Params json.RawMessage `json:"params"`
+	jwt.RegisteredClaims
+}
+
+// NewDownloadClaims constructs a DownloadClaims value for export of subject's
+// data with params
+func NewDownloadClaims(export, subject string, params json.RawMessage, now, expiresAt time.Time) *DownloadClaims {
+	return &DownloadClaims{
+		Export: export,
+		Params: params,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{downloadAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+// GenerateDownloadToken generates a signed JWT token string representing the
+// DownloadClaims.
+func (a *Authenticator) GenerateDownloadToken(claims *DownloadClaims) (string, error) {
+	str, err := jwt.NewWithClaims(hmacSigningMethod, claims).SignedString(a.downloadKey)
+	if err != nil {
+		return "", fmt.Errorf("can't sign download token: %w", err)
+	}
+
+	return str, nil
+}
+
+// ParseDownloadClaims recreates the DownloadClaims that were used to generate
+// a download token. It verifies that the token was signed using our key, it
+// returns ErrDownloadExpired if token is expired.
+func (a *Authenticator) ParseDownloadClaims(tknStr string) (*DownloadClaims, error) {
+	claims := new(DownloadClaims)
+	tkn, err := a.hmacParser.ParseWithClaims(tknStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.downloadKey, nil
+	})
+	// expiry is checked before signature, so forged token may be expired too
+	if errors.Is(err, jwt.ErrTokenExpired) && !errors.Is(err, jwt.ErrTokenSignatureInvalid) && claims.VerifyAudience(downloadAudience, true) {
+		return nil, ErrDownloadExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing download token: %w", err)
+	}
+
+	if !tkn.Valid || !claims.VerifyAudience(downloadAudience, true) || claims.Subject == "" || claims.Export == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid download token")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestAuthenticator_ParseDownloadClaims(t *testing.T) {
+	a := newAuthenticator(t)
+	now := time.Now()
+	params := json.RawMessage(`{"format":"csv"}`)
+	claims := auth.NewDownloadClaims("urls", "507f191e810c19729de860ea", params, now, now.Add(10*time.Minute))
+
+	t.Run("success", func(t *testing.T) {
+		tkn, err := a.GenerateDownloadToken(claims)
+		require.NoError(t, err)
+
+		parsed, err := a.ParseDownloadClaims(tkn)
+		require.NoError(t, err)
+		assert.Equal(t, "urls", parsed.Export)
+		assert.Equal(t, claims.Subject, parsed.Subject)
+		assert.JSONEq(t, string(params), string(parsed.Params))
+	})
+
+	t.Run("signed with other key", func(t *testing.T) {
+		tkn, err := newAuthenticator(t).GenerateDownloadToken(claims)
+		require.NoError(t, err)
+
+		_, err = a.ParseDownloadClaims(tkn)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, auth.ErrDownloadExpired)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := auth.NewDownloadClaims("urls", "507f191e810c19729de860ea", params, now.Add(-time.Hour), now.Add(-time.Minute))
+		tkn, err := a.GenerateDownloadToken(expired)
+		require.NoError(t, err)
+
+		_, err = a.ParseDownloadClaims(tkn)
+		assert.ErrorIs(t, err, auth.ErrDownloadExpired)
+	})
+
+	t.Run("expired and signed with other key", func(t *testing.T) {
+		expired := auth.NewDownloadClaims("urls", "507f191e810c19729de860ea", params, now.Add(-time.Hour), now.Add(-time.Minute))
+		tkn, err := newAuthenticator(t).GenerateDownloadToken(expired)
+		require.NoError(t, err)
+
+		_, err = a.ParseDownloadClaims(tkn)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, auth.ErrDownloadExpired)
+	})
+
+	t.Run("share token", func(t *testing.T) {
+		tkn, err := a.GenerateShareToken(auth.NewShareClaims("640f1c3b5f1d2c0a9e8b7a61", "test123", nil, now, now.Add(time.Hour)))
+		require.NoError(t, err)
+
+		_, err = a.ParseDownloadClaims(tkn)
+		assert.Error(t, err)
+	})
+}
@@ -13,9 +13,34 @@ const (
 	RoleUser  = "USER"
 )
 
-// Claims represents the authorization claims transmitted via a JWT
+// ImpersonationTTL is the maximum lifetime of an impersonation token
+const ImpersonationTTL = 15 * time.Minute
+
+// TypeService marks claims of service accounts
+const TypeService = "service"
+
+// ScopeURLRead allows reading URLs of the account
+// ScopeURLWrite allows creating, updating and deleting URLs of the account
+const (
+	ScopeURLRead  = "url:read"
+	ScopeURLWrite = "url:write"
+)
+
+// Claims represents the authorization claims transmitted via a JWT. Email and
+// Name are shown to the user and are never used for authorization, user is
+// identified by Subject. Claims of service accounts have TypeService type and
+// are limited to Scopes. Claims with PasswordChangeRequired are accepted only
+// by password change route. TOSVersion is the terms of service version the
+// user accepted when the token was issued.
 type Claims struct {
-	Roles []string `json:"roles"`
+	Roles                  []string `json:"roles"`
+	Impersonator           string   `json:"impersonator,omitempty"`
+	Email                  string   `json:"email,omitempty"`
+	Name                   string   `json:"name,omitempty"`
+	Type                   string   `json:"type,omitempty"`
+	Scopes                 []string `json:"scopes,omitempty"`
+	PasswordChangeRequired bool     `json:"pwd_change_required,omitempty"`
+	TOSVersion             string   `json:"tos_version,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -33,6 +58,47 @@ func NewClaims(subject string, roles []string, now time.Time, expires time.Durat
 	return c
 }
 
+// NewImpersonationClaims constructs a Claims value that lets the admin identified
+// by impersonator act as the subject user. Lifetime is capped by ImpersonationTTL.
+func NewImpersonationClaims(subject string, roles []string, impersonator string, now time.Time) *Claims {
+	c := NewClaims(subject, roles, now, ImpersonationTTL)
+	c.Impersonator = impersonator
+
+	return c
+}
+
+// WithProfile sets email and display name of the user and returns the claims
+func (c *Claims) WithProfile(email, name string) *Claims {
+	c.Email = email
+	c.Name = name
+
+	return c
+}
+
+// IsImpersonated returns true if the claims were issued to an admin acting as another user.
+func (c *Claims) IsImpersonated() bool {
+	return c.Impersonator != ""
+}
+
+// IsService returns true if the claims were issued to a service account.
+func (c *Claims) IsService() bool {
+	return c.Type == TypeService
+}
+
+// HasScope returns true if the claims allow the scope. Claims of users allow
+// every scope, claims of service accounts allow only their scopes.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsService() {
+		return true
+	}
+	for _, has := range c.Scopes {
+		if has == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // HasRole returns true if the claims has at least one of the provided roles.
 func (c *Claims) HasRole(roles ...string) bool {
 	for _, has := range c.Roles {
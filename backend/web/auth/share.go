@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// shareAudience is the audience of share tokens
+const shareAudience = "share"
+
+// hmacSigningMethod signs share, deletion and download tokens. User tokens
+// are verified with public key, so tokens signed with HMAC can't be used in
+// their place.
+var hmacSigningMethod = jwt.SigningMethodHS256
+
+// ShareClaims represents the claims of token granting read-only access to
+// statistics of URL, ID is the id of the share
+type ShareClaims struct {
+	URLID  string   `json:"url_id"`
+	Panels []string `json:"panels"`
+	jwt.RegisteredClaims
+}
+
+// NewShareClaims constructs a ShareClaims value for the share of URL
+// statistics
+func NewShareClaims(id, urlID string, panels []string, now, expiresAt time.Time) *ShareClaims {
+	return &ShareClaims{
+		URLID:  urlID,
+		Panels: panels,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Audience:  jwt.ClaimStrings{shareAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+// derivedKey derives key of tokens with given audience from private key, so
+// no separate secret has to be configured and tokens of one audience can't be
+// used in place of another
+func derivedKey(privateKey *rsa.PrivateKey, audience string) []byte {
+	mac := hmac.New(sha256.New, x509.MarshalPKCS1PrivateKey(privateKey))
+	mac.Write([]byte(audience))
+	return mac.Sum(nil)
+}
+
+// GenerateShareToken generates a signed JWT token string representing the
+// ShareClaims.
+func (a *Authenticator) GenerateShareToken(claims *ShareClaims) (string, error) {
+	str, err := jwt.NewWithClaims(hmacSigningMethod, claims).SignedString(a.shareKey)
+	if err != nil {
+		return "", fmt.Errorf("can't sign share token: %w", err)
+	}
+
+	return str, nil
+}
+
+// ParseShareClaims recreates the ShareClaims that were used to generate a
+// share token. It verifies that the token was signed using our key and is
+// not expired.
+func (a *Authenticator) ParseShareClaims(tknStr string) (*ShareClaims, error) {
+	claims := new(ShareClaims)
+	tkn, err := a.hmacParser.ParseWithClaims(tknStr, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.shareKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing share token: %w", err)
+	}
+
+	if !tkn.Valid || !claims.VerifyAudience(shareAudience, true) || claims.ID == "" {
+		return nil, errors.New("invalid share token")
+	}
+
+	return claims, nil
+}
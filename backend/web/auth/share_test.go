@@ -0,0 +1,61 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+func TestAuthenticator_ParseShareClaims(t *testing.T) {
+	a := newAuthenticator(t)
+	now := time.Now()
+	claims := auth.NewShareClaims("640f1c3b5f1d2c0a9e8b7a61", "test123", []string{"clicks", "daily"}, now, now.Add(time.Hour))
+
+	t.Run("success", func(t *testing.T) {
+		tkn, err := a.GenerateShareToken(claims)
+		require.NoError(t, err)
+
+		parsed, err := a.ParseShareClaims(tkn)
+		require.NoError(t, err)
+		assert.Equal(t, claims.ID, parsed.ID)
+		assert.Equal(t, claims.URLID, parsed.URLID)
+		assert.Equal(t, claims.Panels, parsed.Panels)
+	})
+
+	t.Run("signed with other key", func(t *testing.T) {
+		tkn, err := newAuthenticator(t).GenerateShareToken(claims)
+		require.NoError(t, err)
+
+		_, err = a.ParseShareClaims(tkn)
+		assert.Error(t, err)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := auth.NewShareClaims("640f1c3b5f1d2c0a9e8b7a61", "test123", nil, now.Add(-time.Hour), now.Add(-time.Minute))
+		tkn, err := a.GenerateShareToken(expired)
+		require.NoError(t, err)
+
+		_, err = a.ParseShareClaims(tkn)
+		assert.Error(t, err)
+	})
+
+	t.Run("user token", func(t *testing.T) {
+		tkn, err := a.GenerateToken(auth.NewClaims("507f191e810c19729de860ea", []string{auth.RoleUser}, now, time.Minute))
+		require.NoError(t, err)
+
+		_, err = a.ParseShareClaims(tkn)
+		assert.Error(t, err)
+	})
+
+	t.Run("share token is not user token", func(t *testing.T) {
+		tkn, err := a.GenerateShareToken(claims)
+		require.NoError(t, err)
+
+		_, err = a.ParseClaims(tkn)
+		assert.Error(t, err)
+	})
+}
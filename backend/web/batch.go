@@ -0,0 +1,84 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// BatchResult represents outcome of one item of batch request. Status is HTTP
+// status code of the item, error members are set when the item failed.
+type BatchResult struct {
+	Index  int                                    `json:"index"`
+	ID     string                                 `json:"id,omitempty"`
+	Status int                                    `json:"status"`
+	Error  string                                 `json:"error,omitempty"`
+	Fields validator.ValidationErrorsTranslations `json:"fields,omitempty"`
+}
+
+// Batch aggregates outcomes of batch request items
+type Batch struct {
+	Results []BatchResult `json:"results"`
+	failed  int
+	logger  *zap.Logger
+}
+
+// NewBatch creates Batch for request with size items, logger logs server
+// errors of failed items
+func NewBatch(size int, logger *zap.Logger) *Batch {
+	return &Batch{
+		Results: make([]BatchResult, 0, size),
+		logger:  logger,
+	}
+}
+
+// Succeeded records item with given index that succeeded with status
+func (b *Batch) Succeeded(index int, id string, status int) {
+	b.Results = append(b.Results, BatchResult{Index: index, ID: id, Status: status})
+}
+
+// Failed records item with given index that failed with err, status is
+// determined by domain.GetStatusCode
+func (b *Batch) Failed(index int, id string, err error) {
+	b.failed++
+	b.Results = append(b.Results, BatchResult{
+		Index:  index,
+		ID:     id,
+		Status: domain.GetStatusCode(err, b.logger),
+		Error:  err.Error(),
+	})
+}
+
+// Invalid records item with given index that failed validation
+func (b *Batch) Invalid(index int, id string, fields validator.ValidationErrorsTranslations) {
+	b.failed++
+	b.Results = append(b.Results, BatchResult{
+		Index:  index,
+		ID:     id,
+		Status: http.StatusBadRequest,
+		Error:  "validation error",
+		Fields: fields,
+	})
+}
+
+// Status returns HTTP status of the whole batch: 201 when all items
+// succeeded, 400 when all items failed and 207 otherwise
+func (b *Batch) Status() int {
+	switch {
+	case b.failed == 0:
+		return http.StatusCreated
+	case b.failed == len(b.Results):
+		return http.StatusBadRequest
+	default:
+		return http.StatusMultiStatus
+	}
+}
+
+// RespondBatch writes batch results with status of the whole batch
+func RespondBatch(c echo.Context, b *Batch) error {
+	return Respond(c, b.Status(), b)
+}
@@ -0,0 +1,112 @@
+package web_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+func TestBatch(t *testing.T) {
+	conflict := fmt.Errorf("URL abc already exists: %w", domain.ErrConflict)
+	fields := validator.ValidationErrorsTranslations{"link": "link is a required field"}
+
+	cases := []struct {
+		description string
+		record      func(b *web.Batch)
+		status      int
+		results     []web.BatchResult
+	}{
+		{
+			description: "all succeeded",
+			record: func(b *web.Batch) {
+				b.Succeeded(0, "abc", http.StatusCreated)
+				b.Succeeded(1, "def", http.StatusCreated)
+			},
+			status: http.StatusCreated,
+			results: []web.BatchResult{
+				{Index: 0, ID: "abc", Status: http.StatusCreated},
+				{Index: 1, ID: "def", Status: http.StatusCreated},
+			},
+		},
+		{
+			description: "mixed",
+			record: func(b *web.Batch) {
+				b.Succeeded(0, "def", http.StatusCreated)
+				b.Failed(1, "abc", conflict)
+			},
+			status: http.StatusMultiStatus,
+			results: []web.BatchResult{
+				{Index: 0, ID: "def", Status: http.StatusCreated},
+				{Index: 1, ID: "abc", Status: http.StatusConflict, Error: conflict.Error()},
+			},
+		},
+		{
+			description: "all failed",
+			record: func(b *web.Batch) {
+				b.Failed(0, "abc", conflict)
+				b.Invalid(1, "", fields)
+			},
+			status: http.StatusBadRequest,
+			results: []web.BatchResult{
+				{Index: 0, ID: "abc", Status: http.StatusConflict, Error: conflict.Error()},
+				{Index: 1, Status: http.StatusBadRequest, Error: "validation error", Fields: fields},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			b := web.NewBatch(len(tc.results), zap.NewNop())
+			tc.record(b)
+
+			assert.Equal(t, tc.status, b.Status())
+			assert.Equal(t, tc.results, b.Results)
+		})
+	}
+}
+
+func TestRespondBatch(t *testing.T) {
+	e := echo.New()
+	for _, prefix := range []string{"/v1", "/v2"} {
+		e.POST(prefix+"/items", func(c echo.Context) error {
+			b := web.NewBatch(2, zap.NewNop())
+			b.Succeeded(0, "abc", http.StatusCreated)
+			b.Failed(1, "def", domain.ErrForbidden)
+			return web.RespondBatch(c, b)
+		})
+	}
+
+	cases := []struct {
+		target string
+		body   string
+	}{
+		{
+			target: "/v1/items",
+			body:   `{"results":[{"index":0,"id":"abc","status":201},{"index":1,"id":"def","status":403,"error":"attempted action is not allowed"}]}`,
+		},
+		{
+			target: "/v2/items",
+			body:   `{"data":{"results":[{"index":0,"id":"abc","status":201},{"index":1,"id":"def","status":403,"error":"attempted action is not allowed"}]}}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(echo.POST, tc.target, nil))
+
+			require.Equal(t, http.StatusMultiStatus, rec.Code)
+			assert.JSONEq(t, tc.body, rec.Body.String())
+		})
+	}
+}
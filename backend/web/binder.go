@@ -0,0 +1,106 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// UnknownFieldError is returned by Binder when JSON body has field which
+// bound struct doesn't have
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unknown field %q", e.Field)
+}
+
+// Binder binds request data like echo.DefaultBinder, but JSON bodies are
+// decoded strictly: unknown fields and data after JSON document are rejected.
+// Other bodies are bound by echo.DefaultBinder.
+type Binder struct {
+	echo.DefaultBinder
+}
+
+// Bind binds path params, query params for GET, DELETE and HEAD requests and
+// request body into i
+func (b *Binder) Bind(i interface{}, c echo.Context) error {
+	if err := b.BindPathParams(c, i); err != nil {
+		return err
+	}
+
+	method := c.Request().Method
+	if method == http.MethodGet || method == http.MethodDelete || method == http.MethodHead {
+		if err := b.BindQueryParams(c, i); err != nil {
+			return err
+		}
+	}
+
+	return b.BindBody(c, i)
+}
+
+// BindBody binds request body into i
+func (b *Binder) BindBody(c echo.Context, i interface{}) error {
+	req := c.Request()
+	if req.ContentLength == 0 || !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return b.DefaultBinder.BindBody(c, i)
+	}
+
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(i); err != nil {
+		return jsonBindError(err)
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Syntax error: unexpected data after JSON document")
+	}
+
+	return nil
+}
+
+// jsonBindError converts JSON decoding error to error returned by
+// echo.DefaultBinder, unknown field error is converted to UnknownFieldError
+func jsonBindError(err error) error {
+	var ute *json.UnmarshalTypeError
+	var se *json.SyntaxError
+	switch {
+	case errors.As(err, &ute):
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unmarshal type error: expected=%v, got=%v, field=%v, offset=%v", ute.Type, ute.Value, ute.Field, ute.Offset)).SetInternal(err)
+	case errors.As(err, &se):
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Syntax error: offset=%v, error=%v", se.Offset, se.Error())).SetInternal(err)
+	}
+
+	// encoding/json has no error type for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, uerr := strconv.Unquote(field); uerr == nil {
+			field = unquoted
+		}
+		return &UnknownFieldError{Field: field}
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+}
+
+// BindErrorResponse returns response to error of binding request data,
+// unknown field is reported in response fields
+func BindErrorResponse(err error) domain.ResponseError {
+	var ufe *UnknownFieldError
+	if errors.As(err, &ufe) {
+		return domain.ResponseError{
+			Error:  "validation error",
+			Fields: map[string]string{ufe.Field: ufe.Field + " is not a known field"},
+		}
+	}
+
+	return domain.ResponseError{Error: err.Error()}
+}
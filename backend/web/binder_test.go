@@ -0,0 +1,85 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+func TestBinder(t *testing.T) {
+	type payload struct {
+		Name  string `json:"name" form:"name"`
+		Count int    `json:"count" form:"count"`
+	}
+
+	e := echo.New()
+	bind := func(contentType, body string) (*payload, error) {
+		req := httptest.NewRequest(echo.POST, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		c := e.NewContext(req, httptest.NewRecorder())
+		p := new(payload)
+		err := new(web.Binder).Bind(p, c)
+		return p, err
+	}
+
+	t.Run("json", func(t *testing.T) {
+		p, err := bind(echo.MIMEApplicationJSON, `{"name":"test","count":2}`)
+		require.NoError(t, err)
+		assert.Equal(t, &payload{Name: "test", Count: 2}, p)
+	})
+
+	t.Run("json with trailing whitespace", func(t *testing.T) {
+		_, err := bind(echo.MIMEApplicationJSONCharsetUTF8, "{\"name\":\"test\"}\n")
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := bind(echo.MIMEApplicationJSON, `{"name":"test","cuont":2}`)
+		var ufe *web.UnknownFieldError
+		require.ErrorAs(t, err, &ufe)
+		assert.Equal(t, "cuont", ufe.Field)
+		assert.Equal(t, domain.ResponseError{
+			Error:  "validation error",
+			Fields: map[string]string{"cuont": "cuont is not a known field"},
+		}, web.BindErrorResponse(err))
+	})
+
+	t.Run("trailing data", func(t *testing.T) {
+		for _, body := range []string{`{"name":"test"}garbage`, `{"name":"test"}{"count":2}`} {
+			_, err := bind(echo.MIMEApplicationJSON, body)
+			var he *echo.HTTPError
+			require.ErrorAs(t, err, &he, body)
+			assert.Equal(t, http.StatusBadRequest, he.Code)
+		}
+	})
+
+	t.Run("type error", func(t *testing.T) {
+		_, err := bind(echo.MIMEApplicationJSON, `{"count":"two"}`)
+		var he *echo.HTTPError
+		require.ErrorAs(t, err, &he)
+		assert.Equal(t, http.StatusBadRequest, he.Code)
+		assert.Equal(t, domain.ResponseError{Error: err.Error()}, web.BindErrorResponse(err))
+	})
+
+	t.Run("form ignores unknown fields", func(t *testing.T) {
+		form := url.Values{"name": {"test"}, "cuont": {"2"}}
+		p, err := bind(echo.MIMEApplicationForm, form.Encode())
+		require.NoError(t, err)
+		assert.Equal(t, &payload{Name: "test"}, p)
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		p, err := bind(echo.MIMEApplicationJSON, "")
+		require.NoError(t, err)
+		assert.Equal(t, &payload{}, p)
+	})
+}
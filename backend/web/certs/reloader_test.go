@@ -0,0 +1,114 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/web/certs"
+)
+
+func writeSelfSigned(t *testing.T, dir string, serial int64, modTime time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	return certFile, keyFile
+}
+
+func serialOf(t *testing.T, r *certs.Reloader) int64 {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	return parsed.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+
+	t.Run("files not found", func(t *testing.T) {
+		_, err := certs.NewReloader("none.pem", "none.key", zap.NewNop())
+		assert.Error(t, err)
+	})
+
+	t.Run("reload on demand", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeSelfSigned(t, dir, 1, start)
+
+		r, err := certs.NewReloader(certFile, keyFile, zap.NewNop())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), serialOf(t, r))
+
+		writeSelfSigned(t, dir, 2, start.Add(time.Second))
+		require.NoError(t, r.Reload())
+		assert.Equal(t, int64(2), serialOf(t, r))
+	})
+
+	t.Run("broken files keep previous certificate", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeSelfSigned(t, dir, 1, start)
+
+		r, err := certs.NewReloader(certFile, keyFile, zap.NewNop())
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+		assert.Error(t, r.Reload())
+		assert.Equal(t, int64(1), serialOf(t, r))
+	})
+
+	t.Run("watch picks up changed files", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeSelfSigned(t, dir, 1, start)
+
+		r, err := certs.NewReloader(certFile, keyFile, zap.NewNop())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go r.Watch(ctx, 10*time.Millisecond)
+
+		writeSelfSigned(t, dir, 3, start.Add(time.Second))
+		assert.Eventually(t, func() bool {
+			return serialOf(t, r) == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,89 @@
+// Package requestctx carries claims of authenticated caller and request
+// metadata in context.Context, so code without echo.Context, e.g. usecases
+// and background jobs started by request, knows who made it. Values are
+// stored by middleware, see middleware.StoreClaims and
+// middleware.RequestContext.
+package requestctx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web/auth"
+)
+
+// ErrNoClaims is returned for requests made without authentication, it is
+// responded with 401
+var ErrNoClaims = fmt.Errorf("%w: request is not authenticated", domain.ErrAuthenticationFailure)
+
+// ErrNoRole is returned for callers lacking required role, it is responded
+// with 403
+var ErrNoRole = fmt.Errorf("%w: you are not authorized for that action", domain.ErrForbidden)
+
+type claimsKey struct{}
+
+type requestIDKey struct{}
+
+type clientIPKey struct{}
+
+// WithClaims returns copy of ctx that carries claims of authenticated caller
+func WithClaims(ctx context.Context, claims *auth.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns claims stored in ctx, ok is false for unauthenticated
+// requests
+func ClaimsFrom(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*auth.Claims)
+	return claims, ok && claims != nil
+}
+
+// RequireClaims returns claims stored in ctx, ErrNoClaims is returned when
+// ctx carries none
+func RequireClaims(ctx context.Context) (*auth.Claims, error) {
+	claims, ok := ClaimsFrom(ctx)
+	if !ok {
+		return nil, ErrNoClaims
+	}
+	return claims, nil
+}
+
+// RequireRole returns claims stored in ctx if caller has at least one of
+// roles, ErrNoRole is returned otherwise. Service accounts never pass role
+// checks, whatever roles they have.
+func RequireRole(ctx context.Context, roles ...string) (*auth.Claims, error) {
+	claims, err := RequireClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IsService() || !claims.HasRole(roles...) {
+		return nil, ErrNoRole
+	}
+	return claims, nil
+}
+
+// WithRequestID returns copy of ctx that carries id of the request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns request id stored in ctx, ok is false when ctx
+// carries none
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// WithClientIP returns copy of ctx that carries address of the client that
+// made the request
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFrom returns client address stored in ctx, ok is false when ctx
+// carries none
+func ClientIPFrom(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
@@ -0,0 +1,120 @@
+package requestctx_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web/auth"
+	"github.com/semka95/shortener/backend/web/requestctx"
+)
+
+func TestClaims(t *testing.T) {
+	user := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e7f", []string{auth.RoleUser}, time.Now(), time.Hour)
+
+	t.Run("stored", func(t *testing.T) {
+		ctx := requestctx.WithClaims(context.Background(), user)
+		claims, ok := requestctx.ClaimsFrom(ctx)
+		require.True(t, ok)
+		assert.Same(t, user, claims)
+
+		claims, err := requestctx.RequireClaims(ctx)
+		require.NoError(t, err)
+		assert.Same(t, user, claims)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		claims, ok := requestctx.ClaimsFrom(context.Background())
+		assert.False(t, ok)
+		assert.Nil(t, claims)
+
+		claims, err := requestctx.RequireClaims(context.Background())
+		assert.ErrorIs(t, err, requestctx.ErrNoClaims)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusUnauthorized, domain.GetStatusCode(err, zap.NewNop()))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		ctx := requestctx.WithClaims(context.Background(), nil)
+		_, ok := requestctx.ClaimsFrom(ctx)
+		assert.False(t, ok)
+		_, err := requestctx.RequireClaims(ctx)
+		assert.ErrorIs(t, err, requestctx.ErrNoClaims)
+	})
+}
+
+func TestRequireRole(t *testing.T) {
+	admin := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e7f", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	user := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e70", []string{auth.RoleUser}, time.Now(), time.Hour)
+	service := auth.NewClaims("5f1e0f3e9b1d8a3a4c5d6e71", []string{auth.RoleAdmin}, time.Now(), time.Hour)
+	service.Type = auth.TypeService
+
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		err    error
+		status int
+	}{
+		{"admin", admin, nil, 0},
+		{"user", user, requestctx.ErrNoRole, http.StatusForbidden},
+		{"service", service, requestctx.ErrNoRole, http.StatusForbidden},
+		{"unauthenticated", nil, requestctx.ErrNoClaims, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.claims != nil {
+				ctx = requestctx.WithClaims(ctx, tc.claims)
+			}
+
+			claims, err := requestctx.RequireRole(ctx, auth.RoleAdmin)
+			if tc.err == nil {
+				require.NoError(t, err)
+				assert.Same(t, tc.claims, claims)
+				return
+			}
+			assert.ErrorIs(t, err, tc.err)
+			assert.Nil(t, claims)
+			assert.Equal(t, tc.status, domain.GetStatusCode(err, zap.NewNop()))
+		})
+	}
+}
+
+func TestRequestMetadata(t *testing.T) {
+	t.Run("stored", func(t *testing.T) {
+		ctx := requestctx.WithClientIP(requestctx.WithRequestID(context.Background(), "request-1"), "203.0.113.7")
+
+		id, ok := requestctx.RequestIDFrom(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "request-1", id)
+
+		ip, ok := requestctx.ClientIPFrom(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "203.0.113.7", ip)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		id, ok := requestctx.RequestIDFrom(context.Background())
+		assert.False(t, ok)
+		assert.Empty(t, id)
+
+		ip, ok := requestctx.ClientIPFrom(context.Background())
+		assert.False(t, ok)
+		assert.Empty(t, ip)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		ctx := requestctx.WithClientIP(requestctx.WithRequestID(context.Background(), ""), "")
+		_, ok := requestctx.RequestIDFrom(ctx)
+		assert.False(t, ok)
+		_, ok = requestctx.ClientIPFrom(ctx)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,300 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/i18n"
+)
+
+const (
+	// MIMEApplicationProblemJSON is the media type of RFC 7807 problem details
+	MIMEApplicationProblemJSON = "application/problem+json"
+
+	// MIMEApplicationNDJSON is the media type of JSON lines, e.g. account
+	// backups
+	MIMEApplicationNDJSON = "application/x-ndjson"
+
+	// HeaderXTotalCount is the response header that carries total number of
+	// list items
+	HeaderXTotalCount = "X-Total-Count"
+
+	// HeaderXStatsPartial is the response header set on statistics made
+	// without some click details, see domain.StatsCoverage
+	HeaderXStatsPartial = "X-Stats-Partial"
+
+	// v2Prefix is the path prefix of v2 API routes
+	v2Prefix = "/v2/"
+)
+
+// Envelope wraps successful v2 responses
+type Envelope struct {
+	Data interface{} `json:"data"`
+	Meta *Meta       `json:"meta,omitempty"`
+}
+
+// Meta stores response metadata
+type Meta struct {
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes page of list response
+type Pagination struct {
+	// Count is the number of items on the page
+	Count int `json:"count"`
+	// Limit is the maximum number of items on the page, zero if list is not
+	// limited
+	Limit int64 `json:"limit,omitempty"`
+	// NextCursor fetches next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// PrevCursor fetches previous page, empty on the first page
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	// Total is the number of items in the list, set on request
+	Total *int64 `json:"total,omitempty"`
+}
+
+// Problem represents RFC 7807 problem details of v2 error responses
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors is the extension member with field validation errors
+	Errors validator.ValidationErrorsTranslations `json:"errors,omitempty"`
+	// Entity and ID are the extension members identifying the item error is
+	// about
+	Entity string `json:"entity,omitempty"`
+	ID     string `json:"id,omitempty"`
+	// TraceID is the extension member set for server errors
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// APIVersion returns version of API the request is made to, routes outside of
+// /v2 are served as v1
+func APIVersion(c echo.Context) int {
+	if strings.HasPrefix(c.Request().URL.Path, v2Prefix) {
+		return 2
+	}
+
+	return 1
+}
+
+// ClientIP returns address of the client that made the request. Forwarded
+// headers are honored only by e.IPExtractor, see middleware.IPExtractor,
+// address of the direct peer is returned when it is not set.
+func ClientIP(c echo.Context) string {
+	if c.Echo() == nil || c.Echo().IPExtractor == nil {
+		return echo.ExtractIPDirect()(c.Request())
+	}
+	return c.RealIP()
+}
+
+// ClientIdentifier identifies clients of rate limiters by ClientIP
+func ClientIdentifier(c echo.Context) (string, error) {
+	return ClientIP(c), nil
+}
+
+// Respond writes data as is to v1 routes and wrapped in Envelope to v2 routes
+func Respond(c echo.Context, code int, data interface{}) error {
+	if APIVersion(c) == 1 {
+		return c.JSON(code, data)
+	}
+
+	return c.JSON(code, Envelope{Data: data})
+}
+
+// RespondList writes v1 body as is to v1 routes, v2 routes get items with
+// pagination meta
+func RespondList(c echo.Context, code int, v1 interface{}, items interface{}, p Pagination) error {
+	if APIVersion(c) == 1 {
+		return c.JSON(code, v1)
+	}
+
+	return c.JSON(code, Envelope{Data: items, Meta: &Meta{Pagination: &p}})
+}
+
+// RespondError writes domain.ResponseError to v1 routes and Problem to v2
+// routes
+func RespondError(c echo.Context, code int, re domain.ResponseError) error {
+	contentType, body := ErrorBody(c, code, re)
+	if contentType == echo.MIMEApplicationJSONCharsetUTF8 {
+		return c.JSON(code, body)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().WriteHeader(code)
+	return c.Echo().JSONSerializer.Serialize(c, body, "")
+}
+
+// RespondDomainError writes err with status code of its kind, details of
+// domain.Error are written too
+func RespondDomainError(c echo.Context, err error, logger *zap.Logger) error {
+	return RespondError(c, domain.GetStatusCode(err, logger), domain.NewResponseError(err))
+}
+
+// ErrorBody returns content type and body of error response for the request,
+// trace id is added to server errors
+func ErrorBody(c echo.Context, code int, re domain.ResponseError) (string, interface{}) {
+	h := c.Response().Header()
+	if code >= http.StatusInternalServerError {
+		re.TraceID = h.Get(HeaderXTraceID)
+	}
+
+	if APIVersion(c) == 1 {
+		return echo.MIMEApplicationJSONCharsetUTF8, re
+	}
+
+	return MIMEApplicationProblemJSON, Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(code),
+		Status:   code,
+		Detail:   re.Error,
+		Instance: h.Get(echo.HeaderXRequestID),
+		Errors:   re.Fields,
+		Entity:   re.Entity,
+		ID:       re.ID,
+		TraceID:  re.TraceID,
+	}
+}
+
+// HTTPErrorHandler writes errors returned from v2 routes as Problem and passes
+// errors of other routes to next handler
+func HTTPErrorHandler(next echo.HTTPErrorHandler) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed || APIVersion(c) == 1 {
+			next(err, c)
+			return
+		}
+
+		code := http.StatusInternalServerError
+		detail := http.StatusText(code)
+		var he *echo.HTTPError
+		if errors.As(err, &he) {
+			code = he.Code
+			detail = fmt.Sprint(he.Message)
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(code)
+		} else {
+			err = RespondError(c, code, domain.ResponseError{Error: detail})
+		}
+		if err != nil {
+			c.Logger().Error(err)
+		}
+	}
+}
+
+// AcceptsHTML returns true if client asks for HTML before JSON, browsers do
+func AcceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get(echo.HeaderAccept)
+	html := strings.Index(accept, echo.MIMETextHTML)
+	if html < 0 {
+		return false
+	}
+	json := strings.Index(accept, echo.MIMEApplicationJSON)
+	return json < 0 || html < json
+}
+
+// RespondHTML renders HTML page in locale of the request, page template is
+// parsed with i18n.Funcs and cloned with funcs of the locale
+func RespondHTML(c echo.Context, code int, page *template.Template, data interface{}) error {
+	locale := i18n.LocaleFromContext(c.Request().Context())
+	t, err := page.Clone()
+	if err != nil {
+		return fmt.Errorf("can't clone %s page: %w", page.Name(), err)
+	}
+	t.Funcs(i18n.Funcs(locale))
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	h.Set("Content-Language", locale)
+	h.Add(echo.HeaderVary, "Accept-Language")
+	c.Response().WriteHeader(code)
+	return t.Execute(c.Response(), data)
+}
+
+// SetCoverageHeader sets HeaderXStatsPartial header when statistics are
+// partial, e.g. "analytics=minimal; untracked_clicks=3"
+func SetCoverageHeader(c echo.Context, coverage *domain.StatsCoverage) {
+	if coverage == nil || !coverage.Partial {
+		return
+	}
+	c.Response().Header().Set(HeaderXStatsPartial, fmt.Sprintf("analytics=%s; untracked_clicks=%d", coverage.Analytics, coverage.Untracked))
+}
+
+// SetPageHeaders sets X-Total-Count header when total is known and RFC 5988
+// Link header with next and prev pages. Page links keep query parameters of
+// the request, cursorParams are replaced by next or prev parameters, nil
+// parameters mean there is no such page.
+func SetPageHeaders(c echo.Context, total *int64, next, prev url.Values, cursorParams ...string) {
+	h := c.Response().Header()
+	if total != nil {
+		h.Set(HeaderXTotalCount, strconv.FormatInt(*total, 10))
+	}
+
+	// RequestURI keeps path requested by client before rewrites
+	path := c.Request().URL.Path
+	if u, err := url.ParseRequestURI(c.Request().RequestURI); err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	links := make([]string, 0, 2)
+	for _, l := range []struct {
+		rel    string
+		params url.Values
+	}{{"next", next}, {"prev", prev}} {
+		if l.params == nil {
+			continue
+		}
+		query := url.Values{}
+		for k, v := range c.QueryParams() {
+			query[k] = v
+		}
+		for _, p := range cursorParams {
+			query.Del(p)
+		}
+		for k, v := range l.params {
+			query[k] = v
+		}
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, path, query.Encode(), l.rel))
+	}
+	if len(links) > 0 {
+		h.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// SelectFields returns JSON object of v with given fields only, fields are
+// JSON names
+func SelectFields(v interface{}, fields []string) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal %T: %w", v, err)
+	}
+
+	all := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("can't unmarshal %T into object: %w", v, err)
+	}
+
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if raw, ok := all[f]; ok {
+			selected[f] = raw
+		}
+	}
+
+	return selected, nil
+}
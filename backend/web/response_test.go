@@ -0,0 +1,121 @@
+package web_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+type item struct {
+	ID string `json:"id"`
+}
+
+type page struct {
+	Items      []item `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func TestResponses(t *testing.T) {
+	e := echo.New()
+	e.JSONSerializer = web.JSONSerializer{}
+	e.HTTPErrorHandler = web.HTTPErrorHandler(e.DefaultHTTPErrorHandler)
+
+	items := []item{{ID: "a"}, {ID: "b"}}
+	p := page{Items: items, NextCursor: "b"}
+	for _, prefix := range []string{"/v1", "/v2"} {
+		g := e.Group(prefix)
+		g.GET("/item", func(c echo.Context) error {
+			return web.Respond(c, http.StatusOK, items[0])
+		})
+		g.GET("/items", func(c echo.Context) error {
+			return web.RespondList(c, http.StatusOK, p, p.Items, web.Pagination{Count: len(p.Items), Limit: 2, NextCursor: p.NextCursor})
+		})
+		g.GET("/fail", func(c echo.Context) error {
+			c.Response().Header().Set(web.HeaderXTraceID, "trace-1")
+			c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+			return web.RespondError(c, http.StatusInternalServerError, domain.ResponseError{Error: "boom"})
+		})
+		g.GET("/conflict", func(c echo.Context) error {
+			err := domain.NewError(domain.ErrConflict, "URL test already exists").WithEntity(domain.EntityURL, "test")
+			return web.RespondDomainError(c, err, zap.NewNop())
+		})
+		g.GET("/invalid", func(c echo.Context) error {
+			return web.RespondDomainError(c, domain.NewError(domain.ErrBadParamInput, "link can't be null").WithField("link"), zap.NewNop())
+		})
+		g.GET("/internal", func(c echo.Context) error {
+			err := domain.InternalError("URL get error", domain.NewError(domain.ErrNotFound, "unexpected"))
+			return web.RespondDomainError(c, err, zap.NewNop())
+		})
+		g.GET("/forbidden", func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusForbidden, "you are not authorized for that action")
+		})
+		g.GET("/error", func(c echo.Context) error {
+			return errors.New("internal details")
+		})
+	}
+
+	cases := []struct {
+		description string
+		target      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"v1 item", "/v1/item", http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, `{"id":"a"}`},
+		{"v2 item", "/v2/item", http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, `{"data":{"id":"a"}}`},
+		{"v1 list", "/v1/items", http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, `{"items":[{"id":"a"},{"id":"b"}],"next_cursor":"b"}`},
+		{"v2 list", "/v2/items", http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, `{"data":[{"id":"a"},{"id":"b"}],"meta":{"pagination":{"count":2,"limit":2,"next_cursor":"b"}}}`},
+		{"v1 error", "/v1/fail", http.StatusInternalServerError, echo.MIMEApplicationJSONCharsetUTF8, `{"error":"boom","trace_id":"trace-1"}`},
+		{"v2 error", "/v2/fail", http.StatusInternalServerError, web.MIMEApplicationProblemJSON, `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"boom","instance":"req-1","trace_id":"trace-1"}`},
+		{"v1 domain error", "/v1/conflict", http.StatusConflict, echo.MIMEApplicationJSONCharsetUTF8, `{"error":"URL test already exists: your item already exist","entity":"url","id":"test"}`},
+		{"v2 domain error", "/v2/conflict", http.StatusConflict, web.MIMEApplicationProblemJSON, `{"type":"about:blank","title":"Conflict","status":409,"detail":"URL test already exists: your item already exist","entity":"url","id":"test"}`},
+		{"v1 domain error field", "/v1/invalid", http.StatusBadRequest, echo.MIMEApplicationJSONCharsetUTF8, `{"error":"link can't be null: given param is not valid","fields":{"link":"link can't be null"}}`},
+		{"v2 domain error field", "/v2/invalid", http.StatusBadRequest, web.MIMEApplicationProblemJSON, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"link can't be null: given param is not valid","errors":{"link":"link can't be null"}}`},
+		{"v1 domain error kind wins over cause", "/v1/internal", http.StatusInternalServerError, echo.MIMEApplicationJSONCharsetUTF8, `{"error":"URL get error: internal server error: unexpected: your requested item is not found"}`},
+		{"v1 http error", "/v1/forbidden", http.StatusForbidden, echo.MIMEApplicationJSONCharsetUTF8, `{"message":"you are not authorized for that action"}`},
+		{"v2 http error", "/v2/forbidden", http.StatusForbidden, web.MIMEApplicationProblemJSON, `{"type":"about:blank","title":"Forbidden","status":403,"detail":"you are not authorized for that action"}`},
+		{"v2 internal error is hidden", "/v2/error", http.StatusInternalServerError, web.MIMEApplicationProblemJSON, `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Internal Server Error"}`},
+		{"v2 route not found", "/v2/missing", http.StatusNotFound, web.MIMEApplicationProblemJSON, `{"type":"about:blank","title":"Not Found","status":404,"detail":"Not Found"}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.description, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			require.Equal(t, tc.code, rec.Code)
+			assert.Equal(t, tc.contentType, rec.Header().Get(echo.HeaderContentType))
+			assert.JSONEq(t, tc.body, rec.Body.String())
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	newContext := func(e *echo.Echo) echo.Context {
+		req := httptest.NewRequest(echo.GET, "/", nil)
+		req.RemoteAddr = "203.0.113.57:4321"
+		req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.7")
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	t.Run("forwarded headers are ignored without extractor", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.57", web.ClientIP(newContext(echo.New())))
+	})
+
+	t.Run("extractor", func(t *testing.T) {
+		e := echo.New()
+		e.IPExtractor = func(req *http.Request) string {
+			return req.Header.Get(echo.HeaderXForwardedFor)
+		}
+		assert.Equal(t, "198.51.100.7", web.ClientIP(newContext(e)))
+	})
+}
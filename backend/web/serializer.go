@@ -0,0 +1,28 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/semka95/shortener/backend/domain"
+)
+
+// HeaderXTraceID is the response header that carries trace id of the request
+const HeaderXTraceID = "X-Trace-ID"
+
+// JSONSerializer encodes responses like echo.DefaultJSONSerializer and adds
+// trace id from X-Trace-ID response header to server error bodies
+type JSONSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+// Serialize converts an interface into a json and writes it to the response
+func (s JSONSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	if re, ok := i.(domain.ResponseError); ok && c.Response().Status >= http.StatusInternalServerError {
+		re.TraceID = c.Response().Header().Get(HeaderXTraceID)
+		i = re
+	}
+
+	return s.DefaultJSONSerializer.Serialize(c, i, indent)
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/tracing"
+)
+
+// Propagator returns W3C trace context and baggage propagator used for
+// inbound and outbound requests
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// TracingTransport is http.RoundTripper that starts client span for every
+// outbound request and injects its context into request headers
+type TracingTransport struct {
+	base       http.RoundTripper
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracingTransport wraps base transport, http.DefaultTransport is used
+// when base is nil
+func NewTracingTransport(base http.RoundTripper, tracer trace.Tracer) *TracingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &TracingTransport{
+		base:       base,
+		tracer:     tracing.Tracer(tracer),
+		propagator: Propagator(),
+	}
+}
+
+// RoundTrip executes a single HTTP transaction
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(
+		req.Context(),
+		fmt.Sprintf("HTTP %s", req.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", req.URL.Redacted()),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+
+	return res, nil
+}
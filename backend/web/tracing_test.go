@@ -0,0 +1,80 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/semka95/shortener/backend/web"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentID    = "00f067aa0ba902b7"
+)
+
+func TestInboundPropagation(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	e := echo.New()
+	e.Use(otelecho.Middleware("test", otelecho.WithTracerProvider(tp), otelecho.WithPropagators(web.Propagator())))
+	e.GET("/", func(c echo.Context) error {
+		_, span := tp.Tracer("").Start(c.Request().Context(), "handler")
+		span.End()
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(echo.GET, "/", nil)
+	req.Header.Set("traceparent", traceparent)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+	}
+	server := spans[1]
+	assert.Equal(t, parentID, server.Parent().SpanID().String())
+	assert.True(t, server.Parent().IsRemote())
+}
+
+func TestTracingTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("")
+	ctx, parent := tracer.Start(context.Background(), "usecase")
+	defer parent.End()
+
+	client := &http.Client{Timeout: time.Second, Transport: web.NewTracingTransport(nil, tracer)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+	clientSpan := spans[0]
+	assert.Equal(t, trace.SpanKindClient, clientSpan.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), clientSpan.Parent().SpanID())
+	assert.Equal(t, "00-"+parent.SpanContext().TraceID().String()+"-"+clientSpan.SpanContext().SpanID().String()+"-01", got)
+}
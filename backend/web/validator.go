@@ -1,13 +1,17 @@
 package web
 
 import (
+	"errors"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 	enTranslations "github.com/go-playground/validator/v10/translations/en"
+
+	"github.com/semka95/shortener/backend/domain"
 )
 
 // AppValidator represents validation struct
@@ -35,6 +39,17 @@ func NewAppValidator() (*AppValidator, error) {
 		return nil, err
 	}
 
+	// default translations miss required_without, parameter is Go field name
+	err = av.V.RegisterTranslation("required_without", av.Translator, func(ut ut.Translator) error {
+		return ut.Add("required_without", "{0} is required when {1} is not set", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("required_without", fe.Field(), strings.ToLower(fe.Param()))
+		return t
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	av.V.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
 		if name == "-" {
@@ -50,3 +65,65 @@ func NewAppValidator() (*AppValidator, error) {
 func (av *AppValidator) Validate(i interface{}) error {
 	return av.V.Struct(i)
 }
+
+// TranslateItems translates err of payload holding list of items, e.g.
+// validated with dive. Errors inside items are returned as items with index
+// of the item, so clients can map them back to items they sent. Other errors,
+// e.g. of list length or of Var validations without namespace, are
+// translated as ValidationErrors.Translate does. Both are nil if err is not
+// validator.ValidationErrors.
+func (av *AppValidator) TranslateItems(err error) ([]domain.ItemError, validator.ValidationErrorsTranslations) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil, nil
+	}
+
+	var items []domain.ItemError
+	var fields validator.ValidationErrorsTranslations
+	for _, fe := range verrs {
+		index, field, ok := itemPath(fe.Namespace())
+		if !ok {
+			if fields == nil {
+				fields = make(validator.ValidationErrorsTranslations)
+			}
+			fields[fe.Namespace()] = av.translate(fe)
+			continue
+		}
+		items = append(items, domain.ItemError{Index: index, Field: field, Message: av.translate(fe)})
+	}
+
+	return items, fields
+}
+
+// translate translates fe, translations start with field name, so value
+// validated with Var without name is called value
+func (av *AppValidator) translate(fe validator.FieldError) string {
+	msg := fe.Translate(av.Translator)
+	if fe.Field() == "" && strings.HasPrefix(msg, " ") {
+		msg = "value" + msg
+	}
+	return msg
+}
+
+// itemPath splits namespace of field inside list item, e.g.
+// LookupURLs.ids[3] or [3].link, into index of the item and path of the
+// field inside it. It is not ok when namespace has no list index.
+func itemPath(namespace string) (index int, field string, ok bool) {
+	start := strings.IndexByte(namespace, '[')
+	if start < 0 {
+		return 0, "", false
+	}
+	end := strings.IndexByte(namespace[start:], ']')
+	if end < 0 {
+		return 0, "", false
+	}
+	end += start
+
+	// keys of maps are not indexes
+	index, err := strconv.Atoi(namespace[start+1 : end])
+	if err != nil || index < 0 {
+		return 0, "", false
+	}
+
+	return index, strings.TrimPrefix(namespace[end+1:], "."), true
+}
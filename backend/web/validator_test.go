@@ -0,0 +1,113 @@
+package web_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/semka95/shortener/backend/domain"
+	"github.com/semka95/shortener/backend/web"
+)
+
+type testRow struct {
+	Link  string   `json:"link" validate:"required,url"`
+	Title string   `json:"title" validate:"max=5"`
+	Tags  []string `json:"tags" validate:"dive,alpha"`
+	From  int      `json:"from"`
+	To    int      `json:"to"`
+}
+
+type testImport struct {
+	Name string            `json:"name" validate:"required"`
+	Rows []testRow         `json:"rows" validate:"required,max=4,dive"`
+	Meta map[string]string `json:"meta" validate:"dive,required"`
+}
+
+func TestAppValidator_TranslateItems(t *testing.T) {
+	v, err := web.NewAppValidator()
+	require.NoError(t, err)
+	v.V.RegisterStructValidation(func(sl validator.StructLevel) {
+		row := sl.Current().Interface().(testRow)
+		if row.From > row.To {
+			sl.ReportError(row.From, "from", "From", "ltefield", "to")
+		}
+	}, testRow{})
+
+	t.Run("multiple failing rows", func(t *testing.T) {
+		err := v.V.Struct(testImport{
+			Name: "import",
+			Rows: []testRow{
+				{Link: "https://example.org"},
+				{Link: "example", Title: "too long"},
+				{Link: "https://example.org"},
+				{Link: "https://example.org", Tags: []string{"ok", "n0t"}, From: 2, To: 1},
+			},
+		})
+
+		items, fields := v.TranslateItems(err)
+
+		assert.Nil(t, fields)
+		assert.Equal(t, []domain.ItemError{
+			{Index: 1, Field: "link", Message: "link must be a valid URL"},
+			{Index: 1, Field: "title", Message: "title must be a maximum of 5 characters in length"},
+			{Index: 3, Field: "tags[1]", Message: "tags[1] can only contain alphabetic characters"},
+			{Index: 3, Field: "from", Message: "from must be less than or equal to to"},
+		}, items)
+	})
+
+	t.Run("errors outside rows", func(t *testing.T) {
+		err := v.V.Struct(testImport{
+			Rows: make([]testRow, 5),
+			Meta: map[string]string{"source": ""},
+		})
+
+		items, fields := v.TranslateItems(err)
+
+		assert.Empty(t, items)
+		assert.Equal(t, validator.ValidationErrorsTranslations{
+			"testImport.name":         "name is a required field",
+			"testImport.rows":         "rows must contain at maximum 4 items",
+			"testImport.meta[source]": "meta[source] is a required field",
+		}, fields)
+	})
+
+	t.Run("slice validated with Var", func(t *testing.T) {
+		err := v.V.Var([]testRow{{Link: "https://example.org"}, {}}, "dive")
+
+		items, fields := v.TranslateItems(err)
+
+		assert.Nil(t, fields)
+		assert.Equal(t, []domain.ItemError{{Index: 1, Field: "link", Message: "link is a required field"}}, items)
+	})
+
+	t.Run("scalar items validated with Var", func(t *testing.T) {
+		err := v.V.Var([]string{"abc", "", "d3f"}, "dive,required,alpha")
+
+		items, fields := v.TranslateItems(err)
+
+		assert.Nil(t, fields)
+		assert.Equal(t, []domain.ItemError{
+			{Index: 1, Message: "[1] is a required field"},
+			{Index: 2, Message: "[2] can only contain alphabetic characters"},
+		}, items)
+	})
+
+	t.Run("field without namespace", func(t *testing.T) {
+		err := v.V.Var("", "required")
+
+		items, fields := v.TranslateItems(err)
+
+		assert.Nil(t, items)
+		assert.Equal(t, validator.ValidationErrorsTranslations{"": "value is a required field"}, fields)
+	})
+
+	t.Run("not validation errors", func(t *testing.T) {
+		items, fields := v.TranslateItems(errors.New("unexpected error"))
+
+		assert.Nil(t, items)
+		assert.Nil(t, fields)
+	})
+}